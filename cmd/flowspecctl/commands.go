@@ -0,0 +1,636 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package main
+
+import (
+	"bufio"
+	"compress/bzip2"
+	"compress/gzip"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/actions"
+	"floofspectools/flowspecinternal/analysis"
+	"floofspectools/flowspecinternal/mrt"
+	"floofspectools/flowspecinternal/query"
+	"floofspectools/flowspecinternal/rib"
+	"floofspectools/flowspecinternal/simulate"
+	"floofspectools/flowspecinternal/store"
+)
+
+// rule renders an actions.Rule in the input syntax.
+type rule actions.Rule
+
+func (r rule) String() string {
+	acts := make([]string, 0, len(r.Actions))
+	for _, a := range r.Actions {
+		acts = append(acts, a.String())
+	}
+	if len(acts) == 0 {
+		acts = append(acts, "accept")
+	}
+	return "match " + r.Components.String() + " then " + strings.Join(acts, " ")
+}
+
+// lines calls fn for every line of name (stdin for "" and "-") that is not
+// blank or a "#" comment.
+func lines(name string, stdin io.Reader, fn func(n int, line string) error) error {
+	r := stdin
+	if name != "" && name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := fn(n, line); err != nil {
+			if name == "" {
+				name = "-"
+			}
+			return fmt.Errorf("%s:%d: %w", name, n, err)
+		}
+	}
+	return sc.Err()
+}
+
+func readRules(name string, stdin io.Reader) ([]actions.Rule, error) {
+	var rules []actions.Rule
+	err := lines(name, stdin, func(_ int, line string) error {
+		list, acts, err := actions.ParseRule(line)
+		if err != nil {
+			return err
+		}
+		rules = append(rules, actions.Rule{Components: list, Actions: acts})
+		return nil
+	})
+	return rules, err
+}
+
+func afiFlag(fl *flag.FlagSet) *bool {
+	return fl.Bool("6", false, "IPv6 (AFI 2) NLRI")
+}
+
+func afi(ipv6 bool) uint16 {
+	if ipv6 {
+		return fs.AFIIPv6
+	}
+	return fs.AFIIPv4
+}
+
+func runDecode(args []string, stdin io.Reader, stdout io.Writer) error {
+	fl := flag.NewFlagSet("decode", flag.ContinueOnError)
+	v6 := afiFlag(fl)
+	if err := fl.Parse(args); err != nil {
+		return err
+	}
+	decode := func(s string) error {
+		s = strings.NewReplacer("0x", "", " ", "", ":", "").Replace(s)
+		b, err := hex.DecodeString(s)
+		if err != nil {
+			return err
+		}
+		// A line may hold several NLRI as in an MP_REACH attribute.
+		for len(b) > 0 {
+			list, n, err := fs.DecodeNLRI(b, afi(*v6))
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(stdout, list)
+			b = b[n:]
+		}
+		return nil
+	}
+	if fl.NArg() == 0 {
+		return lines("", stdin, func(_ int, line string) error { return decode(line) })
+	}
+	for _, s := range fl.Args() {
+		if err := decode(s); err != nil {
+			return fmt.Errorf("%s: %w", s, err)
+		}
+	}
+	return nil
+}
+
+func runEncode(args []string, stdin io.Reader, stdout io.Writer) error {
+	fl := flag.NewFlagSet("encode", flag.ContinueOnError)
+	v6 := afiFlag(fl)
+	minimize := fl.Bool("minimize", false, "rewrite operator sequences into their shortest form first")
+	if err := fl.Parse(args); err != nil {
+		return err
+	}
+	encode := func(s string) error {
+		list, acts, err := actions.ParseRule(s)
+		if err != nil {
+			return err
+		}
+		if *minimize {
+			if list, err = list.Minimize(); err != nil {
+				return err
+			}
+		}
+		ipv6 := *v6
+		for _, c := range list.Components {
+			if c.Prefix != nil {
+				ipv6 = c.Prefix.Addr().Is6()
+			}
+		}
+		b, err := fs.EncodeNLRI(list, afi(ipv6))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "nlri %x\n", b)
+		for _, a := range acts {
+			ec := a.ExtendedCommunity()
+			fmt.Fprintf(stdout, "ext-community %x # %s\n", ec, a)
+		}
+		return nil
+	}
+	if fl.NArg() == 0 {
+		return lines("", stdin, func(_ int, line string) error { return encode(line) })
+	}
+	return encode(strings.Join(fl.Args(), " "))
+}
+
+// readRIB reads a unicast table dump with one "prefix [as-path...]
+// [originator=addr]" route per line. The neighbor AS is the left-most AS.
+func readRIB(name string) (rib.Index, error) {
+	var routes []*fs.UnicastRoute
+	err := lines(name, nil, func(_ int, line string) error {
+		f := strings.Fields(line)
+		p, err := netip.ParsePrefix(f[0])
+		if err != nil {
+			return err
+		}
+		r := &fs.UnicastRoute{Prefix: p.Masked()}
+		for _, s := range f[1:] {
+			if id, ok := strings.CutPrefix(s, "originator="); ok {
+				a, err := netip.ParseAddr(id)
+				if err != nil {
+					return fmt.Errorf("invalid originator %q", id)
+				}
+				r.OriginatorID = a.Unmap()
+				continue
+			}
+			as, err := strconv.ParseUint(s, 10, 32)
+			if err != nil {
+				return fmt.Errorf("invalid AS %q", s)
+			}
+			r.ASPath = append(r.ASPath, uint32(as))
+		}
+		if len(r.ASPath) > 0 {
+			r.NeighborAS = r.ASPath[0]
+		}
+		routes = append(routes, r)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	rib.SortRoutes(routes)
+	routes = slices.CompactFunc(routes, func(a, b *fs.UnicastRoute) bool { return a.Prefix == b.Prefix })
+	idx := rib.NewSorted()
+	return idx, idx.BulkLoad(routes)
+}
+
+// readMRTRIB reads the unicast routes of an MRT TABLE_DUMP_V2 dump,
+// decompressing ".gz" and ".bz2" files. If peer is set, only the routes of
+// the peer with that address are read.
+func readMRTRIB(name, peer string) (rib.Index, error) {
+	var opts mrt.UnicastOptions
+	if peer != "" {
+		a, err := netip.ParseAddr(peer)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -rib-peer %q", peer)
+		}
+		opts.Peer = func(p mrt.Peer) bool { return p.Address == a.Unmap() }
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var r io.Reader = bufio.NewReader(f)
+	switch {
+	case strings.HasSuffix(name, ".gz"):
+		if r, err = gzip.NewReader(r); err != nil {
+			return nil, err
+		}
+	case strings.HasSuffix(name, ".bz2"):
+		r = bzip2.NewReader(r)
+	}
+	idx := rib.NewSorted()
+	return idx, mrt.LoadUnicast(r, idx, &opts)
+}
+
+func runValidate(args []string, stdin io.Reader, stdout io.Writer) error {
+	fl := flag.NewFlagSet("validate", flag.ContinueOnError)
+	var (
+		ribFile    = fl.String("rib", "", "unicast RIB dump, one \"prefix [as-path...] [originator=addr]\" per line (required)")
+		ribMRT     = fl.Bool("rib-mrt", false, "the -rib file is an MRT TABLE_DUMP_V2 dump, e.g. of route-views, optionally .gz or .bz2 compressed")
+		ribPeer    = fl.String("rib-peer", "", "with -rib-mrt, read only the routes of the peer with this address")
+		asPath     = fl.String("as-path", "", "AS_PATH the rules were received with, space separated")
+		ebgp       = fl.Bool("ebgp", false, "rules were received over eBGP")
+		originator = fl.String("originator", "", "ORIGINATOR_ID the rules were received with")
+		allowNoDst = fl.Bool("allow-no-dst", false, "accept rules without destination prefix (RFC8955 6)")
+		emptyPath  = fl.Bool("allow-empty-as-path", false, "accept empty or confederation-only AS_PATHs (RFC9117 4.1)")
+		asJSON     = fl.Bool("json", false, "print one JSON validation result per line")
+	)
+	if err := fl.Parse(args); err != nil {
+		return err
+	}
+	if *ribFile == "" || *ribFile == "-" || fl.NArg() > 1 {
+		return fmt.Errorf("usage: flowspecctl validate -rib file [flags] [rules]")
+	}
+	var (
+		idx rib.Index
+		err error
+	)
+	if *ribMRT {
+		idx, err = readMRTRIB(*ribFile, *ribPeer)
+	} else {
+		idx, err = readRIB(*ribFile)
+	}
+	if err != nil {
+		return err
+	}
+	rules, err := readRules(fl.Arg(0), stdin)
+	if err != nil {
+		return err
+	}
+	tmpl := fs.FlowSpecRoute{FromEBGP: *ebgp}
+	for _, s := range strings.Fields(*asPath) {
+		as, err := strconv.ParseUint(s, 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid -as-path AS %q", s)
+		}
+		tmpl.ASPath = append(tmpl.ASPath, uint32(as))
+	}
+	if len(tmpl.ASPath) > 0 {
+		tmpl.NeighborAS = tmpl.ASPath[0]
+	}
+	if *originator != "" {
+		a, err := netip.ParseAddr(*originator)
+		if err != nil {
+			return fmt.Errorf("invalid -originator %q", *originator)
+		}
+		tmpl.OriginatorID = a.Unmap()
+	}
+	cfg := &fs.Config{AllowNoDestPrefix: *allowNoDst, EnableEmptyOrConfed: *emptyPath}
+
+	failed := 0
+	enc := json.NewEncoder(stdout)
+	for _, r := range rules {
+		route := tmpl
+		route.Components = r.Components
+		for _, c := range r.Components.Components {
+			if c.Type == fs.ComponentTypeDestinationPrefix {
+				route.DestPrefix = c.Prefix
+			}
+		}
+		res := fs.ValidationResult{Route: &route, Err: fs.ValidateFeasibility(&route, idx, cfg)}
+		if res.Err != nil {
+			failed++
+		}
+		switch {
+		case *asJSON:
+			if err := enc.Encode(res); err != nil {
+				return err
+			}
+		case res.Err != nil:
+			fmt.Fprintf(stdout, "infeasible %s: %v\n", rule(r), res.Err)
+		default:
+			fmt.Fprintf(stdout, "feasible %s\n", rule(r))
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%w: %d of %d rules", errInfeasible, failed, len(rules))
+	}
+	return nil
+}
+
+func sortRules(rules []actions.Rule) {
+	slices.SortStableFunc(rules, func(a, b actions.Rule) int { return fs.CompareFlowSpecKey(a.Components, b.Components) })
+}
+
+func runSort(args []string, stdin io.Reader, stdout io.Writer) error {
+	fl := flag.NewFlagSet("sort", flag.ContinueOnError)
+	if err := fl.Parse(args); err != nil {
+		return err
+	}
+	if fl.NArg() > 1 {
+		return fmt.Errorf("usage: flowspecctl sort [rules]")
+	}
+	rules, err := readRules(fl.Arg(0), stdin)
+	if err != nil {
+		return err
+	}
+	sortRules(rules)
+	for _, r := range rules {
+		fmt.Fprintln(stdout, rule(r))
+	}
+	return nil
+}
+
+// runDiff matches rules by their canonical components and prints "-" for
+// removed, "+" for added and "~" for rules whose actions changed, in RFC8955
+// 5.1 order.
+func runDiff(args []string, stdin io.Reader, stdout io.Writer) error {
+	fl := flag.NewFlagSet("diff", flag.ContinueOnError)
+	if err := fl.Parse(args); err != nil {
+		return err
+	}
+	if fl.NArg() != 2 {
+		return fmt.Errorf("usage: flowspecctl diff old new")
+	}
+	oldRules, err := readRules(fl.Arg(0), stdin)
+	if err != nil {
+		return err
+	}
+	newRules, err := readRules(fl.Arg(1), stdin)
+	if err != nil {
+		return err
+	}
+	added, removed, changed := actions.DiffRuleSets(oldRules, newRules)
+	oldActions := make(map[string][]actions.Action, len(oldRules))
+	for _, r := range oldRules {
+		oldActions[r.Components.Canonical(nil)] = r.Actions
+	}
+
+	type change struct {
+		op byte
+		r  actions.Rule
+	}
+	var changes []change
+	for _, c := range []struct {
+		op    byte
+		rules []actions.Rule
+	}{{'-', removed}, {'+', added}, {'~', changed}} {
+		for _, r := range c.rules {
+			changes = append(changes, change{op: c.op, r: r})
+		}
+	}
+	slices.SortStableFunc(changes, func(a, b change) int {
+		return fs.CompareFlowSpecKey(a.r.Components, b.r.Components)
+	})
+	for _, c := range changes {
+		if c.op == '~' {
+			fmt.Fprintf(stdout, "~ %s (was: %s)\n", rule(c.r), actions.Canonical(oldActions[c.r.Components.Canonical(nil)]))
+			continue
+		}
+		fmt.Fprintf(stdout, "%c %s\n", c.op, rule(c.r))
+	}
+	if len(changes) > 0 {
+		return errDiffers
+	}
+	return nil
+}
+
+// runAnalyze prints the findings of analysis.Analyze, or with -resolve the
+// analysis.Resolve annotations of the losing rules, with rules numbered from 1
+// in input order.
+func runAnalyze(args []string, stdin io.Reader, stdout io.Writer) error {
+	fl := flag.NewFlagSet("analyze", flag.ContinueOnError)
+	var (
+		asJSON     = fl.Bool("json", false, "print one JSON finding per line")
+		resolve    = fl.Bool("resolve", false, "print which rule of each conflict wins instead of the findings")
+		precedence = fl.String("precedence", "", "comma separated action classes for -resolve, the first wins (default discard,rate-limit,redirect,mark,accept)")
+	)
+	if err := fl.Parse(args); err != nil {
+		return err
+	}
+	if fl.NArg() > 1 {
+		return fmt.Errorf("usage: flowspecctl analyze [-json] [-resolve [-precedence classes]] [rules]")
+	}
+	var policy analysis.Policy
+	if *precedence != "" {
+		for _, s := range strings.Split(*precedence, ",") {
+			var c analysis.Class
+			if err := c.UnmarshalText([]byte(strings.TrimSpace(s))); err != nil {
+				return err
+			}
+			policy.Precedence = append(policy.Precedence, c)
+		}
+	}
+	rules, err := readRules(fl.Arg(0), stdin)
+	if err != nil {
+		return err
+	}
+	in := make([]analysis.Rule, len(rules))
+	for i, r := range rules {
+		in[i] = analysis.Rule(r)
+	}
+	enc := json.NewEncoder(stdout)
+	if *resolve {
+		res, err := analysis.Resolve(in, &policy)
+		if err != nil {
+			return err
+		}
+		for _, r := range res {
+			r.Rule++
+			r.Winner++
+			if *asJSON {
+				if err := enc.Encode(r); err != nil {
+					return err
+				}
+				continue
+			}
+			fmt.Fprintln(stdout, r)
+		}
+		return nil
+	}
+	findings, err := analysis.Analyze(in)
+	if err != nil {
+		return err
+	}
+	for _, f := range findings {
+		f.Rule++
+		f.Other++
+		if *asJSON {
+			if err := enc.Encode(f); err != nil {
+				return err
+			}
+			continue
+		}
+		fmt.Fprintln(stdout, f)
+	}
+	return nil
+}
+
+// runSimulate prints the outcome of announcing each rule to the peers of a
+// simulate.Topology.
+func runSimulate(args []string, stdin io.Reader, stdout io.Writer) error {
+	fl := flag.NewFlagSet("simulate", flag.ContinueOnError)
+	var (
+		topoFile = fl.String("topology", "", "JSON topology of the announcer and its peers, see package simulate (required)")
+		asPath   = fl.String("as-path", "", "AS_PATH the rules are announced with, before the announcer's AS, space separated")
+		asJSON   = fl.Bool("json", false, "print one JSON result per rule and peer")
+	)
+	if err := fl.Parse(args); err != nil {
+		return err
+	}
+	if *topoFile == "" || *topoFile == "-" || fl.NArg() > 1 {
+		return fmt.Errorf("usage: flowspecctl simulate -topology file [flags] [rules]")
+	}
+	f, err := os.Open(*topoFile)
+	if err != nil {
+		return err
+	}
+	topo, err := simulate.ReadTopology(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	rules, err := readRules(fl.Arg(0), stdin)
+	if err != nil {
+		return err
+	}
+	var path []uint32
+	for _, s := range strings.Fields(*asPath) {
+		as, err := strconv.ParseUint(s, 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid -as-path AS %q", s)
+		}
+		path = append(path, uint32(as))
+	}
+
+	rejected := 0
+	enc := json.NewEncoder(stdout)
+	for _, r := range rules {
+		route := &fs.FlowSpecRoute{AFI: fs.AFIIPv4, SAFI: fs.SAFIFlowSpec, ASPath: path, Components: r.Components}
+		for _, c := range r.Components.Components {
+			if c.Type == fs.ComponentTypeDestinationPrefix && c.Prefix.Addr().Is6() {
+				route.AFI = fs.AFIIPv6
+			}
+		}
+		for _, a := range r.Actions {
+			route.ExtCommunities = append(route.ExtCommunities, a.ExtendedCommunity())
+		}
+		for _, res := range simulate.Simulate(route, topo) {
+			if !res.Accepted() {
+				rejected++
+			}
+			switch {
+			case *asJSON:
+				if err := enc.Encode(res); err != nil {
+					return err
+				}
+			case !res.Accepted():
+				fmt.Fprintf(stdout, "%s: reject %s: %v\n", res.Peer, rule(r), res.Err)
+			default:
+				fmt.Fprintf(stdout, "%s: accept %s\n", res.Peer, rule(r))
+			}
+		}
+	}
+	if rejected > 0 {
+		return fmt.Errorf("%w: %d of %d announcements", errRejected, rejected, len(rules)*len(topo.Peers))
+	}
+	return nil
+}
+
+// metaFlag collects repeated -meta key=value or -meta key flags.
+type metaFlag map[string]string
+
+func (m metaFlag) String() string { return "" }
+
+func (m metaFlag) Set(s string) error {
+	k, v, _ := strings.Cut(s, "=")
+	if k == "" {
+		return fmt.Errorf("invalid metadata selector %q", s)
+	}
+	m[k] = v
+	return nil
+}
+
+// formatMetadata renders metadata as sorted key=value pairs.
+func formatMetadata(m map[string]string) string {
+	pairs := make([]string, 0, len(m))
+	for k, v := range m {
+		pairs = append(pairs, k+"="+v)
+	}
+	slices.Sort(pairs)
+	return strings.Join(pairs, " ")
+}
+
+// runRules lists the rules of a store database with their metadata.
+func runRules(args []string, stdin io.Reader, stdout io.Writer) error {
+	fl := flag.NewFlagSet("rules", flag.ContinueOnError)
+	meta := metaFlag{}
+	var (
+		db     = fl.String("db", "", "rule database of the controller, see package store (required)")
+		asJSON = fl.Bool("json", false, "print one JSON record per line")
+		q      = fl.String("q", "", "only rules matching this query, e.g. \"dst within 192.0.2.0/24 and action == discard\"")
+	)
+	fl.Var(meta, "meta", "only rules with this metadata key=value, or key with any value; repeatable")
+	if err := fl.Parse(args); err != nil {
+		return err
+	}
+	if *db == "" || fl.NArg() > 0 {
+		return fmt.Errorf("usage: flowspecctl rules -db file [-meta key=value]... [-q query] [-json]")
+	}
+	filter, err := query.Parse(*q)
+	if err != nil {
+		return err
+	}
+	// Open creates missing databases.
+	if _, err := os.Stat(*db); err != nil {
+		return err
+	}
+	s, err := store.Open(*db, nil)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	recs, err := s.Records()
+	if err != nil {
+		return err
+	}
+	match := rib.WithMetadata(meta)
+	enc := json.NewEncoder(stdout)
+	for _, rec := range recs {
+		// The database keeps no validation state, so stored rules are
+		// feasible to the query.
+		if e := (&rib.FlowSpecEntry{Route: rec.Route}); !match(e) || !filter.Match(e) {
+			continue
+		}
+		if *asJSON {
+			if err := enc.Encode(rec); err != nil {
+				return err
+			}
+			continue
+		}
+		var acts []actions.Action
+		for _, ec := range rec.Route.ExtCommunities {
+			if a, err := actions.Decode(ec); err == nil {
+				acts = append(acts, a)
+			}
+		}
+		origin := "received"
+		if rec.Local {
+			origin = "local"
+		}
+		line := fmt.Sprintf("%s # %s", rule{Components: rec.Route.Components, Actions: acts}, origin)
+		if len(rec.Route.Metadata) > 0 {
+			line += " " + formatMetadata(rec.Route.Metadata)
+		}
+		fmt.Fprintln(stdout, line)
+	}
+	return nil
+}
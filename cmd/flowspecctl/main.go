@@ -0,0 +1,75 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+// Command flowspecctl inspects and checks FlowSpec rules from the shell.
+//
+// Rules are written in the syntax of actions.ParseRule, one per line, e.g.
+//
+//	match dst 192.0.2.0/24 proto udp dport 53 then rate-limit 10M
+//
+// Usage:
+//
+//	flowspecctl decode [-6] [hex...]           hex NLRI to rules
+//	flowspecctl encode [-6] rule               rule to hex NLRI and extended communities
+//	flowspecctl validate -rib file [flags] [rules]
+//	flowspecctl sort [rules]                   rules in RFC8955 5.1 order
+//	flowspecctl diff old new                   rules removed, added and changed
+//	flowspecctl analyze [rules]                shadowed, overlapping and conflicting rules
+//	flowspecctl analyze -resolve [rules]       the winner of each conflict
+//	flowspecctl simulate -topology file [flags] [rules]
+//	flowspecctl rules -db file [-meta key=value]... [-q query]  stored rules and their metadata
+//
+// Rule and hex inputs default to standard input, "-" reads it explicitly.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Negative results exit with status 1, like diff(1), and errors with 2.
+var (
+	errDiffers    = errors.New("rule sets differ")
+	errInfeasible = errors.New("infeasible rules")
+	errRejected   = errors.New("rules rejected by peers")
+)
+
+// commands maps subcommand names to their implementation.
+var commands = map[string]func(args []string, stdin io.Reader, stdout io.Writer) error{
+	"decode":   runDecode,
+	"encode":   runEncode,
+	"validate": runValidate,
+	"sort":     runSort,
+	"diff":     runDiff,
+	"analyze":  runAnalyze,
+	"simulate": runSimulate,
+	"rules":    runRules,
+}
+
+func main() {
+	err := run(os.Args[1:], os.Stdin, os.Stdout)
+	switch {
+	case errors.Is(err, errDiffers):
+		os.Exit(1)
+	case errors.Is(err, errInfeasible), errors.Is(err, errRejected):
+		fmt.Fprintln(os.Stderr, "flowspecctl:", err)
+		os.Exit(1)
+	case err != nil:
+		fmt.Fprintln(os.Stderr, "flowspecctl:", err)
+		os.Exit(2)
+	}
+}
+
+func run(args []string, stdin io.Reader, stdout io.Writer) error {
+	if len(args) == 0 {
+		return errors.New("usage: flowspecctl decode|encode|validate|sort|diff|analyze|simulate|rules [flags] [args]")
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+	return cmd(args[1:], stdin, stdout)
+}
@@ -0,0 +1,160 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/actions"
+	"floofspectools/flowspecinternal/query"
+	"floofspectools/flowspecinternal/store"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestRun(t *testing.T) {
+	ribFile := writeFile(t, "rib.txt", "# prefix as-path\n192.0.2.0/24 64500 64496\n198.51.100.0/24 64501\n")
+	oldRules := writeFile(t, "old.txt", "match dst 192.0.2.0/24 proto udp then discard\nmatch dst 198.51.100.0/24 then rate-limit 1M\n")
+	newRules := writeFile(t, "new.txt", "match dst 192.0.2.0/24 proto udp then rate-limit 2M\nmatch dst 203.0.113.0/24 then discard\n")
+	topology := writeFile(t, "topology.json", `{"as": 64500, "router_id": "192.0.2.1", "peers": [
+		{"name": "transit", "as": 64510, "unicast": [{"prefix": "192.0.2.0/24", "neighbor_as": 64500, "as_path": [64500], "originator_id": "192.0.2.1"}]},
+		{"name": "isolated", "as": 64511}]}`)
+
+	tests := []struct {
+		name    string
+		args    []string
+		stdin   string
+		want    string
+		wantErr error
+	}{
+		{
+			name: "Encode",
+			args: []string{"encode", "match", "dst", "192.0.2.0/24", "proto", "udp", "then", "discard"},
+			want: "nlri 080118c00002038111\next-community 8006000000000000 # discard\n",
+		},
+		{
+			name: "EncodeMinimize",
+			args: []string{"encode", "-minimize", "dport >=53&<=53,=53"},
+			want: "nlri 03058135\n",
+		},
+		{
+			name: "Decode",
+			args: []string{"decode", "0x08 01 18 c0 00 02 03 81 11"},
+			want: "dst 192.0.2.0/24 proto udp\n",
+		},
+		{
+			name:  "Sort",
+			args:  []string{"sort"},
+			stdin: "dst 192.0.2.0/24\n\ndst 192.0.2.0/25 then discard\n",
+			want:  "match dst 192.0.2.0/25 then discard\nmatch dst 192.0.2.0/24 then accept\n",
+		},
+		{
+			name:    "Validate",
+			args:    []string{"validate", "-rib", ribFile, "-ebgp", "-as-path", "64500"},
+			stdin:   "dst 192.0.2.0/24\ndst 198.51.100.0/24\n",
+			want:    "feasible match dst 192.0.2.0/24 then accept\ninfeasible match dst 198.51.100.0/24 then accept: ",
+			wantErr: errInfeasible,
+		},
+		{
+			name:  "Analyze",
+			args:  []string{"analyze"},
+			stdin: "dst 192.0.2.0/24 dport 53,123 then discard\ndst 192.0.2.0/24 dport 53 then discard\n",
+			want:  "shadowed: rule 2, rule 1: dst 192.0.2.0/24 dport =53 is covered by dst 192.0.2.0/24 dport =53,=123\n",
+		},
+		{
+			name:  "AnalyzeResolve",
+			args:  []string{"analyze", "-resolve", "-precedence", "redirect"},
+			stdin: "dst 192.0.2.0/24 then redirect 65000:100\ndst 192.0.2.0/25 then discard\n",
+			want:  "rule 2 (discard) loses to rule 1 (redirect): redirect=65000:100 against discard, matched first by RFC8955 order\n",
+		},
+		{
+			name:    "Simulate",
+			args:    []string{"simulate", "-topology", topology},
+			stdin:   "dst 192.0.2.0/24 then discard\n",
+			want:    "transit: accept match dst 192.0.2.0/24 then discard\nisolated: reject match dst 192.0.2.0/24 then discard: ",
+			wantErr: errRejected,
+		},
+		{
+			name:    "Diff",
+			args:    []string{"diff", oldRules, newRules},
+			want:    "~ match dst 192.0.2.0/24 proto udp then rate-bytes 2e+06 (was: discard)\n- match dst 198.51.100.0/24 then rate-bytes 1e+06\n+ match dst 203.0.113.0/24 then discard\n",
+			wantErr: errDiffers,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := run(tt.args, strings.NewReader(tt.stdin), &out)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("run(%q) error = %v, want %v", tt.args, err, tt.wantErr)
+			}
+			if !strings.HasPrefix(out.String(), tt.want) {
+				t.Errorf("run(%q) output = %q, want prefix %q", tt.args, out.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestRules(t *testing.T) {
+	db := filepath.Join(t.TempDir(), "rules.db")
+	s, err := store.Open(db, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range []struct {
+		rule string
+		meta map[string]string
+	}{
+		{"dst 192.0.2.0/24 then discard", map[string]string{"ticket": "NOC-1", "customer": "acme"}},
+		{"dst 198.51.100.0/24 then discard", map[string]string{"customer": "other"}},
+	} {
+		list, acts, err := actions.ParseRule(r.rule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		route := &fs.FlowSpecRoute{AFI: fs.AFIIPv4, SAFI: fs.SAFIFlowSpec, Components: list, Metadata: r.meta}
+		for _, a := range acts {
+			route.ExtCommunities = append(route.ExtCommunities, a.ExtendedCommunity())
+		}
+		if err := s.Put(store.Record{Route: route, Local: true}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.Close()
+
+	var out bytes.Buffer
+	if err := run([]string{"rules", "-db", db, "-meta", "customer=acme"}, nil, &out); err != nil {
+		t.Fatal(err)
+	}
+	if want := "match dst 192.0.2.0/24 then discard # local customer=acme ticket=NOC-1\n"; out.String() != want {
+		t.Errorf("rules -meta customer=acme = %q, want %q", out.String(), want)
+	}
+	out.Reset()
+	if err := run([]string{"rules", "-db", db, "-q", "dst within 198.51.0.0/16 and action == discard"}, nil, &out); err != nil {
+		t.Fatal(err)
+	}
+	if want := "match dst 198.51.100.0/24 then discard # local customer=other\n"; out.String() != want {
+		t.Errorf("rules -q = %q, want %q", out.String(), want)
+	}
+	if err := run([]string{"rules", "-db", db, "-q", "dst near 198.51.0.0/16"}, nil, &out); !errors.Is(err, query.ErrSyntax) {
+		t.Errorf("rules with a bad query = %v", err)
+	}
+	if err := run([]string{"rules", "-db", filepath.Join(t.TempDir(), "missing.db")}, nil, &out); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("rules of a missing database = %v", err)
+	}
+}
@@ -0,0 +1,230 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+// Package actions models the FlowSpec traffic filtering actions carried
+// as BGP extended communities (RFC8955 7).
+package actions
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net/netip"
+	"strings"
+)
+
+var (
+	ErrUnknownAction = errors.New("flowspec: extended community is not a known traffic filtering action (RFC8955 7)")
+)
+
+// Extended community type and sub-type pairs as per RFC8955 7 and the IANA registry.
+const (
+	TypeTrafficRateBytes   uint16 = 0x8006
+	TypeTrafficAction      uint16 = 0x8007
+	TypeRedirectAS2        uint16 = 0x8008
+	TypeTrafficMarking     uint16 = 0x8009
+	TypeTrafficRatePackets uint16 = 0x800c
+	TypeRedirectIPv4       uint16 = 0x8108
+	TypeRedirectAS4        uint16 = 0x8208
+)
+
+// Action is a single traffic filtering action.
+type Action interface {
+	// Type returns the extended community type and sub-type.
+	Type() uint16
+	// ExtendedCommunity returns the 8 byte wire encoding.
+	ExtendedCommunity() [8]byte
+	String() string
+}
+
+// TrafficRateBytes limits matching traffic to Rate bytes per second (RFC8955 7.1).
+// A rate of 0 discards all matching traffic.
+type TrafficRateBytes struct {
+	AS   uint16
+	Rate float32
+}
+
+// TrafficRatePackets limits matching traffic to Rate packets per second (RFC8955 7.2).
+// A rate of 0 discards all matching traffic.
+type TrafficRatePackets struct {
+	AS   uint16
+	Rate float32
+}
+
+// TrafficAction carries the sample and terminal bits (RFC8955 7.3).
+type TrafficAction struct {
+	Sample bool
+	// Terminal is the T bit. Note that per RFC8955 7.3 a set bit means
+	// evaluation continues with subsequent rules.
+	Terminal bool
+}
+
+// Redirect redirects matching traffic to the VRF identified by a route target (RFC8955 7.4).
+type Redirect struct {
+	// Variant is one of TypeRedirectAS2, TypeRedirectIPv4 or TypeRedirectAS4.
+	Variant uint16
+	AS      uint32     // global administrator for the AS variants
+	Addr    netip.Addr // global administrator for the IPv4 variant
+	Value   uint32     // local administrator
+}
+
+// TrafficMarking rewrites the DSCP of matching traffic (RFC8955 7.5).
+type TrafficMarking struct {
+	DSCP uint8
+}
+
+func (TrafficRateBytes) Type() uint16   { return TypeTrafficRateBytes }
+func (TrafficRatePackets) Type() uint16 { return TypeTrafficRatePackets }
+func (TrafficAction) Type() uint16      { return TypeTrafficAction }
+func (r Redirect) Type() uint16         { return r.Variant }
+func (TrafficMarking) Type() uint16     { return TypeTrafficMarking }
+
+func rateCommunity(typ uint16, as uint16, rate float32) [8]byte {
+	var ec [8]byte
+	binary.BigEndian.PutUint16(ec[0:], typ)
+	binary.BigEndian.PutUint16(ec[2:], as)
+	binary.BigEndian.PutUint32(ec[4:], math.Float32bits(rate))
+	return ec
+}
+
+func (a TrafficRateBytes) ExtendedCommunity() [8]byte {
+	return rateCommunity(TypeTrafficRateBytes, a.AS, a.Rate)
+}
+
+func (a TrafficRatePackets) ExtendedCommunity() [8]byte {
+	return rateCommunity(TypeTrafficRatePackets, a.AS, a.Rate)
+}
+
+func (a TrafficAction) ExtendedCommunity() [8]byte {
+	var ec [8]byte
+	binary.BigEndian.PutUint16(ec[0:], TypeTrafficAction)
+	if a.Sample {
+		ec[7] |= 0x02
+	}
+	if a.Terminal {
+		ec[7] |= 0x01
+	}
+	return ec
+}
+
+func (a Redirect) ExtendedCommunity() [8]byte {
+	var ec [8]byte
+	binary.BigEndian.PutUint16(ec[0:], a.Variant)
+	switch a.Variant {
+	case TypeRedirectIPv4:
+		ip := a.Addr.As4()
+		copy(ec[2:6], ip[:])
+		binary.BigEndian.PutUint16(ec[6:], uint16(a.Value))
+	case TypeRedirectAS4:
+		binary.BigEndian.PutUint32(ec[2:], a.AS)
+		binary.BigEndian.PutUint16(ec[6:], uint16(a.Value))
+	default:
+		binary.BigEndian.PutUint16(ec[2:], uint16(a.AS))
+		binary.BigEndian.PutUint32(ec[4:], a.Value)
+	}
+	return ec
+}
+
+func (a TrafficMarking) ExtendedCommunity() [8]byte {
+	var ec [8]byte
+	binary.BigEndian.PutUint16(ec[0:], TypeTrafficMarking)
+	ec[7] = a.DSCP & 0x3f
+	return ec
+}
+
+func (a TrafficRateBytes) String() string {
+	if a.Rate == 0 {
+		return "discard"
+	}
+	return fmt.Sprintf("rate-bytes %g", a.Rate)
+}
+
+func (a TrafficRatePackets) String() string {
+	if a.Rate == 0 {
+		return "discard"
+	}
+	return fmt.Sprintf("rate-packets %g", a.Rate)
+}
+
+func (a TrafficAction) String() string {
+	var flags []string
+	if a.Sample {
+		flags = append(flags, "sample")
+	}
+	if a.Terminal {
+		flags = append(flags, "terminal")
+	}
+	if len(flags) == 0 {
+		return "traffic-action none"
+	}
+	return "traffic-action " + strings.Join(flags, ",")
+}
+
+func (a Redirect) String() string {
+	if a.Variant == TypeRedirectIPv4 {
+		return fmt.Sprintf("redirect %s:%d", a.Addr, a.Value)
+	}
+	return fmt.Sprintf("redirect %d:%d", a.AS, a.Value)
+}
+
+func (a TrafficMarking) String() string {
+	return fmt.Sprintf("mark %d", a.DSCP&0x3f)
+}
+
+// IsDiscard reports whether a drops all matching traffic.
+func IsDiscard(a Action) bool {
+	switch v := a.(type) {
+	case TrafficRateBytes:
+		return v.Rate == 0
+	case TrafficRatePackets:
+		return v.Rate == 0
+	}
+	return false
+}
+
+// Decode parses an extended community into its traffic filtering action,
+// consulting registered extensions for types not defined by RFC8955.
+// ErrUnknownAction is returned for communities that are not FlowSpec actions.
+func Decode(ec [8]byte) (Action, error) {
+	typ := binary.BigEndian.Uint16(ec[0:])
+	switch typ {
+	case TypeTrafficRateBytes:
+		return TrafficRateBytes{
+			AS:   binary.BigEndian.Uint16(ec[2:]),
+			Rate: math.Float32frombits(binary.BigEndian.Uint32(ec[4:])),
+		}, nil
+	case TypeTrafficRatePackets:
+		return TrafficRatePackets{
+			AS:   binary.BigEndian.Uint16(ec[2:]),
+			Rate: math.Float32frombits(binary.BigEndian.Uint32(ec[4:])),
+		}, nil
+	case TypeTrafficAction:
+		return TrafficAction{Sample: ec[7]&0x02 != 0, Terminal: ec[7]&0x01 != 0}, nil
+	case TypeRedirectAS2:
+		return Redirect{
+			Variant: typ,
+			AS:      uint32(binary.BigEndian.Uint16(ec[2:])),
+			Value:   binary.BigEndian.Uint32(ec[4:]),
+		}, nil
+	case TypeRedirectIPv4:
+		return Redirect{
+			Variant: typ,
+			Addr:    netip.AddrFrom4([4]byte(ec[2:6])),
+			Value:   uint32(binary.BigEndian.Uint16(ec[6:])),
+		}, nil
+	case TypeRedirectAS4:
+		return Redirect{
+			Variant: typ,
+			AS:      binary.BigEndian.Uint32(ec[2:]),
+			Value:   uint32(binary.BigEndian.Uint16(ec[6:])),
+		}, nil
+	case TypeTrafficMarking:
+		return TrafficMarking{DSCP: ec[7] & 0x3f}, nil
+	}
+	if ext, ok := Lookup(typ); ok {
+		return ext.Decode(ec)
+	}
+	return nil, ErrUnknownAction
+}
@@ -0,0 +1,51 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package actions
+
+import (
+	"errors"
+	"net/netip"
+	"testing"
+)
+
+func TestDecodeRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		action Action
+		str    string
+	}{
+		{name: "Discard (RFC8955 7.1)", action: TrafficRateBytes{AS: 65000, Rate: 0}, str: "discard"},
+		{name: "RateBytes (RFC8955 7.1)", action: TrafficRateBytes{AS: 65000, Rate: 1.25e6}, str: "rate-bytes 1.25e+06"},
+		{name: "RatePackets (RFC8955 7.2)", action: TrafficRatePackets{Rate: 1000}, str: "rate-packets 1000"},
+		{name: "TrafficAction (RFC8955 7.3)", action: TrafficAction{Sample: true, Terminal: true}, str: "traffic-action sample,terminal"},
+		{name: "RedirectAS2 (RFC8955 7.4)", action: Redirect{Variant: TypeRedirectAS2, AS: 65000, Value: 100}, str: "redirect 65000:100"},
+		{name: "RedirectIPv4 (RFC8955 7.4)", action: Redirect{Variant: TypeRedirectIPv4, Addr: netip.MustParseAddr("192.0.2.1"), Value: 7}, str: "redirect 192.0.2.1:7"},
+		{name: "RedirectAS4 (RFC8955 7.4)", action: Redirect{Variant: TypeRedirectAS4, AS: 4200000000, Value: 7}, str: "redirect 4200000000:7"},
+		{name: "Marking (RFC8955 7.5)", action: TrafficMarking{DSCP: 46}, str: "mark 46"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ec := tt.action.ExtendedCommunity()
+			got, err := Decode(ec)
+			if err != nil {
+				t.Fatalf("Decode(%x) error = %v, want <nil>", ec, err)
+			}
+			if got != tt.action {
+				t.Errorf("Decode(%x) = %#v, want %#v", ec, got, tt.action)
+			}
+			if got.String() != tt.str {
+				t.Errorf("%#v.String() = %q, want %q", got, got.String(), tt.str)
+			}
+		})
+	}
+}
+
+func TestDecodeUnknown(t *testing.T) {
+	ec := [8]byte{0x00, 0x02, 0xfd, 0xe8, 0x00, 0x00, 0x00, 0x64} // route target
+	if _, err := Decode(ec); !errors.Is(err, ErrUnknownAction) {
+		t.Errorf("Decode(%x) error = %v, want %v", ec, err, ErrUnknownAction)
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package actions
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+
+	fs "floofspectools/flowspecinternal"
+)
+
+// Canonical returns the canonical text of acts: sorted, de-duplicated
+// "key=value" tokens with rates in plain bytes or packets per second.
+//
+// Encodings with the same effect render identically: both zero rates become
+// "discard", the informational AS of rate actions is dropped and a traffic
+// action without bits set is omitted. An empty set renders as "accept".
+func Canonical(acts []Action) string {
+	var tokens []string
+	for _, a := range acts {
+		if IsDiscard(a) {
+			tokens = append(tokens, "discard")
+			continue
+		}
+		switch v := a.(type) {
+		case TrafficRateBytes:
+			tokens = append(tokens, "rate-bytes="+formatRate(v.Rate))
+		case TrafficRatePackets:
+			tokens = append(tokens, "rate-packets="+formatRate(v.Rate))
+		case TrafficAction:
+			if v.Sample {
+				tokens = append(tokens, "sample")
+			}
+			if v.Terminal {
+				tokens = append(tokens, "terminal")
+			}
+		case Redirect, TrafficMarking:
+			tokens = append(tokens, strings.Replace(a.String(), " ", "=", 1))
+		default:
+			tokens = append(tokens, strings.ReplaceAll(a.String(), " ", "_"))
+		}
+	}
+	if len(tokens) == 0 {
+		return "accept"
+	}
+	slices.Sort(tokens)
+	return strings.Join(slices.Compact(tokens), " ")
+}
+
+func formatRate(r float32) string {
+	return strconv.FormatFloat(float64(r), 'f', -1, 32)
+}
+
+// CanonicalRule returns the canonical text of a whole rule, the component
+// list and its actions separated by " then ".
+func CanonicalRule(list fs.FSComponentList, acts []Action, opts *fs.CanonicalOptions) string {
+	return list.Canonical(opts) + " then " + Canonical(acts)
+}
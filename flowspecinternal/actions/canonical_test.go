@@ -0,0 +1,54 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package actions
+
+import (
+	"net/netip"
+	"testing"
+
+	fs "floofspectools/flowspecinternal"
+)
+
+func TestCanonical(t *testing.T) {
+	tests := []struct {
+		name string
+		acts []Action
+		want string
+	}{
+		{name: "Empty", want: "accept"},
+		{name: "DiscardEitherUnit", acts: []Action{TrafficRatePackets{AS: 1}, TrafficRateBytes{AS: 2}}, want: "discard"},
+		{name: "RateNoExponent", acts: []Action{TrafficRateBytes{AS: 65000, Rate: 1.25e6}}, want: "rate-bytes=1250000"},
+		{
+			name: "Sorted",
+			acts: []Action{
+				TrafficMarking{DSCP: 46},
+				TrafficAction{Sample: true, Terminal: true},
+				Redirect{Variant: TypeRedirectIPv4, Addr: netip.MustParseAddr("192.0.2.1"), Value: 7},
+				TrafficRatePackets{Rate: 1000},
+			},
+			want: "mark=46 rate-packets=1000 redirect=192.0.2.1:7 sample terminal",
+		},
+		{name: "EmptyTrafficActionOmitted", acts: []Action{TrafficAction{}}, want: "accept"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Canonical(tt.acts); got != tt.want {
+				t.Errorf("Canonical(%v) = %q, want %q", tt.acts, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanonicalRule(t *testing.T) {
+	p := netip.MustParsePrefix("192.0.2.0/24")
+	list := fs.FSComponentList{Components: []fs.FSComponent{
+		{Type: fs.ComponentTypeDestinationPrefix, Prefix: &p},
+		{Type: fs.ComponentTypeIpProtocol, Raw: []byte{0x81, 0x11}},
+	}}
+	got := CanonicalRule(list, []Action{TrafficRateBytes{}}, &fs.CanonicalOptions{Symbolic: true})
+	if want := "dst=192.0.2.0/24 proto=udp then discard"; got != want {
+		t.Errorf("CanonicalRule() = %q, want %q", got, want)
+	}
+}
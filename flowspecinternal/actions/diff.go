@@ -0,0 +1,55 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package actions
+
+import (
+	fs "floofspectools/flowspecinternal"
+)
+
+// Rule is a component list with the actions it is announced with.
+type Rule struct {
+	Components fs.FSComponentList
+	Actions    []Action
+}
+
+// DiffRuleSets compares two rule sets by the canonical text of their
+// components. Rules only in new are added, rules only in old are removed and
+// rules in both whose canonical actions differ are returned with their new
+// actions in changedActions; announcing added and changedActions and
+// withdrawing removed turns old into new. Results keep the order of the input
+// they are taken from. When a set holds the same components more than once
+// the first rule counts.
+func DiffRuleSets(old, new []Rule) (added, removed, changedActions []Rule) {
+	oldByKey := make(map[string]Rule, len(old))
+	for _, r := range old {
+		k := r.Components.Canonical(nil)
+		if _, ok := oldByKey[k]; !ok {
+			oldByKey[k] = r
+		}
+	}
+	newKeys := make(map[string]bool, len(new))
+	for _, r := range new {
+		k := r.Components.Canonical(nil)
+		if newKeys[k] {
+			continue
+		}
+		newKeys[k] = true
+		o, ok := oldByKey[k]
+		switch {
+		case !ok:
+			added = append(added, r)
+		case Canonical(o.Actions) != Canonical(r.Actions):
+			changedActions = append(changedActions, r)
+		}
+	}
+	for _, r := range old {
+		k := r.Components.Canonical(nil)
+		if !newKeys[k] {
+			removed = append(removed, r)
+			newKeys[k] = true // report duplicates once
+		}
+	}
+	return added, removed, changedActions
+}
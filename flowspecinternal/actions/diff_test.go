@@ -0,0 +1,60 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package actions
+
+import (
+	"testing"
+)
+
+func mustRules(t *testing.T, lines ...string) []Rule {
+	t.Helper()
+	var out []Rule
+	for _, s := range lines {
+		list, acts, err := ParseRule(s)
+		if err != nil {
+			t.Fatalf("ParseRule(%q) error = %v", s, err)
+		}
+		out = append(out, Rule{Components: list, Actions: acts})
+	}
+	return out
+}
+
+func TestDiffRuleSets(t *testing.T) {
+	old := mustRules(t,
+		"dst 192.0.2.0/24 proto udp then discard",
+		"dst 198.51.100.0/24 then rate-limit 1M",
+		"dst 203.0.113.0/24 dport 80,443 then discard",
+	)
+	new := mustRules(t,
+		// Same match space and actions, encoded differently.
+		"dst 203.0.113.0/24 dport 443,80 then rate-packets 0",
+		"dst 192.0.2.0/24 proto udp then rate-limit 2M",
+		"dst 2001:db8::/32 then discard",
+		"dst 2001:db8::/32 then sample",
+	)
+	added, removed, changed := DiffRuleSets(old, new)
+
+	keys := func(rules []Rule) []string {
+		var out []string
+		for _, r := range rules {
+			out = append(out, CanonicalRule(r.Components, r.Actions, nil))
+		}
+		return out
+	}
+	for _, tt := range []struct {
+		name string
+		got  []Rule
+		want []string
+	}{
+		{"added", added, []string{"dst=2001:db8::/32 then discard"}},
+		{"removed", removed, []string{"dst=198.51.100.0/24 then rate-bytes=1000000"}},
+		{"changedActions", changed, []string{"dst=192.0.2.0/24 proto=17 then rate-bytes=2000000"}},
+	} {
+		got := keys(tt.got)
+		if len(got) != len(tt.want) || (len(got) > 0 && got[0] != tt.want[0]) {
+			t.Errorf("DiffRuleSets() %s = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package actions
+
+import (
+	"errors"
+	"math"
+	"slices"
+	"sync"
+)
+
+var (
+	ErrDuplicateAction = errors.New("flowspec: action type already registered")
+	ErrInvalidAction   = errors.New("flowspec: invalid traffic filtering action")
+	ErrIncompleteExt   = errors.New("flowspec: action extension needs a Name and a Decode function")
+)
+
+// Extension describes a custom or vendor-specific action carried in an
+// extended community type unknown to RFC8955. The action value returned by
+// Decode provides the encoding (ExtendedCommunity) and rendering (String).
+type Extension struct {
+	// Type is the extended community type and sub-type.
+	Type uint16
+	// Name identifies the extension in logs and listings.
+	Name string
+	// Decode parses the extended community into an Action.
+	Decode func(ec [8]byte) (Action, error)
+	// Validate optionally rejects semantically invalid values.
+	Validate func(a Action) error
+}
+
+var registry struct {
+	mu   sync.RWMutex
+	exts map[uint16]Extension
+}
+
+func builtin(typ uint16) bool {
+	switch typ {
+	case TypeTrafficRateBytes, TypeTrafficAction, TypeRedirectAS2, TypeTrafficMarking,
+		TypeTrafficRatePackets, TypeRedirectIPv4, TypeRedirectAS4:
+		return true
+	}
+	return false
+}
+
+// Register adds ext so that Decode and Validate handle its type.
+// Types defined by RFC8955 and types registered before cannot be replaced.
+func Register(ext Extension) error {
+	if ext.Name == "" || ext.Decode == nil {
+		return ErrIncompleteExt
+	}
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	if _, ok := registry.exts[ext.Type]; ok || builtin(ext.Type) {
+		return ErrDuplicateAction
+	}
+	if registry.exts == nil {
+		registry.exts = make(map[uint16]Extension)
+	}
+	registry.exts[ext.Type] = ext
+	return nil
+}
+
+// Unregister removes the extension for typ, mainly for tests.
+func Unregister(typ uint16) {
+	registry.mu.Lock()
+	delete(registry.exts, typ)
+	registry.mu.Unlock()
+}
+
+// Lookup returns the extension registered for typ.
+func Lookup(typ uint16) (Extension, bool) {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+	ext, ok := registry.exts[typ]
+	return ext, ok
+}
+
+// Registered returns all registered extensions ordered by type.
+func Registered() []Extension {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+	out := make([]Extension, 0, len(registry.exts))
+	for _, ext := range registry.exts {
+		out = append(out, ext)
+	}
+	slices.SortFunc(out, func(a, b Extension) int { return int(a.Type) - int(b.Type) })
+	return out
+}
+
+// Validate checks a against RFC8955 7, or against its extension's Validate.
+func Validate(a Action) error {
+	switch v := a.(type) {
+	case TrafficRateBytes:
+		return validRate(v.Rate)
+	case TrafficRatePackets:
+		return validRate(v.Rate)
+	case TrafficAction:
+		return nil
+	case Redirect:
+		switch v.Variant {
+		case TypeRedirectAS2:
+			if v.AS > math.MaxUint16 {
+				return ErrInvalidAction
+			}
+		case TypeRedirectIPv4:
+			if !v.Addr.Is4() || v.Value > math.MaxUint16 {
+				return ErrInvalidAction
+			}
+		case TypeRedirectAS4:
+			if v.Value > math.MaxUint16 {
+				return ErrInvalidAction
+			}
+		default:
+			return ErrInvalidAction
+		}
+		return nil
+	case TrafficMarking:
+		if v.DSCP > 0x3f {
+			return ErrInvalidAction
+		}
+		return nil
+	}
+	ext, ok := Lookup(a.Type())
+	if !ok {
+		return ErrUnknownAction
+	}
+	if ext.Validate != nil {
+		return ext.Validate(a)
+	}
+	return nil
+}
+
+// validRate rejects rates that are negative, NaN or infinite (RFC8955 7.1).
+func validRate(r float32) error {
+	f := float64(r)
+	if f < 0 || math.IsNaN(f) || math.IsInf(f, 0) {
+		return ErrInvalidAction
+	}
+	return nil
+}
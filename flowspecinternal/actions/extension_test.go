@@ -0,0 +1,134 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package actions
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net/netip"
+	"testing"
+)
+
+// scrub is a made-up vendor action sending traffic to scrubbing profile Profile.
+type scrub struct {
+	Profile uint32
+}
+
+const typeScrub uint16 = 0x80f0
+
+func (scrub) Type() uint16 { return typeScrub }
+
+func (a scrub) ExtendedCommunity() [8]byte {
+	var ec [8]byte
+	binary.BigEndian.PutUint16(ec[0:], typeScrub)
+	binary.BigEndian.PutUint32(ec[4:], a.Profile)
+	return ec
+}
+
+func (a scrub) String() string { return fmt.Sprintf("scrub %d", a.Profile) }
+
+var errNoProfile = errors.New("scrub: profile 0 is reserved")
+
+func scrubExtension() Extension {
+	return Extension{
+		Type: typeScrub,
+		Name: "example-scrub",
+		Decode: func(ec [8]byte) (Action, error) {
+			return scrub{Profile: binary.BigEndian.Uint32(ec[4:])}, nil
+		},
+		Validate: func(a Action) error {
+			if a.(scrub).Profile == 0 {
+				return errNoProfile
+			}
+			return nil
+		},
+	}
+}
+
+func TestRegister(t *testing.T) {
+	ec := scrub{Profile: 7}.ExtendedCommunity()
+	if _, err := Decode(ec); !errors.Is(err, ErrUnknownAction) {
+		t.Fatalf("Decode(%x) before Register error = %v, want %v", ec, err, ErrUnknownAction)
+	}
+
+	if err := Register(scrubExtension()); err != nil {
+		t.Fatalf("Register() error = %v, want <nil>", err)
+	}
+	defer Unregister(typeScrub)
+
+	got, err := Decode(ec)
+	if err != nil {
+		t.Fatalf("Decode(%x) error = %v, want <nil>", ec, err)
+	}
+	if want := (scrub{Profile: 7}); got != want {
+		t.Errorf("Decode(%x) = %#v, want %#v", ec, got, want)
+	}
+	if err := Validate(got); err != nil {
+		t.Errorf("Validate(%v) = %v, want <nil>", got, err)
+	}
+	if err := Validate(scrub{}); !errors.Is(err, errNoProfile) {
+		t.Errorf("Validate(scrub{}) = %v, want %v", err, errNoProfile)
+	}
+	if got := Canonical([]Action{scrub{Profile: 7}, TrafficMarking{DSCP: 1}}); got != "mark=1 scrub_7" {
+		t.Errorf("Canonical() = %q, want %q", got, "mark=1 scrub_7")
+	}
+	if exts := Registered(); len(exts) != 1 || exts[0].Name != "example-scrub" {
+		t.Errorf("Registered() = %v, want [example-scrub]", exts)
+	}
+}
+
+func TestRegisterErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		ext     Extension
+		wantErr error
+	}{
+		{name: "Builtin", ext: Extension{Type: TypeTrafficMarking, Name: "x", Decode: scrubExtension().Decode}, wantErr: ErrDuplicateAction},
+		{name: "NoName", ext: Extension{Type: typeScrub, Decode: scrubExtension().Decode}, wantErr: ErrIncompleteExt},
+		{name: "NoDecode", ext: Extension{Type: typeScrub, Name: "x"}, wantErr: ErrIncompleteExt},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Register(tt.ext); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Register(%v) error = %v, want %v", tt.ext.Name, err, tt.wantErr)
+			}
+		})
+	}
+
+	if err := Register(scrubExtension()); err != nil {
+		t.Fatalf("Register() error = %v, want <nil>", err)
+	}
+	defer Unregister(typeScrub)
+	if err := Register(scrubExtension()); !errors.Is(err, ErrDuplicateAction) {
+		t.Errorf("Register() twice error = %v, want %v", err, ErrDuplicateAction)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		action  Action
+		wantErr error
+	}{
+		{name: "Rate", action: TrafficRateBytes{Rate: 1000}},
+		{name: "NegativeRate", action: TrafficRateBytes{Rate: -1}, wantErr: ErrInvalidAction},
+		{name: "NaNRate", action: TrafficRatePackets{Rate: float32(math.NaN())}, wantErr: ErrInvalidAction},
+		{name: "RedirectAS2TooLarge", action: Redirect{Variant: TypeRedirectAS2, AS: 70000}, wantErr: ErrInvalidAction},
+		{name: "RedirectIPv4NoAddr", action: Redirect{Variant: TypeRedirectIPv4, Value: 1}, wantErr: ErrInvalidAction},
+		{name: "RedirectIPv4", action: Redirect{Variant: TypeRedirectIPv4, Addr: netip.MustParseAddr("192.0.2.1"), Value: 1}},
+		{name: "RedirectBadVariant", action: Redirect{Variant: TypeTrafficMarking}, wantErr: ErrInvalidAction},
+		{name: "MarkingTooLarge", action: TrafficMarking{DSCP: 64}, wantErr: ErrInvalidAction},
+		{name: "Unregistered", action: scrub{Profile: 1}, wantErr: ErrUnknownAction},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Validate(tt.action); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Validate(%v) = %v, want %v", tt.action, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package actions
+
+import (
+	"fmt"
+	"math"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	fs "floofspectools/flowspecinternal"
+)
+
+// rateSuffixes are the SI multipliers accepted after a rate.
+var rateSuffixes = map[byte]float64{'k': 1e3, 'K': 1e3, 'M': 1e6, 'G': 1e9}
+
+// ParseRule parses "match <components> then <actions>", e.g.
+// "match dst 10.0.0.0/8 proto udp dport 53 then rate-limit 10M". The
+// components use the syntax of fs.ParseComponents and the actions that of
+// ParseActions. "match" may be omitted; a rule without "then" has no actions.
+func ParseRule(s string) (fs.FSComponentList, []Action, error) {
+	s = strings.TrimSpace(s)
+	if f := strings.Fields(s); len(f) > 0 && f[0] == "match" {
+		s = s[len("match"):]
+	}
+	match, then, _ := strings.Cut(" "+s+" ", " then ")
+	list, err := fs.ParseComponents(match)
+	if err != nil {
+		return fs.FSComponentList{}, nil, err
+	}
+	acts, err := ParseActions(then)
+	if err != nil {
+		return fs.FSComponentList{}, nil, err
+	}
+	return list, acts, nil
+}
+
+// ParseActions parses a space-separated list of actions:
+//
+//	accept                  no action
+//	discard                 traffic-rate 0
+//	rate-limit <rate>       traffic-rate in bytes per second, also "rate-bytes"
+//	rate-packets <rate>     traffic-rate in packets per second
+//	sample, terminal        traffic-action bits, also "traffic-action sample,terminal"
+//	redirect <asn|ipv4>:<n> redirect to a route target
+//	mark <dscp>             traffic-marking
+//
+// Rates take an optional k, M or G suffix, so "10M" is 10,000,000. The forms
+// produced by Action.String parse back to the same action.
+func ParseActions(s string) ([]Action, error) {
+	f := strings.Fields(s)
+	var (
+		acts []Action
+		ta   TrafficAction
+	)
+	for i := 0; i < len(f); i++ {
+		kw := f[i]
+		switch kw {
+		case "accept":
+			continue
+		case "discard":
+			acts = append(acts, TrafficRateBytes{})
+			continue
+		case "sample", "terminal":
+			ta.Sample = ta.Sample || kw == "sample"
+			ta.Terminal = ta.Terminal || kw == "terminal"
+			continue
+		}
+		if i+1 == len(f) {
+			return nil, fmt.Errorf("%w: %q lacks a value", fs.ErrSyntax, kw)
+		}
+		i++
+		var (
+			a   Action
+			err error
+		)
+		switch kw {
+		case "rate-limit", "rate-bytes":
+			var r float32
+			r, err = parseRate(f[i])
+			a = TrafficRateBytes{Rate: r}
+		case "rate-packets":
+			var r float32
+			r, err = parseRate(f[i])
+			a = TrafficRatePackets{Rate: r}
+		case "redirect":
+			a, err = parseRedirect(f[i])
+		case "mark":
+			var d uint64
+			if d, err = strconv.ParseUint(f[i], 10, 8); err != nil {
+				err = fmt.Errorf("%w: %v", fs.ErrSyntax, err)
+			}
+			a = TrafficMarking{DSCP: uint8(d)}
+		case "traffic-action":
+			if f[i] == "none" {
+				continue
+			}
+			for _, bit := range strings.Split(f[i], ",") {
+				switch bit {
+				case "sample":
+					ta.Sample = true
+				case "terminal":
+					ta.Terminal = true
+				default:
+					return nil, fmt.Errorf("%w: unknown traffic-action bit %q", fs.ErrSyntax, bit)
+				}
+			}
+			continue
+		default:
+			return nil, fmt.Errorf("%w: unknown action %q", fs.ErrSyntax, kw)
+		}
+		if err == nil {
+			err = Validate(a)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s %s: %w", kw, f[i], err)
+		}
+		acts = append(acts, a)
+	}
+	if ta != (TrafficAction{}) {
+		acts = append(acts, ta)
+	}
+	return acts, nil
+}
+
+func parseRate(s string) (float32, error) {
+	mult := 1.0
+	if m, ok := rateSuffixes[s[len(s)-1]]; ok {
+		mult, s = m, s[:len(s)-1]
+	}
+	r, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", fs.ErrSyntax, err)
+	}
+	if r *= mult; r > math.MaxFloat32 {
+		return 0, ErrInvalidAction
+	}
+	return float32(r), nil
+}
+
+// parseRedirect picks the 2-octet AS variant where the AS fits.
+func parseRedirect(s string) (Action, error) {
+	i := strings.LastIndexByte(s, ':')
+	if i < 0 {
+		return nil, fmt.Errorf("%w: redirect target %q is not <admin>:<value>", fs.ErrSyntax, s)
+	}
+	val, err := strconv.ParseUint(s[i+1:], 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", fs.ErrSyntax, err)
+	}
+	if addr, err := netip.ParseAddr(s[:i]); err == nil {
+		return Redirect{Variant: TypeRedirectIPv4, Addr: addr, Value: uint32(val)}, nil
+	}
+	as, err := strconv.ParseUint(s[:i], 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", fs.ErrSyntax, err)
+	}
+	r := Redirect{Variant: TypeRedirectAS4, AS: uint32(as), Value: uint32(val)}
+	if as <= math.MaxUint16 {
+		r.Variant = TypeRedirectAS2
+	}
+	return r, nil
+}
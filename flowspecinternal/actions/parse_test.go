@@ -0,0 +1,93 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package actions
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+
+	fs "floofspectools/flowspecinternal"
+)
+
+func TestParseRule(t *testing.T) {
+	tests := []struct {
+		name      string
+		in        string
+		wantRule  string
+		wantActs  []Action
+		wantError error
+	}{
+		{
+			name:     "Example",
+			in:       "match dst 10.0.0.0/8 proto udp dport 53 then rate-limit 10M",
+			wantRule: "dst 10.0.0.0/8 proto udp dport =53",
+			wantActs: []Action{TrafficRateBytes{Rate: 10e6}},
+		},
+		{
+			name:     "SortedAndMerged",
+			in:       "dport 1024-2048 proto tcp tcp-flags =syn|ack then sample discard terminal redirect 64500:7",
+			wantRule: "proto tcp dport >=1024&<=2048 tcp-flags =syn|ack",
+			wantActs: []Action{TrafficRateBytes{}, Redirect{Variant: TypeRedirectAS2, AS: 64500, Value: 7}, TrafficAction{Sample: true, Terminal: true}},
+		},
+		{
+			name:     "NoActions",
+			in:       "match src 2001:db8::/32 len >1400",
+			wantRule: "src 2001:db8::/32 len >1400",
+		},
+		{name: "UnknownAction", in: "dst 10.0.0.0/8 then police 1M", wantError: fs.ErrSyntax},
+		{name: "MissingRate", in: "dst 10.0.0.0/8 then rate-limit", wantError: fs.ErrSyntax},
+		{name: "BadDSCP", in: "dst 10.0.0.0/8 then mark 64", wantError: ErrInvalidAction},
+		{name: "Duplicate", in: "dport 53 dport 123", wantError: fs.ErrDuplicateComponent},
+		{name: "UnknownPort", in: "dport nosuchservice", wantError: fs.ErrUnknownSymbol},
+		{name: "UnknownFlag", in: "tcp-flags syn|xmas", wantError: fs.ErrSyntax},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list, acts, err := ParseRule(tt.in)
+			if !errors.Is(err, tt.wantError) {
+				t.Fatalf("ParseRule(%q) error = %v, want %v", tt.in, err, tt.wantError)
+			}
+			if err != nil {
+				return
+			}
+			if got := list.String(); got != tt.wantRule {
+				t.Errorf("ParseRule(%q) = %q, want %q", tt.in, got, tt.wantRule)
+			}
+			if !reflect.DeepEqual(acts, tt.wantActs) {
+				t.Errorf("ParseRule(%q) actions = %v, want %v", tt.in, acts, tt.wantActs)
+			}
+		})
+	}
+}
+
+// Everything Format and Action.String produce must parse back unchanged.
+func TestParseRuleRoundTrip(t *testing.T) {
+	list := fs.FSComponentList{Components: []fs.FSComponent{
+		{Type: fs.ComponentTypeIpProtocol, Raw: []byte{0x01, 0x06, 0x81, 0x11}},
+		{Type: fs.ComponentTypeDestinationPort, Raw: []byte{0x01, 0x7b, 0x13, 0x04, 0x00, 0xd5, 0x08, 0x00}},
+		{Type: fs.ComponentTypeTCPFlags, Raw: []byte{0x01, 0x12, 0x42, 0x04, 0x82, 0x01}},
+		{Type: fs.ComponentTypeFragment, Raw: []byte{0x81, 0x03}},
+	}}
+	acts := []Action{TrafficRatePackets{Rate: 1.5e6}, TrafficMarking{DSCP: 10}}
+	in := "match " + list.String() + " then " + acts[0].String() + " " + acts[1].String()
+
+	gotList, gotActs, err := ParseRule(in)
+	if err != nil {
+		t.Fatalf("ParseRule(%q) error = %v, want <nil>", in, err)
+	}
+	if len(gotList.Components) != len(list.Components) {
+		t.Fatalf("ParseRule(%q) = %d components, want %d", in, len(gotList.Components), len(list.Components))
+	}
+	for i, c := range list.Components {
+		if g := gotList.Components[i]; g.Type != c.Type || !bytes.Equal(g.Raw, c.Raw) {
+			t.Errorf("ParseRule(%q) component %d = %s %x, want %s %x", in, i, g.Type, g.Raw, c.Type, c.Raw)
+		}
+	}
+	if !reflect.DeepEqual(gotActs, acts) {
+		t.Errorf("ParseRule(%q) actions = %v, want %v", in, gotActs, acts)
+	}
+}
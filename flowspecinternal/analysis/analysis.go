@@ -0,0 +1,334 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+// Package analysis finds rules in a rule set that never match, overlap or
+// contradict each other.
+//
+// Every rule is reduced to the set of packets it matches, one value set per
+// component type, and rules are compared pairwise in RFC8955 5.1 evaluation
+// order. The comparison is exact per component but does not relate different
+// component types: a "port" component is not compared with "dport" or "sport",
+// so shadowing through such combinations, or through the union of several
+// earlier rules, is not reported.
+package analysis
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"slices"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/actions"
+)
+
+var (
+	ErrUnknownComponent = errors.New("analysis: unknown component type")
+	ErrMissingPrefix    = errors.New("analysis: prefix component without prefix")
+	ErrUnknownKind      = errors.New("analysis: unknown finding kind")
+)
+
+// Rule is a component list with its actions.
+type Rule struct {
+	Components fs.FSComponentList
+	Actions    []actions.Action
+}
+
+// Kind classifies a Finding.
+type Kind uint8
+
+const (
+	// KindShadowed reports a rule that never matches because an earlier
+	// terminal rule matches every packet it would.
+	KindShadowed Kind = iota + 1
+	// KindOverlap reports two rules that match some packets in common.
+	KindOverlap
+	// KindConflict reports two overlapping rules whose actions contradict:
+	// discard against forwarding, actions of different classes such as a
+	// rate limit against a redirect, or different rates, markings or
+	// redirect targets. Resolve decides which rule wins.
+	KindConflict
+)
+
+var kindNames = [...]string{KindShadowed: "shadowed", KindOverlap: "overlap", KindConflict: "conflict"}
+
+func (k Kind) String() string {
+	if int(k) < len(kindNames) && kindNames[k] != "" {
+		return kindNames[k]
+	}
+	return fmt.Sprintf("kind-%d", uint8(k))
+}
+
+func (k Kind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+func (k *Kind) UnmarshalText(b []byte) error {
+	i := slices.Index(kindNames[:], string(b))
+	if i <= 0 {
+		return fmt.Errorf("%w: %q", ErrUnknownKind, b)
+	}
+	*k = Kind(i)
+	return nil
+}
+
+// Finding relates Rule to an Other rule evaluated before it. Both are indexes
+// into the slice passed to Analyze.
+type Finding struct {
+	Kind   Kind   `json:"kind"`
+	Rule   int    `json:"rule"`
+	Other  int    `json:"other"`
+	Detail string `json:"detail"`
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%s: rule %d, rule %d: %s", f.Kind, f.Rule, f.Other, f.Detail)
+}
+
+// Analyze compares every pair of rules and returns the findings in evaluation
+// order. A rule is reported shadowed by the first rule that covers it only.
+func Analyze(rules []Rule) ([]Finding, error) {
+	spaces := make([]*space, len(rules))
+	for i, r := range rules {
+		s, err := newSpace(r.Components)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i, err)
+		}
+		spaces[i] = s
+	}
+	order := make([]int, len(rules))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		return fs.CompareFlowSpecKey(rules[a].Components, rules[b].Components)
+	})
+
+	var out []Finding
+	for j, b := range order {
+		shadowed := false
+		for _, a := range order[:j] {
+			if !spaces[a].overlaps(spaces[b]) {
+				continue
+			}
+			switch {
+			case !shadowed && terminal(rules[a].Actions) && spaces[a].contains(spaces[b]):
+				shadowed = true
+				out = append(out, Finding{Kind: KindShadowed, Rule: b, Other: a,
+					Detail: fmt.Sprintf("%s is covered by %s", rules[b].Components, rules[a].Components)})
+			default:
+				out = append(out, Finding{Kind: KindOverlap, Rule: b, Other: a,
+					Detail: fmt.Sprintf("%s overlaps %s", rules[b].Components, rules[a].Components)})
+			}
+			if why := conflict(rules[a].Actions, rules[b].Actions); why != "" {
+				out = append(out, Finding{Kind: KindConflict, Rule: b, Other: a, Detail: why})
+			}
+		}
+	}
+	return out, nil
+}
+
+// terminal reports whether evaluation stops at a rule with acts (RFC8955 7.3).
+func terminal(acts []actions.Action) bool {
+	for _, a := range acts {
+		if ta, ok := a.(actions.TrafficAction); ok && ta.Terminal {
+			return false
+		}
+	}
+	return true
+}
+
+// conflict describes how acts a and b contradict, or returns "".
+func conflict(a, b []actions.Action) string {
+	da, db := slices.ContainsFunc(a, actions.IsDiscard), slices.ContainsFunc(b, actions.IsDiscard)
+	if da != db {
+		return fmt.Sprintf("%s against %s", actions.Canonical(b), actions.Canonical(a))
+	}
+	if da {
+		return ""
+	}
+	if ca, cb := ClassOf(a), ClassOf(b); ca != cb && ca != ClassAccept && cb != ClassAccept {
+		return fmt.Sprintf("%s against %s", actions.Canonical(b), actions.Canonical(a))
+	}
+	for _, x := range a {
+		for _, y := range b {
+			if x.Type() == y.Type() && x.Type() != actions.TypeTrafficAction &&
+				actions.Canonical([]actions.Action{x}) != actions.Canonical([]actions.Action{y}) {
+				return fmt.Sprintf("%s against %s", y, x)
+			}
+		}
+	}
+	return ""
+}
+
+// space is the set of packets a rule matches. A component type absent from
+// the maps matches any value.
+type space struct {
+	prefixes map[fs.ComponentType]netip.Prefix
+	ranges   map[fs.ComponentType][]fs.ValueRange
+	bits     map[fs.ComponentType]bitset
+}
+
+// maxValues bound the numeric components by the width of their header field.
+var maxValues = map[fs.ComponentType]uint64{
+	fs.ComponentTypeIpProtocol: 0xff,
+	fs.ComponentTypeICMPType:   0xff,
+	fs.ComponentTypeICMPCode:   0xff,
+	fs.ComponentTypeDSCP:       0x3f,
+}
+
+// bitmaskWidths are the widths of the bitmask header fields in bits.
+var bitmaskWidths = map[fs.ComponentType]uint{
+	fs.ComponentTypeTCPFlags: 16,
+	fs.ComponentTypeFragment: 8,
+}
+
+func newSpace(l fs.FSComponentList) (*space, error) {
+	s := &space{
+		prefixes: map[fs.ComponentType]netip.Prefix{},
+		ranges:   map[fs.ComponentType][]fs.ValueRange{},
+		bits:     map[fs.ComponentType]bitset{},
+	}
+	for _, c := range l.Components {
+		switch {
+		case c.Type == fs.ComponentTypeDestinationPrefix || c.Type == fs.ComponentTypeSourcePrefix:
+			if c.Prefix == nil {
+				return nil, ErrMissingPrefix
+			}
+			s.prefixes[c.Type] = c.Prefix.Masked()
+		case c.Type.IsBitmask():
+			ops, err := fs.ParseBitmaskOps(c.Raw)
+			if err != nil {
+				return nil, err
+			}
+			s.bits[c.Type] = matchingValues(fs.SplitBitmaskOps(ops), bitmaskWidths[c.Type])
+		case c.Type >= fs.ComponentTypeIpProtocol && c.Type <= fs.ComponentTypeFragment:
+			ops, err := fs.ParseNumericOps(c.Raw)
+			if err != nil {
+				return nil, err
+			}
+			max, ok := maxValues[c.Type]
+			if !ok {
+				max = 0xffff
+			}
+			s.ranges[c.Type] = fs.NumericRanges(ops, max)
+		default:
+			return nil, fmt.Errorf("%w: %v", ErrUnknownComponent, c.Type)
+		}
+	}
+	return s, nil
+}
+
+// contains reports whether every packet o matches is matched by s.
+func (s *space) contains(o *space) bool {
+	for t, p := range s.prefixes {
+		q, ok := o.prefixes[t]
+		if !ok || !p.Overlaps(q) || p.Bits() > q.Bits() {
+			return false
+		}
+	}
+	for t, r := range s.ranges {
+		q, ok := o.ranges[t]
+		if !ok || !rangesContain(r, q) {
+			return false
+		}
+	}
+	for t, b := range s.bits {
+		q, ok := o.bits[t]
+		if !ok || !b.contains(q) {
+			return false
+		}
+	}
+	return true
+}
+
+// overlaps reports whether some packet is matched by both s and o.
+func (s *space) overlaps(o *space) bool {
+	for t, p := range s.prefixes {
+		if q, ok := o.prefixes[t]; ok && !p.Overlaps(q) {
+			return false
+		}
+	}
+	for t, r := range s.ranges {
+		if q, ok := o.ranges[t]; ok && len(fs.IntersectRanges(r, q)) == 0 {
+			return false
+		}
+	}
+	for t, b := range s.bits {
+		if q, ok := o.bits[t]; ok && !b.overlaps(q) {
+			return false
+		}
+	}
+	// A component matching nothing makes the rule match nothing.
+	for _, sp := range []*space{s, o} {
+		for _, r := range sp.ranges {
+			if len(r) == 0 {
+				return false
+			}
+		}
+		for _, b := range sp.bits {
+			if b.empty() {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// rangesContain reports whether the normalized ranges a cover b.
+func rangesContain(a, b []fs.ValueRange) bool {
+	for _, r := range b {
+		if !slices.ContainsFunc(a, func(x fs.ValueRange) bool { return x.From <= r.From && r.To <= x.To }) {
+			return false
+		}
+	}
+	return true
+}
+
+// bitset holds the field values a bitmask component matches.
+type bitset []uint64
+
+// matchingValues evaluates OR-ed groups of AND-ed terms as per RFC8955
+// 4.2.1.2 for every value of a width bit field.
+func matchingValues(groups [][]fs.BitmaskOp, width uint) bitset {
+	b := make(bitset, (1<<width+63)/64)
+	for v := uint64(0); v < 1<<width; v++ {
+		for _, g := range groups {
+			if slices.IndexFunc(g, func(op fs.BitmaskOp) bool { return hit(op, v) == op.Not }) < 0 {
+				b[v/64] |= 1 << (v % 64)
+				break
+			}
+		}
+	}
+	return b
+}
+
+func hit(op fs.BitmaskOp, v uint64) bool {
+	if op.Match {
+		return v&op.Value == op.Value
+	}
+	return v&op.Value != 0
+}
+
+func (b bitset) contains(o bitset) bool {
+	for i := range b {
+		if o[i]&^b[i] != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (b bitset) overlaps(o bitset) bool {
+	for i := range b {
+		if b[i]&o[i] != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (b bitset) empty() bool {
+	return !slices.ContainsFunc(b, func(w uint64) bool { return w != 0 })
+}
@@ -0,0 +1,172 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package analysis
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+
+	"floofspectools/flowspecinternal/actions"
+)
+
+func mustRule(t *testing.T, s string) Rule {
+	t.Helper()
+	list, acts, err := actions.ParseRule(s)
+	if err != nil {
+		t.Fatalf("ParseRule(%q) error = %v", s, err)
+	}
+	return Rule{Components: list, Actions: acts}
+}
+
+type pair struct {
+	kind        Kind
+	rule, other int
+}
+
+func TestAnalyze(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []string
+		want  []pair
+	}{
+		{
+			name: "Shadowed",
+			rules: []string{
+				"dst 192.0.2.0/24 proto udp dport 53,123 then discard",
+				"dst 192.0.2.0/24 proto udp dport 53 then discard",
+			},
+			want: []pair{{KindShadowed, 1, 0}},
+		},
+		{
+			name: "NotShadowedBehindNonTerminal",
+			rules: []string{
+				"dst 192.0.2.0/24 proto udp dport 53,123 then rate-limit 1M terminal",
+				"dst 192.0.2.0/24 proto udp dport 53 then rate-limit 1M",
+			},
+			want: []pair{{KindOverlap, 1, 0}},
+		},
+		{
+			name: "OverlapWithConflict",
+			rules: []string{
+				"dst 192.0.2.0/24 proto udp then discard",
+				"dst 192.0.2.0/25 proto udp,tcp then rate-limit 10M",
+			},
+			want: []pair{{KindOverlap, 0, 1}, {KindConflict, 0, 1}},
+		},
+		{
+			name: "DifferentRates",
+			rules: []string{
+				"dst 192.0.2.0/24 len 100-200 then rate-limit 1M",
+				"dst 192.0.2.0/24 len 150-300 then rate-limit 2M",
+			},
+			want: []pair{{KindOverlap, 1, 0}, {KindConflict, 1, 0}},
+		},
+		{
+			name: "Disjoint",
+			rules: []string{
+				"dst 192.0.2.0/25 then discard",
+				"dst 192.0.2.128/25 then discard",
+				"dst 198.51.100.0/24 tcp-flags =syn then discard",
+				"dst 198.51.100.0/24 tcp-flags !syn then discard",
+			},
+		},
+		{
+			name: "EmptyComponent",
+			rules: []string{
+				"dst 192.0.2.0/24 then discard",
+				"dst 192.0.2.0/24 dport >100&<50 then discard",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var rules []Rule
+			for _, s := range tt.rules {
+				rules = append(rules, mustRule(t, s))
+			}
+			findings, err := Analyze(rules)
+			if err != nil {
+				t.Fatalf("Analyze() error = %v, want <nil>", err)
+			}
+			var got []pair
+			for _, f := range findings {
+				got = append(got, pair{f.Kind, f.Rule, f.Other})
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Analyze() = %v, want %v", findings, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindingJSON(t *testing.T) {
+	in := Finding{Kind: KindConflict, Rule: 2, Other: 1, Detail: "discard against accept"}
+	b, err := json.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"kind":"conflict","rule":2,"other":1,"detail":"discard against accept"}`; string(b) != want {
+		t.Errorf("Marshal() = %s, want %s", b, want)
+	}
+	var out Finding
+	if err := json.Unmarshal(b, &out); err != nil || out != in {
+		t.Errorf("Unmarshal(%s) = %+v, %v, want %+v", b, out, err, in)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	rules := []Rule{
+		mustRule(t, "dst 192.0.2.0/24 proto udp then redirect 65000:100"),
+		mustRule(t, "dst 192.0.2.0/25 proto udp then rate-limit 10M"),
+		mustRule(t, "dst 192.0.2.0/26 proto udp dport 53 then rate-limit 1M"),
+		mustRule(t, "dst 192.0.2.0/24 proto udp dport 123 then discard"),
+	}
+	type res struct {
+		rule, winner int
+		reordered    bool
+	}
+	tests := []struct {
+		name   string
+		policy *Policy
+		want   []res
+	}{
+		{
+			// evaluation order: 2, 3, 1, 0
+			name: "Default",
+			want: []res{{1, 2, false}, {1, 3, false}, {0, 2, false}, {0, 3, false}, {0, 1, false}},
+		},
+		{
+			name:   "RedirectFirst",
+			policy: &Policy{Precedence: []Class{ClassRedirect}},
+			want:   []res{{1, 2, false}, {1, 3, false}, {2, 0, true}, {3, 0, true}, {1, 0, true}},
+		},
+		{
+			name: "Override",
+			policy: &Policy{Override: func(a, b Rule) int {
+				if ClassOf(a.Actions) == ClassRateLimit && ClassOf(b.Actions) == ClassRateLimit {
+					return 1
+				}
+				return 0
+			}},
+			want: []res{{2, 1, true}, {1, 3, false}, {0, 2, false}, {0, 3, false}, {0, 1, false}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Resolve(rules, tt.policy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var pairs []res
+			for _, r := range got {
+				pairs = append(pairs, res{r.Rule, r.Winner, r.Reordered})
+			}
+			if !slices.Equal(pairs, tt.want) {
+				t.Errorf("Resolve() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,210 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package analysis
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"floofspectools/flowspecinternal/actions"
+)
+
+var (
+	ErrUnknownClass = errors.New("analysis: unknown action class")
+)
+
+// Class groups the actions of a rule for conflict resolution.
+type Class uint8
+
+const (
+	// ClassDiscard drops the traffic, a rate of 0.
+	ClassDiscard Class = iota + 1
+	// ClassRateLimit limits it to a rate above 0.
+	ClassRateLimit
+	// ClassRedirect redirects it to a VRF or next hop.
+	ClassRedirect
+	// ClassMark rewrites its DSCP.
+	ClassMark
+	// ClassAccept forwards it unchanged.
+	ClassAccept
+)
+
+var classNames = [...]string{
+	ClassDiscard:   "discard",
+	ClassRateLimit: "rate-limit",
+	ClassRedirect:  "redirect",
+	ClassMark:      "mark",
+	ClassAccept:    "accept",
+}
+
+func (c Class) String() string {
+	if int(c) < len(classNames) && classNames[c] != "" {
+		return classNames[c]
+	}
+	return fmt.Sprintf("class-%d", uint8(c))
+}
+
+func (c Class) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+func (c *Class) UnmarshalText(b []byte) error {
+	i := slices.Index(classNames[:], string(b))
+	if i <= 0 {
+		return fmt.Errorf("%w: %q", ErrUnknownClass, b)
+	}
+	*c = Class(i)
+	return nil
+}
+
+// DefaultPrecedence lets the most restrictive action win.
+var DefaultPrecedence = []Class{ClassDiscard, ClassRateLimit, ClassRedirect, ClassMark, ClassAccept}
+
+// ClassOf returns the class of acts, the first of DefaultPrecedence any of
+// them belongs to.
+func ClassOf(acts []actions.Action) Class {
+	c := ClassAccept
+	for _, a := range acts {
+		ac := ClassAccept
+		switch v := a.(type) {
+		case actions.TrafficRateBytes, actions.TrafficRatePackets:
+			ac = ClassRateLimit
+			if actions.IsDiscard(v) {
+				ac = ClassDiscard
+			}
+		case actions.Redirect:
+			ac = ClassRedirect
+		case actions.TrafficMarking:
+			ac = ClassMark
+		}
+		c = min(c, ac)
+	}
+	return c
+}
+
+// Policy decides which of two conflicting rules wins.
+type Policy struct {
+	// Precedence ranks the action classes, the first wins. Classes not
+	// listed rank after those listed, in DefaultPrecedence order. Nil
+	// is DefaultPrecedence.
+	Precedence []Class `json:"precedence,omitempty"`
+	// Override, if set, is asked first: it returns a negative number if a
+	// wins, a positive one if b wins and 0 to leave the decision to
+	// Precedence, e.g. to pin the rules of an operator over those learned
+	// from peers.
+	Override func(a, b Rule) int `json:"-"`
+}
+
+// Resolution annotates the losing rule of a conflict. Rule and Winner are
+// indexes into the slice passed to Resolve.
+type Resolution struct {
+	Rule        int   `json:"rule"`
+	Winner      int   `json:"winner"`
+	Class       Class `json:"class"`
+	WinnerClass Class `json:"winner_class"`
+	// Overridden reports that Policy.Override decided.
+	Overridden bool `json:"overridden,omitempty"`
+	// Reordered reports that the winner is evaluated after Rule in RFC8955
+	// 5.1 order, so a router applies Rule to the shared traffic unless the
+	// rules are changed.
+	Reordered bool   `json:"reordered,omitempty"`
+	Detail    string `json:"detail"`
+}
+
+func (r Resolution) String() string {
+	s := fmt.Sprintf("rule %d (%s) loses to rule %d (%s): %s", r.Rule, r.Class, r.Winner, r.WinnerClass, r.Detail)
+	if r.Reordered {
+		s += ", matched first by RFC8955 order"
+	}
+	return s
+}
+
+// Resolve applies p, nil for the default policy, to every conflict Analyze
+// finds in rules and returns one Resolution per conflict in evaluation
+// order. Rules of the same class are decided by the lower rate for rate
+// limits of the same unit and by evaluation order otherwise.
+func Resolve(rules []Rule, p *Policy) ([]Resolution, error) {
+	findings, err := Analyze(rules)
+	if err != nil {
+		return nil, err
+	}
+	var pol Policy
+	if p != nil {
+		pol = *p
+	}
+	rank := ranks(pol.Precedence)
+	var out []Resolution
+	for _, f := range findings {
+		if f.Kind != KindConflict {
+			continue
+		}
+		// f.Other is evaluated before f.Rule
+		first, second := f.Other, f.Rule
+		c1, c2 := ClassOf(rules[first].Actions), ClassOf(rules[second].Actions)
+		winner, overridden := first, false
+		if pol.Override != nil {
+			if d := pol.Override(rules[first], rules[second]); d != 0 {
+				overridden = true
+				if d > 0 {
+					winner = second
+				}
+			}
+		}
+		if !overridden {
+			switch {
+			case rank[c2] < rank[c1]:
+				winner = second
+			case c1 == c2 && c1 == ClassRateLimit && lowerRate(rules[second].Actions, rules[first].Actions):
+				winner = second
+			}
+		}
+		r := Resolution{Rule: second, Winner: first, Class: c2, WinnerClass: c1, Overridden: overridden, Detail: f.Detail}
+		if winner == second {
+			r = Resolution{Rule: first, Winner: second, Class: c1, WinnerClass: c2, Overridden: overridden, Reordered: true, Detail: f.Detail}
+		}
+		out = append(out, r)
+	}
+	return out, nil
+}
+
+// Losers groups resolutions by losing rule.
+func Losers(res []Resolution) map[int][]Resolution {
+	out := make(map[int][]Resolution)
+	for _, r := range res {
+		out[r.Rule] = append(out[r.Rule], r)
+	}
+	return out
+}
+
+// ranks returns the rank of every class under precedence.
+func ranks(precedence []Class) map[Class]int {
+	rank := make(map[Class]int)
+	for _, c := range slices.Concat(precedence, DefaultPrecedence) {
+		if _, ok := rank[c]; !ok {
+			rank[c] = len(rank)
+		}
+	}
+	return rank
+}
+
+// lowerRate reports whether a limits to a lower rate than b in the same unit.
+func lowerRate(a, b []actions.Action) bool {
+	for _, x := range a {
+		for _, y := range b {
+			switch x := x.(type) {
+			case actions.TrafficRateBytes:
+				if y, ok := y.(actions.TrafficRateBytes); ok {
+					return x.Rate < y.Rate
+				}
+			case actions.TrafficRatePackets:
+				if y, ok := y.(actions.TrafficRatePackets); ok {
+					return x.Rate < y.Rate
+				}
+			}
+		}
+	}
+	return false
+}
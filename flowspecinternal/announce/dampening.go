@@ -0,0 +1,282 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package announce
+
+import (
+	"context"
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	fs "floofspectools/flowspecinternal"
+)
+
+// Dampening defaults, the RFC2439 values scaled to one penalty unit per
+// withdrawal.
+const (
+	DefaultPenalty     = 1000
+	DefaultSuppress    = 2000
+	DefaultReuse       = 750
+	DefaultHalfLife    = 15 * time.Minute
+	DefaultMaxSuppress = time.Hour
+)
+
+// DamperOptions configures a Damper.
+type DamperOptions struct {
+	// PerMinute caps the announcements sent in any minute, zero is
+	// unlimited. Announcements beyond it are deferred until Release.
+	// Withdrawals are never capped.
+	PerMinute int
+	// Penalty is added to a rule's figure of merit on every withdrawal of
+	// it. The figure decays exponentially with HalfLife; above Suppress
+	// announcements of the rule are held back until it decays to Reuse,
+	// but for at most MaxSuppress (RFC2439 4.2).
+	Penalty     float64
+	Suppress    float64
+	Reuse       float64
+	HalfLife    time.Duration
+	MaxSuppress time.Duration
+	// Now returns the current time, defaults to time.Now.
+	Now func() time.Time
+}
+
+// Damper is a Sender capping the announcements toward one peer and
+// suppressing rules that flap, announced and withdrawn over and over, as
+// route flap damping (RFC2439) does for unicast routes. Put one per peer
+// between its Scheduler and the peer's Sender:
+//
+//	d := announce.NewDamper(peer, &announce.DamperOptions{PerMinute: 60})
+//	s, _ := announce.New(d, nil)
+//	go d.Run(ctx, time.Second)
+//
+// Held announcements are sent by Release once the budget or the penalty
+// allows, superseded by later updates for the same NLRI. Its methods are
+// safe for concurrent use.
+type Damper struct {
+	next Sender
+	o    DamperOptions
+	// ceiling bounds the figure of merit so that suppression lasts at
+	// most MaxSuppress
+	ceiling float64
+
+	mu    sync.Mutex
+	rules map[string]*damped
+	sent  []time.Time // announcement times within the last minute
+}
+
+// damped is the dampening state of one NLRI.
+type damped struct {
+	components fs.FSComponentList
+	rd         *[8]byte
+	announced  bool // last update sent was an announcement
+	merit      float64
+	updated    time.Time // when merit was last decayed
+	flaps      int
+	suppressed bool
+	held       *Update // announcement waiting for Release
+}
+
+// NewDamper returns a Damper sending through next.
+func NewDamper(next Sender, opts *DamperOptions) *Damper {
+	var o DamperOptions
+	if opts != nil {
+		o = *opts
+	}
+	if o.Penalty <= 0 {
+		o.Penalty = DefaultPenalty
+	}
+	if o.Suppress <= 0 {
+		o.Suppress = DefaultSuppress
+	}
+	if o.Reuse <= 0 || o.Reuse >= o.Suppress {
+		o.Reuse = min(DefaultReuse, o.Suppress/2)
+	}
+	if o.HalfLife <= 0 {
+		o.HalfLife = DefaultHalfLife
+	}
+	if o.MaxSuppress <= 0 {
+		o.MaxSuppress = DefaultMaxSuppress
+	}
+	if o.Now == nil {
+		o.Now = time.Now
+	}
+	return &Damper{
+		next:    next,
+		o:       o,
+		ceiling: o.Reuse * math.Exp2(float64(o.MaxSuppress)/float64(o.HalfLife)),
+		rules:   make(map[string]*damped),
+	}
+}
+
+// decay brings the figure of merit of d to now.
+func (dm *Damper) decay(d *damped, now time.Time) {
+	if dt := now.Sub(d.updated); dt > 0 {
+		d.merit *= math.Exp2(-float64(dt) / float64(dm.o.HalfLife))
+	}
+	d.updated = now
+	if d.suppressed && d.merit <= dm.o.Reuse {
+		d.suppressed = false
+	}
+}
+
+// allow reports whether the budget has room for one more announcement at
+// now.
+func (dm *Damper) allow(now time.Time) bool {
+	dm.sent = slices.DeleteFunc(dm.sent, func(t time.Time) bool { return now.Sub(t) >= time.Minute })
+	return dm.o.PerMinute <= 0 || len(dm.sent) < dm.o.PerMinute
+}
+
+// Send implements Sender. Withdrawals are sent at once and penalize the
+// rule; announcements of suppressed rules or beyond the budget are held
+// and nil is returned.
+func (dm *Damper) Send(ctx context.Context, u Update) error {
+	key := nlriKey(u)
+	dm.mu.Lock()
+	now := dm.o.Now()
+	d := dm.rules[key]
+	if d == nil {
+		d = &damped{components: u.Components, rd: u.RD, updated: now}
+		dm.rules[key] = d
+	}
+	dm.decay(d, now)
+	if u.Withdraw {
+		d.held = nil
+		if d.announced {
+			d.flaps++
+			d.merit = min(d.merit+dm.o.Penalty, dm.ceiling)
+			if d.merit > dm.o.Suppress {
+				d.suppressed = true
+			}
+		}
+		d.announced = false
+		dm.mu.Unlock()
+		return dm.next.Send(ctx, u)
+	}
+	if d.suppressed || !dm.allow(now) {
+		d.held = &u
+		dm.mu.Unlock()
+		return nil
+	}
+	d.held = nil
+	dm.sent = append(dm.sent, now)
+	dm.mu.Unlock()
+	if err := dm.next.Send(ctx, u); err != nil {
+		dm.mu.Lock()
+		dm.sent = dm.sent[:len(dm.sent)-1]
+		dm.mu.Unlock()
+		return err
+	}
+	dm.mu.Lock()
+	d.announced = true
+	dm.mu.Unlock()
+	return nil
+}
+
+// Release sends the held announcements the penalty and budget allow, in
+// RFC8955 5.1 order, and forgets rules whose penalty decayed. A failed
+// announcement stays held and its error is returned.
+func (dm *Damper) Release(ctx context.Context) error {
+	dm.mu.Lock()
+	now := dm.o.Now()
+	var ready []*damped
+	for key, d := range dm.rules {
+		dm.decay(d, now)
+		switch {
+		case d.held != nil && !d.suppressed:
+			ready = append(ready, d)
+		case d.held == nil && !d.announced && d.merit < dm.o.Reuse/2:
+			delete(dm.rules, key)
+		}
+	}
+	slices.SortFunc(ready, func(a, b *damped) int { return fs.CompareFlowSpecKey(a.components, b.components) })
+	dm.mu.Unlock()
+
+	for _, d := range ready {
+		dm.mu.Lock()
+		u := d.held
+		if u == nil || !dm.allow(now) {
+			dm.mu.Unlock()
+			continue
+		}
+		d.held = nil
+		dm.sent = append(dm.sent, now)
+		dm.mu.Unlock()
+		if err := dm.next.Send(ctx, *u); err != nil {
+			dm.mu.Lock()
+			if d.held == nil {
+				d.held = u
+			}
+			dm.mu.Unlock()
+			return err
+		}
+		dm.mu.Lock()
+		d.announced = true
+		dm.mu.Unlock()
+	}
+	return nil
+}
+
+// Run calls Release every interval until ctx is done or a send fails.
+func (dm *Damper) Run(ctx context.Context, interval time.Duration) error {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+		if err := dm.Release(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+// Suppressed is the dampening state of a suppressed rule.
+type Suppressed struct {
+	Components fs.FSComponentList
+	RD         *[8]byte
+	// Penalty is the current figure of merit, Flaps the withdrawals
+	// counted since the rule was last forgotten.
+	Penalty float64
+	Flaps   int
+	// Reuse is when the penalty will have decayed to the reuse threshold.
+	Reuse time.Time
+	// Held reports whether an announcement of the rule waits for Reuse.
+	Held bool
+}
+
+// Suppressed returns the suppressed rules in RFC8955 5.1 order.
+func (dm *Damper) Suppressed() []Suppressed {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	now := dm.o.Now()
+	var out []Suppressed
+	for _, d := range dm.rules {
+		dm.decay(d, now)
+		if !d.suppressed {
+			continue
+		}
+		reuse := now.Add(time.Duration(math.Log2(d.merit/dm.o.Reuse) * float64(dm.o.HalfLife)))
+		out = append(out, Suppressed{Components: d.components, RD: d.rd, Penalty: d.merit, Flaps: d.flaps, Reuse: reuse, Held: d.held != nil})
+	}
+	slices.SortFunc(out, func(a, b Suppressed) int { return fs.CompareFlowSpecKey(a.Components, b.Components) })
+	return out
+}
+
+// Deferred returns the number of held announcements of rules that are not
+// suppressed, waiting for the budget.
+func (dm *Damper) Deferred() int {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	n := 0
+	for _, d := range dm.rules {
+		if d.held != nil && !d.suppressed {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,93 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package announce
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestDamperSuppression(t *testing.T) {
+	ctx := context.Background()
+	rec := &recorder{}
+	now := time.Unix(0, 0)
+	d := NewDamper(rec, &DamperOptions{HalfLife: time.Minute, Now: func() time.Time { return now }})
+
+	flap := Update{Components: dst("192.0.2.0/24")}
+	withdraw := Update{Withdraw: true, Components: flap.Components}
+	for range 3 {
+		d.Send(ctx, flap)
+		d.Send(ctx, withdraw)
+	}
+	// the third withdrawal took the penalty above 2000
+	d.Send(ctx, flap)
+	d.Send(ctx, Update{Components: dst("198.51.100.0/24")})
+	want := []string{
+		"announce dst=192.0.2.0/24", "withdraw dst=192.0.2.0/24",
+		"announce dst=192.0.2.0/24", "withdraw dst=192.0.2.0/24",
+		"announce dst=192.0.2.0/24", "withdraw dst=192.0.2.0/24",
+		"announce dst=198.51.100.0/24",
+	}
+	if !slices.Equal(rec.got, want) {
+		t.Fatalf("sent %q, want %q", rec.got, want)
+	}
+	s := d.Suppressed()
+	if len(s) != 1 || s[0].Flaps != 3 || !s[0].Held || s[0].Penalty <= DefaultSuppress {
+		t.Fatalf("Suppressed() = %+v, want the flapping rule with a held announcement", s)
+	}
+
+	// not yet decayed to 750
+	now = s[0].Reuse.Add(-time.Second)
+	if err := d.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.got) != len(want) {
+		t.Errorf("Release() before the reuse time sent %q", rec.got[len(want):])
+	}
+	now = s[0].Reuse
+	if err := d.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := rec.got[len(want):]; !slices.Equal(got, []string{"announce dst=192.0.2.0/24"}) {
+		t.Errorf("Release() at the reuse time sent %q, want the held announcement", got)
+	}
+	if s := d.Suppressed(); len(s) != 0 {
+		t.Errorf("Suppressed() after reuse = %+v, want none", s)
+	}
+}
+
+func TestDamperBudget(t *testing.T) {
+	ctx := context.Background()
+	rec := &recorder{}
+	now := time.Unix(0, 0)
+	d := NewDamper(rec, &DamperOptions{PerMinute: 2, Now: func() time.Time { return now }})
+
+	for _, p := range []string{"192.0.2.0/24", "192.0.2.0/25", "198.51.100.0/24", "203.0.113.0/24"} {
+		d.Send(ctx, Update{Components: dst(p)})
+	}
+	d.Send(ctx, Update{Withdraw: true, Components: dst("203.0.113.0/24")})
+	if want := []string{"announce dst=192.0.2.0/24", "announce dst=192.0.2.0/25", "withdraw dst=203.0.113.0/24"}; !slices.Equal(rec.got, want) {
+		t.Fatalf("sent %q, want %q", rec.got, want)
+	}
+	if n := d.Deferred(); n != 1 {
+		t.Errorf("Deferred() = %d, want 1, the withdrawn one dropped", n)
+	}
+
+	now = now.Add(30 * time.Second)
+	d.Release(ctx)
+	if len(rec.got) != 3 {
+		t.Errorf("Release() within the minute sent %q", rec.got[3:])
+	}
+	now = now.Add(30 * time.Second)
+	d.Release(ctx)
+	if got := rec.got[3:]; !slices.Equal(got, []string{"announce dst=198.51.100.0/24"}) || d.Deferred() != 0 {
+		t.Errorf("Release() after the minute sent %q, want the deferred announcement", got)
+	}
+	if s := d.Suppressed(); len(s) != 0 {
+		t.Errorf("Suppressed() = %+v, want none", s)
+	}
+}
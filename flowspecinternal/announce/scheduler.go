@@ -0,0 +1,263 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+// Package announce paces FlowSpec updates towards BGP peers.
+//
+// A Scheduler coalesces queued updates per NLRI, sends withdrawals before
+// announcements and announces in RFC8955 5.1 order, highest precedence first,
+// so a receiver never holds a broad rule without the narrower rules that take
+// precedence over it. The rate is bounded by a token bucket.
+package announce
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/actions"
+)
+
+var (
+	ErrInvalidRate = errors.New("announce: rate must be positive")
+)
+
+// Update is one announcement or withdrawal of a FlowSpec NLRI.
+type Update struct {
+	Withdraw   bool
+	Components fs.FSComponentList
+	Actions    []actions.Action // ignored for withdrawals
+	// RD, if set, makes the update a VPN FlowSpec (SAFI 134) one with this
+	// route distinguisher, imported by the VRFs of RouteTargets.
+	RD           *[8]byte
+	RouteTargets [][8]byte // ignored for withdrawals
+}
+
+// Sender delivers updates, e.g. via the embedded speaker or a GoBGP client.
+type Sender interface {
+	Send(ctx context.Context, u Update) error
+}
+
+// SenderFunc adapts a function to Sender.
+type SenderFunc func(ctx context.Context, u Update) error
+
+func (f SenderFunc) Send(ctx context.Context, u Update) error { return f(ctx, u) }
+
+// Options tunes the pacing.
+type Options struct {
+	// Rate is the sustained number of updates per second, defaults to 100.
+	Rate float64
+	// Burst is the number of updates that may be sent back to back, defaults to 1.
+	Burst int
+}
+
+// Scheduler queues and paces updates. It is safe for concurrent use.
+type Scheduler struct {
+	sender Sender
+	rate   float64
+	burst  float64
+
+	mu      sync.Mutex
+	pending map[string]Update // updates queued since the current round was built
+	round   []keyed           // current round in send order
+	wake    chan struct{}
+
+	tokens float64
+	last   time.Time
+}
+
+type keyed struct {
+	key string
+	u   Update
+}
+
+// New returns a Scheduler sending through s.
+func New(s Sender, opts *Options) (*Scheduler, error) {
+	o := Options{Rate: 100, Burst: 1}
+	if opts != nil {
+		if opts.Rate < 0 {
+			return nil, ErrInvalidRate
+		}
+		if opts.Rate > 0 {
+			o.Rate = opts.Rate
+		}
+		if opts.Burst > 0 {
+			o.Burst = opts.Burst
+		}
+	}
+	return &Scheduler{
+		sender:  s,
+		rate:    o.Rate,
+		burst:   float64(o.Burst),
+		tokens:  float64(o.Burst),
+		pending: make(map[string]Update),
+		wake:    make(chan struct{}, 1),
+	}, nil
+}
+
+// nlriKey identifies the NLRI of u by its exact encoding; updates with the same
+// key supersede each other.
+func nlriKey(u Update) string {
+	var b strings.Builder
+	if u.RD != nil {
+		fmt.Fprintf(&b, "%x/", *u.RD)
+	}
+	for _, c := range u.Components.Components {
+		fmt.Fprintf(&b, "%d:", c.Type)
+		if c.Prefix != nil {
+			b.WriteString(c.Prefix.Masked().String())
+		}
+		fmt.Fprintf(&b, "%x;", c.Raw)
+	}
+	return b.String()
+}
+
+// Enqueue queues updates. A queued update for the same NLRI is replaced.
+func (s *Scheduler) Enqueue(updates ...Update) {
+	s.mu.Lock()
+	for _, u := range updates {
+		s.pending[nlriKey(u)] = u
+	}
+	s.mu.Unlock()
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Pending returns the number of queued updates.
+func (s *Scheduler) Pending() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.pending) + len(s.round)
+}
+
+// next pops the next update to send.
+func (s *Scheduler) next() (keyed, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for {
+		if len(s.pending) > 0 && (len(s.round) == 0 || s.hasPendingWithdraw()) {
+			s.rebuild()
+		}
+		if len(s.round) == 0 {
+			return keyed{}, false
+		}
+		k := s.round[0]
+		s.round = s.round[1:]
+		if _, superseded := s.pending[k.key]; superseded {
+			continue
+		}
+		return k, true
+	}
+}
+
+func (s *Scheduler) hasPendingWithdraw() bool {
+	for _, u := range s.pending {
+		if u.Withdraw {
+			return true
+		}
+	}
+	return false
+}
+
+// rebuild merges pending into the current round and orders it:
+// withdrawals first, then announcements by RFC8955 5.1 precedence.
+func (s *Scheduler) rebuild() {
+	merged := make(map[string]Update, len(s.round)+len(s.pending))
+	for _, k := range s.round {
+		merged[k.key] = k.u
+	}
+	for key, u := range s.pending {
+		merged[key] = u
+	}
+	clear(s.pending)
+
+	s.round = s.round[:0]
+	for key, u := range merged {
+		s.round = append(s.round, keyed{key: key, u: u})
+	}
+	slices.SortFunc(s.round, func(a, b keyed) int {
+		if a.u.Withdraw != b.u.Withdraw {
+			if a.u.Withdraw {
+				return -1
+			}
+			return 1
+		}
+		if c := fs.CompareFlowSpecKey(a.u.Components, b.u.Components); c != fs.Equal {
+			return c
+		}
+		return cmp.Compare(a.key, b.key)
+	})
+}
+
+// requeue puts k back unless a newer update for its NLRI was queued meanwhile.
+func (s *Scheduler) requeue(k keyed) {
+	s.mu.Lock()
+	if _, ok := s.pending[k.key]; !ok {
+		s.round = append([]keyed{k}, s.round...)
+	}
+	s.mu.Unlock()
+}
+
+// take waits until the token bucket allows one more update.
+func (s *Scheduler) take(ctx context.Context) error {
+	now := time.Now()
+	if !s.last.IsZero() {
+		s.tokens = min(s.burst, s.tokens+now.Sub(s.last).Seconds()*s.rate)
+	}
+	s.last = now
+	if s.tokens < 1 {
+		d := time.Duration((1 - s.tokens) / s.rate * float64(time.Second))
+		t := time.NewTimer(d)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+		s.tokens, s.last = 1, time.Now()
+	}
+	s.tokens--
+	return nil
+}
+
+// Flush sends queued updates until the queue is empty. A failed update is
+// re-queued and its error returned.
+func (s *Scheduler) Flush(ctx context.Context) error {
+	for {
+		k, ok := s.next()
+		if !ok {
+			return nil
+		}
+		if err := s.take(ctx); err != nil {
+			s.requeue(k)
+			return err
+		}
+		if err := s.sender.Send(ctx, k.u); err != nil {
+			s.requeue(k)
+			return err
+		}
+	}
+}
+
+// Run flushes the queue whenever updates are enqueued, until ctx is done or a send fails.
+// Only one of Run and Flush may be active at a time.
+func (s *Scheduler) Run(ctx context.Context) error {
+	for {
+		if err := s.Flush(ctx); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-s.wake:
+		}
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package announce
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"slices"
+	"testing"
+	"time"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/actions"
+)
+
+func dst(s string, extra ...fs.FSComponent) fs.FSComponentList {
+	p := netip.MustParsePrefix(s)
+	return fs.FSComponentList{Components: append([]fs.FSComponent{{Type: fs.ComponentTypeDestinationPrefix, Prefix: &p}}, extra...)}
+}
+
+var udp = fs.FSComponent{Type: fs.ComponentTypeIpProtocol, Raw: []byte{0x81, 0x11}}
+
+type recorder struct {
+	got  []string
+	fail error
+}
+
+func (r *recorder) Send(_ context.Context, u Update) error {
+	if r.fail != nil {
+		return r.fail
+	}
+	op := "announce "
+	if u.Withdraw {
+		op = "withdraw "
+	}
+	r.got = append(r.got, op+u.Components.Canonical(nil))
+	return nil
+}
+
+func TestFlushOrder(t *testing.T) {
+	rec := &recorder{}
+	s, err := New(rec, &Options{Rate: 1e6, Burst: 1000})
+	if err != nil {
+		t.Fatalf("New() error = %v, want <nil>", err)
+	}
+	s.Enqueue(
+		Update{Components: dst("192.0.2.0/24"), Actions: []actions.Action{actions.TrafficRateBytes{}}},
+		Update{Components: dst("192.0.2.0/24", udp)},
+		Update{Withdraw: true, Components: dst("198.51.100.0/24")},
+		Update{Components: dst("192.0.2.128/25")},
+		// superseded below
+		Update{Components: dst("203.0.113.0/24")},
+	)
+	s.Enqueue(Update{Withdraw: true, Components: dst("203.0.113.0/24")})
+	if n := s.Pending(); n != 5 {
+		t.Errorf("Pending() = %d, want 5", n)
+	}
+	if err := s.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush() error = %v, want <nil>", err)
+	}
+
+	want := []string{
+		"withdraw dst=198.51.100.0/24",
+		"withdraw dst=203.0.113.0/24",
+		"announce dst=192.0.2.0/24 proto=17",
+		"announce dst=192.0.2.128/25",
+		"announce dst=192.0.2.0/24",
+	}
+	if !slices.Equal(rec.got, want) {
+		t.Errorf("Flush() sent %q, want %q", rec.got, want)
+	}
+	if n := s.Pending(); n != 0 {
+		t.Errorf("Pending() after Flush = %d, want 0", n)
+	}
+}
+
+func TestFlushRequeuesOnError(t *testing.T) {
+	errPeer := errors.New("peer down")
+	rec := &recorder{fail: errPeer}
+	s, _ := New(rec, &Options{Rate: 1e6})
+	s.Enqueue(Update{Components: dst("192.0.2.0/24")})
+	if err := s.Flush(context.Background()); !errors.Is(err, errPeer) {
+		t.Fatalf("Flush() error = %v, want %v", err, errPeer)
+	}
+	if n := s.Pending(); n != 1 {
+		t.Errorf("Pending() after failed Flush = %d, want 1", n)
+	}
+	rec.fail = nil
+	if err := s.Flush(context.Background()); err != nil || len(rec.got) != 1 {
+		t.Errorf("Flush() = %v, sent %q, want <nil> and one update", err, rec.got)
+	}
+}
+
+func TestPacing(t *testing.T) {
+	rec := &recorder{}
+	s, _ := New(rec, &Options{Rate: 100, Burst: 1})
+	for _, p := range []string{"192.0.2.0/28", "192.0.2.16/28", "192.0.2.32/28", "192.0.2.48/28", "192.0.2.64/28", "192.0.2.80/28"} {
+		s.Enqueue(Update{Components: dst(p)})
+	}
+	start := time.Now()
+	if err := s.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush() error = %v, want <nil>", err)
+	}
+	// the first update uses the burst token, five more need 10ms each
+	if elapsed := time.Since(start); elapsed < 45*time.Millisecond {
+		t.Errorf("Flush() of 6 updates at 100/s took %v, want >= 50ms", elapsed)
+	}
+}
+
+func TestRunStopsOnCancel(t *testing.T) {
+	rec := &recorder{}
+	s, _ := New(rec, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- s.Run(ctx) }()
+	s.Enqueue(Update{Components: dst("192.0.2.0/24")})
+	for s.Pending() != 0 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Run() error = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestNewInvalidRate(t *testing.T) {
+	if _, err := New(&recorder{}, &Options{Rate: -1}); !errors.Is(err, ErrInvalidRate) {
+		t.Errorf("New() error = %v, want %v", err, ErrInvalidRate)
+	}
+}
@@ -0,0 +1,300 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+// Package audit records who originated, accepted, rejected or withdrew a
+// FlowSpec rule, when and why, for post-incident reviews of automated
+// mitigations.
+//
+// A Log is an append-only JSON Lines file with one record per line:
+//
+//	{"entry": {...}, "hash": "<hex>"}
+//
+// The hash is the SHA-256 of the entry's JSON as written, and every entry
+// holds the hash of its predecessor in Prev, so editing, removing or
+// reordering lines breaks the chain. Open and Verify walk the chain and
+// report the first broken entry with ErrTampered. The chain only detects
+// tampering by someone who cannot rewrite the whole file; keep a copy of
+// the latest hash elsewhere, e.g. in the system log, to detect that too.
+package audit
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/events"
+)
+
+var (
+	ErrTampered = errors.New("audit: hash chain broken")
+	ErrClosed   = errors.New("audit: log closed")
+)
+
+// Action is the change an Entry records.
+type Action string
+
+const (
+	// Originated records a rule originated locally, e.g. through the
+	// management API.
+	Originated Action = "originated"
+	// Accepted records a received rule that passed validation.
+	Accepted Action = "accepted"
+	// Rejected records a received rule that failed validation.
+	Rejected Action = "rejected"
+	// Withdrawn records a rule withdrawn by its originator or an operator,
+	// or expired.
+	Withdrawn Action = "withdrawn"
+)
+
+// Entry is one audited change.
+type Entry struct {
+	// Seq numbers the entries from 1.
+	Seq  uint64    `json:"seq"`
+	Time time.Time `json:"time"`
+	// Action is what happened and Actor who did it: the caller of the
+	// management API, or the peer "AS<n>" of a received rule.
+	Action Action `json:"action"`
+	Actor  string `json:"actor"`
+	// Rule is the canonical form of the rule's components.
+	Rule  string            `json:"rule"`
+	Route *fs.FlowSpecRoute `json:"route,omitempty"`
+	// Reason and Error give a rejection or expiry, see fs.Reason; Comment
+	// is the reason an operator gave.
+	Reason  string `json:"reason,omitempty"`
+	Error   string `json:"error,omitempty"`
+	Comment string `json:"comment,omitempty"`
+	// Prev is the Hash of the previous entry, empty for the first.
+	Prev string `json:"prev,omitempty"`
+	// Hash is set by Append and the readers; it is not part of the hashed
+	// entry.
+	Hash string `json:"hash,omitempty"`
+}
+
+// record is one line of the file.
+type record struct {
+	Entry json.RawMessage `json:"entry"`
+	Hash  string          `json:"hash"`
+}
+
+// Options configures a Log.
+type Options struct {
+	// Sync, if set, flushes every entry to stable storage before Append
+	// returns.
+	Sync bool
+	// Logger, if set, receives the errors of entries appended for events,
+	// which have no caller to return them to.
+	Logger *slog.Logger
+	// Now returns the current time, defaults to time.Now.
+	Now func() time.Time
+}
+
+// Log is an append-only, hash chained audit log file.
+type Log struct {
+	mu   sync.Mutex
+	f    *os.File
+	o    Options
+	log  *slog.Logger
+	seq  uint64
+	last string
+}
+
+// Open opens or creates the log at path, verifying the existing entries.
+func Open(path string, opts *Options) (*Log, error) {
+	var o Options
+	if opts != nil {
+		o = *opts
+	}
+	if o.Now == nil {
+		o.Now = time.Now
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	l := &Log{f: f, o: o, log: fs.SubsystemLogger(o.Logger, fs.SubsystemAudit)}
+	err = Verify(f, func(e Entry) bool {
+		l.seq, l.last = e.Seq, e.Hash
+		return true
+	})
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// Close closes the file.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return ErrClosed
+	}
+	err := l.f.Close()
+	l.f = nil
+	return err
+}
+
+// Head returns the sequence number and hash of the last entry.
+func (l *Log) Head() (uint64, string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.seq, l.last
+}
+
+// Append chains e to the log, setting its Seq, Prev, Hash and, if zero, its
+// Time and Rule, and returns it.
+func (l *Log) Append(e Entry) (Entry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return e, ErrClosed
+	}
+	if e.Time.IsZero() {
+		e.Time = l.o.Now()
+	}
+	if e.Rule == "" && e.Route != nil {
+		e.Rule = e.Route.Components.Canonical(nil)
+	}
+	e.Seq, e.Prev, e.Hash = l.seq+1, l.last, ""
+	raw, err := json.Marshal(e)
+	if err != nil {
+		return e, err
+	}
+	e.Hash = hash(raw)
+	line, err := json.Marshal(record{Entry: raw, Hash: e.Hash})
+	if err != nil {
+		return e, err
+	}
+	if _, err := l.f.Write(append(line, '\n')); err != nil {
+		return e, err
+	}
+	if l.o.Sync {
+		if err := l.f.Sync(); err != nil {
+			return e, err
+		}
+	}
+	l.seq, l.last = e.Seq, e.Hash
+	return e, nil
+}
+
+func hash(raw []byte) string {
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// Verify reads a log from r, checks its hash chain and calls fn with every
+// entry until fn returns false. It returns an error wrapping ErrTampered at
+// the first entry whose hash, predecessor or sequence number does not match.
+func Verify(r io.Reader, fn func(Entry) bool) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 1<<20)
+	var seq uint64
+	var prev string
+	for sc.Scan() {
+		var rec record
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			return fmt.Errorf("%w: entry %d: %v", ErrTampered, seq+1, err)
+		}
+		var e Entry
+		if err := json.Unmarshal(rec.Entry, &e); err != nil {
+			return fmt.Errorf("%w: entry %d: %v", ErrTampered, seq+1, err)
+		}
+		switch {
+		case hash(rec.Entry) != rec.Hash:
+			return fmt.Errorf("%w: entry %d: hash mismatch", ErrTampered, seq+1)
+		case e.Prev != prev:
+			return fmt.Errorf("%w: entry %d: previous hash mismatch", ErrTampered, seq+1)
+		case e.Seq != seq+1:
+			return fmt.Errorf("%w: entry %d: sequence number %d", ErrTampered, seq+1, e.Seq)
+		}
+		seq, prev = e.Seq, rec.Hash
+		e.Hash = rec.Hash
+		if !fn(e) {
+			return nil
+		}
+	}
+	return sc.Err()
+}
+
+// Filter selects entries in Query. Zero fields match everything.
+type Filter struct {
+	// Since and Until bound the entry time, Until exclusive.
+	Since, Until time.Time
+	Actions      []Action
+	Actor        string
+	// Rule is the canonical form of the rule.
+	Rule string
+	// Limit, if positive, keeps only the latest Limit matching entries.
+	Limit int
+}
+
+// Match reports whether e is selected by f, ignoring Limit.
+func (f *Filter) Match(e *Entry) bool {
+	return (f.Since.IsZero() || !e.Time.Before(f.Since)) &&
+		(f.Until.IsZero() || e.Time.Before(f.Until)) &&
+		(len(f.Actions) == 0 || slices.Contains(f.Actions, e.Action)) &&
+		(f.Actor == "" || e.Actor == f.Actor) &&
+		(f.Rule == "" || e.Rule == f.Rule)
+}
+
+// Query returns the entries matching f in log order, verifying the chain as
+// it reads the file.
+func (l *Log) Query(f Filter) ([]Entry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return nil, ErrClosed
+	}
+	var out []Entry
+	err := Verify(io.NewSectionReader(l.f, 0, 1<<62), func(e Entry) bool {
+		if f.Match(&e) {
+			out = append(out, e)
+			if f.Limit > 0 && len(out) > f.Limit {
+				out = slices.Delete(out, 0, 1)
+			}
+		}
+		return true
+	})
+	return out, err
+}
+
+// Observe records a RuleAccepted, RuleRejected or RuleWithdrawn event with
+// the peer of the route as actor.
+func (l *Log) Observe(ev events.Event) {
+	var action Action
+	switch ev.Kind {
+	case events.RuleAccepted:
+		action = Accepted
+	case events.RuleRejected:
+		action = Rejected
+	case events.RuleWithdrawn:
+		action = Withdrawn
+	default:
+		return
+	}
+	e := Entry{Action: action, Actor: fmt.Sprintf("AS%d", ev.Route.NeighborAS), Rule: ev.Route.Components.Canonical(nil), Route: ev.Route}
+	if ev.Err != nil {
+		e.Reason, e.Error = fs.Reason(ev.Err), ev.Err.Error()
+	}
+	if _, err := l.Append(e); err != nil {
+		l.log.Error("appending audit entry", "event", ev.Kind.String(), fs.LogKeyRule, e.Rule, "error", err)
+	}
+}
+
+// Subscribe records the changes published on bus, typically the Events of
+// the received FlowSpecRIB, until cancel is called.
+func (l *Log) Subscribe(bus *events.Bus) (cancel func()) {
+	return bus.Subscribe(l.Observe, events.RuleAccepted, events.RuleRejected, events.RuleWithdrawn)
+}
@@ -0,0 +1,127 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package audit
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/events"
+)
+
+func route(t *testing.T, s string, as uint32) *fs.FlowSpecRoute {
+	t.Helper()
+	l, err := fs.ParseComponents(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &fs.FlowSpecRoute{AFI: fs.AFIIPv4, NeighborAS: as, Components: l, DestPrefix: l.Components[0].Prefix}
+}
+
+func TestLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	opts := &Options{Now: func() time.Time { now = now.Add(time.Minute); return now }}
+	l, err := Open(path, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bus := events.NewBus()
+	l.Subscribe(bus)
+	r := route(t, "dst 192.0.2.0/24", 64500)
+	if _, err := l.Append(Entry{Action: Originated, Actor: "alice", Route: r, Comment: "ticket 42"}); err != nil {
+		t.Fatal(err)
+	}
+	bus.Publish(events.Event{Kind: events.RuleRejected, Route: r, Err: fs.ErrNoBestUnicast})
+	bus.Publish(events.Event{Kind: events.RuleRevalidated, Route: r})
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reopening continues the chain.
+	if l, err = Open(path, opts); err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	last, err := l.Append(Entry{Action: Withdrawn, Actor: "bob", Route: r})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seq, h := l.Head(); seq != 3 || h != last.Hash || last.Prev == "" {
+		t.Errorf("Head() = %d %s, last appended %+v", seq, h, last)
+	}
+
+	all, err := l.Query(Filter{})
+	if err != nil || len(all) != 3 {
+		t.Fatalf("Query() = %d entries, %v; want 3", len(all), err)
+	}
+	if e := all[1]; e.Action != Rejected || e.Actor != "AS64500" || e.Reason != "no-best-unicast" || e.Rule != r.Components.Canonical(nil) {
+		t.Errorf("event entry = %+v", e)
+	}
+	tests := []struct {
+		name string
+		f    Filter
+		want []uint64
+	}{
+		{"actor", Filter{Actor: "alice"}, []uint64{1}},
+		{"actions", Filter{Actions: []Action{Originated, Withdrawn}}, []uint64{1, 3}},
+		{"time", Filter{Since: all[1].Time, Until: all[2].Time}, []uint64{2}},
+		{"limit", Filter{Limit: 2}, []uint64{2, 3}},
+		{"rule", Filter{Rule: "dst 198.51.100.0/24"}, nil},
+	}
+	for _, tt := range tests {
+		got, err := l.Query(tt.f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var seqs []uint64
+		for _, e := range got {
+			seqs = append(seqs, e.Seq)
+		}
+		if !slices.Equal(seqs, tt.want) {
+			t.Errorf("%s: Query() = %v, want %v", tt.name, seqs, tt.want)
+		}
+	}
+}
+
+func TestTampered(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	l, err := Open(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := route(t, "dst 192.0.2.0/24", 64500)
+	for _, a := range []Action{Originated, Withdrawn, Originated} {
+		if _, err := l.Append(Entry{Action: a, Actor: "alice", Route: r}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	l.Close()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := bytes.SplitAfter(b, []byte("\n"))
+
+	edited := bytes.Join([][]byte{lines[0], bytes.Replace(lines[1], []byte("alice"), []byte("mallory"), 1), lines[2]}, nil)
+	removed := bytes.Join([][]byte{lines[0], lines[2]}, nil)
+	for name, data := range map[string][]byte{"edited": edited, "removed": removed} {
+		if err := Verify(bytes.NewReader(data), func(Entry) bool { return true }); !errors.Is(err, ErrTampered) {
+			t.Errorf("%s: Verify() = %v, want ErrTampered", name, err)
+		}
+	}
+	if err := os.WriteFile(path, edited, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(path, nil); !errors.Is(err, ErrTampered) {
+		t.Errorf("Open(edited) = %v, want ErrTampered", err)
+	}
+}
@@ -0,0 +1,237 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+// Package authz identifies the callers of the management APIs and decides
+// what they may do.
+//
+// Callers present an API token as "Authorization: Bearer <token>" or a TLS
+// client certificate verified by the server; both map to an Identity with a
+// Role:
+//
+//	viewer    lists rules, events and the audit log, validates rules
+//	operator  also originates rules and withdraws or replaces its own
+//	admin     also withdraws or replaces anyone's rules and changes
+//	          per-peer policy
+//
+// An Authorizer remembers who originated each rule so operators cannot
+// withdraw the rules of others, including those of the auto-mitigation
+// controller, which have no owner.
+package authz
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"floofspectools/flowspecinternal/events"
+	"floofspectools/flowspecinternal/rib"
+)
+
+var (
+	ErrUnauthenticated = errors.New("authz: unknown caller")
+	ErrForbidden       = errors.New("authz: permission denied")
+	ErrUnknownRole     = errors.New("authz: unknown role")
+)
+
+// Role is a set of permissions, each role having those of the roles below.
+type Role uint8
+
+const (
+	Viewer Role = iota + 1
+	Operator
+	Admin
+)
+
+var roleNames = [...]string{
+	Viewer:   "viewer",
+	Operator: "operator",
+	Admin:    "admin",
+}
+
+func (r Role) String() string {
+	if int(r) < len(roleNames) && roleNames[r] != "" {
+		return roleNames[r]
+	}
+	return fmt.Sprintf("role-%d", uint8(r))
+}
+
+func (r Role) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+func (r *Role) UnmarshalText(b []byte) error {
+	i := slices.Index(roleNames[:], string(b))
+	if i <= 0 {
+		return fmt.Errorf("%w: %q", ErrUnknownRole, b)
+	}
+	*r = Role(i)
+	return nil
+}
+
+// Permission is an operation of the management APIs.
+type Permission uint8
+
+const (
+	// Read lists and validates rules and reads events and the audit log.
+	Read Permission = iota + 1
+	// Originate originates rules and withdraws or replaces the caller's own.
+	Originate
+	// WithdrawAny withdraws or replaces rules of any originator.
+	WithdrawAny
+	// ChangePolicy installs and removes per-peer validation policies.
+	ChangePolicy
+)
+
+// minRole is the least role holding each permission.
+var minRole = [...]Role{
+	Read:         Viewer,
+	Originate:    Operator,
+	WithdrawAny:  Admin,
+	ChangePolicy: Admin,
+}
+
+// Allows reports whether r holds p.
+func (r Role) Allows(p Permission) bool {
+	return int(p) < len(minRole) && minRole[p] != 0 && r >= minRole[p]
+}
+
+// Identity is an authenticated caller.
+type Identity struct {
+	// Name identifies the caller in logs, the audit log and rule ownership.
+	Name string `json:"name"`
+	Role Role   `json:"role"`
+}
+
+// Options configures an Authorizer.
+type Options struct {
+	// Tokens maps API tokens to identities.
+	Tokens map[string]Identity
+	// Certificates maps TLS client certificates to identities by a URI SAN,
+	// e.g. a SPIFFE ID, or else the subject common name. Only certificates
+	// verified by the server count, so the server must set ClientCAs.
+	Certificates map[string]Identity
+}
+
+// Authorizer authenticates callers and checks their permissions. Its
+// methods are safe for concurrent use.
+type Authorizer struct {
+	tokens map[[sha256.Size]byte]Identity
+	certs  map[string]Identity
+
+	mu     sync.Mutex
+	owners map[string]string // rib.FlowSpecKey to Identity.Name
+}
+
+// New returns an Authorizer for the identities of opts.
+func New(opts *Options) *Authorizer {
+	a := &Authorizer{tokens: map[[sha256.Size]byte]Identity{}, certs: map[string]Identity{}, owners: map[string]string{}}
+	if opts != nil {
+		// Tokens are looked up by hash so the lookup time does not depend
+		// on how much of a guess matches.
+		for t, id := range opts.Tokens {
+			a.tokens[sha256.Sum256([]byte(t))] = id
+		}
+		for name, id := range opts.Certificates {
+			a.certs[name] = id
+		}
+	}
+	return a
+}
+
+// Identify returns the identity of a caller presenting the value of an
+// Authorization header and the TLS connection state, either may be empty.
+// A token takes precedence over a certificate.
+func (a *Authorizer) Identify(authorization string, state *tls.ConnectionState) (Identity, error) {
+	if authorization != "" {
+		token, ok := strings.CutPrefix(authorization, "Bearer ")
+		if id, known := a.tokens[sha256.Sum256([]byte(token))]; ok && known {
+			return id, nil
+		}
+		return Identity{}, ErrUnauthenticated
+	}
+	if state != nil && len(state.VerifiedChains) > 0 {
+		cert := state.VerifiedChains[0][0]
+		for _, u := range cert.URIs {
+			if id, ok := a.certs[u.String()]; ok {
+				return id, nil
+			}
+		}
+		if id, ok := a.certs[cert.Subject.CommonName]; ok {
+			return id, nil
+		}
+	}
+	return Identity{}, ErrUnauthenticated
+}
+
+// Check returns an error wrapping ErrForbidden unless id holds p.
+func Check(id Identity, p Permission) error {
+	if !id.Role.Allows(p) {
+		return fmt.Errorf("%w: %s %q", ErrForbidden, id.Role, id.Name)
+	}
+	return nil
+}
+
+// CheckRule checks that id may originate, replace or withdraw the rule of
+// key: it must hold Originate and own the rule, if it exists, or hold
+// WithdrawAny.
+func (a *Authorizer) CheckRule(id Identity, key string, exists bool) error {
+	if err := Check(id, Originate); err != nil {
+		return err
+	}
+	if !exists || id.Role.Allows(WithdrawAny) {
+		return nil
+	}
+	if owner := a.Owner(key); owner != id.Name {
+		return fmt.Errorf("%w: rule originated by %q", ErrForbidden, owner)
+	}
+	return nil
+}
+
+// SetOwner records id as the originator of the rule of key.
+func (a *Authorizer) SetOwner(key string, id Identity) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.owners[key] = id.Name
+}
+
+// Owner returns the originator of the rule of key, empty if unknown.
+func (a *Authorizer) Owner(key string) string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.owners[key]
+}
+
+// Observe forgets the owner of a withdrawn rule, e.g. one that expired.
+func (a *Authorizer) Observe(e events.Event) {
+	if e.Kind != events.RuleWithdrawn {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.owners, rib.FlowSpecKey(e.Route))
+}
+
+// Subscribe forgets owners as rules are withdrawn from the RIB publishing
+// on bus, typically the local RIB, until cancel is called.
+func (a *Authorizer) Subscribe(bus *events.Bus) (cancel func()) {
+	return bus.Subscribe(a.Observe, events.RuleWithdrawn)
+}
+
+type contextKey struct{}
+
+// NewContext returns ctx carrying id.
+func NewContext(ctx context.Context, id Identity) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the identity carried by ctx, if any.
+func FromContext(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(contextKey{}).(Identity)
+	return id, ok
+}
@@ -0,0 +1,139 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package authz
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"net/url"
+	"testing"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/events"
+	"floofspectools/flowspecinternal/rib"
+)
+
+func TestRoles(t *testing.T) {
+	tests := []struct {
+		role Role
+		want []Permission
+	}{
+		{Viewer, []Permission{Read}},
+		{Operator, []Permission{Read, Originate}},
+		{Admin, []Permission{Read, Originate, WithdrawAny, ChangePolicy}},
+		{0, nil},
+	}
+	for _, tt := range tests {
+		var got []Permission
+		for p := Read; p <= ChangePolicy+1; p++ {
+			if tt.role.Allows(p) {
+				got = append(got, p)
+			}
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%s allows %v, want %v", tt.role, got, tt.want)
+		}
+	}
+
+	var r Role
+	if err := r.UnmarshalText([]byte("operator")); err != nil || r != Operator {
+		t.Errorf("UnmarshalText(operator) = %v, %v", r, err)
+	}
+	if err := r.UnmarshalText([]byte("root")); !errors.Is(err, ErrUnknownRole) {
+		t.Errorf("UnmarshalText(root) = %v, want ErrUnknownRole", err)
+	}
+}
+
+func TestIdentify(t *testing.T) {
+	alice := Identity{Name: "alice", Role: Operator}
+	bot := Identity{Name: "bot", Role: Viewer}
+	spiffe := Identity{Name: "spiffe", Role: Admin}
+	a := New(&Options{
+		Tokens:       map[string]Identity{"s3cret": alice},
+		Certificates: map[string]Identity{"bot.example.net": bot, "spiffe://example.net/ctl": spiffe},
+	})
+	chain := func(cn, uri string) *tls.ConnectionState {
+		c := &x509.Certificate{Subject: pkix.Name{CommonName: cn}}
+		if uri != "" {
+			u, _ := url.Parse(uri)
+			c.URIs = []*url.URL{u}
+		}
+		return &tls.ConnectionState{PeerCertificates: []*x509.Certificate{c}, VerifiedChains: [][]*x509.Certificate{{c}}}
+	}
+	unverified := chain("bot.example.net", "")
+	unverified.VerifiedChains = nil
+
+	tests := []struct {
+		name  string
+		auth  string
+		state *tls.ConnectionState
+		want  Identity
+		err   error
+	}{
+		{"token", "Bearer s3cret", nil, alice, nil},
+		{"token over certificate", "Bearer s3cret", chain("bot.example.net", ""), alice, nil},
+		{"wrong token", "Bearer guess", chain("bot.example.net", ""), Identity{}, ErrUnauthenticated},
+		{"no bearer", "s3cret", nil, Identity{}, ErrUnauthenticated},
+		{"common name", "", chain("bot.example.net", ""), bot, nil},
+		{"uri", "", chain("bot.example.net", "spiffe://example.net/ctl"), spiffe, nil},
+		{"unverified", "", unverified, Identity{}, ErrUnauthenticated},
+		{"nothing", "", nil, Identity{}, ErrUnauthenticated},
+	}
+	for _, tt := range tests {
+		id, err := a.Identify(tt.auth, tt.state)
+		if id != tt.want || !errors.Is(err, tt.err) {
+			t.Errorf("%s: Identify() = %v, %v; want %v, %v", tt.name, id, err, tt.want, tt.err)
+		}
+	}
+
+	ctx := NewContext(context.Background(), alice)
+	if id, ok := FromContext(ctx); !ok || id != alice {
+		t.Errorf("FromContext() = %v, %v", id, ok)
+	}
+}
+
+func TestCheckRule(t *testing.T) {
+	alice := Identity{Name: "alice", Role: Operator}
+	bob := Identity{Name: "bob", Role: Operator}
+	admin := Identity{Name: "root", Role: Admin}
+	viewer := Identity{Name: "noc", Role: Viewer}
+	a := New(nil)
+	l, err := fs.ParseComponents("dst 192.0.2.0/24")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &fs.FlowSpecRoute{AFI: fs.AFIIPv4, Components: l}
+	key := rib.FlowSpecKey(r)
+
+	if err := a.CheckRule(viewer, key, false); !errors.Is(err, ErrForbidden) {
+		t.Errorf("viewer originating: %v, want ErrForbidden", err)
+	}
+	if err := a.CheckRule(alice, key, false); err != nil {
+		t.Errorf("operator originating: %v", err)
+	}
+	a.SetOwner(key, alice)
+	if err := a.CheckRule(alice, key, true); err != nil {
+		t.Errorf("owner withdrawing: %v", err)
+	}
+	if err := a.CheckRule(bob, key, true); !errors.Is(err, ErrForbidden) {
+		t.Errorf("other operator withdrawing: %v, want ErrForbidden", err)
+	}
+	if err := a.CheckRule(admin, key, true); err != nil {
+		t.Errorf("admin withdrawing: %v", err)
+	}
+
+	bus := events.NewBus()
+	a.Subscribe(bus)
+	bus.Publish(events.Event{Kind: events.RuleWithdrawn, Route: r})
+	if owner := a.Owner(key); owner != "" {
+		t.Errorf("Owner() after withdrawal = %q", owner)
+	}
+	if err := a.CheckRule(alice, key, true); !errors.Is(err, ErrForbidden) {
+		t.Errorf("operator withdrawing an unowned rule: %v, want ErrForbidden", err)
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package flowspecinternal
+
+import (
+	"math/rand/v2"
+	"net/netip"
+	"sort"
+	"testing"
+)
+
+const benchRules = 100_000
+
+// benchRuleSet returns rules shaped like a DDoS mitigation table: a
+// destination /32 or /24, mostly with a protocol and often a port.
+func benchRuleSet() []FSComponentList {
+	rng := rand.New(rand.NewPCG(7, 7))
+	rules := make([]FSComponentList, 0, benchRules)
+	for len(rules) < benchRules {
+		bits := 32
+		if rng.IntN(4) == 0 {
+			bits = 24
+		}
+		a := netip.AddrFrom4([4]byte{byte(1 + rng.IntN(222)), byte(rng.IntN(256)), byte(rng.IntN(256)), byte(rng.IntN(256))})
+		p := netip.PrefixFrom(a, bits).Masked()
+		l := FSComponentList{Components: []FSComponent{{Type: ComponentTypeDestinationPrefix, Prefix: &p}}}
+		if rng.IntN(10) < 8 {
+			l.Components = append(l.Components, FSComponent{Type: ComponentTypeIpProtocol, Raw: []byte{0x81, []byte{6, 17}[rng.IntN(2)]}})
+		}
+		if rng.IntN(2) == 0 {
+			port := uint16(rng.IntN(1024))
+			l.Components = append(l.Components, FSComponent{Type: ComponentTypeDestinationPort, Raw: []byte{0x91, byte(port >> 8), byte(port)}})
+		}
+		rules = append(rules, l)
+	}
+	return rules
+}
+
+func BenchmarkSortFlowSpecs(b *testing.B) {
+	rules := benchRuleSet()
+	work := make([]FSComponentList, len(rules))
+	b.Run("SortStableFunc", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			copy(work, rules)
+			SortFlowSpecs(work)
+		}
+	})
+	b.Run("SortSlice", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			copy(work, rules)
+			sort.Slice(work, func(i, j int) bool { return CompareFlowSpecKey(work[i], work[j]) < 0 })
+		}
+	})
+}
+
+func BenchmarkInsertFlowSpec(b *testing.B) {
+	rules := benchRuleSet()[:2000]
+	b.Run("BinarySearch", func(b *testing.B) {
+		for b.Loop() {
+			var list []FSComponentList
+			for _, l := range rules {
+				list = InsertFlowSpec(list, l)
+			}
+		}
+	})
+	b.Run("AppendAndSortSlice", func(b *testing.B) {
+		for b.Loop() {
+			var list []FSComponentList
+			for _, l := range rules {
+				list = append(list, l)
+				sort.Slice(list, func(i, j int) bool { return CompareFlowSpecKey(list[i], list[j]) < 0 })
+			}
+		}
+	})
+}
+
+func BenchmarkCompareFlowSpecKey(b *testing.B) {
+	rules := benchRuleSet()
+	b.ReportAllocs()
+	i := 0
+	for b.Loop() {
+		CompareFlowSpecKey(rules[i%len(rules)], rules[(i+1)%len(rules)])
+		i++
+	}
+}
+
+func BenchmarkDecodeNLRI(b *testing.B) {
+	rules := benchRuleSet()[:1000]
+	wire := make([][]byte, len(rules))
+	for i, l := range rules {
+		var err error
+		if wire[i], err = EncodeNLRI(l, AFIIPv4); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportAllocs()
+	i := 0
+	for b.Loop() {
+		if _, _, err := DecodeNLRI(wire[i%len(wire)], AFIIPv4); err != nil {
+			b.Fatal(err)
+		}
+		i++
+	}
+}
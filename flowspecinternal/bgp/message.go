@@ -0,0 +1,315 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package bgp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/netip"
+	"slices"
+	"time"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/announce"
+)
+
+var (
+	ErrMalformedOpen = fs.NewError(fs.StageDecode, "malformed-open", "RFC4271 6.2", "bgp: malformed OPEN message")
+	ErrMessageTooBig = fs.NewError(fs.StageDecode, "message-too-big", "RFC4271 4.1", "bgp: message exceeds 4096 bytes")
+)
+
+// MaxMessageLen is the RFC4271 4.1 maximum message size.
+const MaxMessageLen = 4096
+
+// ASTrans is the 2 octet placeholder for 4 octet ASNs (RFC6793).
+const ASTrans = 23456
+
+// Capability codes.
+const (
+	capMultiprotocol        = 1
+	capRouteRefresh         = 2
+	capFourOctetAS          = 65
+	capEnhancedRouteRefresh = 70
+)
+
+// Open is the content of an OPEN message relevant to a FlowSpec session.
+type Open struct {
+	AS       uint32 // 4 octet AS if announced, else the 2 octet My AS field
+	HoldTime time.Duration
+	RouterID netip.Addr
+	Families []Family
+	// FourByteAS reports the 4-octet AS number capability.
+	FourByteAS bool
+	// RouteRefresh and EnhancedRouteRefresh report the route refresh
+	// capabilities of RFC2918 and RFC7313.
+	RouteRefresh         bool
+	EnhancedRouteRefresh bool
+}
+
+// NotificationError is a NOTIFICATION sent or received (RFC4271 4.5).
+type NotificationError struct {
+	Code    uint8
+	Subcode uint8
+	Data    []byte
+}
+
+func (e *NotificationError) Error() string {
+	return fmt.Sprintf("bgp: notification code %d subcode %d", e.Code, e.Subcode)
+}
+
+// NOTIFICATION error codes and the subcodes used here.
+const (
+	NotifyHeaderError       = 1
+	NotifyOpenError         = 2
+	NotifyUpdateError       = 3
+	NotifyHoldTimerExpired  = 4
+	NotifyFSMError          = 5
+	NotifyCease             = 6
+	NotifyRouteRefreshError = 7 // RFC7313 5
+
+	SubcodeBadPeerAS              = 2 // OPEN error
+	SubcodeBadBGPID               = 3 // OPEN error
+	SubcodeBadHoldTime            = 6 // OPEN error
+	SubcodeUnsupportedCapability  = 7 // OPEN error
+	SubcodeMalformedAttributeList = 1 // UPDATE error
+	SubcodeMaxPrefixes            = 1 // Cease, RFC4486
+	SubcodeAdminShutdown          = 2 // Cease
+	SubcodeInvalidMessageLength   = 1 // ROUTE-REFRESH error
+)
+
+func header(typ uint8, bodyLen int) []byte {
+	b := bytes.Repeat([]byte{0xff}, 16)
+	b = binary.BigEndian.AppendUint16(b, uint16(HeaderLen+bodyLen))
+	return append(b, typ)
+}
+
+// EncodeKeepalive returns a KEEPALIVE message.
+func EncodeKeepalive() []byte {
+	return header(MsgKeepalive, 0)
+}
+
+// EncodeNotification returns a NOTIFICATION message for e.
+func EncodeNotification(e *NotificationError) []byte {
+	return append(append(header(MsgNotification, 2+len(e.Data)), e.Code, e.Subcode), e.Data...)
+}
+
+// EncodeOpen returns an OPEN message announcing o's families, its route
+// refresh capabilities and the 4-octet AS capability.
+func EncodeOpen(o *Open) []byte {
+	var caps []byte
+	for _, f := range o.Families {
+		caps = append(caps, capMultiprotocol, 4)
+		caps = binary.BigEndian.AppendUint16(caps, f.AFI)
+		caps = append(caps, 0, f.SAFI)
+	}
+	if o.RouteRefresh {
+		caps = append(caps, capRouteRefresh, 0)
+	}
+	if o.EnhancedRouteRefresh {
+		caps = append(caps, capEnhancedRouteRefresh, 0)
+	}
+	caps = append(caps, capFourOctetAS, 4)
+	caps = binary.BigEndian.AppendUint32(caps, o.AS)
+
+	myAS := uint16(ASTrans)
+	if o.AS <= 0xffff {
+		myAS = uint16(o.AS)
+	}
+	body := []byte{4}
+	body = binary.BigEndian.AppendUint16(body, myAS)
+	body = binary.BigEndian.AppendUint16(body, uint16(o.HoldTime/time.Second))
+	body = append(body, o.RouterID.AsSlice()...)
+	body = append(body, byte(2+len(caps)), 2, byte(len(caps)))
+	body = append(body, caps...)
+	return append(header(MsgOpen, len(body)), body...)
+}
+
+// ParseOpen decodes the body of an OPEN message.
+func ParseOpen(body []byte) (*Open, error) {
+	if len(body) < 10 || body[0] != 4 {
+		return nil, ErrMalformedOpen
+	}
+	o := &Open{
+		AS:       uint32(binary.BigEndian.Uint16(body[1:])),
+		HoldTime: time.Duration(binary.BigEndian.Uint16(body[3:])) * time.Second,
+		RouterID: netip.AddrFrom4([4]byte(body[5:9])),
+	}
+	params := body[10:]
+	if len(params) != int(body[9]) {
+		return nil, ErrMalformedOpen
+	}
+	for len(params) > 0 {
+		if len(params) < 2 || len(params) < 2+int(params[1]) {
+			return nil, ErrMalformedOpen
+		}
+		typ, v := params[0], params[2:2+int(params[1])]
+		params = params[2+int(params[1]):]
+		if typ != 2 {
+			continue
+		}
+		for len(v) > 0 {
+			if len(v) < 2 || len(v) < 2+int(v[1]) {
+				return nil, ErrMalformedOpen
+			}
+			code, cv := v[0], v[2:2+int(v[1])]
+			v = v[2+int(v[1]):]
+			switch {
+			case code == capMultiprotocol && len(cv) == 4:
+				o.Families = append(o.Families, Family{AFI: binary.BigEndian.Uint16(cv), SAFI: cv[3]})
+			case code == capFourOctetAS && len(cv) == 4:
+				o.AS, o.FourByteAS = binary.BigEndian.Uint32(cv), true
+			case code == capRouteRefresh:
+				o.RouteRefresh = true
+			case code == capEnhancedRouteRefresh:
+				o.EnhancedRouteRefresh = true
+			}
+		}
+	}
+	return o, nil
+}
+
+// ReadMessage reads one BGP message from r and returns its type and body.
+func ReadMessage(r io.Reader) (typ uint8, body []byte, err error) {
+	var hdr [HeaderLen]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return 0, nil, err
+	}
+	n := int(binary.BigEndian.Uint16(hdr[16:]))
+	if n > MaxMessageLen {
+		return 0, nil, ErrMessageTooBig
+	}
+	msg := make([]byte, n)
+	copy(msg, hdr[:])
+	if n > HeaderLen {
+		if _, err := io.ReadFull(r, msg[HeaderLen:]); err != nil {
+			return 0, nil, err
+		}
+	}
+	return SplitHeader(msg)
+}
+
+// EncodeOptions describes the session an UPDATE is built for.
+type EncodeOptions struct {
+	LocalAS uint32
+	// EBGP prepends LocalAS to the AS_PATH, iBGP updates carry an empty AS_PATH and LOCAL_PREF.
+	EBGP bool
+	// TwoByteAS encodes AS_PATH with 2 octet ASNs and adds AS4_PATH where needed.
+	TwoByteAS bool
+}
+
+// Attribute type codes only used for encoding.
+const attrLocalPref = 5
+
+func appendAttr(dst []byte, flags, code byte, v []byte) []byte {
+	if len(v) > 255 {
+		dst = append(dst, flags|FlagExtLength, code)
+		dst = binary.BigEndian.AppendUint16(dst, uint16(len(v)))
+	} else {
+		dst = append(dst, flags, code, byte(len(v)))
+	}
+	return append(dst, v...)
+}
+
+// updateFamily returns the family of u: the AFI of its prefix components,
+// IPv4 if it has none and L2VPN if it has Ethernet components, and SAFI 134
+// if it has an RD.
+func updateFamily(u announce.Update) Family {
+	f := Family{AFI: fs.AFIIPv4, SAFI: fs.SAFIFlowSpec}
+	for _, c := range u.Components.Components {
+		switch {
+		case c.Type.IsEthernet():
+			f.AFI = fs.AFIL2VPN
+		case c.Prefix != nil && c.Prefix.Addr().Is6():
+			f.AFI = fs.AFIIPv6
+		}
+	}
+	if u.RD != nil {
+		f.SAFI = fs.SAFIFlowSpecVPN
+	}
+	return f
+}
+
+// EncodeUpdate builds an UPDATE announcing or withdrawing one SAFI 133 NLRI,
+// or SAFI 134 NLRI if u has an RD. Components must already be in RFC8955
+// 4.2 type order.
+func EncodeUpdate(u announce.Update, o EncodeOptions) ([]byte, error) {
+	f := updateFamily(u)
+	var (
+		nlri []byte
+		err  error
+	)
+	if u.RD != nil {
+		nlri, err = fs.EncodeVPNNLRI(*u.RD, u.Components, f.AFI)
+	} else {
+		nlri, err = fs.EncodeNLRI(u.Components, f.AFI)
+	}
+	if err != nil {
+		return nil, err
+	}
+	mp := binary.BigEndian.AppendUint16(nil, f.AFI)
+	mp = append(mp, f.SAFI)
+
+	var attrs []byte
+	if u.Withdraw {
+		attrs = appendAttr(attrs, FlagOptional, AttrMPUnreachNLRI, append(mp, nlri...))
+	} else {
+		attrs = appendAttr(attrs, FlagTransitive, AttrOrigin, []byte{0})
+		attrs = appendAttr(attrs, FlagTransitive, AttrASPath, encodeASPath(o, false))
+		if o.EBGP && o.TwoByteAS && o.LocalAS > 0xffff {
+			attrs = appendAttr(attrs, FlagOptional|FlagTransitive, AttrAS4Path, encodeASPath(o, true))
+		}
+		if !o.EBGP {
+			attrs = appendAttr(attrs, FlagTransitive, attrLocalPref, []byte{0, 0, 0, 100})
+		}
+		if len(u.Actions) > 0 || len(u.RouteTargets) > 0 {
+			var ec []byte
+			for _, a := range u.Actions {
+				c := a.ExtendedCommunity()
+				ec = append(ec, c[:]...)
+			}
+			for _, rt := range u.RouteTargets {
+				ec = append(ec, rt[:]...)
+			}
+			attrs = appendAttr(attrs, FlagOptional|FlagTransitive, AttrExtCommunities, ec)
+		}
+		// no next hop, reserved octet
+		attrs = appendAttr(attrs, FlagOptional, AttrMPReachNLRI, append(append(mp, 0, 0), nlri...))
+	}
+
+	body := []byte{0, 0}
+	body = binary.BigEndian.AppendUint16(body, uint16(len(attrs)))
+	body = append(body, attrs...)
+	if HeaderLen+len(body) > MaxMessageLen {
+		return nil, ErrMessageTooBig
+	}
+	return append(header(MsgUpdate, len(body)), body...), nil
+}
+
+func encodeASPath(o EncodeOptions, as4 bool) []byte {
+	if !o.EBGP {
+		return nil
+	}
+	if o.TwoByteAS && !as4 {
+		as := uint16(ASTrans)
+		if o.LocalAS <= 0xffff {
+			as = uint16(o.LocalAS)
+		}
+		return binary.BigEndian.AppendUint16([]byte{segSequence, 1}, as)
+	}
+	return binary.BigEndian.AppendUint32([]byte{segSequence, 1}, o.LocalAS)
+}
+
+// negotiate returns the FlowSpec families under cfg both sides announced.
+func negotiate(local, peer []Family, cfg *fs.Config) []Family {
+	var out []Family
+	for _, f := range local {
+		if f.flowSpecUnder(cfg) && slices.Contains(peer, f) {
+			out = append(out, f)
+		}
+	}
+	return out
+}
@@ -0,0 +1,129 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package bgp
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"slices"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/announce"
+)
+
+var (
+	ErrMalformedRouteRefresh = fs.NewError(fs.StageDecode, "malformed-route-refresh", "RFC7313 5", "bgp: malformed ROUTE-REFRESH message")
+	ErrRefreshNotSupported   = errors.New("bgp: peer did not announce the route refresh capability")
+)
+
+// ROUTE-REFRESH message subtypes (RFC7313 3).
+const (
+	// RefreshRequest asks the peer to re-send its Adj-RIB-Out.
+	RefreshRequest = 0
+	// RefreshBegin (BoRR) and RefreshEnd (EoRR) enclose the re-sent routes
+	// when enhanced route refresh is negotiated.
+	RefreshBegin = 1
+	RefreshEnd   = 2
+)
+
+// RouteRefresh is a ROUTE-REFRESH message for one family.
+type RouteRefresh struct {
+	Family
+	Subtype uint8
+}
+
+func (r RouteRefresh) String() string {
+	switch r.Subtype {
+	case RefreshRequest:
+		return fmt.Sprintf("refresh %s", r.Family)
+	case RefreshBegin:
+		return fmt.Sprintf("BoRR %s", r.Family)
+	case RefreshEnd:
+		return fmt.Sprintf("EoRR %s", r.Family)
+	}
+	return fmt.Sprintf("refresh-%d %s", r.Subtype, r.Family)
+}
+
+// EncodeRouteRefresh returns a ROUTE-REFRESH message (RFC2918 3). The
+// subtype takes the reserved octet, so it must be RefreshRequest unless the
+// peer announced enhanced route refresh.
+func EncodeRouteRefresh(r RouteRefresh) []byte {
+	body := binary.BigEndian.AppendUint16(nil, r.AFI)
+	body = append(body, r.Subtype, r.SAFI)
+	return append(header(MsgRouteRefresh, len(body)), body...)
+}
+
+// ParseRouteRefresh decodes the body of a ROUTE-REFRESH message. RFC7313 5
+// requires ignoring unknown subtypes, so they are returned as they are.
+func ParseRouteRefresh(body []byte) (RouteRefresh, error) {
+	if len(body) != 4 {
+		return RouteRefresh{}, ErrMalformedRouteRefresh
+	}
+	return RouteRefresh{Family: Family{AFI: binary.BigEndian.Uint16(body), SAFI: body[3]}, Subtype: body[2]}, nil
+}
+
+// RequestRefresh asks the peer to re-send its routes of f, e.g. after the
+// import policy changed, without resetting the session. With enhanced route
+// refresh the peer encloses them in RefreshBegin and RefreshEnd, which are
+// handed to SessionConfig.OnRefreshMarker.
+func (s *Session) RequestRefresh(ctx context.Context, f Family) error {
+	if err := s.awaitEstablished(ctx); err != nil {
+		return err
+	}
+	if !s.peer.RouteRefresh && !s.peer.EnhancedRouteRefresh {
+		return ErrRefreshNotSupported
+	}
+	if !slices.Contains(s.families, f) {
+		return ErrFamilyNotNegotiated
+	}
+	return s.write(ctx, EncodeRouteRefresh(RouteRefresh{Family: f}))
+}
+
+// receiveRefresh handles a ROUTE-REFRESH from the peer. Requests are
+// answered from SessionConfig.RIBOut on their own goroutine, so Send can
+// reach the session loop; markers go to SessionConfig.OnRefreshMarker.
+func (s *Session) receiveRefresh(ctx context.Context, r RouteRefresh) {
+	s.log.Debug("received ROUTE-REFRESH", "refresh", r.String())
+	if !slices.Contains(s.families, r.Family) {
+		return
+	}
+	switch r.Subtype {
+	case RefreshRequest:
+		if s.cfg.RIBOut != nil {
+			updates := s.cfg.RIBOut(r.Family)
+			go func() {
+				if err := s.resend(ctx, r.Family, updates); err != nil {
+					s.log.Warn("answering ROUTE-REFRESH", "family", r.Family.String(), "error", err)
+				}
+			}()
+		}
+	case RefreshBegin, RefreshEnd:
+		if s.cfg.OnRefreshMarker != nil {
+			s.cfg.OnRefreshMarker(r)
+		}
+	}
+}
+
+// resend sends updates, the Adj-RIB-Out of f, enclosed in RefreshBegin and
+// RefreshEnd if the peer announced enhanced route refresh.
+func (s *Session) resend(ctx context.Context, f Family, updates []announce.Update) error {
+	enhanced := s.peer.EnhancedRouteRefresh
+	if enhanced {
+		if err := s.write(ctx, EncodeRouteRefresh(RouteRefresh{Family: f, Subtype: RefreshBegin})); err != nil {
+			return err
+		}
+	}
+	for _, u := range updates {
+		if err := s.Send(ctx, u); err != nil {
+			return err
+		}
+	}
+	if enhanced {
+		return s.write(ctx, EncodeRouteRefresh(RouteRefresh{Family: f, Subtype: RefreshEnd}))
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package bgp
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"testing"
+	"time"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/announce"
+)
+
+func TestRouteRefreshRoundTrip(t *testing.T) {
+	for _, r := range []RouteRefresh{
+		{Family: FamilyIPv4FlowSpec},
+		{Family: FamilyIPv6FlowSpecVPN, Subtype: RefreshEnd},
+	} {
+		typ, body, err := SplitHeader(EncodeRouteRefresh(r))
+		if err != nil || typ != MsgRouteRefresh {
+			t.Fatalf("SplitHeader() = %d, %v, want ROUTE-REFRESH", typ, err)
+		}
+		if got, err := ParseRouteRefresh(body); err != nil || got != r {
+			t.Errorf("ParseRouteRefresh(EncodeRouteRefresh(%v)) = %v, %v", r, got, err)
+		}
+	}
+	if _, err := ParseRouteRefresh([]byte{0, 1, 0}); !errors.Is(err, ErrMalformedRouteRefresh) {
+		t.Errorf("ParseRouteRefresh(3 bytes) error = %v, want %v", err, ErrMalformedRouteRefresh)
+	}
+}
+
+func TestSessionRouteRefresh(t *testing.T) {
+	dst := netip.MustParsePrefix("192.0.2.0/24")
+	ribOut := []announce.Update{{Components: fs.FSComponentList{Components: []fs.FSComponent{
+		{Type: fs.ComponentTypeDestinationPrefix, Prefix: &dst},
+	}}}}
+	received := make(chan string, 8)
+	controller := &SessionConfig{
+		LocalAS:  65000,
+		RouterID: netip.MustParseAddr("192.0.2.1"),
+		RIBOut: func(f Family) []announce.Update {
+			if f != FamilyIPv4FlowSpec {
+				return nil
+			}
+			return ribOut
+		},
+	}
+	router := &SessionConfig{
+		LocalAS:         65001,
+		RouterID:        netip.MustParseAddr("192.0.2.2"),
+		OnRoute:         func(r *fs.FlowSpecRoute, err error) { received <- r.Components.String() },
+		OnRefreshMarker: func(r RouteRefresh) { received <- r.String() },
+	}
+	_, sb, _, _ := runPair(t, controller, router)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := sb.RequestRefresh(ctx, FamilyL2VPNFlowSpec); !errors.Is(err, ErrFamilyNotNegotiated) {
+		t.Errorf("RequestRefresh(L2VPN) error = %v, want %v", err, ErrFamilyNotNegotiated)
+	}
+	if err := sb.RequestRefresh(ctx, FamilyIPv4FlowSpec); err != nil {
+		t.Fatalf("RequestRefresh() error = %v", err)
+	}
+	for _, want := range []string{"BoRR 1/133", "dst 192.0.2.0/24", "EoRR 1/133"} {
+		select {
+		case got := <-received:
+			if got != want {
+				t.Errorf("received %q, want %q", got, want)
+			}
+		case <-ctx.Done():
+			t.Fatalf("%q not received", want)
+		}
+	}
+}
+
+func TestSessionRouteRefreshNotSupported(t *testing.T) {
+	a := &SessionConfig{LocalAS: 65000, RouterID: netip.MustParseAddr("192.0.2.1")}
+	b := &SessionConfig{LocalAS: 65001, RouterID: netip.MustParseAddr("192.0.2.2")}
+	sa, _, _, _ := runPair(t, a, b)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := sa.RequestRefresh(ctx, FamilyIPv4FlowSpec); !errors.Is(err, ErrRefreshNotSupported) {
+		t.Errorf("RequestRefresh() error = %v, want %v", err, ErrRefreshNotSupported)
+	}
+}
@@ -0,0 +1,516 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package bgp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/announce"
+	"floofspectools/flowspecinternal/events"
+	"floofspectools/flowspecinternal/tracing"
+)
+
+var (
+	ErrSessionClosed        = errors.New("bgp: session closed")
+	ErrFamilyNotNegotiated  = errors.New("bgp: address family not negotiated with peer")
+	ErrOpenTimeout          = errors.New("bgp: no OPEN or KEEPALIVE from peer within the hold time")
+	ErrInvalidSessionConfig = errors.New("bgp: session needs LocalAS and an IPv4 RouterID")
+)
+
+// State is the RFC4271 8 session state. Connect and Active are left to the
+// caller, which hands an established TCP connection to Run.
+type State int32
+
+const (
+	StateIdle State = iota
+	StateOpenSent
+	StateOpenConfirm
+	StateEstablished
+)
+
+func (s State) String() string {
+	return [...]string{"Idle", "OpenSent", "OpenConfirm", "Established"}[s]
+}
+
+// openHoldTime bounds the wait for the peer's OPEN (RFC4271 8 suggests 4 minutes).
+const openHoldTime = 4 * time.Minute
+
+// SessionConfig configures a FlowSpec-only BGP session.
+type SessionConfig struct {
+	LocalAS  uint32
+	RouterID netip.Addr
+	// PeerAS is the expected AS of the peer, 0 accepts any.
+	PeerAS uint32
+	// HoldTime is proposed to the peer, defaults to 90s.
+	HoldTime time.Duration
+	// Families to negotiate, defaults to IPv4 and IPv6 FlowSpec.
+	Families []Family
+
+	// RIB, if set, is used to validate received routes with fs.ValidateFeasibility under Validation.
+	// Validation also selects strict decoding, the RFC7606 handling of malformed UPDATEs
+	// and whether the experimental L2VPN family is negotiated.
+	RIB        fs.UnicastRIB
+	Validation *fs.Config
+	// RIBs, if set, selects the unicast RIB of each received route instead
+	// of RIB, e.g. an fs.VRFs validating VPN routes against their VRF.
+	RIBs fs.RIBProvider
+	// Limits, if set, rejects received routes exceeding them; their OnRoute
+	// error is one of the fs.Limits errors and they are not validated.
+	// MaxRules counts the distinct routes currently announced by the peer;
+	// an evicted route is handed to OnWithdraw and published as
+	// RuleWithdrawn with fs.ErrRuleEvicted, OverflowTeardown closes the
+	// session with a Cease NOTIFICATION.
+	Limits *fs.Limits
+	// Priority, if set, returns the fs.FlowSpecRoute Priority of a received
+	// route before it is counted against Limits.MaxRules.
+	Priority func(r *fs.FlowSpecRoute) int
+	// Policy, if set, is the peer's policy, e.g. from fs.ValidatorSet:
+	// received routes using components or actions it does not allow are
+	// rejected like those exceeding Limits. Its Config and Limits stand in
+	// for Validation and Limits when those are nil.
+	Policy *fs.PeerPolicy
+	// OnRoute is called for every received route with the validation result.
+	OnRoute func(r *fs.FlowSpecRoute, err error)
+	// OnWithdraw is called for every withdrawn route.
+	OnWithdraw func(r *fs.FlowSpecRoute)
+	// Events, if set, receives RuleAccepted or RuleRejected for every
+	// received route after OnRoute and RuleWithdrawn after OnWithdraw.
+	Events *events.Bus
+	// TracerProvider receives a "bgp.update" span per received UPDATE with
+	// decode and validation child spans, defaults to the global provider.
+	TracerProvider trace.TracerProvider
+	// Logger, if set, receives session state changes, NOTIFICATIONs, rules
+	// rejected by Limits and, as the decode subsystem, malformed UPDATEs.
+	Logger *slog.Logger
+	// OnUpdateError is called for malformed UPDATEs that do not reset the
+	// session, before their remaining routes are delivered.
+	OnUpdateError func(err *UpdateError)
+	// RIBOut, if set, returns the routes announced to the peer for a family
+	// so the session can answer its ROUTE-REFRESH requests.
+	RIBOut func(f Family) []announce.Update
+	// OnRefreshMarker is called for the RefreshBegin and RefreshEnd
+	// enclosing a refresh sent by the peer, e.g. to mark its routes of the
+	// family stale and flush those not re-sent (RFC7313 4.2). The route
+	// refresh capabilities are only announced with RIBOut or
+	// OnRefreshMarker set.
+	OnRefreshMarker func(r RouteRefresh)
+}
+
+// Session is one BGP session with a peer. It announces locally generated rules
+// with Send, which makes it an announce.Sender, and hands received rules to
+// the configured callbacks.
+type Session struct {
+	cfg   SessionConfig
+	state atomic.Int32
+	log   *slog.Logger
+
+	peer     *Open
+	families []Family
+	// rules holds the routes announced by the peer when Limits.MaxRules
+	// is set; only the Run goroutine uses it.
+	rules *fs.RuleLimiter
+
+	out         chan sendReq
+	established chan struct{}
+	done        chan struct{}
+}
+
+type sendReq struct {
+	msg []byte
+	err chan error
+}
+
+type received struct {
+	typ  uint8
+	body []byte
+	err  error
+}
+
+// NewSession returns an idle session.
+func NewSession(cfg *SessionConfig) (*Session, error) {
+	c := *cfg
+	if c.LocalAS == 0 || !c.RouterID.Is4() {
+		return nil, ErrInvalidSessionConfig
+	}
+	if c.HoldTime == 0 {
+		c.HoldTime = 90 * time.Second
+	}
+	if len(c.Families) == 0 {
+		c.Families = []Family{FamilyIPv4FlowSpec, FamilyIPv6FlowSpec}
+	}
+	if c.Policy != nil {
+		if c.Validation == nil {
+			c.Validation = &c.Policy.Config
+		}
+		if c.Limits == nil {
+			c.Limits = &c.Policy.Limits
+		}
+	}
+	var rules *fs.RuleLimiter
+	if c.Limits != nil && c.Limits.MaxRules > 0 {
+		rules = fs.NewRuleLimiter(c.Limits)
+	}
+	return &Session{
+		cfg:         c,
+		rules:       rules,
+		log:         fs.SubsystemLogger(c.Logger, fs.SubsystemSession),
+		out:         make(chan sendReq),
+		established: make(chan struct{}),
+		done:        make(chan struct{}),
+	}, nil
+}
+
+// State returns the current session state.
+func (s *Session) State() State {
+	return State(s.state.Load())
+}
+
+// Peer returns the peer's OPEN once the session is established.
+func (s *Session) Peer() *Open {
+	select {
+	case <-s.established:
+		return s.peer
+	default:
+		return nil
+	}
+}
+
+// Run runs the session over conn until ctx is done, the peer closes or an
+// error occurs; conn is closed on return. A Session runs once.
+func (s *Session) Run(ctx context.Context, conn net.Conn) error {
+	defer func() {
+		s.state.Store(int32(StateIdle))
+		close(s.done)
+		conn.Close()
+	}()
+
+	msgs := make(chan received, 16)
+	go func() {
+		for {
+			typ, body, err := ReadMessage(conn)
+			select {
+			case msgs <- received{typ, body, err}:
+			case <-s.done:
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	refresh := s.cfg.RIBOut != nil || s.cfg.OnRefreshMarker != nil
+	if _, err := conn.Write(EncodeOpen(&Open{
+		AS: s.cfg.LocalAS, HoldTime: s.cfg.HoldTime, RouterID: s.cfg.RouterID, Families: s.cfg.Families,
+		RouteRefresh: refresh, EnhancedRouteRefresh: refresh,
+	})); err != nil {
+		return err
+	}
+	s.state.Store(int32(StateOpenSent))
+
+	m, err := s.await(ctx, conn, msgs)
+	if err != nil {
+		return err
+	}
+	if m.typ != MsgOpen {
+		return s.notify(conn, &NotificationError{Code: NotifyFSMError})
+	}
+	peer, err := ParseOpen(m.body)
+	if err != nil {
+		return s.notify(conn, &NotificationError{Code: NotifyOpenError})
+	}
+	if nerr := s.checkOpen(peer); nerr != nil {
+		return s.notify(conn, nerr)
+	}
+	s.peer, s.families = peer, negotiate(s.cfg.Families, peer.Families, s.cfg.Validation)
+	if _, err := conn.Write(EncodeKeepalive()); err != nil {
+		return err
+	}
+	s.state.Store(int32(StateOpenConfirm))
+
+	if m, err = s.await(ctx, conn, msgs); err != nil {
+		return err
+	}
+	if m.typ != MsgKeepalive {
+		return s.notify(conn, &NotificationError{Code: NotifyFSMError})
+	}
+	s.state.Store(int32(StateEstablished))
+	close(s.established)
+	s.log.Info("session established", fs.LogKeyPeer, peer.AS, "router_id", peer.RouterID.String(), "families", fmt.Sprint(s.families))
+	err = s.runEstablished(ctx, conn, msgs)
+	s.log.Info("session closed", fs.LogKeyPeer, peer.AS, "error", err)
+	return err
+}
+
+func (s *Session) checkOpen(peer *Open) *NotificationError {
+	if s.cfg.PeerAS != 0 && peer.AS != s.cfg.PeerAS {
+		return &NotificationError{Code: NotifyOpenError, Subcode: SubcodeBadPeerAS}
+	}
+	if peer.HoldTime != 0 && peer.HoldTime < 3*time.Second {
+		return &NotificationError{Code: NotifyOpenError, Subcode: SubcodeBadHoldTime}
+	}
+	if !peer.RouterID.IsValid() || peer.RouterID.IsUnspecified() {
+		return &NotificationError{Code: NotifyOpenError, Subcode: SubcodeBadBGPID}
+	}
+	if len(negotiate(s.cfg.Families, peer.Families, s.cfg.Validation)) == 0 {
+		return &NotificationError{Code: NotifyOpenError, Subcode: SubcodeUnsupportedCapability}
+	}
+	return nil
+}
+
+// await waits for the next message during session setup.
+func (s *Session) await(ctx context.Context, conn net.Conn, msgs <-chan received) (received, error) {
+	t := time.NewTimer(openHoldTime)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return received{}, ctx.Err()
+	case <-t.C:
+		s.notify(conn, &NotificationError{Code: NotifyHoldTimerExpired})
+		return received{}, ErrOpenTimeout
+	case m := <-msgs:
+		if m.err != nil {
+			return received{}, m.err
+		}
+		if m.typ == MsgNotification {
+			return received{}, parseNotification(m.body)
+		}
+		return m, nil
+	}
+}
+
+func parseNotification(body []byte) error {
+	if len(body) < 2 {
+		return &NotificationError{}
+	}
+	return &NotificationError{Code: body[0], Subcode: body[1], Data: body[2:]}
+}
+
+// notify sends e to the peer and returns it.
+func (s *Session) notify(conn net.Conn, e *NotificationError) error {
+	s.log.Warn("sending NOTIFICATION", "code", e.Code, "subcode", e.Subcode)
+	conn.SetWriteDeadline(time.Now().Add(time.Second))
+	conn.Write(EncodeNotification(e))
+	return e
+}
+
+// runEstablished is the Established state loop.
+func (s *Session) runEstablished(ctx context.Context, conn net.Conn, msgs <-chan received) error {
+	hold := min(s.cfg.HoldTime, s.peer.HoldTime)
+	var (
+		keepalive <-chan time.Time
+		holdTimer *time.Timer
+		holdC     <-chan time.Time
+	)
+	if hold > 0 {
+		tick := time.NewTicker(hold / 3)
+		defer tick.Stop()
+		keepalive = tick.C
+		holdTimer = time.NewTimer(hold)
+		defer holdTimer.Stop()
+		holdC = holdTimer.C
+	}
+	opts := &ParseOptions{PeerAS: s.peer.AS, LocalAS: s.cfg.LocalAS, PeerRouterID: s.peer.RouterID, TwoByteAS: !s.peer.FourByteAS, Validation: s.cfg.Validation, Logger: s.cfg.Logger}
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.notify(conn, &NotificationError{Code: NotifyCease, Subcode: SubcodeAdminShutdown})
+			return ctx.Err()
+		case <-keepalive:
+			if _, err := conn.Write(EncodeKeepalive()); err != nil {
+				return err
+			}
+		case <-holdC:
+			return s.notify(conn, &NotificationError{Code: NotifyHoldTimerExpired})
+		case req := <-s.out:
+			_, err := conn.Write(req.msg)
+			req.err <- err
+			if err != nil {
+				return err
+			}
+		case m := <-msgs:
+			if m.err != nil {
+				return m.err
+			}
+			if holdTimer != nil {
+				holdTimer.Reset(hold)
+			}
+			switch m.typ {
+			case MsgKeepalive:
+			case MsgNotification:
+				return parseNotification(m.body)
+			case MsgRouteRefresh:
+				r, err := ParseRouteRefresh(m.body)
+				if err != nil {
+					// RFC7313 5
+					return s.notify(conn, &NotificationError{Code: NotifyRouteRefreshError, Subcode: SubcodeInvalidMessageLength, Data: m.body})
+				}
+				s.receiveRefresh(ctx, r)
+			case MsgUpdate:
+				if err := s.receiveUpdate(ctx, m.body, opts); errors.Is(err, fs.ErrRuleLimitCease) {
+					return s.notify(conn, &NotificationError{Code: NotifyCease, Subcode: SubcodeMaxPrefixes})
+				} else if err != nil {
+					return s.notify(conn, &NotificationError{Code: NotifyUpdateError, Subcode: SubcodeMalformedAttributeList})
+				}
+			default:
+				return s.notify(conn, &NotificationError{Code: NotifyFSMError})
+			}
+		}
+	}
+}
+
+// receiveUpdate decodes and delivers one UPDATE in a "bgp.update" span. It
+// returns the errors that reset the session.
+func (s *Session) receiveUpdate(ctx context.Context, body []byte, opts *ParseOptions) error {
+	tracer := tracing.Tracer(s.cfg.TracerProvider)
+	ctx, span := tracer.Start(ctx, "bgp.update", trace.WithAttributes(tracing.AttrPeer.Int64(int64(opts.PeerAS))))
+	defer span.End()
+
+	_, decode := tracer.Start(ctx, "bgp.decode_update")
+	u, err := ParseUpdateBody(body, opts)
+	if u != nil {
+		decode.SetAttributes(attribute.Int("bgp.announced", len(u.Announced)), attribute.Int("bgp.withdrawn", len(u.Withdrawn)))
+	}
+	if err != nil {
+		var ue *UpdateError
+		if errors.As(err, &ue) {
+			decode.SetAttributes(attribute.String("bgp.error_handling", ue.Handling.String()))
+		}
+		tracing.End(decode, err)
+		if ue == nil || ue.Handling == fs.SessionReset {
+			return err
+		}
+		if s.cfg.OnUpdateError != nil {
+			s.cfg.OnUpdateError(ue)
+		}
+	} else {
+		decode.End()
+	}
+	return s.deliver(ctx, u)
+}
+
+// deliver hands the routes of u to the callbacks. It returns
+// fs.ErrRuleLimitCease if a route exceeds Limits.MaxRules under
+// OverflowTeardown, the routes after it are dropped.
+func (s *Session) deliver(ctx context.Context, u *Update) error {
+	for _, r := range u.Withdrawn {
+		if s.rules != nil {
+			s.rules.Remove(r)
+		}
+		if s.cfg.OnWithdraw != nil {
+			s.cfg.OnWithdraw(r)
+		}
+		s.cfg.Events.Publish(events.Event{Kind: events.RuleWithdrawn, Route: r})
+	}
+	for _, r := range u.Announced {
+		err := s.cfg.Limits.Check(r.Components, r.AFI)
+		if err == nil && s.cfg.Policy != nil {
+			err = s.cfg.Policy.Check(r)
+		}
+		if err == nil && s.rules != nil {
+			if s.cfg.Priority != nil {
+				r.Priority = s.cfg.Priority(r)
+			}
+			var evicted *fs.FlowSpecRoute
+			if evicted, err = s.rules.Add(r); evicted != nil {
+				s.evict(evicted)
+			}
+		}
+		if err != nil {
+			s.log.Info("flowspec route exceeds limits or policy", fs.LogKeyPeer, r.NeighborAS, fs.LogKeyRule, r.Components.Canonical(nil), "error", err)
+		} else if rib := s.unicastRIB(r); rib != nil {
+			err = tracing.ValidateFeasibility(ctx, s.cfg.TracerProvider, r, rib, s.cfg.Validation)
+		} else if s.cfg.RIBs != nil {
+			err = fs.ErrNoVRF
+		}
+		if s.cfg.OnRoute != nil {
+			s.cfg.OnRoute(r, err)
+		}
+		if err != nil {
+			s.cfg.Events.Publish(events.Event{Kind: events.RuleRejected, Route: r, Err: err})
+		} else {
+			s.cfg.Events.Publish(events.Event{Kind: events.RuleAccepted, Route: r})
+		}
+		if errors.Is(err, fs.ErrRuleLimitCease) {
+			return err
+		}
+	}
+	return nil
+}
+
+// evict withdraws r, dropped by the rule limiter for a route of higher
+// priority.
+func (s *Session) evict(r *fs.FlowSpecRoute) {
+	s.log.Info("flowspec route evicted", fs.LogKeyPeer, r.NeighborAS, fs.LogKeyRule, r.Components.Canonical(nil), "priority", r.Priority)
+	if s.cfg.OnWithdraw != nil {
+		s.cfg.OnWithdraw(r)
+	}
+	s.cfg.Events.Publish(events.Event{Kind: events.RuleWithdrawn, Route: r, Err: fs.ErrRuleEvicted})
+}
+
+// unicastRIB returns the RIB r is validated against, nil if it is not
+// validated.
+func (s *Session) unicastRIB(r *fs.FlowSpecRoute) fs.UnicastRIB {
+	if s.cfg.RIBs != nil {
+		return s.cfg.RIBs.RIBFor(r)
+	}
+	return s.cfg.RIB
+}
+
+// Send announces or withdraws u, waiting for the session to be established.
+func (s *Session) Send(ctx context.Context, u announce.Update) error {
+	if err := s.awaitEstablished(ctx); err != nil {
+		return err
+	}
+	if !slices.Contains(s.families, updateFamily(u)) {
+		return ErrFamilyNotNegotiated
+	}
+	msg, err := EncodeUpdate(u, EncodeOptions{
+		LocalAS:   s.cfg.LocalAS,
+		EBGP:      s.peer.AS != s.cfg.LocalAS,
+		TwoByteAS: !s.peer.FourByteAS,
+	})
+	if err != nil {
+		return err
+	}
+	return s.write(ctx, msg)
+}
+
+func (s *Session) awaitEstablished(ctx context.Context) error {
+	select {
+	case <-s.established:
+		return nil
+	case <-s.done:
+		return ErrSessionClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// write hands msg to the session loop and waits until it is written.
+func (s *Session) write(ctx context.Context, msg []byte) error {
+	req := sendReq{msg: msg, err: make(chan error, 1)}
+	select {
+	case s.out <- req:
+	case <-s.done:
+		return ErrSessionClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return <-req.err
+}
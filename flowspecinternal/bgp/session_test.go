@@ -0,0 +1,301 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package bgp
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"slices"
+	"testing"
+	"time"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/actions"
+	"floofspectools/flowspecinternal/announce"
+	"floofspectools/flowspecinternal/events"
+	"floofspectools/flowspecinternal/rib"
+)
+
+func TestOpenRoundTrip(t *testing.T) {
+	o := &Open{
+		AS:         4200000000,
+		HoldTime:   90 * time.Second,
+		RouterID:   netip.MustParseAddr("192.0.2.1"),
+		Families:   []Family{FamilyIPv4FlowSpec, FamilyIPv6FlowSpecVPN},
+		FourByteAS: true,
+
+		EnhancedRouteRefresh: true,
+	}
+	typ, body, err := SplitHeader(EncodeOpen(o))
+	if err != nil || typ != MsgOpen {
+		t.Fatalf("SplitHeader() = %d, %v, want OPEN", typ, err)
+	}
+	got, err := ParseOpen(body)
+	if err != nil {
+		t.Fatalf("ParseOpen() error = %v, want <nil>", err)
+	}
+	if got.AS != o.AS || got.HoldTime != o.HoldTime || got.RouterID != o.RouterID ||
+		!got.FourByteAS || !slices.Equal(got.Families, o.Families) || got.RouteRefresh || !got.EnhancedRouteRefresh {
+		t.Errorf("ParseOpen(EncodeOpen(%+v)) = %+v", o, got)
+	}
+}
+
+func runPair(t *testing.T, a, b *SessionConfig) (sa, sb *Session, errA, errB chan error) {
+	t.Helper()
+	var err error
+	if sa, err = NewSession(a); err != nil {
+		t.Fatal(err)
+	}
+	if sb, err = NewSession(b); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	ca, cb := net.Pipe()
+	errA, errB = make(chan error, 1), make(chan error, 1)
+	go func() { errA <- sa.Run(ctx, ca) }()
+	go func() { errB <- sb.Run(ctx, cb) }()
+	return sa, sb, errA, errB
+}
+
+func TestSessionAnnounce(t *testing.T) {
+	routes := make(chan *fs.FlowSpecRoute, 1)
+	controller := &SessionConfig{LocalAS: 65000, RouterID: netip.MustParseAddr("192.0.2.1"), PeerAS: 65001}
+	router := &SessionConfig{
+		LocalAS:  65001,
+		RouterID: netip.MustParseAddr("192.0.2.2"),
+		PeerAS:   65000,
+		Families: []Family{FamilyIPv4FlowSpec},
+		OnRoute:  func(r *fs.FlowSpecRoute, err error) { routes <- r },
+	}
+	sa, sb, _, _ := runPair(t, controller, router)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	dst := netip.MustParsePrefix("192.0.2.0/24")
+	u := announce.Update{
+		Components: fs.FSComponentList{Components: []fs.FSComponent{
+			{Type: fs.ComponentTypeDestinationPrefix, Prefix: &dst},
+			{Type: fs.ComponentTypeIpProtocol, Raw: []byte{0x81, 0x06}},
+		}},
+		Actions: []actions.Action{actions.TrafficRateBytes{Rate: 0}},
+	}
+	if err := sa.Send(ctx, u); err != nil {
+		t.Fatalf("Send() error = %v, want <nil>", err)
+	}
+	select {
+	case r := <-routes:
+		if got, want := r.Components.Canonical(nil), "dst=192.0.2.0/24 proto=6"; got != want {
+			t.Errorf("received %q, want %q", got, want)
+		}
+		if !r.FromEBGP || r.NeighborAS != 65000 || !slices.Equal(r.ASPath, []uint32{65000}) || len(r.ExtCommunities) != 1 {
+			t.Errorf("received route %+v, want eBGP from AS65000 with one action", r)
+		}
+	case <-ctx.Done():
+		t.Fatal("route not received")
+	}
+	if sa.State() != StateEstablished || sb.State() != StateEstablished {
+		t.Errorf("State() = %v, %v, want Established", sa.State(), sb.State())
+	}
+
+	v6 := netip.MustParsePrefix("2001:db8::/32")
+	u.Components = fs.FSComponentList{Components: []fs.FSComponent{{Type: fs.ComponentTypeDestinationPrefix, Prefix: &v6}}}
+	if err := sa.Send(ctx, u); !errors.Is(err, ErrFamilyNotNegotiated) {
+		t.Errorf("Send(IPv6) error = %v, want %v", err, ErrFamilyNotNegotiated)
+	}
+}
+
+func TestSessionBadPeerAS(t *testing.T) {
+	a := &SessionConfig{LocalAS: 65000, RouterID: netip.MustParseAddr("192.0.2.1")}
+	b := &SessionConfig{LocalAS: 65001, RouterID: netip.MustParseAddr("192.0.2.2"), PeerAS: 65002}
+	_, _, errA, errB := runPair(t, a, b)
+
+	// a either reads the NOTIFICATION or finds the connection already closed
+	var nerr *NotificationError
+	select {
+	case err := <-errB:
+		if !errors.As(err, &nerr) || nerr.Code != NotifyOpenError || nerr.Subcode != SubcodeBadPeerAS {
+			t.Errorf("Run() error = %v, want OPEN error bad peer AS", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run() did not return")
+	}
+	select {
+	case err := <-errA:
+		if err == nil {
+			t.Error("Run() error = <nil> on the rejected side")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run() did not return on the rejected side")
+	}
+}
+
+func TestSessionRuleLimit(t *testing.T) {
+	var (
+		errs  []error
+		kinds []events.Kind
+	)
+	bus := events.NewBus()
+	bus.Subscribe(func(e events.Event) { kinds = append(kinds, e.Kind) })
+	s, err := NewSession(&SessionConfig{
+		LocalAS:  65001,
+		RouterID: netip.MustParseAddr("192.0.2.2"),
+		Limits:   &fs.Limits{MaxRules: 1, MaxComponents: 1},
+		OnRoute:  func(r *fs.FlowSpecRoute, err error) { errs = append(errs, err) },
+		Events:   bus,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	route := func(dst string, extra ...fs.FSComponent) *fs.FlowSpecRoute {
+		p := netip.MustParsePrefix(dst)
+		l := fs.FSComponentList{Components: append([]fs.FSComponent{{Type: fs.ComponentTypeDestinationPrefix, Prefix: &p}}, extra...)}
+		return &fs.FlowSpecRoute{AFI: fs.AFIIPv4, SAFI: fs.SAFIFlowSpec, Components: l}
+	}
+	a, b := route("192.0.2.0/24"), route("198.51.100.0/24")
+	s.deliver(context.Background(), &Update{Announced: []*fs.FlowSpecRoute{
+		a,
+		a, // re-announcement replaces the route
+		b,
+		route("203.0.113.0/24", fs.FSComponent{Type: fs.ComponentTypeIpProtocol, Raw: []byte{0x81, 0x06}}),
+	}})
+	s.deliver(context.Background(), &Update{Withdrawn: []*fs.FlowSpecRoute{a}, Announced: []*fs.FlowSpecRoute{b}})
+
+	want := []error{nil, nil, fs.ErrRuleLimit, fs.ErrComponentLimit, nil}
+	if len(errs) != len(want) {
+		t.Fatalf("OnRoute called %d times, want %d", len(errs), len(want))
+	}
+	for i, w := range want {
+		if !errors.Is(errs[i], w) {
+			t.Errorf("route %d: error = %v, want %v", i, errs[i], w)
+		}
+	}
+	wantKinds := []events.Kind{events.RuleAccepted, events.RuleAccepted, events.RuleRejected, events.RuleRejected, events.RuleWithdrawn, events.RuleAccepted}
+	if !slices.Equal(kinds, wantKinds) {
+		t.Errorf("events = %v, want %v", kinds, wantKinds)
+	}
+}
+
+func TestSessionRuleOverflow(t *testing.T) {
+	var (
+		errs      []error
+		withdrawn []error
+	)
+	bus := events.NewBus()
+	bus.Subscribe(func(e events.Event) {
+		if e.Kind == events.RuleWithdrawn {
+			withdrawn = append(withdrawn, e.Err)
+		}
+	})
+	route := func(dst string) *fs.FlowSpecRoute {
+		p := netip.MustParsePrefix(dst)
+		l := fs.FSComponentList{Components: []fs.FSComponent{{Type: fs.ComponentTypeDestinationPrefix, Prefix: &p}}}
+		return &fs.FlowSpecRoute{AFI: fs.AFIIPv4, SAFI: fs.SAFIFlowSpec, Components: l}
+	}
+	cfg := &SessionConfig{
+		LocalAS:  65001,
+		RouterID: netip.MustParseAddr("192.0.2.2"),
+		Limits:   &fs.Limits{MaxRules: 1, Overflow: fs.OverflowEvict},
+		Priority: func(r *fs.FlowSpecRoute) int { return r.DestPrefix.Bits() },
+		OnRoute:  func(r *fs.FlowSpecRoute, err error) { errs = append(errs, err) },
+		Events:   bus,
+	}
+	s, err := NewSession(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, b, c := route("192.0.2.0/24"), route("198.51.100.0/28"), route("203.0.113.0/16")
+	for _, r := range []*fs.FlowSpecRoute{a, b, c} {
+		r.DestPrefix = r.Components.Components[0].Prefix
+	}
+	if err := s.deliver(context.Background(), &Update{Announced: []*fs.FlowSpecRoute{a, b, c}}); err != nil {
+		t.Fatalf("deliver() error = %v", err)
+	}
+	want := []error{nil, nil, fs.ErrRuleLimit}
+	for i, w := range want {
+		if i >= len(errs) || !errors.Is(errs[i], w) {
+			t.Errorf("evict: route %d: errors = %v, want %v", i, errs, want)
+		}
+	}
+	if len(withdrawn) != 1 || !errors.Is(withdrawn[0], fs.ErrRuleEvicted) {
+		t.Errorf("withdrawn = %v, want [%v]", withdrawn, fs.ErrRuleEvicted)
+	}
+
+	errs = nil
+	cfg.Limits = &fs.Limits{MaxRules: 1, Overflow: fs.OverflowTeardown}
+	if s, err = NewSession(cfg); err != nil {
+		t.Fatal(err)
+	}
+	err = s.deliver(context.Background(), &Update{Announced: []*fs.FlowSpecRoute{a, b, c}})
+	if !errors.Is(err, fs.ErrRuleLimitCease) {
+		t.Errorf("teardown: deliver() error = %v, want %v", err, fs.ErrRuleLimitCease)
+	}
+	if len(errs) != 2 || errs[0] != nil || !errors.Is(errs[1], fs.ErrRuleLimitCease) {
+		t.Errorf("teardown: errors = %v, want [<nil> %v]", errs, fs.ErrRuleLimitCease)
+	}
+}
+
+func TestSessionPolicy(t *testing.T) {
+	var errs []error
+	s, err := NewSession(&SessionConfig{
+		LocalAS:  65001,
+		RouterID: netip.MustParseAddr("192.0.2.2"),
+		Policy:   &fs.PeerPolicy{AllowedActions: []fs.ActionRule{{Action: fs.ActionDiscard}}, Limits: fs.Limits{MaxRules: 1}},
+		OnRoute:  func(r *fs.FlowSpecRoute, err error) { errs = append(errs, err) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	route := func(dst string, ec [8]byte) *fs.FlowSpecRoute {
+		p := netip.MustParsePrefix(dst)
+		l := fs.FSComponentList{Components: []fs.FSComponent{{Type: fs.ComponentTypeDestinationPrefix, Prefix: &p}}}
+		return &fs.FlowSpecRoute{AFI: fs.AFIIPv4, SAFI: fs.SAFIFlowSpec, Components: l, ExtCommunities: [][8]byte{ec}}
+	}
+	s.deliver(context.Background(), &Update{Announced: []*fs.FlowSpecRoute{
+		route("192.0.2.0/24", [8]byte{0x80, 0x08}),
+		route("192.0.2.0/24", [8]byte{0x80, 0x06}),
+		route("198.51.100.0/24", [8]byte{0x80, 0x06}),
+	}})
+
+	want := []error{fs.ErrActionNotAllowed, nil, fs.ErrRuleLimit}
+	if len(errs) != len(want) {
+		t.Fatalf("OnRoute called %d times, want %d", len(errs), len(want))
+	}
+	for i, w := range want {
+		if !errors.Is(errs[i], w) {
+			t.Errorf("route %d: error = %v, want %v", i, errs[i], w)
+		}
+	}
+}
+
+func TestSessionVRFs(t *testing.T) {
+	var errs []error
+	s, err := NewSession(&SessionConfig{
+		LocalAS:  65001,
+		RouterID: netip.MustParseAddr("192.0.2.2"),
+		RIBs:     fs.NewVRFs(rib.NewTrie()),
+		OnRoute:  func(r *fs.FlowSpecRoute, err error) { errs = append(errs, err) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := netip.MustParsePrefix("192.0.2.0/24")
+	l := fs.FSComponentList{Components: []fs.FSComponent{{Type: fs.ComponentTypeDestinationPrefix, Prefix: &p}}}
+	s.deliver(context.Background(), &Update{Announced: []*fs.FlowSpecRoute{
+		{AFI: fs.AFIIPv4, SAFI: fs.SAFIFlowSpec, Components: l, DestPrefix: &p},
+		{AFI: fs.AFIIPv4, SAFI: fs.SAFIFlowSpecVPN, Components: l, DestPrefix: &p},
+	}})
+	want := []error{fs.ErrNoBestUnicast, fs.ErrNoVRF}
+	if len(errs) != len(want) {
+		t.Fatalf("OnRoute called %d times, want %d", len(errs), len(want))
+	}
+	for i, w := range want {
+		if !errors.Is(errs[i], w) {
+			t.Errorf("route %d: error = %v, want %v", i, errs[i], w)
+		}
+	}
+}
@@ -0,0 +1,551 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+// Package bgp decodes the parts of BGP-4 (RFC4271) messages FlowSpec needs.
+//
+// ParseUpdate extracts FlowSpec NLRI (AFI 1/2, SAFI 133/134) from
+// MP_REACH_NLRI and MP_UNREACH_NLRI together with the attributes used for
+// validation. IPv4 and IPv6 unicast prefixes are returned as well so callers
+// can keep the unicast view FlowSpec routes are validated against. Other
+// address families and attributes are skipped.
+package bgp
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/netip"
+
+	fs "floofspectools/flowspecinternal"
+)
+
+var (
+	ErrShortMessage       = fs.NewError(fs.StageDecode, "short-message", "RFC4271 4.1", "bgp: message shorter than its header or length field")
+	ErrBadMarker          = fs.NewError(fs.StageDecode, "bad-marker", "RFC4271 4.1", "bgp: message header marker is not all ones")
+	ErrNotUpdate          = fs.NewError(fs.StageDecode, "not-update", "RFC4271 4.1", "bgp: message is not an UPDATE")
+	ErrMalformedAttribute = fs.NewError(fs.StageDecode, "malformed-attribute", "RFC7606", "bgp: malformed path attribute")
+)
+
+// Message types as per RFC4271 4.1.
+const (
+	MsgOpen         = 1
+	MsgUpdate       = 2
+	MsgNotification = 3
+	MsgKeepalive    = 4
+	MsgRouteRefresh = 5 // RFC2918 3
+
+	HeaderLen = 19
+)
+
+// Path attribute type codes.
+const (
+	AttrOrigin         = 1
+	AttrASPath         = 2
+	AttrNextHop        = 3
+	AttrCommunities    = 8
+	AttrOriginatorID   = 9
+	AttrClusterList    = 10
+	AttrMPReachNLRI    = 14
+	AttrMPUnreachNLRI  = 15
+	AttrExtCommunities = 16
+	AttrAS4Path        = 17
+)
+
+// Attribute flags.
+const (
+	FlagOptional   = 0x80
+	FlagTransitive = 0x40
+	FlagExtLength  = 0x10
+)
+
+// AS_PATH segment types (RFC4271 4.3, RFC5065 3).
+const (
+	segSet       = 1
+	segSequence  = 2
+	segConfedSeq = 3
+	segConfedSet = 4
+)
+
+// safiUnicast is the RFC4760 SAFI for unicast forwarding.
+const safiUnicast = 1
+
+// rdLen is the length of a route distinguisher (RFC4364 4.2).
+const rdLen = 8
+
+// ParseOptions describes the session the UPDATE was received on.
+type ParseOptions struct {
+	// PeerAS and LocalAS set NeighborAS and FromEBGP of the decoded routes.
+	PeerAS  uint32
+	LocalAS uint32
+	// PeerRouterID is the BGP Identifier of the peer, set as PeerRouterID
+	// of the decoded routes.
+	PeerRouterID netip.Addr
+	// TwoByteAS is set for sessions without the 4-octet AS capability (RFC6793),
+	// AS_PATH then carries 2 octet ASNs and AS4_PATH is merged in.
+	TwoByteAS bool
+	// Validation selects strict decoding of announced FlowSpec NLRI with
+	// fs.Config.CheckStrict. Withdrawn NLRI are always decoded leniently.
+	Validation *fs.Config
+	// Logger, if set, receives malformed UPDATEs: warnings for those handled
+	// by treat-as-withdraw or attribute-discard, errors for session resets.
+	Logger *slog.Logger
+}
+
+// Update holds the FlowSpec content of one UPDATE message.
+type Update struct {
+	// Announced routes carry the message's AS_PATH, ORIGINATOR_ID, CLUSTER_LIST and extended communities.
+	Announced []*fs.FlowSpecRoute
+	// Withdrawn routes only carry AFI, SAFI, RD, Components and DestPrefix.
+	Withdrawn []*fs.FlowSpecRoute
+
+	// Reachable and Unreachable hold the unicast (SAFI 1) prefixes of the
+	// message, from the RFC4271 NLRI fields and from MP_(UN)REACH_NLRI.
+	Reachable   []*fs.UnicastRoute
+	Unreachable []netip.Prefix
+}
+
+// SplitHeader checks the RFC4271 4.1 header of msg and returns type and body.
+func SplitHeader(msg []byte) (typ uint8, body []byte, err error) {
+	if len(msg) < HeaderLen {
+		return 0, nil, ErrShortMessage
+	}
+	for _, b := range msg[:16] {
+		if b != 0xff {
+			return 0, nil, ErrBadMarker
+		}
+	}
+	n := int(binary.BigEndian.Uint16(msg[16:]))
+	if n < HeaderLen || n > len(msg) {
+		return 0, nil, ErrShortMessage
+	}
+	return msg[18], msg[HeaderLen:n], nil
+}
+
+// ParseUpdate decodes a complete UPDATE message, header included.
+func ParseUpdate(msg []byte, opts *ParseOptions) (*Update, error) {
+	typ, body, err := SplitHeader(msg)
+	if err != nil {
+		return nil, err
+	}
+	if typ != MsgUpdate {
+		return nil, ErrNotUpdate
+	}
+	return ParseUpdateBody(body, opts)
+}
+
+// UpdateError is the error of a malformed UPDATE message together with its
+// RFC7606 handling, which is never ErrorHandlingDefault.
+type UpdateError struct {
+	Handling fs.ErrorHandling
+	Err      error
+}
+
+func (e *UpdateError) Error() string {
+	return fmt.Sprintf("%v (%s)", e.Err, e.Handling)
+}
+
+func (e *UpdateError) Unwrap() error {
+	return e.Err
+}
+
+// ParseUpdateBody decodes an UPDATE message without its header.
+//
+// Errors are *UpdateError classified as per RFC7606 and opts.Validation. With
+// SessionReset no Update is returned. With AttributeDiscard the Update lacks
+// the malformed attribute or NLRI, with TreatAsWithdraw its announced routes
+// and prefixes have been moved to Withdrawn and Unreachable. Of several errors
+// the most severe one is returned.
+func ParseUpdateBody(body []byte, opts *ParseOptions) (*Update, error) {
+	var o ParseOptions
+	if opts != nil {
+		o = *opts
+	}
+	reset := func(err error) (*Update, error) {
+		ue := &UpdateError{Handling: fs.SessionReset, Err: err}
+		o.log(ue)
+		return nil, ue
+	}
+	var fault *UpdateError
+	fail := func(h fs.ErrorHandling, err error) {
+		if fault == nil || h > fault.Handling {
+			fault = &UpdateError{Handling: h, Err: err}
+		}
+	}
+
+	if len(body) < 2 {
+		return reset(ErrShortMessage)
+	}
+	wlen := int(binary.BigEndian.Uint16(body))
+	if len(body) < 2+wlen+2 {
+		return reset(ErrShortMessage)
+	}
+	withdrawn := body[2 : 2+wlen]
+	attrs := body[2+wlen:]
+	alen := int(binary.BigEndian.Uint16(attrs))
+	if len(attrs) < 2+alen {
+		return reset(ErrShortMessage)
+	}
+	nlri := attrs[2+alen:]
+	attrs = attrs[2 : 2+alen]
+
+	var (
+		u                    Update
+		asPath, as4Path      []uint32
+		hasAS4               bool
+		originatorID         netip.Addr
+		clusterList          []netip.Addr
+		extComms             [][8]byte
+		comms                []uint32
+		reach, unreach       []byte
+		nextHop              netip.Addr
+		reachFam, unreachFam Family
+	)
+	for len(attrs) > 0 {
+		if len(attrs) < 3 {
+			return reset(ErrMalformedAttribute)
+		}
+		flags, code := attrs[0], attrs[1]
+		hdr, n := 3, int(attrs[2])
+		if flags&FlagExtLength != 0 {
+			if len(attrs) < 4 {
+				return reset(ErrMalformedAttribute)
+			}
+			hdr, n = 4, int(binary.BigEndian.Uint16(attrs[2:]))
+		}
+		if len(attrs) < hdr+n {
+			return reset(ErrMalformedAttribute)
+		}
+		v := attrs[hdr : hdr+n]
+		attrs = attrs[hdr+n:]
+
+		var err error
+		switch code {
+		case AttrASPath:
+			asSize := 4
+			if o.TwoByteAS {
+				asSize = 2
+			}
+			if asPath, err = parseASPath(v, asSize); err != nil {
+				fail(o.Validation.AttributeErrorHandling(), err)
+			}
+		case AttrAS4Path:
+			// RFC6793 6: a malformed AS4_PATH is discarded
+			if as4Path, err = parseASPath(v, 4); err != nil {
+				fail(fs.AttributeDiscard, err)
+			}
+			hasAS4 = err == nil
+		case AttrOriginatorID:
+			if len(v) != 4 {
+				fail(o.Validation.AttributeErrorHandling(), ErrMalformedAttribute)
+				continue
+			}
+			originatorID = netip.AddrFrom4([4]byte(v))
+		case AttrClusterList:
+			// RFC7606 7.11
+			if len(v) == 0 || len(v)%4 != 0 {
+				fail(o.Validation.AttributeErrorHandling(), ErrMalformedAttribute)
+				continue
+			}
+			for i := 0; i < len(v); i += 4 {
+				clusterList = append(clusterList, netip.AddrFrom4([4]byte(v[i:i+4])))
+			}
+		case AttrCommunities:
+			if len(v)%4 != 0 {
+				fail(o.Validation.AttributeErrorHandling(), ErrMalformedAttribute)
+				continue
+			}
+			for i := 0; i < len(v); i += 4 {
+				comms = append(comms, binary.BigEndian.Uint32(v[i:]))
+			}
+		case AttrExtCommunities:
+			if len(v)%8 != 0 {
+				fail(o.Validation.AttributeErrorHandling(), ErrMalformedAttribute)
+				continue
+			}
+			for i := 0; i < len(v); i += 8 {
+				extComms = append(extComms, [8]byte(v[i:i+8]))
+			}
+		case AttrMPReachNLRI:
+			if reachFam, nextHop, reach, err = parseMPReach(v); err != nil {
+				return reset(err)
+			}
+		case AttrMPUnreachNLRI:
+			if len(v) < 3 {
+				return reset(ErrMalformedAttribute)
+			}
+			unreachFam = Family{AFI: binary.BigEndian.Uint16(v), SAFI: v[2]}
+			unreach = v[3:]
+		}
+	}
+	if o.TwoByteAS && hasAS4 && len(as4Path) <= len(asPath) {
+		// RFC6793 4.2.3: AS4_PATH replaces the trailing part of AS_PATH
+		asPath = append(asPath[:len(asPath)-len(as4Path)], as4Path...)
+	}
+
+	var err error
+	if u.Unreachable, err = parsePrefixes(withdrawn, fs.AFIIPv4); err != nil {
+		return reset(err)
+	}
+	reachable, err := parsePrefixes(nlri, fs.AFIIPv4)
+	if err != nil {
+		return reset(err)
+	}
+	if reachFam.unicast() {
+		more, err := parsePrefixes(reach, reachFam.AFI)
+		if err != nil {
+			return reset(err)
+		}
+		reachable = append(reachable, more...)
+	}
+	if unreachFam.unicast() {
+		more, err := parsePrefixes(unreach, unreachFam.AFI)
+		if err != nil {
+			return reset(err)
+		}
+		u.Unreachable = append(u.Unreachable, more...)
+	}
+	for _, p := range reachable {
+		u.Reachable = append(u.Reachable, &fs.UnicastRoute{
+			Prefix:       p,
+			NeighborAS:   o.PeerAS,
+			ASPath:       asPath,
+			OriginatorID: originatorID,
+			PeerRouterID: o.PeerRouterID,
+			ClusterList:  clusterList,
+		})
+	}
+
+	if reachFam.flowSpecUnder(o.Validation) {
+		routes, malformed, err := parseNLRIs(reach, reachFam)
+		if err != nil {
+			return reset(err)
+		}
+		for _, r := range routes {
+			if err := o.Validation.CheckStrict(r.Components, r.AFI); err != nil {
+				malformed = append(malformed, err)
+				continue
+			}
+			r.FromEBGP = o.PeerAS != o.LocalAS
+			r.NeighborAS = o.PeerAS
+			r.ASPath = asPath
+			r.OriginatorID = originatorID
+			r.PeerRouterID = o.PeerRouterID
+			r.ClusterList = clusterList
+			r.NextHop = nextHop
+			r.ExtCommunities = extComms
+			r.Communities = comms
+			u.Announced = append(u.Announced, r)
+		}
+		if len(malformed) > 0 {
+			fail(o.Validation.NLRIErrorHandling(), errors.Join(malformed...))
+		}
+	}
+	if unreachFam.flowSpecUnder(o.Validation) {
+		routes, malformed, err := parseNLRIs(unreach, unreachFam)
+		if err != nil {
+			return reset(err)
+		}
+		u.Withdrawn = routes
+		if len(malformed) > 0 {
+			fail(o.Validation.NLRIErrorHandling(), errors.Join(malformed...))
+		}
+	}
+
+	if fault != nil {
+		o.log(fault)
+	}
+	switch {
+	case fault == nil:
+		return &u, nil
+	case fault.Handling == fs.SessionReset:
+		return nil, fault
+	case fault.Handling == fs.TreatAsWithdraw:
+		for _, r := range u.Announced {
+			u.Withdrawn = append(u.Withdrawn, &fs.FlowSpecRoute{
+				AFI: r.AFI, SAFI: r.SAFI, RD: r.RD, Components: r.Components, DestPrefix: r.DestPrefix,
+			})
+		}
+		for _, r := range u.Reachable {
+			u.Unreachable = append(u.Unreachable, r.Prefix)
+		}
+		u.Announced, u.Reachable = nil, nil
+	}
+	return &u, fault
+}
+
+func (o *ParseOptions) log(e *UpdateError) {
+	if o.Logger == nil {
+		return
+	}
+	level := slog.LevelWarn
+	if e.Handling == fs.SessionReset {
+		level = slog.LevelError
+	}
+	fs.SubsystemLogger(o.Logger, fs.SubsystemDecode).Log(context.Background(), level, "malformed UPDATE",
+		fs.LogKeyPeer, o.PeerAS, "handling", e.Handling.String(), "error", e.Err)
+}
+
+// Family is an AFI/SAFI pair.
+type Family struct {
+	AFI  uint16
+	SAFI uint8
+}
+
+// Known FlowSpec families.
+var (
+	FamilyIPv4FlowSpec    = Family{AFI: fs.AFIIPv4, SAFI: fs.SAFIFlowSpec}
+	FamilyIPv6FlowSpec    = Family{AFI: fs.AFIIPv6, SAFI: fs.SAFIFlowSpec}
+	FamilyIPv4FlowSpecVPN = Family{AFI: fs.AFIIPv4, SAFI: fs.SAFIFlowSpecVPN}
+	FamilyIPv6FlowSpecVPN = Family{AFI: fs.AFIIPv6, SAFI: fs.SAFIFlowSpecVPN}
+	// FamilyL2VPNFlowSpec is only negotiated and decoded with
+	// fs.Config.ExperimentalL2VPN.
+	FamilyL2VPNFlowSpec = Family{AFI: fs.AFIL2VPN, SAFI: fs.SAFIFlowSpecVPN}
+)
+
+func (f Family) String() string {
+	return fmt.Sprintf("%d/%d", f.AFI, f.SAFI)
+}
+
+func (f Family) unicast() bool {
+	return (f.AFI == fs.AFIIPv4 || f.AFI == fs.AFIIPv6) && f.SAFI == safiUnicast
+}
+
+func (f Family) flowSpec() bool {
+	return (f.AFI == fs.AFIIPv4 || f.AFI == fs.AFIIPv6) &&
+		(f.SAFI == fs.SAFIFlowSpec || f.SAFI == fs.SAFIFlowSpecVPN)
+}
+
+// flowSpecUnder reports whether f is a FlowSpec family handled under cfg,
+// which adds FamilyL2VPNFlowSpec with ExperimentalL2VPN.
+func (f Family) flowSpecUnder(cfg *fs.Config) bool {
+	return f.flowSpec() || f == FamilyL2VPNFlowSpec && cfg != nil && cfg.ExperimentalL2VPN
+}
+
+// parseMPReach returns the family, next hop and NLRI field of an
+// MP_REACH_NLRI attribute (RFC4760 3).
+func parseMPReach(v []byte) (Family, netip.Addr, []byte, error) {
+	if len(v) < 5 {
+		return Family{}, netip.Addr{}, nil, ErrMalformedAttribute
+	}
+	f := Family{AFI: binary.BigEndian.Uint16(v), SAFI: v[2]}
+	nhLen := int(v[3])
+	if len(v) < 4+nhLen+1 {
+		return Family{}, netip.Addr{}, nil, ErrMalformedAttribute
+	}
+	return f, parseNextHop(v[4 : 4+nhLen]), v[4+nhLen+1:], nil
+}
+
+// parseNextHop returns the address of a next hop field: IPv4, IPv6, the
+// global one of an IPv6 global and link-local pair (RFC2545 3), each
+// optionally preceded by a zero route distinguisher (RFC4364 4.3.2,
+// RFC4659 3.2). It returns the zero Addr for an empty or unknown field.
+func parseNextHop(nh []byte) netip.Addr {
+	switch len(nh) {
+	case 12, 24, 48:
+		nh = nh[8:]
+	}
+	switch len(nh) {
+	case 4:
+		return netip.AddrFrom4([4]byte(nh))
+	case 16, 32:
+		return netip.AddrFrom16([16]byte(nh[:16]))
+	}
+	return netip.Addr{}
+}
+
+// parseASPath flattens AS_SEQUENCE and AS_SET members; confederation segments are dropped.
+func parseASPath(v []byte, asSize int) ([]uint32, error) {
+	var path []uint32
+	for len(v) > 0 {
+		if len(v) < 2 {
+			return nil, ErrMalformedAttribute
+		}
+		typ, n := v[0], int(v[1])
+		if len(v) < 2+n*asSize {
+			return nil, ErrMalformedAttribute
+		}
+		seg := v[2 : 2+n*asSize]
+		v = v[2+n*asSize:]
+		switch typ {
+		case segSet, segSequence:
+			for i := 0; i < len(seg); i += asSize {
+				if asSize == 2 {
+					path = append(path, uint32(binary.BigEndian.Uint16(seg[i:])))
+				} else {
+					path = append(path, binary.BigEndian.Uint32(seg[i:]))
+				}
+			}
+		case segConfedSeq, segConfedSet:
+		default:
+			return nil, ErrMalformedAttribute
+		}
+	}
+	return path, nil
+}
+
+// parseNLRIs decodes all FlowSpec NLRI in b. For SAFI 134 every NLRI starts
+// with a route distinguisher covered by the length field. NLRI whose contents
+// do not decode are skipped and returned in malformed; err is set only when
+// the length fields do not add up, so the NLRI cannot be located.
+func parseNLRIs(b []byte, f Family) (routes []*fs.FlowSpecRoute, malformed []error, err error) {
+	for len(b) > 0 {
+		n, hdr, err := fs.ReadNLRILength(b)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(b) < hdr+n {
+			return nil, nil, fs.ErrMalformedNLRI
+		}
+		value := b[hdr : hdr+n]
+		b = b[hdr+n:]
+
+		r := &fs.FlowSpecRoute{AFI: f.AFI, SAFI: f.SAFI}
+		if f.SAFI == fs.SAFIFlowSpecVPN {
+			if len(value) < rdLen {
+				malformed = append(malformed, fs.ErrMalformedNLRI)
+				continue
+			}
+			r.RD = [8]byte(value[:rdLen])
+			value = value[rdLen:]
+		}
+		if r.Components, err = fs.DecodeComponents(value, f.AFI); err != nil {
+			malformed = append(malformed, err)
+			continue
+		}
+		for _, c := range r.Components.Components {
+			if c.Type == fs.ComponentTypeDestinationPrefix {
+				r.DestPrefix = c.Prefix
+			}
+		}
+		routes = append(routes, r)
+	}
+	return routes, malformed, nil
+}
+
+// parsePrefixes decodes a sequence of RFC4271 4.3 length, prefix pairs.
+func parsePrefixes(b []byte, afi uint16) ([]netip.Prefix, error) {
+	size := 4
+	if afi == fs.AFIIPv6 {
+		size = 16
+	}
+	var out []netip.Prefix
+	for len(b) > 0 {
+		bits := int(b[0])
+		n := (bits + 7) / 8
+		if bits > size*8 || len(b) < 1+n {
+			return nil, ErrMalformedAttribute
+		}
+		var a [16]byte
+		copy(a[:], b[1:1+n])
+		b = b[1+n:]
+		addr := netip.AddrFrom16(a)
+		if size == 4 {
+			addr = netip.AddrFrom4([4]byte(a[:4]))
+		}
+		out = append(out, netip.PrefixFrom(addr, bits).Masked())
+	}
+	return out, nil
+}
@@ -0,0 +1,366 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package bgp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"log/slog"
+	"net/netip"
+	"slices"
+	"strings"
+	"testing"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/announce"
+)
+
+func attr(flags, code byte, v []byte) []byte {
+	if len(v) > 255 {
+		return append(binary.BigEndian.AppendUint16([]byte{flags | FlagExtLength, code}, uint16(len(v))), v...)
+	}
+	return append([]byte{flags, code, byte(len(v))}, v...)
+}
+
+func update(attrs ...[]byte) []byte {
+	a := bytes.Join(attrs, nil)
+	body := binary.BigEndian.AppendUint16([]byte{0, 0}, uint16(len(a)))
+	body = append(body, a...)
+	msg := bytes.Repeat([]byte{0xff}, 16)
+	msg = binary.BigEndian.AppendUint16(msg, uint16(HeaderLen+len(body)))
+	msg = append(msg, MsgUpdate)
+	return append(msg, body...)
+}
+
+func asPath4(segType byte, asns ...uint32) []byte {
+	b := []byte{segType, byte(len(asns))}
+	for _, as := range asns {
+		b = binary.BigEndian.AppendUint32(b, as)
+	}
+	return b
+}
+
+// RFC8955 4.3 example 1: destination 192.0.2.0/24, ip protocol tcp, port 25
+var example1 = []byte{0x0b, 0x01, 0x18, 0xc0, 0x00, 0x02, 0x03, 0x81, 0x06, 0x04, 0x81, 0x19}
+
+func TestParseUpdate(t *testing.T) {
+	discard := [8]byte{0x80, 0x06, 0, 0, 0, 0, 0, 0}
+	reach := append([]byte{0, 1, 133, 0, 0}, example1...)
+	msg := update(
+		attr(FlagTransitive, AttrOrigin, []byte{0}),
+		attr(FlagTransitive, AttrASPath, slices.Concat(asPath4(segConfedSeq, 65001), asPath4(segSequence, 64500, 64501))),
+		attr(FlagOptional, AttrOriginatorID, []byte{192, 0, 2, 1}),
+		attr(FlagOptional, AttrClusterList, []byte{192, 0, 2, 2, 192, 0, 2, 3}),
+		attr(FlagOptional|FlagTransitive, AttrCommunities, []byte{0xff, 0xff, 0x00, 0x06}),
+		attr(FlagOptional|FlagTransitive, AttrExtCommunities, discard[:]),
+		attr(FlagOptional, AttrMPReachNLRI, reach),
+		attr(FlagOptional, AttrMPUnreachNLRI, []byte{0, 2, 133, 0x07, 0x01, 0x20, 0x00, 0x20, 0x01, 0x0d, 0xb8}),
+	)
+
+	u, err := ParseUpdate(msg, &ParseOptions{PeerAS: 64500, LocalAS: 65000, PeerRouterID: netip.AddrFrom4([4]byte{198, 51, 100, 1})})
+	if err != nil {
+		t.Fatalf("ParseUpdate() error = %v, want <nil>", err)
+	}
+	if len(u.Announced) != 1 || len(u.Withdrawn) != 1 {
+		t.Fatalf("ParseUpdate() = %d announced, %d withdrawn, want 1, 1", len(u.Announced), len(u.Withdrawn))
+	}
+	r := u.Announced[0]
+	if got, want := r.Components.Canonical(nil), "dst=192.0.2.0/24 proto=6 port=25"; got != want {
+		t.Errorf("Components = %q, want %q", got, want)
+	}
+	if r.DestPrefix == nil || r.DestPrefix.String() != "192.0.2.0/24" {
+		t.Errorf("DestPrefix = %v, want 192.0.2.0/24", r.DestPrefix)
+	}
+	if !slices.Equal(r.ASPath, []uint32{64500, 64501}) {
+		t.Errorf("ASPath = %v, want [64500 64501] (confederation segment dropped)", r.ASPath)
+	}
+	if r.OriginatorID != netip.AddrFrom4([4]byte{192, 0, 2, 1}) {
+		t.Errorf("OriginatorID = %v, want 192.0.2.1", r.OriginatorID)
+	}
+	if want := []netip.Addr{netip.AddrFrom4([4]byte{192, 0, 2, 2}), netip.AddrFrom4([4]byte{192, 0, 2, 3})}; !slices.Equal(r.ClusterList, want) {
+		t.Errorf("ClusterList = %v, want %v", r.ClusterList, want)
+	}
+	if r.PeerRouterID != netip.AddrFrom4([4]byte{198, 51, 100, 1}) {
+		t.Errorf("PeerRouterID = %v, want 198.51.100.1", r.PeerRouterID)
+	}
+	if !r.FromEBGP || r.NeighborAS != 64500 || r.AFI != fs.AFIIPv4 || r.SAFI != fs.SAFIFlowSpec {
+		t.Errorf("route = %+v, want eBGP from AS64500, AFI 1 SAFI 133", r)
+	}
+	if len(r.ExtCommunities) != 1 || r.ExtCommunities[0] != discard {
+		t.Errorf("ExtCommunities = %x, want [%x]", r.ExtCommunities, discard)
+	}
+	if !slices.Equal(r.Communities, []uint32{fs.CommunityLLGRStale}) {
+		t.Errorf("Communities = %x, want [%x]", r.Communities, fs.CommunityLLGRStale)
+	}
+	if got, want := u.Withdrawn[0].Components.Canonical(nil), "dst=2001:db8::/32"; got != want {
+		t.Errorf("Withdrawn = %q, want %q", got, want)
+	}
+}
+
+func TestParseUpdateVPN(t *testing.T) {
+	rd := [8]byte{0, 0, 0xfd, 0xe8, 0, 0, 0, 100}
+	nlri := append([]byte{byte(8 + len(example1) - 1)}, rd[:]...)
+	nlri = append(nlri, example1[1:]...)
+	msg := update(attr(FlagOptional, AttrMPReachNLRI, append([]byte{0, 1, 134, 0, 0}, nlri...)))
+
+	u, err := ParseUpdate(msg, nil)
+	if err != nil {
+		t.Fatalf("ParseUpdate() error = %v, want <nil>", err)
+	}
+	if len(u.Announced) != 1 || u.Announced[0].RD != rd || u.Announced[0].SAFI != fs.SAFIFlowSpecVPN {
+		t.Errorf("ParseUpdate() = %+v, want one SAFI 134 route with RD %x", u.Announced, rd)
+	}
+}
+
+func TestParseUpdateNextHop(t *testing.T) {
+	v6 := netip.MustParseAddr("2001:db8::1")
+	ll := netip.MustParseAddr("fe80::1")
+	tests := []struct {
+		name string
+		nh   []byte
+		want netip.Addr
+	}{
+		{name: "None", nh: nil},
+		{name: "IPv4", nh: []byte{192, 0, 2, 1}, want: netip.AddrFrom4([4]byte{192, 0, 2, 1})},
+		{name: "IPv6", nh: v6.AsSlice(), want: v6},
+		{name: "IPv6LinkLocal", nh: append(v6.AsSlice(), ll.AsSlice()...), want: v6},
+		{name: "VPNv4", nh: []byte{0, 0, 0, 0, 0, 0, 0, 0, 192, 0, 2, 1}, want: netip.AddrFrom4([4]byte{192, 0, 2, 1})},
+		{name: "Unknown", nh: []byte{1, 2, 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mp := append([]byte{0, 1, 133, byte(len(tt.nh))}, tt.nh...)
+			mp = append(append(mp, 0), example1...)
+			u, err := ParseUpdate(update(attr(FlagOptional, AttrMPReachNLRI, mp)), nil)
+			if err != nil || len(u.Announced) != 1 {
+				t.Fatalf("ParseUpdate() = %+v, %v, want one route", u, err)
+			}
+			if got := u.Announced[0].NextHop; got != tt.want {
+				t.Errorf("NextHop = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncodeUpdateVPN(t *testing.T) {
+	rd := [8]byte{0, 0, 0xfd, 0xe8, 0, 0, 0, 100}
+	rt, _ := fs.ParseRouteTarget("65000:1")
+	dst := netip.MustParsePrefix("2001:db8::/32")
+	msg, err := EncodeUpdate(announce.Update{
+		Components:   fs.FSComponentList{Components: []fs.FSComponent{{Type: fs.ComponentTypeDestinationPrefix, Prefix: &dst}}},
+		RD:           &rd,
+		RouteTargets: [][8]byte{rt},
+	}, EncodeOptions{LocalAS: 65000})
+	if err != nil {
+		t.Fatalf("EncodeUpdate() error = %v", err)
+	}
+	u, err := ParseUpdate(msg, nil)
+	if err != nil {
+		t.Fatalf("ParseUpdate() error = %v, want <nil>", err)
+	}
+	if len(u.Announced) != 1 {
+		t.Fatalf("ParseUpdate() = %d announced, want 1", len(u.Announced))
+	}
+	r := u.Announced[0]
+	if r.RD != rd || r.AFI != fs.AFIIPv6 || r.SAFI != fs.SAFIFlowSpecVPN || !slices.Equal(r.ExtCommunities, [][8]byte{rt}) {
+		t.Errorf("ParseUpdate() = %+v, want an IPv6 SAFI 134 route with RD %x and route target %x", r, rd, rt)
+	}
+}
+
+func TestParseUpdateL2VPN(t *testing.T) {
+	rd := [8]byte{0, 0, 0xfd, 0xe8, 0, 0, 0, 100}
+	value := []byte{0x0e, 0x91, 0x08, 0x00, 0x15, 0x81, 0x64} // ether-type =0x0800, vlan =100
+	nlri := slices.Concat([]byte{byte(8 + len(value))}, rd[:], value)
+	msg := update(attr(FlagOptional, AttrMPReachNLRI, append([]byte{0, 25, 134, 0, 0}, nlri...)))
+
+	if u, err := ParseUpdate(msg, nil); err != nil || len(u.Announced) != 0 {
+		t.Errorf("ParseUpdate() = %+v, %v, want the L2VPN family ignored by default", u, err)
+	}
+	u, err := ParseUpdate(msg, &ParseOptions{Validation: &fs.Config{ExperimentalL2VPN: true}})
+	if err != nil {
+		t.Fatalf("ParseUpdate(ExperimentalL2VPN) error = %v, want <nil>", err)
+	}
+	if len(u.Announced) != 1 || u.Announced[0].AFI != fs.AFIL2VPN || u.Announced[0].RD != rd {
+		t.Fatalf("ParseUpdate(ExperimentalL2VPN) = %+v, want one L2VPN route with RD %x", u.Announced, rd)
+	}
+	if got, want := u.Announced[0].Components.Canonical(nil), "ether-type=2048 vlan=100"; got != want {
+		t.Errorf("Components = %q, want %q", got, want)
+	}
+}
+
+func TestParseUpdateTwoByteAS(t *testing.T) {
+	// AS_PATH 64500 AS_TRANS, AS4_PATH 4200000000
+	asPath := []byte{segSequence, 2, 0xfb, 0xf4, 0x5b, 0xa0}
+	msg := update(
+		attr(FlagTransitive, AttrASPath, asPath),
+		attr(FlagOptional|FlagTransitive, AttrAS4Path, asPath4(segSequence, 4200000000)),
+		attr(FlagOptional, AttrMPReachNLRI, append([]byte{0, 1, 133, 0, 0}, example1...)),
+	)
+	u, err := ParseUpdate(msg, &ParseOptions{TwoByteAS: true})
+	if err != nil {
+		t.Fatalf("ParseUpdate() error = %v, want <nil>", err)
+	}
+	if got := u.Announced[0].ASPath; !slices.Equal(got, []uint32{64500, 4200000000}) {
+		t.Errorf("ASPath = %v, want [64500 4200000000]", got)
+	}
+}
+
+func TestParseUpdateUnicast(t *testing.T) {
+	msg := update(
+		attr(FlagTransitive, AttrASPath, asPath4(segSequence, 64500)),
+		attr(FlagOptional, AttrMPReachNLRI, []byte{0, 2, 1, 16, 0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0x20, 0x20, 0x01, 0x0d, 0xb8}),
+	)
+	// IPv4 withdrawn routes field: 198.51.100.0/24
+	msg = slices.Concat(msg[:HeaderLen], []byte{0, 4, 24, 198, 51, 100}, msg[HeaderLen+2:], []byte{24, 192, 0, 2})
+	binary.BigEndian.PutUint16(msg[16:], uint16(len(msg)))
+
+	u, err := ParseUpdate(msg, &ParseOptions{PeerAS: 64500})
+	if err != nil {
+		t.Fatalf("ParseUpdate() error = %v, want <nil>", err)
+	}
+	var got []string
+	for _, r := range u.Reachable {
+		got = append(got, r.Prefix.String())
+		if r.NeighborAS != 64500 || !slices.Equal(r.ASPath, []uint32{64500}) {
+			t.Errorf("route %v = %+v, want neighbor and AS_PATH 64500", r.Prefix, r)
+		}
+	}
+	if want := []string{"192.0.2.0/24", "2001:db8::/32"}; !slices.Equal(got, want) {
+		t.Errorf("Reachable = %v, want %v", got, want)
+	}
+	if len(u.Unreachable) != 1 || u.Unreachable[0].String() != "198.51.100.0/24" {
+		t.Errorf("Unreachable = %v, want [198.51.100.0/24]", u.Unreachable)
+	}
+}
+
+func TestParseUpdateErrors(t *testing.T) {
+	valid := update(attr(FlagOptional, AttrMPReachNLRI, append([]byte{0, 1, 133, 0, 0}, example1...)))
+	badMarker := slices.Clone(valid)
+	badMarker[0] = 0
+	keepalive := slices.Clone(valid[:HeaderLen])
+	keepalive[17], keepalive[18] = HeaderLen, MsgKeepalive
+
+	tests := []struct {
+		name    string
+		msg     []byte
+		wantErr error
+	}{
+		{name: "Short", msg: valid[:10], wantErr: ErrShortMessage},
+		{name: "BadMarker", msg: badMarker, wantErr: ErrBadMarker},
+		{name: "NotUpdate", msg: keepalive, wantErr: ErrNotUpdate},
+		{name: "TruncatedAttribute", msg: update([]byte{FlagOptional, AttrOriginatorID, 4, 1}), wantErr: ErrMalformedAttribute},
+		{name: "OriginatorIDLength", msg: update(attr(FlagOptional, AttrOriginatorID, []byte{1, 2, 3})), wantErr: ErrMalformedAttribute},
+		{name: "ClusterListLength", msg: update(attr(FlagOptional, AttrClusterList, []byte{1, 2, 3, 4, 5})), wantErr: ErrMalformedAttribute},
+		{name: "ExtCommunityLength", msg: update(attr(FlagOptional, AttrExtCommunities, []byte{1, 2, 3})), wantErr: ErrMalformedAttribute},
+		{name: "BadSegment", msg: update(attr(FlagTransitive, AttrASPath, asPath4(9, 1))), wantErr: ErrMalformedAttribute},
+		{
+			name:    "MalformedNLRI",
+			msg:     update(attr(FlagOptional, AttrMPReachNLRI, []byte{0, 1, 133, 0, 0, 0x03, 0x04, 0x81, 0x19, 0x03})),
+			wantErr: fs.ErrMalformedNLRI,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseUpdate(tt.msg, nil)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("ParseUpdate(%x) error = %v, want %v", tt.msg, err, tt.wantErr)
+			}
+			if got := fs.ErrorStage(err); got != fs.StageDecode {
+				t.Errorf("ErrorStage() = %v, want %v", got, fs.StageDecode)
+			}
+		})
+	}
+}
+
+func TestParseUpdateStrict(t *testing.T) {
+	// dscp =64
+	nlri := []byte{0x03, 0x0b, 0x81, 0x40}
+	announce := update(attr(FlagOptional, AttrMPReachNLRI, append([]byte{0, 1, 133, 0, 0}, nlri...)))
+	withdraw := update(attr(FlagOptional, AttrMPUnreachNLRI, append([]byte{0, 1, 133}, nlri...)))
+	strict := &ParseOptions{Validation: &fs.Config{Strict: true}}
+
+	if _, err := ParseUpdate(announce, nil); err != nil {
+		t.Errorf("ParseUpdate(lenient) error = %v, want <nil>", err)
+	}
+	if _, err := ParseUpdate(announce, strict); !errors.Is(err, fs.ErrInvalidComponentValue) {
+		t.Errorf("ParseUpdate(strict) error = %v, want %v", err, fs.ErrInvalidComponentValue)
+	}
+	if u, err := ParseUpdate(withdraw, strict); err != nil || len(u.Withdrawn) != 1 {
+		t.Errorf("ParseUpdate(strict withdraw) = %v, %v, want one withdrawn route", u, err)
+	}
+}
+
+func TestParseUpdateErrorHandling(t *testing.T) {
+	// type 13 is unknown
+	unknown := []byte{0x03, 0x0d, 0x81, 0x00}
+	reach := attr(FlagOptional, AttrMPReachNLRI, slices.Concat([]byte{0, 1, 133, 0, 0}, example1, unknown))
+	valid := attr(FlagOptional, AttrMPReachNLRI, append([]byte{0, 1, 133, 0, 0}, example1...))
+
+	tests := []struct {
+		name          string
+		msg           []byte
+		cfg           *fs.Config
+		want          fs.ErrorHandling
+		wantAnnounced int
+		wantWithdrawn int
+	}{
+		{name: "MalformedNLRI", msg: update(reach), want: fs.TreatAsWithdraw, wantWithdrawn: 1},
+		{name: "MalformedNLRIDiscard", msg: update(reach), cfg: &fs.Config{MalformedNLRI: fs.AttributeDiscard}, want: fs.AttributeDiscard, wantAnnounced: 1},
+		{name: "MalformedNLRIReset", msg: update(reach), cfg: &fs.Config{MalformedNLRI: fs.SessionReset}, want: fs.SessionReset},
+		{
+			name:          "MalformedWithdrawal",
+			msg:           update(attr(FlagOptional, AttrMPUnreachNLRI, slices.Concat([]byte{0, 1, 133}, unknown, example1))),
+			want:          fs.TreatAsWithdraw,
+			wantWithdrawn: 1,
+		},
+		{name: "ExtCommunities", msg: update(attr(FlagOptional, AttrExtCommunities, []byte{1, 2, 3}), valid), want: fs.TreatAsWithdraw, wantWithdrawn: 1},
+		{
+			name: "ExtCommunitiesReset",
+			msg:  update(attr(FlagOptional, AttrExtCommunities, []byte{1, 2, 3}), valid),
+			cfg:  &fs.Config{MalformedAttribute: fs.SessionReset},
+			want: fs.SessionReset,
+		},
+		{
+			name:          "AS4Path",
+			msg:           update(attr(FlagOptional|FlagTransitive, AttrAS4Path, []byte{9, 1, 0, 0, 0, 1}), valid),
+			want:          fs.AttributeDiscard,
+			wantAnnounced: 1,
+		},
+		{name: "Framing", msg: update([]byte{FlagOptional, AttrOriginatorID, 4, 1}), want: fs.SessionReset},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := ParseUpdate(tt.msg, &ParseOptions{Validation: tt.cfg})
+			var ue *UpdateError
+			if !errors.As(err, &ue) || ue.Handling != tt.want {
+				t.Fatalf("ParseUpdate() error = %v, want %s", err, tt.want)
+			}
+			if tt.want == fs.SessionReset {
+				if u != nil {
+					t.Errorf("ParseUpdate() = %+v, want <nil>", u)
+				}
+				return
+			}
+			if len(u.Announced) != tt.wantAnnounced || len(u.Withdrawn) != tt.wantWithdrawn {
+				t.Errorf("ParseUpdate() = %d announced, %d withdrawn, want %d, %d",
+					len(u.Announced), len(u.Withdrawn), tt.wantAnnounced, tt.wantWithdrawn)
+			}
+		})
+	}
+}
+
+func TestParseUpdateLog(t *testing.T) {
+	var buf bytes.Buffer
+	msg := update(attr(FlagOptional, AttrExtCommunities, []byte{1, 2, 3}))
+	if _, err := ParseUpdate(msg, &ParseOptions{PeerAS: 64500, Logger: slog.New(slog.NewTextHandler(&buf, nil))}); err == nil {
+		t.Fatal("ParseUpdate() error = <nil>, want treat-as-withdraw")
+	}
+	for _, want := range []string{"level=WARN", "subsystem=decode", "peer=64500", "handling=treat-as-withdraw"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("log lacks %q: %s", want, buf.String())
+		}
+	}
+}
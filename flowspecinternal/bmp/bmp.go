@@ -0,0 +1,309 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+// Package bmp receives BGP Monitoring Protocol (RFC7854) feeds from routers.
+//
+// A Receiver keeps the unicast routes each monitored peer advertised and
+// validates the peer's FlowSpec routes against that view, so the feed shows
+// which rules a router in the field received and whether they are feasible.
+package bmp
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/bgp"
+	"floofspectools/flowspecinternal/rib"
+)
+
+var (
+	ErrBadVersion    = errors.New("bmp: unsupported version")
+	ErrShortMessage  = errors.New("bmp: message shorter than its header or length field")
+	ErrMessageTooBig = errors.New("bmp: message exceeds the maximum length")
+)
+
+// Version is the BMP version implemented (RFC7854 4.1).
+const Version = 3
+
+// Message types as per RFC7854 4.1.
+const (
+	MsgRouteMonitoring = 0
+	MsgStatistics      = 1
+	MsgPeerDown        = 2
+	MsgPeerUp          = 3
+	MsgInitiation      = 4
+	MsgTermination     = 5
+	MsgRouteMirroring  = 6
+)
+
+// Per-peer header flags (RFC7854 4.2).
+const (
+	FlagIPv6       = 0x80
+	FlagPostPolicy = 0x40
+	FlagTwoByteAS  = 0x20
+)
+
+const (
+	commonHeaderLen = 6
+	peerHeaderLen   = 42
+	maxMessageLen   = 1 << 20
+	peerUpFixedLen  = 20 // local address, local and remote port
+	bgpLengthOffset = 16
+)
+
+// PeerHeader is the RFC7854 4.2 per-peer header.
+type PeerHeader struct {
+	Type          uint8
+	Flags         uint8
+	Distinguisher [8]byte
+	Address       netip.Addr
+	AS            uint32
+	BGPID         netip.Addr
+	Timestamp     time.Time
+}
+
+// Message is one BMP message. Peer is set for the message types that carry a
+// per-peer header, Body holds the rest of the message.
+type Message struct {
+	Type uint8
+	Peer *PeerHeader
+	Body []byte
+}
+
+// ReadMessage reads one BMP message from r.
+func ReadMessage(r io.Reader) (*Message, error) {
+	var hdr [commonHeaderLen]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, err
+	}
+	if hdr[0] != Version {
+		return nil, ErrBadVersion
+	}
+	n := int(binary.BigEndian.Uint32(hdr[1:]))
+	if n < commonHeaderLen {
+		return nil, ErrShortMessage
+	}
+	if n > maxMessageLen {
+		return nil, ErrMessageTooBig
+	}
+	body := make([]byte, n-commonHeaderLen)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	m := &Message{Type: hdr[5], Body: body}
+	switch m.Type {
+	case MsgRouteMonitoring, MsgStatistics, MsgPeerDown, MsgPeerUp, MsgRouteMirroring:
+		if len(body) < peerHeaderLen {
+			return nil, ErrShortMessage
+		}
+		m.Peer = parsePeerHeader(body)
+		m.Body = body[peerHeaderLen:]
+	}
+	return m, nil
+}
+
+func parsePeerHeader(b []byte) *PeerHeader {
+	h := &PeerHeader{
+		Type:          b[0],
+		Flags:         b[1],
+		Distinguisher: [8]byte(b[2:10]),
+		AS:            binary.BigEndian.Uint32(b[26:]),
+		BGPID:         netip.AddrFrom4([4]byte(b[30:34])),
+		Timestamp:     time.Unix(int64(binary.BigEndian.Uint32(b[34:])), int64(binary.BigEndian.Uint32(b[38:]))*1000),
+	}
+	if h.Flags&FlagIPv6 != 0 {
+		h.Address = netip.AddrFrom16([16]byte(b[10:26]))
+	} else {
+		h.Address = netip.AddrFrom4([4]byte(b[22:26]))
+	}
+	return h
+}
+
+// Result is one FlowSpec route seen in a route monitoring message.
+type Result struct {
+	Peer     PeerHeader
+	Route    *fs.FlowSpecRoute
+	Withdraw bool
+	// Err is the fs.ValidateFeasibility result against the peer's unicast
+	// routes, nil if the route is accepted. It is always nil for withdrawals.
+	Err error
+}
+
+// Options configures a Receiver.
+type Options struct {
+	Validation *fs.Config
+	// NewIndex returns the per-peer unicast index, defaults to rib.NewTrie.
+	NewIndex func() rib.Index
+	// OnResult is called for every FlowSpec route received.
+	OnResult func(Result)
+}
+
+type peerKey struct {
+	distinguisher [8]byte
+	address       netip.Addr
+}
+
+type peerState struct {
+	unicast rib.Index
+	localAS uint32
+}
+
+// Receiver ingests BMP feeds from any number of routers.
+type Receiver struct {
+	opts Options
+
+	mu    sync.Mutex
+	peers map[peerKey]*peerState
+}
+
+// NewReceiver returns a Receiver with opts, which may be nil.
+func NewReceiver(opts *Options) *Receiver {
+	var o Options
+	if opts != nil {
+		o = *opts
+	}
+	if o.NewIndex == nil {
+		o.NewIndex = func() rib.Index { return rib.NewTrie() }
+	}
+	return &Receiver{opts: o, peers: make(map[peerKey]*peerState)}
+}
+
+// Serve accepts BMP connections on ln until ctx is done.
+func (r *Receiver) Serve(ctx context.Context, ln net.Listener) error {
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		go func() {
+			defer conn.Close()
+			r.ServeConn(conn)
+		}()
+	}
+}
+
+// ServeConn processes the messages of one router until EOF or a Termination message.
+func (r *Receiver) ServeConn(rd io.Reader) error {
+	for {
+		m, err := ReadMessage(rd)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if m.Type == MsgTermination {
+			return nil
+		}
+		if err := r.Handle(m); err != nil {
+			return err
+		}
+	}
+}
+
+// Handle processes one message.
+func (r *Receiver) Handle(m *Message) error {
+	switch m.Type {
+	case MsgPeerUp:
+		return r.peerUp(m)
+	case MsgPeerDown:
+		r.mu.Lock()
+		delete(r.peers, keyOf(m.Peer))
+		r.mu.Unlock()
+	case MsgRouteMonitoring:
+		return r.routeMonitoring(m)
+	}
+	return nil
+}
+
+func keyOf(h *PeerHeader) peerKey {
+	return peerKey{distinguisher: h.Distinguisher, address: h.Address}
+}
+
+// peer returns the state of h, creating it for routers that skipped Peer Up.
+func (r *Receiver) peer(h *PeerHeader) *peerState {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p, ok := r.peers[keyOf(h)]
+	if !ok {
+		p = &peerState{unicast: r.opts.NewIndex()}
+		r.peers[keyOf(h)] = p
+	}
+	return p
+}
+
+// peerUp records the monitored router's own AS from the OPEN it sent (RFC7854 4.10).
+func (r *Receiver) peerUp(m *Message) error {
+	if len(m.Body) < peerUpFixedLen+bgp.HeaderLen {
+		return ErrShortMessage
+	}
+	sent := m.Body[peerUpFixedLen:]
+	n := int(binary.BigEndian.Uint16(sent[bgpLengthOffset:]))
+	if n > len(sent) {
+		return ErrShortMessage
+	}
+	typ, body, err := bgp.SplitHeader(sent[:n])
+	if err != nil {
+		return err
+	}
+	if typ != bgp.MsgOpen {
+		return bgp.ErrMalformedOpen
+	}
+	open, err := bgp.ParseOpen(body)
+	if err != nil {
+		return err
+	}
+	p := r.peer(m.Peer)
+	r.mu.Lock()
+	p.unicast, p.localAS = r.opts.NewIndex(), open.AS
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *Receiver) routeMonitoring(m *Message) error {
+	p := r.peer(m.Peer)
+	r.mu.Lock()
+	localAS, unicast := p.localAS, p.unicast
+	r.mu.Unlock()
+
+	u, err := bgp.ParseUpdate(m.Body, &bgp.ParseOptions{
+		PeerAS:     m.Peer.AS,
+		LocalAS:    localAS,
+		TwoByteAS:  m.Peer.Flags&FlagTwoByteAS != 0,
+		Validation: r.opts.Validation,
+	})
+	if err != nil {
+		return err
+	}
+	for _, pfx := range u.Unreachable {
+		unicast.Delete(pfx)
+	}
+	for _, route := range u.Reachable {
+		unicast.Insert(route)
+	}
+	if r.opts.OnResult == nil {
+		return nil
+	}
+	for _, route := range u.Withdrawn {
+		r.opts.OnResult(Result{Peer: *m.Peer, Route: route, Withdraw: true})
+	}
+	for _, route := range u.Announced {
+		r.opts.OnResult(Result{Peer: *m.Peer, Route: route, Err: fs.ValidateFeasibility(route, unicast, r.opts.Validation)})
+	}
+	return nil
+}
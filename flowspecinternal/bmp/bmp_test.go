@@ -0,0 +1,112 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package bmp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net/netip"
+	"slices"
+	"testing"
+	"time"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/announce"
+	"floofspectools/flowspecinternal/bgp"
+)
+
+func message(typ uint8, peer []byte, body ...[]byte) []byte {
+	b := slices.Concat(append([][]byte{peer}, body...)...)
+	hdr := binary.BigEndian.AppendUint32([]byte{Version}, uint32(commonHeaderLen+len(b)))
+	return append(append(hdr, typ), b...)
+}
+
+// peerHeader for 203.0.113.1, AS64500, post-policy.
+func peerHeader() []byte {
+	b := make([]byte, peerHeaderLen)
+	b[1] = FlagPostPolicy
+	copy(b[22:], []byte{203, 0, 113, 1})
+	binary.BigEndian.PutUint32(b[26:], 64500)
+	copy(b[30:], []byte{203, 0, 113, 1})
+	binary.BigEndian.PutUint32(b[34:], 1700000000)
+	return b
+}
+
+// unicastUpdate announces 192.0.2.0/24 with AS_PATH 64500.
+func unicastUpdate() []byte {
+	attrs := []byte{bgp.FlagTransitive, bgp.AttrASPath, 6, 2, 1, 0, 0, 0xfb, 0xf4}
+	body := binary.BigEndian.AppendUint16([]byte{0, 0}, uint16(len(attrs)))
+	body = slices.Concat(body, attrs, []byte{24, 192, 0, 2})
+	msg := bytes.Repeat([]byte{0xff}, 16)
+	msg = binary.BigEndian.AppendUint16(msg, uint16(bgp.HeaderLen+len(body)))
+	return append(append(msg, bgp.MsgUpdate), body...)
+}
+
+func flowSpecUpdate(t *testing.T, dst string) []byte {
+	p := netip.MustParsePrefix(dst)
+	msg, err := bgp.EncodeUpdate(announce.Update{
+		Components: fs.FSComponentList{Components: []fs.FSComponent{{Type: fs.ComponentTypeDestinationPrefix, Prefix: &p}}},
+	}, bgp.EncodeOptions{LocalAS: 64500, EBGP: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func TestReceiver(t *testing.T) {
+	sentOpen := bgp.EncodeOpen(&bgp.Open{AS: 65000, HoldTime: 90 * time.Second, RouterID: netip.MustParseAddr("192.0.2.254")})
+	recvOpen := bgp.EncodeOpen(&bgp.Open{AS: 64500, HoldTime: 90 * time.Second, RouterID: netip.MustParseAddr("203.0.113.1")})
+	stream := slices.Concat(
+		message(MsgInitiation, nil, []byte{0, 2, 0, 2, 'r', '1'}),
+		message(MsgPeerUp, peerHeader(), make([]byte, peerUpFixedLen), sentOpen, recvOpen),
+		message(MsgRouteMonitoring, peerHeader(), unicastUpdate()),
+		message(MsgRouteMonitoring, peerHeader(), flowSpecUpdate(t, "192.0.2.0/24")),
+		message(MsgRouteMonitoring, peerHeader(), flowSpecUpdate(t, "198.51.100.0/24")),
+		message(MsgTermination, nil),
+	)
+
+	var results []Result
+	r := NewReceiver(&Options{OnResult: func(res Result) { results = append(results, res) }})
+	if err := r.ServeConn(bytes.NewReader(stream)); err != nil {
+		t.Fatalf("ServeConn() error = %v, want <nil>", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("got %d results, want 2", len(results))
+	}
+	if res := results[0]; res.Err != nil || res.Route.DestPrefix.String() != "192.0.2.0/24" {
+		t.Errorf("results[0] = %v %v, want 192.0.2.0/24 accepted", res.Route.DestPrefix, res.Err)
+	}
+	if res := results[1]; !errors.Is(res.Err, fs.ErrNoBestUnicast) {
+		t.Errorf("results[1].Err = %v, want %v", res.Err, fs.ErrNoBestUnicast)
+	}
+	h := results[0].Peer
+	if h.Address != netip.MustParseAddr("203.0.113.1") || h.AS != 64500 || h.Flags&FlagPostPolicy == 0 || h.Timestamp.Unix() != 1700000000 {
+		t.Errorf("Peer = %+v, want 203.0.113.1 AS64500 post-policy", h)
+	}
+	if !results[0].Route.FromEBGP {
+		t.Error("route from AS64500 to AS65000 not marked eBGP")
+	}
+}
+
+func TestReadMessageErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     []byte
+		wantErr error
+	}{
+		{name: "BadVersion", raw: []byte{1, 0, 0, 0, 6, MsgInitiation}, wantErr: ErrBadVersion},
+		{name: "ShortLength", raw: []byte{Version, 0, 0, 0, 5, MsgInitiation}, wantErr: ErrShortMessage},
+		{name: "TooBig", raw: []byte{Version, 0xff, 0, 0, 0, MsgInitiation}, wantErr: ErrMessageTooBig},
+		{name: "NoPeerHeader", raw: message(MsgRouteMonitoring, nil, []byte{1, 2, 3}), wantErr: ErrShortMessage},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ReadMessage(bytes.NewReader(tt.raw)); !errors.Is(err, tt.wantErr) {
+				t.Errorf("ReadMessage(%x) error = %v, want %v", tt.raw, err, tt.wantErr)
+			}
+		})
+	}
+}
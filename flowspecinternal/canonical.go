@@ -0,0 +1,197 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package flowspecinternal
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// CanonicalOptions configures Canonical. The zero value renders every value numerically.
+type CanonicalOptions struct {
+	// Symbolic renders protocols, ports, DSCP code points, TCP flags and
+	// fragment bits by name.
+	Symbolic bool
+}
+
+// componentKeys are the keywords of the canonical form, indexed by ComponentType.
+var componentKeys = [...]string{
+	ComponentTypeDestinationPrefix: "dst",
+	ComponentTypeSourcePrefix:      "src",
+	ComponentTypeIpProtocol:        "proto",
+	ComponentTypePort:              "port",
+	ComponentTypeDestinationPort:   "dport",
+	ComponentTypeSourcePort:        "sport",
+	ComponentTypeICMPType:          "icmp-type",
+	ComponentTypeICMPCode:          "icmp-code",
+	ComponentTypeTCPFlags:          "tcp-flags",
+	ComponentTypePacketLength:      "len",
+	ComponentTypeDSCP:              "dscp",
+	ComponentTypeFragment:          "frag",
+	ComponentTypeEthernetType:      "ether-type",
+	ComponentTypeSourceMAC:         "src-mac",
+	ComponentTypeDestinationMAC:    "dst-mac",
+	ComponentTypeVLANID:            "vlan",
+	ComponentTypeInnerVLANID:       "inner-vlan",
+}
+
+// String returns the keyword of t in the canonical form, or "type-N" for unknown types.
+func (t ComponentType) String() string {
+	if int(t) < len(componentKeys) && componentKeys[t] != "" {
+		return componentKeys[t]
+	}
+	return "type-" + strconv.Itoa(int(t))
+}
+
+// maxValue returns the largest value a numeric component of type t can match.
+func (t ComponentType) maxValue() uint64 {
+	switch t {
+	case ComponentTypeIpProtocol, ComponentTypeICMPType, ComponentTypeICMPCode:
+		return 0xff
+	case ComponentTypeDSCP:
+		return maxDSCP
+	case ComponentTypeVLANID, ComponentTypeInnerVLANID:
+		return 0xfff
+	}
+	return 0xffff
+}
+
+var (
+	tcpFlagNames  = []string{"fin", "syn", "rst", "psh", "ack", "urg", "ece", "cwr"}
+	fragmentNames = []string{"df", "isf", "ff", "lf"}
+)
+
+// Canonical returns the canonical text of l: one "key=value" token per component
+// ordered by type, independent of how the operators were encoded. Two lists
+// matching the same values for every component render identically, so the text
+// is suitable for diffs, logs and golden files.
+//
+// Numeric components render as sorted, merged ranges ("53,123", "1024-2048"),
+// "any" or "none". Bitmask components render as OR-ed groups of AND-ed terms
+// joined by "+", where "=v" means all bits set, "!=v" not all bits set, "&v"
+// any bit set and "!&v" no bit set. Malformed operator bytes render as "raw:<hex>".
+func (l FSComponentList) Canonical(opts *CanonicalOptions) string {
+	var o CanonicalOptions
+	if opts != nil {
+		o = *opts
+	}
+	comps := slices.Clone(l.Components)
+	slices.SortStableFunc(comps, func(a, b FSComponent) int { return int(a.Type) - int(b.Type) })
+
+	tokens := make([]string, 0, len(comps))
+	for _, c := range comps {
+		tokens = append(tokens, c.Type.String()+"="+canonicalValue(c, o))
+	}
+	return strings.Join(tokens, " ")
+}
+
+func canonicalValue(c FSComponent, o CanonicalOptions) string {
+	switch {
+	case c.Type == ComponentTypeDestinationPrefix || c.Type == ComponentTypeSourcePrefix:
+		if c.Prefix == nil {
+			return "none"
+		}
+		return c.Prefix.Masked().String()
+	case c.Type.IsMAC():
+		if mac, ok := c.MAC(); ok {
+			return mac.String()
+		}
+		return fmt.Sprintf("raw:%x", c.Raw)
+	case c.Type.IsBitmask():
+		ops, err := ParseBitmaskOps(c.Raw)
+		if err != nil {
+			return fmt.Sprintf("raw:%x", c.Raw)
+		}
+		return canonicalBitmask(c.Type, ops, o)
+	}
+	ops, err := ParseNumericOps(c.Raw)
+	if err != nil {
+		return fmt.Sprintf("raw:%x", c.Raw)
+	}
+	ranges := NumericRanges(ops, c.Type.maxValue())
+	switch {
+	case len(ranges) == 0:
+		return "none"
+	case len(ranges) == 1 && ranges[0].From == 0 && ranges[0].To == c.Type.maxValue():
+		return "any"
+	}
+	parts := make([]string, 0, len(ranges))
+	for _, r := range ranges {
+		if r.From != r.To {
+			parts = append(parts, fmt.Sprintf("%d-%d", r.From, r.To))
+			continue
+		}
+		parts = append(parts, canonicalNumber(c.Type, r.From, o))
+	}
+	return strings.Join(parts, ",")
+}
+
+func canonicalNumber(t ComponentType, v uint64, o CanonicalOptions) string {
+	if o.Symbolic {
+		switch t {
+		case ComponentTypeIpProtocol:
+			return FormatProtocol(uint8(v))
+		case ComponentTypePort, ComponentTypeDestinationPort, ComponentTypeSourcePort:
+			return FormatPort(uint16(v))
+		case ComponentTypeDSCP:
+			return FormatDSCP(uint8(v))
+		}
+	}
+	return strconv.FormatUint(v, 10)
+}
+
+func canonicalBitmask(t ComponentType, ops []BitmaskOp, o CanonicalOptions) string {
+	var groups []string
+	for _, g := range SplitBitmaskOps(ops) {
+		slices.SortFunc(g, func(a, b BitmaskOp) int {
+			if a.Value != b.Value {
+				return int(a.Value) - int(b.Value)
+			}
+			return bitmaskKind(a) - bitmaskKind(b)
+		})
+		g = slices.CompactFunc(g, func(a, b BitmaskOp) bool {
+			return a.Value == b.Value && a.Not == b.Not && a.Match == b.Match
+		})
+		terms := make([]string, 0, len(g))
+		for _, op := range g {
+			terms = append(terms, bitmaskPrefix[bitmaskKind(op)]+canonicalBits(t, op.Value, o))
+		}
+		groups = append(groups, strings.Join(terms, "+"))
+	}
+	slices.Sort(groups)
+	return strings.Join(slices.Compact(groups), ",")
+}
+
+var bitmaskPrefix = [...]string{"&", "!&", "=", "!="}
+
+func bitmaskKind(op BitmaskOp) int {
+	k := 0
+	if op.Not {
+		k |= 1
+	}
+	if op.Match {
+		k |= 2
+	}
+	return k
+}
+
+func canonicalBits(t ComponentType, v uint64, o CanonicalOptions) string {
+	names := tcpFlagNames
+	if t == ComponentTypeFragment {
+		names = fragmentNames
+	}
+	if !o.Symbolic || v == 0 || v>>len(names) != 0 {
+		return fmt.Sprintf("0x%02x", v)
+	}
+	var set []string
+	for i, n := range names {
+		if v&(1<<i) != 0 {
+			set = append(set, n)
+		}
+	}
+	return strings.Join(set, "|")
+}
@@ -0,0 +1,93 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package flowspecinternal
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestCanonical(t *testing.T) {
+	dst := netip.MustParsePrefix("192.0.2.77/24")
+	v6 := netip.MustParsePrefix("2001:0db8:0000::/32")
+
+	tests := []struct {
+		name string
+		list FSComponentList
+		opts *CanonicalOptions
+		want string
+	}{
+		{
+			name: "SortedByType_PrefixMasked",
+			list: FSComponentList{Components: []FSComponent{
+				{Type: ComponentTypeDestinationPort, Raw: []byte{0x81, 0x35}},
+				{Type: ComponentTypeIpProtocol, Raw: []byte{0x81, 0x11}},
+				{Type: ComponentTypeDestinationPrefix, Prefix: &dst},
+			}},
+			want: "dst=192.0.2.0/24 proto=17 dport=53",
+		},
+		{
+			name: "Symbolic",
+			list: FSComponentList{Components: []FSComponent{
+				{Type: ComponentTypeIpProtocol, Raw: []byte{0x81, 0x11}},
+				{Type: ComponentTypeDestinationPort, Raw: []byte{0x01, 0x7b, 0x13, 0x04, 0x00, 0xd5, 0x08, 0x00}},
+				{Type: ComponentTypeTCPFlags, Raw: []byte{0x81, 0x12}},
+			}},
+			opts: &CanonicalOptions{Symbolic: true},
+			want: "proto=udp dport=ntp,1024-2048 tcp-flags==syn|ack",
+		},
+		{
+			// ==53 or ==54 or ==55 and >=52 and <=55 encode the same set
+			name: "EquivalentEncodingsNormalized_Or",
+			list: FSComponentList{Components: []FSComponent{
+				{Type: ComponentTypePacketLength, Raw: []byte{0x01, 0x35, 0x01, 0x36, 0x81, 0x37}},
+			}},
+			want: "len=53-55",
+		},
+		{
+			name: "EquivalentEncodingsNormalized_And",
+			list: FSComponentList{Components: []FSComponent{
+				{Type: ComponentTypePacketLength, Raw: []byte{0x03, 0x35, 0xc5, 0x37}},
+			}},
+			want: "len=53-55",
+		},
+		{
+			name: "AnyAndNone",
+			list: FSComponentList{Components: []FSComponent{
+				{Type: ComponentTypeDSCP, Raw: []byte{0x83, 0x00}},
+				{Type: ComponentTypeICMPType, Raw: []byte{0x04, 0x05, 0xc2, 0x07}},
+			}},
+			want: "icmp-type=none dscp=any",
+		},
+		{
+			name: "BitmaskTermsSortedAndDeduplicated",
+			list: FSComponentList{Components: []FSComponent{
+				{Type: ComponentTypeFragment, Raw: []byte{0x00, 0x04, 0x00, 0x01, 0x42, 0x08, 0xc0, 0x01}},
+			}},
+			want: "frag=&0x01+!&0x08,&0x04",
+		},
+		{
+			name: "IPv6PrefixCompressed",
+			list: FSComponentList{Components: []FSComponent{
+				{Type: ComponentTypeSourcePrefix, Prefix: &v6},
+			}},
+			want: "src=2001:db8::/32",
+		},
+		{
+			name: "Malformed",
+			list: FSComponentList{Components: []FSComponent{
+				{Type: ComponentTypeIpProtocol, Raw: []byte{0x01, 0x11}},
+			}},
+			want: "proto=raw:0111",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.list.Canonical(tt.opts); got != tt.want {
+				t.Errorf("Canonical(%v) = %q, want %q", tt.list, got, tt.want)
+			}
+		})
+	}
+}
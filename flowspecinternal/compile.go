@@ -0,0 +1,55 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package flowspecinternal
+
+import "errors"
+
+// Errors shared by the compilers translating rules into dataplane and
+// router configuration.
+var (
+	ErrEmptyMatch    = errors.New("flowspec: component operators match no value; rule can never match")
+	ErrMixedFamilies = errors.New("flowspec: destination and source prefix address families differ")
+)
+
+// AddressFamily reports whether the prefix components of list are IPv6. It
+// returns fallback if list has no prefix component and ErrMixedFamilies if
+// the destination and source prefix families differ.
+func AddressFamily(list FSComponentList, fallback bool) (bool, error) {
+	var seen []bool
+	for _, c := range list.Components {
+		if (c.Type == ComponentTypeDestinationPrefix || c.Type == ComponentTypeSourcePrefix) && c.Prefix != nil {
+			seen = append(seen, c.Prefix.Addr().Is6())
+		}
+	}
+	if len(seen) == 0 {
+		return fallback, nil
+	}
+	for _, v := range seen[1:] {
+		if v != seen[0] {
+			return false, ErrMixedFamilies
+		}
+	}
+	return seen[0], nil
+}
+
+// ComponentRanges evaluates the numeric operators of c over [0, max], see
+// NumericRanges. It returns ErrEmptyMatch if c matches no value.
+func ComponentRanges(c FSComponent, max uint64) ([]ValueRange, error) {
+	ops, err := ParseNumericOps(c.Raw)
+	if err != nil {
+		return nil, err
+	}
+	ranges := NumericRanges(ops, max)
+	if len(ranges) == 0 {
+		return nil, ErrEmptyMatch
+	}
+	return ranges, nil
+}
+
+// MatchesAll reports whether ranges cover every value of [0, max], so the
+// component does not constrain the packet.
+func MatchesAll(ranges []ValueRange, max uint64) bool {
+	return len(ranges) == 1 && ranges[0].From == 0 && ranges[0].To == max
+}
@@ -0,0 +1,67 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package flowspecinternal
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestAddressFamily(t *testing.T) {
+	tests := []struct {
+		rule     string
+		fallback bool
+		want     bool
+		wantErr  error
+	}{
+		{rule: "dst 192.0.2.0/24 src 198.51.100.0/24"},
+		{rule: "dst 2001:db8::/32 proto tcp", want: true},
+		{rule: "src 2001:db8::/32", want: true},
+		{rule: "proto tcp", fallback: true, want: true},
+		{rule: "dport 80"},
+		{rule: "dst 192.0.2.0/24 src 2001:db8::/32", wantErr: ErrMixedFamilies},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rule, func(t *testing.T) {
+			got, err := AddressFamily(mustParse(t, tt.rule), tt.fallback)
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil) != (err == nil) {
+				t.Fatalf("AddressFamily() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("AddressFamily() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestComponentRanges(t *testing.T) {
+	tests := []struct {
+		rule    string
+		max     uint64
+		want    []ValueRange
+		all     bool
+		wantErr error
+	}{
+		{rule: "dport 80,1024-2048", max: 0xffff, want: []ValueRange{{80, 80}, {1024, 2048}}},
+		{rule: "dscp >=0", max: 0x3f, want: []ValueRange{{0, 0x3f}}, all: true},
+		{rule: "proto >=0", max: 0xff, want: []ValueRange{{0, 0xff}}, all: true},
+		{rule: "dport >100&<50", max: 0xffff, wantErr: ErrEmptyMatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rule, func(t *testing.T) {
+			got, err := ComponentRanges(mustParse(t, tt.rule).Components[0], tt.max)
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil) != (err == nil) {
+				t.Fatalf("ComponentRanges() error = %v, want %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("ComponentRanges() = %v, want %v", got, tt.want)
+			}
+			if all := MatchesAll(got, tt.max); all != tt.all {
+				t.Errorf("MatchesAll() = %v, want %v", all, tt.all)
+			}
+		})
+	}
+}
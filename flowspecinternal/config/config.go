@@ -0,0 +1,341 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+// Package config loads the configuration of a FlowSpec controller: its
+// peers with their validation policy, limits and allowed actions, and its
+// dataplane backends.
+//
+// A file is YAML, TOML or JSON, chosen by its extension, with the keys of
+// the JSON of fs.PeerPolicy:
+//
+//	default_policy:
+//	  limits: {max_components: 8, max_rules: 1000, overflow: reject}
+//	peers:
+//	  - address: 192.0.2.1
+//	    as: 64500
+//	    prefixes: [198.51.100.0/24, "ip prefix-list X seq 5 permit 203.0.113.0/24 le 32"]
+//	    policy:
+//	      strict: true
+//	      allowed_actions: [{action: discard}, {action: rate-limit}]
+//	dataplanes:
+//	  - type: nftables
+//	    options: {table: flowspec, chain: filter}
+//
+// Parsing is strict: unknown keys are errors. After parsing, defaults are
+// filled in and the configuration is cross-checked; Load returns every
+// problem found, each wrapping ErrInvalid. Reloader re-reads the file on
+// SIGHUP and applies the Diff to the running controller.
+package config
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"go.yaml.in/yaml/v3"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/actions"
+	"floofspectools/flowspecinternal/dataplane"
+	"floofspectools/flowspecinternal/dataplane/iptables"
+	"floofspectools/flowspecinternal/dataplane/nftables"
+	"floofspectools/flowspecinternal/dataplane/tcflower"
+	"floofspectools/flowspecinternal/prefixlist"
+)
+
+var (
+	ErrFormat  = errors.New("config: unknown file format")
+	ErrInvalid = errors.New("config: invalid configuration")
+)
+
+// Format is the syntax of a configuration file.
+type Format string
+
+const (
+	YAML Format = "yaml"
+	TOML Format = "toml"
+	JSON Format = "json"
+)
+
+// FormatOf returns the format of path by its extension.
+func FormatOf(path string) (Format, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return YAML, nil
+	case ".toml":
+		return TOML, nil
+	case ".json":
+		return JSON, nil
+	}
+	return "", fmt.Errorf("%w: %q", ErrFormat, path)
+}
+
+// Config is a controller configuration.
+type Config struct {
+	// DefaultPolicy applies to peers without a policy and to unconfigured
+	// neighbors; nil rejects the rules of unconfigured neighbors.
+	DefaultPolicy *fs.PeerPolicy `json:"default_policy,omitempty"`
+	Peers         []Peer         `json:"peers,omitempty"`
+	Dataplanes    []Dataplane    `json:"dataplanes,omitempty"`
+}
+
+// Peer is a configured neighbor.
+type Peer struct {
+	Address netip.Addr `json:"address"`
+	AS      uint32     `json:"as"`
+	// Name defaults to "AS<as>".
+	Name string `json:"name,omitempty"`
+	// Prefixes, if set, is the address space of the peer as prefix list
+	// lines, see prefixlist.Read.
+	Prefixes []string `json:"prefixes,omitempty"`
+	// Policy defaults to Config.DefaultPolicy.
+	Policy *fs.PeerPolicy `json:"policy,omitempty"`
+}
+
+// PeerPolicy returns the policy of p with its Prefixes, nil if it has
+// none.
+func (p *Peer) PeerPolicy() (*fs.PeerPolicy, error) {
+	if p.Policy == nil {
+		return nil, nil
+	}
+	pol := *p.Policy
+	if len(p.Prefixes) > 0 {
+		entries, err := prefixlist.Read(strings.NewReader(strings.Join(p.Prefixes, "\n")))
+		if err != nil {
+			return nil, err
+		}
+		pol.Prefixes = prefixlist.New(entries)
+	}
+	return &pol, nil
+}
+
+// Dataplane types.
+const (
+	IPTables = "iptables"
+	NFTables = "nftables"
+	TCFlower = "tcflower"
+)
+
+// Dataplane is a dataplane backend.
+type Dataplane struct {
+	// Name defaults to Type.
+	Name string `json:"name,omitempty"`
+	Type string `json:"type"`
+	// Options are the Options of the type's compiler, e.g. nftables.Options,
+	// keyed by field name.
+	Options json.RawMessage `json:"options,omitempty"`
+}
+
+// Compiler returns the Backend.Compile of d.
+func (d *Dataplane) Compiler() (func([]actions.Rule) ([]string, error), error) {
+	switch d.Type {
+	case IPTables:
+		var o iptables.Options
+		if err := d.options(&o); err != nil {
+			return nil, err
+		}
+		return dataplane.PerRule(func(l fs.FSComponentList, acts []actions.Action) ([]iptables.Rule, error) {
+			return iptables.Compile(l, acts, &o)
+		}), nil
+	case NFTables:
+		var o nftables.Options
+		if err := d.options(&o); err != nil {
+			return nil, err
+		}
+		return dataplane.PerRule(func(l fs.FSComponentList, acts []actions.Action) ([]string, error) {
+			return nftables.Compile(l, acts, &o)
+		}), nil
+	case TCFlower:
+		var o tcflower.Options
+		if err := d.options(&o); err != nil {
+			return nil, err
+		}
+		return dataplane.PerRule(func(l fs.FSComponentList, acts []actions.Action) ([]tcflower.Filter, error) {
+			return tcflower.Compile(l, acts, &o)
+		}), nil
+	}
+	return nil, fmt.Errorf("unknown dataplane type %q", d.Type)
+}
+
+func (d *Dataplane) options(v any) error {
+	if len(d.Options) == 0 {
+		return nil
+	}
+	return decodeStrict(d.Options, v)
+}
+
+// Backends returns the dataplane backends of c, installing with the Apply
+// returned by apply for each, e.g. running the compiled commands.
+func (c *Config) Backends(apply func(*Dataplane) func(ctx context.Context, out []string) error) ([]dataplane.Backend, error) {
+	var out []dataplane.Backend
+	for i := range c.Dataplanes {
+		d := &c.Dataplanes[i]
+		compile, err := d.Compiler()
+		if err != nil {
+			return nil, fmt.Errorf("dataplane %q: %w", d.Name, err)
+		}
+		out = append(out, dataplane.Backend{Name: d.Name, Compile: compile, Apply: apply(d)})
+	}
+	return out, nil
+}
+
+// Load reads, defaults and checks the configuration file at path.
+func Load(path string) (*Config, error) {
+	format, err := FormatOf(path)
+	if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c, err := Parse(b, format)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return c, nil
+}
+
+// Parse decodes, defaults and checks a configuration.
+func Parse(b []byte, format Format) (*Config, error) {
+	var tree any
+	switch format {
+	case YAML:
+		if err := yaml.Unmarshal(b, &tree); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+		}
+	case TOML:
+		var m map[string]any
+		if _, err := toml.Decode(string(b), &m); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+		}
+		tree = m
+	case JSON:
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrFormat, format)
+	}
+	if format != JSON {
+		// Go through JSON to share the keys and text forms of the
+		// fs types.
+		var err error
+		if b, err = json.Marshal(tree); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+		}
+	}
+	var c Config
+	if t := bytes.TrimSpace(b); len(t) > 0 && string(t) != "null" {
+		if err := decodeStrict(b, &c); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+		}
+	}
+	c.setDefaults()
+	if err := c.Check(); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// decodeStrict decodes the JSON b into v, refusing unknown keys and
+// trailing data.
+func decodeStrict(b []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if dec.More() {
+		return errors.New("trailing data")
+	}
+	return nil
+}
+
+func (c *Config) setDefaults() {
+	for i := range c.Peers {
+		p := &c.Peers[i]
+		if p.Name == "" {
+			p.Name = fmt.Sprintf("AS%d", p.AS)
+		}
+		if p.Policy == nil {
+			p.Policy = c.DefaultPolicy
+		}
+		p.Address = p.Address.Unmap()
+	}
+	for i := range c.Dataplanes {
+		if d := &c.Dataplanes[i]; d.Name == "" {
+			d.Name = d.Type
+		}
+	}
+}
+
+// Check cross-checks c, returning every problem found joined, each wrapping
+// ErrInvalid.
+func (c *Config) Check() error {
+	var errs []error
+	fail := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%w: "+format, append([]any{ErrInvalid}, args...)...))
+	}
+	checkPolicy := func(where string, p *fs.PeerPolicy) {
+		l := p.Limits
+		if l.MaxNLRILength < 0 || l.MaxComponents < 0 || l.MaxOperators < 0 || l.MaxRules < 0 {
+			fail("%s: negative limit", where)
+		}
+		if l.MaxNLRILength > 4095 {
+			fail("%s: max_nlri_length %d above the RFC8955 4.1 maximum of 4095", where, l.MaxNLRILength)
+		}
+		for i, a := range p.AllowedActions {
+			switch a.Action {
+			case fs.ActionDiscard, fs.ActionRateLimit, fs.ActionTrafficAction, fs.ActionRedirect, fs.ActionMarking:
+			default:
+				fail("%s: allowed_actions[%d]: unknown action class %q", where, i, a.Action)
+			}
+		}
+	}
+	if c.DefaultPolicy != nil {
+		checkPolicy("default_policy", c.DefaultPolicy)
+	}
+	peers := map[netip.Addr]int{}
+	for i := range c.Peers {
+		p := &c.Peers[i]
+		where := fmt.Sprintf("peers[%d]", i)
+		switch j, dup := peers[p.Address]; {
+		case !p.Address.IsValid():
+			fail("%s: missing address", where)
+		case dup:
+			fail("%s: address %s already used by peers[%d]", where, p.Address, j)
+		default:
+			peers[p.Address] = i
+		}
+		if p.AS == 0 {
+			fail("%s: missing as", where)
+		}
+		if p.Policy == nil {
+			fail("%s: no policy and no default_policy", where)
+		} else if p.Policy != c.DefaultPolicy {
+			checkPolicy(where+".policy", p.Policy)
+		}
+		if _, err := p.PeerPolicy(); err != nil {
+			fail("%s.prefixes: %v", where, err)
+		}
+	}
+	names := map[string]int{}
+	for i := range c.Dataplanes {
+		d := &c.Dataplanes[i]
+		where := fmt.Sprintf("dataplanes[%d]", i)
+		if j, dup := names[d.Name]; dup {
+			fail("%s: name %q already used by dataplanes[%d]", where, d.Name, j)
+		}
+		names[d.Name] = i
+		if _, err := d.Compiler(); err != nil {
+			fail("%s: %v", where, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,304 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package config
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/actions"
+	"floofspectools/flowspecinternal/rib"
+)
+
+const testYAML = `
+default_policy:
+  limits: {max_components: 8, max_rules: 100, overflow: evict}
+peers:
+  - address: 192.0.2.1
+    as: 64500
+    prefixes: [198.51.100.0/24]
+    policy:
+      strict: true
+      allowed_components: [dst, proto]
+      allowed_actions: [{action: discard, prefixes: [198.51.100.0/24]}]
+  - address: 192.0.2.2
+    as: 64501
+dataplanes:
+  - type: nftables
+    options: {Table: fs, Chain: in}
+`
+
+const testTOML = `
+[default_policy.limits]
+max_components = 8
+max_rules = 100
+overflow = "evict"
+
+[[peers]]
+address = "192.0.2.1"
+as = 64500
+prefixes = ["198.51.100.0/24"]
+[peers.policy]
+strict = true
+allowed_components = ["dst", "proto"]
+allowed_actions = [{action = "discard", prefixes = ["198.51.100.0/24"]}]
+
+[[peers]]
+address = "192.0.2.2"
+as = 64501
+
+[[dataplanes]]
+type = "nftables"
+options = {Table = "fs", Chain = "in"}
+`
+
+func TestParse(t *testing.T) {
+	for format, src := range map[Format]string{YAML: testYAML, TOML: testTOML} {
+		c, err := Parse([]byte(src), format)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		if len(c.Peers) != 2 || c.Peers[1].Name != "AS64501" || c.Peers[1].Policy != c.DefaultPolicy {
+			t.Errorf("%s: peers = %+v, want the default name and policy filled in", format, c.Peers)
+		}
+		if c.DefaultPolicy.Limits.Overflow != fs.OverflowEvict {
+			t.Errorf("%s: default limits = %+v", format, c.DefaultPolicy.Limits)
+		}
+		pol, err := c.Peer(netip.MustParseAddr("192.0.2.1")).PeerPolicy()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !pol.Strict || !slices.Equal(pol.AllowedComponents, []fs.ComponentType{fs.ComponentTypeDestinationPrefix, fs.ComponentTypeIpProtocol}) ||
+			pol.Prefixes == nil || !pol.Prefixes.OwnsPrefix(netip.MustParsePrefix("198.51.100.128/25")) {
+			t.Errorf("%s: policy = %+v", format, pol)
+		}
+		if d := c.Dataplanes[0]; d.Name != NFTables {
+			t.Errorf("%s: dataplane name = %q, want the type", format, d.Name)
+		}
+		backends, err := c.Backends(func(*Dataplane) func(context.Context, []string) error { return nil })
+		if err != nil {
+			t.Fatal(err)
+		}
+		list, acts, err := actions.ParseRule("dst 198.51.100.0/24 then discard")
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := backends[0].Compile([]actions.Rule{{Components: list, Actions: acts}})
+		if err != nil || len(out) != 1 || !strings.Contains(out[0], "add rule inet fs in") {
+			t.Errorf("%s: Compile() = %q, %v", format, out, err)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name, src string
+		want      []string
+	}{
+		{"unknown key", "peers: [{address: 192.0.2.1, as: 1, polcy: {}}]", []string{`unknown field "polcy"`}},
+		{"syntax", "peers: [", []string{"yaml"}},
+		{"cross checks", `
+peers:
+  - {address: 192.0.2.1, as: 64500}
+  - {address: "::ffff:192.0.2.1", policy: {limits: {max_nlri_length: 5000}, allowed_actions: [{action: nuke}]}}
+  - {as: 64502, prefixes: [not-a-prefix], policy: {}}
+dataplanes:
+  - {type: iptables}
+  - {name: iptables, type: pf}
+  - {type: tcflower, options: {Device: eth1}}
+`, []string{
+			"peers[0]: no policy and no default_policy",
+			"peers[1]: address 192.0.2.1 already used by peers[0]",
+			"peers[1]: missing as",
+			"peers[1].policy: max_nlri_length 5000",
+			`peers[1].policy: allowed_actions[0]: unknown action class "nuke"`,
+			"peers[2]: missing address",
+			"peers[2].prefixes:",
+			`dataplanes[1]: name "iptables" already used by dataplanes[0]`,
+			`dataplanes[1]: unknown dataplane type "pf"`,
+			`dataplanes[2]: json: unknown field "Device"`,
+		}},
+	}
+	for _, tt := range tests {
+		_, err := Parse([]byte(tt.src), YAML)
+		if !errors.Is(err, ErrInvalid) {
+			t.Errorf("%s: Parse() = %v, want ErrInvalid", tt.name, err)
+			continue
+		}
+		for _, w := range tt.want {
+			if !strings.Contains(err.Error(), w) {
+				t.Errorf("%s: error lacks %q:\n%v", tt.name, w, err)
+			}
+		}
+	}
+	if _, err := Load("flowspec.ini"); !errors.Is(err, ErrFormat) {
+		t.Errorf("Load(.ini) = %v, want ErrFormat", err)
+	}
+}
+
+func TestReloader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "flowspec.yaml")
+	write := func(s string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(s), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(testYAML)
+	set := fs.NewValidatorSet(nil)
+	var diffs []Diff
+	fail := false
+	r, err := NewReloader(path, func(old, c *Config, d Diff) error {
+		if fail {
+			return errors.New("apply failed")
+		}
+		diffs = append(diffs, d)
+		return c.ApplyPolicies(set, d)
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, second := netip.MustParseAddr("192.0.2.1"), netip.MustParseAddr("192.0.2.2")
+	if len(diffs) != 1 || len(diffs[0].AddedPeers) != 2 || !diffs[0].DefaultPolicy || set.Policy(first) == nil {
+		t.Fatalf("initial diffs = %+v", diffs)
+	}
+
+	// Unchanged files are not applied again.
+	if _, err := r.Reload(); err != nil || len(diffs) != 1 {
+		t.Errorf("Reload() unchanged = %v, %d applies", err, len(diffs))
+	}
+
+	write(strings.Replace(strings.Replace(testYAML, "strict: true", "strict: false", 1), "  - address: 192.0.2.2\n    as: 64501\n", "", 1))
+	d, err := r.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(d.ChangedPeers, []netip.Addr{first}) || !slices.Equal(d.RemovedPeers, []netip.Addr{second}) || d.DefaultPolicy || d.Dataplanes() {
+		t.Errorf("Reload() diff = %+v", d)
+	}
+	if set.Policy(first).Strict || set.Policy(second).Limits.MaxRules != 100 {
+		t.Errorf("policies after reload: %+v, %+v, want the second peer on the default", set.Policy(first), set.Policy(second))
+	}
+
+	running := r.Current()
+	write("peers: [{address: 192.0.2.1}]")
+	if _, err := r.Reload(); !errors.Is(err, ErrInvalid) || r.Current() != running {
+		t.Errorf("Reload() invalid = %v, want ErrInvalid and the running configuration kept", err)
+	}
+	write(testYAML)
+	fail = true
+	if _, err := r.Reload(); err == nil || r.Current() != running {
+		t.Errorf("Reload() failing apply = %v, want the running configuration kept", err)
+	}
+}
+
+func TestPlan(t *testing.T) {
+	old, err := Parse([]byte(testYAML), YAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := Parse([]byte(strings.NewReplacer(
+		"max_rules: 100", "max_rules: 50",
+		"  - address: 192.0.2.2\n    as: 64501\n", "  - address: 192.0.2.3\n    as: 64503\n",
+		"type: nftables\n    options: {Table: fs, Chain: in}", "name: nftables\n    type: iptables",
+	).Replace(testYAML)), YAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := rib.NewFlowSpecRIB(nil)
+	for _, r := range []struct {
+		rule string
+		as   uint32
+	}{
+		{"dst 198.51.100.0/24", 64500}, // on its own policy, unchanged
+		{"dst 198.51.100.1/32", 64501}, // removed peer
+		{"dst 198.51.100.2/32", 64599}, // unconfigured, on the changed default
+	} {
+		l, err := fs.ParseComponents(r.rule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		received.Insert(&fs.FlowSpecRoute{AFI: fs.AFIIPv4, NeighborAS: r.as, Components: l}, nil)
+	}
+
+	p := c.Plan(old, received.Snapshot())
+	want := "~ default policy\n" +
+		"+ peer 192.0.2.3 AS64503 (AS64503)\n" +
+		"- peer 192.0.2.2 AS64501 (AS64501)\n" +
+		"~ revalidate 2 rules\n" +
+		"~ dataplane nftables (iptables)\n"
+	if p.String() != want {
+		t.Errorf("Plan() =\n%s\nwant\n%s", p, want)
+	}
+	if c.Plan(c, nil).String() != "no changes\n" {
+		t.Errorf("Plan(same) = %s", c.Plan(c, nil))
+	}
+
+	set := fs.NewValidatorSet(nil)
+	if err := old.ApplyPolicies(set, old.Compare(nil)); err != nil {
+		t.Fatal(err)
+	}
+	var reprogrammed []BackendChange
+	err = ApplyPlan(p, &Targets{
+		Policies: set,
+		Received: received,
+		Validate: func(*fs.FlowSpecRoute) error { return fs.ErrUnknownPeer },
+		Reprogram: func(_ *Config, changes []BackendChange) error {
+			reprogrammed = changes
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var infeasible int
+	for e := range received.Snapshot().All() {
+		if e.Err != nil {
+			infeasible++
+		}
+	}
+	if infeasible != 2 || len(reprogrammed) != 1 || set.Policy(netip.MustParseAddr("192.0.2.3")) == nil {
+		t.Errorf("after ApplyPlan: %d rules revalidated, reprogrammed %v", infeasible, reprogrammed)
+	}
+}
+
+func TestReloaderPlan(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "flowspec.yaml")
+	if err := os.WriteFile(path, []byte(testYAML), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	applied := 0
+	r, err := NewReloader(path, func(old, c *Config, d Diff) error { applied++; return nil }, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(strings.Replace(testYAML, "strict: true", "strict: false", 1)), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	p, err := r.Plan(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if applied != 1 || r.Current() == p.Config() {
+		t.Fatal("Plan() applied the configuration")
+	}
+	stale, err := r.Plan(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.ApplyPlan(p); err != nil || applied != 2 || r.Current() != p.Config() {
+		t.Errorf("ApplyPlan() = %v, %d applies", err, applied)
+	}
+	if err := r.ApplyPlan(stale); !errors.Is(err, ErrStalePlan) {
+		t.Errorf("ApplyPlan(stale) = %v, want ErrStalePlan", err)
+	}
+}
@@ -0,0 +1,211 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/rib"
+)
+
+var (
+	ErrStalePlan = errors.New("config: plan was made against another running configuration")
+)
+
+// Change is what a Plan does to a peer or dataplane.
+type Change string
+
+const (
+	Add    Change = "add"
+	Remove Change = "remove"
+	Modify Change = "change"
+)
+
+// symbol is the Terraform-style marker of c.
+func (c Change) symbol() string {
+	switch c {
+	case Add:
+		return "+"
+	case Remove:
+		return "-"
+	}
+	return "~"
+}
+
+// PeerChange is a peer whose policy a Plan installs, replaces or removes.
+type PeerChange struct {
+	Change  Change     `json:"change"`
+	Address netip.Addr `json:"address"`
+	AS      uint32     `json:"as"`
+	Name    string     `json:"name"`
+}
+
+// BackendChange is a dataplane a Plan programs, reprograms or removes.
+type BackendChange struct {
+	Change Change `json:"change"`
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+}
+
+// RuleRef is a received rule a Plan re-validates.
+type RuleRef struct {
+	// Rule is the canonical form of the rule's components.
+	Rule       string `json:"rule"`
+	NeighborAS uint32 `json:"neighbor_as"`
+}
+
+// Plan is the operational delta of moving a controller from one
+// configuration to another, computed without side effects so it can be
+// reviewed before ApplyPlan.
+type Plan struct {
+	Diff       Diff            `json:"diff"`
+	Peers      []PeerChange    `json:"peers,omitempty"`
+	Revalidate []RuleRef       `json:"revalidate,omitempty"`
+	Backends   []BackendChange `json:"backends,omitempty"`
+
+	old, new *Config
+	// ases are the neighbor ASes whose policy changes; others is set when
+	// the default policy, applying to unconfigured ASes, changes.
+	ases   map[uint32]bool
+	others bool
+}
+
+// Plan returns the plan of moving from old, nil for none, to c, listing
+// the rules of received, if not nil, whose peer's policy changes.
+func (c *Config) Plan(old *Config, received *rib.FlowSpecSnapshot) *Plan {
+	if old == nil {
+		old = &Config{}
+	}
+	p := &Plan{Diff: c.Compare(old), old: old, new: c, ases: map[uint32]bool{}}
+	peerChanges := func(change Change, cfg *Config, addrs []netip.Addr) {
+		for _, a := range addrs {
+			peer := cfg.Peer(a)
+			p.Peers = append(p.Peers, PeerChange{Change: change, Address: a, AS: peer.AS, Name: peer.Name})
+			p.ases[peer.AS] = true
+		}
+	}
+	peerChanges(Add, c, p.Diff.AddedPeers)
+	peerChanges(Modify, c, p.Diff.ChangedPeers)
+	peerChanges(Remove, old, p.Diff.RemovedPeers)
+	for _, a := range p.Diff.ChangedPeers {
+		// The peer may have changed its AS.
+		p.ases[old.Peer(a).AS] = true
+	}
+	if p.Diff.DefaultPolicy {
+		p.others = true
+	}
+
+	backendChanges := func(change Change, cfg *Config, names []string) {
+		for _, n := range names {
+			for _, d := range cfg.Dataplanes {
+				if d.Name == n {
+					p.Backends = append(p.Backends, BackendChange{Change: change, Name: n, Type: d.Type})
+				}
+			}
+		}
+	}
+	backendChanges(Add, c, p.Diff.AddedDataplanes)
+	backendChanges(Modify, c, p.Diff.ChangedDataplanes)
+	backendChanges(Remove, old, p.Diff.RemovedDataplanes)
+
+	if received != nil {
+		for e := range received.All() {
+			if p.affects(e.Route) {
+				p.Revalidate = append(p.Revalidate, RuleRef{Rule: e.Route.Components.Canonical(nil), NeighborAS: e.Route.NeighborAS})
+			}
+		}
+	}
+	return p
+}
+
+// affects reports whether the policy applying to the rules of route's
+// neighbor changes.
+func (p *Plan) affects(route *fs.FlowSpecRoute) bool {
+	if p.ases[route.NeighborAS] {
+		return true
+	}
+	if !p.others {
+		return false
+	}
+	for _, peer := range p.new.Peers {
+		if peer.AS == route.NeighborAS {
+			return false
+		}
+	}
+	return true
+}
+
+// Config returns the configuration p moves to.
+func (p *Plan) Config() *Config {
+	return p.new
+}
+
+// Empty reports whether p changes nothing.
+func (p *Plan) Empty() bool {
+	return p.Diff.Empty()
+}
+
+// String renders p for review, one change per line:
+//
+//	~ default policy
+//	+ peer 192.0.2.1 AS64500 (AS64500)
+//	~ revalidate 3 rules
+//	- dataplane iptables (iptables)
+func (p *Plan) String() string {
+	var b strings.Builder
+	if p.Diff.DefaultPolicy {
+		b.WriteString("~ default policy\n")
+	}
+	for _, c := range p.Peers {
+		fmt.Fprintf(&b, "%s peer %s AS%d (%s)\n", c.Change.symbol(), c.Address, c.AS, c.Name)
+	}
+	if n := len(p.Revalidate); n > 0 {
+		fmt.Fprintf(&b, "~ revalidate %d rules\n", n)
+	}
+	for _, c := range p.Backends {
+		fmt.Fprintf(&b, "%s dataplane %s (%s)\n", c.Change.symbol(), c.Name, c.Type)
+	}
+	if b.Len() == 0 {
+		return "no changes\n"
+	}
+	return b.String()
+}
+
+// Targets are the parts of a running controller ApplyPlan changes. Nil
+// fields are skipped.
+type Targets struct {
+	Policies *fs.ValidatorSet
+	// Received is re-validated with Validate, e.g. fs.ValidatorSet.Validate
+	// for the rule's peer against the unicast RIB, once Policies is updated.
+	Received *rib.FlowSpecRIB
+	Validate func(*fs.FlowSpecRoute) error
+	// Reprogram rebuilds the dataplane backends, e.g. from Config.Backends,
+	// when p.Backends is not empty.
+	Reprogram func(c *Config, changes []BackendChange) error
+}
+
+// ApplyPlan carries out p: it installs the peer policies, re-validates the
+// received rules of the affected peers, including those received since the
+// plan was made, and reprograms the dataplanes.
+func ApplyPlan(p *Plan, t *Targets) error {
+	if t.Policies != nil {
+		if err := p.new.ApplyPolicies(t.Policies, p.Diff); err != nil {
+			return err
+		}
+	}
+	if t.Received != nil && t.Validate != nil && (len(p.ases) > 0 || p.others) {
+		t.Received.Revalidate(t.Validate, func(e *rib.FlowSpecEntry) bool { return p.affects(e.Route) })
+	}
+	if t.Reprogram != nil && len(p.Backends) > 0 {
+		if err := t.Reprogram(p.new, p.Backends); err != nil {
+			return fmt.Errorf("reprogramming dataplanes: %w", err)
+		}
+	}
+	return nil
+}
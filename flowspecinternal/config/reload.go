@@ -0,0 +1,243 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package config
+
+import (
+	"context"
+	"log/slog"
+	"net/netip"
+	"os"
+	"os/signal"
+	"reflect"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"syscall"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/rib"
+)
+
+// Diff lists what changed between two configurations.
+type Diff struct {
+	DefaultPolicy bool `json:"default_policy,omitempty"`
+	// Peers by address and dataplanes by name.
+	AddedPeers        []netip.Addr `json:"added_peers,omitempty"`
+	RemovedPeers      []netip.Addr `json:"removed_peers,omitempty"`
+	ChangedPeers      []netip.Addr `json:"changed_peers,omitempty"`
+	AddedDataplanes   []string     `json:"added_dataplanes,omitempty"`
+	RemovedDataplanes []string     `json:"removed_dataplanes,omitempty"`
+	ChangedDataplanes []string     `json:"changed_dataplanes,omitempty"`
+}
+
+// Empty reports whether nothing changed.
+func (d *Diff) Empty() bool {
+	return reflect.ValueOf(*d).IsZero()
+}
+
+// Dataplanes reports whether a dataplane was added, removed or changed.
+func (d *Diff) Dataplanes() bool {
+	return len(d.AddedDataplanes)+len(d.RemovedDataplanes)+len(d.ChangedDataplanes) > 0
+}
+
+// Compare returns the changes from old to c, in the order of the
+// configurations. A nil old is empty.
+func (c *Config) Compare(old *Config) Diff {
+	if old == nil {
+		old = &Config{}
+	}
+	var d Diff
+	d.DefaultPolicy = !reflect.DeepEqual(old.DefaultPolicy, c.DefaultPolicy)
+
+	oldPeers := map[netip.Addr]*Peer{}
+	for i := range old.Peers {
+		oldPeers[old.Peers[i].Address] = &old.Peers[i]
+	}
+	for i := range c.Peers {
+		p := &c.Peers[i]
+		switch o, ok := oldPeers[p.Address]; {
+		case !ok:
+			d.AddedPeers = append(d.AddedPeers, p.Address)
+		case !reflect.DeepEqual(o, p):
+			d.ChangedPeers = append(d.ChangedPeers, p.Address)
+		}
+		delete(oldPeers, p.Address)
+	}
+	for i := range old.Peers {
+		if _, ok := oldPeers[old.Peers[i].Address]; ok {
+			d.RemovedPeers = append(d.RemovedPeers, old.Peers[i].Address)
+		}
+	}
+
+	oldDataplanes := map[string]*Dataplane{}
+	for i := range old.Dataplanes {
+		oldDataplanes[old.Dataplanes[i].Name] = &old.Dataplanes[i]
+	}
+	for i := range c.Dataplanes {
+		dp := &c.Dataplanes[i]
+		switch o, ok := oldDataplanes[dp.Name]; {
+		case !ok:
+			d.AddedDataplanes = append(d.AddedDataplanes, dp.Name)
+		case o.Type != dp.Type || !jsonEqual(o.Options, dp.Options):
+			d.ChangedDataplanes = append(d.ChangedDataplanes, dp.Name)
+		}
+		delete(oldDataplanes, dp.Name)
+	}
+	for i := range old.Dataplanes {
+		if _, ok := oldDataplanes[old.Dataplanes[i].Name]; ok {
+			d.RemovedDataplanes = append(d.RemovedDataplanes, old.Dataplanes[i].Name)
+		}
+	}
+	return d
+}
+
+// jsonEqual compares two JSON values ignoring formatting and key order.
+func jsonEqual(a, b []byte) bool {
+	var x, y any
+	if len(a) > 0 && decodeStrict(a, &x) != nil || len(b) > 0 && decodeStrict(b, &y) != nil {
+		return string(a) == string(b)
+	}
+	return reflect.DeepEqual(x, y)
+}
+
+// Peer returns the peer of c with address a, nil if there is none.
+func (c *Config) Peer(a netip.Addr) *Peer {
+	for i := range c.Peers {
+		if c.Peers[i].Address == a.Unmap() {
+			return &c.Peers[i]
+		}
+	}
+	return nil
+}
+
+// ApplyPolicies brings set, holding the policies of the previous
+// configuration, to those of c, changing only what d, the Compare of the
+// two, lists. Each peer switches policy atomically: a concurrent
+// validation sees either its old or its new policy.
+func (c *Config) ApplyPolicies(set *fs.ValidatorSet, d Diff) error {
+	if d.DefaultPolicy {
+		set.SetDefault(c.DefaultPolicy)
+	}
+	for _, a := range d.RemovedPeers {
+		set.Delete(a)
+	}
+	for _, a := range slices.Concat(d.AddedPeers, d.ChangedPeers) {
+		pol, err := c.Peer(a).PeerPolicy()
+		if err != nil {
+			return err
+		}
+		set.Set(a, pol)
+	}
+	return nil
+}
+
+// ApplyFunc applies the configuration c, which differs from the running old
+// one, nil on the first load, as d lists. An error keeps old running.
+type ApplyFunc func(old, c *Config, d Diff) error
+
+// ReloaderOptions configures a Reloader.
+type ReloaderOptions struct {
+	// Logger, if set, receives the reloads and their failures.
+	Logger *slog.Logger
+}
+
+// Reloader keeps a running configuration in sync with its file.
+type Reloader struct {
+	path  string
+	apply ApplyFunc
+	log   *slog.Logger
+
+	mu  sync.Mutex // serializes reloads
+	cur atomic.Pointer[Config]
+}
+
+// NewReloader loads the configuration at path and applies it.
+func NewReloader(path string, apply ApplyFunc, opts *ReloaderOptions) (*Reloader, error) {
+	var o ReloaderOptions
+	if opts != nil {
+		o = *opts
+	}
+	r := &Reloader{path: path, apply: apply, log: fs.SubsystemLogger(o.Logger, fs.SubsystemConfig)}
+	if _, err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Current returns the running configuration. It must not be modified.
+func (r *Reloader) Current() *Config {
+	return r.cur.Load()
+}
+
+// Reload reads the file again and, if it is valid and differs from the
+// running configuration, applies it. On any error the running
+// configuration is kept.
+func (r *Reloader) Reload() (Diff, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c, err := Load(r.path)
+	if err != nil {
+		return Diff{}, err
+	}
+	old := r.cur.Load()
+	d := c.Compare(old)
+	if old != nil && d.Empty() {
+		return d, nil
+	}
+	if err := r.apply(old, c, d); err != nil {
+		return d, err
+	}
+	r.cur.Store(c)
+	r.log.Info("configuration applied", "path", r.path, "diff", d)
+	return d, nil
+}
+
+// Plan reads the file again and returns the plan of moving the running
+// configuration to it, without applying it; see Config.Plan for received.
+func (r *Reloader) Plan(received *rib.FlowSpecSnapshot) (*Plan, error) {
+	c, err := Load(r.path)
+	if err != nil {
+		return nil, err
+	}
+	return c.Plan(r.cur.Load(), received), nil
+}
+
+// ApplyPlan applies a plan made by Plan, failing with ErrStalePlan if the
+// running configuration changed since.
+func (r *Reloader) ApplyPlan(p *Plan) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	old := r.cur.Load()
+	if p.old != old {
+		return ErrStalePlan
+	}
+	if p.Empty() {
+		return nil
+	}
+	if err := r.apply(old, p.new, p.Diff); err != nil {
+		return err
+	}
+	r.cur.Store(p.new)
+	r.log.Info("configuration plan applied", "path", r.path, "diff", p.Diff)
+	return nil
+}
+
+// Run reloads the configuration on every SIGHUP until ctx is done. Failed
+// reloads are logged.
+func (r *Reloader) Run(ctx context.Context) error {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-hup:
+			if _, err := r.Reload(); err != nil {
+				r.log.Error("configuration reload failed, keeping the running one", "path", r.path, "error", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,321 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+// Package coord coordinates the controllers of a high availability group so
+// that only one of them originates a rule.
+//
+// Rules are partitioned into groups, by default a single one. Each group is
+// a lease in a shared Backend; the controller holding it is the group's
+// leader and the only one whose Gate lets the group's updates through to
+// its peers. The others drop them, so the controllers neither announce a
+// rule twice nor withdraw what the leader announces.
+//
+// On takeover the new leader's Options.OnElected hook runs, e.g. to
+// re-announce its rules of the group, while the deposed leader withdraws
+// what its Gates announced for the group. A leader considers itself
+// deposed once its lease runs out without renewal, even when the backend
+// is unreachable, and Run releases the leases on shutdown for a prompt
+// handover:
+//
+//	c := coord.New(backend, hostname, &coord.Options{OnElected: resync})
+//	sched, _ := announce.New(c.Gate(peer), nil)
+//	go c.Run(ctx)
+package coord
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/announce"
+)
+
+// DefaultGroup is the group of every rule unless Options.Group says
+// otherwise.
+const DefaultGroup = "flowspec"
+
+// Options configures a Coordinator.
+type Options struct {
+	// Groups are the leases the controller campaigns for, defaults to
+	// DefaultGroup.
+	Groups []string
+	// Group returns the group of a rule, defaults to DefaultGroup. Rules of
+	// groups not in Groups are never originated.
+	Group func(fs.FSComponentList) string
+	// TTL is the lease duration, defaults to 15s. A leader unable to renew
+	// stops originating within TTL, and a standby takes over after it.
+	TTL time.Duration
+	// RenewInterval defaults to a third of TTL.
+	RenewInterval time.Duration
+	// OnElected runs when the controller becomes the leader of a group.
+	OnElected func(ctx context.Context, l Lease)
+	// OnDemoted runs when the controller lost a group, after its Gates
+	// withdrew their announcements of it.
+	OnDemoted func(ctx context.Context, l Lease)
+	// Logger, if set, receives elections and renewal failures.
+	Logger *slog.Logger
+	// Now returns the current time, defaults to time.Now.
+	Now func() time.Time
+}
+
+// group is the view of a lease by one controller.
+type group struct {
+	lease   Lease
+	leading bool
+	// until is when the lease expires as seen by this controller,
+	// measured from before the Acquire that granted it.
+	until time.Time
+}
+
+// Coordinator campaigns for the leases of one controller. Its methods are
+// safe for concurrent use.
+type Coordinator struct {
+	backend Backend
+	id      string
+	o       Options
+	log     *slog.Logger
+
+	mu     sync.Mutex
+	groups map[string]*group
+	gates  []*Gate
+}
+
+// New returns a Coordinator for the controller id, unique among the
+// controllers sharing backend.
+func New(backend Backend, id string, opts *Options) *Coordinator {
+	var o Options
+	if opts != nil {
+		o = *opts
+	}
+	if len(o.Groups) == 0 {
+		o.Groups = []string{DefaultGroup}
+	}
+	if o.Group == nil {
+		o.Group = func(fs.FSComponentList) string { return DefaultGroup }
+	}
+	if o.TTL <= 0 {
+		o.TTL = 15 * time.Second
+	}
+	if o.RenewInterval <= 0 {
+		o.RenewInterval = o.TTL / 3
+	}
+	if o.Now == nil {
+		o.Now = time.Now
+	}
+	c := &Coordinator{
+		backend: backend,
+		id:      id,
+		o:       o,
+		log:     fs.SubsystemLogger(o.Logger, fs.SubsystemCoord).With("controller", id),
+		groups:  make(map[string]*group),
+	}
+	for _, g := range o.Groups {
+		c.groups[g] = &group{lease: Lease{Name: g}}
+	}
+	return c
+}
+
+// ID returns the controller id.
+func (c *Coordinator) ID() string {
+	return c.id
+}
+
+// Renew acquires or renews each group's lease once, running the hooks of
+// the groups won or lost. Run calls it every Options.RenewInterval.
+func (c *Coordinator) Renew(ctx context.Context) error {
+	var firstErr error
+	for _, name := range c.o.Groups {
+		start := c.o.Now()
+		l, err := c.backend.Acquire(ctx, name, c.id, c.o.TTL)
+		c.mu.Lock()
+		g := c.groups[name]
+		was := g.leading
+		switch {
+		case err != nil:
+			if firstErr == nil {
+				firstErr = fmt.Errorf("group %q: %w", name, err)
+			}
+			c.log.Warn("lease renewal failed", "group", name, "error", err)
+			g.leading = g.leading && c.o.Now().Before(g.until)
+		case l.Holder == c.id:
+			g.lease, g.leading, g.until = l, true, start.Add(c.o.TTL)
+		default:
+			g.lease, g.leading = l, false
+		}
+		leading, lease := g.leading, g.lease
+		c.mu.Unlock()
+		switch {
+		case leading && !was:
+			c.log.Info("elected", "group", name, "epoch", lease.Epoch)
+			if c.o.OnElected != nil {
+				c.o.OnElected(ctx, lease)
+			}
+		case !leading && was:
+			c.demoted(ctx, lease)
+		}
+	}
+	return firstErr
+}
+
+// demoted withdraws the announcements of the group of l and runs
+// OnDemoted.
+func (c *Coordinator) demoted(ctx context.Context, l Lease) {
+	c.log.Warn("demoted", "group", l.Name, "holder", l.Holder, "epoch", l.Epoch)
+	c.mu.Lock()
+	gates := c.gates
+	c.mu.Unlock()
+	for _, g := range gates {
+		if err := g.withdraw(ctx, l.Name); err != nil {
+			c.log.Error("withdrawing the rules of a lost group failed", "group", l.Name, "error", err)
+		}
+	}
+	if c.o.OnDemoted != nil {
+		c.o.OnDemoted(ctx, l)
+	}
+}
+
+// Run renews the leases every Options.RenewInterval until ctx is done, then
+// withdraws the announcements of the groups it leads and releases them.
+// Renewal failures are logged and retried.
+func (c *Coordinator) Run(ctx context.Context) error {
+	t := time.NewTicker(c.o.RenewInterval)
+	defer t.Stop()
+	for {
+		c.Renew(ctx)
+		select {
+		case <-ctx.Done():
+			c.resign(context.WithoutCancel(ctx))
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// resign gives up the groups c leads.
+func (c *Coordinator) resign(ctx context.Context) {
+	for _, name := range c.o.Groups {
+		c.mu.Lock()
+		g := c.groups[name]
+		was := g.leading
+		g.leading = false
+		lease := g.lease
+		c.mu.Unlock()
+		if !was {
+			continue
+		}
+		c.demoted(ctx, lease)
+		if err := c.backend.Release(ctx, name, c.id); err != nil {
+			c.log.Warn("lease release failed", "group", name, "error", err)
+		}
+	}
+}
+
+// Leader reports whether c leads group, with its lease. It stops leading
+// once the lease runs out, even before Renew notices.
+func (c *Coordinator) Leader(group string) (Lease, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	g := c.groups[group]
+	if g == nil {
+		return Lease{}, false
+	}
+	return g.lease, g.leading && c.o.Now().Before(g.until)
+}
+
+// Owner returns the group of list and the last seen lease of it, whose
+// Holder is the controller originating the rule.
+func (c *Coordinator) Owner(list fs.FSComponentList) (Lease, bool) {
+	name := c.o.Group(list)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	g := c.groups[name]
+	if g == nil {
+		return Lease{Name: name}, false
+	}
+	return g.lease, true
+}
+
+// Owns reports whether c currently originates list.
+func (c *Coordinator) Owns(list fs.FSComponentList) bool {
+	_, ok := c.Leader(c.o.Group(list))
+	return ok
+}
+
+// Leases returns the last seen lease of each group, in the order of
+// Options.Groups.
+func (c *Coordinator) Leases() []Lease {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make([]Lease, 0, len(c.o.Groups))
+	for _, name := range c.o.Groups {
+		out = append(out, c.groups[name].lease)
+	}
+	return out
+}
+
+// Gate is an announce.Sender passing on the updates of the groups its
+// Coordinator leads and dropping the others. It remembers the rules it
+// announced to withdraw them on demotion.
+type Gate struct {
+	c    *Coordinator
+	next announce.Sender
+
+	mu        sync.Mutex
+	announced map[string]announce.Update
+}
+
+// Gate returns a Gate in front of next, e.g. the Sender of one peer.
+func (c *Coordinator) Gate(next announce.Sender) *Gate {
+	g := &Gate{c: c, next: next, announced: make(map[string]announce.Update)}
+	c.mu.Lock()
+	c.gates = append(c.gates, g)
+	c.mu.Unlock()
+	return g
+}
+
+func gateKey(u announce.Update) string {
+	if u.RD != nil {
+		return fmt.Sprintf("%x/%s", *u.RD, u.Components.Canonical(nil))
+	}
+	return u.Components.Canonical(nil)
+}
+
+// Send implements announce.Sender.
+func (g *Gate) Send(ctx context.Context, u announce.Update) error {
+	// Serialized with withdraw, so a demotion does not miss an
+	// announcement in flight.
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.c.Owns(u.Components) {
+		return nil
+	}
+	if err := g.next.Send(ctx, u); err != nil {
+		return err
+	}
+	if u.Withdraw {
+		delete(g.announced, gateKey(u))
+	} else {
+		g.announced[gateKey(u)] = u
+	}
+	return nil
+}
+
+// withdraw withdraws the announced rules of group.
+func (g *Gate) withdraw(ctx context.Context, group string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for k, u := range g.announced {
+		if g.c.o.Group(u.Components) != group {
+			continue
+		}
+		if err := g.next.Send(ctx, announce.Update{Withdraw: true, Components: u.Components, RD: u.RD}); err != nil {
+			return err
+		}
+		delete(g.announced, k)
+	}
+	return nil
+}
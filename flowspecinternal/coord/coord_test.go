@@ -0,0 +1,143 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package coord
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/announce"
+)
+
+// recorder is a peer remembering what it holds.
+type recorder map[string]bool
+
+func (r recorder) Send(_ context.Context, u announce.Update) error {
+	if u.Withdraw {
+		delete(r, u.Components.Canonical(nil))
+	} else {
+		r[u.Components.Canonical(nil)] = true
+	}
+	return nil
+}
+
+// failing is a Backend that is unreachable.
+type failing struct{}
+
+func (failing) Acquire(context.Context, string, string, time.Duration) (Lease, error) {
+	return Lease{}, errors.New("unreachable")
+}
+func (failing) Release(context.Context, string, string) error { return errors.New("unreachable") }
+
+func TestTakeover(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0)
+	clock := func() time.Time { return now }
+	backend := NewMemoryBackend(clock)
+	var elected, demoted []string
+	opts := func() *Options {
+		return &Options{
+			TTL:       10 * time.Second,
+			Now:       clock,
+			OnElected: func(_ context.Context, l Lease) { elected = append(elected, l.Holder) },
+			OnDemoted: func(_ context.Context, l Lease) { demoted = append(demoted, l.Holder) },
+		}
+	}
+	a, b := New(backend, "a", opts()), New(backend, "b", opts())
+	peerA, peerB := recorder{}, recorder{}
+	gateA, gateB := a.Gate(peerA), b.Gate(peerB)
+	rule, err := fs.ParseComponents("dst 192.0.2.0/24")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []*Coordinator{a, b} {
+		if err := c.Renew(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, g := range []*Gate{gateA, gateB} {
+		if err := g.Send(ctx, announce.Update{Components: rule}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(peerA) != 1 || len(peerB) != 0 || !a.Owns(rule) || b.Owns(rule) {
+		t.Fatalf("peers hold %v and %v, want the rule from a only", peerA, peerB)
+	}
+	if l, _ := b.Owner(rule); l.Holder != "a" || l.Epoch != 1 {
+		t.Errorf("b.Owner() = %+v, want a in epoch 1", l)
+	}
+	// The standby does not withdraw the leader's rule either.
+	gateB.Send(ctx, announce.Update{Withdraw: true, Components: rule})
+	if len(peerA) != 1 {
+		t.Error("standby withdrawal reached the leader's peer")
+	}
+
+	// a stops renewing; it stops originating once its lease ran out, and b
+	// takes over.
+	now = now.Add(11 * time.Second)
+	if a.Owns(rule) {
+		t.Error("a still originates after its lease expired")
+	}
+	b.Renew(ctx)
+	if l, ok := b.Leader(DefaultGroup); !ok || l.Epoch != 2 {
+		t.Errorf("b.Leader() = %+v, %v, want epoch 2", l, ok)
+	}
+	a.Renew(ctx)
+	if len(peerA) != 0 {
+		t.Errorf("deposed a still announces %v", peerA)
+	}
+	if len(elected) != 2 || elected[1] != "b" || len(demoted) != 1 || demoted[0] != "b" {
+		t.Errorf("hooks: elected %v, demoted %v", elected, demoted)
+	}
+}
+
+func TestRunReleases(t *testing.T) {
+	backend := NewMemoryBackend(nil)
+	a, b := New(backend, "a", nil), New(backend, "b", nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- a.Run(ctx) }()
+	for {
+		if _, ok := a.Leader(DefaultGroup); ok {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Run() = %v", err)
+	}
+	if err := b.Renew(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := b.Leader(DefaultGroup); !ok {
+		t.Error("b did not take over the released lease at once")
+	}
+}
+
+func TestUnreachableBackend(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0)
+	c := New(NewMemoryBackend(func() time.Time { return now }), "a", &Options{TTL: 10 * time.Second, Now: func() time.Time { return now }})
+	if err := c.Renew(ctx); err != nil {
+		t.Fatal(err)
+	}
+	c.backend = failing{}
+	if err := c.Renew(ctx); err == nil {
+		t.Fatal("Renew() with an unreachable backend succeeded")
+	}
+	if _, ok := c.Leader(DefaultGroup); !ok {
+		t.Error("a renewal failure within the TTL demoted the leader")
+	}
+	now = now.Add(10 * time.Second)
+	c.Renew(ctx)
+	if _, ok := c.Leader(DefaultGroup); ok {
+		t.Error("leader kept the group past its TTL")
+	}
+}
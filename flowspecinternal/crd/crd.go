@@ -0,0 +1,302 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+// Package crd maps locally originated rules to a Kubernetes custom resource,
+// FlowSpecRule, for operators built on the sdk package.
+//
+// The package provides the spec and status of the resource, with the
+// DeepCopy methods deepcopy-gen would generate, and the CRD manifest in
+// Definition. The operator declares the resource type itself, so this
+// package stays free of Kubernetes dependencies:
+//
+//	type FlowSpecRule struct {
+//		metav1.TypeMeta   `json:",inline"`
+//		metav1.ObjectMeta `json:"metadata,omitempty"`
+//		Spec   crd.FlowSpecRuleSpec   `json:"spec"`
+//		Status crd.FlowSpecRuleStatus `json:"status,omitempty"`
+//	}
+//
+// Condition has the JSON of metav1.Condition. Reconcile originates the spec
+// through an sdk.Client and records the outcome in the Valid, Feasible and
+// Ready conditions.
+package crd
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"strings"
+	"time"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/sdk"
+)
+
+// API group, version and kind of the resource.
+const (
+	Group      = "flowspec.floofspec.io"
+	Version    = "v1alpha1"
+	APIVersion = Group + "/" + Version
+	Kind       = "FlowSpecRule"
+)
+
+// Definition is the CustomResourceDefinition of FlowSpecRule, see
+// flowspecrule.yaml.
+//
+//go:embed flowspecrule.yaml
+var Definition string
+
+// FlowSpecRuleSpec is the desired rule, see sdk.RuleSpec.
+type FlowSpecRuleSpec struct {
+	Match   string `json:"match"`
+	Actions string `json:"actions,omitempty"`
+	IPv6    bool   `json:"ipv6,omitempty"`
+	// TTLSeconds, if set, withdraws the rule unless reconciled again.
+	TTLSeconds *int64 `json:"ttlSeconds,omitempty"`
+}
+
+// RuleSpec returns s as an sdk.RuleSpec.
+func (s *FlowSpecRuleSpec) RuleSpec() sdk.RuleSpec {
+	spec := sdk.RuleSpec{Match: s.Match, Actions: s.Actions, IPv6: s.IPv6}
+	if s.TTLSeconds != nil {
+		spec.TTL = time.Duration(*s.TTLSeconds) * time.Second
+	}
+	return spec
+}
+
+// SpecFromRule returns the spec of an originated rule, e.g. to import it as
+// a resource. Its lifetime is not part of the spec.
+func SpecFromRule(r *sdk.Rule) FlowSpecRuleSpec {
+	return FlowSpecRuleSpec{Match: r.Match, Actions: r.Actions, IPv6: r.IPv6}
+}
+
+// DeepCopyInto copies s into out.
+func (s *FlowSpecRuleSpec) DeepCopyInto(out *FlowSpecRuleSpec) {
+	*out = *s
+	if s.TTLSeconds != nil {
+		ttl := *s.TTLSeconds
+		out.TTLSeconds = &ttl
+	}
+}
+
+// DeepCopy returns a copy of s.
+func (s *FlowSpecRuleSpec) DeepCopy() *FlowSpecRuleSpec {
+	if s == nil {
+		return nil
+	}
+	out := new(FlowSpecRuleSpec)
+	s.DeepCopyInto(out)
+	return out
+}
+
+// FlowSpecRuleStatus is the observed state of a rule.
+type FlowSpecRuleStatus struct {
+	// ID is the sdk.Rule ID of the originated rule.
+	ID                 string `json:"id,omitempty"`
+	ObservedGeneration int64  `json:"observedGeneration,omitempty"`
+	// Match and Actions are canonical.
+	Match      string      `json:"match,omitempty"`
+	Actions    string      `json:"actions,omitempty"`
+	Expires    *time.Time  `json:"expires,omitempty"`
+	Conditions []Condition `json:"conditions,omitempty"`
+}
+
+// DeepCopyInto copies s into out.
+func (s *FlowSpecRuleStatus) DeepCopyInto(out *FlowSpecRuleStatus) {
+	*out = *s
+	if s.Expires != nil {
+		at := *s.Expires
+		out.Expires = &at
+	}
+	if s.Conditions != nil {
+		out.Conditions = make([]Condition, len(s.Conditions))
+		for i := range s.Conditions {
+			s.Conditions[i].DeepCopyInto(&out.Conditions[i])
+		}
+	}
+}
+
+// DeepCopy returns a copy of s.
+func (s *FlowSpecRuleStatus) DeepCopy() *FlowSpecRuleStatus {
+	if s == nil {
+		return nil
+	}
+	out := new(FlowSpecRuleStatus)
+	s.DeepCopyInto(out)
+	return out
+}
+
+// ConditionStatus is the status of a Condition.
+type ConditionStatus string
+
+const (
+	ConditionTrue    ConditionStatus = "True"
+	ConditionFalse   ConditionStatus = "False"
+	ConditionUnknown ConditionStatus = "Unknown"
+)
+
+// Condition types of a FlowSpecRuleStatus.
+const (
+	// ConditionValid is whether the spec parses.
+	ConditionValid = "Valid"
+	// ConditionFeasible is whether the rule is originated and passes
+	// validation, e.g. RFC 8955 feasibility against the unicast RIB.
+	ConditionFeasible = "Feasible"
+	// ConditionReady is whether both are true.
+	ConditionReady = "Ready"
+)
+
+// Condition reasons besides those of the validation errors, which are the
+// fs.Reason of the error in CamelCase, e.g. NoBestUnicast.
+const (
+	ReasonParsed        = "Parsed"
+	ReasonInvalidSpec   = "InvalidSpec"
+	ReasonOriginated    = "Originated"
+	ReasonNotOriginated = "NotOriginated"
+	// ReasonConflict is set when another resource originates the same match
+	// with other actions.
+	ReasonConflict = "Conflict"
+)
+
+// Condition is a metav1.Condition.
+type Condition struct {
+	Type               string          `json:"type"`
+	Status             ConditionStatus `json:"status"`
+	ObservedGeneration int64           `json:"observedGeneration,omitempty"`
+	LastTransitionTime time.Time       `json:"lastTransitionTime"`
+	Reason             string          `json:"reason"`
+	Message            string          `json:"message"`
+}
+
+// DeepCopyInto copies c into out.
+func (c *Condition) DeepCopyInto(out *Condition) {
+	*out = *c
+}
+
+// DeepCopy returns a copy of c.
+func (c *Condition) DeepCopy() *Condition {
+	if c == nil {
+		return nil
+	}
+	out := new(Condition)
+	c.DeepCopyInto(out)
+	return out
+}
+
+// FindCondition returns the condition of type typ in conds, nil if there is
+// none.
+func FindCondition(conds []Condition, typ string) *Condition {
+	for i := range conds {
+		if conds[i].Type == typ {
+			return &conds[i]
+		}
+	}
+	return nil
+}
+
+// SetCondition adds c to conds or replaces the condition of its type. Like
+// meta.SetStatusCondition, LastTransitionTime is set to now, truncated to
+// seconds, only when the status changes.
+func SetCondition(conds *[]Condition, c Condition, now time.Time) {
+	c.LastTransitionTime = now.Truncate(time.Second)
+	old := FindCondition(*conds, c.Type)
+	if old == nil {
+		*conds = append(*conds, c)
+		return
+	}
+	if old.Status == c.Status {
+		c.LastTransitionTime = old.LastTransitionTime
+	}
+	*old = c
+}
+
+// reason returns the condition reason of an fs.Reason, e.g. NoBestUnicast
+// for no-best-unicast.
+func reason(name string) string {
+	var b strings.Builder
+	for _, w := range strings.Split(name, "-") {
+		if w != "" {
+			b.WriteString(strings.ToUpper(w[:1]) + w[1:])
+		}
+	}
+	return b.String()
+}
+
+// Update records the outcome of originating generation of the spec: r and
+// err as returned by sdk.Client.CreateRule, UpdateRuleActions or ReadRule.
+func (s *FlowSpecRuleStatus) Update(generation int64, r *sdk.Rule, err error, now time.Time) {
+	s.ObservedGeneration = generation
+	if r != nil {
+		s.ID, s.Match, s.Actions, s.Expires = r.ID, r.Match, r.Actions, nil
+		if !r.Expires.IsZero() {
+			at := r.Expires
+			s.Expires = &at
+		}
+	} else if errors.Is(err, sdk.ErrNotFound) {
+		s.ID, s.Match, s.Actions, s.Expires = "", "", "", nil
+	}
+
+	valid := Condition{Type: ConditionValid, Status: ConditionTrue, Reason: ReasonParsed}
+	feasible := Condition{Type: ConditionFeasible}
+	switch {
+	case errors.Is(err, sdk.ErrSpec):
+		valid.Status, valid.Reason, valid.Message = ConditionFalse, ReasonInvalidSpec, err.Error()
+		feasible.Status, feasible.Reason = ConditionUnknown, ReasonInvalidSpec
+	case errors.Is(err, sdk.ErrExists):
+		feasible.Status, feasible.Reason, feasible.Message = ConditionFalse, ReasonConflict, err.Error()
+	case errors.Is(err, sdk.ErrNotFound):
+		feasible.Status, feasible.Reason, feasible.Message = ConditionUnknown, ReasonNotOriginated, err.Error()
+	case err != nil:
+		feasible.Status, feasible.Reason, feasible.Message = ConditionFalse, reason(fs.Reason(err)), err.Error()
+	case r != nil && !r.Feasible:
+		feasible.Status, feasible.Reason, feasible.Message = ConditionFalse, reason(r.Reason), r.Error
+	default:
+		feasible.Status, feasible.Reason = ConditionTrue, ReasonOriginated
+	}
+	ready := Condition{Type: ConditionReady, Status: ConditionTrue, Reason: ReasonOriginated}
+	for _, c := range []Condition{valid, feasible} {
+		if c.Status != ConditionTrue {
+			ready.Status, ready.Reason, ready.Message = ConditionFalse, c.Reason, c.Message
+			break
+		}
+	}
+	for _, c := range []Condition{valid, feasible, ready} {
+		c.ObservedGeneration = generation
+		SetCondition(&s.Conditions, c, now)
+	}
+}
+
+// Reconcile originates generation of spec through c, withdrawing the rule
+// of status first if the match changed, and updates status. It returns the
+// error that kept the rule from being originated, also recorded in the
+// conditions, so the caller can requeue the resource.
+func Reconcile(ctx context.Context, c *sdk.Client, generation int64, spec *FlowSpecRuleSpec, status *FlowSpecRuleStatus, now time.Time) error {
+	rs := spec.RuleSpec()
+	id, err := sdk.ID(rs)
+	if err != nil {
+		status.Update(generation, nil, err, now)
+		return err
+	}
+	if status.ID != "" && status.ID != id {
+		if err := c.DeleteRule(ctx, status.ID); err != nil {
+			return err
+		}
+		status.ID, status.Match, status.Actions, status.Expires = "", "", "", nil
+	}
+	r, err := c.CreateRule(ctx, rs)
+	if errors.Is(err, sdk.ErrExists) && status.ID == id {
+		r, err = c.UpdateRuleActions(ctx, id, spec.Actions)
+	}
+	status.Update(generation, r, err, now)
+	return err
+}
+
+// Finalize withdraws the rule of status, e.g. from the finalizer of a
+// deleted resource.
+func Finalize(ctx context.Context, c *sdk.Client, status *FlowSpecRuleStatus) error {
+	if status.ID == "" {
+		return nil
+	}
+	return c.DeleteRule(ctx, status.ID)
+}
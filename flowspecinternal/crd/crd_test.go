@@ -0,0 +1,141 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package crd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/rib"
+	"floofspectools/flowspecinternal/sdk"
+)
+
+func TestDeepCopy(t *testing.T) {
+	ttl := int64(60)
+	spec := &FlowSpecRuleSpec{Match: "dst 192.0.2.0/24", TTLSeconds: &ttl}
+	cp := spec.DeepCopy()
+	*cp.TTLSeconds = 120
+	if *spec.TTLSeconds != 60 {
+		t.Error("DeepCopy() of the spec shares TTLSeconds")
+	}
+
+	at := time.Unix(1700000000, 0)
+	status := &FlowSpecRuleStatus{Expires: &at, Conditions: []Condition{{Type: ConditionReady, Status: ConditionTrue}}}
+	scp := status.DeepCopy()
+	*scp.Expires = at.Add(time.Hour)
+	scp.Conditions[0].Status = ConditionFalse
+	if !status.Expires.Equal(at) || status.Conditions[0].Status != ConditionTrue {
+		t.Error("DeepCopy() of the status shares memory")
+	}
+	if (*FlowSpecRuleStatus)(nil).DeepCopy() != nil {
+		t.Error("DeepCopy() of nil is not nil")
+	}
+}
+
+func TestSetCondition(t *testing.T) {
+	t0, t1 := time.Unix(1700000000, 500), time.Unix(1700000100, 0)
+	var conds []Condition
+	SetCondition(&conds, Condition{Type: ConditionReady, Status: ConditionFalse, Reason: "A"}, t0)
+	SetCondition(&conds, Condition{Type: ConditionReady, Status: ConditionFalse, Reason: "B"}, t1)
+	if c := FindCondition(conds, ConditionReady); len(conds) != 1 || c.Reason != "B" || !c.LastTransitionTime.Equal(t0.Truncate(time.Second)) {
+		t.Errorf("same status: %+v, want the transition time kept", conds)
+	}
+	SetCondition(&conds, Condition{Type: ConditionReady, Status: ConditionTrue, Reason: "C"}, t1)
+	if c := FindCondition(conds, ConditionReady); !c.LastTransitionTime.Equal(t1) {
+		t.Errorf("changed status: %+v, want the transition time updated", conds)
+	}
+	if FindCondition(conds, ConditionValid) != nil {
+		t.Error("FindCondition() of a missing type is not nil")
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0)
+	local := rib.NewFlowSpecRIB(nil)
+	c := sdk.New(local, &sdk.Options{Validate: func(r *fs.FlowSpecRoute) error {
+		if r.DestPrefix != nil && r.DestPrefix.Addr().IsLoopback() {
+			return fs.ErrNoBestUnicast
+		}
+		return nil
+	}})
+	cond := func(s *FlowSpecRuleStatus, typ string) string {
+		c := FindCondition(s.Conditions, typ)
+		if c == nil {
+			return "missing"
+		}
+		return string(c.Status) + "/" + c.Reason
+	}
+
+	spec := &FlowSpecRuleSpec{Match: "dst 192.0.2.0/24", Actions: "discard"}
+	var status FlowSpecRuleStatus
+	if err := Reconcile(ctx, c, 1, spec, &status, now); err != nil {
+		t.Fatal(err)
+	}
+	if status.ID == "" || status.ObservedGeneration != 1 || cond(&status, ConditionReady) != "True/Originated" {
+		t.Errorf("Reconcile() status = %+v", status)
+	}
+
+	// New actions update the rule in place.
+	spec.Actions = "rate-limit 1M"
+	if err := Reconcile(ctx, c, 2, spec, &status, now); err != nil || status.Actions != "rate-bytes=1000000" || local.Snapshot().Len() != 1 {
+		t.Errorf("Reconcile() new actions = %v, %+v", err, status)
+	}
+
+	// Another resource with the same match conflicts.
+	var other FlowSpecRuleStatus
+	if err := Reconcile(ctx, c, 1, &FlowSpecRuleSpec{Match: "dst 192.0.2.0/24"}, &other, now); !errors.Is(err, sdk.ErrExists) ||
+		cond(&other, ConditionReady) != "False/Conflict" || other.ID != "" {
+		t.Errorf("Reconcile() conflict = %v, %+v", err, other)
+	}
+
+	// A new match withdraws the old rule.
+	old := status.ID
+	spec.Match = "dst 127.0.0.1/32"
+	if err := Reconcile(ctx, c, 3, spec, &status, now); !errors.Is(err, fs.ErrNoBestUnicast) {
+		t.Errorf("Reconcile() infeasible = %v", err)
+	}
+	if _, err := c.ReadRule(ctx, old); !errors.Is(err, sdk.ErrNotFound) {
+		t.Errorf("old rule still originated: %v", err)
+	}
+	if cond(&status, ConditionValid) != "True/Parsed" || cond(&status, ConditionFeasible) != "False/NoBestUnicast" || cond(&status, ConditionReady) != "False/NoBestUnicast" {
+		t.Errorf("Reconcile() infeasible status = %+v", status.Conditions)
+	}
+
+	spec.Match = "dst nowhere"
+	if err := Reconcile(ctx, c, 4, spec, &status, now); !errors.Is(err, sdk.ErrSpec) || cond(&status, ConditionValid) != "False/InvalidSpec" {
+		t.Errorf("Reconcile() invalid = %v, %+v", err, status.Conditions)
+	}
+
+	spec.Match = "dst 198.51.100.0/24"
+	if err := Reconcile(ctx, c, 5, spec, &status, now); err != nil {
+		t.Fatal(err)
+	}
+	if err := Finalize(ctx, c, &status); err != nil || local.Snapshot().Len() != 0 {
+		t.Errorf("Finalize() = %v, %d rules left", err, local.Snapshot().Len())
+	}
+}
+
+func TestJSON(t *testing.T) {
+	var status FlowSpecRuleStatus
+	status.Update(7, &sdk.Rule{ID: "x", Match: "dst=192.0.2.0/24", Feasible: true}, nil, time.Unix(1700000000, 0).UTC())
+	b, err := json.Marshal(status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"observedGeneration":7`, `"lastTransitionTime":"2023-11-14T22:13:20Z"`, `"type":"Ready","status":"True"`} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("JSON %s lacks %s", b, want)
+		}
+	}
+	if !strings.Contains(Definition, "name: "+Version) || !strings.Contains(Definition, "group: "+Group) {
+		t.Error("Definition does not match the API version")
+	}
+}
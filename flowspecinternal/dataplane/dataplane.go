@@ -0,0 +1,199 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+// Package dataplane installs the feasible rules of a FlowSpec RIB with the
+// compilers of its subpackages.
+//
+// A Backend pairs a compiler, rendering the whole rule set as commands or
+// configuration, with the function applying the result. An Installer syncs
+// every backend with a RIB snapshot. With Options.DryRun it still compiles
+// and logs the result but applies nothing, so a new deployment can watch
+// what it would install before it enforces anything.
+package dataplane
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/actions"
+	"floofspectools/flowspecinternal/rib"
+)
+
+var (
+	ErrInvalidBackend = errors.New("dataplane: backend needs a name, Compile and, unless dry-run, Apply")
+)
+
+// DefaultSyncInterval is how often Run checks the RIB for changes when called
+// with a non-positive interval.
+const DefaultSyncInterval = time.Second
+
+// Backend is one dataplane.
+type Backend struct {
+	Name string
+	// Compile renders rules, in RFC8955 5.1 order, as what Apply installs.
+	Compile func(rules []actions.Rule) ([]string, error)
+	// Apply replaces the installed rules with out. It is never called in
+	// dry-run mode and may be nil then.
+	Apply func(ctx context.Context, out []string) error
+}
+
+// PerRule adapts a compiler of single rules, such as iptables.Compile with
+// its options bound, to Backend.Compile. Results are rendered with fmt.Sprint.
+func PerRule[T any](compile func(fs.FSComponentList, []actions.Action) ([]T, error)) func([]actions.Rule) ([]string, error) {
+	return func(rules []actions.Rule) ([]string, error) {
+		var out []string
+		for _, r := range rules {
+			res, err := compile(r.Components, r.Actions)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", r.Components, err)
+			}
+			for _, x := range res {
+				out = append(out, fmt.Sprint(x))
+			}
+		}
+		return out, nil
+	}
+}
+
+// Options configures an Installer.
+type Options struct {
+	// DryRun compiles and logs the rules but does not apply them.
+	DryRun bool
+	// Logger, if set, receives every sync: the compiled output at debug
+	// level, or at info level in dry-run mode, and failures.
+	Logger *slog.Logger
+}
+
+// Result is the outcome of one backend's sync.
+type Result struct {
+	Backend string
+	// Rules counts the rules compiled.
+	Rules int
+	// Output is what Compile returned, installed unless DryRun.
+	Output []string
+	// Applied reports that Apply succeeded; it is false in dry-run mode.
+	Applied bool
+	DryRun  bool
+	Err     error
+}
+
+// Installer syncs backends with a FlowSpec RIB. Its methods are safe for
+// concurrent use; syncs are serialized.
+type Installer struct {
+	backends []Backend
+	o        Options
+	log      *slog.Logger
+
+	mu      sync.Mutex
+	version uint64
+	synced  bool
+	last    []Result
+}
+
+// NewInstaller returns an Installer for backends.
+func NewInstaller(backends []Backend, opts *Options) (*Installer, error) {
+	var o Options
+	if opts != nil {
+		o = *opts
+	}
+	for _, b := range backends {
+		if b.Name == "" || b.Compile == nil || (b.Apply == nil && !o.DryRun) {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidBackend, b.Name)
+		}
+	}
+	return &Installer{
+		backends: backends,
+		o:        o,
+		log:      fs.SubsystemLogger(o.Logger, fs.SubsystemDataplane),
+	}, nil
+}
+
+// Rules returns the feasible rules of snap in RFC8955 5.1 order with their
+// traffic filtering actions; other extended communities, e.g. route targets,
+// are left out.
+func Rules(snap *rib.FlowSpecSnapshot) []actions.Rule {
+	var out []actions.Rule
+	for e := range snap.All() {
+		if e.Err != nil {
+			continue
+		}
+		r := actions.Rule{Components: e.Route.Components}
+		for _, ec := range e.Route.ExtCommunities {
+			if a, err := actions.Decode(ec); err == nil {
+				r.Actions = append(r.Actions, a)
+			}
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
+// Sync compiles the feasible rules of snap for every backend and, unless in
+// dry-run mode, applies them. A backend failing does not stop the others.
+func (in *Installer) Sync(ctx context.Context, snap *rib.FlowSpecSnapshot) []Result {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	rules := Rules(snap)
+	results := make([]Result, len(in.backends))
+	for i, b := range in.backends {
+		res := Result{Backend: b.Name, Rules: len(rules), DryRun: in.o.DryRun}
+		res.Output, res.Err = b.Compile(rules)
+		if res.Err == nil && !in.o.DryRun {
+			res.Err = b.Apply(ctx, res.Output)
+			res.Applied = res.Err == nil
+		}
+		in.logResult(res, snap.Version())
+		results[i] = res
+	}
+	in.version, in.synced, in.last = snap.Version(), true, results
+	return results
+}
+
+func (in *Installer) logResult(res Result, version uint64) {
+	attrs := []any{"backend", res.Backend, "version", version, "rules", res.Rules, "lines", len(res.Output)}
+	switch {
+	case res.Err != nil:
+		in.log.Error("dataplane sync failed", append(attrs, "error", res.Err)...)
+	case res.DryRun:
+		in.log.Info("dry run, not applying", append(attrs, "output", res.Output)...)
+	default:
+		in.log.Debug("dataplane synced", append(attrs, "output", res.Output)...)
+	}
+}
+
+// Last returns the results of the latest sync, nil before the first.
+func (in *Installer) Last() []Result {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	return in.last
+}
+
+// Run syncs the backends with r now and whenever its snapshot changed,
+// checking every interval, until ctx is done.
+func (in *Installer) Run(ctx context.Context, r *rib.FlowSpecRIB, interval time.Duration) error {
+	if interval <= 0 {
+		interval = DefaultSyncInterval
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		snap := r.Snapshot()
+		in.mu.Lock()
+		stale := !in.synced || in.version != snap.Version()
+		in.mu.Unlock()
+		if stale {
+			in.Sync(ctx, snap)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package dataplane
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"strings"
+	"testing"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/actions"
+	"floofspectools/flowspecinternal/dataplane/iptables"
+	"floofspectools/flowspecinternal/rib"
+)
+
+func testRIB(t *testing.T) *rib.FlowSpecRIB {
+	t.Helper()
+	r := rib.NewFlowSpecRIB(nil)
+	for i, s := range []string{
+		"dst 192.0.2.0/24 proto udp dport 123 then discard",
+		"dst 198.51.100.0/24 proto tcp then rate-limit 1M",
+		"dst 203.0.113.0/24 then discard",
+	} {
+		list, acts, err := actions.ParseRule(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		route := &fs.FlowSpecRoute{AFI: fs.AFIIPv4, SAFI: fs.SAFIFlowSpec, Components: list}
+		for _, a := range acts {
+			route.ExtCommunities = append(route.ExtCommunities, a.ExtendedCommunity())
+		}
+		var verr error
+		if i == 2 {
+			verr = fs.ErrNoBestUnicast
+		}
+		r.Insert(route, verr)
+	}
+	return r
+}
+
+func iptablesBackend(applied *[][]string) Backend {
+	return Backend{
+		Name: "iptables",
+		Compile: PerRule(func(l fs.FSComponentList, acts []actions.Action) ([]iptables.Rule, error) {
+			return iptables.Compile(l, acts, nil)
+		}),
+		Apply: func(ctx context.Context, out []string) error {
+			*applied = append(*applied, out)
+			return nil
+		},
+	}
+}
+
+func TestInstaller(t *testing.T) {
+	r := testRIB(t)
+	for _, dryRun := range []bool{false, true} {
+		var applied [][]string
+		var buf bytes.Buffer
+		in, err := NewInstaller([]Backend{iptablesBackend(&applied)}, &Options{DryRun: dryRun, Logger: slog.New(slog.NewTextHandler(&buf, nil))})
+		if err != nil {
+			t.Fatal(err)
+		}
+		res := in.Sync(context.Background(), r.Snapshot())
+		if len(res) != 1 || res[0].Err != nil || res[0].Rules != 2 || len(res[0].Output) == 0 {
+			t.Fatalf("DryRun %v: Sync() = %+v, want 2 rules compiled", dryRun, res)
+		}
+		if res[0].Applied == dryRun || (len(applied) == 1) == dryRun {
+			t.Errorf("DryRun %v: Applied = %v, Apply called %d times", dryRun, res[0].Applied, len(applied))
+		}
+		if dryRun && !strings.Contains(buf.String(), "dry run") {
+			t.Errorf("DryRun: log = %q, want the output logged", buf.String())
+		}
+		if !slices.Equal(in.Last()[0].Output, res[0].Output) {
+			t.Errorf("Last() = %+v, want the sync result", in.Last())
+		}
+	}
+}
+
+func TestInstallerErrors(t *testing.T) {
+	if _, err := NewInstaller([]Backend{{Name: "x", Compile: PerRule(func(fs.FSComponentList, []actions.Action) ([]string, error) { return nil, nil })}}, nil); !errors.Is(err, ErrInvalidBackend) {
+		t.Errorf("NewInstaller(no Apply) error = %v, want %v", err, ErrInvalidBackend)
+	}
+	failing := Backend{
+		Name:    "failing",
+		Compile: func([]actions.Rule) ([]string, error) { return nil, errors.New("boom") },
+		Apply:   func(context.Context, []string) error { return nil },
+	}
+	var applied [][]string
+	in, err := NewInstaller([]Backend{failing, iptablesBackend(&applied)}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := in.Sync(context.Background(), testRIB(t).Snapshot())
+	if res[0].Err == nil || res[1].Err != nil || len(applied) != 1 {
+		t.Errorf("Sync() = %+v, want the first backend failing and the second applied", res)
+	}
+}
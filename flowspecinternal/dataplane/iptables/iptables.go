@@ -0,0 +1,533 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+// Package iptables compiles FlowSpec rules into iptables/ip6tables arguments.
+//
+// iptables cannot express OR-ed operator sequences within a single rule, so a
+// FlowSpec rule is expanded into the cross product of its alternatives. The
+// following approximations apply:
+//   - port components without a protocol component are expanded to tcp and udp
+//   - protocol, DSCP and ICMP values are enumerated, one rule per value
+//   - fragment components are not supported
+package iptables
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/actions"
+)
+
+var (
+	ErrUnsupportedComponent = errors.New("iptables: component cannot be expressed as iptables match")
+	ErrEmptyMatch           = fs.ErrEmptyMatch
+	ErrMixedFamilies        = fs.ErrMixedFamilies
+	ErrConflictingActions   = errors.New("iptables: more than one traffic-rate action present")
+	ErrTooManyRules         = errors.New("iptables: rule expansion exceeds Options.MaxRules")
+)
+
+// Protocol numbers the compiler needs to reason about.
+const (
+	protoICMP   = 1
+	protoTCP    = 6
+	protoUDP    = 17
+	protoICMPv6 = 58
+	protoSCTP   = 132
+)
+
+// maxMultiport is the number of ports a single multiport match accepts; ranges count twice.
+const maxMultiport = 15
+
+// Options controls where compiled rules are installed.
+type Options struct {
+	Chain       string // filter table chain, defaults to "FLOWSPEC"
+	MangleChain string // mangle table chain for marking and redirect, defaults to "FLOWSPEC"
+	// IPv6 selects ip6tables for rules that carry no prefix component.
+	IPv6 bool
+	// MaxRules bounds the expansion of one FlowSpec rule, defaults to 256.
+	MaxRules int
+}
+
+// Rule is a single iptables invocation.
+type Rule struct {
+	Command string // "iptables" or "ip6tables"
+	Args    []string
+}
+
+// String renders r as a shell command line.
+func (r Rule) String() string {
+	args := make([]string, len(r.Args))
+	for i, a := range r.Args {
+		if strings.ContainsAny(a, " \"'") {
+			a = strconv.Quote(a)
+		}
+		args[i] = a
+	}
+	return r.Command + " " + strings.Join(args, " ")
+}
+
+// Compile translates list and acts into iptables invocations in installation order.
+// Rules must be compiled in RFC8955 5.1 order, see flowspecinternal.SortFlowSpecs;
+// a rule that stops evaluation RETURNs from the FlowSpec chain.
+func Compile(list fs.FSComponentList, acts []actions.Action, opts *Options) ([]Rule, error) {
+	o := Options{Chain: "FLOWSPEC", MangleChain: "FLOWSPEC", MaxRules: 256}
+	if opts != nil {
+		o.IPv6 = opts.IPv6
+		if opts.Chain != "" {
+			o.Chain = opts.Chain
+		}
+		if opts.MangleChain != "" {
+			o.MangleChain = opts.MangleChain
+		}
+		if opts.MaxRules > 0 {
+			o.MaxRules = opts.MaxRules
+		}
+	}
+
+	ipv6, err := fs.AddressFamily(list, o.IPv6)
+	if err != nil {
+		return nil, err
+	}
+	matches, err := compileMatches(list, ipv6, o.MaxRules)
+	if err != nil {
+		return nil, err
+	}
+	targets, err := compileTargets(list, acts, o)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := "iptables"
+	if ipv6 {
+		cmd = "ip6tables"
+	}
+	var out []Rule
+	for _, m := range matches {
+		for _, t := range targets {
+			args := append([]string{}, t.table...)
+			args = append(args, m...)
+			args = append(args, t.jump...)
+			out = append(out, Rule{Command: cmd, Args: args})
+		}
+	}
+	if len(out) > o.MaxRules {
+		return nil, ErrTooManyRules
+	}
+	return out, nil
+}
+
+func enumerate(ranges []fs.ValueRange) []uint64 {
+	var out []uint64
+	for _, r := range ranges {
+		for v := r.From; v <= r.To; v++ {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// cross returns every combination of one alternative from each of alts.
+func cross(acc [][]string, alts [][]string, limit int) ([][]string, error) {
+	var out [][]string
+	for _, a := range acc {
+		for _, b := range alts {
+			out = append(out, append(append([]string{}, a...), b...))
+			if len(out) > limit {
+				return nil, ErrTooManyRules
+			}
+		}
+	}
+	return out, nil
+}
+
+func protoName(p uint64, ipv6 bool) string {
+	switch p {
+	case protoTCP:
+		return "tcp"
+	case protoUDP:
+		return "udp"
+	case protoSCTP:
+		return "sctp"
+	case protoICMP:
+		return "icmp"
+	case protoICMPv6:
+		if ipv6 {
+			return "ipv6-icmp"
+		}
+	}
+	return strconv.FormatUint(p, 10)
+}
+
+func compileMatches(list fs.FSComponentList, ipv6 bool, limit int) ([][]string, error) {
+	var (
+		protos   []uint64 // nil means any protocol
+		needs    []uint64 // protocols implied by port, flag and icmp components
+		byType   = map[fs.ComponentType]fs.FSComponent{}
+		prefixes []string
+	)
+	for _, c := range list.Components {
+		byType[c.Type] = c
+		switch c.Type {
+		case fs.ComponentTypeDestinationPrefix:
+			prefixes = append(prefixes, "-d", c.Prefix.Masked().String())
+		case fs.ComponentTypeSourcePrefix:
+			prefixes = append(prefixes, "-s", c.Prefix.Masked().String())
+		case fs.ComponentTypeIpProtocol:
+			ranges, err := fs.ComponentRanges(c, 0xff)
+			if err != nil {
+				return nil, err
+			}
+			if !fs.MatchesAll(ranges, 0xff) {
+				protos = enumerate(ranges)
+			}
+		case fs.ComponentTypePort, fs.ComponentTypeDestinationPort, fs.ComponentTypeSourcePort:
+			needs = intersect(needs, []uint64{protoTCP, protoUDP, protoSCTP})
+		case fs.ComponentTypeTCPFlags:
+			needs = intersect(needs, []uint64{protoTCP})
+		case fs.ComponentTypeICMPType, fs.ComponentTypeICMPCode:
+			if ipv6 {
+				needs = intersect(needs, []uint64{protoICMPv6})
+			} else {
+				needs = intersect(needs, []uint64{protoICMP})
+			}
+		case fs.ComponentTypeFragment:
+			return nil, ErrUnsupportedComponent
+		}
+	}
+	if needs != nil {
+		if len(needs) == 0 {
+			return nil, ErrEmptyMatch
+		}
+		if protos == nil {
+			// approximation: a port match without protocol means tcp or udp
+			protos = intersect([]uint64{protoTCP, protoUDP}, needs)
+			if len(protos) == 0 {
+				protos = needs
+			}
+		} else {
+			protos = intersect(protos, needs)
+		}
+		if len(protos) == 0 {
+			return nil, ErrEmptyMatch
+		}
+	}
+
+	acc := [][]string{prefixes}
+	if protos != nil {
+		alts := make([][]string, 0, len(protos))
+		for _, p := range protos {
+			alts = append(alts, []string{"-p", protoName(p, ipv6)})
+		}
+		var err error
+		if acc, err = cross(acc, alts, limit); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, t := range []fs.ComponentType{
+		fs.ComponentTypePort,
+		fs.ComponentTypeDestinationPort,
+		fs.ComponentTypeSourcePort,
+		fs.ComponentTypeICMPType,
+		fs.ComponentTypeTCPFlags,
+		fs.ComponentTypePacketLength,
+		fs.ComponentTypeDSCP,
+	} {
+		c, ok := byType[t]
+		if !ok {
+			continue
+		}
+		alts, err := componentAlts(c, byType, ipv6)
+		if err != nil {
+			return nil, err
+		}
+		if alts == nil {
+			continue
+		}
+		if acc, err = cross(acc, alts, limit); err != nil {
+			return nil, err
+		}
+	}
+	if _, ok := byType[fs.ComponentTypeICMPCode]; ok {
+		if _, ok := byType[fs.ComponentTypeICMPType]; !ok {
+			return nil, ErrUnsupportedComponent
+		}
+	}
+	return acc, nil
+}
+
+func intersect(a, b []uint64) []uint64 {
+	if a == nil {
+		return append([]uint64{}, b...)
+	}
+	out := []uint64{}
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				out = append(out, x)
+			}
+		}
+	}
+	return out
+}
+
+func componentAlts(c fs.FSComponent, byType map[fs.ComponentType]fs.FSComponent, ipv6 bool) ([][]string, error) {
+	switch c.Type {
+	case fs.ComponentTypePort:
+		return portAlts(c, "--port", "--ports")
+	case fs.ComponentTypeDestinationPort:
+		return portAlts(c, "--dport", "--dports")
+	case fs.ComponentTypeSourcePort:
+		return portAlts(c, "--sport", "--sports")
+	case fs.ComponentTypeICMPType:
+		return icmpAlts(c, byType, ipv6)
+	case fs.ComponentTypePacketLength:
+		ranges, err := fs.ComponentRanges(c, 0xffff)
+		if err != nil || fs.MatchesAll(ranges, 0xffff) {
+			return nil, err
+		}
+		var alts [][]string
+		for _, r := range ranges {
+			alts = append(alts, []string{"-m", "length", "--length", formatRange(r, ":")})
+		}
+		return alts, nil
+	case fs.ComponentTypeDSCP:
+		ranges, err := fs.ComponentRanges(c, 0x3f)
+		if err != nil || fs.MatchesAll(ranges, 0x3f) {
+			return nil, err
+		}
+		var alts [][]string
+		for _, v := range enumerate(ranges) {
+			alts = append(alts, []string{"-m", "dscp", "--dscp", strconv.FormatUint(v, 10)})
+		}
+		return alts, nil
+	case fs.ComponentTypeTCPFlags:
+		return tcpFlagAlts(c)
+	}
+	return nil, ErrUnsupportedComponent
+}
+
+func formatRange(r fs.ValueRange, sep string) string {
+	if r.From == r.To {
+		return strconv.FormatUint(r.From, 10)
+	}
+	return fmt.Sprintf("%d%s%d", r.From, sep, r.To)
+}
+
+// portAlts uses a plain port match for one range and multiport chunks otherwise.
+// The "either" port component (type 4) always needs multiport --ports.
+func portAlts(c fs.FSComponent, single, multi string) ([][]string, error) {
+	ranges, err := fs.ComponentRanges(c, 0xffff)
+	if err != nil || fs.MatchesAll(ranges, 0xffff) {
+		return nil, err
+	}
+	if len(ranges) == 1 && single != "--port" {
+		return [][]string{{single, formatRange(ranges[0], ":")}}, nil
+	}
+	var (
+		alts  [][]string
+		chunk []string
+		used  int
+	)
+	flush := func() {
+		if len(chunk) > 0 {
+			alts = append(alts, []string{"-m", "multiport", multi, strings.Join(chunk, ",")})
+		}
+		chunk, used = nil, 0
+	}
+	for _, r := range ranges {
+		cost := 1
+		if r.From != r.To {
+			cost = 2
+		}
+		if used+cost > maxMultiport {
+			flush()
+		}
+		chunk = append(chunk, formatRange(r, ":"))
+		used += cost
+	}
+	flush()
+	return alts, nil
+}
+
+func icmpAlts(c fs.FSComponent, byType map[fs.ComponentType]fs.FSComponent, ipv6 bool) ([][]string, error) {
+	opt := "--icmp-type"
+	if ipv6 {
+		opt = "--icmpv6-type"
+	}
+	ranges, err := fs.ComponentRanges(c, 0xff)
+	if err != nil {
+		return nil, err
+	}
+	types := enumerate(ranges)
+	var codes []uint64
+	if cc, ok := byType[fs.ComponentTypeICMPCode]; ok {
+		cr, err := fs.ComponentRanges(cc, 0xff)
+		if err != nil {
+			return nil, err
+		}
+		if !fs.MatchesAll(cr, 0xff) {
+			codes = enumerate(cr)
+		}
+	}
+	var alts [][]string
+	for _, t := range types {
+		if codes == nil {
+			alts = append(alts, []string{opt, strconv.FormatUint(t, 10)})
+			continue
+		}
+		for _, code := range codes {
+			alts = append(alts, []string{opt, fmt.Sprintf("%d/%d", t, code)})
+		}
+	}
+	return alts, nil
+}
+
+var tcpFlagNames = []struct {
+	bit  uint64
+	name string
+}{
+	{0x01, "FIN"},
+	{0x02, "SYN"},
+	{0x04, "RST"},
+	{0x08, "PSH"},
+	{0x10, "ACK"},
+	{0x20, "URG"},
+}
+
+func flagList(v uint64) (string, error) {
+	if v == 0 {
+		return "NONE", nil
+	}
+	var names []string
+	for _, f := range tcpFlagNames {
+		if v&f.bit != 0 {
+			names = append(names, f.name)
+			v &^= f.bit
+		}
+	}
+	if v != 0 {
+		// ECE/CWR and the data offset bits are not supported by the tcp match
+		return "", ErrUnsupportedComponent
+	}
+	return strings.Join(names, ","), nil
+}
+
+// tcpFlagAlts renders bitmask terms as RFC8955 4.2.1.2 describes; "any of" terms
+// are expanded into one alternative per bit.
+func tcpFlagAlts(c fs.FSComponent) ([][]string, error) {
+	ops, err := fs.ParseBitmaskOps(c.Raw)
+	if err != nil {
+		return nil, err
+	}
+	var alts [][]string
+	for _, group := range fs.SplitBitmaskOps(ops) {
+		acc := [][]string{nil}
+		for _, op := range group {
+			mask, err := flagList(op.Value)
+			if err != nil {
+				return nil, err
+			}
+			var termAlts [][]string
+			switch {
+			case op.Match && !op.Not:
+				termAlts = [][]string{{"-m", "tcp", "--tcp-flags", mask, mask}}
+			case op.Match && op.Not:
+				termAlts = [][]string{{"-m", "tcp", "!", "--tcp-flags", mask, mask}}
+			case op.Not:
+				termAlts = [][]string{{"-m", "tcp", "--tcp-flags", mask, "NONE"}}
+			default:
+				for _, f := range tcpFlagNames {
+					if op.Value&f.bit != 0 {
+						termAlts = append(termAlts, []string{"-m", "tcp", "--tcp-flags", f.name, f.name})
+					}
+				}
+			}
+			if acc, err = cross(acc, termAlts, 1<<16); err != nil {
+				return nil, err
+			}
+		}
+		alts = append(alts, acc...)
+	}
+	return alts, nil
+}
+
+type target struct {
+	table []string
+	jump  []string
+}
+
+// limitName derives a hashlimit bucket name shared by all expansions of one FlowSpec rule.
+func limitName(list fs.FSComponentList) string {
+	h := fnv.New32a()
+	for _, c := range list.Components {
+		h.Write([]byte{byte(c.Type)})
+		if c.Prefix != nil {
+			h.Write([]byte(c.Prefix.String()))
+		}
+		h.Write(c.Raw)
+	}
+	return fmt.Sprintf("fs-%08x", h.Sum32())
+}
+
+// compileTargets returns the per-match rules implementing acts, in installation order.
+func compileTargets(list fs.FSComponentList, acts []actions.Action, o Options) ([]target, error) {
+	var (
+		out   []target
+		final []target
+		chain = []string{"-A", o.Chain}
+		stop  = true
+		drop  bool
+		rates int
+	)
+	for _, a := range acts {
+		switch v := a.(type) {
+		case actions.TrafficRateBytes, actions.TrafficRatePackets:
+			rates++
+			if actions.IsDiscard(a) {
+				final = append(final, target{table: chain, jump: []string{"-j", "DROP"}})
+				drop = true
+				continue
+			}
+			above := ""
+			if b, ok := v.(actions.TrafficRateBytes); ok {
+				above = fmt.Sprintf("%db/s", uint64(b.Rate))
+			} else {
+				above = fmt.Sprintf("%d/sec", uint64(v.(actions.TrafficRatePackets).Rate))
+			}
+			final = append(final, target{table: chain, jump: []string{
+				"-m", "hashlimit", "--hashlimit-above", above, "--hashlimit-name", limitName(list),
+				"-j", "DROP",
+			}})
+		case actions.TrafficAction:
+			if v.Sample {
+				out = append(out, target{table: chain, jump: []string{"-j", "LOG", "--log-prefix", "flowspec: "}})
+			}
+			stop = !v.Terminal
+		case actions.TrafficMarking:
+			out = append(out, target{
+				table: []string{"-t", "mangle", "-A", o.MangleChain},
+				jump:  []string{"-j", "DSCP", "--set-dscp", strconv.Itoa(int(v.DSCP & 0x3f))},
+			})
+		case actions.Redirect:
+			// no VRFs in iptables, hand the local administrator to policy routing instead
+			out = append(out, target{
+				table: []string{"-t", "mangle", "-A", o.MangleChain},
+				jump:  []string{"-j", "MARK", "--set-mark", strconv.FormatUint(uint64(v.Value), 10)},
+			})
+		}
+	}
+	if rates > 1 {
+		return nil, ErrConflictingActions
+	}
+	out = append(out, final...)
+	if stop && !drop {
+		out = append(out, target{table: chain, jump: []string{"-j", "RETURN"}})
+	}
+	return out, nil
+}
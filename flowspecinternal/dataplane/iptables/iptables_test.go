@@ -0,0 +1,134 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package iptables
+
+import (
+	"errors"
+	"net/netip"
+	"slices"
+	"testing"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/actions"
+)
+
+func prefix(s string) *netip.Prefix {
+	p := netip.MustParsePrefix(s)
+	return &p
+}
+
+func render(rules []Rule) []string {
+	out := make([]string, 0, len(rules))
+	for _, r := range rules {
+		out = append(out, r.String())
+	}
+	return out
+}
+
+func TestCompile(t *testing.T) {
+	tests := []struct {
+		name    string
+		list    fs.FSComponentList
+		acts    []actions.Action
+		opts    *Options
+		want    []string
+		wantErr error
+	}{
+		{
+			name: "DstProtoPort_Discard",
+			list: fs.FSComponentList{Components: []fs.FSComponent{
+				{Type: fs.ComponentTypeDestinationPrefix, Prefix: prefix("192.0.2.0/24")},
+				{Type: fs.ComponentTypeIpProtocol, Raw: []byte{0x81, 0x06}},
+				{Type: fs.ComponentTypeDestinationPort, Raw: []byte{0x91, 0x01, 0xbb}},
+			}},
+			acts: []actions.Action{actions.TrafficRateBytes{}},
+			want: []string{"iptables -A FLOWSPEC -d 192.0.2.0/24 -p tcp --dport 443 -j DROP"},
+		},
+		{
+			name: "PortWithoutProtocol_ExpandsTCPAndUDP_Multiport",
+			list: fs.FSComponentList{Components: []fs.FSComponent{
+				{Type: fs.ComponentTypeDestinationPrefix, Prefix: prefix("2001:db8::/32")},
+				{Type: fs.ComponentTypeDestinationPort, Raw: []byte{0x01, 0x35, 0x81, 0x7b}},
+			}},
+			acts: []actions.Action{actions.TrafficRatePackets{Rate: 100}},
+			want: []string{
+				"ip6tables -A FLOWSPEC -d 2001:db8::/32 -p tcp -m multiport --dports 53,123 -m hashlimit --hashlimit-above 100/sec --hashlimit-name fs-35bcc638 -j DROP",
+				"ip6tables -A FLOWSPEC -d 2001:db8::/32 -p tcp -m multiport --dports 53,123 -j RETURN",
+				"ip6tables -A FLOWSPEC -d 2001:db8::/32 -p udp -m multiport --dports 53,123 -m hashlimit --hashlimit-above 100/sec --hashlimit-name fs-35bcc638 -j DROP",
+				"ip6tables -A FLOWSPEC -d 2001:db8::/32 -p udp -m multiport --dports 53,123 -j RETURN",
+			},
+		},
+		{
+			name: "TCPFlags_AnyOf_ExpandsPerBit",
+			list: fs.FSComponentList{Components: []fs.FSComponent{
+				{Type: fs.ComponentTypeTCPFlags, Raw: []byte{0x80, 0x06}},
+			}},
+			acts: []actions.Action{actions.TrafficAction{Terminal: true}, actions.TrafficMarking{DSCP: 8}},
+			want: []string{
+				"iptables -t mangle -A FLOWSPEC -p tcp -m tcp --tcp-flags SYN SYN -j DSCP --set-dscp 8",
+				"iptables -t mangle -A FLOWSPEC -p tcp -m tcp --tcp-flags RST RST -j DSCP --set-dscp 8",
+			},
+		},
+		{
+			name: "ICMPTypeAndCode",
+			list: fs.FSComponentList{Components: []fs.FSComponent{
+				{Type: fs.ComponentTypeDestinationPrefix, Prefix: prefix("192.0.2.1/32")},
+				{Type: fs.ComponentTypeICMPType, Raw: []byte{0x81, 0x03}},
+				{Type: fs.ComponentTypeICMPCode, Raw: []byte{0x81, 0x04}},
+			}},
+			acts: []actions.Action{actions.TrafficRateBytes{}},
+			want: []string{"iptables -A FLOWSPEC -d 192.0.2.1/32 -p icmp --icmp-type 3/4 -j DROP"},
+		},
+		{
+			name: "LengthRanges_Sample",
+			list: fs.FSComponentList{Components: []fs.FSComponent{
+				{Type: fs.ComponentTypePacketLength, Raw: []byte{0x05, 0x40, 0x93, 0x05, 0xdc}},
+			}},
+			acts: []actions.Action{actions.TrafficAction{Sample: true}},
+			want: []string{
+				`iptables -A FLOWSPEC -m length --length 0:64 -j LOG --log-prefix "flowspec: "`,
+				"iptables -A FLOWSPEC -m length --length 0:64 -j RETURN",
+				`iptables -A FLOWSPEC -m length --length 1500:65535 -j LOG --log-prefix "flowspec: "`,
+				"iptables -A FLOWSPEC -m length --length 1500:65535 -j RETURN",
+			},
+		},
+		{
+			name: "PortWithICMP_Empty",
+			list: fs.FSComponentList{Components: []fs.FSComponent{
+				{Type: fs.ComponentTypeIpProtocol, Raw: []byte{0x81, 0x01}},
+				{Type: fs.ComponentTypeDestinationPort, Raw: []byte{0x81, 0x35}},
+			}},
+			wantErr: ErrEmptyMatch,
+		},
+		{
+			name: "Fragment_Unsupported",
+			list: fs.FSComponentList{Components: []fs.FSComponent{
+				{Type: fs.ComponentTypeFragment, Raw: []byte{0x81, 0x02}},
+			}},
+			wantErr: ErrUnsupportedComponent,
+		},
+		{
+			name: "Expansion_Bounded",
+			list: fs.FSComponentList{Components: []fs.FSComponent{
+				{Type: fs.ComponentTypeIpProtocol, Raw: []byte{0x82, 0x00}},
+				{Type: fs.ComponentTypeDSCP, Raw: []byte{0x82, 0x00}},
+			}},
+			opts:    &Options{MaxRules: 100},
+			wantErr: ErrTooManyRules,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Compile(tt.list, tt.acts, tt.opts)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Compile(%v, %v) error = %v, want %v", tt.list, tt.acts, err, tt.wantErr)
+			}
+			if !slices.Equal(render(got), tt.want) {
+				t.Errorf("Compile(%v, %v) =\n%q\nwant\n%q", tt.list, tt.acts, render(got), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,320 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+// Package nftables compiles FlowSpec rules into nftables rule statements
+// suitable for `nft -f`.
+package nftables
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/actions"
+)
+
+var (
+	ErrUnsupportedComponent = errors.New("nftables: component cannot be expressed as nftables match")
+	ErrEmptyMatch           = fs.ErrEmptyMatch
+	ErrMixedFamilies        = fs.ErrMixedFamilies
+	ErrConflictingActions   = errors.New("nftables: more than one traffic-rate action present")
+)
+
+// Options controls where compiled rules are installed.
+type Options struct {
+	Family string // nftables table family, defaults to "inet"
+	Table  string // defaults to "flowspec"
+	Chain  string // defaults to "filter"
+	// IPv6 selects the address family for rules that carry no prefix component.
+	IPv6 bool
+}
+
+// Fragment bits as per RFC8955 4.2.2.12.
+const (
+	fragDF  = 0x01
+	fragIsF = 0x02
+	fragFF  = 0x04
+	fragLF  = 0x08
+)
+
+// Compile translates list and acts into `add rule` lines. Operator sequences
+// with OR-ed alternatives that nftables cannot express in one rule (bitmask
+// groups, the type 4 port component) are expanded into several rules.
+// Rules must be installed in RFC8955 5.1 order, see flowspecinternal.SortFlowSpecs.
+func Compile(list fs.FSComponentList, acts []actions.Action, opts *Options) ([]string, error) {
+	o := Options{Family: "inet", Table: "flowspec", Chain: "filter"}
+	if opts != nil {
+		o.IPv6 = opts.IPv6
+		if opts.Family != "" {
+			o.Family = opts.Family
+		}
+		if opts.Table != "" {
+			o.Table = opts.Table
+		}
+		if opts.Chain != "" {
+			o.Chain = opts.Chain
+		}
+	}
+
+	ipv6, err := fs.AddressFamily(list, o.IPv6)
+	if err != nil {
+		return nil, err
+	}
+
+	alts := []string{""}
+	for _, c := range list.Components {
+		exprs, err := componentExprs(c, ipv6)
+		if err != nil {
+			return nil, err
+		}
+		if exprs == nil {
+			continue
+		}
+		var next []string
+		for _, a := range alts {
+			for _, e := range exprs {
+				next = append(next, strings.TrimSpace(a+" "+e))
+			}
+		}
+		alts = next
+	}
+
+	stmts, err := actionStmts(acts, ipv6)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := fmt.Sprintf("add rule %s %s %s ", o.Family, o.Table, o.Chain)
+	var out []string
+	for _, a := range alts {
+		for _, s := range stmts {
+			out = append(out, prefix+strings.TrimSpace(a+" "+s))
+		}
+	}
+	return out, nil
+}
+
+func ipKeyword(ipv6 bool) string {
+	if ipv6 {
+		return "ip6"
+	}
+	return "ip"
+}
+
+// componentExprs returns the OR-ed alternatives for c; nil means c does not constrain the packet.
+func componentExprs(c fs.FSComponent, ipv6 bool) ([]string, error) {
+	switch c.Type {
+	case fs.ComponentTypeDestinationPrefix:
+		return []string{fmt.Sprintf("%s daddr %s", ipKeyword(ipv6), c.Prefix.Masked())}, nil
+	case fs.ComponentTypeSourcePrefix:
+		return []string{fmt.Sprintf("%s saddr %s", ipKeyword(ipv6), c.Prefix.Masked())}, nil
+	case fs.ComponentTypeIpProtocol:
+		return numericExprs(c, 0xff, "meta l4proto")
+	case fs.ComponentTypePort:
+		set, err := numericExprs(c, 0xffff, "")
+		if set == nil || err != nil {
+			return nil, err
+		}
+		return []string{"th sport " + set[0], "th dport " + set[0]}, nil
+	case fs.ComponentTypeDestinationPort:
+		return numericExprs(c, 0xffff, "th dport")
+	case fs.ComponentTypeSourcePort:
+		return numericExprs(c, 0xffff, "th sport")
+	case fs.ComponentTypeICMPType:
+		if ipv6 {
+			return numericExprs(c, 0xff, "icmpv6 type")
+		}
+		return numericExprs(c, 0xff, "icmp type")
+	case fs.ComponentTypeICMPCode:
+		if ipv6 {
+			return numericExprs(c, 0xff, "icmpv6 code")
+		}
+		return numericExprs(c, 0xff, "icmp code")
+	case fs.ComponentTypePacketLength:
+		return numericExprs(c, 0xffff, "meta length")
+	case fs.ComponentTypeDSCP:
+		return numericExprs(c, 0x3f, ipKeyword(ipv6)+" dscp")
+	case fs.ComponentTypeTCPFlags:
+		return bitmaskExprs(c.Raw, func(op fs.BitmaskOp) (string, error) {
+			return maskedCompare("tcp flags", op.Value&0xff, op), nil
+		})
+	case fs.ComponentTypeFragment:
+		if ipv6 {
+			return nil, ErrUnsupportedComponent
+		}
+		return bitmaskExprs(c.Raw, fragmentExpr)
+	}
+	return nil, ErrUnsupportedComponent
+}
+
+func numericExprs(c fs.FSComponent, max uint64, key string) ([]string, error) {
+	ranges, err := fs.ComponentRanges(c, max)
+	if err != nil || fs.MatchesAll(ranges, max) {
+		return nil, err
+	}
+	return []string{strings.TrimSpace(key + " " + formatSet(ranges))}, nil
+}
+
+func formatSet(ranges []fs.ValueRange) string {
+	elems := make([]string, 0, len(ranges))
+	for _, r := range ranges {
+		if r.From == r.To {
+			elems = append(elems, fmt.Sprint(r.From))
+		} else {
+			elems = append(elems, fmt.Sprintf("%d-%d", r.From, r.To))
+		}
+	}
+	if len(elems) == 1 {
+		return elems[0]
+	}
+	return "{ " + strings.Join(elems, ", ") + " }"
+}
+
+func bitmaskExprs(raw []byte, term func(fs.BitmaskOp) (string, error)) ([]string, error) {
+	ops, err := fs.ParseBitmaskOps(raw)
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, group := range fs.SplitBitmaskOps(ops) {
+		exprs := make([]string, 0, len(group))
+		for _, op := range group {
+			e, err := term(op)
+			if err != nil {
+				return nil, err
+			}
+			exprs = append(exprs, e)
+		}
+		out = append(out, strings.Join(exprs, " "))
+	}
+	return out, nil
+}
+
+// maskedCompare renders one bitmask term as per RFC8955 4.2.1.2.
+func maskedCompare(key string, v uint64, op fs.BitmaskOp) string {
+	switch {
+	case op.Match && !op.Not:
+		return fmt.Sprintf("%s & 0x%x == 0x%x", key, v, v)
+	case op.Match && op.Not:
+		return fmt.Sprintf("%s & 0x%x != 0x%x", key, v, v)
+	case op.Not:
+		return fmt.Sprintf("%s & 0x%x == 0x0", key, v)
+	}
+	return fmt.Sprintf("%s & 0x%x != 0x0", key, v)
+}
+
+// fragmentExpr maps a single fragment bit onto the IPv4 frag-off field.
+// Terms combining several bits are only supported where the result stays a single conjunction.
+func fragmentExpr(op fs.BitmaskOp) (string, error) {
+	set := func(bit uint64) string {
+		switch bit {
+		case fragDF:
+			return "ip frag-off & 0x4000 != 0x0"
+		case fragIsF:
+			return "ip frag-off & 0x3fff != 0x0"
+		case fragFF:
+			return "ip frag-off & 0x3fff == 0x2000"
+		case fragLF:
+			return "ip frag-off & 0x2000 == 0x0 ip frag-off & 0x1fff != 0x0"
+		}
+		return ""
+	}
+	unset := func(bit uint64) string {
+		switch bit {
+		case fragDF:
+			return "ip frag-off & 0x4000 == 0x0"
+		case fragIsF:
+			return "ip frag-off & 0x3fff == 0x0"
+		case fragFF:
+			return "ip frag-off & 0x3fff != 0x2000"
+		}
+		return ""
+	}
+
+	var bits []uint64
+	for b := uint64(fragDF); b <= fragLF; b <<= 1 {
+		if op.Value&b != 0 {
+			bits = append(bits, b)
+		}
+	}
+	if len(bits) == 0 || op.Value&^0x0f != 0 {
+		return "", ErrUnsupportedComponent
+	}
+	// all bits set (match) and no bit set (not any) are conjunctions, the rest would need expansion
+	conj := op.Match != op.Not || len(bits) == 1
+	if !conj {
+		return "", ErrUnsupportedComponent
+	}
+	negate := op.Not
+	var exprs []string
+	for _, b := range bits {
+		e := set(b)
+		if negate {
+			e = unset(b)
+		}
+		if e == "" {
+			return "", ErrUnsupportedComponent
+		}
+		exprs = append(exprs, e)
+	}
+	return strings.Join(exprs, " "), nil
+}
+
+// actionStmts returns the statement lists to append to the match, one rule each.
+func actionStmts(acts []actions.Action, ipv6 bool) ([]string, error) {
+	var (
+		stmts []string
+		limit string
+		drop  bool
+		stop  = true
+		rates int
+	)
+	stmts = append(stmts, "counter")
+	for _, a := range acts {
+		switch v := a.(type) {
+		case actions.TrafficRateBytes:
+			rates++
+			if v.Rate == 0 {
+				drop = true
+			} else {
+				limit = fmt.Sprintf("limit rate over %d bytes/second drop", uint64(v.Rate))
+			}
+		case actions.TrafficRatePackets:
+			rates++
+			if v.Rate == 0 {
+				drop = true
+			} else {
+				limit = fmt.Sprintf("limit rate over %d/second drop", uint64(v.Rate))
+			}
+		case actions.TrafficAction:
+			if v.Sample {
+				stmts = append(stmts, `log prefix "flowspec: "`)
+			}
+			stop = !v.Terminal
+		case actions.TrafficMarking:
+			stmts = append(stmts, fmt.Sprintf("%s dscp set %d", ipKeyword(ipv6), v.DSCP&0x3f))
+		case actions.Redirect:
+			// no VRFs in nftables, hand the local administrator to policy routing instead
+			stmts = append(stmts, fmt.Sprintf("meta mark set %d", v.Value))
+		}
+	}
+	if rates > 1 {
+		return nil, ErrConflictingActions
+	}
+
+	switch {
+	case drop:
+		return []string{strings.Join(append(stmts, "drop"), " ")}, nil
+	case limit != "":
+		out := []string{strings.Join(append(stmts, limit), " ")}
+		if stop {
+			out = append(out, "accept")
+		}
+		return out, nil
+	case stop:
+		return []string{strings.Join(append(stmts, "accept"), " ")}, nil
+	}
+	return []string{strings.Join(stmts, " ")}, nil
+}
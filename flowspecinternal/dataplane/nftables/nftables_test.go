@@ -0,0 +1,121 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package nftables
+
+import (
+	"errors"
+	"net/netip"
+	"slices"
+	"testing"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/actions"
+)
+
+func prefix(s string) *netip.Prefix {
+	p := netip.MustParsePrefix(s)
+	return &p
+}
+
+func TestCompile(t *testing.T) {
+	tests := []struct {
+		name    string
+		list    fs.FSComponentList
+		acts    []actions.Action
+		want    []string
+		wantErr error
+	}{
+		{
+			name: "DstProtoPorts_Discard",
+			list: fs.FSComponentList{Components: []fs.FSComponent{
+				{Type: fs.ComponentTypeDestinationPrefix, Prefix: prefix("192.0.2.0/24")},
+				{Type: fs.ComponentTypeIpProtocol, Raw: []byte{0x81, 0x11}},
+				{Type: fs.ComponentTypeDestinationPort, Raw: []byte{0x01, 0x35, 0x81, 0x7b}},
+			}},
+			acts: []actions.Action{actions.TrafficRateBytes{Rate: 0}},
+			want: []string{
+				"add rule inet flowspec filter ip daddr 192.0.2.0/24 meta l4proto 17 th dport { 53, 123 } counter drop",
+			},
+		},
+		{
+			name: "PortComponent_ExpandsToSrcAndDst",
+			list: fs.FSComponentList{Components: []fs.FSComponent{
+				{Type: fs.ComponentTypeDestinationPrefix, Prefix: prefix("2001:db8::/32")},
+				{Type: fs.ComponentTypePort, Raw: []byte{0x91, 0x01, 0xbb}},
+			}},
+			want: []string{
+				"add rule inet flowspec filter ip6 daddr 2001:db8::/32 th sport 443 counter accept",
+				"add rule inet flowspec filter ip6 daddr 2001:db8::/32 th dport 443 counter accept",
+			},
+		},
+		{
+			name: "RateLimit_TerminalUnset_AddsAccept",
+			list: fs.FSComponentList{Components: []fs.FSComponent{
+				{Type: fs.ComponentTypeDestinationPrefix, Prefix: prefix("192.0.2.0/24")},
+				{Type: fs.ComponentTypePacketLength, Raw: []byte{0x13, 0x04, 0x00, 0xd5, 0x08, 0x00}},
+			}},
+			acts: []actions.Action{actions.TrafficRateBytes{Rate: 125000}, actions.TrafficMarking{DSCP: 10}},
+			want: []string{
+				"add rule inet flowspec filter ip daddr 192.0.2.0/24 meta length 1024-2048 counter ip dscp set 10 limit rate over 125000 bytes/second drop",
+				"add rule inet flowspec filter ip daddr 192.0.2.0/24 meta length 1024-2048 accept",
+			},
+		},
+		{
+			name: "TCPFlags_OrGroups_Expand",
+			list: fs.FSComponentList{Components: []fs.FSComponent{
+				{Type: fs.ComponentTypeTCPFlags, Raw: []byte{0x01, 0x02, 0x41, 0x10, 0x81, 0x04}},
+			}},
+			acts: []actions.Action{actions.TrafficAction{Terminal: true}},
+			want: []string{
+				"add rule inet flowspec filter tcp flags & 0x2 == 0x2 tcp flags & 0x10 == 0x10 counter",
+				"add rule inet flowspec filter tcp flags & 0x4 == 0x4 counter",
+			},
+		},
+		{
+			name: "Fragment_DontFragmentNotSet",
+			list: fs.FSComponentList{Components: []fs.FSComponent{
+				{Type: fs.ComponentTypeFragment, Raw: []byte{0x83, 0x01}},
+			}},
+			want: []string{
+				"add rule inet flowspec filter ip frag-off & 0x4000 == 0x0 counter accept",
+			},
+		},
+		{
+			name: "EmptyMatch",
+			list: fs.FSComponentList{Components: []fs.FSComponent{
+				{Type: fs.ComponentTypeIpProtocol, Raw: []byte{0x01, 0x06, 0xc1, 0x11}},
+			}},
+			wantErr: ErrEmptyMatch,
+		},
+		{
+			name: "MixedFamilies",
+			list: fs.FSComponentList{Components: []fs.FSComponent{
+				{Type: fs.ComponentTypeDestinationPrefix, Prefix: prefix("192.0.2.0/24")},
+				{Type: fs.ComponentTypeSourcePrefix, Prefix: prefix("2001:db8::/32")},
+			}},
+			wantErr: ErrMixedFamilies,
+		},
+		{
+			name: "TwoRates_Conflict",
+			list: fs.FSComponentList{Components: []fs.FSComponent{
+				{Type: fs.ComponentTypeDestinationPrefix, Prefix: prefix("192.0.2.0/24")},
+			}},
+			acts:    []actions.Action{actions.TrafficRateBytes{Rate: 10}, actions.TrafficRatePackets{Rate: 10}},
+			wantErr: ErrConflictingActions,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Compile(tt.list, tt.acts, nil)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Compile(%v, %v) error = %v, want %v", tt.list, tt.acts, err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Compile(%v, %v) =\n%q\nwant\n%q", tt.list, tt.acts, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,459 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+// Package tcflower compiles FlowSpec rules into `tc filter add ... flower` commands,
+// which capable NICs can offload to hardware.
+//
+// flower matches single values, masks or port ranges, so OR-ed operator
+// sequences are expanded into several filters sharing one priority. Packet
+// length components cannot be matched by flower and are rejected.
+package tcflower
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/actions"
+)
+
+var (
+	ErrUnsupportedComponent = errors.New("tcflower: component cannot be expressed as flower match")
+	ErrUnsupportedAction    = errors.New("tcflower: redirect target has no device in Options.RedirectDevs")
+	ErrEmptyMatch           = fs.ErrEmptyMatch
+	ErrMixedFamilies        = fs.ErrMixedFamilies
+	ErrConflictingActions   = errors.New("tcflower: more than one traffic-rate action present")
+	ErrTooManyFilters       = errors.New("tcflower: rule expansion exceeds Options.MaxFilters")
+)
+
+// Protocol numbers with flower keywords.
+const (
+	protoICMP   = 1
+	protoTCP    = 6
+	protoUDP    = 17
+	protoICMPv6 = 58
+	protoSCTP   = 132
+)
+
+// Fragment bits as per RFC8955 4.2.2.12.
+const (
+	fragIsF = 0x02
+	fragFF  = 0x04
+)
+
+// Options controls where compiled filters are attached.
+type Options struct {
+	Dev    string // defaults to "eth0"
+	Parent string // defaults to "ingress"
+	// Prio orders filters; assign increasing values in RFC8955 5.1 order. Defaults to 1.
+	Prio int
+	// IPv6 selects the address family for rules that carry no prefix component.
+	IPv6 bool
+	// SkipSW requests hardware-only filters.
+	SkipSW bool
+	// RedirectDevs maps a redirect action, in its String() form without the
+	// "redirect " keyword (e.g. "65000:100"), to the egress device for mirred.
+	RedirectDevs map[string]string
+	// MaxFilters bounds the expansion of one rule, defaults to 256.
+	MaxFilters int
+}
+
+// Filter is one tc invocation.
+type Filter struct {
+	Args []string
+}
+
+// String renders f as a shell command line.
+func (f Filter) String() string {
+	return "tc " + strings.Join(f.Args, " ")
+}
+
+// match is one flower key alternative.
+type match struct {
+	args []string
+}
+
+// Compile translates list and acts into flower filters.
+func Compile(list fs.FSComponentList, acts []actions.Action, opts *Options) ([]Filter, error) {
+	o := Options{Dev: "eth0", Parent: "ingress", Prio: 1, MaxFilters: 256}
+	if opts != nil {
+		o.IPv6, o.SkipSW, o.RedirectDevs = opts.IPv6, opts.SkipSW, opts.RedirectDevs
+		if opts.Dev != "" {
+			o.Dev = opts.Dev
+		}
+		if opts.Parent != "" {
+			o.Parent = opts.Parent
+		}
+		if opts.Prio > 0 {
+			o.Prio = opts.Prio
+		}
+		if opts.MaxFilters > 0 {
+			o.MaxFilters = opts.MaxFilters
+		}
+	}
+
+	ipv6, err := fs.AddressFamily(list, o.IPv6)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := compileKeys(list, ipv6, o.MaxFilters)
+	if err != nil {
+		return nil, err
+	}
+	acting, err := compileActions(acts, ipv6, o)
+	if err != nil {
+		return nil, err
+	}
+
+	protocol := "ip"
+	if ipv6 {
+		protocol = "ipv6"
+	}
+	head := []string{"filter", "add", "dev", o.Dev, o.Parent, "protocol", protocol, "prio", strconv.Itoa(o.Prio), "flower"}
+	if o.SkipSW {
+		head = append(head, "skip_sw")
+	}
+	var out []Filter
+	for _, k := range keys {
+		args := append(append([]string{}, head...), k...)
+		out = append(out, Filter{Args: append(args, acting...)})
+	}
+	return out, nil
+}
+
+func protoKeyword(p uint64) string {
+	switch p {
+	case protoTCP:
+		return "tcp"
+	case protoUDP:
+		return "udp"
+	case protoSCTP:
+		return "sctp"
+	case protoICMP:
+		return "icmp"
+	case protoICMPv6:
+		return "icmpv6"
+	}
+	return strconv.FormatUint(p, 10)
+}
+
+// compileKeys returns the flower key alternatives of list.
+func compileKeys(list fs.FSComponentList, ipv6 bool, limit int) ([][]string, error) {
+	var (
+		fixed  []string
+		protos []uint64 // nil: any
+		alts   [][]match
+		needs  [][]uint64
+	)
+	for _, c := range list.Components {
+		switch c.Type {
+		case fs.ComponentTypeDestinationPrefix:
+			fixed = append(fixed, "dst_ip", c.Prefix.Masked().String())
+		case fs.ComponentTypeSourcePrefix:
+			fixed = append(fixed, "src_ip", c.Prefix.Masked().String())
+		case fs.ComponentTypeIpProtocol:
+			ranges, err := fs.ComponentRanges(c, 0xff)
+			if err != nil {
+				return nil, err
+			}
+			if fs.MatchesAll(ranges, 0xff) {
+				continue
+			}
+			for _, r := range ranges {
+				for v := r.From; v <= r.To; v++ {
+					protos = append(protos, v)
+				}
+			}
+		case fs.ComponentTypePort, fs.ComponentTypeDestinationPort, fs.ComponentTypeSourcePort:
+			ranges, err := fs.ComponentRanges(c, 0xffff)
+			if err != nil {
+				return nil, err
+			}
+			if fs.MatchesAll(ranges, 0xffff) {
+				continue
+			}
+			keys := map[fs.ComponentType][]string{
+				fs.ComponentTypePort:            {"src_port", "dst_port"},
+				fs.ComponentTypeDestinationPort: {"dst_port"},
+				fs.ComponentTypeSourcePort:      {"src_port"},
+			}[c.Type]
+			var ms []match
+			for _, key := range keys {
+				for _, r := range ranges {
+					ms = append(ms, match{args: []string{key, formatRange(r)}})
+				}
+			}
+			alts = append(alts, ms)
+			needs = append(needs, []uint64{protoTCP, protoUDP, protoSCTP})
+		case fs.ComponentTypeICMPType, fs.ComponentTypeICMPCode:
+			ranges, err := fs.ComponentRanges(c, 0xff)
+			if err != nil {
+				return nil, err
+			}
+			if fs.MatchesAll(ranges, 0xff) {
+				continue
+			}
+			key := "type"
+			if c.Type == fs.ComponentTypeICMPCode {
+				key = "code"
+			}
+			var ms []match
+			for _, r := range ranges {
+				for v := r.From; v <= r.To; v++ {
+					ms = append(ms, match{args: []string{key, strconv.FormatUint(v, 10)}})
+				}
+			}
+			alts = append(alts, ms)
+			if ipv6 {
+				needs = append(needs, []uint64{protoICMPv6})
+			} else {
+				needs = append(needs, []uint64{protoICMP})
+			}
+		case fs.ComponentTypeDSCP:
+			ranges, err := fs.ComponentRanges(c, 0x3f)
+			if err != nil {
+				return nil, err
+			}
+			if fs.MatchesAll(ranges, 0x3f) {
+				continue
+			}
+			var ms []match
+			for _, r := range ranges {
+				for v := r.From; v <= r.To; v++ {
+					ms = append(ms, match{args: []string{"ip_tos", fmt.Sprintf("0x%x/0xfc", v<<2)}})
+				}
+			}
+			alts = append(alts, ms)
+		case fs.ComponentTypeTCPFlags:
+			ms, err := tcpFlagMatches(c)
+			if err != nil {
+				return nil, err
+			}
+			alts = append(alts, ms)
+			needs = append(needs, []uint64{protoTCP})
+		case fs.ComponentTypeFragment:
+			ms, err := fragmentMatches(c)
+			if err != nil {
+				return nil, err
+			}
+			alts = append(alts, ms)
+		default:
+			return nil, ErrUnsupportedComponent
+		}
+	}
+
+	// resolve the protocol: flower needs ip_proto for port, icmp and flag keys
+	for _, n := range needs {
+		if protos == nil {
+			// ports without a protocol component are matched for tcp and udp only
+			protos = intersect(n, []uint64{protoTCP, protoUDP, protoICMP, protoICMPv6})
+			continue
+		}
+		protos = intersect(protos, n)
+	}
+	if protos != nil && len(protos) == 0 {
+		return nil, ErrEmptyMatch
+	}
+
+	acc := [][]string{fixed}
+	if protos != nil {
+		var ms []match
+		for _, p := range protos {
+			ms = append(ms, match{args: []string{"ip_proto", protoKeyword(p)}})
+		}
+		alts = append([][]match{ms}, alts...)
+	}
+	for _, ms := range alts {
+		var next [][]string
+		for _, a := range acc {
+			for _, m := range ms {
+				next = append(next, append(append([]string{}, a...), m.args...))
+				if len(next) > limit {
+					return nil, ErrTooManyFilters
+				}
+			}
+		}
+		acc = next
+	}
+	return acc, nil
+}
+
+func intersect(a, b []uint64) []uint64 {
+	out := []uint64{}
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				out = append(out, x)
+			}
+		}
+	}
+	return out
+}
+
+func formatRange(r fs.ValueRange) string {
+	if r.From == r.To {
+		return strconv.FormatUint(r.From, 10)
+	}
+	return fmt.Sprintf("%d-%d", r.From, r.To)
+}
+
+// valMask is a flower "VALUE/MASK" key: (field & mask) == val.
+type valMask struct{ val, mask uint64 }
+
+// merge ANDs two keys; ok is false when they contradict.
+func (a valMask) merge(b valMask) (valMask, bool) {
+	common := a.mask & b.mask
+	if a.val&common != b.val&common {
+		return valMask{}, false
+	}
+	return valMask{val: a.val | b.val, mask: a.mask | b.mask}, true
+}
+
+// termKeys expresses one RFC8955 4.2.1.2 bitmask term as OR-ed value/mask keys.
+func termKeys(op fs.BitmaskOp) []valMask {
+	v := op.Value
+	var out []valMask
+	switch {
+	case op.Match && !op.Not: // all bits set
+		out = append(out, valMask{val: v, mask: v})
+	case !op.Match && op.Not: // no bit set
+		out = append(out, valMask{val: 0, mask: v})
+	case op.Match && op.Not: // not all bits set: some bit clear
+		for b := uint64(1); b <= v; b <<= 1 {
+			if v&b != 0 {
+				out = append(out, valMask{val: 0, mask: b})
+			}
+		}
+	default: // any bit set
+		for b := uint64(1); b <= v; b <<= 1 {
+			if v&b != 0 {
+				out = append(out, valMask{val: b, mask: b})
+			}
+		}
+	}
+	return out
+}
+
+func bitmaskKeys(raw []byte) ([]valMask, error) {
+	ops, err := fs.ParseBitmaskOps(raw)
+	if err != nil {
+		return nil, err
+	}
+	var out []valMask
+	for _, group := range fs.SplitBitmaskOps(ops) {
+		acc := []valMask{{}}
+		for _, op := range group {
+			var next []valMask
+			for _, a := range acc {
+				for _, k := range termKeys(op) {
+					if m, ok := a.merge(k); ok {
+						next = append(next, m)
+					}
+				}
+			}
+			acc = next
+		}
+		out = append(out, acc...)
+	}
+	if len(out) == 0 {
+		return nil, ErrEmptyMatch
+	}
+	return out, nil
+}
+
+func tcpFlagMatches(c fs.FSComponent) ([]match, error) {
+	keys, err := bitmaskKeys(c.Raw)
+	if err != nil {
+		return nil, err
+	}
+	var out []match
+	for _, k := range keys {
+		out = append(out, match{args: []string{"tcp_flags", fmt.Sprintf("0x%x/0x%x", k.val, k.mask)}})
+	}
+	return out, nil
+}
+
+// fragmentMatches maps IsF and FF onto flower's frag and firstfrag ip_flags.
+func fragmentMatches(c fs.FSComponent) ([]match, error) {
+	keys, err := bitmaskKeys(c.Raw)
+	if err != nil {
+		return nil, err
+	}
+	var out []match
+	for _, k := range keys {
+		if k.mask&^(fragIsF|fragFF) != 0 {
+			return nil, ErrUnsupportedComponent
+		}
+		var flags []string
+		if k.mask&fragIsF != 0 {
+			flags = append(flags, map[bool]string{true: "frag", false: "nofrag"}[k.val&fragIsF != 0])
+		}
+		if k.mask&fragFF != 0 {
+			flags = append(flags, map[bool]string{true: "firstfrag", false: "nofirstfrag"}[k.val&fragFF != 0])
+		}
+		out = append(out, match{args: []string{"ip_flags", strings.Join(flags, "/")}})
+	}
+	return out, nil
+}
+
+// compileActions renders acts as a flower action list.
+func compileActions(acts []actions.Action, ipv6 bool, o Options) ([]string, error) {
+	var (
+		out   []string
+		tail  []string
+		stop  = true
+		rates int
+	)
+	for _, a := range acts {
+		switch v := a.(type) {
+		case actions.TrafficRateBytes:
+			rates++
+			if v.Rate != 0 {
+				bits := uint64(v.Rate) * 8
+				out = append(out, "action", "police", "rate", fmt.Sprintf("%dbit", bits),
+					"burst", strconv.FormatUint(max(uint64(v.Rate)/10, 1500), 10), "conform-exceed", "drop/pipe")
+			}
+		case actions.TrafficRatePackets:
+			rates++
+			if v.Rate != 0 {
+				out = append(out, "action", "police", "pkts_rate", strconv.FormatUint(uint64(v.Rate), 10),
+					"pkts_burst", strconv.FormatUint(max(uint64(v.Rate)/10, 1), 10), "conform-exceed", "drop/pipe")
+			}
+		case actions.TrafficAction:
+			stop = !v.Terminal
+		case actions.TrafficMarking:
+			field := "ip dsfield"
+			if ipv6 {
+				field = "ip6 traffic_class"
+			}
+			out = append(out, "action", "pedit", "ex", "munge")
+			out = append(out, strings.Fields(field)...)
+			out = append(out, "set", strconv.Itoa(int(v.DSCP&0x3f)<<2), "retain", "0xfc", "pipe")
+			if !ipv6 {
+				out = append(out, "action", "csum", "ip", "pipe")
+			}
+		case actions.Redirect:
+			dev, ok := o.RedirectDevs[strings.TrimPrefix(v.String(), "redirect ")]
+			if !ok {
+				return nil, ErrUnsupportedAction
+			}
+			tail = []string{"action", "mirred", "egress", "redirect", "dev", dev}
+		}
+		if actions.IsDiscard(a) {
+			tail = []string{"action", "drop"}
+		}
+	}
+	if rates > 1 {
+		return nil, ErrConflictingActions
+	}
+	if tail != nil {
+		return append(out, tail...), nil
+	}
+	if stop {
+		return append(out, "action", "pass"), nil
+	}
+	return append(out, "action", "continue"), nil
+}
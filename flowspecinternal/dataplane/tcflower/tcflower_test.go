@@ -0,0 +1,149 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package tcflower
+
+import (
+	"errors"
+	"net/netip"
+	"slices"
+	"testing"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/actions"
+)
+
+func prefix(s string) *netip.Prefix {
+	p := netip.MustParsePrefix(s)
+	return &p
+}
+
+func TestCompile(t *testing.T) {
+	tests := []struct {
+		name    string
+		list    fs.FSComponentList
+		acts    []actions.Action
+		opts    *Options
+		want    []string
+		wantErr error
+	}{
+		{
+			name: "DstProtoPorts_Discard",
+			list: fs.FSComponentList{Components: []fs.FSComponent{
+				{Type: fs.ComponentTypeDestinationPrefix, Prefix: prefix("192.0.2.0/24")},
+				{Type: fs.ComponentTypeIpProtocol, Raw: []byte{0x81, 0x11}},
+				{Type: fs.ComponentTypeDestinationPort, Raw: []byte{0x01, 0x35, 0x81, 0x7b}},
+			}},
+			acts: []actions.Action{actions.TrafficRateBytes{Rate: 0}},
+			want: []string{
+				"tc filter add dev eth0 ingress protocol ip prio 1 flower dst_ip 192.0.2.0/24 ip_proto udp dst_port 53 action drop",
+				"tc filter add dev eth0 ingress protocol ip prio 1 flower dst_ip 192.0.2.0/24 ip_proto udp dst_port 123 action drop",
+			},
+		},
+		{
+			name: "PortRange_NoProto_TCPAndUDP",
+			list: fs.FSComponentList{Components: []fs.FSComponent{
+				{Type: fs.ComponentTypeDestinationPrefix, Prefix: prefix("2001:db8::/32")},
+				{Type: fs.ComponentTypeSourcePort, Raw: []byte{0x53, 0x04, 0x00, 0xd5, 0x08, 0x00}},
+			}},
+			opts: &Options{Dev: "ens1f0", Prio: 10, SkipSW: true},
+			want: []string{
+				"tc filter add dev ens1f0 ingress protocol ipv6 prio 10 flower skip_sw dst_ip 2001:db8::/32 ip_proto tcp src_port 1024-2048 action pass",
+				"tc filter add dev ens1f0 ingress protocol ipv6 prio 10 flower skip_sw dst_ip 2001:db8::/32 ip_proto udp src_port 1024-2048 action pass",
+			},
+		},
+		{
+			name: "Police_TerminalUnset_Continue",
+			list: fs.FSComponentList{Components: []fs.FSComponent{
+				{Type: fs.ComponentTypeDestinationPrefix, Prefix: prefix("192.0.2.0/24")},
+				{Type: fs.ComponentTypeDSCP, Raw: []byte{0x81, 0x2e}},
+			}},
+			acts: []actions.Action{actions.TrafficRateBytes{Rate: 125000}, actions.TrafficAction{Terminal: true}},
+			want: []string{
+				"tc filter add dev eth0 ingress protocol ip prio 1 flower dst_ip 192.0.2.0/24 ip_tos 0xb8/0xfc " +
+					"action police rate 1000000bit burst 12500 conform-exceed drop/pipe action continue",
+			},
+		},
+		{
+			name: "TCPFlags_AnyOf_Mirred",
+			list: fs.FSComponentList{Components: []fs.FSComponent{
+				{Type: fs.ComponentTypeDestinationPrefix, Prefix: prefix("192.0.2.1/32")},
+				{Type: fs.ComponentTypeTCPFlags, Raw: []byte{0x80, 0x06}},
+			}},
+			acts: []actions.Action{actions.Redirect{Variant: actions.TypeRedirectAS2, AS: 65000, Value: 100}},
+			opts: &Options{RedirectDevs: map[string]string{"65000:100": "scrub0"}},
+			want: []string{
+				"tc filter add dev eth0 ingress protocol ip prio 1 flower dst_ip 192.0.2.1/32 ip_proto tcp tcp_flags 0x2/0x2 action mirred egress redirect dev scrub0",
+				"tc filter add dev eth0 ingress protocol ip prio 1 flower dst_ip 192.0.2.1/32 ip_proto tcp tcp_flags 0x4/0x4 action mirred egress redirect dev scrub0",
+			},
+		},
+		{
+			name: "Fragment_FirstFrag",
+			list: fs.FSComponentList{Components: []fs.FSComponent{
+				{Type: fs.ComponentTypeFragment, Raw: []byte{0x81, 0x06}},
+			}},
+			acts: []actions.Action{actions.TrafficMarking{DSCP: 10}},
+			want: []string{
+				"tc filter add dev eth0 ingress protocol ip prio 1 flower ip_flags frag/firstfrag " +
+					"action pedit ex munge ip dsfield set 40 retain 0xfc pipe action csum ip pipe action pass",
+			},
+		},
+		{
+			name: "PacketLength_Unsupported",
+			list: fs.FSComponentList{Components: []fs.FSComponent{
+				{Type: fs.ComponentTypePacketLength, Raw: []byte{0x81, 0x40}},
+			}},
+			wantErr: ErrUnsupportedComponent,
+		},
+		{
+			name: "Redirect_NoDevice",
+			list: fs.FSComponentList{Components: []fs.FSComponent{
+				{Type: fs.ComponentTypeDestinationPrefix, Prefix: prefix("192.0.2.0/24")},
+			}},
+			acts:    []actions.Action{actions.Redirect{Variant: actions.TypeRedirectAS2, AS: 65000, Value: 1}},
+			wantErr: ErrUnsupportedAction,
+		},
+		{
+			name: "ICMPTypeWithUDP_Empty",
+			list: fs.FSComponentList{Components: []fs.FSComponent{
+				{Type: fs.ComponentTypeIpProtocol, Raw: []byte{0x81, 0x11}},
+				{Type: fs.ComponentTypeICMPType, Raw: []byte{0x81, 0x08}},
+			}},
+			wantErr: ErrEmptyMatch,
+		},
+		{
+			name: "TwoRates_Conflict",
+			list: fs.FSComponentList{Components: []fs.FSComponent{
+				{Type: fs.ComponentTypeDestinationPrefix, Prefix: prefix("192.0.2.0/24")},
+			}},
+			acts:    []actions.Action{actions.TrafficRateBytes{Rate: 1000}, actions.TrafficRatePackets{Rate: 10}},
+			wantErr: ErrConflictingActions,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filters, err := Compile(tt.list, tt.acts, tt.opts)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Compile() error = %v, want %v", err, tt.wantErr)
+			}
+			var got []string
+			for _, f := range filters {
+				got = append(got, f.String())
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Compile() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileTooManyFilters(t *testing.T) {
+	list := fs.FSComponentList{Components: []fs.FSComponent{
+		{Type: fs.ComponentTypeICMPType, Raw: []byte{0x84, 0x10}},
+		{Type: fs.ComponentTypeDSCP, Raw: []byte{0x86, 0x20}},
+	}}
+	if _, err := Compile(list, nil, &Options{MaxFilters: 64}); !errors.Is(err, ErrTooManyFilters) {
+		t.Errorf("Compile() error = %v, want %v", err, ErrTooManyFilters)
+	}
+}
@@ -0,0 +1,354 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+//
+// Generic map-driven FlowSpec classifier for XDP.
+//
+// The rules map holds fs_rule entries in RFC8955 5.1 order, keys 0..count-1,
+// as produced by the Go package floofspectools/flowspecinternal/dataplane/xdp.
+// The first matching rule is applied; evaluation continues with later rules
+// only when its terminal flag is set (RFC8955 7.3 T bit).
+//
+// Build: clang -O2 -g -target bpf -c xdp_flowspec.c -o xdp_flowspec.o
+
+#include <linux/bpf.h>
+#include <linux/if_ether.h>
+#include <linux/ip.h>
+#include <linux/ipv6.h>
+#include <linux/in.h>
+#include <linux/tcp.h>
+#include <linux/udp.h>
+#include <linux/icmp.h>
+
+#define SEC(name) __attribute__((section(name), used))
+#define __uint(name, val) int (*name)[val]
+#define __type(name, val) typeof(val) *name
+
+static void *(*bpf_map_lookup_elem)(void *map, const void *key) = (void *)BPF_FUNC_map_lookup_elem;
+static long (*bpf_map_update_elem)(void *map, const void *key, const void *value, __u64 flags) = (void *)BPF_FUNC_map_update_elem;
+static __u64 (*bpf_ktime_get_ns)(void) = (void *)BPF_FUNC_ktime_get_ns;
+
+#define FS_MAX_RULES 1024
+#define FS_MAX_TERMS 8
+#define FS_NUM_COMPS 10 /* component types 3..12 */
+
+#define FS_OP_AND   0x40
+#define FS_OP_LT    0x04
+#define FS_OP_GT    0x02
+#define FS_OP_EQ    0x01
+#define FS_OP_NOT   0x02
+#define FS_OP_MATCH 0x01
+
+enum {
+	FS_ACT_PASS       = 0,
+	FS_ACT_DROP       = 1,
+	FS_ACT_RATE_BYTES = 2,
+	FS_ACT_RATE_PKTS  = 3,
+};
+
+struct fs_term {
+	__u32 value;
+	__u8 op;
+	__u8 pad[3];
+};
+
+struct fs_comp {
+	__u8 nterms;
+	__u8 pad[3];
+	struct fs_term terms[FS_MAX_TERMS];
+};
+
+struct fs_rule {
+	__u64 id;
+	__u32 present; /* bit n set: component type n present */
+	__u8 family;   /* 4, 6 or 0 for rules without prefix components */
+	__u8 dst_len;
+	__u8 src_len;
+	__u8 action;
+	__u8 dst[16];
+	__u8 src[16];
+	__u32 rate; /* per CPU, bytes or packets per second */
+	__u8 mark_dscp; /* 0xff: no marking */
+	__u8 terminal;
+	__u8 pad[2];
+	struct fs_comp comps[FS_NUM_COMPS];
+};
+
+struct fs_counter {
+	__u64 packets;
+	__u64 bytes;
+};
+
+struct fs_bucket {
+	__u64 tokens;
+	__u64 last_ns;
+};
+
+struct {
+	__uint(type, BPF_MAP_TYPE_ARRAY);
+	__uint(max_entries, FS_MAX_RULES);
+	__type(key, __u32);
+	__type(value, struct fs_rule);
+} fs_rules SEC(".maps");
+
+/* key 0: number of valid entries in fs_rules */
+struct {
+	__uint(type, BPF_MAP_TYPE_ARRAY);
+	__uint(max_entries, 1);
+	__type(key, __u32);
+	__type(value, __u32);
+} fs_count SEC(".maps");
+
+struct {
+	__uint(type, BPF_MAP_TYPE_PERCPU_HASH);
+	__uint(max_entries, FS_MAX_RULES);
+	__type(key, __u64);
+	__type(value, struct fs_counter);
+} fs_counters SEC(".maps");
+
+struct {
+	__uint(type, BPF_MAP_TYPE_PERCPU_HASH);
+	__uint(max_entries, FS_MAX_RULES);
+	__type(key, __u64);
+	__type(value, struct fs_bucket);
+} fs_buckets SEC(".maps");
+
+struct pkt {
+	__u8 family;
+	__u8 proto;
+	__u8 dscp;
+	__u8 frag; /* RFC8955 4.2.2.12 bits */
+	__u8 dst[16];
+	__u8 src[16];
+	__u32 sport;
+	__u32 dport;
+	__u32 icmp_type;
+	__u32 icmp_code;
+	__u32 tcp_flags;
+	__u32 length;
+	int has_ports;
+	int has_icmp;
+	int has_tcp;
+};
+
+static __always_inline int term_numeric(const struct fs_term *t, __u32 v)
+{
+	return ((t->op & FS_OP_LT) && v < t->value) ||
+	       ((t->op & FS_OP_GT) && v > t->value) ||
+	       ((t->op & FS_OP_EQ) && v == t->value);
+}
+
+static __always_inline int term_bitmask(const struct fs_term *t, __u32 v)
+{
+	int r;
+	if (t->op & FS_OP_MATCH)
+		r = (v & t->value) == t->value;
+	else
+		r = (v & t->value) != 0;
+	return (t->op & FS_OP_NOT) ? !r : r;
+}
+
+/* eval applies RFC8955 4.2.1 semantics: AND binds tighter than OR. */
+static __always_inline int eval(const struct fs_comp *c, __u32 v, int bitmask)
+{
+	int result = 0, cur = 1;
+#pragma unroll
+	for (int i = 0; i < FS_MAX_TERMS; i++) {
+		if (i >= c->nterms)
+			break;
+		const struct fs_term *t = &c->terms[i];
+		if (i > 0 && !(t->op & FS_OP_AND)) {
+			result |= cur;
+			cur = 1;
+		}
+		cur &= bitmask ? term_bitmask(t, v) : term_numeric(t, v);
+	}
+	return result | cur;
+}
+
+static __always_inline int prefix_match(const __u8 *want, __u8 len, const __u8 *addr)
+{
+#pragma unroll
+	for (int i = 0; i < 16; i++) {
+		if (len == 0)
+			return 1;
+		__u8 mask = len >= 8 ? 0xff : (__u8)(0xff << (8 - len));
+		if ((addr[i] & mask) != (want[i] & mask))
+			return 0;
+		len = len >= 8 ? len - 8 : 0;
+	}
+	return 1;
+}
+
+static __always_inline int rule_match(const struct fs_rule *r, const struct pkt *p)
+{
+	if (r->family && r->family != p->family)
+		return 0;
+	if ((r->present & (1 << 1)) && !prefix_match(r->dst, r->dst_len, p->dst))
+		return 0;
+	if ((r->present & (1 << 2)) && !prefix_match(r->src, r->src_len, p->src))
+		return 0;
+	if ((r->present & (1 << 3)) && !eval(&r->comps[0], p->proto, 0))
+		return 0;
+	if (r->present & (1 << 4)) {
+		if (!p->has_ports)
+			return 0;
+		if (!eval(&r->comps[1], p->sport, 0) && !eval(&r->comps[1], p->dport, 0))
+			return 0;
+	}
+	if ((r->present & (1 << 5)) && (!p->has_ports || !eval(&r->comps[2], p->dport, 0)))
+		return 0;
+	if ((r->present & (1 << 6)) && (!p->has_ports || !eval(&r->comps[3], p->sport, 0)))
+		return 0;
+	if ((r->present & (1 << 7)) && (!p->has_icmp || !eval(&r->comps[4], p->icmp_type, 0)))
+		return 0;
+	if ((r->present & (1 << 8)) && (!p->has_icmp || !eval(&r->comps[5], p->icmp_code, 0)))
+		return 0;
+	if ((r->present & (1 << 9)) && (!p->has_tcp || !eval(&r->comps[6], p->tcp_flags, 1)))
+		return 0;
+	if ((r->present & (1 << 10)) && !eval(&r->comps[7], p->length, 0))
+		return 0;
+	if ((r->present & (1 << 11)) && !eval(&r->comps[8], p->dscp, 0))
+		return 0;
+	if ((r->present & (1 << 12)) && !eval(&r->comps[9], p->frag, 1))
+		return 0;
+	return 1;
+}
+
+static __always_inline int parse(struct xdp_md *ctx, struct pkt *p)
+{
+	void *data = (void *)(long)ctx->data;
+	void *end = (void *)(long)ctx->data_end;
+	struct ethhdr *eth = data;
+	void *l4;
+
+	if ((void *)(eth + 1) > end)
+		return -1;
+	if (eth->h_proto == __builtin_bswap16(ETH_P_IP)) {
+		struct iphdr *ip = (void *)(eth + 1);
+		if ((void *)(ip + 1) > end)
+			return -1;
+		__u16 off = __builtin_bswap16(ip->frag_off);
+		p->family = 4;
+		p->proto = ip->protocol;
+		p->dscp = ip->tos >> 2;
+		p->length = __builtin_bswap16(ip->tot_len);
+		__builtin_memcpy(p->dst, &ip->daddr, 4);
+		__builtin_memcpy(p->src, &ip->saddr, 4);
+		if (off & 0x4000)
+			p->frag |= 0x01; /* DF */
+		if (off & 0x3fff)
+			p->frag |= 0x02; /* IsF */
+		if ((off & 0x3fff) == 0x2000)
+			p->frag |= 0x04; /* FF */
+		if ((off & 0x1fff) && !(off & 0x2000))
+			p->frag |= 0x08; /* LF */
+		if (off & 0x1fff)
+			return 0; /* no L4 header in non-first fragments */
+		l4 = (void *)ip + ip->ihl * 4;
+	} else if (eth->h_proto == __builtin_bswap16(ETH_P_IPV6)) {
+		struct ipv6hdr *ip6 = (void *)(eth + 1);
+		if ((void *)(ip6 + 1) > end)
+			return -1;
+		p->family = 6;
+		p->proto = ip6->nexthdr;
+		p->dscp = ((ip6->priority << 4) | (ip6->flow_lbl[0] >> 4)) >> 2;
+		p->length = __builtin_bswap16(ip6->payload_len) + sizeof(*ip6);
+		__builtin_memcpy(p->dst, &ip6->daddr, 16);
+		__builtin_memcpy(p->src, &ip6->saddr, 16);
+		l4 = ip6 + 1;
+	} else {
+		return -1;
+	}
+
+	if (p->proto == IPPROTO_TCP) {
+		struct tcphdr *tcp = l4;
+		if ((void *)(tcp + 1) > end)
+			return 0;
+		p->sport = __builtin_bswap16(tcp->source);
+		p->dport = __builtin_bswap16(tcp->dest);
+		p->tcp_flags = ((__u8 *)tcp)[13];
+		p->has_ports = p->has_tcp = 1;
+	} else if (p->proto == IPPROTO_UDP) {
+		struct udphdr *udp = l4;
+		if ((void *)(udp + 1) > end)
+			return 0;
+		p->sport = __builtin_bswap16(udp->source);
+		p->dport = __builtin_bswap16(udp->dest);
+		p->has_ports = 1;
+	} else if (p->proto == IPPROTO_ICMP || p->proto == 58 /* ICMPv6 */) {
+		__u8 *icmp = l4;
+		if ((void *)(icmp + 2) > end)
+			return 0;
+		p->icmp_type = icmp[0];
+		p->icmp_code = icmp[1];
+		p->has_icmp = 1;
+	}
+	return 0;
+}
+
+static __always_inline int over_rate(const struct fs_rule *r, __u64 cost)
+{
+	struct fs_bucket *b = bpf_map_lookup_elem(&fs_buckets, &r->id);
+	__u64 now = bpf_ktime_get_ns();
+	if (!b) {
+		struct fs_bucket init = { .tokens = r->rate, .last_ns = now };
+		bpf_map_update_elem(&fs_buckets, &r->id, &init, BPF_ANY);
+		return 0;
+	}
+	b->tokens += (now - b->last_ns) * r->rate / 1000000000ULL;
+	if (b->tokens > r->rate)
+		b->tokens = r->rate;
+	b->last_ns = now;
+	if (b->tokens < cost)
+		return 1;
+	b->tokens -= cost;
+	return 0;
+}
+
+SEC("xdp")
+int xdp_flowspec(struct xdp_md *ctx)
+{
+	struct pkt p = {};
+	__u32 zero = 0;
+	__u32 *count = bpf_map_lookup_elem(&fs_count, &zero);
+
+	if (!count || parse(ctx, &p) < 0)
+		return XDP_PASS;
+
+	for (__u32 i = 0; i < FS_MAX_RULES; i++) {
+		if (i >= *count)
+			break;
+		struct fs_rule *r = bpf_map_lookup_elem(&fs_rules, &i);
+		if (!r || !rule_match(r, &p))
+			continue;
+
+		struct fs_counter *c = bpf_map_lookup_elem(&fs_counters, &r->id);
+		if (c) {
+			c->packets++;
+			c->bytes += p.length;
+		} else {
+			struct fs_counter init = { .packets = 1, .bytes = p.length };
+			bpf_map_update_elem(&fs_counters, &r->id, &init, BPF_ANY);
+		}
+
+		switch (r->action) {
+		case FS_ACT_DROP:
+			return XDP_DROP;
+		case FS_ACT_RATE_BYTES:
+			if (over_rate(r, p.length))
+				return XDP_DROP;
+			break;
+		case FS_ACT_RATE_PKTS:
+			if (over_rate(r, 1))
+				return XDP_DROP;
+			break;
+		}
+		/* mark_dscp needs checksum rewrites, it is carried for a tc egress program */
+		if (!r->terminal)
+			return XDP_PASS;
+	}
+	return XDP_PASS;
+}
+
+char _license[] SEC("license") = "GPL";
@@ -0,0 +1,266 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+// Package xdp drives a generic, map-driven XDP classifier (ProgramSource) from FlowSpec rules.
+//
+// The program is compiled once; rule changes only rewrite map entries:
+//   - fs_rules (array): key i holds the encoded i-th rule in RFC8955 5.1 order
+//   - fs_count (array): key 0 holds the number of valid fs_rules entries
+//   - fs_counters (per-CPU hash): keyed by RuleID, read back with DecodeCounters
+//
+// Loading the object and writing the maps is left to the caller (bpftool,
+// cilium/ebpf, ...), which keeps this package free of kernel dependencies.
+package xdp
+
+import (
+	_ "embed"
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+	"runtime"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/actions"
+)
+
+// ProgramSource is the C source of the XDP classifier, see bpf/xdp_flowspec.c.
+//
+//go:embed bpf/xdp_flowspec.c
+var ProgramSource string
+
+var (
+	ErrTooManyRules       = errors.New("xdp: rule set exceeds MaxRules")
+	ErrTooManyTerms       = errors.New("xdp: component exceeds MaxTerms {operator, value} pairs")
+	ErrUnsupportedAction  = errors.New("xdp: redirect actions cannot be enforced in XDP")
+	ErrConflictingActions = errors.New("xdp: more than one traffic-rate action present")
+	ErrMixedFamilies      = errors.New("xdp: destination and source prefix address families differ")
+	ErrMalformedCounters  = errors.New("xdp: per-CPU counter value has unexpected length")
+)
+
+// Limits and layout of the maps, these must match bpf/xdp_flowspec.c.
+const (
+	MaxRules = 1024
+	MaxTerms = 8
+
+	numComps    = 10 // component types 3..12
+	termSize    = 8
+	compSize    = 4 + MaxTerms*termSize
+	compsOffset = 56
+	RuleSize    = compsOffset + numComps*compSize
+	counterSize = 16
+)
+
+// Actions as encoded in fs_rule.action.
+const (
+	actPass      = 0
+	actDrop      = 1
+	actRateBytes = 2
+	actRatePkts  = 3
+)
+
+// Rule is a FlowSpec rule as installed into the classifier.
+type Rule struct {
+	Components fs.FSComponentList
+	Actions    []actions.Action
+}
+
+// Options tunes the encoding.
+type Options struct {
+	// CPUs is the number of CPUs the program runs on. Rate limits are enforced
+	// per CPU, so configured rates are divided by it. Defaults to runtime.NumCPU().
+	CPUs int
+}
+
+// Maps is the content of the classifier maps for one rule set.
+type Maps struct {
+	// Rules holds the fs_rules values for keys 0..len(Rules)-1.
+	Rules [][]byte
+	// IDs holds the fs_counters key of each rule.
+	IDs []uint64
+}
+
+// Count returns the fs_count value.
+func (m *Maps) Count() []byte {
+	return binary.LittleEndian.AppendUint32(nil, uint32(len(m.Rules)))
+}
+
+// Counters are the packets and bytes a rule matched, summed over all CPUs.
+type Counters struct {
+	Packets uint64
+	Bytes   uint64
+}
+
+// RuleID returns the stable fs_counters key of list: FNV-1a 64 over every
+// component's type, prefix length, prefix address and operator bytes.
+// It does not depend on the rule's position, so counters survive reordering.
+func RuleID(list fs.FSComponentList) uint64 {
+	h := fnv.New64a()
+	for _, c := range list.Components {
+		h.Write([]byte{byte(c.Type)})
+		if c.Prefix != nil {
+			p := c.Prefix.Masked()
+			h.Write([]byte{byte(p.Bits())})
+			h.Write(p.Addr().AsSlice())
+		}
+		h.Write(c.Raw)
+	}
+	return h.Sum64()
+}
+
+// Compile encodes rules, which must already be in RFC8955 5.1 order.
+func Compile(rules []Rule, opts *Options) (*Maps, error) {
+	if len(rules) > MaxRules {
+		return nil, ErrTooManyRules
+	}
+	cpus := runtime.NumCPU()
+	if opts != nil && opts.CPUs > 0 {
+		cpus = opts.CPUs
+	}
+	m := &Maps{}
+	for _, r := range rules {
+		b, err := EncodeRule(r, cpus)
+		if err != nil {
+			return nil, err
+		}
+		m.Rules = append(m.Rules, b)
+		m.IDs = append(m.IDs, RuleID(r.Components))
+	}
+	return m, nil
+}
+
+// EncodeRule returns the fs_rule value for r.
+func EncodeRule(r Rule, cpus int) ([]byte, error) {
+	b := make([]byte, RuleSize)
+	binary.LittleEndian.PutUint64(b[0:], RuleID(r.Components))
+
+	var present uint32
+	for _, c := range r.Components.Components {
+		present |= 1 << c.Type
+		switch c.Type {
+		case fs.ComponentTypeDestinationPrefix, fs.ComponentTypeSourcePrefix:
+			p := c.Prefix.Masked()
+			family := byte(4)
+			if p.Addr().Is6() {
+				family = 6
+			}
+			if b[12] != 0 && b[12] != family {
+				return nil, ErrMixedFamilies
+			}
+			b[12] = family
+			if c.Type == fs.ComponentTypeDestinationPrefix {
+				b[13] = byte(p.Bits())
+				copy(b[16:32], p.Addr().AsSlice())
+			} else {
+				b[14] = byte(p.Bits())
+				copy(b[32:48], p.Addr().AsSlice())
+			}
+		default:
+			if c.Type < fs.ComponentTypeIpProtocol || c.Type > fs.ComponentTypeFragment {
+				continue
+			}
+			if err := encodeComp(b[compsOffset+int(c.Type-fs.ComponentTypeIpProtocol)*compSize:], c); err != nil {
+				return nil, err
+			}
+		}
+	}
+	binary.LittleEndian.PutUint32(b[8:], present)
+
+	b[52] = 0xff // no marking
+	rates := 0
+	for _, a := range r.Actions {
+		switch v := a.(type) {
+		case actions.TrafficRateBytes:
+			rates++
+			b[15] = actRateBytes
+			binary.LittleEndian.PutUint32(b[48:], uint32(v.Rate)/uint32(cpus))
+		case actions.TrafficRatePackets:
+			rates++
+			b[15] = actRatePkts
+			binary.LittleEndian.PutUint32(b[48:], uint32(v.Rate)/uint32(cpus))
+		case actions.TrafficAction:
+			if v.Terminal {
+				b[53] = 1
+			}
+		case actions.TrafficMarking:
+			b[52] = v.DSCP & 0x3f
+		case actions.Redirect:
+			return nil, ErrUnsupportedAction
+		}
+		if actions.IsDiscard(a) {
+			b[15] = actDrop
+		}
+	}
+	if rates > 1 {
+		return nil, ErrConflictingActions
+	}
+	return b, nil
+}
+
+// encodeComp writes one fs_comp; terms keep their RFC8955 operator bits.
+func encodeComp(dst []byte, c fs.FSComponent) error {
+	var terms [][2]uint64 // value, op
+	if c.Type.IsBitmask() {
+		ops, err := fs.ParseBitmaskOps(c.Raw)
+		if err != nil {
+			return err
+		}
+		for _, o := range ops {
+			var op uint64
+			if o.And {
+				op |= 0x40
+			}
+			if o.Not {
+				op |= 0x02
+			}
+			if o.Match {
+				op |= 0x01
+			}
+			terms = append(terms, [2]uint64{o.Value, op})
+		}
+	} else {
+		ops, err := fs.ParseNumericOps(c.Raw)
+		if err != nil {
+			return err
+		}
+		for _, o := range ops {
+			var op uint64
+			if o.And {
+				op |= 0x40
+			}
+			if o.LT {
+				op |= 0x04
+			}
+			if o.GT {
+				op |= 0x02
+			}
+			if o.EQ {
+				op |= 0x01
+			}
+			terms = append(terms, [2]uint64{o.Value, op})
+		}
+	}
+	if len(terms) > MaxTerms {
+		return ErrTooManyTerms
+	}
+	dst[0] = byte(len(terms))
+	for i, t := range terms {
+		off := 4 + i*termSize
+		binary.LittleEndian.PutUint32(dst[off:], uint32(t[0]))
+		dst[off+4] = byte(t[1])
+	}
+	return nil
+}
+
+// DecodeCounters sums a per-CPU fs_counters value as returned by a map lookup.
+func DecodeCounters(perCPU []byte) (Counters, error) {
+	if len(perCPU) == 0 || len(perCPU)%counterSize != 0 {
+		return Counters{}, ErrMalformedCounters
+	}
+	var c Counters
+	for off := 0; off < len(perCPU); off += counterSize {
+		c.Packets += binary.LittleEndian.Uint64(perCPU[off:])
+		c.Bytes += binary.LittleEndian.Uint64(perCPU[off+8:])
+	}
+	return c, nil
+}
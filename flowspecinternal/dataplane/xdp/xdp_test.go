@@ -0,0 +1,142 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package xdp
+
+import (
+	"encoding/binary"
+	"errors"
+	"net/netip"
+	"strings"
+	"testing"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/actions"
+)
+
+func prefix(s string) *netip.Prefix {
+	p := netip.MustParsePrefix(s)
+	return &p
+}
+
+func TestEncodeRule(t *testing.T) {
+	r := Rule{
+		Components: fs.FSComponentList{Components: []fs.FSComponent{
+			{Type: fs.ComponentTypeDestinationPrefix, Prefix: prefix("192.0.2.0/24")},
+			{Type: fs.ComponentTypeIpProtocol, Raw: []byte{0x81, 0x11}},
+			{Type: fs.ComponentTypeDestinationPort, Raw: []byte{0x01, 0x35, 0x91, 0x01, 0xbb}},
+		}},
+		Actions: []actions.Action{actions.TrafficRateBytes{Rate: 8000}, actions.TrafficAction{Terminal: true}},
+	}
+	b, err := EncodeRule(r, 4)
+	if err != nil {
+		t.Fatalf("EncodeRule(%v) error = %v, want <nil>", r, err)
+	}
+	if len(b) != RuleSize {
+		t.Fatalf("len(EncodeRule(%v)) = %d, want %d", r, len(b), RuleSize)
+	}
+
+	checks := []struct {
+		name      string
+		got, want uint64
+	}{
+		{"id", binary.LittleEndian.Uint64(b[0:]), RuleID(r.Components)},
+		{"present", uint64(binary.LittleEndian.Uint32(b[8:])), 1<<1 | 1<<3 | 1<<5},
+		{"family", uint64(b[12]), 4},
+		{"dst_len", uint64(b[13]), 24},
+		{"dst[2]", uint64(b[18]), 2},
+		{"action", uint64(b[15]), actRateBytes},
+		{"rate per cpu", uint64(binary.LittleEndian.Uint32(b[48:])), 2000},
+		{"mark_dscp", uint64(b[52]), 0xff},
+		{"terminal", uint64(b[53]), 1},
+		{"proto nterms", uint64(b[compsOffset]), 1},
+		{"proto value", uint64(binary.LittleEndian.Uint32(b[compsOffset+4:])), 17},
+		{"dport nterms", uint64(b[compsOffset+2*compSize]), 2},
+		{"dport term 2 value", uint64(binary.LittleEndian.Uint32(b[compsOffset+2*compSize+12:])), 443},
+		{"dport term 2 op", uint64(b[compsOffset+2*compSize+16]), 0x01},
+	}
+	for _, c := range checks {
+		if c.got != c.want {
+			t.Errorf("EncodeRule() %s = %d, want %d", c.name, c.got, c.want)
+		}
+	}
+}
+
+func TestEncodeRuleErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    Rule
+		wantErr error
+	}{
+		{
+			name:    "Redirect",
+			rule:    Rule{Actions: []actions.Action{actions.Redirect{Variant: actions.TypeRedirectAS2, AS: 65000, Value: 1}}},
+			wantErr: ErrUnsupportedAction,
+		},
+		{
+			name: "TooManyTerms",
+			rule: Rule{Components: fs.FSComponentList{Components: []fs.FSComponent{
+				{Type: fs.ComponentTypeIpProtocol, Raw: fs.EncodeNumericOps(make([]fs.NumericOp, MaxTerms+1))},
+			}}},
+			wantErr: ErrTooManyTerms,
+		},
+		{
+			name: "MixedFamilies",
+			rule: Rule{Components: fs.FSComponentList{Components: []fs.FSComponent{
+				{Type: fs.ComponentTypeDestinationPrefix, Prefix: prefix("192.0.2.0/24")},
+				{Type: fs.ComponentTypeSourcePrefix, Prefix: prefix("2001:db8::/32")},
+			}}},
+			wantErr: ErrMixedFamilies,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := EncodeRule(tt.rule, 1); !errors.Is(err, tt.wantErr) {
+				t.Errorf("EncodeRule(%v) error = %v, want %v", tt.rule, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRuleIDStable(t *testing.T) {
+	a := fs.FSComponentList{Components: []fs.FSComponent{
+		{Type: fs.ComponentTypeDestinationPrefix, Prefix: prefix("192.0.2.0/24")},
+	}}
+	b := fs.FSComponentList{Components: []fs.FSComponent{
+		{Type: fs.ComponentTypeDestinationPrefix, Prefix: prefix("192.0.2.7/24")},
+	}}
+	if RuleID(a) != RuleID(b) {
+		t.Errorf("RuleID(%v) != RuleID(%v), want equal for the same masked prefix", a, b)
+	}
+	// pinned: changing the encoding orphans counters of running programs
+	if got, want := RuleID(a), uint64(0x5f778030b39be8ae); got != want {
+		t.Errorf("RuleID(%v) = %#x, want %#x", a, got, want)
+	}
+}
+
+func TestDecodeCounters(t *testing.T) {
+	var v []byte
+	for cpu := uint64(1); cpu <= 3; cpu++ {
+		v = binary.LittleEndian.AppendUint64(v, cpu)
+		v = binary.LittleEndian.AppendUint64(v, cpu*100)
+	}
+	got, err := DecodeCounters(v)
+	if err != nil {
+		t.Fatalf("DecodeCounters(%x) error = %v, want <nil>", v, err)
+	}
+	if want := (Counters{Packets: 6, Bytes: 600}); got != want {
+		t.Errorf("DecodeCounters(%x) = %v, want %v", v, got, want)
+	}
+	if _, err := DecodeCounters(v[:10]); !errors.Is(err, ErrMalformedCounters) {
+		t.Errorf("DecodeCounters(short) error = %v, want %v", err, ErrMalformedCounters)
+	}
+}
+
+func TestProgramSourceEmbedded(t *testing.T) {
+	for _, sym := range []string{"fs_rules", "fs_count", "fs_counters", "SEC(\"xdp\")"} {
+		if !strings.Contains(ProgramSource, sym) {
+			t.Errorf("ProgramSource does not contain %q", sym)
+		}
+	}
+}
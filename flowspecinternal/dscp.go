@@ -0,0 +1,50 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package flowspecinternal
+
+import "fmt"
+
+// DSCP code points (RFC2474 class selectors, RFC2597 assured forwarding,
+// RFC3246 expedited forwarding, RFC5865 voice-admit, RFC8622 lower effort).
+const (
+	DSCPCS0        = 0
+	DSCPLE         = 1
+	DSCPCS1        = 8
+	DSCPAF11       = 10
+	DSCPAF12       = 12
+	DSCPAF13       = 14
+	DSCPCS2        = 16
+	DSCPAF21       = 18
+	DSCPAF22       = 20
+	DSCPAF23       = 22
+	DSCPCS3        = 24
+	DSCPAF31       = 26
+	DSCPAF32       = 28
+	DSCPAF33       = 30
+	DSCPCS4        = 32
+	DSCPAF41       = 34
+	DSCPAF42       = 36
+	DSCPAF43       = 38
+	DSCPCS5        = 40
+	DSCPVoiceAdmit = 44
+	DSCPEF         = 46
+	DSCPCS6        = 48
+	DSCPCS7        = 56
+)
+
+// maxDSCP is the largest value of the 6 bit DSCP field.
+const maxDSCP = 0x3f
+
+// DSCPComponent returns the DSCP component (type 11) matching the code
+// points of ranges, e.g. DSCPComponent(ValueRange{From: DSCPAF41, To: DSCPAF43}).
+// Values above 63 return ErrInvalidComponentValue.
+func DSCPComponent(ranges ...ValueRange) (FSComponent, error) {
+	for _, r := range ranges {
+		if r.From > r.To || r.To > maxDSCP {
+			return FSComponent{}, fmt.Errorf("%w: dscp %d-%d", ErrInvalidComponentValue, r.From, r.To)
+		}
+	}
+	return FSComponent{Type: ComponentTypeDSCP, Raw: EncodeNumericOps(NumericOpsFromRanges(ranges, maxDSCP))}, nil
+}
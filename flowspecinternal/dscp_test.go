@@ -0,0 +1,33 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package flowspecinternal
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDSCPComponent(t *testing.T) {
+	c, err := DSCPComponent(ValueRange{From: DSCPAF41, To: DSCPAF43}, ValueRange{From: DSCPEF, To: DSCPEF})
+	if err != nil {
+		t.Fatalf("DSCPComponent() error = %v", err)
+	}
+	l := FSComponentList{Components: []FSComponent{c}}
+	if got, want := l.Canonical(&CanonicalOptions{Symbolic: true}), "dscp=34-38,ef"; got != want {
+		t.Errorf("Canonical() = %q, want %q", got, want)
+	}
+	if got, err := ParseComponents("dscp af41-af43,EF"); err != nil || got.Canonical(nil) != l.Canonical(nil) {
+		t.Errorf("ParseComponents() = %v, %v, want %v", got, err, l)
+	}
+	if _, err := DSCPComponent(ValueRange{From: 60, To: 64}); !errors.Is(err, ErrInvalidComponentValue) {
+		t.Errorf("DSCPComponent(60-64) error = %v, want %v", err, ErrInvalidComponentValue)
+	}
+	if _, err := ParseDSCP("64"); !errors.Is(err, ErrInvalidComponentValue) {
+		t.Errorf("ParseDSCP(64) error = %v, want %v", err, ErrInvalidComponentValue)
+	}
+	if _, err := ParseDSCP("af44"); !errors.Is(err, ErrUnknownSymbol) {
+		t.Errorf("ParseDSCP(af44) error = %v, want %v", err, ErrUnknownSymbol)
+	}
+}
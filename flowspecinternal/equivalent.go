@@ -0,0 +1,166 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package flowspecinternal
+
+import (
+	"net/netip"
+	"slices"
+)
+
+// bitmaskWidth is the width in bits of the header field a bitmask component tests.
+func (t ComponentType) bitmaskWidth() uint {
+	if t == ComponentTypeFragment {
+		return 8
+	}
+	return 16
+}
+
+// Equivalent reports whether a and b match exactly the same packets, however
+// their operators are encoded: "port >=80&<=80" and "port =80" are
+// equivalent, as are bitmask sequences selecting the same flag combinations
+// and prefixes differing only in host bits.
+//
+// A component that matches every value is equivalent to its absence for the
+// protocol, packet length, DSCP and fragment components only; the port, ICMP
+// and TCP flag components also restrict the IP protocol, and a prefix
+// restricts the address family. Two lists that match nothing are equivalent.
+// Malformed operator sequences return ErrMalformedOperators.
+func Equivalent(a, b FSComponentList) (bool, error) {
+	sa, err := newMatchSets(a)
+	if err != nil {
+		return false, err
+	}
+	sb, err := newMatchSets(b)
+	if err != nil {
+		return false, err
+	}
+	if sa.empty || sb.empty {
+		return sa.empty == sb.empty, nil
+	}
+	for t := range 256 {
+		if !sa.equal(sb, ComponentType(t)) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// matchSets holds the values each component of a list matches. A type without
+// entry is absent from the list.
+type matchSets struct {
+	prefixes map[ComponentType]netip.Prefix
+	ranges   map[ComponentType][]ValueRange
+	bits     map[ComponentType][]uint64
+	macs     map[ComponentType]string
+	empty    bool // some component matches nothing
+}
+
+func newMatchSets(l FSComponentList) (*matchSets, error) {
+	s := &matchSets{
+		prefixes: map[ComponentType]netip.Prefix{},
+		ranges:   map[ComponentType][]ValueRange{},
+		bits:     map[ComponentType][]uint64{},
+		macs:     map[ComponentType]string{},
+	}
+	for _, c := range l.Components {
+		switch {
+		case c.Type == ComponentTypeDestinationPrefix || c.Type == ComponentTypeSourcePrefix:
+			if c.Prefix != nil {
+				s.prefixes[c.Type] = c.Prefix.Masked()
+			}
+		case c.Type.IsMAC():
+			s.macs[c.Type] = string(c.Raw)
+		case c.Type.IsBitmask():
+			ops, err := ParseBitmaskOps(c.Raw)
+			if err != nil {
+				return nil, err
+			}
+			b := bitmaskValues(SplitBitmaskOps(ops), c.Type.bitmaskWidth())
+			s.bits[c.Type] = b
+			s.empty = s.empty || !slices.ContainsFunc(b, func(w uint64) bool { return w != 0 })
+		default:
+			ops, err := ParseNumericOps(c.Raw)
+			if err != nil {
+				return nil, err
+			}
+			r := NumericRanges(ops, c.Type.maxValue())
+			s.ranges[c.Type] = r
+			s.empty = s.empty || len(r) == 0
+		}
+	}
+	return s, nil
+}
+
+// optional reports whether a component of type t matching every value is the
+// same as no component.
+func (t ComponentType) optional() bool {
+	switch t {
+	case ComponentTypeIpProtocol, ComponentTypePacketLength, ComponentTypeDSCP, ComponentTypeFragment:
+		return true
+	}
+	return false
+}
+
+func (s *matchSets) equal(o *matchSets, t ComponentType) bool {
+	if p, ok := s.prefixes[t]; ok {
+		q, ok := o.prefixes[t]
+		return ok && p == q
+	}
+	if _, ok := o.prefixes[t]; ok {
+		return false
+	}
+	if t.IsMAC() {
+		x, okx := s.macs[t]
+		y, oky := o.macs[t]
+		return okx == oky && x == y
+	}
+	if t.IsBitmask() {
+		full := make([]uint64, (1<<t.bitmaskWidth())/64)
+		for i := range full {
+			full[i] = ^uint64(0)
+		}
+		x, okx := s.bits[t]
+		y, oky := o.bits[t]
+		if !okx && t.optional() {
+			x, okx = full, true
+		}
+		if !oky && t.optional() {
+			y, oky = full, true
+		}
+		return okx == oky && slices.Equal(x, y)
+	}
+	full := []ValueRange{{From: 0, To: t.maxValue()}}
+	x, okx := s.ranges[t]
+	y, oky := o.ranges[t]
+	if !okx && t.optional() {
+		x, okx = full, true
+	}
+	if !oky && t.optional() {
+		y, oky = full, true
+	}
+	return okx == oky && slices.Equal(x, y)
+}
+
+// bitmaskValues returns the set of width bit field values the OR-ed groups of
+// AND-ed terms match as per RFC8955 4.2.1.2.
+func bitmaskValues(groups [][]BitmaskOp, width uint) []uint64 {
+	set := make([]uint64, (1<<width+63)/64)
+	for v := uint64(0); v < 1<<width; v++ {
+		for _, g := range groups {
+			if !slices.ContainsFunc(g, func(op BitmaskOp) bool { return bitmaskHit(op, v) == op.Not }) {
+				set[v/64] |= 1 << (v % 64)
+				break
+			}
+		}
+	}
+	return set
+}
+
+func bitmaskHit(op BitmaskOp, v uint64) bool {
+	if op.Match {
+		return v&op.Value == op.Value
+	}
+	return v&op.Value != 0
+}
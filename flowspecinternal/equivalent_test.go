@@ -0,0 +1,53 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package flowspecinternal
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestEquivalent(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want bool
+	}{
+		{name: "RangeVersusEquality", a: "port >=80&<=80", b: "port =80", want: true},
+		{name: "ReorderedValues", a: "dport =443,=80", b: "dport 80-80,443", want: true},
+		{name: "HostBits", a: "dst 192.0.2.77/24", b: "dst 192.0.2.0/24", want: true},
+		{name: "SingleBitAnyAndAll", a: "tcp-flags =syn", b: "tcp-flags syn", want: true},
+		{name: "DeMorgan", a: "tcp-flags !syn&!ack", b: "tcp-flags !syn|ack", want: true},
+		{name: "FullLengthIsAbsent", a: "dst 192.0.2.0/24 len >=0", b: "dst 192.0.2.0/24", want: true},
+		{name: "FullPortIsNotAbsent", a: "dst 192.0.2.0/24 dport >=0", b: "dst 192.0.2.0/24", want: false},
+		{name: "BothEmpty", a: "dport >100&<50", b: "len false", want: true},
+		{name: "DifferentPrefix", a: "dst 192.0.2.0/24", b: "dst 192.0.2.0/25", want: false},
+		{name: "PortVersusDport", a: "port 80", b: "dport 80", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := ParseComponents(tt.a)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := ParseComponents(tt.b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := Equivalent(a, b)
+			if err != nil {
+				t.Fatalf("Equivalent() error = %v, want <nil>", err)
+			}
+			if got != tt.want {
+				t.Errorf("Equivalent(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+
+	bad := FSComponentList{Components: []FSComponent{{Type: ComponentTypePort, Raw: []byte{0x01}}}}
+	if _, err := Equivalent(bad, bad); !errors.Is(err, ErrMalformedOperators) {
+		t.Errorf("Equivalent(malformed) error = %v, want %v", err, ErrMalformedOperators)
+	}
+}
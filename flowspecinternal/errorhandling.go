@@ -0,0 +1,85 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package flowspecinternal
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+var ErrUnknownErrorHandling = errors.New("flowspec: unknown error handling")
+
+// ErrorHandling is the RFC7606 2 approach to a malformed UPDATE message.
+// The values are ordered by severity, so the most severe of several errors
+// of one message is the largest.
+type ErrorHandling uint8
+
+const (
+	// ErrorHandlingDefault selects the RFC7606 approach for the error.
+	ErrorHandlingDefault ErrorHandling = iota
+	// AttributeDiscard ignores the malformed attribute, or the malformed
+	// NLRI only, and processes the rest of the message.
+	AttributeDiscard
+	// TreatAsWithdraw withdraws every route the message announces.
+	TreatAsWithdraw
+	// SessionReset closes the session with a NOTIFICATION.
+	SessionReset
+)
+
+var errorHandlingNames = [...]string{
+	AttributeDiscard: "attribute-discard",
+	TreatAsWithdraw:  "treat-as-withdraw",
+	SessionReset:     "session-reset",
+}
+
+func (h ErrorHandling) String() string {
+	if h == ErrorHandlingDefault {
+		return "default"
+	}
+	if int(h) < len(errorHandlingNames) {
+		return errorHandlingNames[h]
+	}
+	return fmt.Sprintf("error-handling-%d", uint8(h))
+}
+
+func (h ErrorHandling) MarshalText() ([]byte, error) {
+	return []byte(h.String()), nil
+}
+
+func (h *ErrorHandling) UnmarshalText(b []byte) error {
+	if string(b) == "default" {
+		*h = ErrorHandlingDefault
+		return nil
+	}
+	i := slices.Index(errorHandlingNames[:], string(b))
+	if i <= 0 {
+		return fmt.Errorf("%w: %q", ErrUnknownErrorHandling, b)
+	}
+	*h = ErrorHandling(i)
+	return nil
+}
+
+// NLRIErrorHandling returns the handling of FlowSpec NLRI that can be located
+// but whose components do not decode or fail CheckStrict: MalformedNLRI, or
+// TreatAsWithdraw when unset or c is nil.
+func (c *Config) NLRIErrorHandling() ErrorHandling {
+	if c == nil || c.MalformedNLRI == ErrorHandlingDefault {
+		return TreatAsWithdraw
+	}
+	return c.MalformedNLRI
+}
+
+// AttributeErrorHandling returns the handling of malformed AS_PATH,
+// ORIGINATOR_ID, CLUSTER_LIST and extended community attributes:
+// MalformedAttribute, or TreatAsWithdraw (RFC7606 7) when unset or c is nil.
+// FlowSpec actions are extended communities, so discarding that attribute
+// would change the rule.
+func (c *Config) AttributeErrorHandling() ErrorHandling {
+	if c == nil || c.MalformedAttribute == ErrorHandlingDefault {
+		return TreatAsWithdraw
+	}
+	return c.MalformedAttribute
+}
@@ -0,0 +1,44 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package flowspecinternal
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestErrorHandlingJSON(t *testing.T) {
+	in := Config{MalformedNLRI: SessionReset, MalformedAttribute: AttributeDiscard}
+	b, err := json.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out Config
+	if err := json.Unmarshal(b, &out); err != nil {
+		t.Fatalf("Unmarshal(%s) error = %v", b, err)
+	}
+	if out.MalformedNLRI != SessionReset || out.MalformedAttribute != AttributeDiscard {
+		t.Errorf("Unmarshal(%s) = %+v, want %+v", b, out, in)
+	}
+
+	var h ErrorHandling
+	if err := h.UnmarshalText([]byte("ignore")); !errors.Is(err, ErrUnknownErrorHandling) {
+		t.Errorf("UnmarshalText(ignore) error = %v, want %v", err, ErrUnknownErrorHandling)
+	}
+}
+
+func TestConfigErrorHandling(t *testing.T) {
+	var nilCfg *Config
+	if h := nilCfg.NLRIErrorHandling(); h != TreatAsWithdraw {
+		t.Errorf("nil NLRIErrorHandling() = %s, want %s", h, TreatAsWithdraw)
+	}
+	if h := (&Config{}).AttributeErrorHandling(); h != TreatAsWithdraw {
+		t.Errorf("AttributeErrorHandling() = %s, want %s", h, TreatAsWithdraw)
+	}
+	if h := (&Config{MalformedNLRI: AttributeDiscard}).NLRIErrorHandling(); h != AttributeDiscard {
+		t.Errorf("NLRIErrorHandling() = %s, want %s", h, AttributeDiscard)
+	}
+}
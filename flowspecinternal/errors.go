@@ -0,0 +1,104 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package flowspecinternal
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Stage is the step of processing a received rule an Error rejects it at.
+type Stage uint8
+
+const (
+	// StageDecode rejects a malformed UPDATE or NLRI.
+	StageDecode Stage = iota + 1
+	// StagePolicy rejects a well-formed rule by local policy: peer policy,
+	// limits, origin authorization, destination screens and rule lifetimes.
+	StagePolicy
+	// StageFeasibility rejects a rule by the RFC8955 6 and RFC9117
+	// feasibility rules and their extensions checked against the unicast
+	// RIB.
+	StageFeasibility
+)
+
+var stageNames = [...]string{
+	StageDecode:      "decode",
+	StagePolicy:      "policy",
+	StageFeasibility: "feasibility",
+}
+
+func (s Stage) String() string {
+	if s == 0 || int(s) >= len(stageNames) {
+		return "other"
+	}
+	return stageNames[s]
+}
+
+// Error is a reason a received rule is rejected for. The rejection errors of
+// this package and of the decoders are *Error sentinels, returned as is or
+// wrapped: errors.Is tells a given reason, errors.As its code for APIs and
+// metrics.
+//
+//	var e *fs.Error
+//	if errors.As(err, &e) {
+//		log.Print(e.Stage, e.Code, e.RFC)
+//	}
+type Error struct {
+	// Code is the stable machine readable name of the reason, e.g.
+	// "no-best-unicast", as returned by Reason.
+	Code  string
+	Stage Stage
+	// RFC references the section the rejection stems from, e.g.
+	// "RFC8955 6 b)", "" for local policy.
+	RFC string
+	msg string
+}
+
+func (e *Error) Error() string { return e.msg }
+
+// errorCodes holds the Errors by Code.
+var errorCodes = map[string]*Error{}
+
+// NewError returns the rejection reason code with the message msg, for
+// decoders in other packages. It panics if code is taken, as codes must map
+// to a single reason to be restored by LookupError.
+func NewError(stage Stage, code, rfc, msg string) *Error {
+	if _, ok := errorCodes[code]; ok {
+		panic(fmt.Sprintf("flowspec: error code %q registered twice", code))
+	}
+	e := &Error{Code: code, Stage: stage, RFC: rfc, msg: msg}
+	errorCodes[code] = e
+	return e
+}
+
+// LookupError returns the Error of code, nil if there is none.
+func LookupError(code string) *Error {
+	return errorCodes[code]
+}
+
+// Reason returns the stable name of the rejection reason err, the Code of
+// the first Error it wraps, as used in the "reason" of a JSON
+// ValidationResult: "" for nil and "other" for errors without a code.
+func Reason(err error) string {
+	if err == nil {
+		return ""
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return "other"
+}
+
+// ErrorStage returns the Stage of the first Error err wraps, 0 if there is
+// none.
+func ErrorStage(err error) Stage {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Stage
+	}
+	return 0
+}
@@ -0,0 +1,73 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package flowspecinternal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestError(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		wantCode  string
+		wantStage Stage
+		wantRFC   string
+	}{
+		{name: "nil", err: nil},
+		{name: "sentinel", err: ErrNoDestinationPrefix, wantCode: "no-destination-prefix", wantStage: StageFeasibility, wantRFC: "RFC8955 6 a)"},
+		{name: "wrapped", err: fmt.Errorf("%w: 192.0.2.0/24", ErrMartianDestination), wantCode: "martian-destination", wantStage: StagePolicy, wantRFC: "RFC6890"},
+		{name: "wrapping a cause", err: fmt.Errorf("%w: %w", ErrRIBLookup, context.Canceled), wantCode: "rib-lookup-failed", wantStage: StageFeasibility},
+		{name: "family mismatch", err: ErrAddressFamilyMismatch, wantCode: "address-family-mismatch", wantStage: StageFeasibility, wantRFC: "RFC8956 3"},
+		{name: "joined", err: errors.Join(ErrMalformedOperators, ErrMalformedNLRI), wantCode: "malformed-operators", wantStage: StageDecode, wantRFC: "RFC8955 4.2.1"},
+		{name: "other", err: errors.New("boom"), wantCode: "other"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.err == nil {
+				if got := Reason(nil); got != "" {
+					t.Errorf("Reason(nil) = %q, want \"\"", got)
+				}
+				return
+			}
+			if got := Reason(tt.err); got != tt.wantCode {
+				t.Errorf("Reason() = %q, want %q", got, tt.wantCode)
+			}
+			if got := ErrorStage(tt.err); got != tt.wantStage {
+				t.Errorf("ErrorStage() = %v, want %v", got, tt.wantStage)
+			}
+			var e *Error
+			if ok := errors.As(tt.err, &e); ok != (tt.wantStage != 0) {
+				t.Fatalf("errors.As() = %v", ok)
+			}
+			if e != nil && (e.Code != tt.wantCode || e.RFC != tt.wantRFC || LookupError(e.Code) != e) {
+				t.Errorf("errors.As() = %+v, want code %q, RFC %q", e, tt.wantCode, tt.wantRFC)
+			}
+		})
+	}
+}
+
+func TestErrorCodes(t *testing.T) {
+	for code, e := range errorCodes {
+		if e.Code != code || e.Stage.String() == "other" || e.Error() == "" {
+			t.Errorf("error %q = %+v", code, e)
+		}
+		if got := Reason(fmt.Errorf("context: %w", e)); got != code {
+			t.Errorf("Reason(%v) = %q, want %q", e, got, code)
+		}
+	}
+	if LookupError("nope") != nil {
+		t.Error("LookupError(nope) != nil")
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("NewError() with a registered code did not panic")
+		}
+	}()
+	NewError(StagePolicy, "no-best-unicast", "", "duplicate")
+}
@@ -0,0 +1,135 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+// Package events distributes FlowSpec rule lifecycle events.
+//
+// Producers such as the FlowSpec RIB and the BGP session Publish on a Bus;
+// dataplane installers, loggers and metrics Subscribe to the kinds they care
+// about instead of polling. Handlers run synchronously on the publishing
+// goroutine in subscription order, so a slow handler delays the producer and
+// should hand events off to its own goroutine.
+package events
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+
+	fs "floofspectools/flowspecinternal"
+)
+
+var (
+	ErrUnknownKind = errors.New("events: unknown event kind")
+)
+
+// Kind is the lifecycle transition an Event reports.
+type Kind uint8
+
+const (
+	// RuleAccepted reports a rule that passed validation.
+	RuleAccepted Kind = iota + 1
+	// RuleRejected reports a rule that failed validation, Err is the reason.
+	RuleRejected
+	// RuleWithdrawn reports a rule removed by its originator or the
+	// operator, or expired by the RIB. Err is then the expiry reason, or
+	// the reason the originator gave.
+	RuleWithdrawn
+	// RuleRevalidated reports a rule whose validation result changed, e.g.
+	// after a unicast route change. Err is the new and Previous the old result.
+	RuleRevalidated
+)
+
+var kindNames = [...]string{
+	RuleAccepted:    "accepted",
+	RuleRejected:    "rejected",
+	RuleWithdrawn:   "withdrawn",
+	RuleRevalidated: "revalidated",
+}
+
+func (k Kind) String() string {
+	if int(k) < len(kindNames) && kindNames[k] != "" {
+		return kindNames[k]
+	}
+	return fmt.Sprintf("kind-%d", uint8(k))
+}
+
+func (k Kind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+func (k *Kind) UnmarshalText(b []byte) error {
+	i := slices.Index(kindNames[:], string(b))
+	if i <= 0 {
+		return fmt.Errorf("%w: %q", ErrUnknownKind, b)
+	}
+	*k = Kind(i)
+	return nil
+}
+
+// Event is one lifecycle transition of a rule. Route must not be modified.
+type Event struct {
+	Kind  Kind
+	Route *fs.FlowSpecRoute
+	// Err is the validation error of RuleRejected and RuleRevalidated.
+	Err error
+	// Previous is the validation error before a RuleRevalidated.
+	Previous error
+}
+
+func (e Event) String() string {
+	s := fmt.Sprintf("%s %s", e.Kind, e.Route.Components)
+	if e.Err != nil {
+		s += ": " + e.Err.Error()
+	}
+	return s
+}
+
+// Bus fans events out to subscribers. The zero value is ready to use and a
+// nil *Bus discards events, so producers can publish unconditionally.
+type Bus struct {
+	mu   sync.RWMutex
+	subs []*subscription
+}
+
+type subscription struct {
+	fn    func(Event)
+	kinds []Kind
+}
+
+// NewBus returns a Bus without subscribers.
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+// Subscribe calls fn for every published event of one of kinds, or of any
+// kind when none are given, until cancel is called.
+func (b *Bus) Subscribe(fn func(Event), kinds ...Kind) (cancel func()) {
+	s := &subscription{fn: fn, kinds: slices.Clone(kinds)}
+	b.mu.Lock()
+	b.subs = append(b.subs, s)
+	b.mu.Unlock()
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		// Publish may still be iterating the old slice.
+		b.subs = slices.DeleteFunc(slices.Clone(b.subs), func(o *subscription) bool { return o == s })
+	}
+}
+
+// Publish hands e to the matching subscribers and returns when all of them
+// have.
+func (b *Bus) Publish(e Event) {
+	if b == nil {
+		return
+	}
+	b.mu.RLock()
+	subs := b.subs
+	b.mu.RUnlock()
+	for _, s := range subs {
+		if len(s.kinds) == 0 || slices.Contains(s.kinds, e.Kind) {
+			s.fn(e)
+		}
+	}
+}
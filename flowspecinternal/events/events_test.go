@@ -0,0 +1,53 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package events
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	fs "floofspectools/flowspecinternal"
+)
+
+func TestBus(t *testing.T) {
+	b := NewBus()
+	var all, rejected []Kind
+	cancel := b.Subscribe(func(e Event) { all = append(all, e.Kind) })
+	b.Subscribe(func(e Event) { rejected = append(rejected, e.Kind) }, RuleRejected, RuleRevalidated)
+
+	r := &fs.FlowSpecRoute{}
+	b.Publish(Event{Kind: RuleAccepted, Route: r})
+	b.Publish(Event{Kind: RuleRejected, Route: r, Err: errors.New("infeasible")})
+	cancel()
+	b.Publish(Event{Kind: RuleRevalidated, Route: r})
+
+	if want := []Kind{RuleAccepted, RuleRejected}; !slices.Equal(all, want) {
+		t.Errorf("all = %v, want %v", all, want)
+	}
+	if want := []Kind{RuleRejected, RuleRevalidated}; !slices.Equal(rejected, want) {
+		t.Errorf("filtered = %v, want %v", rejected, want)
+	}
+
+	var nilBus *Bus
+	nilBus.Publish(Event{Kind: RuleAccepted, Route: r})
+}
+
+func TestKindText(t *testing.T) {
+	for _, k := range []Kind{RuleAccepted, RuleRejected, RuleWithdrawn, RuleRevalidated} {
+		b, err := k.MarshalText()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got Kind
+		if err := got.UnmarshalText(b); err != nil || got != k {
+			t.Errorf("UnmarshalText(%s) = %v, %v, want %v", b, got, err, k)
+		}
+	}
+	var k Kind
+	if err := k.UnmarshalText([]byte("installed")); !errors.Is(err, ErrUnknownKind) {
+		t.Errorf("UnmarshalText(installed) error = %v, want %v", err, ErrUnknownKind)
+	}
+}
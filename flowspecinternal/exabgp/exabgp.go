@@ -0,0 +1,585 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+// Package exabgp speaks the ExaBGP text API, so an ExaBGP process can act as
+// the BGP speaker of a controller:
+//
+//	announce flow route { match { destination 192.0.2.0/24; protocol =6; destination-port =443; } then { discard; } }
+//	withdraw flow route { match { destination 192.0.2.0/24; protocol =6; destination-port =443; } }
+//
+// Run the controller as an ExaBGP "process" and send the commands of a
+// Writer, e.g. from an announce.Scheduler, to its standard output. Parse
+// reads the same commands back, e.g. from a command log or an ExaBGP
+// configuration written by hand.
+//
+// Numeric values are "<op><n>" terms joined by "&" (AND), bitmask values
+// flag names or hex values prefixed by "!" (not) or "=" (match all);
+// alternatives (OR) are listed in brackets. Actions without ExaBGP keyword
+// are sent as raw "extended-community" values.
+package exabgp
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/actions"
+	"floofspectools/flowspecinternal/announce"
+)
+
+var (
+	ErrUnsupportedComponent = errors.New("exabgp: component cannot be expressed in ExaBGP syntax")
+	ErrSyntax               = errors.New("exabgp: command syntax error")
+)
+
+// Options configures the rendering of commands.
+type Options struct {
+	// IPv6 selects the keywords of the IPv6 family (next-header,
+	// traffic-class) for rules that carry no prefix component.
+	IPv6 bool
+}
+
+// keywords maps component types to their ExaBGP match keywords, IPv4 first.
+var keywords = map[fs.ComponentType][2]string{
+	fs.ComponentTypeDestinationPrefix: {"destination", "destination"},
+	fs.ComponentTypeSourcePrefix:      {"source", "source"},
+	fs.ComponentTypeIpProtocol:        {"protocol", "next-header"},
+	fs.ComponentTypePort:              {"port", "port"},
+	fs.ComponentTypeDestinationPort:   {"destination-port", "destination-port"},
+	fs.ComponentTypeSourcePort:        {"source-port", "source-port"},
+	fs.ComponentTypeICMPType:          {"icmp-type", "icmp-type"},
+	fs.ComponentTypeICMPCode:          {"icmp-code", "icmp-code"},
+	fs.ComponentTypeTCPFlags:          {"tcp-flags", "tcp-flags"},
+	fs.ComponentTypePacketLength:      {"packet-length", "packet-length"},
+	fs.ComponentTypeDSCP:              {"dscp", "traffic-class"},
+	fs.ComponentTypeFragment:          {"fragment", "fragment"},
+}
+
+var (
+	tcpFlagNames  = [...]string{"fin", "syn", "rst", "push", "ack", "urgent", "ece", "cwr"}
+	fragmentNames = [...]string{"dont-fragment", "is-fragment", "first-fragment", "last-fragment"}
+)
+
+// Announce returns the command announcing list with acts.
+func Announce(list fs.FSComponentList, acts []actions.Action, opts *Options) (string, error) {
+	match, err := formatMatch(list, opts)
+	if err != nil {
+		return "", err
+	}
+	var then []string
+	for _, a := range acts {
+		then = append(then, formatAction(a))
+	}
+	if len(then) == 0 {
+		then = []string{"accept"}
+	}
+	return "announce flow route { match { " + match + " } then { " + strings.Join(then, "; ") + "; } }", nil
+}
+
+// Withdraw returns the command withdrawing list.
+func Withdraw(list fs.FSComponentList, opts *Options) (string, error) {
+	match, err := formatMatch(list, opts)
+	if err != nil {
+		return "", err
+	}
+	return "withdraw flow route { match { " + match + " } }", nil
+}
+
+// Command returns the command of u.
+func Command(u announce.Update, opts *Options) (string, error) {
+	if u.Withdraw {
+		return Withdraw(u.Components, opts)
+	}
+	return Announce(u.Components, u.Actions, opts)
+}
+
+func formatMatch(list fs.FSComponentList, opts *Options) (string, error) {
+	ipv6 := opts != nil && opts.IPv6
+	for _, c := range list.Components {
+		if c.Prefix != nil {
+			ipv6 = c.Prefix.Addr().Is6()
+		}
+	}
+	family := 0
+	if ipv6 {
+		family = 1
+	}
+	var b strings.Builder
+	for _, c := range list.Components {
+		kw, ok := keywords[c.Type]
+		if !ok {
+			return "", fmt.Errorf("%w: %s", ErrUnsupportedComponent, c.Type)
+		}
+		v, err := formatValue(c)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&b, "%s %s; ", kw[family], v)
+	}
+	return strings.TrimSuffix(b.String(), " "), nil
+}
+
+func formatValue(c fs.FSComponent) (string, error) {
+	if c.Type == fs.ComponentTypeDestinationPrefix || c.Type == fs.ComponentTypeSourcePrefix {
+		if c.Prefix == nil {
+			return "", fmt.Errorf("%w: %s without prefix", ErrUnsupportedComponent, c.Type)
+		}
+		return c.Prefix.String(), nil
+	}
+	var groups []string
+	if c.Type.IsBitmask() {
+		ops, err := fs.ParseBitmaskOps(c.Raw)
+		if err != nil {
+			return "", err
+		}
+		for _, op := range ops {
+			t := formatBits(c.Type, op.Value)
+			if op.Match {
+				t = "=" + t
+			}
+			if op.Not {
+				t = "!" + t
+			}
+			groups = join(groups, op.And, t)
+		}
+	} else {
+		ops, err := fs.ParseNumericOps(c.Raw)
+		if err != nil {
+			return "", err
+		}
+		for _, op := range ops {
+			var t string
+			switch sym := numericSymbol(op); sym {
+			case "":
+				return "", fmt.Errorf("%w: %s operator matches no value", ErrUnsupportedComponent, c.Type)
+			case "true":
+				t = ">=0"
+			default:
+				t = sym + strconv.FormatUint(op.Value, 10)
+			}
+			groups = join(groups, op.And, t)
+		}
+	}
+	if len(groups) == 1 {
+		return groups[0], nil
+	}
+	return "[ " + strings.Join(groups, " ") + " ]", nil
+}
+
+// join appends term to the last group if and, else starts a new group.
+func join(groups []string, and bool, term string) []string {
+	if and && len(groups) > 0 {
+		groups[len(groups)-1] += "&" + term
+		return groups
+	}
+	return append(groups, term)
+}
+
+func numericSymbol(op fs.NumericOp) string {
+	switch {
+	case op.LT && op.GT && op.EQ:
+		return "true"
+	case op.LT && op.GT:
+		return "!="
+	case op.LT && op.EQ:
+		return "<="
+	case op.GT && op.EQ:
+		return ">="
+	case op.LT:
+		return "<"
+	case op.GT:
+		return ">"
+	case op.EQ:
+		return "="
+	}
+	return ""
+}
+
+// formatBits names a single flag, other values are rendered in hex.
+func formatBits(t fs.ComponentType, v uint64) string {
+	names := bitNames(t)
+	if v != 0 && v&(v-1) == 0 {
+		for i, n := range names {
+			if v == 1<<i {
+				return n
+			}
+		}
+	}
+	return fmt.Sprintf("0x%02x", v)
+}
+
+func bitNames(t fs.ComponentType) []string {
+	if t == fs.ComponentTypeTCPFlags {
+		return tcpFlagNames[:]
+	}
+	return fragmentNames[:]
+}
+
+func formatAction(a actions.Action) string {
+	switch v := a.(type) {
+	case actions.TrafficRateBytes:
+		if v.Rate == 0 {
+			return "discard"
+		}
+		return "rate-limit " + strconv.FormatFloat(float64(v.Rate), 'f', -1, 32)
+	case actions.TrafficMarking:
+		return fmt.Sprintf("mark %d", v.DSCP&0x3f)
+	case actions.TrafficAction:
+		switch {
+		case v.Sample && v.Terminal:
+			return "action sample-terminal"
+		case v.Sample:
+			return "action sample"
+		case v.Terminal:
+			return "action terminal"
+		}
+	case actions.Redirect:
+		if v.Variant != actions.TypeRedirectIPv4 {
+			return fmt.Sprintf("redirect %d:%d", v.AS, v.Value)
+		}
+	}
+	ec := a.ExtendedCommunity()
+	return fmt.Sprintf("extended-community [ 0x%016x ]", binary.BigEndian.Uint64(ec[:]))
+}
+
+// Writer sends commands to an ExaBGP process, one per line. It implements
+// announce.Sender.
+type Writer struct {
+	mu   sync.Mutex
+	w    io.Writer
+	opts *Options
+}
+
+// NewWriter returns a Writer to w, typically os.Stdout of a process started
+// by ExaBGP.
+func NewWriter(w io.Writer, opts *Options) *Writer {
+	return &Writer{w: w, opts: opts}
+}
+
+// Send writes the command of u.
+func (w *Writer) Send(ctx context.Context, u announce.Update) error {
+	cmd, err := Command(u, w.opts)
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, err = io.WriteString(w.w, cmd+"\n")
+	return err
+}
+
+// Parse parses one announce or withdraw flow route command, in the braced
+// form Command emits or the flat form "announce flow route destination
+// 192.0.2.0/24 protocol tcp discard".
+func Parse(s string) (announce.Update, error) {
+	var u announce.Update
+	for _, r := range "{};[]" {
+		s = strings.ReplaceAll(s, string(r), " "+string(r)+" ")
+	}
+	f := strings.Fields(s)
+	if len(f) < 3 || (f[0] != "announce" && f[0] != "withdraw") || f[1] != "flow" || f[2] != "route" {
+		return u, fmt.Errorf("%w: not a flow route command: %q", ErrSyntax, strings.Join(f, " "))
+	}
+	u.Withdraw = f[0] == "withdraw"
+	p := &parser{tokens: f[3:]}
+	var comps []fs.FSComponent
+	for {
+		kw, ok := p.next()
+		if !ok {
+			break
+		}
+		switch kw {
+		case "{", "}", ";", "match", "then":
+			continue
+		}
+		if t, ok := componentType(kw); ok {
+			if slices.ContainsFunc(comps, func(c fs.FSComponent) bool { return c.Type == t }) {
+				return u, fmt.Errorf("%w: %s", fs.ErrDuplicateComponent, kw)
+			}
+			c, err := p.component(t)
+			if err != nil {
+				return u, err
+			}
+			comps = append(comps, c)
+			continue
+		}
+		acts, err := p.action(kw)
+		if err != nil {
+			return u, err
+		}
+		u.Actions = append(u.Actions, acts...)
+	}
+	slices.SortStableFunc(comps, func(a, b fs.FSComponent) int { return int(a.Type) - int(b.Type) })
+	u.Components = fs.FSComponentList{Components: comps}
+	if u.Withdraw {
+		u.Actions = nil
+	}
+	return u, nil
+}
+
+// ReadCommands parses the commands of r, one per line, skipping empty lines
+// and "#" comments.
+func ReadCommands(r io.Reader) ([]announce.Update, error) {
+	var out []announce.Update
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		u, err := Parse(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		out = append(out, u)
+	}
+	return out, sc.Err()
+}
+
+func componentType(kw string) (fs.ComponentType, bool) {
+	for t, k := range keywords {
+		if k[0] == kw || k[1] == kw {
+			return t, true
+		}
+	}
+	return 0, false
+}
+
+type parser struct {
+	tokens []string
+}
+
+func (p *parser) next() (string, bool) {
+	if len(p.tokens) == 0 {
+		return "", false
+	}
+	t := p.tokens[0]
+	p.tokens = p.tokens[1:]
+	return t, true
+}
+
+// values returns the terms of one value: a bracketed list or a single term.
+func (p *parser) values() ([]string, error) {
+	t, ok := p.next()
+	if !ok || t == ";" || t == "}" {
+		return nil, fmt.Errorf("%w: missing value", ErrSyntax)
+	}
+	if t != "[" {
+		return []string{t}, nil
+	}
+	var out []string
+	for {
+		t, ok := p.next()
+		if !ok {
+			return nil, fmt.Errorf("%w: unterminated list", ErrSyntax)
+		}
+		if t == "]" {
+			return out, nil
+		}
+		out = append(out, t)
+	}
+}
+
+func (p *parser) component(t fs.ComponentType) (fs.FSComponent, error) {
+	terms, err := p.values()
+	if err != nil {
+		return fs.FSComponent{}, err
+	}
+	c := fs.FSComponent{Type: t}
+	if t == fs.ComponentTypeDestinationPrefix || t == fs.ComponentTypeSourcePrefix {
+		if len(terms) != 1 {
+			return c, fmt.Errorf("%w: %s takes one prefix", ErrSyntax, t)
+		}
+		s := terms[0]
+		// an IPv6 prefix may carry an offset, only 0 is supported
+		if addr, rest, ok := strings.Cut(s, "/"); ok {
+			if l, off, ok := strings.Cut(rest, "/"); ok {
+				if off != "0" {
+					return c, fmt.Errorf("%w: prefix offset %s", ErrUnsupportedComponent, off)
+				}
+				s = addr + "/" + l
+			}
+		}
+		pfx, err := netip.ParsePrefix(s)
+		if err != nil {
+			return c, fmt.Errorf("%w: %v", ErrSyntax, err)
+		}
+		pfx = pfx.Masked()
+		c.Prefix = &pfx
+		return c, nil
+	}
+	if t.IsBitmask() {
+		var ops []fs.BitmaskOp
+		for _, term := range terms {
+			for i, s := range strings.Split(term, "&") {
+				op, err := parseBitmask(t, s)
+				if err != nil {
+					return c, err
+				}
+				op.And = i > 0
+				ops = append(ops, op)
+			}
+		}
+		c.Raw = fs.EncodeBitmaskOps(ops)
+		return c, nil
+	}
+	var ops []fs.NumericOp
+	for _, term := range terms {
+		for i, s := range strings.Split(term, "&") {
+			op, err := parseNumeric(t, s)
+			if err != nil {
+				return c, err
+			}
+			op.And = i > 0
+			ops = append(ops, op)
+		}
+	}
+	c.Raw = fs.EncodeNumericOps(ops)
+	return c, nil
+}
+
+func parseNumeric(t fs.ComponentType, s string) (fs.NumericOp, error) {
+	var op fs.NumericOp
+	for _, p := range []struct {
+		sym        string
+		lt, gt, eq bool
+	}{
+		{">=", false, true, true}, {"<=", true, false, true}, {"!=", true, true, false},
+		{"=", false, false, true}, {">", false, true, false}, {"<", true, false, false},
+	} {
+		if v, ok := strings.CutPrefix(s, p.sym); ok {
+			s, op.LT, op.GT, op.EQ = v, p.lt, p.gt, p.eq
+			break
+		}
+	}
+	if !op.LT && !op.GT && !op.EQ {
+		op.EQ = true
+	}
+	if t == fs.ComponentTypeIpProtocol {
+		p, err := fs.ParseProtocol(s)
+		if err != nil {
+			return op, fmt.Errorf("%w: %v", ErrSyntax, err)
+		}
+		op.Value = uint64(p)
+		return op, nil
+	}
+	v, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return op, fmt.Errorf("%w: %s value %q", ErrSyntax, t, s)
+	}
+	op.Value = v
+	return op, nil
+}
+
+func parseBitmask(t fs.ComponentType, s string) (fs.BitmaskOp, error) {
+	var op fs.BitmaskOp
+	s, op.Not = strings.CutPrefix(s, "!")
+	s, op.Match = strings.CutPrefix(s, "=")
+	if t == fs.ComponentTypeFragment && s == "not-a-fragment" {
+		// ExaBGP's name for "!is-fragment"
+		op.Not, op.Value = !op.Not, 0x02
+		return op, nil
+	}
+	if v, ok := strings.CutPrefix(s, "0x"); ok {
+		n, err := strconv.ParseUint(v, 16, 64)
+		if err != nil {
+			return op, fmt.Errorf("%w: %s value %q", ErrSyntax, t, s)
+		}
+		op.Value = n
+		return op, nil
+	}
+	for i, n := range bitNames(t) {
+		if n == s {
+			op.Value = 1 << i
+			return op, nil
+		}
+	}
+	return op, fmt.Errorf("%w: %s value %q", ErrSyntax, t, s)
+}
+
+func (p *parser) action(kw string) ([]actions.Action, error) {
+	arg := func() (string, error) {
+		t, ok := p.next()
+		if !ok || t == ";" || t == "}" {
+			return "", fmt.Errorf("%w: %s needs an argument", ErrSyntax, kw)
+		}
+		return t, nil
+	}
+	switch kw {
+	case "accept":
+		return nil, nil
+	case "discard":
+		return []actions.Action{actions.TrafficRateBytes{}}, nil
+	case "rate-limit":
+		s, err := arg()
+		if err != nil {
+			return nil, err
+		}
+		r, err := strconv.ParseFloat(s, 32)
+		if err != nil {
+			return nil, fmt.Errorf("%w: rate %q", ErrSyntax, s)
+		}
+		return []actions.Action{actions.TrafficRateBytes{Rate: float32(r)}}, nil
+	case "mark":
+		s, err := arg()
+		if err != nil {
+			return nil, err
+		}
+		d, err := strconv.ParseUint(s, 10, 6)
+		if err != nil {
+			return nil, fmt.Errorf("%w: dscp %q", ErrSyntax, s)
+		}
+		return []actions.Action{actions.TrafficMarking{DSCP: uint8(d)}}, nil
+	case "action":
+		s, err := arg()
+		if err != nil {
+			return nil, err
+		}
+		a := actions.TrafficAction{Sample: strings.HasPrefix(s, "sample"), Terminal: strings.HasSuffix(s, "terminal")}
+		if !a.Sample && !a.Terminal {
+			return nil, fmt.Errorf("%w: action %q", ErrSyntax, s)
+		}
+		return []actions.Action{a}, nil
+	case "redirect":
+		s, err := arg()
+		if err != nil {
+			return nil, err
+		}
+		acts, err := actions.ParseActions("redirect " + s)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrSyntax, err)
+		}
+		return acts, nil
+	case "extended-community":
+		terms, err := p.values()
+		if err != nil {
+			return nil, err
+		}
+		var acts []actions.Action
+		for _, t := range terms {
+			v, err := strconv.ParseUint(strings.TrimPrefix(t, "0x"), 16, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%w: extended community %q", ErrSyntax, t)
+			}
+			var ec [8]byte
+			binary.BigEndian.PutUint64(ec[:], v)
+			a, err := actions.Decode(ec)
+			if err != nil {
+				return nil, err
+			}
+			acts = append(acts, a)
+		}
+		return acts, nil
+	}
+	return nil, fmt.Errorf("%w: unknown keyword %q", ErrSyntax, kw)
+}
@@ -0,0 +1,139 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package exabgp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/actions"
+	"floofspectools/flowspecinternal/announce"
+)
+
+func TestAnnounce(t *testing.T) {
+	tests := []struct {
+		name string
+		rule string
+		want string
+	}{
+		{
+			name: "discard",
+			rule: "dst 192.0.2.0/24 proto tcp dport =443 then discard",
+			want: "announce flow route { match { destination 192.0.2.0/24; protocol =6; destination-port =443; } then { discard; } }",
+		},
+		{
+			name: "ranges and alternatives",
+			rule: "dst 192.0.2.0/24 dport >=1024&<=2048,=80 len <100 then rate-limit 9600",
+			want: "announce flow route { match { destination 192.0.2.0/24; destination-port [ >=1024&<=2048 =80 ]; packet-length <100; } then { rate-limit 9600; } }",
+		},
+		{
+			name: "bitmasks",
+			rule: "dst 192.0.2.0/24 tcp-flags =syn|ack,!rst frag isf then mark 10 sample terminal",
+			want: "announce flow route { match { destination 192.0.2.0/24; tcp-flags [ =0x12 !rst ]; fragment is-fragment; } then { mark 10; action sample-terminal; } }",
+		},
+		{
+			name: "ipv6",
+			rule: "dst 2001:db8::/32 proto udp dscp =46 then redirect 65500:100",
+			want: "announce flow route { match { destination 2001:db8::/32; next-header =17; traffic-class =46; } then { redirect 65500:100; } }",
+		},
+		{
+			name: "accept and raw actions",
+			rule: "dst 192.0.2.0/24 then rate-packets 100",
+			want: "announce flow route { match { destination 192.0.2.0/24; } then { extended-community [ 0x800c000042c80000 ]; } }",
+		},
+		{
+			name: "accept",
+			rule: "dst 192.0.2.0/24",
+			want: "announce flow route { match { destination 192.0.2.0/24; } then { accept; } }",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list, acts, err := actions.ParseRule(tt.rule)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := Announce(list, acts, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Announce() =\n%s\nwant\n%s", got, tt.want)
+			}
+
+			u, err := Parse(got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if u.Withdraw || u.Components.Canonical(nil) != list.Canonical(nil) || actions.Canonical(u.Actions) != actions.Canonical(acts) {
+				t.Errorf("Parse() = %s then %s, want %s then %s", u.Components, u.Actions, list, acts)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		cmd     string
+		want    string
+		wantErr error
+	}{
+		{cmd: "announce flow route destination 192.0.2.0/24 protocol tcp destination-port =80 discard", want: "dst 192.0.2.0/24 proto tcp dport =80"},
+		{cmd: "announce flow route { match { source 10.0.0.0/8; fragment [ not-a-fragment ]; } then { accept; } }", want: "src 10.0.0.0/8 frag !isf"},
+		{cmd: "withdraw flow route { match { destination 2001:db8::/32/0; next-header =6; } }", want: "dst 2001:db8::/32 proto tcp"},
+		{cmd: "announce route 192.0.2.0/24 next-hop self", wantErr: ErrSyntax},
+		{cmd: "announce flow route destination 192.0.2.0/24 color red", wantErr: ErrSyntax},
+		{cmd: "announce flow route destination 192.0.2.0/24 destination 192.0.2.0/25", wantErr: fs.ErrDuplicateComponent},
+		{cmd: "announce flow route destination 2001:db8::/32/8", wantErr: ErrUnsupportedComponent},
+		{cmd: "announce flow route destination-port [ =80", wantErr: ErrSyntax},
+	}
+	for _, tt := range tests {
+		u, err := Parse(tt.cmd)
+		if tt.wantErr != nil {
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Parse(%q) error = %v, want %v", tt.cmd, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Parse(%q) error = %v", tt.cmd, err)
+			continue
+		}
+		want, err := fs.ParseComponents(tt.want)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if u.Components.Canonical(nil) != want.Canonical(nil) {
+			t.Errorf("Parse(%q) = %s, want %s", tt.cmd, u.Components, want)
+		}
+	}
+}
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, nil)
+	list, acts, err := actions.ParseRule("dst 192.0.2.0/24 then discard")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := w.Send(ctx, announce.Update{Components: list, Actions: acts}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Send(ctx, announce.Update{Withdraw: true, Components: list}); err != nil {
+		t.Fatal(err)
+	}
+	updates, err := ReadCommands(strings.NewReader("# replay\n" + buf.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(updates) != 2 || updates[0].Withdraw || !updates[1].Withdraw || len(updates[0].Actions) != 1 {
+		t.Errorf("ReadCommands() = %+v", updates)
+	}
+}
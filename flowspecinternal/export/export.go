@@ -0,0 +1,151 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+// Package export dumps the rule table of a FlowSpecRIB with its validation
+// state, traffic counters and metadata for offline analytics and archiving,
+// as CSV or Parquet:
+//
+//	recs := export.Records(local, nil)
+//	err := export.WriteParquet(f, recs)
+//
+// Both formats have the columns of Columns, one row per rule in the order
+// of a snapshot. Timestamps are UTC, in RFC 3339 in CSV and milliseconds
+// since the epoch in Parquet; columns without a value are empty or null.
+// Metadata is a JSON object.
+package export
+
+import (
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/actions"
+	"floofspectools/flowspecinternal/rib"
+)
+
+// Columns are the column names of the exports, in order.
+var Columns = []string{
+	"id", "family", "rd", "match", "actions", "neighbor_as",
+	"feasible", "reason", "error", "stale_until", "expires",
+	"packets", "bytes", "last_match", "metadata",
+}
+
+// Options configures Records.
+type Options struct {
+	// Window is the period the traffic counters sum up, defaults to
+	// rib.DefaultAccountingRetention. See rib.FlowSpecRIB.Traffic.
+	Window time.Duration
+}
+
+// Record is the row of a rule.
+type Record struct {
+	// ID is the rule id of the HTTP API, the unpadded base64url of the
+	// rib.FlowSpecKey.
+	ID     string
+	Family string // ipv4 or ipv6
+	// RD is the route distinguisher of a FlowSpec VPN rule.
+	RD         string
+	Match      string
+	Actions    string
+	NeighborAS uint32
+	Feasible   bool
+	// Reason and Error tell why an infeasible rule is, see fs.Reason.
+	Reason     string
+	Error      string
+	StaleUntil time.Time
+	Expires    time.Time
+	Packets    uint64
+	Bytes      uint64
+	LastMatch  time.Time
+	Metadata   map[string]string
+}
+
+// Records returns the rows of the rules of r.
+func Records(r *rib.FlowSpecRIB, opts *Options) []Record {
+	var o Options
+	if opts != nil {
+		o = *opts
+	}
+	if o.Window <= 0 {
+		o.Window = rib.DefaultAccountingRetention
+	}
+	var out []Record
+	for e := range r.Snapshot().All() {
+		route := e.Route
+		var acts []actions.Action
+		for _, ec := range route.ExtCommunities {
+			if a, err := actions.Decode(ec); err == nil {
+				acts = append(acts, a)
+			}
+		}
+		rec := Record{
+			ID:         base64.RawURLEncoding.EncodeToString([]byte(e.Key)),
+			Family:     "ipv4",
+			Match:      route.Components.String(),
+			Actions:    actions.Canonical(acts),
+			NeighborAS: route.NeighborAS,
+			Feasible:   e.Err == nil,
+			StaleUntil: r.StaleUntil(route),
+			Expires:    r.Expiry(route),
+			LastMatch:  r.LastMatch(route),
+			Metadata:   route.Metadata,
+		}
+		if route.AFI == fs.AFIIPv6 {
+			rec.Family = "ipv6"
+		}
+		if route.SAFI == fs.SAFIFlowSpecVPN {
+			rec.RD = fs.FormatRD(route.RD)
+		}
+		if e.Err != nil {
+			rec.Reason, rec.Error = fs.Reason(e.Err), e.Err.Error()
+		}
+		c := r.Traffic(route, o.Window)
+		rec.Packets, rec.Bytes = c.Packets, c.Bytes
+		out = append(out, rec)
+	}
+	return out
+}
+
+// metadata returns m as a JSON object, "" if empty.
+func metadata(m map[string]string) string {
+	if len(m) == 0 {
+		return ""
+	}
+	b, _ := json.Marshal(m) // sorts the keys
+	return string(b)
+}
+
+func csvTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// WriteCSV writes recs as CSV with a header row of Columns.
+func WriteCSV(w io.Writer, recs []Record) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(Columns); err != nil {
+		return err
+	}
+	for _, r := range recs {
+		err := cw.Write([]string{
+			r.ID, r.Family, r.RD, r.Match, r.Actions,
+			strconv.FormatUint(uint64(r.NeighborAS), 10),
+			strconv.FormatBool(r.Feasible), r.Reason, r.Error,
+			csvTime(r.StaleUntil), csvTime(r.Expires),
+			strconv.FormatUint(r.Packets, 10), strconv.FormatUint(r.Bytes, 10),
+			csvTime(r.LastMatch), metadata(r.Metadata),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,271 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package export
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/csv"
+	"slices"
+	"testing"
+	"time"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/actions"
+	"floofspectools/flowspecinternal/rib"
+)
+
+var now = time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func testRIB(t *testing.T) *rib.FlowSpecRIB {
+	t.Helper()
+	r := rib.NewFlowSpecRIB(&rib.FlowSpecOptions{Now: func() time.Time { return now }})
+	for _, rule := range []struct {
+		s    string
+		err  error
+		meta map[string]string
+		ttl  time.Duration
+	}{
+		{"dst 192.0.2.0/24 proto udp then discard", nil, map[string]string{"ticket": "NOC-1", "customer": "acme"}, time.Hour},
+		{"dst 198.51.100.0/24 then rate-limit 10M", fs.ErrNoBestUnicast, nil, 0},
+		{"dst 2001:db8::/32", nil, nil, 0},
+	} {
+		list, acts, err := actions.ParseRule(rule.s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		route := &fs.FlowSpecRoute{AFI: fs.AFIIPv4, SAFI: fs.SAFIFlowSpec, Components: list, NeighborAS: 65001, Metadata: rule.meta}
+		if list.Components[0].Prefix.Addr().Is6() {
+			route.AFI = fs.AFIIPv6
+		}
+		for _, a := range acts {
+			route.ExtCommunities = append(route.ExtCommunities, a.ExtendedCommunity())
+		}
+		r.InsertWithLifetime(route, rule.err, rib.Lifetime{TTL: rule.ttl})
+		if rule.ttl > 0 {
+			r.ReportCounters("r1", route, now.Add(-2*time.Minute), rib.Counters{Packets: 10, Bytes: 1000})
+			r.ReportCounters("r1", route, now.Add(-time.Minute), rib.Counters{Packets: 15, Bytes: 1500})
+		}
+	}
+	return r
+}
+
+func TestRecords(t *testing.T) {
+	recs := Records(testRIB(t), nil)
+	if len(recs) != 3 {
+		t.Fatalf("Records() returned %d records, want 3", len(recs))
+	}
+	r := recs[0]
+	if r.Match != "dst 192.0.2.0/24 proto udp" || r.Actions != "discard" || r.Family != "ipv4" || !r.Feasible || r.NeighborAS != 65001 {
+		t.Errorf("Records()[0] = %+v", r)
+	}
+	if r.Packets != 5 || r.Bytes != 500 || !r.LastMatch.Equal(now.Add(-time.Minute)) || !r.Expires.Equal(now.Add(time.Hour)) {
+		t.Errorf("Records()[0] traffic %d/%d, last match %v, expires %v", r.Packets, r.Bytes, r.LastMatch, r.Expires)
+	}
+	if r := recs[1]; r.Feasible || r.Reason != "no-best-unicast" || r.Actions != "rate-bytes=10000000" {
+		t.Errorf("Records()[1] = %+v", r)
+	}
+	if r := recs[2]; r.Family != "ipv6" || r.Actions != "accept" || !r.Expires.IsZero() {
+		t.Errorf("Records()[2] = %+v", r)
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	var b bytes.Buffer
+	if err := WriteCSV(&b, Records(testRIB(t), nil)); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(&b).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 4 || !slices.Equal(rows[0], Columns) {
+		t.Fatalf("WriteCSV() = %q", rows)
+	}
+	row := map[string]string{}
+	for i, c := range Columns {
+		row[c] = rows[1][i]
+	}
+	for c, want := range map[string]string{
+		"match":      "dst 192.0.2.0/24 proto udp",
+		"feasible":   "true",
+		"rd":         "",
+		"expires":    "2025-03-01T13:00:00Z",
+		"packets":    "5",
+		"last_match": "2025-03-01T11:59:00Z",
+		"metadata":   `{"customer":"acme","ticket":"NOC-1"}`,
+	} {
+		if row[c] != want {
+			t.Errorf("column %s = %q, want %q", c, row[c], want)
+		}
+	}
+}
+
+// treader decodes the Thrift compact protocol into maps by field id.
+type treader struct {
+	b []byte
+	t *testing.T
+}
+
+func (r *treader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.b)
+	if n <= 0 {
+		r.t.Fatal("bad varint")
+	}
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *treader) value(typ byte) any {
+	switch typ {
+	case tTrue, tFalse:
+		return typ == tTrue
+	case tI32, tI64:
+		v := r.uvarint()
+		return int64(v>>1) ^ -int64(v&1)
+	case tBinary:
+		n := r.uvarint()
+		s := string(r.b[:n])
+		r.b = r.b[n:]
+		return s
+	case tList:
+		h := r.b[0]
+		r.b = r.b[1:]
+		n := uint64(h >> 4)
+		if n == 15 {
+			n = r.uvarint()
+		}
+		var out []any
+		for range n {
+			out = append(out, r.value(h&0x0f))
+		}
+		return out
+	case tStruct:
+		return r.strct()
+	}
+	r.t.Fatalf("unexpected type %d", typ)
+	return nil
+}
+
+func (r *treader) strct() map[int16]any {
+	out := map[int16]any{}
+	var id int16
+	for {
+		h := r.b[0]
+		r.b = r.b[1:]
+		if h == 0 {
+			return out
+		}
+		if d := h >> 4; d != 0 {
+			id += int16(d)
+		} else {
+			v := r.uvarint()
+			id = int16(v>>1) ^ -int16(v&1)
+		}
+		out[id] = r.value(h & 0x0f)
+	}
+}
+
+// readColumn decodes the values of a column chunk, nil for nulls.
+func readColumn(t *testing.T, file []byte, meta map[int16]any, c *column) []any {
+	r := &treader{b: file[meta[9].(int64):], t: t}
+	h := r.strct()
+	rows := int(h[5].(map[int16]any)[1].(int64))
+	data := r.b[:h[2].(int64)]
+	defined := make([]bool, rows)
+	for i := range defined {
+		defined[i] = true
+	}
+	if c.optional {
+		n := binary.LittleEndian.Uint32(data)
+		levels := &treader{b: data[4 : 4+n], t: t}
+		if hdr := levels.uvarint(); hdr&1 != 1 {
+			t.Fatalf("%s: definition levels not bit-packed", c.name)
+		}
+		for i := range defined {
+			defined[i] = levels.b[i/8]&(1<<(i%8)) != 0
+		}
+		data = data[4+n:]
+	}
+	var out []any
+	bit := 0
+	for _, d := range defined {
+		if !d {
+			out = append(out, nil)
+			continue
+		}
+		switch c.kind {
+		case kindString, kindJSON:
+			n := binary.LittleEndian.Uint32(data)
+			out = append(out, string(data[4:4+n]))
+			data = data[4+n:]
+		case kindInt:
+			out = append(out, int64(binary.LittleEndian.Uint64(data)))
+			data = data[8:]
+		case kindTime:
+			out = append(out, time.UnixMilli(int64(binary.LittleEndian.Uint64(data))).UTC())
+			data = data[8:]
+		case kindBool:
+			out = append(out, data[bit/8]&(1<<(bit%8)) != 0)
+			bit++
+		}
+	}
+	return out
+}
+
+func TestWriteParquet(t *testing.T) {
+	var b bytes.Buffer
+	if err := WriteParquet(&b, Records(testRIB(t), nil)); err != nil {
+		t.Fatal(err)
+	}
+	file := b.Bytes()
+	if !bytes.HasPrefix(file, []byte("PAR1")) || !bytes.HasSuffix(file, []byte("PAR1")) {
+		t.Fatal("missing magic")
+	}
+	n := binary.LittleEndian.Uint32(file[len(file)-8:])
+	r := &treader{b: file[len(file)-8-int(n) : len(file)-8], t: t}
+	meta := r.strct()
+	if len(r.b) != 0 {
+		t.Errorf("%d bytes after FileMetaData", len(r.b))
+	}
+	if meta[3] != int64(3) {
+		t.Errorf("num_rows = %v, want 3", meta[3])
+	}
+	var names []string
+	for _, e := range meta[2].([]any)[1:] {
+		names = append(names, e.(map[int16]any)[4].(string))
+	}
+	if !slices.Equal(names, Columns) {
+		t.Errorf("schema = %q, want %q", names, Columns)
+	}
+	groups := meta[4].([]any)
+	if len(groups) != 1 {
+		t.Fatalf("%d row groups, want 1", len(groups))
+	}
+	chunks := groups[0].(map[int16]any)[1].([]any)
+	got := map[string][]any{}
+	for i := range schema {
+		got[schema[i].name] = readColumn(t, file, chunks[i].(map[int16]any)[3].(map[int16]any), &schema[i])
+	}
+	for c, want := range map[string][]any{
+		"family":     {"ipv4", "ipv4", "ipv6"},
+		"actions":    {"discard", "rate-bytes=10000000", "accept"},
+		"feasible":   {true, false, true},
+		"reason":     {nil, "no-best-unicast", nil},
+		"packets":    {int64(5), int64(0), int64(0)},
+		"expires":    {now.Add(time.Hour), nil, nil},
+		"metadata":   {`{"customer":"acme","ticket":"NOC-1"}`, nil, nil},
+		"last_match": {now.Add(-time.Minute), nil, nil},
+	} {
+		if !slices.Equal(got[c], want) {
+			t.Errorf("column %s = %v, want %v", c, got[c], want)
+		}
+	}
+
+	b.Reset()
+	if err := WriteParquet(&b, nil); err != nil || !bytes.HasSuffix(b.Bytes(), []byte("PAR1")) {
+		t.Errorf("WriteParquet(nil) = %v", err)
+	}
+}
@@ -0,0 +1,371 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package export
+
+import (
+	"encoding/binary"
+	"io"
+	"time"
+)
+
+// The subset of the Parquet format WriteParquet needs: flat schemas of
+// uncompressed, PLAIN encoded columns with one data page (v1) per column
+// chunk, described by Thrift compact protocol metadata, see
+// https://github.com/apache/parquet-format.
+
+const parquetMagic = "PAR1"
+
+// rowGroupRows bounds the rows of a row group, so readers can process
+// large tables in parts.
+const rowGroupRows = 1 << 16
+
+// Physical types.
+const (
+	typeBoolean   = 0
+	typeInt64     = 2
+	typeByteArray = 6
+)
+
+// Converted types, for readers predating logical types.
+const (
+	convertedUTF8            = 0
+	convertedTimestampMillis = 9
+	convertedJSON            = 19
+)
+
+const (
+	encodingPlain = 0
+	encodingRLE   = 3
+)
+
+type kind int
+
+const (
+	kindString kind = iota
+	kindJSON
+	kindInt
+	kindBool
+	kindTime
+)
+
+type column struct {
+	name string
+	kind kind
+	// optional columns are null when value returns false.
+	optional bool
+	value    func(r *Record) (any, bool)
+}
+
+func str(f func(r *Record) string) func(r *Record) (any, bool) {
+	return func(r *Record) (any, bool) { s := f(r); return s, s != "" }
+}
+
+func timestamp(f func(r *Record) time.Time) func(r *Record) (any, bool) {
+	return func(r *Record) (any, bool) { t := f(r); return t, !t.IsZero() }
+}
+
+func integer(f func(r *Record) uint64) func(r *Record) (any, bool) {
+	return func(r *Record) (any, bool) { return int64(f(r)), true }
+}
+
+// schema holds the columns in the order of Columns.
+var schema = []column{
+	{"id", kindString, false, str(func(r *Record) string { return r.ID })},
+	{"family", kindString, false, str(func(r *Record) string { return r.Family })},
+	{"rd", kindString, true, str(func(r *Record) string { return r.RD })},
+	{"match", kindString, false, str(func(r *Record) string { return r.Match })},
+	{"actions", kindString, false, str(func(r *Record) string { return r.Actions })},
+	{"neighbor_as", kindInt, false, integer(func(r *Record) uint64 { return uint64(r.NeighborAS) })},
+	{"feasible", kindBool, false, func(r *Record) (any, bool) { return r.Feasible, true }},
+	{"reason", kindString, true, str(func(r *Record) string { return r.Reason })},
+	{"error", kindString, true, str(func(r *Record) string { return r.Error })},
+	{"stale_until", kindTime, true, timestamp(func(r *Record) time.Time { return r.StaleUntil })},
+	{"expires", kindTime, true, timestamp(func(r *Record) time.Time { return r.Expires })},
+	{"packets", kindInt, false, integer(func(r *Record) uint64 { return r.Packets })},
+	{"bytes", kindInt, false, integer(func(r *Record) uint64 { return r.Bytes })},
+	{"last_match", kindTime, true, timestamp(func(r *Record) time.Time { return r.LastMatch })},
+	{"metadata", kindJSON, true, str(func(r *Record) string { return metadata(r.Metadata) })},
+}
+
+func (c *column) physical() int32 {
+	switch c.kind {
+	case kindInt, kindTime:
+		return typeInt64
+	case kindBool:
+		return typeBoolean
+	}
+	return typeByteArray
+}
+
+// page returns the data page of recs in c: the definition levels of an
+// optional column followed by the values.
+func (c *column) page(recs []Record) []byte {
+	var defined, bools []bool
+	var vals []byte
+	for i := range recs {
+		v, ok := c.value(&recs[i])
+		if c.optional {
+			defined = append(defined, ok)
+			if !ok {
+				continue
+			}
+		}
+		switch v := v.(type) {
+		case string:
+			vals = binary.LittleEndian.AppendUint32(vals, uint32(len(v)))
+			vals = append(vals, v...)
+		case int64:
+			vals = binary.LittleEndian.AppendUint64(vals, uint64(v))
+		case time.Time:
+			vals = binary.LittleEndian.AppendUint64(vals, uint64(v.UnixMilli()))
+		case bool:
+			bools = append(bools, v)
+		}
+	}
+	var out []byte
+	if c.optional {
+		// RLE/bit-packing hybrid of bit width 1 in a single bit-packed run,
+		// prefixed by its length.
+		levels := binary.AppendUvarint(nil, uint64((len(defined)+7)/8)<<1|1)
+		levels = append(levels, packBits(defined)...)
+		out = binary.LittleEndian.AppendUint32(out, uint32(len(levels)))
+		out = append(out, levels...)
+	}
+	if c.kind == kindBool {
+		vals = packBits(bools)
+	}
+	return append(out, vals...)
+}
+
+// packBits packs b least significant bit first.
+func packBits(b []bool) []byte {
+	out := make([]byte, (len(b)+7)/8)
+	for i, v := range b {
+		if v {
+			out[i/8] |= 1 << (i % 8)
+		}
+	}
+	return out
+}
+
+// thrift encodes structs in the Thrift compact protocol.
+type thrift struct {
+	b []byte
+	// last holds the last field id of each open struct.
+	last []int16
+}
+
+// Compact protocol types.
+const (
+	tTrue   = 1
+	tFalse  = 2
+	tI32    = 5
+	tI64    = 6
+	tBinary = 8
+	tList   = 9
+	tStruct = 12
+)
+
+func (t *thrift) begin() { t.last = append(t.last, 0) }
+
+func (t *thrift) end() {
+	t.b = append(t.b, 0)
+	t.last = t.last[:len(t.last)-1]
+}
+
+func (t *thrift) field(id int16, typ byte) {
+	last := &t.last[len(t.last)-1]
+	if d := id - *last; d > 0 && d <= 15 {
+		t.b = append(t.b, byte(d)<<4|typ)
+	} else {
+		t.b = append(t.b, typ)
+		t.b = binary.AppendVarint(t.b, int64(id))
+	}
+	*last = id
+}
+
+func (t *thrift) i32(id int16, v int32) {
+	t.field(id, tI32)
+	t.b = binary.AppendVarint(t.b, int64(v))
+}
+
+func (t *thrift) i64(id int16, v int64) {
+	t.field(id, tI64)
+	t.b = binary.AppendVarint(t.b, v)
+}
+
+func (t *thrift) bool(id int16, v bool) {
+	if v {
+		t.field(id, tTrue)
+	} else {
+		t.field(id, tFalse)
+	}
+}
+
+func (t *thrift) string(id int16, s string) {
+	t.field(id, tBinary)
+	t.b = binary.AppendUvarint(t.b, uint64(len(s)))
+	t.b = append(t.b, s...)
+}
+
+// structField opens the struct field id, closed by end.
+func (t *thrift) structField(id int16) {
+	t.field(id, tStruct)
+	t.begin()
+}
+
+// list starts the list field id of n elements of typ. Struct elements are
+// written with begin and end.
+func (t *thrift) list(id int16, typ byte, n int) {
+	t.field(id, tList)
+	if n < 15 {
+		t.b = append(t.b, byte(n)<<4|typ)
+	} else {
+		t.b = append(t.b, 0xf0|typ)
+		t.b = binary.AppendUvarint(t.b, uint64(n))
+	}
+}
+
+// schemaElement writes the SchemaElement of c.
+func (t *thrift) schemaElement(c *column) {
+	t.begin()
+	t.i32(1, c.physical())
+	repetition := int32(0) // REQUIRED
+	if c.optional {
+		repetition = 1 // OPTIONAL
+	}
+	t.i32(3, repetition)
+	t.string(4, c.name)
+	switch c.kind {
+	case kindString:
+		t.i32(6, convertedUTF8)
+		t.structField(10)
+		t.structField(1) // STRING
+		t.end()
+		t.end()
+	case kindJSON:
+		t.i32(6, convertedJSON)
+		t.structField(10)
+		t.structField(12) // JSON
+		t.end()
+		t.end()
+	case kindTime:
+		t.i32(6, convertedTimestampMillis)
+		t.structField(10)
+		t.structField(8) // TIMESTAMP
+		t.bool(1, true)  // isAdjustedToUTC
+		t.structField(2) // unit
+		t.structField(1) // MILLIS
+		t.end()
+		t.end()
+		t.end()
+		t.end()
+	}
+	t.end()
+}
+
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countWriter) Write(b []byte) (int, error) {
+	n, err := w.w.Write(b)
+	w.n += int64(n)
+	return n, err
+}
+
+type chunk struct {
+	offset, size int64
+}
+
+// WriteParquet writes recs as a Parquet file of uncompressed row groups of
+// up to 65536 rows.
+func WriteParquet(w io.Writer, recs []Record) error {
+	cw := &countWriter{w: w}
+	if _, err := io.WriteString(cw, parquetMagic); err != nil {
+		return err
+	}
+	var groups [][]chunk
+	for start := 0; start < len(recs); start += rowGroupRows {
+		rows := recs[start:min(start+rowGroupRows, len(recs))]
+		var chunks []chunk
+		for i := range schema {
+			data := schema[i].page(rows)
+			var h thrift
+			// PageHeader of a DATA_PAGE
+			h.begin()
+			h.i32(1, 0)
+			h.i32(2, int32(len(data)))
+			h.i32(3, int32(len(data)))
+			h.structField(5) // DataPageHeader
+			h.i32(1, int32(len(rows)))
+			h.i32(2, encodingPlain)
+			h.i32(3, encodingRLE)
+			h.i32(4, encodingRLE)
+			h.end()
+			h.end()
+			c := chunk{offset: cw.n, size: int64(len(h.b) + len(data))}
+			if _, err := cw.Write(h.b); err != nil {
+				return err
+			}
+			if _, err := cw.Write(data); err != nil {
+				return err
+			}
+			chunks = append(chunks, c)
+		}
+		groups = append(groups, chunks)
+	}
+
+	var t thrift
+	t.begin() // FileMetaData
+	t.i32(1, 1)
+	t.list(2, tStruct, len(schema)+1)
+	t.begin()
+	t.string(4, "schema")
+	t.i32(5, int32(len(schema)))
+	t.end()
+	for i := range schema {
+		t.schemaElement(&schema[i])
+	}
+	t.i64(3, int64(len(recs)))
+	t.list(4, tStruct, len(groups))
+	for g, chunks := range groups {
+		rows := min(rowGroupRows, len(recs)-g*rowGroupRows)
+		var size int64
+		t.begin() // RowGroup
+		t.list(1, tStruct, len(chunks))
+		for i, c := range chunks {
+			size += c.size
+			t.begin() // ColumnChunk
+			t.i64(2, c.offset)
+			t.structField(3) // ColumnMetaData
+			t.i32(1, schema[i].physical())
+			t.list(2, tI32, 2)
+			t.b = binary.AppendVarint(t.b, encodingPlain)
+			t.b = binary.AppendVarint(t.b, encodingRLE)
+			t.list(3, tBinary, 1)
+			t.b = binary.AppendUvarint(t.b, uint64(len(schema[i].name)))
+			t.b = append(t.b, schema[i].name...)
+			t.i32(4, 0) // UNCOMPRESSED
+			t.i64(5, int64(rows))
+			t.i64(6, c.size)
+			t.i64(7, c.size)
+			t.i64(9, c.offset)
+			t.end()
+			t.end()
+		}
+		t.i64(2, size)
+		t.i64(3, int64(rows))
+		t.end()
+	}
+	t.string(6, "floofspectools")
+	t.end()
+
+	footer := binary.LittleEndian.AppendUint32(t.b, uint32(len(t.b)))
+	footer = append(footer, parquetMagic...)
+	_, err := cw.Write(footer)
+	return err
+}
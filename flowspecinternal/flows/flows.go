@@ -0,0 +1,330 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+// Package flows proposes rate-limit rules from the top talkers of a flow
+// collector, aggregated NetFlow or IPFIX records as exported by e.g.
+// nfdump or pmacct.
+//
+// Attack traffic rarely comes as a few large flows: a reflection attack
+// is thousands of sources toward one address, a carpet bombing one source
+// port toward a whole prefix. Propose therefore aggregates before it
+// proposes anything, so that the candidates stay within what a router's
+// FlowSpec table holds:
+//
+//   - ports above Options.MaxServicePort are taken to be ephemeral and
+//     not matched, leaving the service side of a flow
+//   - destinations are merged into their covering /24 (IPv4) or /48
+//     (IPv6) once Options.MinDestinations of them see the same traffic
+//   - sources are merged likewise, and not matched at all when more than
+//     Options.MaxSources remain
+//
+// The candidates are proposals for an operator or a pipeline to review,
+// e.g. with package analysis, before they are announced.
+package flows
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"slices"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/actions"
+)
+
+var (
+	ErrInvalidRecord = errors.New("flows: record needs a destination prefix and a source of the same family")
+)
+
+// Defaults of Options.
+const (
+	DefaultMaxServicePort  = 1023
+	DefaultAggregateBits4  = 24
+	DefaultAggregateBits6  = 48
+	DefaultMinDestinations = 4
+	DefaultMaxSources      = 4
+	DefaultMaxRules        = 100
+	DefaultRateFraction    = 0.1
+)
+
+// IP protocols whose ports are matched.
+const (
+	protoTCP = 6
+	protoUDP = 17
+)
+
+// Record is an aggregated flow record. Zero ports and an invalid Src
+// match any.
+type Record struct {
+	Protocol uint8        `json:"proto"`
+	Src      netip.Prefix `json:"src,omitzero"`
+	Dst      netip.Prefix `json:"dst"`
+	SrcPort  uint16       `json:"sport,omitempty"`
+	DstPort  uint16       `json:"dport,omitempty"`
+	// BPS and PPS are the observed bits and packets per second.
+	BPS float64 `json:"bps"`
+	PPS float64 `json:"pps"`
+}
+
+// Check returns ErrInvalidRecord if r has no destination or its source is
+// of another address family.
+func (r Record) Check() error {
+	if !r.Dst.IsValid() || r.Src.IsValid() && r.Src.Addr().Is4() != r.Dst.Addr().Is4() {
+		return fmt.Errorf("%w: %v -> %v", ErrInvalidRecord, r.Src, r.Dst)
+	}
+	return nil
+}
+
+// ReadRecords reads a stream of JSON records, e.g. one per line:
+//
+//	{"proto": 17, "src": "198.51.100.7/32", "dst": "192.0.2.10/32", "sport": 123, "bps": 8e8, "pps": 1e5}
+func ReadRecords(r io.Reader) ([]Record, error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	var out []Record
+	for {
+		var rec Record
+		err := dec.Decode(&rec)
+		if err == io.EOF {
+			return out, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("flows: record %d: %w", len(out)+1, err)
+		}
+		if err := rec.Check(); err != nil {
+			return nil, err
+		}
+		out = append(out, rec)
+	}
+}
+
+// Options configures Propose. Zero values select the defaults.
+type Options struct {
+	// MinBPS and MinPPS are the traffic a candidate must carry, either
+	// suffices. Both zero propose every aggregate.
+	MinBPS float64
+	MinPPS float64
+	// MaxServicePort is the largest port matched, larger ones are
+	// ephemeral. Use 65535 to match all.
+	MaxServicePort uint16
+	// AggregateBits4 and AggregateBits6 are the lengths of the prefixes
+	// destinations and sources are merged into.
+	AggregateBits4 int
+	AggregateBits6 int
+	// MinDestinations is the number of destinations within an aggregate
+	// seeing the same traffic for them to be merged into it.
+	MinDestinations int
+	// MaxSources is the number of source aggregates above which a
+	// candidate matches any source.
+	MaxSources int
+	// MaxRules bounds the candidates, those carrying the most traffic are
+	// kept.
+	MaxRules int
+	// Rate, if positive, is the limit of every candidate in bytes per
+	// second. Otherwise candidates are limited to RateFraction of their
+	// observed traffic, in packets if the records carry no BPS.
+	Rate         float32
+	RateFraction float64
+	// AS is the informational AS of the rate-limit actions.
+	AS uint16
+}
+
+// Candidate is a proposed rule with the traffic it would have matched.
+type Candidate struct {
+	Rule    actions.Rule
+	BPS     float64
+	PPS     float64
+	Records int // flow records aggregated into it
+}
+
+// key identifies traffic that can share a rule, but for its sources.
+type key struct {
+	proto        uint8
+	sport, dport uint16
+	dst          netip.Prefix
+}
+
+type traffic struct {
+	bps, pps float64
+	records  int
+}
+
+func (t *traffic) add(u traffic) {
+	t.bps += u.bps
+	t.pps += u.pps
+	t.records += u.records
+}
+
+// aggregate is the traffic of a key by source aggregate, the invalid
+// prefix standing for unknown sources.
+type aggregate map[netip.Prefix]*traffic
+
+func (a aggregate) add(src netip.Prefix, t traffic) {
+	if a[src] == nil {
+		a[src] = new(traffic)
+	}
+	a[src].add(t)
+}
+
+// Propose returns the candidate rules for records, the ones carrying the
+// most traffic first. Records failing Check return ErrInvalidRecord.
+func Propose(records []Record, opts *Options) ([]Candidate, error) {
+	o := withDefaults(opts)
+	groups := make(map[key]aggregate)
+	for _, r := range records {
+		if err := r.Check(); err != nil {
+			return nil, err
+		}
+		k := key{proto: r.Protocol, dst: r.Dst.Masked()}
+		if r.Protocol == protoTCP || r.Protocol == protoUDP {
+			k.sport, k.dport = o.servicePort(r.SrcPort), o.servicePort(r.DstPort)
+		}
+		if groups[k] == nil {
+			groups[k] = make(aggregate)
+		}
+		groups[k].add(o.aggregate(r.Src.Masked()), traffic{r.BPS, r.PPS, 1})
+	}
+	mergeDestinations(groups, o)
+
+	var out []Candidate
+	for k, srcs := range groups {
+		if len(srcs) > o.MaxSources || srcs[netip.Prefix{}] != nil {
+			var t traffic
+			for _, s := range srcs {
+				t.add(*s)
+			}
+			srcs = aggregate{netip.Prefix{}: &t}
+		}
+		for src, t := range srcs {
+			if t.bps <= 0 && t.pps <= 0 || (o.MinBPS > 0 || o.MinPPS > 0) && t.bps < o.MinBPS && t.pps < o.MinPPS {
+				continue
+			}
+			out = append(out, Candidate{Rule: o.rule(k, src, *t), BPS: t.bps, PPS: t.pps, Records: t.records})
+		}
+	}
+	slices.SortFunc(out, func(a, b Candidate) int {
+		if c := cmp.Compare(b.BPS, a.BPS); c != 0 {
+			return c
+		}
+		return fs.CompareFlowSpecKey(a.Rule.Components, b.Rule.Components)
+	})
+	if len(out) > o.MaxRules {
+		out = out[:o.MaxRules]
+	}
+	return out, nil
+}
+
+// mergeDestinations merges the groups whose destinations lie within the
+// same aggregate, if there are at least MinDestinations of them.
+func mergeDestinations(groups map[key]aggregate, o Options) {
+	within := make(map[key][]key)
+	for k := range groups {
+		ak := k
+		ak.dst = o.aggregate(k.dst)
+		if ak.dst != k.dst {
+			within[ak] = append(within[ak], k)
+		}
+	}
+	for ak, ks := range within {
+		if len(ks) < o.MinDestinations {
+			continue
+		}
+		if groups[ak] == nil {
+			groups[ak] = make(aggregate)
+		}
+		for _, k := range ks {
+			for src, t := range groups[k] {
+				groups[ak].add(src, *t)
+			}
+			delete(groups, k)
+		}
+	}
+}
+
+func withDefaults(opts *Options) Options {
+	var o Options
+	if opts != nil {
+		o = *opts
+	}
+	if o.MaxServicePort == 0 {
+		o.MaxServicePort = DefaultMaxServicePort
+	}
+	if o.AggregateBits4 <= 0 || o.AggregateBits4 > 32 {
+		o.AggregateBits4 = DefaultAggregateBits4
+	}
+	if o.AggregateBits6 <= 0 || o.AggregateBits6 > 128 {
+		o.AggregateBits6 = DefaultAggregateBits6
+	}
+	if o.MinDestinations <= 0 {
+		o.MinDestinations = DefaultMinDestinations
+	}
+	if o.MaxSources <= 0 {
+		o.MaxSources = DefaultMaxSources
+	}
+	if o.MaxRules <= 0 {
+		o.MaxRules = DefaultMaxRules
+	}
+	if o.RateFraction <= 0 {
+		o.RateFraction = DefaultRateFraction
+	}
+	return o
+}
+
+func (o Options) servicePort(p uint16) uint16 {
+	if p > o.MaxServicePort {
+		return 0
+	}
+	return p
+}
+
+// aggregate returns the aggregate p lies within, p itself if it is not
+// more specific.
+func (o Options) aggregate(p netip.Prefix) netip.Prefix {
+	bits := o.AggregateBits4
+	if p.Addr().Is6() {
+		bits = o.AggregateBits6
+	}
+	if !p.IsValid() || p.Bits() <= bits {
+		return p
+	}
+	a, _ := p.Addr().Prefix(bits)
+	return a
+}
+
+// rule returns the rule matching the traffic t of k from src, limited to
+// the rate of o. Records without bits per second are limited in packets.
+func (o Options) rule(k key, src netip.Prefix, t traffic) actions.Rule {
+	dst := k.dst
+	comps := []fs.FSComponent{{Type: fs.ComponentTypeDestinationPrefix, Prefix: &dst}}
+	if src.IsValid() {
+		comps = append(comps, fs.FSComponent{Type: fs.ComponentTypeSourcePrefix, Prefix: &src})
+	}
+	if k.proto != 0 {
+		comps = append(comps, numeric(fs.ComponentTypeIpProtocol, uint64(k.proto)))
+	}
+	if k.dport != 0 {
+		comps = append(comps, numeric(fs.ComponentTypeDestinationPort, uint64(k.dport)))
+	}
+	if k.sport != 0 {
+		comps = append(comps, numeric(fs.ComponentTypeSourcePort, uint64(k.sport)))
+	}
+	var limit actions.Action
+	switch {
+	case o.Rate > 0:
+		limit = actions.TrafficRateBytes{AS: o.AS, Rate: o.Rate}
+	case t.bps > 0:
+		limit = actions.TrafficRateBytes{AS: o.AS, Rate: float32(t.bps / 8 * o.RateFraction)}
+	default:
+		limit = actions.TrafficRatePackets{AS: o.AS, Rate: float32(t.pps * o.RateFraction)}
+	}
+	return actions.Rule{Components: fs.FSComponentList{Components: comps}, Actions: []actions.Action{limit}}
+}
+
+// numeric returns the component of type t matching v only.
+func numeric(t fs.ComponentType, v uint64) fs.FSComponent {
+	return fs.FSComponent{Type: t, Raw: fs.EncodeNumericOps([]fs.NumericOp{{EQ: true, Value: v}})}
+}
@@ -0,0 +1,123 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package flows
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"floofspectools/flowspecinternal/actions"
+)
+
+func TestPropose(t *testing.T) {
+	var in strings.Builder
+	// NTP reflection from 20 sources toward one address
+	for i := range 20 {
+		fmt.Fprintf(&in, `{"proto": 17, "src": "198.51.%d.7/32", "dst": "192.0.2.10/32", "sport": 123, "dport": %d, "bps": 4e7, "pps": 5000}`+"\n", i, 30000+i)
+	}
+	// SYN flood from two hosts of one /24 toward 5 web servers of a /24
+	for i := range 5 {
+		fmt.Fprintf(&in, `{"proto": 6, "src": "203.0.113.%d/32", "dst": "192.0.2.%d/32", "sport": 40000, "dport": 443, "bps": 1e7, "pps": 20000}`+"\n", i%2, 100+i)
+	}
+	// below the threshold
+	in.WriteString(`{"proto": 1, "src": "2001:db8:1::9/128", "dst": "2001:db8::/64", "bps": 1e3, "pps": 1}` + "\n")
+	// no bits per second
+	in.WriteString(`{"proto": 47, "dst": "198.51.100.0/24", "pps": 30000}` + "\n")
+
+	records, err := ReadRecords(strings.NewReader(in.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Propose(records, &Options{MinBPS: 1e6, MinPPS: 10000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		rule    string
+		records int
+	}{
+		{"match dst 192.0.2.10/32 proto udp sport 123 then rate-limit 1e+07", 20},
+		{"match dst 192.0.2.0/24 src 203.0.113.0/24 proto tcp dport 443 then rate-limit 625000", 5},
+		{"match dst 198.51.100.0/24 proto gre then rate-packets 3000", 1},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Propose() = %d candidates, want %d: %v", len(got), len(want), got)
+	}
+	for i, w := range want {
+		comps, acts, err := actions.ParseRule(w.rule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		g, want := actions.CanonicalRule(got[i].Rule.Components, got[i].Rule.Actions, nil), actions.CanonicalRule(comps, acts, nil)
+		if g != want || got[i].Records != w.records {
+			t.Errorf("Propose()[%d] = %s from %d records, want %s from %d", i, g, got[i].Records, want, w.records)
+		}
+	}
+
+	// without destination aggregation every server gets its rule
+	got, err = Propose(records, &Options{MinBPS: 1e6, MinPPS: 10000, MinDestinations: 6, MaxRules: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 4 || got[0].Records != 20 {
+		t.Errorf("Propose(MinDestinations: 6, MaxRules: 4) = %v, want the NTP rule and 3 SYN rules", got)
+	}
+}
+
+func TestReadRecordsErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want error
+	}{
+		{"NoDst", `{"proto": 17, "bps": 1}`, ErrInvalidRecord},
+		{"FamilyMismatch", `{"src": "2001:db8::1/128", "dst": "192.0.2.1/32"}`, ErrInvalidRecord},
+		{"UnknownField", `{"dst": "192.0.2.1/32", "bytes": 1}`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ReadRecords(strings.NewReader(tt.in))
+			if err == nil || tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("ReadRecords() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+type providerFunc func(context.Context) ([]Record, error)
+
+func (f providerFunc) TopTalkers(ctx context.Context) ([]Record, error) { return f(ctx) }
+
+func TestWatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errDown := errors.New("collector down")
+	calls := 0
+	p := providerFunc(func(context.Context) ([]Record, error) {
+		calls++
+		if calls == 1 {
+			return nil, errDown
+		}
+		return []Record{{Protocol: 17, Dst: netip.MustParsePrefix("192.0.2.10/32"), SrcPort: 53, BPS: 8e6}}, nil
+	})
+	var got []error
+	err := Watch(ctx, p, time.Millisecond, nil, func(cs []Candidate, err error) {
+		got = append(got, err)
+		if len(cs) == 1 {
+			cancel()
+		}
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Watch() = %v, want %v", err, context.Canceled)
+	}
+	if len(got) != 2 || !errors.Is(got[0], errDown) || got[1] != nil {
+		t.Errorf("Watch() reported %v, want the provider error and then a candidate", got)
+	}
+}
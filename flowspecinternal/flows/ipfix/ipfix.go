@@ -0,0 +1,375 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+// Package ipfix is a minimal IPFIX (RFC7011) collector feeding package
+// flows.
+//
+// A Collector learns the templates of its exporters and sums the octet and
+// packet counters of their data records per protocol, address and port
+// pair. As a flows.Provider it hands the sums out as top-talker records,
+// so detection and mitigation run in one process:
+//
+//	c := ipfix.NewCollector(nil)
+//	conn, _ := net.ListenPacket("udp", ":4739")
+//	go c.Serve(ctx, conn)
+//	flows.Watch(ctx, c, time.Minute, nil, announce)
+//
+// Only UDP transport is served. Options templates and the records of
+// options data sets are skipped, and counters are read as delta counts
+// whatever their information element says.
+package ipfix
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"log/slog"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/flows"
+)
+
+var (
+	ErrBadVersion = errors.New("ipfix: unsupported version")
+	ErrMalformed  = errors.New("ipfix: malformed message")
+)
+
+// Version is the IPFIX version number of the message header (RFC7011 3.1).
+const Version = 10
+
+// Set IDs (RFC7011 3.3.2). Data sets use the ID of their template, from
+// MinTemplateID up.
+const (
+	SetTemplate        = 2
+	SetOptionsTemplate = 3
+	MinTemplateID      = 256
+)
+
+// Information elements read from data records (IANA IPFIX registry).
+const (
+	IEOctetDeltaCount             = 1
+	IEPacketDeltaCount            = 2
+	IEProtocolIdentifier          = 4
+	IESourceTransportPort         = 7
+	IESourceIPv4Address           = 8
+	IESourceIPv4PrefixLength      = 9
+	IEDestinationTransportPort    = 11
+	IEDestinationIPv4Address      = 12
+	IEDestinationIPv4PrefixLength = 13
+	IESourceIPv6Address           = 27
+	IEDestinationIPv6Address      = 28
+	IESourceIPv6PrefixLength      = 29
+	IEDestinationIPv6PrefixLength = 30
+	IEOctetTotalCount             = 85
+	IEPacketTotalCount            = 86
+)
+
+const (
+	messageHeaderLen = 16
+	setHeaderLen     = 4
+	// maxMessageLen is the largest message, bounded by its 16 bit length
+	// field.
+	maxMessageLen = 0xffff
+	// ieEnterpriseBit marks an enterprise-specific field specifier, which
+	// is followed by the enterprise number (RFC7011 3.2).
+	ieEnterpriseBit = 0x8000
+	// varLength is the field length of variable-length fields (RFC7011 7).
+	varLength = 0xffff
+)
+
+// Options configures a Collector.
+type Options struct {
+	Logger *slog.Logger
+	// Now returns the current time, defaults to time.Now.
+	Now func() time.Time
+}
+
+// field is a field specifier of a template (RFC7011 3.2).
+type field struct {
+	ie         uint16
+	length     uint16
+	enterprise bool
+}
+
+type templateKey struct {
+	exporter string
+	domain   uint32
+	id       uint16
+}
+
+type counters struct {
+	octets, packets uint64
+}
+
+// Collector receives IPFIX messages and sums their flows. Its methods are
+// safe for concurrent use.
+type Collector struct {
+	log *slog.Logger
+	now func() time.Time
+
+	mu        sync.Mutex
+	templates map[templateKey][]field // nil fields for options templates
+	flows     map[flows.Record]*counters
+	since     time.Time
+}
+
+// NewCollector returns a Collector with opts, which may be nil.
+func NewCollector(opts *Options) *Collector {
+	var o Options
+	if opts != nil {
+		o = *opts
+	}
+	if o.Now == nil {
+		o.Now = time.Now
+	}
+	return &Collector{
+		log:       fs.SubsystemLogger(o.Logger, fs.SubsystemFlows),
+		now:       o.Now,
+		templates: make(map[templateKey][]field),
+		flows:     make(map[flows.Record]*counters),
+		since:     o.Now(),
+	}
+}
+
+// Serve reads messages from conn until ctx is done. Malformed messages are
+// logged and dropped.
+func (c *Collector) Serve(ctx context.Context, conn net.PacketConn) error {
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+	buf := make([]byte, maxMessageLen)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		if err := c.HandleMessage(addr.String(), buf[:n]); err != nil {
+			c.log.Warn("message dropped", "exporter", addr.String(), "error", err)
+		}
+	}
+}
+
+// HandleMessage processes one message from exporter, which scopes its
+// templates together with the observation domain.
+func (c *Collector) HandleMessage(exporter string, b []byte) error {
+	if len(b) < messageHeaderLen {
+		return ErrMalformed
+	}
+	if v := binary.BigEndian.Uint16(b); v != Version {
+		return ErrBadVersion
+	}
+	n := int(binary.BigEndian.Uint16(b[2:]))
+	if n < messageHeaderLen || n > len(b) {
+		return ErrMalformed
+	}
+	domain := binary.BigEndian.Uint32(b[12:])
+	b = b[messageHeaderLen:n]
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(b) > 0 {
+		if len(b) < setHeaderLen {
+			return ErrMalformed
+		}
+		id := binary.BigEndian.Uint16(b)
+		l := int(binary.BigEndian.Uint16(b[2:]))
+		if l < setHeaderLen || l > len(b) {
+			return ErrMalformed
+		}
+		body := b[setHeaderLen:l]
+		b = b[l:]
+		var err error
+		switch {
+		case id == SetTemplate || id == SetOptionsTemplate:
+			err = c.templateSet(exporter, domain, id == SetOptionsTemplate, body)
+		case id >= MinTemplateID:
+			err = c.dataSet(templateKey{exporter, domain, id}, body)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// templateSet records or withdraws the templates of a (options) template
+// set.
+func (c *Collector) templateSet(exporter string, domain uint32, options bool, b []byte) error {
+	hdr := 4
+	if options {
+		hdr = 6 // scope field count
+	}
+	// a record is at least its header, anything shorter is padding
+	for len(b) >= hdr {
+		id := binary.BigEndian.Uint16(b)
+		count := int(binary.BigEndian.Uint16(b[2:]))
+		k := templateKey{exporter, domain, id}
+		if count == 0 {
+			// template withdrawal (RFC7011 8.1)
+			delete(c.templates, k)
+			b = b[4:]
+			continue
+		}
+		if id < MinTemplateID {
+			return ErrMalformed
+		}
+		b = b[hdr:]
+		fields := make([]field, 0, count)
+		for range count {
+			if len(b) < 4 {
+				return ErrMalformed
+			}
+			f := field{ie: binary.BigEndian.Uint16(b), length: binary.BigEndian.Uint16(b[2:])}
+			b = b[4:]
+			if f.ie&ieEnterpriseBit != 0 {
+				if len(b) < 4 {
+					return ErrMalformed
+				}
+				f.ie &^= ieEnterpriseBit
+				f.enterprise = true
+				b = b[4:]
+			}
+			fields = append(fields, f)
+		}
+		if options {
+			fields = nil
+		}
+		c.templates[k] = fields
+	}
+	return nil
+}
+
+// dataSet adds the records of a data set to the flows. Sets of unknown
+// templates are dropped, as the template may still be on its way.
+func (c *Collector) dataSet(k templateKey, b []byte) error {
+	fields, ok := c.templates[k]
+	if !ok {
+		c.log.Debug("data set without template", "exporter", k.exporter, "domain", k.domain, "template", k.id)
+		return nil
+	}
+	if fields == nil {
+		return nil
+	}
+	minLen := 0
+	for _, f := range fields {
+		if f.length == varLength {
+			minLen++
+		} else {
+			minLen += int(f.length)
+		}
+	}
+	for len(b) >= max(minLen, 1) {
+		var (
+			rec             flows.Record
+			src, dst        netip.Addr
+			srcLen, dstLen  = -1, -1
+			octets, packets uint64
+		)
+		for _, f := range fields {
+			n := int(f.length)
+			if f.length == varLength {
+				if len(b) < 1 {
+					return ErrMalformed
+				}
+				n, b = int(b[0]), b[1:]
+				if n == 0xff {
+					if len(b) < 2 {
+						return ErrMalformed
+					}
+					n, b = int(binary.BigEndian.Uint16(b)), b[2:]
+				}
+			}
+			if len(b) < n {
+				return ErrMalformed
+			}
+			v := b[:n]
+			b = b[n:]
+			if f.enterprise {
+				continue
+			}
+			switch f.ie {
+			case IEOctetDeltaCount, IEOctetTotalCount:
+				octets = unsigned(v)
+			case IEPacketDeltaCount, IEPacketTotalCount:
+				packets = unsigned(v)
+			case IEProtocolIdentifier:
+				rec.Protocol = uint8(unsigned(v))
+			case IESourceTransportPort:
+				rec.SrcPort = uint16(unsigned(v))
+			case IEDestinationTransportPort:
+				rec.DstPort = uint16(unsigned(v))
+			case IESourceIPv4Address, IESourceIPv6Address:
+				src, _ = netip.AddrFromSlice(v)
+			case IEDestinationIPv4Address, IEDestinationIPv6Address:
+				dst, _ = netip.AddrFromSlice(v)
+			case IESourceIPv4PrefixLength, IESourceIPv6PrefixLength:
+				srcLen = int(unsigned(v))
+			case IEDestinationIPv4PrefixLength, IEDestinationIPv6PrefixLength:
+				dstLen = int(unsigned(v))
+			}
+		}
+		rec.Src, rec.Dst = prefix(src, srcLen), prefix(dst, dstLen)
+		if rec.Check() != nil {
+			continue
+		}
+		if c.flows[rec] == nil {
+			c.flows[rec] = new(counters)
+		}
+		c.flows[rec].octets += octets
+		c.flows[rec].packets += packets
+	}
+	return nil
+}
+
+// unsigned decodes a big endian unsigned integer of up to 8 bytes, which
+// may use reduced-size encoding (RFC7011 6.2).
+func unsigned(b []byte) uint64 {
+	var v uint64
+	for _, x := range b {
+		v = v<<8 | uint64(x)
+	}
+	return v
+}
+
+// prefix returns the prefix of a, of bits length if it is valid for the
+// family, or the host prefix.
+func prefix(a netip.Addr, bits int) netip.Prefix {
+	if !a.IsValid() {
+		return netip.Prefix{}
+	}
+	if bits < 0 || bits > a.BitLen() {
+		bits = a.BitLen()
+	}
+	p, _ := a.Prefix(bits)
+	return p
+}
+
+// TopTalkers implements flows.Provider: it returns the flows summed since
+// the previous call, or since NewCollector, and starts a new interval.
+func (c *Collector) TopTalkers(context.Context) ([]flows.Record, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	secs := now.Sub(c.since).Seconds()
+	c.since = now
+	if secs <= 0 {
+		secs = 1
+	}
+	out := make([]flows.Record, 0, len(c.flows))
+	for rec, n := range c.flows {
+		rec.BPS = float64(n.octets) * 8 / secs
+		rec.PPS = float64(n.packets) / secs
+		out = append(out, rec)
+	}
+	clear(c.flows)
+	return out, nil
+}
@@ -0,0 +1,176 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package ipfix
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"floofspectools/flowspecinternal/flows"
+)
+
+// message returns an IPFIX message of observation domain 1 with sets.
+func message(sets ...[]byte) []byte {
+	b := make([]byte, messageHeaderLen)
+	binary.BigEndian.PutUint16(b, Version)
+	binary.BigEndian.PutUint32(b[12:], 1)
+	for _, s := range sets {
+		b = append(b, s...)
+	}
+	binary.BigEndian.PutUint16(b[2:], uint16(len(b)))
+	return b
+}
+
+// set returns a set of id with the concatenated body parts.
+func set(id uint16, parts ...[]byte) []byte {
+	b := binary.BigEndian.AppendUint16(nil, id)
+	b = append(b, 0, 0)
+	for _, p := range parts {
+		b = append(b, p...)
+	}
+	binary.BigEndian.PutUint16(b[2:], uint16(len(b)))
+	return b
+}
+
+func u16(vs ...uint16) []byte {
+	var b []byte
+	for _, v := range vs {
+		b = binary.BigEndian.AppendUint16(b, v)
+	}
+	return b
+}
+
+// template 256: protocol, source and destination IPv4 address, ports,
+// reduced-size octet and packet counts and an enterprise field
+var template = set(SetTemplate, u16(256, 8,
+	IEProtocolIdentifier, 1,
+	IESourceIPv4Address, 4,
+	IEDestinationIPv4Address, 4,
+	IESourceTransportPort, 2,
+	IEDestinationTransportPort, 2,
+	IEOctetDeltaCount, 4,
+	IEPacketDeltaCount, 4,
+	ieEnterpriseBit|1, varLength), []byte{0, 0, 0x70, 0x1f})
+
+func record(src, dst string, sport, dport uint16, octets, packets uint32) []byte {
+	b := []byte{17}
+	b = append(b, netip.MustParseAddr(src).AsSlice()...)
+	b = append(b, netip.MustParseAddr(dst).AsSlice()...)
+	b = append(b, u16(sport, dport)...)
+	b = binary.BigEndian.AppendUint32(b, octets)
+	b = binary.BigEndian.AppendUint32(b, packets)
+	return append(b, 2, 0xaa, 0xbb) // enterprise field, variable length
+}
+
+func TestCollector(t *testing.T) {
+	now := time.Unix(0, 0)
+	c := NewCollector(&Options{Now: func() time.Time { return now }})
+
+	data := set(256,
+		record("198.51.100.7", "192.0.2.10", 123, 40000, 6e8, 1e6),
+		record("198.51.100.8", "192.0.2.10", 123, 40001, 3e8, 5e5),
+		record("198.51.100.7", "192.0.2.10", 123, 40000, 6e8, 1e6),
+		[]byte{0, 0, 0}, // padding
+	)
+	// data before its template is dropped
+	if err := c.HandleMessage("exporter", message(data)); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.HandleMessage("exporter", message(template, data)); err != nil {
+		t.Fatal(err)
+	}
+	// templates are per exporter
+	if err := c.HandleMessage("other", message(data)); err != nil {
+		t.Fatal(err)
+	}
+
+	now = now.Add(10 * time.Second)
+	got, err := c.TopTalkers(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := flows.Record{Protocol: 17, Src: netip.MustParsePrefix("198.51.100.7/32"), Dst: netip.MustParsePrefix("192.0.2.10/32"), SrcPort: 123, DstPort: 40000, BPS: 9.6e8, PPS: 2e5}
+	if len(got) != 2 || !containsRecord(got, want) {
+		t.Errorf("TopTalkers() = %+v, want 2 records with %+v", got, want)
+	}
+	if got, _ := c.TopTalkers(context.Background()); len(got) != 0 {
+		t.Errorf("TopTalkers() after TopTalkers = %+v, want none", got)
+	}
+
+	// withdrawn templates no longer apply
+	if err := c.HandleMessage("exporter", message(set(SetTemplate, u16(256, 0)), data)); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := c.TopTalkers(context.Background()); len(got) != 0 {
+		t.Errorf("TopTalkers() after withdrawal = %+v, want none", got)
+	}
+}
+
+func containsRecord(rs []flows.Record, r flows.Record) bool {
+	for _, x := range rs {
+		if x == r {
+			return true
+		}
+	}
+	return false
+}
+
+func TestHandleMessageErrors(t *testing.T) {
+	bad := message(template)
+	binary.BigEndian.PutUint16(bad, 9)
+	tests := []struct {
+		name string
+		msg  []byte
+		want error
+	}{
+		{"Short", []byte{0, 10}, ErrMalformed},
+		{"Version", bad, ErrBadVersion},
+		{"SetLength", message(u16(SetTemplate, 2)), ErrMalformed},
+		{"TruncatedTemplate", message(set(SetTemplate, u16(256, 2, IEProtocolIdentifier, 1))), ErrMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := NewCollector(nil).HandleMessage("exporter", tt.msg); !errors.Is(err, tt.want) {
+				t.Errorf("HandleMessage() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestServe(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	c := NewCollector(nil)
+	go func() { done <- c.Serve(ctx, conn) }()
+
+	out, err := net.Dial("udp", conn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	msg := message(template, set(256, record("198.51.100.7", "192.0.2.10", 123, 40000, 1500, 1)))
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); {
+		out.Write(msg)
+		time.Sleep(10 * time.Millisecond)
+		if got, _ := c.TopTalkers(ctx); len(got) > 0 {
+			cancel()
+			if err := <-done; !errors.Is(err, context.Canceled) {
+				t.Errorf("Serve() = %v, want %v", err, context.Canceled)
+			}
+			return
+		}
+	}
+	cancel()
+	t.Error("no records received")
+}
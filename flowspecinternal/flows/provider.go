@@ -0,0 +1,40 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package flows
+
+import (
+	"context"
+	"time"
+)
+
+// Provider supplies attack signals as flow records: a collector such as
+// ipfix.Collector, an sFlow agent or an external detection system.
+type Provider interface {
+	// TopTalkers returns the records of the traffic seen since the
+	// previous call, with BPS and PPS averaged over that interval.
+	TopTalkers(ctx context.Context) ([]Record, error)
+}
+
+// Watch asks p for its records every interval until ctx is done and calls
+// fn with the candidates proposed from them, or with the error of p or
+// Propose; a failing interval does not end the watch. It returns
+// ctx.Err().
+func Watch(ctx context.Context, p Provider, interval time.Duration, opts *Options, fn func([]Candidate, error)) error {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+		records, err := p.TopTalkers(ctx)
+		if err != nil {
+			fn(nil, err)
+			continue
+		}
+		fn(Propose(records, opts))
+	}
+}
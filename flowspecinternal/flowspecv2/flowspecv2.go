@@ -0,0 +1,194 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+// Package flowspecv2 is an experimental codec for the FlowSpec v2 NLRI of
+// draft-ietf-idr-flowspec-v2. A v2 NLRI carries a user-defined order, which
+// takes precedence over the RFC8955 5.1 ordering, and TLVs whose components
+// each carry their own length, so receivers can skip component types they do
+// not know:
+//
+//	NLRI      = length (2) | order (4) | TLV...
+//	TLV       = type (2) | length (2) | component...
+//	component = type (1) | length (1) | value
+//
+// Component values are those of RFC8955 and RFC8956, so rules share
+// fs.FSComponentList and the traffic filtering actions of the actions
+// package with FlowSpec v1. The draft has no SAFI assigned yet, the bgp
+// package does not negotiate v2.
+package flowspecv2
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"slices"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/actions"
+)
+
+var (
+	ErrMalformedNLRI = errors.New("flowspecv2: NLRI malformed: truncated, bad length or components out of order")
+	ErrTooLong       = errors.New("flowspecv2: NLRI, TLV or component value exceeds its length field")
+)
+
+// TLVIPFilter is the TLV type of the IP filter components.
+const TLVIPFilter uint16 = 1
+
+// maxNLRILength is the largest length the 2 octet NLRI length field can carry.
+const maxNLRILength = 0xffff
+
+// TLV is a TLV of a type this package does not decode, kept as is.
+type TLV struct {
+	Type  uint16
+	Value []byte
+}
+
+// Rule is a FlowSpec v2 rule. Rules with a lower Order take precedence,
+// rules of equal Order are ordered as per RFC8955 5.1.
+type Rule struct {
+	Order      uint32
+	Components fs.FSComponentList
+	Actions    []actions.Action // carried as extended communities, not in the NLRI
+	// Unknown holds the TLVs other than TLVIPFilter, in NLRI order.
+	Unknown []TLV
+}
+
+// FromV1 returns the v2 rule of a v1 rule with order.
+func FromV1(r actions.Rule, order uint32) Rule {
+	return Rule{Order: order, Components: r.Components, Actions: r.Actions}
+}
+
+// V1 returns the v1 rule of r, dropping its order and unknown TLVs.
+func (r Rule) V1() actions.Rule {
+	return actions.Rule{Components: r.Components, Actions: r.Actions}
+}
+
+// Compare orders rules by Order and then as per RFC8955 5.1, returning a
+// negative number if a takes precedence.
+func Compare(a, b Rule) int {
+	if a.Order != b.Order {
+		if a.Order < b.Order {
+			return -1
+		}
+		return 1
+	}
+	return fs.CompareFlowSpecKey(a.Components, b.Components)
+}
+
+// Sort sorts rules in-place by precedence.
+func Sort(rules []Rule) {
+	slices.SortStableFunc(rules, Compare)
+}
+
+// ExtendedCommunities returns the extended communities of r's actions.
+func (r Rule) ExtendedCommunities() [][8]byte {
+	out := make([][8]byte, 0, len(r.Actions))
+	for _, a := range r.Actions {
+		out = append(out, a.ExtendedCommunity())
+	}
+	return out
+}
+
+// Encode encodes the components of r, sorted by type, and its unknown TLVs
+// as one length-prefixed v2 NLRI.
+func Encode(r Rule, afi uint16) ([]byte, error) {
+	comps := slices.Clone(r.Components.Components)
+	slices.SortStableFunc(comps, func(a, b fs.FSComponent) int { return int(a.Type) - int(b.Type) })
+	var filter []byte
+	for _, c := range comps {
+		v, err := fs.EncodeComponents(fs.FSComponentList{Components: []fs.FSComponent{c}}, afi)
+		if err != nil {
+			return nil, err
+		}
+		v = v[1:] // the type octet
+		if len(v) > 0xff {
+			return nil, fmt.Errorf("%w: %s", ErrTooLong, c.Type)
+		}
+		filter = append(filter, byte(c.Type), byte(len(v)))
+		filter = append(filter, v...)
+	}
+	out := []byte{0, 0}
+	out = binary.BigEndian.AppendUint32(out, r.Order)
+	tlvs := append([]TLV{{Type: TLVIPFilter, Value: filter}}, r.Unknown...)
+	for _, t := range tlvs {
+		if len(t.Value) > 0xffff {
+			return nil, fmt.Errorf("%w: TLV %d", ErrTooLong, t.Type)
+		}
+		out = binary.BigEndian.AppendUint16(out, t.Type)
+		out = binary.BigEndian.AppendUint16(out, uint16(len(t.Value)))
+		out = append(out, t.Value...)
+	}
+	if len(out)-2 > maxNLRILength {
+		return nil, ErrTooLong
+	}
+	binary.BigEndian.PutUint16(out, uint16(len(out)-2))
+	return out, nil
+}
+
+// Decode decodes one length-prefixed v2 NLRI and returns the bytes consumed.
+// Components of types fs does not decode are kept with their value in Raw;
+// component types must be strictly increasing.
+func Decode(b []byte, afi uint16) (Rule, int, error) {
+	if len(b) < 6 {
+		return Rule{}, 0, ErrMalformedNLRI
+	}
+	n := int(binary.BigEndian.Uint16(b)) + 2
+	if n < 6 || len(b) < n {
+		return Rule{}, 0, ErrMalformedNLRI
+	}
+	r := Rule{Order: binary.BigEndian.Uint32(b[2:])}
+	for tlvs := b[6:n]; len(tlvs) > 0; {
+		if len(tlvs) < 4 {
+			return Rule{}, 0, ErrMalformedNLRI
+		}
+		typ, l := binary.BigEndian.Uint16(tlvs), int(binary.BigEndian.Uint16(tlvs[2:]))
+		if len(tlvs) < 4+l {
+			return Rule{}, 0, ErrMalformedNLRI
+		}
+		v := tlvs[4 : 4+l]
+		tlvs = tlvs[4+l:]
+		if typ != TLVIPFilter {
+			r.Unknown = append(r.Unknown, TLV{Type: typ, Value: slices.Clone(v)})
+			continue
+		}
+		comps, err := decodeComponents(v, afi)
+		if err != nil {
+			return Rule{}, 0, err
+		}
+		r.Components.Components = append(r.Components.Components, comps...)
+	}
+	return r, n, nil
+}
+
+func decodeComponents(b []byte, afi uint16) ([]fs.FSComponent, error) {
+	var out []fs.FSComponent
+	for len(b) > 0 {
+		if len(b) < 2 || len(b) < 2+int(b[1]) {
+			return nil, ErrMalformedNLRI
+		}
+		t, v := fs.ComponentType(b[0]), b[2:2+int(b[1])]
+		b = b[2+len(v):]
+		if n := len(out); n > 0 && out[n-1].Type >= t {
+			return nil, ErrMalformedNLRI
+		}
+		if !known(t, afi) {
+			out = append(out, fs.FSComponent{Type: t, Raw: slices.Clone(v)})
+			continue
+		}
+		// the value must decode as exactly one v1 component
+		l, err := fs.DecodeComponents(append([]byte{byte(t)}, v...), afi)
+		if err != nil || len(l.Components) != 1 {
+			return nil, fmt.Errorf("%w: %s value %x", ErrMalformedNLRI, t, v)
+		}
+		out = append(out, l.Components[0])
+	}
+	return out, nil
+}
+
+// known reports whether fs decodes components of type t in NLRI of afi.
+func known(t fs.ComponentType, afi uint16) bool {
+	return t >= fs.ComponentTypeDestinationPrefix && t <= fs.ComponentTypeFragment ||
+		afi == fs.AFIL2VPN && t.IsEthernet()
+}
@@ -0,0 +1,90 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package flowspecv2
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/actions"
+)
+
+func mustRule(t *testing.T, s string, order uint32) Rule {
+	t.Helper()
+	l, acts, err := actions.ParseRule(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return FromV1(actions.Rule{Components: l, Actions: acts}, order)
+}
+
+func TestRoundTrip(t *testing.T) {
+	r := mustRule(t, "dst 192.0.2.0/24 proto 6 dport 25 then discard", 10)
+	r.Unknown = []TLV{{Type: 2, Value: []byte{1, 2, 3}}}
+	b, err := Encode(r, fs.AFIIPv4)
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	want := []byte{
+		0, 29, 0, 0, 0, 10,
+		0, 1, 0, 14, 1, 4, 24, 192, 0, 2, 3, 2, 0x81, 6, 5, 2, 0x81, 25,
+		0, 2, 0, 3, 1, 2, 3,
+	}
+	if !reflect.DeepEqual(b, want) {
+		t.Errorf("Encode() = %x, want %x", b, want)
+	}
+	got, n, err := Decode(b, fs.AFIIPv4)
+	if err != nil || n != len(b) {
+		t.Fatalf("Decode() = %d, %v", n, err)
+	}
+	r.Actions = nil // not part of the NLRI
+	if !reflect.DeepEqual(got, r) {
+		t.Errorf("Decode() = %+v, want %+v", got, r)
+	}
+}
+
+func TestDecodeUnknownComponent(t *testing.T) {
+	b := []byte{0, 16, 0, 0, 0, 1, 0, 1, 0, 8, 3, 2, 0x81, 17, 200, 2, 0xaa, 0xbb}
+	r, _, err := Decode(b, fs.AFIIPv4)
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	want := []fs.FSComponent{{Type: fs.ComponentTypeIpProtocol, Raw: []byte{0x81, 17}}, {Type: 200, Raw: []byte{0xaa, 0xbb}}}
+	if !reflect.DeepEqual(r.Components.Components, want) {
+		t.Errorf("Components = %+v, want %+v", r.Components.Components, want)
+	}
+
+	for name, b := range map[string][]byte{
+		"Truncated":  {0, 10, 0, 0, 0, 1},
+		"OutOfOrder": {0, 16, 0, 0, 0, 1, 0, 1, 0, 8, 5, 2, 0x81, 25, 3, 2, 0x81, 6},
+		"LongValue":  {0, 13, 0, 0, 0, 1, 0, 1, 0, 5, 3, 3, 0x81, 6, 0},
+	} {
+		if _, _, err := Decode(b, fs.AFIIPv4); !errors.Is(err, ErrMalformedNLRI) {
+			t.Errorf("Decode(%s) error = %v, want %v", name, err, ErrMalformedNLRI)
+		}
+	}
+}
+
+func TestSort(t *testing.T) {
+	rules := []Rule{
+		mustRule(t, "dst 192.0.2.0/24 then discard", 20),
+		mustRule(t, "dst 192.0.2.0/25 then discard", 20),
+		mustRule(t, "dst 198.51.100.0/24 then discard", 5),
+	}
+	Sort(rules)
+	var got []string
+	for _, r := range rules {
+		got = append(got, r.Components.String())
+	}
+	want := []string{"dst 198.51.100.0/24", "dst 192.0.2.0/25", "dst 192.0.2.0/24"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Sort() = %v, want %v (order first, then RFC8955 5.1)", got, want)
+	}
+	if ecs := rules[0].ExtendedCommunities(); len(ecs) != 1 || !actions.IsDiscard(rules[0].Actions[0]) {
+		t.Errorf("ExtendedCommunities() = %x", ecs)
+	}
+}
@@ -0,0 +1,316 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package flowspecinternal
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrSyntax             = errors.New("flowspec: rule syntax error")
+	ErrDuplicateComponent = errors.New("flowspec: component type given more than once")
+)
+
+// FormatOptions configures Format. The zero value renders protocols, TCP flags
+// and fragment bits by name.
+type FormatOptions struct {
+	// Numeric renders every value as a number.
+	Numeric bool
+}
+
+// numericOperators are the operators of the human-readable form, indexed by lt|gt|eq.
+var numericOperators = [...]string{"false", "=", ">", ">=", "<", "<=", "!=", "true"}
+
+// String returns l.Format(nil).
+func (l FSComponentList) String() string {
+	return l.Format(nil)
+}
+
+// Format renders l for humans, e.g. "dst 192.0.2.0/24 proto tcp dport =443
+// tcp-flags syn". Unlike Canonical it keeps the component and operator order
+// of the encoding: AND-ed operators are joined by "&" and OR-ed ones by ",".
+// Bitmask terms are "syn|ack" (any bit set), "=syn|ack" (all bits set) and
+// their negations "!" and "!="; for a single bit "any" and "all" coincide and
+// render bare. Malformed operator bytes render as "raw:<hex>".
+func (l FSComponentList) Format(opts *FormatOptions) string {
+	var o FormatOptions
+	if opts != nil {
+		o = *opts
+	}
+	tokens := make([]string, 0, 2*len(l.Components))
+	for _, c := range l.Components {
+		tokens = append(tokens, c.Type.String(), formatValue(c, o))
+	}
+	return strings.Join(tokens, " ")
+}
+
+// String renders c as a single "key value" pair of FSComponentList.Format.
+func (c FSComponent) String() string {
+	return c.Type.String() + " " + formatValue(c, FormatOptions{})
+}
+
+func formatValue(c FSComponent, o FormatOptions) string {
+	if c.Type == ComponentTypeDestinationPrefix || c.Type == ComponentTypeSourcePrefix {
+		if c.Prefix == nil {
+			return "none"
+		}
+		return c.Prefix.String()
+	}
+	if c.Type.IsMAC() {
+		if mac, ok := c.MAC(); ok {
+			return mac.String()
+		}
+		return fmt.Sprintf("raw:%x", c.Raw)
+	}
+	var b strings.Builder
+	if c.Type.IsBitmask() {
+		ops, err := ParseBitmaskOps(c.Raw)
+		if err != nil {
+			return fmt.Sprintf("raw:%x", c.Raw)
+		}
+		for i, op := range ops {
+			b.WriteString(formatJoin(i, op.And))
+			b.WriteString(formatBitmask(c.Type, op, o))
+		}
+		return b.String()
+	}
+	ops, err := ParseNumericOps(c.Raw)
+	if err != nil {
+		return fmt.Sprintf("raw:%x", c.Raw)
+	}
+	for i, op := range ops {
+		b.WriteString(formatJoin(i, op.And))
+		b.WriteString(formatNumeric(c.Type, op, o))
+	}
+	return b.String()
+}
+
+func formatJoin(i int, and bool) string {
+	switch {
+	case i == 0:
+		return ""
+	case and:
+		return "&"
+	}
+	return ","
+}
+
+func formatNumeric(t ComponentType, op NumericOp, o FormatOptions) string {
+	i := 0
+	if op.LT {
+		i |= opLT
+	}
+	if op.GT {
+		i |= opGT
+	}
+	if op.EQ {
+		i |= opEQ
+	}
+	sym := numericOperators[i]
+	if sym == "true" || sym == "false" {
+		return sym
+	}
+	v := strconv.FormatUint(op.Value, 10)
+	if t != ComponentTypeIpProtocol {
+		return sym + v
+	}
+	if !o.Numeric {
+		v = FormatProtocol(uint8(op.Value))
+	}
+	if sym == "=" {
+		// "proto tcp" reads better than "proto =tcp".
+		return v
+	}
+	return sym + v
+}
+
+func formatBitmask(t ComponentType, op BitmaskOp, o FormatOptions) string {
+	k := bitmaskKind(op)
+	if op.Value&(op.Value-1) == 0 {
+		k &^= 2 // any and all are the same test for a single bit
+	}
+	prefix := [...]string{"", "!", "=", "!="}[k]
+	if o.Numeric {
+		return prefix + fmt.Sprintf("0x%02x", op.Value)
+	}
+	return prefix + canonicalBits(t, op.Value, CanonicalOptions{Symbolic: true})
+}
+
+// ParseComponents parses the text of Format back into a component list sorted
+// by type. Besides the forms Format emits it accepts port names, ranges such as
+// "1024-2048" and a bare value as equality for every numeric component, so
+// "proto udp dport 53" and "proto 17 dport =dns" parse to the same list.
+func ParseComponents(s string) (FSComponentList, error) {
+	f := strings.Fields(s)
+	if len(f)%2 != 0 {
+		return FSComponentList{}, fmt.Errorf("%w: %q lacks a value", ErrSyntax, f[len(f)-1])
+	}
+	var l FSComponentList
+	for i := 0; i < len(f); i += 2 {
+		t, err := ParseComponentType(f[i])
+		if err != nil {
+			return FSComponentList{}, err
+		}
+		if slices.ContainsFunc(l.Components, func(c FSComponent) bool { return c.Type == t }) {
+			return FSComponentList{}, fmt.Errorf("%w: %s", ErrDuplicateComponent, t)
+		}
+		c, err := parseComponent(t, f[i+1])
+		if err != nil {
+			return FSComponentList{}, fmt.Errorf("%s %s: %w", f[i], f[i+1], err)
+		}
+		l.Components = append(l.Components, c)
+	}
+	slices.SortStableFunc(l.Components, func(a, b FSComponent) int { return int(a.Type) - int(b.Type) })
+	return l, nil
+}
+
+func parseComponent(t ComponentType, v string) (FSComponent, error) {
+	c := FSComponent{Type: t}
+	if raw, ok := strings.CutPrefix(v, "raw:"); ok {
+		b, err := hex.DecodeString(raw)
+		if err != nil {
+			return FSComponent{}, fmt.Errorf("%w: %v", ErrSyntax, err)
+		}
+		c.Raw = b
+		return c, nil
+	}
+	if t == ComponentTypeDestinationPrefix || t == ComponentTypeSourcePrefix {
+		p, err := netip.ParsePrefix(v)
+		if err != nil {
+			return FSComponent{}, fmt.Errorf("%w: %v", ErrSyntax, err)
+		}
+		// as decoded from the wire, so ordering and keys agree
+		p = p.Masked()
+		c.Prefix = &p
+		return c, nil
+	}
+	if t.IsMAC() {
+		mac, err := net.ParseMAC(v)
+		if err != nil {
+			return FSComponent{}, fmt.Errorf("%w: %v", ErrSyntax, err)
+		}
+		return MACComponent(t, mac)
+	}
+	if t.IsBitmask() {
+		var ops []BitmaskOp
+		for _, group := range strings.Split(v, ",") {
+			for j, term := range strings.Split(group, "&") {
+				op, err := parseBitmaskTerm(t, term)
+				if err != nil {
+					return FSComponent{}, err
+				}
+				op.And = j > 0
+				ops = append(ops, op)
+			}
+		}
+		c.Raw = EncodeBitmaskOps(ops)
+		return c, nil
+	}
+	var ops []NumericOp
+	for _, group := range strings.Split(v, ",") {
+		first := len(ops)
+		for _, term := range strings.Split(group, "&") {
+			terms, err := parseNumericTerm(t, term)
+			if err != nil {
+				return FSComponent{}, err
+			}
+			ops = append(ops, terms...)
+		}
+		for j := first + 1; j < len(ops); j++ {
+			ops[j].And = true
+		}
+	}
+	c.Raw = EncodeNumericOps(ops)
+	return c, nil
+}
+
+func parseNumericTerm(t ComponentType, term string) ([]NumericOp, error) {
+	switch term {
+	case "true":
+		return []NumericOp{{LT: true, GT: true, EQ: true}}, nil
+	case "false":
+		return []NumericOp{{}}, nil
+	}
+	if from, to, ok := strings.Cut(term, "-"); ok {
+		lo, err := parseNumber(t, from)
+		if err != nil {
+			return nil, err
+		}
+		hi, err := parseNumber(t, to)
+		if err != nil {
+			return nil, err
+		}
+		return []NumericOp{{GT: true, EQ: true, Value: lo}, {And: true, LT: true, EQ: true, Value: hi}}, nil
+	}
+	// Longest operators first so ">=" is not read as ">".
+	for _, i := range []int{opGT | opEQ, opLT | opEQ, opLT | opGT, opEQ, opGT, opLT} {
+		if rest, ok := strings.CutPrefix(term, numericOperators[i]); ok {
+			v, err := parseNumber(t, rest)
+			if err != nil {
+				return nil, err
+			}
+			return []NumericOp{{LT: i&opLT != 0, GT: i&opGT != 0, EQ: i&opEQ != 0, Value: v}}, nil
+		}
+	}
+	v, err := parseNumber(t, term)
+	if err != nil {
+		return nil, err
+	}
+	return []NumericOp{{EQ: true, Value: v}}, nil
+}
+
+func parseNumber(t ComponentType, s string) (uint64, error) {
+	switch t {
+	case ComponentTypeIpProtocol:
+		v, err := ParseProtocol(s)
+		return uint64(v), err
+	case ComponentTypePort, ComponentTypeDestinationPort, ComponentTypeSourcePort:
+		v, err := ParsePort(s)
+		return uint64(v), err
+	case ComponentTypeDSCP:
+		v, err := ParseDSCP(s)
+		return uint64(v), err
+	}
+	v, err := strconv.ParseUint(s, 0, 64)
+	if err != nil || v > t.maxValue() {
+		return 0, fmt.Errorf("%w: %q is not a %s value", ErrSyntax, s, t)
+	}
+	return v, nil
+}
+
+func parseBitmaskTerm(t ComponentType, term string) (BitmaskOp, error) {
+	var op BitmaskOp
+	switch {
+	case strings.HasPrefix(term, "!="):
+		op.Not, op.Match, term = true, true, term[2:]
+	case strings.HasPrefix(term, "!"):
+		op.Not, term = true, term[1:]
+	case strings.HasPrefix(term, "="):
+		op.Match, term = true, term[1:]
+	}
+	names := tcpFlagNames
+	if t == ComponentTypeFragment {
+		names = fragmentNames
+	}
+	if v, err := strconv.ParseUint(term, 0, 16); err == nil {
+		op.Value = v
+		return op, nil
+	}
+	for _, n := range strings.Split(term, "|") {
+		i := slices.Index(names, n)
+		if i < 0 {
+			return BitmaskOp{}, fmt.Errorf("%w: unknown %s bit %q", ErrSyntax, t, n)
+		}
+		op.Value |= 1 << i
+	}
+	return op, nil
+}
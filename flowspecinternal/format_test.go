@@ -0,0 +1,77 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package flowspecinternal
+
+import (
+	"fmt"
+	"net/netip"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	dst := netip.MustParsePrefix("192.0.2.0/24")
+
+	tests := []struct {
+		name string
+		list FSComponentList
+		opts *FormatOptions
+		want string
+	}{
+		{
+			name: "Example",
+			list: FSComponentList{Components: []FSComponent{
+				{Type: ComponentTypeDestinationPrefix, Prefix: &dst},
+				{Type: ComponentTypeIpProtocol, Raw: []byte{0x81, 0x06}},
+				{Type: ComponentTypeDestinationPort, Raw: []byte{0x91, 0x01, 0xbb}},
+				{Type: ComponentTypeTCPFlags, Raw: []byte{0x81, 0x02}},
+			}},
+			want: "dst 192.0.2.0/24 proto tcp dport =443 tcp-flags syn",
+		},
+		{
+			name: "OperatorSequences",
+			list: FSComponentList{Components: []FSComponent{
+				{Type: ComponentTypeDestinationPort, Raw: []byte{0x01, 0x7b, 0x13, 0x04, 0x00, 0xd5, 0x08, 0x00}},
+				{Type: ComponentTypePacketLength, Raw: []byte{0x86, 0x00}},
+				{Type: ComponentTypeTCPFlags, Raw: []byte{0x01, 0x12, 0x42, 0x04, 0x83, 0x01}},
+			}},
+			want: "dport =123,>=1024&<=2048 len !=0 tcp-flags =syn|ack&!rst,!fin",
+		},
+		{
+			name: "Numeric",
+			list: FSComponentList{Components: []FSComponent{
+				{Type: ComponentTypeIpProtocol, Raw: []byte{0x01, 0x11, 0x82, 0x20}},
+				{Type: ComponentTypeFragment, Raw: []byte{0x80, 0x02}},
+			}},
+			opts: &FormatOptions{Numeric: true},
+			want: "proto 17,>32 frag 0x02",
+		},
+		{
+			name: "Malformed",
+			list: FSComponentList{Components: []FSComponent{{Type: ComponentTypeDSCP, Raw: []byte{0x01}}}},
+			want: "dscp raw:01",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.list.Format(tt.opts); got != tt.want {
+				t.Errorf("Format() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatVerb(t *testing.T) {
+	l := FSComponentList{Components: []FSComponent{{Type: ComponentTypeIpProtocol, Raw: []byte{0x81, 0x11}}}}
+	if got, want := fmt.Sprintf("%v", l), "proto udp"; got != want {
+		t.Errorf("Sprintf(%%v) = %q, want %q", got, want)
+	}
+}
+
+func TestParseComponentsMasksPrefixes(t *testing.T) {
+	l := mustParse(t, "dst 10.1.6.0/22 src 2001:db8::1/32")
+	if got, want := l.String(), "dst 10.1.4.0/22 src 2001:db8::/32"; got != want {
+		t.Errorf("ParseComponents() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package flowspecinternal
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// FragmentBits is the bit field the fragment component (type 12) tests,
+// as per RFC8955 4.2.2.12.
+type FragmentBits uint8
+
+const (
+	// FragmentDF is the IPv4 Don't Fragment flag. IPv6 has no such flag,
+	// RFC8956 3.7 requires it to be 0 in IPv6 rules.
+	FragmentDF FragmentBits = 0x01
+	// FragmentIsF is set for any fragment.
+	FragmentIsF FragmentBits = 0x02
+	// FragmentFF is set for the first fragment.
+	FragmentFF FragmentBits = 0x04
+	// FragmentLF is set for the last fragment.
+	FragmentLF FragmentBits = 0x08
+
+	fragmentAll = FragmentDF | FragmentIsF | FragmentFF | FragmentLF
+)
+
+// PacketFragmentBits returns the bits of a packet from its more fragments
+// flag and fragment offset, of the IPv4 header or of the IPv6 fragment
+// header (RFC8200 4.5), and df, the IPv4 Don't Fragment flag.
+func PacketFragmentBits(df, more bool, offset uint16) FragmentBits {
+	var f FragmentBits
+	if df {
+		f |= FragmentDF
+	}
+	if more || offset != 0 {
+		f |= FragmentIsF
+	}
+	if more && offset == 0 {
+		f |= FragmentFF
+	}
+	if !more && offset != 0 {
+		f |= FragmentLF
+	}
+	return f
+}
+
+// NonFirst reports whether f is the bits of a fragment other than the first,
+// which carries no transport header.
+func (f FragmentBits) NonFirst() bool {
+	return f&FragmentIsF != 0 && f&FragmentFF == 0
+}
+
+// String returns the names of the bits of f joined by "|", as in the rule
+// syntax, or its hex value if it is 0 or has undefined bits set.
+func (f FragmentBits) String() string {
+	return canonicalBits(ComponentTypeFragment, uint64(f), CanonicalOptions{Symbolic: true})
+}
+
+// ParseFragmentBits parses the notation of FragmentBits.String, also
+// accepting numbers.
+func ParseFragmentBits(s string) (FragmentBits, error) {
+	if v, err := strconv.ParseUint(s, 0, 8); err == nil && FragmentBits(v)&^fragmentAll == 0 {
+		return FragmentBits(v), nil
+	}
+	var f FragmentBits
+	for _, n := range strings.Split(s, "|") {
+		i := slices.Index(fragmentNames, n)
+		if i < 0 {
+			return 0, fmt.Errorf("%w: unknown %s bit %q", ErrSyntax, ComponentTypeFragment, n)
+		}
+		f |= 1 << i
+	}
+	return f, nil
+}
+
+// FragmentComponent returns the fragment component OR-ing groups of AND-ed
+// operators, e.g. FragmentComponent([]BitmaskOp{BitmaskAny(uint64(FragmentIsF))})
+// for any fragment.
+func FragmentComponent(groups ...[]BitmaskOp) FSComponent {
+	return FSComponent{Type: ComponentTypeFragment, Raw: EncodeBitmaskOps(JoinBitmaskOps(groups...))}
+}
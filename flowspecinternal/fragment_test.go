@@ -0,0 +1,71 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package flowspecinternal
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestPacketFragmentBits(t *testing.T) {
+	tests := []struct {
+		name     string
+		df, more bool
+		offset   uint16
+		want     FragmentBits
+		nonFirst bool
+	}{
+		{name: "Unfragmented", df: true, want: FragmentDF},
+		{name: "First", more: true, want: FragmentIsF | FragmentFF},
+		{name: "Middle", more: true, offset: 185, want: FragmentIsF, nonFirst: true},
+		{name: "Last", offset: 370, want: FragmentIsF | FragmentLF, nonFirst: true},
+	}
+	for _, tt := range tests {
+		got := PacketFragmentBits(tt.df, tt.more, tt.offset)
+		if got != tt.want || got.NonFirst() != tt.nonFirst {
+			t.Errorf("%s: PacketFragmentBits() = %v, NonFirst() = %v, want %v, %v", tt.name, got, got.NonFirst(), tt.want, tt.nonFirst)
+		}
+	}
+}
+
+func TestFragmentBitsString(t *testing.T) {
+	f := FragmentIsF | FragmentLF
+	if got := f.String(); got != "isf|lf" {
+		t.Errorf("String() = %q, want %q", got, "isf|lf")
+	}
+	for _, s := range []string{"isf|lf", "0x0a", "10"} {
+		if got, err := ParseFragmentBits(s); err != nil || got != f {
+			t.Errorf("ParseFragmentBits(%q) = %v, %v, want %v", s, got, err, f)
+		}
+	}
+	for _, s := range []string{"mf", "0x10"} {
+		if _, err := ParseFragmentBits(s); !errors.Is(err, ErrSyntax) {
+			t.Errorf("ParseFragmentBits(%q) error = %v, want %v", s, err, ErrSyntax)
+		}
+	}
+}
+
+func TestFragmentComponent(t *testing.T) {
+	groups := [][]BitmaskOp{
+		{BitmaskAll(uint64(FragmentIsF | FragmentFF))},
+		{BitmaskAny(uint64(FragmentLF)), BitmaskNone(uint64(FragmentDF))},
+	}
+	c := FragmentComponent(groups...)
+	if got, want := c.String(), "frag =isf|ff,lf&!df"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	ops, err := ParseBitmaskOps(c.Raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]BitmaskOp{
+		{{Match: true, Value: 0x06}},
+		{{Value: 0x08}, {And: true, Not: true, Value: 0x01}},
+	}
+	if got := SplitBitmaskOps(ops); !reflect.DeepEqual(got, want) {
+		t.Errorf("SplitBitmaskOps() = %+v, want %+v", got, want)
+	}
+}
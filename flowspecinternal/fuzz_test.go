@@ -0,0 +1,138 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package flowspecinternal
+
+import (
+	"bytes"
+	"testing"
+)
+
+// nlriSeeds are NLRI as seen on the wire: the RFC8955 4.3 and RFC8956 3.8
+// examples and a rule with every IPv4 component type.
+var nlriSeeds = []struct {
+	afi uint16
+	b   []byte
+}{
+	{AFIIPv4, []byte{0x0b, 0x01, 0x18, 0xc0, 0x00, 0x02, 0x03, 0x81, 0x06, 0x04, 0x81, 0x19}},
+	{AFIIPv4, []byte{0x12, 0x01, 0x18, 0x0a, 0x00, 0x01, 0x02, 0x18, 0xc0, 0x00, 0x02, 0x03, 0x81, 0x11, 0x04, 0x03, 0x89, 0x45, 0x8b, 0x91, 0x1f, 0x90}},
+	{AFIIPv4, []byte{0x0e, 0x01, 0x18, 0xc0, 0x00, 0x02, 0x03, 0x81, 0x06, 0x09, 0x01, 0x02, 0x81, 0x10}},
+	{AFIIPv6, []byte{0x0d, 0x01, 0x20, 0x00, 0x20, 0x01, 0x0d, 0xb8, 0x02, 0x00, 0x00, 0x03, 0x81, 0x06, 0xff}},
+	{AFIIPv6, []byte{0x05, 0x01, 0x20, 0x08, 0x0d, 0xb8}},
+	{AFIIPv4, []byte{0xf0, 0x03, 0x03, 0x81, 0x06}},
+}
+
+func addNLRISeeds(f *testing.F) {
+	for _, s := range nlriSeeds {
+		f.Add(s.b, s.afi)
+	}
+	l, err := ParseComponents("dst 192.0.2.0/24 src 198.51.100.0/24 proto tcp port 80 dport 443 sport >=1024 icmp-type 8 icmp-code 0 tcp-flags syn&!ack len 40-1500 dscp 46 frag isf")
+	if err != nil {
+		f.Fatal(err)
+	}
+	b, err := EncodeNLRI(l, AFIIPv4)
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(b, AFIIPv4)
+}
+
+// FuzzDecodeNLRI checks that DecodeNLRI never panics, consumes at most its
+// input and that what it accepts encodes back to an NLRI decoding the same.
+func FuzzDecodeNLRI(f *testing.F) {
+	addNLRISeeds(f)
+	f.Fuzz(func(t *testing.T, b []byte, afi uint16) {
+		l, n, err := DecodeNLRI(b, afi)
+		if err != nil {
+			return
+		}
+		if n > len(b) {
+			t.Fatalf("DecodeNLRI consumed %d of %d bytes", n, len(b))
+		}
+		_ = l.Canonical(&CanonicalOptions{Symbolic: true})
+		_ = l.String()
+		enc, err := EncodeNLRI(l, afi)
+		if err != nil {
+			t.Fatalf("EncodeNLRI(DecodeNLRI(%x)) error = %v", b, err)
+		}
+		l2, n2, err := DecodeNLRI(enc, afi)
+		if err != nil || n2 != len(enc) {
+			t.Fatalf("DecodeNLRI(%x) = %d, %v after re-encoding %x", enc, n2, err, b)
+		}
+		if CompareFlowSpecKey(l, l2) != Equal || l.Canonical(nil) != l2.Canonical(nil) {
+			t.Fatalf("decode(encode(%q)) = %q", l.Canonical(nil), l2.Canonical(nil))
+		}
+	})
+}
+
+// FuzzCompareFlowSpecKey checks that CompareFlowSpecKey is a consistent
+// order on the NLRI DecodeNLRI accepts: antisymmetric and reflexive, with
+// Equal keys encoding identically.
+func FuzzCompareFlowSpecKey(f *testing.F) {
+	for i, a := range nlriSeeds {
+		b := nlriSeeds[(i+1)%len(nlriSeeds)]
+		f.Add(a.b, b.b, a.afi)
+	}
+	f.Fuzz(func(t *testing.T, a, b []byte, afi uint16) {
+		la, _, err := DecodeNLRI(a, afi)
+		if err != nil {
+			return
+		}
+		lb, _, err := DecodeNLRI(b, afi)
+		if err != nil {
+			return
+		}
+		if CompareFlowSpecKey(la, la) != Equal {
+			t.Fatalf("CompareFlowSpecKey(a, a) != Equal for %x", a)
+		}
+		ab, ba := CompareFlowSpecKey(la, lb), CompareFlowSpecKey(lb, la)
+		if ab != -ba {
+			t.Fatalf("CompareFlowSpecKey(%x, %x) = %d but reversed %d", a, b, ab, ba)
+		}
+		if ab == Equal {
+			ea, erra := EncodeNLRI(la, afi)
+			eb, errb := EncodeNLRI(lb, afi)
+			if erra != nil || errb != nil || !bytes.Equal(ea, eb) {
+				t.Fatalf("Equal keys %x and %x encode to %x and %x", a, b, ea, eb)
+			}
+		}
+	})
+}
+
+// FuzzEncodeDecode checks that rules ParseComponents accepts survive
+// encoding and decoding unchanged.
+func FuzzEncodeDecode(f *testing.F) {
+	for _, s := range []string{
+		"dst 192.0.2.0/24 proto tcp dport 80,443",
+		"dst 2001:db8::/32 proto 58 icmp-type 128",
+		"proto udp sport 53 len <=512 dscp af41-af43,ef",
+		"tcp-flags syn&!ack frag isf|lf",
+		"port raw:0319",
+	} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		l, err := ParseComponents(s)
+		if err != nil {
+			return
+		}
+		afi := AFIIPv4
+		for _, c := range l.Components {
+			if c.Prefix != nil && c.Prefix.Addr().Is6() {
+				afi = AFIIPv6
+			}
+		}
+		enc, err := EncodeNLRI(l, afi)
+		if err != nil {
+			return
+		}
+		got, n, err := DecodeNLRI(enc, afi)
+		if err != nil || n != len(enc) {
+			t.Fatalf("DecodeNLRI(EncodeNLRI(%q)) = %d, %v", s, n, err)
+		}
+		if got.Canonical(nil) != l.Canonical(nil) {
+			t.Fatalf("decode(encode(%q)) = %q, want %q", s, got.Canonical(nil), l.Canonical(nil))
+		}
+	})
+}
@@ -0,0 +1,879 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: flowspecpb/flowspec.proto
+
+package flowspecpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	durationpb "google.golang.org/protobuf/types/known/durationpb"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type EventKind int32
+
+const (
+	EventKind_EVENT_KIND_UNSPECIFIED EventKind = 0
+	EventKind_EVENT_KIND_ACCEPTED    EventKind = 1
+	EventKind_EVENT_KIND_REJECTED    EventKind = 2
+	EventKind_EVENT_KIND_WITHDRAWN   EventKind = 3
+	EventKind_EVENT_KIND_REVALIDATED EventKind = 4
+)
+
+// Enum value maps for EventKind.
+var (
+	EventKind_name = map[int32]string{
+		0: "EVENT_KIND_UNSPECIFIED",
+		1: "EVENT_KIND_ACCEPTED",
+		2: "EVENT_KIND_REJECTED",
+		3: "EVENT_KIND_WITHDRAWN",
+		4: "EVENT_KIND_REVALIDATED",
+	}
+	EventKind_value = map[string]int32{
+		"EVENT_KIND_UNSPECIFIED": 0,
+		"EVENT_KIND_ACCEPTED":    1,
+		"EVENT_KIND_REJECTED":    2,
+		"EVENT_KIND_WITHDRAWN":   3,
+		"EVENT_KIND_REVALIDATED": 4,
+	}
+)
+
+func (x EventKind) Enum() *EventKind {
+	p := new(EventKind)
+	*p = x
+	return p
+}
+
+func (x EventKind) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (EventKind) Descriptor() protoreflect.EnumDescriptor {
+	return file_flowspecpb_flowspec_proto_enumTypes[0].Descriptor()
+}
+
+func (EventKind) Type() protoreflect.EnumType {
+	return &file_flowspecpb_flowspec_proto_enumTypes[0]
+}
+
+func (x EventKind) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use EventKind.Descriptor instead.
+func (EventKind) EnumDescriptor() ([]byte, []int) {
+	return file_flowspecpb_flowspec_proto_rawDescGZIP(), []int{0}
+}
+
+// Route is a FlowSpec route.
+type Route struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Afi   uint32                 `protobuf:"varint,1,opt,name=afi,proto3" json:"afi,omitempty"`
+	Safi  uint32                 `protobuf:"varint,2,opt,name=safi,proto3" json:"safi,omitempty"`
+	// rd is the 8 byte route distinguisher of VPN routes.
+	Rd []byte `protobuf:"bytes,3,opt,name=rd,proto3" json:"rd,omitempty"`
+	// components in the rule syntax, e.g. "dst 192.0.2.0/24 proto tcp dport =443".
+	Components   string   `protobuf:"bytes,4,opt,name=components,proto3" json:"components,omitempty"`
+	FromEbgp     bool     `protobuf:"varint,5,opt,name=from_ebgp,json=fromEbgp,proto3" json:"from_ebgp,omitempty"`
+	NeighborAs   uint32   `protobuf:"varint,6,opt,name=neighbor_as,json=neighborAs,proto3" json:"neighbor_as,omitempty"`
+	AsPath       []uint32 `protobuf:"varint,7,rep,packed,name=as_path,json=asPath,proto3" json:"as_path,omitempty"`
+	OriginatorId string   `protobuf:"bytes,8,opt,name=originator_id,json=originatorId,proto3" json:"originator_id,omitempty"`
+	// ext_communities are 8 byte extended communities, e.g. the actions.
+	ExtCommunities [][]byte `protobuf:"bytes,9,rep,name=ext_communities,json=extCommunities,proto3" json:"ext_communities,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *Route) Reset() {
+	*x = Route{}
+	mi := &file_flowspecpb_flowspec_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Route) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Route) ProtoMessage() {}
+
+func (x *Route) ProtoReflect() protoreflect.Message {
+	mi := &file_flowspecpb_flowspec_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Route.ProtoReflect.Descriptor instead.
+func (*Route) Descriptor() ([]byte, []int) {
+	return file_flowspecpb_flowspec_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Route) GetAfi() uint32 {
+	if x != nil {
+		return x.Afi
+	}
+	return 0
+}
+
+func (x *Route) GetSafi() uint32 {
+	if x != nil {
+		return x.Safi
+	}
+	return 0
+}
+
+func (x *Route) GetRd() []byte {
+	if x != nil {
+		return x.Rd
+	}
+	return nil
+}
+
+func (x *Route) GetComponents() string {
+	if x != nil {
+		return x.Components
+	}
+	return ""
+}
+
+func (x *Route) GetFromEbgp() bool {
+	if x != nil {
+		return x.FromEbgp
+	}
+	return false
+}
+
+func (x *Route) GetNeighborAs() uint32 {
+	if x != nil {
+		return x.NeighborAs
+	}
+	return 0
+}
+
+func (x *Route) GetAsPath() []uint32 {
+	if x != nil {
+		return x.AsPath
+	}
+	return nil
+}
+
+func (x *Route) GetOriginatorId() string {
+	if x != nil {
+		return x.OriginatorId
+	}
+	return ""
+}
+
+func (x *Route) GetExtCommunities() [][]byte {
+	if x != nil {
+		return x.ExtCommunities
+	}
+	return nil
+}
+
+// Rule is a route held by a RIB with its validation result.
+type Rule struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// id identifies the rule: AFI, SAFI, RD and canonical components.
+	Id       string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Route    *Route `protobuf:"bytes,2,opt,name=route,proto3" json:"route,omitempty"`
+	Feasible bool   `protobuf:"varint,3,opt,name=feasible,proto3" json:"feasible,omitempty"`
+	// reason is the stable name of the rejection reason, e.g. "no-best-unicast".
+	Reason string `protobuf:"bytes,4,opt,name=reason,proto3" json:"reason,omitempty"`
+	Error  string `protobuf:"bytes,5,opt,name=error,proto3" json:"error,omitempty"`
+	// expires is set for rules with a lifetime.
+	Expires       *timestamppb.Timestamp `protobuf:"bytes,6,opt,name=expires,proto3" json:"expires,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Rule) Reset() {
+	*x = Rule{}
+	mi := &file_flowspecpb_flowspec_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Rule) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Rule) ProtoMessage() {}
+
+func (x *Rule) ProtoReflect() protoreflect.Message {
+	mi := &file_flowspecpb_flowspec_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Rule.ProtoReflect.Descriptor instead.
+func (*Rule) Descriptor() ([]byte, []int) {
+	return file_flowspecpb_flowspec_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Rule) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Rule) GetRoute() *Route {
+	if x != nil {
+		return x.Route
+	}
+	return nil
+}
+
+func (x *Rule) GetFeasible() bool {
+	if x != nil {
+		return x.Feasible
+	}
+	return false
+}
+
+func (x *Rule) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+func (x *Rule) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *Rule) GetExpires() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Expires
+	}
+	return nil
+}
+
+type AddRuleRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Route *Route                 `protobuf:"bytes,1,opt,name=route,proto3" json:"route,omitempty"`
+	// ttl and idle are the optional lifetime of the rule.
+	Ttl           *durationpb.Duration `protobuf:"bytes,2,opt,name=ttl,proto3" json:"ttl,omitempty"`
+	Idle          *durationpb.Duration `protobuf:"bytes,3,opt,name=idle,proto3" json:"idle,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AddRuleRequest) Reset() {
+	*x = AddRuleRequest{}
+	mi := &file_flowspecpb_flowspec_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AddRuleRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AddRuleRequest) ProtoMessage() {}
+
+func (x *AddRuleRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_flowspecpb_flowspec_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AddRuleRequest.ProtoReflect.Descriptor instead.
+func (*AddRuleRequest) Descriptor() ([]byte, []int) {
+	return file_flowspecpb_flowspec_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *AddRuleRequest) GetRoute() *Route {
+	if x != nil {
+		return x.Route
+	}
+	return nil
+}
+
+func (x *AddRuleRequest) GetTtl() *durationpb.Duration {
+	if x != nil {
+		return x.Ttl
+	}
+	return nil
+}
+
+func (x *AddRuleRequest) GetIdle() *durationpb.Duration {
+	if x != nil {
+		return x.Idle
+	}
+	return nil
+}
+
+type WithdrawRuleRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WithdrawRuleRequest) Reset() {
+	*x = WithdrawRuleRequest{}
+	mi := &file_flowspecpb_flowspec_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WithdrawRuleRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WithdrawRuleRequest) ProtoMessage() {}
+
+func (x *WithdrawRuleRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_flowspecpb_flowspec_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WithdrawRuleRequest.ProtoReflect.Descriptor instead.
+func (*WithdrawRuleRequest) Descriptor() ([]byte, []int) {
+	return file_flowspecpb_flowspec_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *WithdrawRuleRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type WithdrawRuleResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WithdrawRuleResponse) Reset() {
+	*x = WithdrawRuleResponse{}
+	mi := &file_flowspecpb_flowspec_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WithdrawRuleResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WithdrawRuleResponse) ProtoMessage() {}
+
+func (x *WithdrawRuleResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_flowspecpb_flowspec_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WithdrawRuleResponse.ProtoReflect.Descriptor instead.
+func (*WithdrawRuleResponse) Descriptor() ([]byte, []int) {
+	return file_flowspecpb_flowspec_proto_rawDescGZIP(), []int{4}
+}
+
+type ListRulesRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// received lists the received instead of the locally originated rules.
+	Received      bool `protobuf:"varint,1,opt,name=received,proto3" json:"received,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListRulesRequest) Reset() {
+	*x = ListRulesRequest{}
+	mi := &file_flowspecpb_flowspec_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListRulesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListRulesRequest) ProtoMessage() {}
+
+func (x *ListRulesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_flowspecpb_flowspec_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListRulesRequest.ProtoReflect.Descriptor instead.
+func (*ListRulesRequest) Descriptor() ([]byte, []int) {
+	return file_flowspecpb_flowspec_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *ListRulesRequest) GetReceived() bool {
+	if x != nil {
+		return x.Received
+	}
+	return false
+}
+
+type ListRulesResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Rules         []*Rule                `protobuf:"bytes,1,rep,name=rules,proto3" json:"rules,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListRulesResponse) Reset() {
+	*x = ListRulesResponse{}
+	mi := &file_flowspecpb_flowspec_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListRulesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListRulesResponse) ProtoMessage() {}
+
+func (x *ListRulesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_flowspecpb_flowspec_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListRulesResponse.ProtoReflect.Descriptor instead.
+func (*ListRulesResponse) Descriptor() ([]byte, []int) {
+	return file_flowspecpb_flowspec_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *ListRulesResponse) GetRules() []*Rule {
+	if x != nil {
+		return x.Rules
+	}
+	return nil
+}
+
+type StreamEventsRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// kinds selects the events, all if empty.
+	Kinds         []EventKind `protobuf:"varint,1,rep,packed,name=kinds,proto3,enum=floofspec.v1.EventKind" json:"kinds,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StreamEventsRequest) Reset() {
+	*x = StreamEventsRequest{}
+	mi := &file_flowspecpb_flowspec_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StreamEventsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamEventsRequest) ProtoMessage() {}
+
+func (x *StreamEventsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_flowspecpb_flowspec_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamEventsRequest.ProtoReflect.Descriptor instead.
+func (*StreamEventsRequest) Descriptor() ([]byte, []int) {
+	return file_flowspecpb_flowspec_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *StreamEventsRequest) GetKinds() []EventKind {
+	if x != nil {
+		return x.Kinds
+	}
+	return nil
+}
+
+type Event struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Kind  EventKind              `protobuf:"varint,1,opt,name=kind,proto3,enum=floofspec.v1.EventKind" json:"kind,omitempty"`
+	// rule is the rule after the change; for withdrawals reason and error
+	// give the expiry reason, if any.
+	Rule *Rule `protobuf:"bytes,2,opt,name=rule,proto3" json:"rule,omitempty"`
+	// previous_reason is the reason before a revalidation, empty if it was feasible.
+	PreviousReason string `protobuf:"bytes,3,opt,name=previous_reason,json=previousReason,proto3" json:"previous_reason,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *Event) Reset() {
+	*x = Event{}
+	mi := &file_flowspecpb_flowspec_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Event) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Event) ProtoMessage() {}
+
+func (x *Event) ProtoReflect() protoreflect.Message {
+	mi := &file_flowspecpb_flowspec_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Event.ProtoReflect.Descriptor instead.
+func (*Event) Descriptor() ([]byte, []int) {
+	return file_flowspecpb_flowspec_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *Event) GetKind() EventKind {
+	if x != nil {
+		return x.Kind
+	}
+	return EventKind_EVENT_KIND_UNSPECIFIED
+}
+
+func (x *Event) GetRule() *Rule {
+	if x != nil {
+		return x.Rule
+	}
+	return nil
+}
+
+func (x *Event) GetPreviousReason() string {
+	if x != nil {
+		return x.PreviousReason
+	}
+	return ""
+}
+
+type ValidateRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Route         *Route                 `protobuf:"bytes,1,opt,name=route,proto3" json:"route,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ValidateRequest) Reset() {
+	*x = ValidateRequest{}
+	mi := &file_flowspecpb_flowspec_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ValidateRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ValidateRequest) ProtoMessage() {}
+
+func (x *ValidateRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_flowspecpb_flowspec_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ValidateRequest.ProtoReflect.Descriptor instead.
+func (*ValidateRequest) Descriptor() ([]byte, []int) {
+	return file_flowspecpb_flowspec_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *ValidateRequest) GetRoute() *Route {
+	if x != nil {
+		return x.Route
+	}
+	return nil
+}
+
+type ValidateResponse struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Feasible bool                   `protobuf:"varint,1,opt,name=feasible,proto3" json:"feasible,omitempty"`
+	Reason   string                 `protobuf:"bytes,2,opt,name=reason,proto3" json:"reason,omitempty"`
+	Error    string                 `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`
+	// rfc_rule is the RFC 8955 section 6 rule that failed, e.g. "b".
+	RfcRule       string `protobuf:"bytes,4,opt,name=rfc_rule,json=rfcRule,proto3" json:"rfc_rule,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ValidateResponse) Reset() {
+	*x = ValidateResponse{}
+	mi := &file_flowspecpb_flowspec_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ValidateResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ValidateResponse) ProtoMessage() {}
+
+func (x *ValidateResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_flowspecpb_flowspec_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ValidateResponse.ProtoReflect.Descriptor instead.
+func (*ValidateResponse) Descriptor() ([]byte, []int) {
+	return file_flowspecpb_flowspec_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *ValidateResponse) GetFeasible() bool {
+	if x != nil {
+		return x.Feasible
+	}
+	return false
+}
+
+func (x *ValidateResponse) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+func (x *ValidateResponse) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *ValidateResponse) GetRfcRule() string {
+	if x != nil {
+		return x.RfcRule
+	}
+	return ""
+}
+
+var File_flowspecpb_flowspec_proto protoreflect.FileDescriptor
+
+const file_flowspecpb_flowspec_proto_rawDesc = "" +
+	"\n" +
+	"\x19flowspecpb/flowspec.proto\x12\ffloofspec.v1\x1a\x1egoogle/protobuf/duration.proto\x1a\x1fgoogle/protobuf/timestamp.proto\"\x82\x02\n" +
+	"\x05Route\x12\x10\n" +
+	"\x03afi\x18\x01 \x01(\rR\x03afi\x12\x12\n" +
+	"\x04safi\x18\x02 \x01(\rR\x04safi\x12\x0e\n" +
+	"\x02rd\x18\x03 \x01(\fR\x02rd\x12\x1e\n" +
+	"\n" +
+	"components\x18\x04 \x01(\tR\n" +
+	"components\x12\x1b\n" +
+	"\tfrom_ebgp\x18\x05 \x01(\bR\bfromEbgp\x12\x1f\n" +
+	"\vneighbor_as\x18\x06 \x01(\rR\n" +
+	"neighborAs\x12\x17\n" +
+	"\aas_path\x18\a \x03(\rR\x06asPath\x12#\n" +
+	"\roriginator_id\x18\b \x01(\tR\foriginatorId\x12'\n" +
+	"\x0fext_communities\x18\t \x03(\fR\x0eextCommunities\"\xc1\x01\n" +
+	"\x04Rule\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12)\n" +
+	"\x05route\x18\x02 \x01(\v2\x13.floofspec.v1.RouteR\x05route\x12\x1a\n" +
+	"\bfeasible\x18\x03 \x01(\bR\bfeasible\x12\x16\n" +
+	"\x06reason\x18\x04 \x01(\tR\x06reason\x12\x14\n" +
+	"\x05error\x18\x05 \x01(\tR\x05error\x124\n" +
+	"\aexpires\x18\x06 \x01(\v2\x1a.google.protobuf.TimestampR\aexpires\"\x97\x01\n" +
+	"\x0eAddRuleRequest\x12)\n" +
+	"\x05route\x18\x01 \x01(\v2\x13.floofspec.v1.RouteR\x05route\x12+\n" +
+	"\x03ttl\x18\x02 \x01(\v2\x19.google.protobuf.DurationR\x03ttl\x12-\n" +
+	"\x04idle\x18\x03 \x01(\v2\x19.google.protobuf.DurationR\x04idle\"%\n" +
+	"\x13WithdrawRuleRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"\x16\n" +
+	"\x14WithdrawRuleResponse\".\n" +
+	"\x10ListRulesRequest\x12\x1a\n" +
+	"\breceived\x18\x01 \x01(\bR\breceived\"=\n" +
+	"\x11ListRulesResponse\x12(\n" +
+	"\x05rules\x18\x01 \x03(\v2\x12.floofspec.v1.RuleR\x05rules\"D\n" +
+	"\x13StreamEventsRequest\x12-\n" +
+	"\x05kinds\x18\x01 \x03(\x0e2\x17.floofspec.v1.EventKindR\x05kinds\"\x85\x01\n" +
+	"\x05Event\x12+\n" +
+	"\x04kind\x18\x01 \x01(\x0e2\x17.floofspec.v1.EventKindR\x04kind\x12&\n" +
+	"\x04rule\x18\x02 \x01(\v2\x12.floofspec.v1.RuleR\x04rule\x12'\n" +
+	"\x0fprevious_reason\x18\x03 \x01(\tR\x0epreviousReason\"<\n" +
+	"\x0fValidateRequest\x12)\n" +
+	"\x05route\x18\x01 \x01(\v2\x13.floofspec.v1.RouteR\x05route\"w\n" +
+	"\x10ValidateResponse\x12\x1a\n" +
+	"\bfeasible\x18\x01 \x01(\bR\bfeasible\x12\x16\n" +
+	"\x06reason\x18\x02 \x01(\tR\x06reason\x12\x14\n" +
+	"\x05error\x18\x03 \x01(\tR\x05error\x12\x19\n" +
+	"\brfc_rule\x18\x04 \x01(\tR\arfcRule*\x8f\x01\n" +
+	"\tEventKind\x12\x1a\n" +
+	"\x16EVENT_KIND_UNSPECIFIED\x10\x00\x12\x17\n" +
+	"\x13EVENT_KIND_ACCEPTED\x10\x01\x12\x17\n" +
+	"\x13EVENT_KIND_REJECTED\x10\x02\x12\x18\n" +
+	"\x14EVENT_KIND_WITHDRAWN\x10\x03\x12\x1a\n" +
+	"\x16EVENT_KIND_REVALIDATED\x10\x042\x81\x03\n" +
+	"\bFlowSpec\x12;\n" +
+	"\aAddRule\x12\x1c.floofspec.v1.AddRuleRequest\x1a\x12.floofspec.v1.Rule\x12U\n" +
+	"\fWithdrawRule\x12!.floofspec.v1.WithdrawRuleRequest\x1a\".floofspec.v1.WithdrawRuleResponse\x12L\n" +
+	"\tListRules\x12\x1e.floofspec.v1.ListRulesRequest\x1a\x1f.floofspec.v1.ListRulesResponse\x12H\n" +
+	"\fStreamEvents\x12!.floofspec.v1.StreamEventsRequest\x1a\x13.floofspec.v1.Event0\x01\x12I\n" +
+	"\bValidate\x12\x1d.floofspec.v1.ValidateRequest\x1a\x1e.floofspec.v1.ValidateResponseB4Z2floofspectools/flowspecinternal/grpcapi/flowspecpbb\x06proto3"
+
+var (
+	file_flowspecpb_flowspec_proto_rawDescOnce sync.Once
+	file_flowspecpb_flowspec_proto_rawDescData []byte
+)
+
+func file_flowspecpb_flowspec_proto_rawDescGZIP() []byte {
+	file_flowspecpb_flowspec_proto_rawDescOnce.Do(func() {
+		file_flowspecpb_flowspec_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_flowspecpb_flowspec_proto_rawDesc), len(file_flowspecpb_flowspec_proto_rawDesc)))
+	})
+	return file_flowspecpb_flowspec_proto_rawDescData
+}
+
+var file_flowspecpb_flowspec_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_flowspecpb_flowspec_proto_msgTypes = make([]protoimpl.MessageInfo, 11)
+var file_flowspecpb_flowspec_proto_goTypes = []any{
+	(EventKind)(0),                // 0: floofspec.v1.EventKind
+	(*Route)(nil),                 // 1: floofspec.v1.Route
+	(*Rule)(nil),                  // 2: floofspec.v1.Rule
+	(*AddRuleRequest)(nil),        // 3: floofspec.v1.AddRuleRequest
+	(*WithdrawRuleRequest)(nil),   // 4: floofspec.v1.WithdrawRuleRequest
+	(*WithdrawRuleResponse)(nil),  // 5: floofspec.v1.WithdrawRuleResponse
+	(*ListRulesRequest)(nil),      // 6: floofspec.v1.ListRulesRequest
+	(*ListRulesResponse)(nil),     // 7: floofspec.v1.ListRulesResponse
+	(*StreamEventsRequest)(nil),   // 8: floofspec.v1.StreamEventsRequest
+	(*Event)(nil),                 // 9: floofspec.v1.Event
+	(*ValidateRequest)(nil),       // 10: floofspec.v1.ValidateRequest
+	(*ValidateResponse)(nil),      // 11: floofspec.v1.ValidateResponse
+	(*timestamppb.Timestamp)(nil), // 12: google.protobuf.Timestamp
+	(*durationpb.Duration)(nil),   // 13: google.protobuf.Duration
+}
+var file_flowspecpb_flowspec_proto_depIdxs = []int32{
+	1,  // 0: floofspec.v1.Rule.route:type_name -> floofspec.v1.Route
+	12, // 1: floofspec.v1.Rule.expires:type_name -> google.protobuf.Timestamp
+	1,  // 2: floofspec.v1.AddRuleRequest.route:type_name -> floofspec.v1.Route
+	13, // 3: floofspec.v1.AddRuleRequest.ttl:type_name -> google.protobuf.Duration
+	13, // 4: floofspec.v1.AddRuleRequest.idle:type_name -> google.protobuf.Duration
+	2,  // 5: floofspec.v1.ListRulesResponse.rules:type_name -> floofspec.v1.Rule
+	0,  // 6: floofspec.v1.StreamEventsRequest.kinds:type_name -> floofspec.v1.EventKind
+	0,  // 7: floofspec.v1.Event.kind:type_name -> floofspec.v1.EventKind
+	2,  // 8: floofspec.v1.Event.rule:type_name -> floofspec.v1.Rule
+	1,  // 9: floofspec.v1.ValidateRequest.route:type_name -> floofspec.v1.Route
+	3,  // 10: floofspec.v1.FlowSpec.AddRule:input_type -> floofspec.v1.AddRuleRequest
+	4,  // 11: floofspec.v1.FlowSpec.WithdrawRule:input_type -> floofspec.v1.WithdrawRuleRequest
+	6,  // 12: floofspec.v1.FlowSpec.ListRules:input_type -> floofspec.v1.ListRulesRequest
+	8,  // 13: floofspec.v1.FlowSpec.StreamEvents:input_type -> floofspec.v1.StreamEventsRequest
+	10, // 14: floofspec.v1.FlowSpec.Validate:input_type -> floofspec.v1.ValidateRequest
+	2,  // 15: floofspec.v1.FlowSpec.AddRule:output_type -> floofspec.v1.Rule
+	5,  // 16: floofspec.v1.FlowSpec.WithdrawRule:output_type -> floofspec.v1.WithdrawRuleResponse
+	7,  // 17: floofspec.v1.FlowSpec.ListRules:output_type -> floofspec.v1.ListRulesResponse
+	9,  // 18: floofspec.v1.FlowSpec.StreamEvents:output_type -> floofspec.v1.Event
+	11, // 19: floofspec.v1.FlowSpec.Validate:output_type -> floofspec.v1.ValidateResponse
+	15, // [15:20] is the sub-list for method output_type
+	10, // [10:15] is the sub-list for method input_type
+	10, // [10:10] is the sub-list for extension type_name
+	10, // [10:10] is the sub-list for extension extendee
+	0,  // [0:10] is the sub-list for field type_name
+}
+
+func init() { file_flowspecpb_flowspec_proto_init() }
+func file_flowspecpb_flowspec_proto_init() {
+	if File_flowspecpb_flowspec_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_flowspecpb_flowspec_proto_rawDesc), len(file_flowspecpb_flowspec_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   11,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_flowspecpb_flowspec_proto_goTypes,
+		DependencyIndexes: file_flowspecpb_flowspec_proto_depIdxs,
+		EnumInfos:         file_flowspecpb_flowspec_proto_enumTypes,
+		MessageInfos:      file_flowspecpb_flowspec_proto_msgTypes,
+	}.Build()
+	File_flowspecpb_flowspec_proto = out.File
+	file_flowspecpb_flowspec_proto_goTypes = nil
+	file_flowspecpb_flowspec_proto_depIdxs = nil
+}
@@ -0,0 +1,299 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: flowspecpb/flowspec.proto
+
+package flowspecpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	FlowSpec_AddRule_FullMethodName      = "/floofspec.v1.FlowSpec/AddRule"
+	FlowSpec_WithdrawRule_FullMethodName = "/floofspec.v1.FlowSpec/WithdrawRule"
+	FlowSpec_ListRules_FullMethodName    = "/floofspec.v1.FlowSpec/ListRules"
+	FlowSpec_StreamEvents_FullMethodName = "/floofspec.v1.FlowSpec/StreamEvents"
+	FlowSpec_Validate_FullMethodName     = "/floofspec.v1.FlowSpec/Validate"
+)
+
+// FlowSpecClient is the client API for FlowSpec service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// FlowSpec manages locally originated FlowSpec rules and reports the
+// validation state of received ones.
+type FlowSpecClient interface {
+	// AddRule validates and originates a rule, replacing the rule with the
+	// same id. Infeasible rules fail with FAILED_PRECONDITION.
+	AddRule(ctx context.Context, in *AddRuleRequest, opts ...grpc.CallOption) (*Rule, error)
+	// WithdrawRule withdraws a locally originated rule.
+	WithdrawRule(ctx context.Context, in *WithdrawRuleRequest, opts ...grpc.CallOption) (*WithdrawRuleResponse, error)
+	// ListRules lists the locally originated or the received rules.
+	ListRules(ctx context.Context, in *ListRulesRequest, opts ...grpc.CallOption) (*ListRulesResponse, error)
+	// StreamEvents streams rule changes until the client cancels.
+	StreamEvents(ctx context.Context, in *StreamEventsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Event], error)
+	// Validate checks a rule for feasibility without originating it.
+	Validate(ctx context.Context, in *ValidateRequest, opts ...grpc.CallOption) (*ValidateResponse, error)
+}
+
+type flowSpecClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewFlowSpecClient(cc grpc.ClientConnInterface) FlowSpecClient {
+	return &flowSpecClient{cc}
+}
+
+func (c *flowSpecClient) AddRule(ctx context.Context, in *AddRuleRequest, opts ...grpc.CallOption) (*Rule, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Rule)
+	err := c.cc.Invoke(ctx, FlowSpec_AddRule_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *flowSpecClient) WithdrawRule(ctx context.Context, in *WithdrawRuleRequest, opts ...grpc.CallOption) (*WithdrawRuleResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(WithdrawRuleResponse)
+	err := c.cc.Invoke(ctx, FlowSpec_WithdrawRule_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *flowSpecClient) ListRules(ctx context.Context, in *ListRulesRequest, opts ...grpc.CallOption) (*ListRulesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListRulesResponse)
+	err := c.cc.Invoke(ctx, FlowSpec_ListRules_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *flowSpecClient) StreamEvents(ctx context.Context, in *StreamEventsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Event], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &FlowSpec_ServiceDesc.Streams[0], FlowSpec_StreamEvents_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[StreamEventsRequest, Event]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type FlowSpec_StreamEventsClient = grpc.ServerStreamingClient[Event]
+
+func (c *flowSpecClient) Validate(ctx context.Context, in *ValidateRequest, opts ...grpc.CallOption) (*ValidateResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ValidateResponse)
+	err := c.cc.Invoke(ctx, FlowSpec_Validate_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// FlowSpecServer is the server API for FlowSpec service.
+// All implementations must embed UnimplementedFlowSpecServer
+// for forward compatibility.
+//
+// FlowSpec manages locally originated FlowSpec rules and reports the
+// validation state of received ones.
+type FlowSpecServer interface {
+	// AddRule validates and originates a rule, replacing the rule with the
+	// same id. Infeasible rules fail with FAILED_PRECONDITION.
+	AddRule(context.Context, *AddRuleRequest) (*Rule, error)
+	// WithdrawRule withdraws a locally originated rule.
+	WithdrawRule(context.Context, *WithdrawRuleRequest) (*WithdrawRuleResponse, error)
+	// ListRules lists the locally originated or the received rules.
+	ListRules(context.Context, *ListRulesRequest) (*ListRulesResponse, error)
+	// StreamEvents streams rule changes until the client cancels.
+	StreamEvents(*StreamEventsRequest, grpc.ServerStreamingServer[Event]) error
+	// Validate checks a rule for feasibility without originating it.
+	Validate(context.Context, *ValidateRequest) (*ValidateResponse, error)
+	mustEmbedUnimplementedFlowSpecServer()
+}
+
+// UnimplementedFlowSpecServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedFlowSpecServer struct{}
+
+func (UnimplementedFlowSpecServer) AddRule(context.Context, *AddRuleRequest) (*Rule, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AddRule not implemented")
+}
+func (UnimplementedFlowSpecServer) WithdrawRule(context.Context, *WithdrawRuleRequest) (*WithdrawRuleResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method WithdrawRule not implemented")
+}
+func (UnimplementedFlowSpecServer) ListRules(context.Context, *ListRulesRequest) (*ListRulesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListRules not implemented")
+}
+func (UnimplementedFlowSpecServer) StreamEvents(*StreamEventsRequest, grpc.ServerStreamingServer[Event]) error {
+	return status.Errorf(codes.Unimplemented, "method StreamEvents not implemented")
+}
+func (UnimplementedFlowSpecServer) Validate(context.Context, *ValidateRequest) (*ValidateResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Validate not implemented")
+}
+func (UnimplementedFlowSpecServer) mustEmbedUnimplementedFlowSpecServer() {}
+func (UnimplementedFlowSpecServer) testEmbeddedByValue()                  {}
+
+// UnsafeFlowSpecServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to FlowSpecServer will
+// result in compilation errors.
+type UnsafeFlowSpecServer interface {
+	mustEmbedUnimplementedFlowSpecServer()
+}
+
+func RegisterFlowSpecServer(s grpc.ServiceRegistrar, srv FlowSpecServer) {
+	// If the following call pancis, it indicates UnimplementedFlowSpecServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&FlowSpec_ServiceDesc, srv)
+}
+
+func _FlowSpec_AddRule_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AddRuleRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FlowSpecServer).AddRule(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FlowSpec_AddRule_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FlowSpecServer).AddRule(ctx, req.(*AddRuleRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FlowSpec_WithdrawRule_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(WithdrawRuleRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FlowSpecServer).WithdrawRule(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FlowSpec_WithdrawRule_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FlowSpecServer).WithdrawRule(ctx, req.(*WithdrawRuleRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FlowSpec_ListRules_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListRulesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FlowSpecServer).ListRules(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FlowSpec_ListRules_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FlowSpecServer).ListRules(ctx, req.(*ListRulesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FlowSpec_StreamEvents_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamEventsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(FlowSpecServer).StreamEvents(m, &grpc.GenericServerStream[StreamEventsRequest, Event]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type FlowSpec_StreamEventsServer = grpc.ServerStreamingServer[Event]
+
+func _FlowSpec_Validate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ValidateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FlowSpecServer).Validate(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FlowSpec_Validate_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FlowSpecServer).Validate(ctx, req.(*ValidateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// FlowSpec_ServiceDesc is the grpc.ServiceDesc for FlowSpec service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var FlowSpec_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "floofspec.v1.FlowSpec",
+	HandlerType: (*FlowSpecServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "AddRule",
+			Handler:    _FlowSpec_AddRule_Handler,
+		},
+		{
+			MethodName: "WithdrawRule",
+			Handler:    _FlowSpec_WithdrawRule_Handler,
+		},
+		{
+			MethodName: "ListRules",
+			Handler:    _FlowSpec_ListRules_Handler,
+		},
+		{
+			MethodName: "Validate",
+			Handler:    _FlowSpec_Validate_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamEvents",
+			Handler:       _FlowSpec_StreamEvents_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "flowspecpb/flowspec.proto",
+}
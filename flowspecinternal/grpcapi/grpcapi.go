@@ -0,0 +1,360 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+// Package grpcapi implements the floofspec.v1.FlowSpec gRPC service of
+// flowspecpb/flowspec.proto on a FlowSpecRIB of locally originated rules:
+//
+//	srv := grpc.NewServer()
+//	flowspecpb.RegisterFlowSpecServer(srv, grpcapi.New(local, &grpcapi.Options{...}))
+//
+// Routes carry their components in the rule syntax of fs.ParseComponents
+// and rule ids are rib.FlowSpecKey. Regenerate the flowspecpb package with
+// "go generate" after changing the proto; it needs protoc, protoc-gen-go and
+// protoc-gen-go-grpc.
+//
+// With Options.Authz every call requires an API token in the
+// "authorization" metadata or a verified client certificate, failing with
+// UNAUTHENTICATED without and PERMISSION_DENIED for a role lacking the
+// permission, see package authz.
+package grpcapi
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative flowspecpb/flowspec.proto
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"sync"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/authz"
+	"floofspectools/flowspecinternal/events"
+	"floofspectools/flowspecinternal/grpcapi/flowspecpb"
+	"floofspectools/flowspecinternal/rib"
+)
+
+// DefaultEventBuffer is the number of events buffered per StreamEvents call
+// when Options.EventBuffer is zero.
+const DefaultEventBuffer = 256
+
+// Options configures a Server.
+type Options struct {
+	// Received, if set, is listed by ListRules with received set.
+	Received *rib.FlowSpecRIB
+	// Validate checks rules for AddRule and Validate, e.g.
+	// fs.ValidateFeasibility against the unicast RIB. Nil accepts every rule.
+	Validate func(*fs.FlowSpecRoute) error
+	// Events, if set, is streamed by StreamEvents, typically the bus of the
+	// local and received RIBs.
+	Events *events.Bus
+	// EventBuffer bounds the events queued for a slow StreamEvents client,
+	// which is disconnected with RESOURCE_EXHAUSTED when it overflows.
+	EventBuffer int
+	// Logger, if set, receives the rule changes made through the service.
+	Logger *slog.Logger
+	// Authz, if set, authenticates and authorizes the callers; it should
+	// be subscribed to the events of local to forget withdrawn rules.
+	Authz *authz.Authorizer
+}
+
+// Server implements flowspecpb.FlowSpecServer.
+type Server struct {
+	flowspecpb.UnimplementedFlowSpecServer
+	local *rib.FlowSpecRIB
+	opts  Options
+	log   *slog.Logger
+}
+
+// New returns a Server managing the rules of local.
+func New(local *rib.FlowSpecRIB, opts *Options) *Server {
+	var o Options
+	if opts != nil {
+		o = *opts
+	}
+	if o.EventBuffer <= 0 {
+		o.EventBuffer = DefaultEventBuffer
+	}
+	return &Server{local: local, opts: o, log: fs.SubsystemLogger(o.Logger, fs.SubsystemAPI)}
+}
+
+// RouteFromProto converts r, parsing its components.
+func RouteFromProto(r *flowspecpb.Route) (*fs.FlowSpecRoute, error) {
+	if r == nil {
+		return nil, errors.New("missing route")
+	}
+	if r.Afi > 0xffff || r.Safi > 0xff {
+		return nil, fmt.Errorf("invalid family %d/%d", r.Afi, r.Safi)
+	}
+	l, err := fs.ParseComponents(r.Components)
+	if err != nil {
+		return nil, err
+	}
+	route := &fs.FlowSpecRoute{
+		AFI:        uint16(r.Afi),
+		SAFI:       uint8(r.Safi),
+		Components: l,
+		FromEBGP:   r.FromEbgp,
+		NeighborAS: r.NeighborAs,
+		ASPath:     r.AsPath,
+	}
+	if route.AFI == 0 {
+		route.AFI = fs.AFIIPv4
+	}
+	if len(r.Rd) > 0 {
+		if len(r.Rd) != len(route.RD) {
+			return nil, fmt.Errorf("invalid route distinguisher %x", r.Rd)
+		}
+		route.RD = [8]byte(r.Rd)
+	}
+	if r.OriginatorId != "" {
+		a, err := netip.ParseAddr(r.OriginatorId)
+		if err != nil {
+			return nil, fmt.Errorf("invalid originator id %q", r.OriginatorId)
+		}
+		route.OriginatorID = a.Unmap()
+	}
+	for _, c := range r.ExtCommunities {
+		if len(c) != 8 {
+			return nil, fmt.Errorf("invalid extended community %x", c)
+		}
+		route.ExtCommunities = append(route.ExtCommunities, [8]byte(c))
+	}
+	for _, c := range l.Components {
+		if c.Type == fs.ComponentTypeDestinationPrefix {
+			route.DestPrefix = c.Prefix
+		}
+	}
+	return route, nil
+}
+
+// RouteToProto converts r.
+func RouteToProto(r *fs.FlowSpecRoute) *flowspecpb.Route {
+	p := &flowspecpb.Route{
+		Afi:        uint32(r.AFI),
+		Safi:       uint32(r.SAFI),
+		Components: r.Components.String(),
+		FromEbgp:   r.FromEBGP,
+		NeighborAs: r.NeighborAS,
+		AsPath:     r.ASPath,
+	}
+	if r.RD != [8]byte{} {
+		p.Rd = r.RD[:]
+	}
+	if r.OriginatorID.IsValid() {
+		p.OriginatorId = r.OriginatorID.String()
+	}
+	for _, c := range r.ExtCommunities {
+		p.ExtCommunities = append(p.ExtCommunities, c[:])
+	}
+	return p
+}
+
+func ruleToProto(r *rib.FlowSpecRIB, route *fs.FlowSpecRoute, err error) *flowspecpb.Rule {
+	p := &flowspecpb.Rule{Id: rib.FlowSpecKey(route), Route: RouteToProto(route), Feasible: err == nil}
+	if err != nil {
+		p.Reason, p.Error = fs.Reason(err), err.Error()
+	}
+	if r != nil {
+		if at := r.Expiry(route); !at.IsZero() {
+			p.Expires = timestamppb.New(at)
+		}
+	}
+	return p
+}
+
+// authorize identifies the caller of ctx and checks that it holds p. Without
+// Options.Authz every caller is allowed and has the zero Identity.
+func (s *Server) authorize(ctx context.Context, p authz.Permission) (authz.Identity, error) {
+	if s.opts.Authz == nil {
+		return authz.Identity{}, nil
+	}
+	var auth string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get("authorization"); len(v) > 0 {
+			auth = v[0]
+		}
+	}
+	var state *tls.ConnectionState
+	if pr, ok := peer.FromContext(ctx); ok {
+		if info, ok := pr.AuthInfo.(credentials.TLSInfo); ok {
+			state = &info.State
+		}
+	}
+	id, err := s.opts.Authz.Identify(auth, state)
+	if err != nil {
+		return id, status.Error(codes.Unauthenticated, err.Error())
+	}
+	if err := authz.Check(id, p); err != nil {
+		s.log.Warn("request denied", "caller", id.Name, "role", id.Role.String(), "error", err)
+		return id, status.Error(codes.PermissionDenied, err.Error())
+	}
+	return id, nil
+}
+
+// checkRule checks that id may originate, replace or withdraw route.
+func (s *Server) checkRule(id authz.Identity, route *fs.FlowSpecRoute) error {
+	if s.opts.Authz == nil {
+		return nil
+	}
+	_, exists := s.local.Snapshot().Get(route)
+	if err := s.opts.Authz.CheckRule(id, rib.FlowSpecKey(route), exists); err != nil {
+		s.log.Warn("request denied", "caller", id.Name, fs.LogKeyRule, rib.FlowSpecKey(route), "error", err)
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+	return nil
+}
+
+func (s *Server) validate(route *fs.FlowSpecRoute) error {
+	if s.opts.Validate == nil {
+		return nil
+	}
+	return s.opts.Validate(route)
+}
+
+// AddRule implements flowspecpb.FlowSpecServer.
+func (s *Server) AddRule(ctx context.Context, req *flowspecpb.AddRuleRequest) (*flowspecpb.Rule, error) {
+	id, err := s.authorize(ctx, authz.Originate)
+	if err != nil {
+		return nil, err
+	}
+	route, err := RouteFromProto(req.Route)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	lt := rib.Lifetime{TTL: req.Ttl.AsDuration(), Idle: req.Idle.AsDuration()}
+	if lt.TTL < 0 || lt.Idle < 0 {
+		return nil, status.Error(codes.InvalidArgument, "negative lifetime")
+	}
+	if err := s.checkRule(id, route); err != nil {
+		return nil, err
+	}
+	if err := s.validate(route); err != nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "%s: %v", fs.Reason(err), err)
+	}
+	s.local.InsertWithLifetime(route, nil, lt)
+	if s.opts.Authz != nil {
+		s.opts.Authz.SetOwner(rib.FlowSpecKey(route), id)
+	}
+	s.log.Info("rule originated", fs.LogKeyRule, rib.FlowSpecKey(route))
+	return ruleToProto(s.local, route, nil), nil
+}
+
+// WithdrawRule implements flowspecpb.FlowSpecServer.
+func (s *Server) WithdrawRule(ctx context.Context, req *flowspecpb.WithdrawRuleRequest) (*flowspecpb.WithdrawRuleResponse, error) {
+	id, err := s.authorize(ctx, authz.Originate)
+	if err != nil {
+		return nil, err
+	}
+	for e := range s.local.Snapshot().All() {
+		if e.Key == req.Id {
+			if err := s.checkRule(id, e.Route); err != nil {
+				return nil, err
+			}
+			s.local.Delete(e.Route)
+			s.log.Info("rule withdrawn", fs.LogKeyRule, e.Key)
+			return &flowspecpb.WithdrawRuleResponse{}, nil
+		}
+	}
+	return nil, status.Error(codes.NotFound, rib.ErrUnknownRule.Error())
+}
+
+// ListRules implements flowspecpb.FlowSpecServer.
+func (s *Server) ListRules(ctx context.Context, req *flowspecpb.ListRulesRequest) (*flowspecpb.ListRulesResponse, error) {
+	if _, err := s.authorize(ctx, authz.Read); err != nil {
+		return nil, err
+	}
+	r := s.local
+	if req.Received {
+		if r = s.opts.Received; r == nil {
+			return nil, status.Error(codes.Unimplemented, "no received rules")
+		}
+	}
+	resp := &flowspecpb.ListRulesResponse{}
+	for e := range r.Snapshot().All() {
+		resp.Rules = append(resp.Rules, ruleToProto(r, e.Route, e.Err))
+	}
+	return resp, nil
+}
+
+// StreamEvents implements flowspecpb.FlowSpecServer. Events are queued
+// rather than sent from the publisher, so a slow client does not stall the
+// RIB. The response headers are sent once subscribed: a client that waits
+// for them misses no later event.
+func (s *Server) StreamEvents(req *flowspecpb.StreamEventsRequest, stream flowspecpb.FlowSpec_StreamEventsServer) error {
+	if _, err := s.authorize(stream.Context(), authz.Read); err != nil {
+		return err
+	}
+	if s.opts.Events == nil {
+		return status.Error(codes.Unimplemented, "no event bus")
+	}
+	var kinds []events.Kind
+	for _, k := range req.Kinds {
+		kinds = append(kinds, events.Kind(k))
+	}
+	queue := make(chan events.Event, s.opts.EventBuffer)
+	overflow := make(chan struct{})
+	var once sync.Once
+	cancel := s.opts.Events.Subscribe(func(e events.Event) {
+		select {
+		case queue <- e:
+		default:
+			once.Do(func() { close(overflow) })
+		}
+	}, kinds...)
+	defer cancel()
+	if err := stream.SendHeader(nil); err != nil {
+		return err
+	}
+	for {
+		select {
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		case <-overflow:
+			return status.Error(codes.ResourceExhausted, "event stream too slow")
+		case e := <-queue:
+			if err := stream.Send(eventToProto(e)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// eventToProto converts e. The EventKind values equal those of events.Kind.
+func eventToProto(e events.Event) *flowspecpb.Event {
+	p := &flowspecpb.Event{Kind: flowspecpb.EventKind(e.Kind), Rule: ruleToProto(nil, e.Route, e.Err)}
+	if e.Previous != nil {
+		p.PreviousReason = fs.Reason(e.Previous)
+	}
+	if e.Kind == events.RuleWithdrawn {
+		// a withdrawn rule is not infeasible, Err is why it was withdrawn
+		p.Rule.Feasible = true
+	}
+	return p
+}
+
+// Validate implements flowspecpb.FlowSpecServer.
+func (s *Server) Validate(ctx context.Context, req *flowspecpb.ValidateRequest) (*flowspecpb.ValidateResponse, error) {
+	if _, err := s.authorize(ctx, authz.Read); err != nil {
+		return nil, err
+	}
+	route, err := RouteFromProto(req.Route)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	resp := &flowspecpb.ValidateResponse{Feasible: true}
+	if err := s.validate(route); err != nil {
+		resp.Feasible, resp.Reason, resp.Error, resp.RfcRule = false, fs.Reason(err), err.Error(), fs.RFCRule(err)
+	}
+	return resp, nil
+}
@@ -0,0 +1,182 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package grpcapi
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/authz"
+	"floofspectools/flowspecinternal/events"
+	"floofspectools/flowspecinternal/grpcapi/flowspecpb"
+	"floofspectools/flowspecinternal/rib"
+)
+
+func dial(t *testing.T, s *Server) flowspecpb.FlowSpecClient {
+	t.Helper()
+	lis := bufconn.Listen(1 << 16)
+	srv := grpc.NewServer()
+	flowspecpb.RegisterFlowSpecServer(srv, s)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return flowspecpb.NewFlowSpecClient(conn)
+}
+
+func TestService(t *testing.T) {
+	bus := events.NewBus()
+	local := rib.NewFlowSpecRIB(&rib.FlowSpecOptions{Events: bus})
+	received := rib.NewFlowSpecRIB(nil)
+	c := dial(t, New(local, &Options{
+		Received: received,
+		Events:   bus,
+		Validate: func(r *fs.FlowSpecRoute) error {
+			if r.DestPrefix == nil || r.DestPrefix.String() == "203.0.113.0/24" {
+				return fs.ErrNoBestUnicast
+			}
+			return nil
+		},
+	}))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := c.StreamEvents(ctx, &flowspecpb.StreamEventsRequest{Kinds: []flowspecpb.EventKind{flowspecpb.EventKind_EVENT_KIND_WITHDRAWN}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Header(); err != nil {
+		t.Fatal(err)
+	}
+
+	route := &flowspecpb.Route{Afi: 1, Components: "dst 192.0.2.0/24 proto tcp dport =443", NeighborAs: 64500}
+	rule, err := c.AddRule(ctx, &flowspecpb.AddRuleRequest{Route: route, Ttl: durationpb.New(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rule.Feasible || rule.Expires == nil || rule.Route.Components != route.Components {
+		t.Errorf("AddRule() = %v", rule)
+	}
+
+	_, err = c.AddRule(ctx, &flowspecpb.AddRuleRequest{Route: &flowspecpb.Route{Components: "dst 203.0.113.0/24"}})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("AddRule(infeasible) error = %v, want FailedPrecondition", err)
+	}
+	_, err = c.AddRule(ctx, &flowspecpb.AddRuleRequest{Route: &flowspecpb.Route{Components: "dst nowhere"}})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("AddRule(invalid) error = %v, want InvalidArgument", err)
+	}
+
+	v, err := c.Validate(ctx, &flowspecpb.ValidateRequest{Route: &flowspecpb.Route{Components: "dst 203.0.113.0/24"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Feasible || v.Reason != "no-best-unicast" || v.RfcRule != "b" {
+		t.Errorf("Validate() = %v", v)
+	}
+
+	list, err := c.ListRules(ctx, &flowspecpb.ListRulesRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Rules) != 1 || list.Rules[0].Id != rule.Id {
+		t.Errorf("ListRules() = %v", list.Rules)
+	}
+	list, err = c.ListRules(ctx, &flowspecpb.ListRulesRequest{Received: true})
+	if err != nil || len(list.Rules) != 0 {
+		t.Errorf("ListRules(received) = %v, %v", list, err)
+	}
+
+	if _, err := c.WithdrawRule(ctx, &flowspecpb.WithdrawRuleRequest{Id: rule.Id}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.WithdrawRule(ctx, &flowspecpb.WithdrawRuleRequest{Id: rule.Id}); status.Code(err) != codes.NotFound {
+		t.Errorf("WithdrawRule(again) error = %v, want NotFound", err)
+	}
+
+	e, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Kind != flowspecpb.EventKind_EVENT_KIND_WITHDRAWN || e.Rule.Id != rule.Id {
+		t.Errorf("StreamEvents() = %v", e)
+	}
+}
+
+func TestRouteProto(t *testing.T) {
+	p := &flowspecpb.Route{
+		Afi: 1, Safi: 134, Rd: []byte{0, 1, 0, 0, 0xfd, 0xe8, 0, 1},
+		Components: "dst 192.0.2.0/24 proto udp", NeighborAs: 64500, AsPath: []uint32{64500, 64501},
+		OriginatorId: "192.0.2.1", ExtCommunities: [][]byte{{0x80, 0x06, 0, 0, 0, 0, 0, 0}},
+	}
+	r, err := RouteFromProto(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.DestPrefix == nil || r.DestPrefix.String() != "192.0.2.0/24" {
+		t.Errorf("DestPrefix = %v", r.DestPrefix)
+	}
+	back, err := RouteFromProto(RouteToProto(r))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rib.FlowSpecKey(back) != rib.FlowSpecKey(r) || back.OriginatorID.String() != "192.0.2.1" || len(back.ExtCommunities) != 1 {
+		t.Errorf("round trip = %+v, want %+v", back, r)
+	}
+	if _, err := RouteFromProto(&flowspecpb.Route{Components: "dst 192.0.2.0/24", Rd: []byte{1}}); err == nil {
+		t.Error("RouteFromProto(short RD) succeeded")
+	}
+}
+
+func TestAuthz(t *testing.T) {
+	az := authz.New(&authz.Options{Tokens: map[string]authz.Identity{
+		"v": {Name: "noc", Role: authz.Viewer},
+		"a": {Name: "alice", Role: authz.Operator},
+		"b": {Name: "bob", Role: authz.Operator},
+	}})
+	c := dial(t, New(rib.NewFlowSpecRIB(nil), &Options{Authz: az}))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	as := func(token string) context.Context {
+		return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+	}
+	route := &flowspecpb.Route{Afi: 1, Components: "dst 192.0.2.0/24"}
+
+	if _, err := c.ListRules(ctx, &flowspecpb.ListRulesRequest{}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("ListRules(anonymous) error = %v, want Unauthenticated", err)
+	}
+	if _, err := c.ListRules(as("v"), &flowspecpb.ListRulesRequest{}); err != nil {
+		t.Errorf("ListRules(viewer) error = %v", err)
+	}
+	if _, err := c.AddRule(as("v"), &flowspecpb.AddRuleRequest{Route: route}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("AddRule(viewer) error = %v, want PermissionDenied", err)
+	}
+	rule, err := c.AddRule(as("a"), &flowspecpb.AddRuleRequest{Route: route})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.WithdrawRule(as("b"), &flowspecpb.WithdrawRuleRequest{Id: rule.Id}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("WithdrawRule(other operator) error = %v, want PermissionDenied", err)
+	}
+	if _, err := c.WithdrawRule(as("a"), &flowspecpb.WithdrawRuleRequest{Id: rule.Id}); err != nil {
+		t.Errorf("WithdrawRule(owner) error = %v", err)
+	}
+}
@@ -0,0 +1,496 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+// Package httpapi is an embeddable HTTP management API for a FlowSpec
+// controller:
+//
+//	GET    /v1/rules           locally originated rules
+//	POST   /v1/rules           validate and originate a rule
+//	GET    /v1/rules/{id}
+//	PUT    /v1/rules/{id}      replace a rule, e.g. its actions or lifetime
+//	DELETE /v1/rules/{id}      withdraw a rule
+//	GET    /v1/received        received rules and their validation state
+//	GET    /v1/received/{id}
+//	GET    /v1/audit           audit log entries, see Options.Audit
+//	GET    /v1/policies/{peer} validation policy of a neighbor address
+//	PUT    /v1/policies/{peer}
+//	DELETE /v1/policies/{peer}
+//	GET    /healthz            liveness
+//	GET    /readyz             readiness, see Options.Ready
+//
+// Rules are rendered like fs.ValidationResult with their id, the URL-safe
+// RuleID of the route, and expiry. POST and PUT take
+//
+//	{"route": {...}, "ttl": "10m", "idle": "5m", "comment": "..."}
+//
+// with the route in the JSON of fs.FlowSpecRoute, including its provenance
+// "metadata", an optional rib.Lifetime as Go durations and an optional
+// comment for the audit log; DELETE takes the comment as query parameter.
+// The lists take repeatable ?meta=key=value or ?meta=key parameters to
+// select rules by metadata and a ?q= filter in the language of package
+// query, e.g. ?q=dst+within+192.0.2.0/24+and+action+==+discard. Errors are {"error": "..."} with, for
+// infeasible rules, the "reason" of fs.Reason.
+//
+// With Options.Authz every endpoint but /healthz and /readyz requires an
+// API token or verified client certificate, answering 401 without and 403
+// for a role lacking the permission, see package authz.
+package httpapi
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/audit"
+	"floofspectools/flowspecinternal/authz"
+	"floofspectools/flowspecinternal/query"
+	"floofspectools/flowspecinternal/rib"
+)
+
+// Options configures a Handler.
+type Options struct {
+	// Received, if set, is exposed read-only under /v1/received.
+	Received *rib.FlowSpecRIB
+	// Validate checks rules before they are originated, e.g.
+	// fs.ValidateFeasibility against the unicast RIB. Infeasible rules are
+	// refused with 422. Nil accepts every rule.
+	Validate func(*fs.FlowSpecRoute) error
+	// Ready, if set, reports whether the controller is ready, e.g. its BGP
+	// sessions are established; /readyz returns 503 with its error.
+	Ready func() error
+	// Logger, if set, receives the rule changes made through the API.
+	Logger *slog.Logger
+	// Audit, if set, records the rules originated and withdrawn through the
+	// API with the caller, and is queried under /v1/audit with the
+	// parameters since and until (RFC 3339), action (repeatable), actor,
+	// rule and limit.
+	Audit *audit.Log
+	// Authz, if set, authenticates and authorizes the callers; it should
+	// be subscribed to the events of local to forget withdrawn rules.
+	Authz *authz.Authorizer
+	// Policies, if set, is exposed under /v1/policies; PUT installs the
+	// PeerPolicy in the JSON body.
+	Policies *fs.ValidatorSet
+}
+
+// Handler serves the API.
+type Handler struct {
+	local *rib.FlowSpecRIB
+	opts  Options
+	mux   *http.ServeMux
+	log   *slog.Logger
+}
+
+// New returns a Handler managing the rules of local.
+func New(local *rib.FlowSpecRIB, opts *Options) *Handler {
+	var o Options
+	if opts != nil {
+		o = *opts
+	}
+	h := &Handler{local: local, opts: o, mux: http.NewServeMux(), log: fs.SubsystemLogger(o.Logger, fs.SubsystemAPI)}
+	h.handle("GET /v1/rules", authz.Read, h.listRules)
+	h.handle("POST /v1/rules", authz.Originate, h.createRule)
+	h.handle("GET /v1/rules/{id}", authz.Read, h.getRule)
+	h.handle("PUT /v1/rules/{id}", authz.Originate, h.replaceRule)
+	h.handle("DELETE /v1/rules/{id}", authz.Originate, h.deleteRule)
+	h.handle("GET /v1/received", authz.Read, h.listReceived)
+	h.handle("GET /v1/received/{id}", authz.Read, h.getReceived)
+	h.handle("GET /v1/audit", authz.Read, h.queryAudit)
+	h.handle("GET /v1/policies/{peer}", authz.Read, h.getPolicy)
+	h.handle("PUT /v1/policies/{peer}", authz.ChangePolicy, h.setPolicy)
+	h.handle("DELETE /v1/policies/{peer}", authz.ChangePolicy, h.deletePolicy)
+	h.mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+	h.mux.HandleFunc("GET /readyz", h.ready)
+	return h
+}
+
+// handle registers fn for pattern, requiring the caller to hold p when
+// Options.Authz is set.
+func (h *Handler) handle(pattern string, p authz.Permission, fn http.HandlerFunc) {
+	h.mux.HandleFunc(pattern, func(w http.ResponseWriter, req *http.Request) {
+		if h.opts.Authz == nil {
+			fn(w, req)
+			return
+		}
+		id, err := h.opts.Authz.Identify(req.Header.Get("Authorization"), req.TLS)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, err)
+			return
+		}
+		if err := authz.Check(id, p); err != nil {
+			h.log.Warn("request denied", "caller", id.Name, "role", id.Role.String(), "path", req.URL.Path, "remote", req.RemoteAddr)
+			writeError(w, http.StatusForbidden, err)
+			return
+		}
+		fn(w, req.WithContext(authz.NewContext(req.Context(), id)))
+	})
+}
+
+// checkRule checks that the caller of req may originate, replace or
+// withdraw route, writing 403 if not.
+func (h *Handler) checkRule(w http.ResponseWriter, req *http.Request, route *fs.FlowSpecRoute) bool {
+	if h.opts.Authz == nil {
+		return true
+	}
+	id, _ := authz.FromContext(req.Context())
+	_, exists := h.local.Snapshot().Get(route)
+	if err := h.opts.Authz.CheckRule(id, rib.FlowSpecKey(route), exists); err != nil {
+		h.log.Warn("request denied", "caller", id.Name, fs.LogKeyRule, rib.FlowSpecKey(route), "error", err)
+		writeError(w, http.StatusForbidden, err)
+		return false
+	}
+	return true
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+// RuleID identifies route in URLs: the unpadded base64url of its
+// rib.FlowSpecKey.
+func RuleID(route *fs.FlowSpecRoute) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(rib.FlowSpecKey(route)))
+}
+
+// Rule is a rule as rendered by the API.
+type Rule struct {
+	ID       string            `json:"id"`
+	Route    *fs.FlowSpecRoute `json:"route"`
+	Feasible bool              `json:"feasible"`
+	Reason   string            `json:"reason,omitempty"`
+	Error    string            `json:"error,omitempty"`
+	// Expires is when a rule with a lifetime is withdrawn unless refreshed.
+	Expires *time.Time `json:"expires,omitempty"`
+	// Stale is when a rule of a restarting peer is flushed unless
+	// re-announced.
+	Stale *time.Time `json:"stale,omitempty"`
+}
+
+// RuleRequest is the body of POST and PUT.
+type RuleRequest struct {
+	Route *fs.FlowSpecRoute `json:"route"`
+	TTL   string            `json:"ttl,omitempty"`
+	Idle  string            `json:"idle,omitempty"`
+	// Comment is recorded in the audit log.
+	Comment string `json:"comment,omitempty"`
+}
+
+func (req *RuleRequest) lifetime() (rib.Lifetime, error) {
+	var lt rib.Lifetime
+	var err error
+	if req.TTL != "" {
+		if lt.TTL, err = time.ParseDuration(req.TTL); err != nil {
+			return lt, fmt.Errorf("invalid ttl: %w", err)
+		}
+	}
+	if req.Idle != "" {
+		if lt.Idle, err = time.ParseDuration(req.Idle); err != nil {
+			return lt, fmt.Errorf("invalid idle: %w", err)
+		}
+	}
+	if lt.TTL < 0 || lt.Idle < 0 {
+		return lt, errors.New("negative lifetime")
+	}
+	return lt, nil
+}
+
+type errorJSON struct {
+	Error  string `json:"error"`
+	Reason string `json:"reason,omitempty"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, errorJSON{Error: err.Error()})
+}
+
+func rule(r *rib.FlowSpecRIB, e *rib.FlowSpecEntry) Rule {
+	out := Rule{ID: RuleID(e.Route), Route: e.Route, Feasible: e.Err == nil}
+	if e.Err != nil {
+		out.Reason, out.Error = fs.Reason(e.Err), e.Err.Error()
+	}
+	if at := r.Expiry(e.Route); !at.IsZero() {
+		out.Expires = &at
+	}
+	if at := r.StaleUntil(e.Route); !at.IsZero() {
+		out.Stale = &at
+	}
+	return out
+}
+
+// list renders the rules of r, those with the route metadata of the
+// repeatable ?meta=key=value or ?meta=key parameter and matching the
+// ?q= query only.
+func list(w http.ResponseWriter, req *http.Request, r *rib.FlowSpecRIB) {
+	sel := map[string]string{}
+	for _, m := range req.URL.Query()["meta"] {
+		k, v, _ := strings.Cut(m, "=")
+		sel[k] = v
+	}
+	q, err := query.Parse(req.URL.Query().Get("q"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	match := rib.WithMetadata(sel)
+	rules := []Rule{}
+	for _, e := range q.Run(r.Snapshot()) {
+		if match(e) {
+			rules = append(rules, rule(r, e))
+		}
+	}
+	writeJSON(w, http.StatusOK, rules)
+}
+
+// lookup finds the entry of the id in the request path.
+func lookup(w http.ResponseWriter, req *http.Request, r *rib.FlowSpecRIB) (*rib.FlowSpecEntry, bool) {
+	key, err := base64.RawURLEncoding.DecodeString(req.PathValue("id"))
+	if err == nil {
+		for e := range r.Snapshot().All() {
+			if e.Key == string(key) {
+				return e, true
+			}
+		}
+	}
+	writeError(w, http.StatusNotFound, rib.ErrUnknownRule)
+	return nil, false
+}
+
+func (h *Handler) listRules(w http.ResponseWriter, req *http.Request) {
+	list(w, req, h.local)
+}
+
+func (h *Handler) getRule(w http.ResponseWriter, req *http.Request) {
+	if e, ok := lookup(w, req, h.local); ok {
+		writeJSON(w, http.StatusOK, rule(h.local, e))
+	}
+}
+
+func (h *Handler) listReceived(w http.ResponseWriter, req *http.Request) {
+	if h.opts.Received == nil {
+		http.NotFound(w, req)
+		return
+	}
+	list(w, req, h.opts.Received)
+}
+
+func (h *Handler) getReceived(w http.ResponseWriter, req *http.Request) {
+	if h.opts.Received == nil {
+		http.NotFound(w, req)
+		return
+	}
+	if e, ok := lookup(w, req, h.opts.Received); ok {
+		writeJSON(w, http.StatusOK, rule(h.opts.Received, e))
+	}
+}
+
+// originate decodes, validates and inserts the rule in the request body.
+// The id, if not empty, must be the RuleID of the route.
+func (h *Handler) originate(w http.ResponseWriter, req *http.Request, id string, status int) {
+	var body RuleRequest
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if body.Route == nil {
+		writeError(w, http.StatusBadRequest, errors.New("missing route"))
+		return
+	}
+	lt, err := body.lifetime()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if id != "" && RuleID(body.Route) != id {
+		writeError(w, http.StatusBadRequest, errors.New("route does not match the rule id"))
+		return
+	}
+	if !h.checkRule(w, req, body.Route) {
+		return
+	}
+	if h.opts.Validate != nil {
+		if err := h.opts.Validate(body.Route); err != nil {
+			writeJSON(w, http.StatusUnprocessableEntity, errorJSON{Error: err.Error(), Reason: fs.Reason(err)})
+			return
+		}
+	}
+	h.local.InsertWithLifetime(body.Route, nil, lt)
+	if id, ok := authz.FromContext(req.Context()); ok {
+		h.opts.Authz.SetOwner(rib.FlowSpecKey(body.Route), id)
+	}
+	h.log.Info("rule originated", fs.LogKeyRule, rib.FlowSpecKey(body.Route), "remote", req.RemoteAddr)
+	h.audit(req, audit.Entry{Action: audit.Originated, Route: body.Route, Comment: body.Comment})
+	e, _ := h.local.Snapshot().Get(body.Route)
+	w.Header().Set("Location", "/v1/rules/"+RuleID(body.Route))
+	writeJSON(w, status, rule(h.local, e))
+}
+
+func (h *Handler) createRule(w http.ResponseWriter, req *http.Request) {
+	h.originate(w, req, "", http.StatusCreated)
+}
+
+func (h *Handler) replaceRule(w http.ResponseWriter, req *http.Request) {
+	if _, ok := lookup(w, req, h.local); ok {
+		h.originate(w, req, req.PathValue("id"), http.StatusOK)
+	}
+}
+
+func (h *Handler) deleteRule(w http.ResponseWriter, req *http.Request) {
+	e, ok := lookup(w, req, h.local)
+	if !ok || !h.checkRule(w, req, e.Route) {
+		return
+	}
+	h.local.Delete(e.Route)
+	h.log.Info("rule withdrawn", fs.LogKeyRule, e.Key, "remote", req.RemoteAddr)
+	h.audit(req, audit.Entry{Action: audit.Withdrawn, Route: e.Route, Comment: req.URL.Query().Get("comment")})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) ready(w http.ResponseWriter, req *http.Request) {
+	if h.opts.Ready != nil {
+		if err := h.opts.Ready(); err != nil {
+			writeError(w, http.StatusServiceUnavailable, err)
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ready"})
+}
+
+// actor identifies the caller of req in the audit log: its authz identity,
+// or else its address.
+func actor(req *http.Request) string {
+	if id, ok := authz.FromContext(req.Context()); ok {
+		return id.Name
+	}
+	return req.RemoteAddr
+}
+
+// audit appends e made by the caller of req to the audit log, if any. The
+// change is already made, so a failure is only logged.
+func (h *Handler) audit(req *http.Request, e audit.Entry) {
+	if h.opts.Audit == nil {
+		return
+	}
+	e.Actor = actor(req)
+	if _, err := h.opts.Audit.Append(e); err != nil {
+		h.log.Error("appending audit entry", fs.LogKeyRule, rib.FlowSpecKey(e.Route), "error", err)
+	}
+}
+
+// auditFilter parses the query parameters of GET /v1/audit.
+func auditFilter(req *http.Request) (audit.Filter, error) {
+	q := req.URL.Query()
+	f := audit.Filter{Actor: q.Get("actor"), Rule: q.Get("rule")}
+	var err error
+	if s := q.Get("since"); s != "" {
+		if f.Since, err = time.Parse(time.RFC3339, s); err != nil {
+			return f, fmt.Errorf("invalid since: %w", err)
+		}
+	}
+	if s := q.Get("until"); s != "" {
+		if f.Until, err = time.Parse(time.RFC3339, s); err != nil {
+			return f, fmt.Errorf("invalid until: %w", err)
+		}
+	}
+	if s := q.Get("limit"); s != "" {
+		if f.Limit, err = strconv.Atoi(s); err != nil || f.Limit < 0 {
+			return f, fmt.Errorf("invalid limit %q", s)
+		}
+	}
+	for _, a := range q["action"] {
+		f.Actions = append(f.Actions, audit.Action(a))
+	}
+	return f, nil
+}
+
+func (h *Handler) queryAudit(w http.ResponseWriter, req *http.Request) {
+	if h.opts.Audit == nil {
+		http.NotFound(w, req)
+		return
+	}
+	f, err := auditFilter(req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	entries, err := h.opts.Audit.Query(f)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if entries == nil {
+		entries = []audit.Entry{}
+	}
+	writeJSON(w, http.StatusOK, entries)
+}
+
+// peer parses the neighbor address in the request path, writing 404 if
+// there are no policies and 400 for an invalid address.
+func (h *Handler) peer(w http.ResponseWriter, req *http.Request) (netip.Addr, bool) {
+	if h.opts.Policies == nil {
+		http.NotFound(w, req)
+		return netip.Addr{}, false
+	}
+	a, err := netip.ParseAddr(req.PathValue("peer"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return netip.Addr{}, false
+	}
+	return a, true
+}
+
+func (h *Handler) getPolicy(w http.ResponseWriter, req *http.Request) {
+	peer, ok := h.peer(w, req)
+	if !ok {
+		return
+	}
+	p := h.opts.Policies.Policy(peer)
+	if p == nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("%w %s", fs.ErrUnknownPeer, peer))
+		return
+	}
+	writeJSON(w, http.StatusOK, p)
+}
+
+func (h *Handler) setPolicy(w http.ResponseWriter, req *http.Request) {
+	peer, ok := h.peer(w, req)
+	if !ok {
+		return
+	}
+	var p fs.PeerPolicy
+	if err := json.NewDecoder(req.Body).Decode(&p); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	h.opts.Policies.Set(peer, &p)
+	h.log.Info("peer policy set", fs.LogKeyPeer, peer.String(), "caller", actor(req))
+	writeJSON(w, http.StatusOK, &p)
+}
+
+func (h *Handler) deletePolicy(w http.ResponseWriter, req *http.Request) {
+	peer, ok := h.peer(w, req)
+	if !ok {
+		return
+	}
+	h.opts.Policies.Delete(peer)
+	h.log.Info("peer policy removed", fs.LogKeyPeer, peer.String(), "caller", actor(req))
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,203 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/audit"
+	"floofspectools/flowspecinternal/authz"
+	"floofspectools/flowspecinternal/rib"
+)
+
+func route(t *testing.T, s string) *fs.FlowSpecRoute {
+	t.Helper()
+	l, err := fs.ParseComponents(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &fs.FlowSpecRoute{AFI: fs.AFIIPv4, NeighborAS: 64500, Components: l, DestPrefix: l.Components[0].Prefix}
+}
+
+func do(t *testing.T, h http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+	return w
+}
+
+func TestRules(t *testing.T) {
+	local := rib.NewFlowSpecRIB(nil)
+	h := New(local, &Options{
+		Validate: func(r *fs.FlowSpecRoute) error {
+			if r.DestPrefix.String() == "203.0.113.0/24" {
+				return fs.ErrNoBestUnicast
+			}
+			return nil
+		},
+	})
+	body := `{"route": {"afi": 1, "components": [{"type": "dst", "prefix": "192.0.2.0/24"}], "neighbor_as": 64500, "metadata": {"ticket": "NOC-1"}}, "ttl": "10m"}`
+	id := RuleID(route(t, "dst 192.0.2.0/24"))
+
+	tests := []struct {
+		name, method, path, body string
+		status                   int
+		want                     string
+	}{
+		{"create", "POST", "/v1/rules", body, http.StatusCreated, `"id":"` + id + `"`},
+		{"expires", "GET", "/v1/rules/" + id, "", http.StatusOK, `"expires":`},
+		{"list", "GET", "/v1/rules", "", http.StatusOK, `"feasible":true`},
+		{"list by metadata", "GET", "/v1/rules?meta=ticket=NOC-1", "", http.StatusOK, `"metadata":{"ticket":"NOC-1"}`},
+		{"list by key", "GET", "/v1/rules?meta=ticket", "", http.StatusOK, `"id":"` + id + `"`},
+		{"list by other metadata", "GET", "/v1/rules?meta=ticket=NOC-2", "", http.StatusOK, `[]`},
+		{"query", "GET", "/v1/rules?q=dst+within+192.0.2.0/23+and+feasible+==+true", "", http.StatusOK, `"id":"` + id + `"`},
+		{"query other", "GET", "/v1/rules?q=dst+within+198.51.100.0/24", "", http.StatusOK, `[]`},
+		{"bad query", "GET", "/v1/rules?q=dst+near+192.0.2.0/24", "", http.StatusBadRequest, "syntax error"},
+		{"replace", "PUT", "/v1/rules/" + id, strings.Replace(body, `"ttl": "10m"`, `"ttl": ""`, 1), http.StatusOK, `"feasible":true`},
+		{"replace other", "PUT", "/v1/rules/" + id, strings.Replace(body, "192.0.2.0", "198.51.100.0", 1), http.StatusBadRequest, "does not match"},
+		{"infeasible", "POST", "/v1/rules", strings.Replace(body, "192.0.2.0", "203.0.113.0", 1), http.StatusUnprocessableEntity, `"reason":"no-best-unicast"`},
+		{"bad ttl", "POST", "/v1/rules", strings.Replace(body, "10m", "ten", 1), http.StatusBadRequest, "invalid ttl"},
+		{"no route", "POST", "/v1/rules", `{}`, http.StatusBadRequest, "missing route"},
+		{"delete", "DELETE", "/v1/rules/" + id, "", http.StatusNoContent, ""},
+		{"deleted", "GET", "/v1/rules/" + id, "", http.StatusNotFound, "not in the FlowSpec RIB"},
+		{"bad id", "GET", "/v1/rules/!", "", http.StatusNotFound, ""},
+		{"no received", "GET", "/v1/received", "", http.StatusNotFound, ""},
+		{"healthz", "GET", "/healthz", "", http.StatusOK, `"ok"`},
+		{"readyz", "GET", "/readyz", "", http.StatusOK, `"ready"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := do(t, h, tt.method, tt.path, tt.body)
+			if w.Code != tt.status {
+				t.Fatalf("%s %s = %d, want %d: %s", tt.method, tt.path, w.Code, tt.status, w.Body)
+			}
+			if !strings.Contains(w.Body.String(), tt.want) {
+				t.Errorf("%s %s body lacks %q: %s", tt.method, tt.path, tt.want, w.Body)
+			}
+		})
+	}
+	if n := local.Snapshot().Len(); n != 0 {
+		t.Errorf("local RIB holds %d rules, want 0", n)
+	}
+}
+
+func TestReceived(t *testing.T) {
+	received := rib.NewFlowSpecRIB(nil)
+	r := route(t, "dst 192.0.2.0/24")
+	received.Insert(r, fs.ErrNoBestUnicast)
+	h := New(rib.NewFlowSpecRIB(nil), &Options{
+		Received: received,
+		Ready:    func() error { return errors.New("no session") },
+	})
+
+	w := do(t, h, "GET", "/v1/received", "")
+	var rules []Rule
+	if err := json.Unmarshal(w.Body.Bytes(), &rules); err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 1 || rules[0].Feasible || rules[0].Reason != "no-best-unicast" || rules[0].ID != RuleID(r) {
+		t.Errorf("GET /v1/received = %+v", rules)
+	}
+	if w := do(t, h, "GET", "/v1/received/"+RuleID(r), ""); w.Code != http.StatusOK {
+		t.Errorf("GET /v1/received/{id} = %d", w.Code)
+	}
+	if w := do(t, h, "DELETE", "/v1/received/"+RuleID(r), ""); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("DELETE /v1/received/{id} = %d, want %d", w.Code, http.StatusMethodNotAllowed)
+	}
+	if w := do(t, h, "GET", "/readyz", ""); w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), "no session") {
+		t.Errorf("GET /readyz = %d %s, want 503", w.Code, w.Body)
+	}
+}
+
+func TestAudit(t *testing.T) {
+	log, err := audit.Open(filepath.Join(t.TempDir(), "audit.jsonl"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+	h := New(rib.NewFlowSpecRIB(nil), &Options{Audit: log})
+	body := `{"route": {"afi": 1, "components": [{"type": "dst", "prefix": "192.0.2.0/24"}], "neighbor_as": 64500}, "comment": "ticket 42"}`
+	id := RuleID(route(t, "dst 192.0.2.0/24"))
+	if w := do(t, h, "POST", "/v1/rules", body); w.Code != http.StatusCreated {
+		t.Fatalf("POST /v1/rules = %d %s", w.Code, w.Body)
+	}
+	if w := do(t, h, "DELETE", "/v1/rules/"+id+"?comment=resolved", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("DELETE /v1/rules/{id} = %d %s", w.Code, w.Body)
+	}
+
+	w := do(t, h, "GET", "/v1/audit?action=withdrawn", "")
+	var entries []audit.Entry
+	if err := json.Unmarshal(w.Body.Bytes(), &entries); err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Seq != 2 || entries[0].Comment != "resolved" || entries[0].Actor == "" || entries[0].Hash == "" {
+		t.Errorf("GET /v1/audit?action=withdrawn = %+v", entries)
+	}
+	if w := do(t, h, "GET", "/v1/audit?since=yesterday", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("GET /v1/audit?since=yesterday = %d, want 400", w.Code)
+	}
+	if w := do(t, New(rib.NewFlowSpecRIB(nil), nil), "GET", "/v1/audit", ""); w.Code != http.StatusNotFound {
+		t.Errorf("GET /v1/audit without a log = %d, want 404", w.Code)
+	}
+}
+
+func doAs(t *testing.T, h http.Handler, token, method, path, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	h.ServeHTTP(w, req)
+	return w
+}
+
+func TestAuthz(t *testing.T) {
+	az := authz.New(&authz.Options{Tokens: map[string]authz.Identity{
+		"v": {Name: "noc", Role: authz.Viewer},
+		"a": {Name: "alice", Role: authz.Operator},
+		"b": {Name: "bob", Role: authz.Operator},
+		"r": {Name: "root", Role: authz.Admin},
+	}})
+	h := New(rib.NewFlowSpecRIB(nil), &Options{Authz: az, Policies: fs.NewValidatorSet(nil)})
+	body := `{"route": {"afi": 1, "components": [{"type": "dst", "prefix": "192.0.2.0/24"}], "neighbor_as": 64500}}`
+	id := RuleID(route(t, "dst 192.0.2.0/24"))
+
+	tests := []struct {
+		name, token, method, path, body string
+		status                          int
+	}{
+		{"anonymous", "", "GET", "/v1/rules", "", http.StatusUnauthorized},
+		{"unknown token", "x", "GET", "/v1/rules", "", http.StatusUnauthorized},
+		{"healthz", "", "GET", "/healthz", "", http.StatusOK},
+		{"viewer lists", "v", "GET", "/v1/rules", "", http.StatusOK},
+		{"viewer originates", "v", "POST", "/v1/rules", body, http.StatusForbidden},
+		{"operator originates", "a", "POST", "/v1/rules", body, http.StatusCreated},
+		{"other operator replaces", "b", "PUT", "/v1/rules/" + id, body, http.StatusForbidden},
+		{"other operator withdraws", "b", "DELETE", "/v1/rules/" + id, "", http.StatusForbidden},
+		{"owner replaces", "a", "PUT", "/v1/rules/" + id, body, http.StatusOK},
+		{"admin withdraws", "r", "DELETE", "/v1/rules/" + id, "", http.StatusNoContent},
+		{"operator sets policy", "a", "PUT", "/v1/policies/192.0.2.1", `{"strict": true}`, http.StatusForbidden},
+		{"admin sets policy", "r", "PUT", "/v1/policies/192.0.2.1", `{"strict": true}`, http.StatusOK},
+		{"viewer reads policy", "v", "GET", "/v1/policies/192.0.2.1", "", http.StatusOK},
+		{"bad peer", "v", "GET", "/v1/policies/peer", "", http.StatusBadRequest},
+		{"admin removes policy", "r", "DELETE", "/v1/policies/192.0.2.1", "", http.StatusNoContent},
+		{"no policy", "v", "GET", "/v1/policies/192.0.2.1", "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := doAs(t, h, tt.token, tt.method, tt.path, tt.body); w.Code != tt.status {
+				t.Errorf("%s %s = %d, want %d: %s", tt.method, tt.path, w.Code, tt.status, w.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,363 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package flowspecinternal
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrUnknownComponentType = errors.New("flowspec: unknown component type keyword")
+	ErrUnknownOperator      = errors.New("flowspec: unknown operator")
+	ErrInvalidComponent     = errors.New("flowspec: component needs exactly one of prefix, ops or raw matching its type")
+	ErrUnknownReason        = errors.New("flowspec: unknown validation reason")
+)
+
+// ParseComponentType returns the type for a keyword as returned by ComponentType.String.
+func ParseComponentType(s string) (ComponentType, error) {
+	if i := slices.Index(componentKeys[:], s); i > 0 {
+		return ComponentType(i), nil
+	}
+	if n, ok := strings.CutPrefix(s, "type-"); ok {
+		if v, err := strconv.ParseUint(n, 10, 8); err == nil {
+			return ComponentType(v), nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %q", ErrUnknownComponentType, s)
+}
+
+func (t ComponentType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+func (t *ComponentType) UnmarshalText(b []byte) error {
+	v, err := ParseComponentType(string(b))
+	if err != nil {
+		return err
+	}
+	*t = v
+	return nil
+}
+
+// numericSymbols are the JSON operators of a NumericOp, indexed by lt|gt|eq.
+// Words rather than symbols keep encoding/json from escaping < and >.
+var numericSymbols = [...]string{"false", "eq", "gt", "ge", "lt", "le", "ne", "true"}
+
+// bitmaskSymbols are the JSON operators of a BitmaskOp, indexed by bitmaskKind.
+var bitmaskSymbols = [...]string{"any", "not-any", "all", "not-all"}
+
+type opJSON struct {
+	And   bool   `json:"and,omitempty"`
+	Op    string `json:"op"`
+	Value uint64 `json:"value"`
+}
+
+// MarshalJSON renders o as {"op": "ge", "value": 1024} with "and": true for AND-ed operators.
+func (o NumericOp) MarshalJSON() ([]byte, error) {
+	i := 0
+	if o.LT {
+		i |= opLT
+	}
+	if o.GT {
+		i |= opGT
+	}
+	if o.EQ {
+		i |= opEQ
+	}
+	return json.Marshal(opJSON{And: o.And, Op: numericSymbols[i], Value: o.Value})
+}
+
+func (o *NumericOp) UnmarshalJSON(b []byte) error {
+	var j opJSON
+	if err := json.Unmarshal(b, &j); err != nil {
+		return err
+	}
+	i := slices.Index(numericSymbols[:], j.Op)
+	if i < 0 {
+		return fmt.Errorf("%w: %q", ErrUnknownOperator, j.Op)
+	}
+	*o = NumericOp{And: j.And, LT: i&opLT != 0, GT: i&opGT != 0, EQ: i&opEQ != 0, Value: j.Value}
+	return nil
+}
+
+// MarshalJSON renders o as {"op": "all", "value": 2}: "any" matches if any
+// bit of value is set, "all" if all are set, "not-any" and "not-all" negate.
+func (o BitmaskOp) MarshalJSON() ([]byte, error) {
+	return json.Marshal(opJSON{And: o.And, Op: bitmaskSymbols[bitmaskKind(o)], Value: o.Value})
+}
+
+func (o *BitmaskOp) UnmarshalJSON(b []byte) error {
+	var j opJSON
+	if err := json.Unmarshal(b, &j); err != nil {
+		return err
+	}
+	k := slices.Index(bitmaskSymbols[:], j.Op)
+	if k < 0 {
+		return fmt.Errorf("%w: %q", ErrUnknownOperator, j.Op)
+	}
+	*o = BitmaskOp{And: j.And, Not: k&1 != 0, Match: k&2 != 0, Value: j.Value}
+	return nil
+}
+
+type componentJSON struct {
+	Type   ComponentType   `json:"type"`
+	Prefix *netip.Prefix   `json:"prefix,omitempty"`
+	Ops    json.RawMessage `json:"ops,omitempty"`
+	Raw    string          `json:"raw,omitempty"`
+}
+
+// MarshalJSON renders prefixes as strings and operator sequences as a list of
+// operators. Sequences that do not decode are kept as hex in "raw".
+func (c FSComponent) MarshalJSON() ([]byte, error) {
+	j := componentJSON{Type: c.Type}
+	var (
+		ops any
+		err error
+	)
+	switch {
+	case c.Type == ComponentTypeDestinationPrefix || c.Type == ComponentTypeSourcePrefix:
+		j.Prefix = c.Prefix
+		return json.Marshal(j)
+	case c.Type.IsMAC():
+		j.Raw = hex.EncodeToString(c.Raw)
+		return json.Marshal(j)
+	case c.Type.IsBitmask():
+		ops, err = ParseBitmaskOps(c.Raw)
+	default:
+		ops, err = ParseNumericOps(c.Raw)
+	}
+	if err != nil {
+		j.Raw = hex.EncodeToString(c.Raw)
+		return json.Marshal(j)
+	}
+	if j.Ops, err = json.Marshal(ops); err != nil {
+		return nil, err
+	}
+	return json.Marshal(j)
+}
+
+func (c *FSComponent) UnmarshalJSON(b []byte) error {
+	var j componentJSON
+	if err := json.Unmarshal(b, &j); err != nil {
+		return err
+	}
+	isPrefix := j.Type == ComponentTypeDestinationPrefix || j.Type == ComponentTypeSourcePrefix
+	set := 0
+	for _, ok := range []bool{j.Prefix != nil, len(j.Ops) > 0, j.Raw != ""} {
+		if ok {
+			set++
+		}
+	}
+	if set != 1 || (j.Prefix != nil) != isPrefix {
+		return ErrInvalidComponent
+	}
+	*c = FSComponent{Type: j.Type, Prefix: j.Prefix}
+	switch {
+	case j.Raw != "":
+		raw, err := hex.DecodeString(j.Raw)
+		if err != nil {
+			return err
+		}
+		c.Raw = raw
+	case len(j.Ops) > 0 && j.Type.IsBitmask():
+		var ops []BitmaskOp
+		if err := json.Unmarshal(j.Ops, &ops); err != nil {
+			return err
+		}
+		c.Raw = EncodeBitmaskOps(ops)
+	case len(j.Ops) > 0:
+		var ops []NumericOp
+		if err := json.Unmarshal(j.Ops, &ops); err != nil {
+			return err
+		}
+		c.Raw = EncodeNumericOps(ops)
+	}
+	return nil
+}
+
+// MarshalJSON renders l as a list of components.
+func (l FSComponentList) MarshalJSON() ([]byte, error) {
+	if l.Components == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(l.Components)
+}
+
+func (l *FSComponentList) UnmarshalJSON(b []byte) error {
+	return json.Unmarshal(b, &l.Components)
+}
+
+type routeJSON struct {
+	AFI            uint16            `json:"afi,omitempty"`
+	SAFI           uint8             `json:"safi,omitempty"`
+	RD             string            `json:"rd,omitempty"`
+	Components     FSComponentList   `json:"components"`
+	DestPrefix     *netip.Prefix     `json:"dest_prefix,omitempty"`
+	FromEBGP       bool              `json:"from_ebgp"`
+	NeighborAS     uint32            `json:"neighbor_as"`
+	ASPath         []uint32          `json:"as_path"`
+	OriginatorID   string            `json:"originator_id,omitempty"`
+	PeerRouterID   string            `json:"peer_router_id,omitempty"`
+	ClusterList    []netip.Addr      `json:"cluster_list,omitempty"`
+	NextHop        netip.Addr        `json:"next_hop,omitzero"`
+	ExtCommunities []string          `json:"ext_communities,omitempty"`
+	Communities    []uint32          `json:"communities,omitempty"`
+	Priority       int               `json:"priority,omitempty"`
+	Metadata       map[string]string `json:"metadata,omitempty"`
+}
+
+// MarshalJSON renders r with prefixes and addresses as strings and the route
+// distinguisher and extended communities as hex.
+func (r FlowSpecRoute) MarshalJSON() ([]byte, error) {
+	j := routeJSON{
+		AFI:         r.AFI,
+		SAFI:        r.SAFI,
+		Components:  r.Components,
+		DestPrefix:  r.DestPrefix,
+		FromEBGP:    r.FromEBGP,
+		NeighborAS:  r.NeighborAS,
+		ASPath:      r.ASPath,
+		ClusterList: r.ClusterList,
+		NextHop:     r.NextHop,
+		Priority:    r.Priority,
+		Communities: r.Communities,
+		Metadata:    r.Metadata,
+	}
+	if j.ASPath == nil {
+		j.ASPath = []uint32{}
+	}
+	if r.RD != [8]byte{} {
+		j.RD = hex.EncodeToString(r.RD[:])
+	}
+	if r.OriginatorID.IsValid() {
+		j.OriginatorID = r.OriginatorID.String()
+	}
+	if r.PeerRouterID.IsValid() {
+		j.PeerRouterID = r.PeerRouterID.String()
+	}
+	for _, c := range r.ExtCommunities {
+		j.ExtCommunities = append(j.ExtCommunities, hex.EncodeToString(c[:]))
+	}
+	return json.Marshal(j)
+}
+
+// UnmarshalJSON decodes r. DestPrefix is taken from the destination prefix
+// component when "dest_prefix" is absent.
+func (r *FlowSpecRoute) UnmarshalJSON(b []byte) error {
+	var j routeJSON
+	if err := json.Unmarshal(b, &j); err != nil {
+		return err
+	}
+	*r = FlowSpecRoute{
+		AFI:         j.AFI,
+		SAFI:        j.SAFI,
+		Components:  j.Components,
+		DestPrefix:  j.DestPrefix,
+		FromEBGP:    j.FromEBGP,
+		NeighborAS:  j.NeighborAS,
+		ASPath:      j.ASPath,
+		ClusterList: j.ClusterList,
+		NextHop:     j.NextHop,
+		Priority:    j.Priority,
+		Communities: j.Communities,
+		Metadata:    j.Metadata,
+	}
+	if j.RD != "" {
+		rd, err := hex.DecodeString(j.RD)
+		if err != nil || len(rd) != len(r.RD) {
+			return fmt.Errorf("flowspec: invalid route distinguisher %q", j.RD)
+		}
+		r.RD = [8]byte(rd)
+	}
+	if j.OriginatorID != "" {
+		a, err := netip.ParseAddr(j.OriginatorID)
+		if err != nil {
+			return fmt.Errorf("flowspec: invalid originator id %q", j.OriginatorID)
+		}
+		r.OriginatorID = a.Unmap()
+	}
+	if j.PeerRouterID != "" {
+		a, err := netip.ParseAddr(j.PeerRouterID)
+		if err != nil {
+			return fmt.Errorf("flowspec: invalid peer router id %q", j.PeerRouterID)
+		}
+		r.PeerRouterID = a.Unmap()
+	}
+	for _, s := range j.ExtCommunities {
+		c, err := hex.DecodeString(s)
+		if err != nil || len(c) != 8 {
+			return fmt.Errorf("flowspec: invalid extended community %q", s)
+		}
+		r.ExtCommunities = append(r.ExtCommunities, [8]byte(c))
+	}
+	if r.DestPrefix == nil {
+		for _, c := range r.Components.Components {
+			if c.Type == ComponentTypeDestinationPrefix {
+				r.DestPrefix = c.Prefix
+			}
+		}
+	}
+	return nil
+}
+
+// ValidationResult is the outcome of ValidateFeasibility for one route.
+type ValidationResult struct {
+	Route *FlowSpecRoute
+	// Err is nil for feasible routes.
+	Err error
+}
+
+type resultJSON struct {
+	Route    *FlowSpecRoute `json:"route"`
+	Feasible bool           `json:"feasible"`
+	Reason   string         `json:"reason,omitempty"`
+	Stage    string         `json:"stage,omitempty"`
+	RFC      string         `json:"rfc,omitempty"`
+	Error    string         `json:"error,omitempty"`
+}
+
+// MarshalJSON renders v with a machine readable "reason" for the errors of
+// ValidateFeasibility, the "stage" and "rfc" of its Error and the error text
+// in "error".
+func (v ValidationResult) MarshalJSON() ([]byte, error) {
+	j := resultJSON{Route: v.Route, Feasible: v.Err == nil}
+	if v.Err != nil {
+		j.Reason, j.Stage, j.Error = Reason(v.Err), ErrorStage(v.Err).String(), v.Err.Error()
+		var e *Error
+		if errors.As(v.Err, &e) {
+			j.RFC = e.RFC
+		}
+	}
+	return json.Marshal(j)
+}
+
+// UnmarshalJSON restores the sentinel error for known reasons; "other" becomes
+// an error with the recorded text.
+func (v *ValidationResult) UnmarshalJSON(b []byte) error {
+	var j resultJSON
+	if err := json.Unmarshal(b, &j); err != nil {
+		return err
+	}
+	*v = ValidationResult{Route: j.Route}
+	if j.Feasible {
+		return nil
+	}
+	if e := LookupError(j.Reason); e != nil {
+		v.Err = e
+		return nil
+	}
+	if j.Reason != "other" {
+		return fmt.Errorf("%w: %q", ErrUnknownReason, j.Reason)
+	}
+	v.Err = errors.New(j.Error)
+	return nil
+}
@@ -0,0 +1,145 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package flowspecinternal
+
+import (
+	"encoding/json"
+	"errors"
+	"net/netip"
+	"reflect"
+	"testing"
+)
+
+func TestComponentListJSON(t *testing.T) {
+	dst := netip.MustParsePrefix("192.0.2.0/24")
+	l := FSComponentList{Components: []FSComponent{
+		{Type: ComponentTypeDestinationPrefix, Prefix: &dst},
+		{Type: ComponentTypeDestinationPort, Raw: []byte{0x03, 0x50, 0xc5, 0x5a}},
+		{Type: ComponentTypeTCPFlags, Raw: []byte{0x81, 0x02}},
+		{Type: ComponentTypePacketLength, Raw: []byte{0x03}},
+	}}
+	want := `[{"type":"dst","prefix":"192.0.2.0/24"},` +
+		`{"type":"dport","ops":[{"op":"ge","value":80},{"and":true,"op":"le","value":90}]},` +
+		`{"type":"tcp-flags","ops":[{"op":"all","value":2}]},` +
+		`{"type":"len","raw":"03"}]`
+
+	b, err := json.Marshal(l)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v, want <nil>", err)
+	}
+	if string(b) != want {
+		t.Errorf("Marshal() = %s, want %s", b, want)
+	}
+	var got FSComponentList
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("Unmarshal() error = %v, want <nil>", err)
+	}
+	if !reflect.DeepEqual(got, l) {
+		t.Errorf("Unmarshal(Marshal(l)) = %+v, want %+v", got, l)
+	}
+}
+
+func TestFlowSpecRouteJSON(t *testing.T) {
+	dst := netip.MustParsePrefix("2001:db8::/32")
+	r := &FlowSpecRoute{
+		DestPrefix:     &dst,
+		FromEBGP:       true,
+		NeighborAS:     64500,
+		ASPath:         []uint32{64500, 64496},
+		OriginatorID:   netip.MustParseAddr("192.0.2.1"),
+		PeerRouterID:   netip.MustParseAddr("198.51.100.1"),
+		ClusterList:    []netip.Addr{netip.MustParseAddr("192.0.2.2")},
+		NextHop:        netip.MustParseAddr("2001:db8::1"),
+		AFI:            AFIIPv6,
+		SAFI:           SAFIFlowSpecVPN,
+		RD:             [8]byte{0, 0, 0xfd, 0xe8, 0, 0, 0, 1},
+		Components:     FSComponentList{Components: []FSComponent{{Type: ComponentTypeDestinationPrefix, Prefix: &dst}}},
+		ExtCommunities: [][8]byte{{0x80, 0x06}},
+		Metadata:       map[string]string{"ticket": "NOC-1234", "customer": "acme"},
+	}
+	b, err := json.Marshal(r)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v, want <nil>", err)
+	}
+	var got FlowSpecRoute
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("Unmarshal(%s) error = %v, want <nil>", b, err)
+	}
+	if !reflect.DeepEqual(&got, r) {
+		t.Errorf("Unmarshal(%s) = %+v, want %+v", b, got, *r)
+	}
+}
+
+func TestValidationResultJSON(t *testing.T) {
+	dst := netip.MustParsePrefix("192.0.2.0/24")
+	route := &FlowSpecRoute{DestPrefix: &dst, ASPath: []uint32{}, Components: FSComponentList{Components: []FSComponent{}}}
+	tests := []struct {
+		name       string
+		res        ValidationResult
+		wantReason string
+		wantStage  string
+		wantRFC    string
+	}{
+		{name: "Feasible", res: ValidationResult{Route: route}},
+		{name: "NoBestUnicast", res: ValidationResult{Route: route, Err: ErrNoBestUnicast}, wantReason: "no-best-unicast", wantStage: "feasibility", wantRFC: "RFC8955 6 b)"},
+		{name: "Policy", res: ValidationResult{Route: route, Err: ErrUnknownPeer}, wantReason: "unknown-peer", wantStage: "policy"},
+		{name: "Other", res: ValidationResult{Route: route, Err: errors.New("boom")}, wantReason: "other", wantStage: "other"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := json.Marshal(tt.res)
+			if err != nil {
+				t.Fatalf("Marshal() error = %v, want <nil>", err)
+			}
+			var j struct{ Reason, Stage, RFC string }
+			json.Unmarshal(b, &j)
+			if j.Reason != tt.wantReason || j.Stage != tt.wantStage || j.RFC != tt.wantRFC {
+				t.Errorf("Marshal() reason, stage, rfc = %q, %q, %q, want %q, %q, %q", j.Reason, j.Stage, j.RFC, tt.wantReason, tt.wantStage, tt.wantRFC)
+			}
+			var got ValidationResult
+			if err := json.Unmarshal(b, &got); err != nil {
+				t.Fatalf("Unmarshal(%s) error = %v, want <nil>", b, err)
+			}
+			if (got.Err == nil) != (tt.res.Err == nil) || (got.Err != nil && got.Err.Error() != tt.res.Err.Error()) {
+				t.Errorf("Unmarshal(%s).Err = %v, want %v", b, got.Err, tt.res.Err)
+			}
+			if tt.res.Err == ErrNoBestUnicast && !errors.Is(got.Err, ErrNoBestUnicast) {
+				t.Errorf("Unmarshal(%s).Err = %v, want the sentinel", b, got.Err)
+			}
+		})
+	}
+}
+
+func TestConfigJSON(t *testing.T) {
+	b, err := json.Marshal(Config{AllowNoDestPrefix: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"allow_no_dest_prefix":true,"enable_empty_or_confed":false}`; string(b) != want {
+		t.Errorf("Marshal() = %s, want %s", b, want)
+	}
+}
+
+func TestComponentJSONErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		wantErr error
+	}{
+		{name: "UnknownType", in: `{"type":"mpls-label","ops":[{"op":"eq","value":1}]}`, wantErr: ErrUnknownComponentType},
+		{name: "UnknownOperator", in: `{"type":"port","ops":[{"op":"~","value":1}]}`, wantErr: ErrUnknownOperator},
+		{name: "PrefixOnPort", in: `{"type":"port","prefix":"192.0.2.0/24"}`, wantErr: ErrInvalidComponent},
+		{name: "OpsOnPrefix", in: `{"type":"dst","ops":[{"op":"eq","value":1}]}`, wantErr: ErrInvalidComponent},
+		{name: "Empty", in: `{"type":"port"}`, wantErr: ErrInvalidComponent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var c FSComponent
+			if err := json.Unmarshal([]byte(tt.in), &c); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Unmarshal(%s) error = %v, want %v", tt.in, err, tt.wantErr)
+			}
+		})
+	}
+}
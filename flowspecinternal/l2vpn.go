@@ -0,0 +1,73 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package flowspecinternal
+
+import (
+	"fmt"
+	"net"
+	"slices"
+)
+
+// Experimental L2VPN FlowSpec as per draft-ietf-idr-flowspec-l2vpn: NLRI of
+// AFI 25 carry Ethernet components next to the non-prefix components of
+// RFC8955. The draft's code points may still change, the bgp package only
+// decodes the family with Config.ExperimentalL2VPN.
+
+// AFIL2VPN is the L2VPN address family (RFC4761).
+const AFIL2VPN uint16 = 25
+
+var ErrInvalidMAC = NewError(StageDecode, "invalid-mac", "draft-ietf-idr-flowspec-l2vpn", "flowspec: MAC address component is not 6 octets (draft-ietf-idr-flowspec-l2vpn)")
+
+// macLen is the size of a MAC address component value after its length octet.
+const macLen = 6
+
+// IsEthernet reports whether t is one of the L2VPN Ethernet component types.
+func (t ComponentType) IsEthernet() bool {
+	switch t {
+	case ComponentTypeEthernetType, ComponentTypeSourceMAC, ComponentTypeDestinationMAC,
+		ComponentTypeVLANID, ComponentTypeInnerVLANID:
+		return true
+	}
+	return false
+}
+
+// IsMAC reports whether components of type t carry a MAC address, encoded as
+// a length octet followed by the address, rather than operators.
+func (t ComponentType) IsMAC() bool {
+	return t == ComponentTypeSourceMAC || t == ComponentTypeDestinationMAC
+}
+
+// validFor reports whether DecodeComponents accepts type t in NLRI of afi.
+func (t ComponentType) validFor(afi uint16) bool {
+	if afi == AFIL2VPN && t.IsEthernet() {
+		return true
+	}
+	return t >= ComponentTypeDestinationPrefix && t <= ComponentTypeFragment
+}
+
+// MACComponent returns a component of the MAC type t matching mac.
+func MACComponent(t ComponentType, mac net.HardwareAddr) (FSComponent, error) {
+	if !t.IsMAC() || len(mac) != macLen {
+		return FSComponent{}, fmt.Errorf("%w: %s %s", ErrInvalidMAC, t, mac)
+	}
+	return FSComponent{Type: t, Raw: append([]byte{macLen}, mac...)}, nil
+}
+
+// MAC returns the address of a MAC component, false for other components
+// and malformed values.
+func (c FSComponent) MAC() (net.HardwareAddr, bool) {
+	if !c.Type.IsMAC() || len(c.Raw) != 1+macLen || c.Raw[0] != macLen {
+		return nil, false
+	}
+	return net.HardwareAddr(slices.Clone(c.Raw[1:])), true
+}
+
+// scanMAC returns the size of the MAC component value at the start of b.
+func scanMAC(b []byte) (int, error) {
+	if len(b) < 1 || b[0] != macLen || len(b) < 1+macLen {
+		return 0, ErrInvalidMAC
+	}
+	return 1 + macLen, nil
+}
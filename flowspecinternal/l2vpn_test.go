@@ -0,0 +1,65 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package flowspecinternal
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestL2VPNComponents(t *testing.T) {
+	// ether-type =0x0800, dst-mac 00:00:5e:00:53:01, vlan =100
+	value := []byte{
+		0x0e, 0x91, 0x08, 0x00,
+		0x10, 0x06, 0x00, 0x00, 0x5e, 0x00, 0x53, 0x01,
+		0x15, 0x81, 0x64,
+	}
+	l, err := DecodeComponents(value, AFIL2VPN)
+	if err != nil {
+		t.Fatalf("DecodeComponents() error = %v", err)
+	}
+	if got, want := l.Canonical(nil), "ether-type=2048 dst-mac=00:00:5e:00:53:01 vlan=100"; got != want {
+		t.Errorf("Canonical() = %q, want %q", got, want)
+	}
+	if mac, ok := l.Components[1].MAC(); !ok || mac.String() != "00:00:5e:00:53:01" {
+		t.Errorf("MAC() = %v, %v", mac, ok)
+	}
+	b, err := EncodeComponents(l, AFIL2VPN)
+	if err != nil || !reflect.DeepEqual(b, value) {
+		t.Errorf("EncodeComponents() = %x, %v, want %x", b, err, value)
+	}
+	parsed, err := ParseComponents(l.Format(nil))
+	if err != nil {
+		t.Fatalf("ParseComponents(%q) error = %v", l.Format(nil), err)
+	}
+	if eq, err := Equivalent(parsed, l); !eq || err != nil {
+		t.Errorf("Equivalent(ParseComponents(Format())) = %v, %v", eq, err)
+	}
+
+	if _, err := DecodeComponents(value, AFIIPv4); !errors.Is(err, ErrMalformedNLRI) {
+		t.Errorf("DecodeComponents(AFIIPv4) error = %v, want %v", err, ErrMalformedNLRI)
+	}
+	if _, err := DecodeComponents([]byte{0x0f, 0x06, 0x00, 0x00, 0x5e}, AFIL2VPN); !errors.Is(err, ErrMalformedNLRI) {
+		t.Errorf("DecodeComponents(short MAC) error = %v, want %v", err, ErrMalformedNLRI)
+	}
+	if _, err := DecodeComponents([]byte{0x01, 0x18, 0xc0, 0x00, 0x02}, AFIL2VPN); !errors.Is(err, ErrFamilyMismatch) {
+		t.Errorf("DecodeComponents(prefix) error = %v, want %v", err, ErrFamilyMismatch)
+	}
+
+	src, _ := MACComponent(ComponentTypeSourceMAC, net.HardwareAddr{0, 0, 0x5e, 0, 0x53, 1})
+	other, _ := MACComponent(ComponentTypeSourceMAC, net.HardwareAddr{0, 0, 0x5e, 0, 0x53, 2})
+	a := FSComponentList{Components: []FSComponent{src}}
+	if got := CompareFlowSpecKey(a, FSComponentList{Components: []FSComponent{other}}); got != AHasPrecedence {
+		t.Errorf("CompareFlowSpecKey() = %d, want the lower MAC first", got)
+	}
+	if _, err := MACComponent(ComponentTypeVLANID, src.Raw[1:]); !errors.Is(err, ErrInvalidMAC) {
+		t.Errorf("MACComponent(vlan) error = %v, want %v", err, ErrInvalidMAC)
+	}
+	if errs := CheckComponents(FSComponentList{Components: []FSComponent{{Type: ComponentTypeVLANID, Raw: []byte{0x91, 0x10, 0x00}}}}, AFIL2VPN); len(errs) != 1 || !errors.Is(errs[0], ErrInvalidComponentValue) {
+		t.Errorf("CheckComponents(vlan 4096) = %v, want %v", errs, ErrInvalidComponentValue)
+	}
+}
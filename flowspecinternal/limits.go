@@ -0,0 +1,192 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package flowspecinternal
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+var (
+	ErrNLRILengthLimit = NewError(StagePolicy, "nlri-length-limit", "", "flowspec: rule exceeds the configured NLRI length limit")
+	ErrComponentLimit  = NewError(StagePolicy, "component-limit", "", "flowspec: rule exceeds the configured component count limit")
+	ErrOperatorLimit   = NewError(StagePolicy, "operator-limit", "", "flowspec: component exceeds the configured operator count limit")
+	ErrRuleLimit       = NewError(StagePolicy, "rule-limit", "", "flowspec: session exceeds the configured rule count limit")
+	ErrRuleEvicted     = NewError(StagePolicy, "rule-evicted", "", "flowspec: rule evicted for a higher priority rule under the rule count limit")
+	ErrRuleLimitCease  = NewError(StagePolicy, "rule-limit-cease", "RFC4486 4", "flowspec: rule count limit exceeded, session torn down")
+	ErrUnknownOverflow = errors.New("flowspec: unknown overflow policy")
+)
+
+// OverflowPolicy selects what a receiver does with a rule beyond
+// Limits.MaxRules. RFC8955 12 leaves the choice to the implementation.
+type OverflowPolicy uint8
+
+const (
+	// OverflowReject rejects the new rule and keeps the held ones.
+	OverflowReject OverflowPolicy = iota
+	// OverflowEvict withdraws the held rule of lowest priority to make room,
+	// see RuleLimiter.Add. A new rule ranking lowest is rejected.
+	OverflowEvict
+	// OverflowTeardown rejects the new rule and closes the session, e.g. a
+	// BGP session sends a Cease NOTIFICATION (RFC4486 4).
+	OverflowTeardown
+)
+
+var overflowNames = [...]string{
+	OverflowReject:   "reject",
+	OverflowEvict:    "evict",
+	OverflowTeardown: "teardown",
+}
+
+func (p OverflowPolicy) String() string {
+	if int(p) < len(overflowNames) {
+		return overflowNames[p]
+	}
+	return fmt.Sprintf("overflow-%d", uint8(p))
+}
+
+func (p OverflowPolicy) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+func (p *OverflowPolicy) UnmarshalText(b []byte) error {
+	i := slices.Index(overflowNames[:], string(b))
+	if i < 0 {
+		return fmt.Errorf("%w: %q", ErrUnknownOverflow, b)
+	}
+	*p = OverflowPolicy(i)
+	return nil
+}
+
+// Limits bounds the rules a receiver accepts so a peer cannot exhaust its
+// memory or its dataplane. A zero field imposes no limit beyond RFC8955.
+type Limits struct {
+	// MaxNLRILength bounds the encoded NLRI value, without length field.
+	// RFC8955 4.1 allows up to 4095 bytes.
+	MaxNLRILength int `json:"max_nlri_length,omitempty"`
+	// MaxComponents bounds the number of components of a rule.
+	MaxComponents int `json:"max_components,omitempty"`
+	// MaxOperators bounds the {operator, value} pairs of a single component.
+	MaxOperators int `json:"max_operators,omitempty"`
+	// MaxRules bounds the rules held for one session or peer. It is enforced
+	// by the receiver, Check does not look at it.
+	MaxRules int `json:"max_rules,omitempty"`
+	// Overflow selects what happens to the rules beyond MaxRules, see
+	// RuleLimiter.
+	Overflow OverflowPolicy `json:"overflow,omitempty"`
+}
+
+// Check reports the first limit l exceeds: ErrComponentLimit,
+// ErrOperatorLimit or ErrNLRILengthLimit. A nil lim accepts every rule.
+func (lim *Limits) Check(l FSComponentList, afi uint16) error {
+	if lim == nil {
+		return nil
+	}
+	if lim.MaxComponents > 0 && len(l.Components) > lim.MaxComponents {
+		return fmt.Errorf("%w: %d components, limit %d", ErrComponentLimit, len(l.Components), lim.MaxComponents)
+	}
+	if lim.MaxOperators > 0 {
+		for _, c := range l.Components {
+			if c.Type == ComponentTypeDestinationPrefix || c.Type == ComponentTypeSourcePrefix {
+				continue
+			}
+			ops := 0
+			if _, err := scanOps(c.Raw, func(byte, uint64) { ops++ }); err != nil {
+				return err
+			}
+			if ops > lim.MaxOperators {
+				return fmt.Errorf("%w: %s has %d operators, limit %d", ErrOperatorLimit, c.Type, ops, lim.MaxOperators)
+			}
+		}
+	}
+	if lim.MaxNLRILength > 0 {
+		b, err := EncodeComponents(l, afi)
+		if err != nil {
+			return err
+		}
+		if len(b) > lim.MaxNLRILength {
+			return fmt.Errorf("%w: %d bytes, limit %d", ErrNLRILengthLimit, len(b), lim.MaxNLRILength)
+		}
+	}
+	return nil
+}
+
+// RuleLimiter holds the rules of one session or peer and enforces
+// Limits.MaxRules with Limits.Overflow. It is not safe for concurrent use.
+type RuleLimiter struct {
+	lim   Limits
+	rules map[string]*FlowSpecRoute
+}
+
+// NewRuleLimiter returns a limiter for lim; a nil lim or a zero MaxRules
+// holds any number of rules.
+func NewRuleLimiter(lim *Limits) *RuleLimiter {
+	l := &RuleLimiter{rules: make(map[string]*FlowSpecRoute)}
+	if lim != nil {
+		l.lim = *lim
+	}
+	return l
+}
+
+// Add holds r, replacing the rule with the same AFI, SAFI, route
+// distinguisher and components. A new rule beyond MaxRules is rejected with
+// ErrRuleLimit under OverflowReject and ErrRuleLimitCease under
+// OverflowTeardown. Under OverflowEvict the held rule with the lowest
+// Priority, and among those the one with the lowest RFC8955 5.1 precedence,
+// is removed and returned; if r ranks lower than every held rule it is
+// rejected with ErrRuleLimit instead.
+func (l *RuleLimiter) Add(r *FlowSpecRoute) (evicted *FlowSpecRoute, err error) {
+	k := ruleKey(r)
+	if _, ok := l.rules[k]; ok || l.lim.MaxRules <= 0 || len(l.rules) < l.lim.MaxRules {
+		l.rules[k] = r
+		return nil, nil
+	}
+	switch l.lim.Overflow {
+	case OverflowEvict:
+		var vk string
+		for hk, h := range l.rules {
+			if evicted == nil || outranks(evicted, h) || (!outranks(h, evicted) && hk < vk) {
+				evicted, vk = h, hk
+			}
+		}
+		if !outranks(r, evicted) {
+			return nil, fmt.Errorf("%w: %d rules, none of lower priority", ErrRuleLimit, l.lim.MaxRules)
+		}
+		delete(l.rules, vk)
+		l.rules[k] = r
+		return evicted, nil
+	case OverflowTeardown:
+		return nil, fmt.Errorf("%w: %d rules", ErrRuleLimitCease, l.lim.MaxRules)
+	default:
+		return nil, fmt.Errorf("%w: %d rules", ErrRuleLimit, l.lim.MaxRules)
+	}
+}
+
+// Remove drops the rule with the same key as r and reports whether it was
+// held.
+func (l *RuleLimiter) Remove(r *FlowSpecRoute) bool {
+	k := ruleKey(r)
+	_, ok := l.rules[k]
+	delete(l.rules, k)
+	return ok
+}
+
+// Len returns the number of rules held.
+func (l *RuleLimiter) Len() int {
+	return len(l.rules)
+}
+
+// outranks reports whether a is kept over b under OverflowEvict.
+func outranks(a, b *FlowSpecRoute) bool {
+	if a.Priority != b.Priority {
+		return a.Priority > b.Priority
+	}
+	return CompareFlowSpecKey(a.Components, b.Components) == AHasPrecedence
+}
+
+func ruleKey(r *FlowSpecRoute) string {
+	return fmt.Sprintf("%d/%d/%x/%s", r.AFI, r.SAFI, r.RD, r.Components.Canonical(nil))
+}
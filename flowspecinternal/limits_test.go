@@ -0,0 +1,107 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package flowspecinternal
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLimitsCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    string
+		limits  *Limits
+		wantErr error
+	}{
+		{name: "NoLimits", rule: "dst 192.0.2.0/24 dport 1,2,3,4,5", limits: nil},
+		{name: "WithinLimits", rule: "dst 192.0.2.0/24 dport 1,2", limits: &Limits{MaxNLRILength: 16, MaxComponents: 2, MaxOperators: 2}},
+		{name: "Components", rule: "dst 192.0.2.0/24 proto udp dport 53", limits: &Limits{MaxComponents: 2}, wantErr: ErrComponentLimit},
+		{name: "Operators", rule: "dport 1,2,3", limits: &Limits{MaxOperators: 2}, wantErr: ErrOperatorLimit},
+		{name: "NLRILength", rule: "dst 192.0.2.0/24 dport 1,2", limits: &Limits{MaxNLRILength: 9}, wantErr: ErrNLRILengthLimit},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := ParseComponents(tt.rule)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.limits.Check(l, AFIIPv4); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Check(%q) error = %v, want %v", tt.rule, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRuleLimiter(t *testing.T) {
+	route := func(rule string, priority int) *FlowSpecRoute {
+		l, err := ParseComponents(rule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &FlowSpecRoute{AFI: AFIIPv4, SAFI: SAFIFlowSpec, Components: l, Priority: priority}
+	}
+	a := route("dst 192.0.2.0/24", 0)
+	b := route("dst 198.51.100.0/24", 5)
+	more := route("dst 192.0.2.0/25", 0)
+	high := route("dst 203.0.113.0/24", 10)
+
+	tests := []struct {
+		name        string
+		overflow    OverflowPolicy
+		add         *FlowSpecRoute
+		wantEvicted *FlowSpecRoute
+		wantErr     error
+	}{
+		{name: "Reject", overflow: OverflowReject, add: high, wantErr: ErrRuleLimit},
+		{name: "Teardown", overflow: OverflowTeardown, add: high, wantErr: ErrRuleLimitCease},
+		{name: "EvictLowestPriority", overflow: OverflowEvict, add: high, wantEvicted: a},
+		{name: "EvictLowerPrecedence", overflow: OverflowEvict, add: more, wantEvicted: a},
+		{name: "EvictNewRanksLowest", overflow: OverflowEvict, add: route("dst 203.0.113.0/24", 0), wantErr: ErrRuleLimit},
+		{name: "Replace", overflow: OverflowReject, add: route("dst 192.0.2.0/24", 7)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewRuleLimiter(&Limits{MaxRules: 2, Overflow: tt.overflow})
+			for _, r := range []*FlowSpecRoute{a, b} {
+				if _, err := l.Add(r); err != nil {
+					t.Fatal(err)
+				}
+			}
+			evicted, err := l.Add(tt.add)
+			if !errors.Is(err, tt.wantErr) || evicted != tt.wantEvicted {
+				t.Errorf("Add(%v) = %v, %v, want %v, %v", tt.add.Components, evicted, err, tt.wantEvicted, tt.wantErr)
+			}
+			if l.Len() != 2 {
+				t.Errorf("Len() = %d, want 2", l.Len())
+			}
+		})
+	}
+
+	l := NewRuleLimiter(&Limits{MaxRules: 1})
+	if _, err := l.Add(a); err != nil {
+		t.Fatal(err)
+	}
+	if !l.Remove(a) || l.Remove(a) {
+		t.Error("Remove(a) twice did not report true, false")
+	}
+	if _, err := l.Add(b); err != nil {
+		t.Errorf("Add after Remove error = %v", err)
+	}
+}
+
+func TestOverflowPolicyText(t *testing.T) {
+	for _, p := range []OverflowPolicy{OverflowReject, OverflowEvict, OverflowTeardown} {
+		b, _ := p.MarshalText()
+		var got OverflowPolicy
+		if err := got.UnmarshalText(b); err != nil || got != p {
+			t.Errorf("UnmarshalText(%q) = %v, %v, want %v", b, got, err, p)
+		}
+	}
+	var p OverflowPolicy
+	if err := p.UnmarshalText([]byte("drop")); !errors.Is(err, ErrUnknownOverflow) {
+		t.Errorf("UnmarshalText(drop) error = %v, want %v", err, ErrUnknownOverflow)
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package flowspecinternal
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Attribute keys used in the log records of all subsystems.
+const (
+	LogKeySubsystem = "subsystem"
+	LogKeyPeer      = "peer"     // neighbor AS
+	LogKeyPrefix    = "prefix"   // destination prefix
+	LogKeyRule      = "rule"     // canonical component list, see Canonical
+	LogKeyRFCRule   = "rfc_rule" // feasibility rule: a, b, c or rfc9117
+)
+
+// Subsystems that log, the values of LogKeySubsystem.
+const (
+	SubsystemValidation  = "validation"
+	SubsystemDecode      = "decode"
+	SubsystemSession     = "session"
+	SubsystemRIB         = "rib"
+	SubsystemStore       = "store"
+	SubsystemAPI         = "api"
+	SubsystemRTR         = "rtr"
+	SubsystemRouteServer = "routeserver"
+	SubsystemRemoteRIB   = "remoterib"
+	SubsystemFlows       = "flows"
+	SubsystemMitigation  = "mitigation"
+	SubsystemDataplane   = "dataplane"
+	SubsystemWebhook     = "webhook"
+	SubsystemAudit       = "audit"
+	SubsystemConfig      = "config"
+	SubsystemCoord       = "coord"
+)
+
+// SubsystemLogger returns l with the subsystem attribute set, or a logger
+// discarding everything when l is nil.
+func SubsystemLogger(l *slog.Logger, subsystem string) *slog.Logger {
+	if l == nil {
+		return slog.New(slog.DiscardHandler)
+	}
+	return l.With(LogKeySubsystem, subsystem)
+}
+
+// LevelHandler sets the minimum level per subsystem. Records of loggers
+// without a configured subsystem use the default level; the wrapped handler
+// still applies its own level.
+//
+//	h := NewLevelHandler(slog.NewTextHandler(os.Stderr, nil), slog.LevelInfo,
+//		map[string]slog.Leveler{SubsystemDecode: slog.LevelDebug})
+//	cfg.Logger = slog.New(h)
+type LevelHandler struct {
+	next   slog.Handler
+	levels map[string]slog.Leveler
+	level  slog.Leveler
+}
+
+// NewLevelHandler wraps next with the default level def and the levels of
+// subsystems.
+func NewLevelHandler(next slog.Handler, def slog.Leveler, levels map[string]slog.Leveler) *LevelHandler {
+	return &LevelHandler{next: next, levels: levels, level: def}
+}
+
+func (h *LevelHandler) Enabled(ctx context.Context, l slog.Level) bool {
+	return l >= h.level.Level() && h.next.Enabled(ctx, l)
+}
+
+func (h *LevelHandler) Handle(ctx context.Context, r slog.Record) error {
+	return h.next.Handle(ctx, r)
+}
+
+func (h *LevelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	c := *h
+	c.next = h.next.WithAttrs(attrs)
+	for _, a := range attrs {
+		if a.Key != LogKeySubsystem {
+			continue
+		}
+		if l, ok := h.levels[a.Value.String()]; ok {
+			c.level = l
+		}
+	}
+	return &c
+}
+
+func (h *LevelHandler) WithGroup(name string) slog.Handler {
+	c := *h
+	c.next = h.next.WithGroup(name)
+	return &c
+}
@@ -0,0 +1,56 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package flowspecinternal
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestLevelHandler(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewLevelHandler(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}), slog.LevelWarn,
+		map[string]slog.Leveler{SubsystemDecode: slog.LevelDebug})
+	l := slog.New(h)
+
+	SubsystemLogger(l, SubsystemDecode).Debug("decode debug")
+	SubsystemLogger(l, SubsystemRIB).Info("rib info")
+	SubsystemLogger(l, SubsystemRIB).Warn("rib warn")
+	l.Info("default info")
+	SubsystemLogger(nil, SubsystemRIB).Error("discarded")
+
+	got := buf.String()
+	for _, want := range []string{"decode debug", "rib warn"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("log lacks %q:\n%s", want, got)
+		}
+	}
+	for _, unwanted := range []string{"rib info", "default info", "discarded"} {
+		if strings.Contains(got, unwanted) {
+			t.Errorf("log contains %q:\n%s", unwanted, got)
+		}
+	}
+}
+
+func TestValidateFeasibilityLog(t *testing.T) {
+	var buf bytes.Buffer
+	cfg := &Config{Logger: slog.New(slog.NewTextHandler(&buf, nil))}
+	dst := mustPrefix("192.0.2.0/24")
+	l, err := ParseComponents("dst 192.0.2.0/24")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &FlowSpecRoute{DestPrefix: &dst, NeighborAS: 64500, Components: l}
+	if err := ValidateFeasibility(r, &mockRIB{}, cfg); err != ErrNoBestUnicast {
+		t.Fatalf("ValidateFeasibility() error = %v, want %v", err, ErrNoBestUnicast)
+	}
+	for _, want := range []string{"subsystem=validation", "peer=64500", "prefix=192.0.2.0/24", "rule=", "rfc_rule=b", "level=INFO"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("log lacks %q: %s", want, buf.String())
+		}
+	}
+}
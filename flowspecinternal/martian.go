@@ -0,0 +1,96 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package flowspecinternal
+
+import (
+	"fmt"
+	"net/netip"
+	"slices"
+)
+
+// Suggested values of Config.MinPrefixLenIPv4 and Config.MinPrefixLenIPv6:
+// no IPv4 allocation is shorter than a /8, no IPv6 one than a /16.
+const (
+	DefaultMinPrefixLenIPv4 = 8
+	DefaultMinPrefixLenIPv6 = 16
+)
+
+// DefaultMartians are the destinations Config.ScreenMartians rejects unless
+// Config.Martians is set: the special-purpose ranges of RFC6890 not
+// globally reachable, multicast and, for IPv6, deprecated site-local.
+// Extend a copy to add local bogons.
+var DefaultMartians = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),       // this network
+	netip.MustParsePrefix("10.0.0.0/8"),      // private use
+	netip.MustParsePrefix("100.64.0.0/10"),   // shared address space
+	netip.MustParsePrefix("127.0.0.0/8"),     // loopback
+	netip.MustParsePrefix("169.254.0.0/16"),  // link local
+	netip.MustParsePrefix("172.16.0.0/12"),   // private use
+	netip.MustParsePrefix("192.0.0.0/24"),    // IETF protocol assignments
+	netip.MustParsePrefix("192.0.2.0/24"),    // TEST-NET-1
+	netip.MustParsePrefix("192.168.0.0/16"),  // private use
+	netip.MustParsePrefix("198.18.0.0/15"),   // benchmarking
+	netip.MustParsePrefix("198.51.100.0/24"), // TEST-NET-2
+	netip.MustParsePrefix("203.0.113.0/24"),  // TEST-NET-3
+	netip.MustParsePrefix("224.0.0.0/4"),     // multicast
+	netip.MustParsePrefix("240.0.0.0/4"),     // reserved, limited broadcast
+	netip.MustParsePrefix("::/128"),          // unspecified
+	netip.MustParsePrefix("::1/128"),         // loopback
+	netip.MustParsePrefix("::ffff:0:0/96"),   // IPv4-mapped
+	netip.MustParsePrefix("100::/64"),        // discard-only
+	netip.MustParsePrefix("2001:2::/48"),     // benchmarking
+	netip.MustParsePrefix("2001:10::/28"),    // ORCHID
+	netip.MustParsePrefix("2001:db8::/32"),   // documentation
+	netip.MustParsePrefix("fc00::/7"),        // unique local
+	netip.MustParsePrefix("fe80::/10"),       // link local
+	netip.MustParsePrefix("fec0::/10"),       // site local
+	netip.MustParsePrefix("ff00::/8"),        // multicast
+}
+
+// martianNextHops are the ranges no next hop may be in: this host, loopback,
+// link local, multicast and reserved (RFC6890).
+var martianNextHops = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("127.0.0.0/8"),
+	netip.MustParsePrefix("169.254.0.0/16"),
+	netip.MustParsePrefix("224.0.0.0/4"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("::/128"),
+	netip.MustParsePrefix("::1/128"),
+	netip.MustParsePrefix("fe80::/10"),
+	netip.MustParsePrefix("ff00::/8"),
+}
+
+// screenBroad returns ErrDestinationTooBroad if dst is shorter than the
+// minimum length of its family and not in c.BroadPrefixesAllowed.
+func (c *Config) screenBroad(dst netip.Prefix) error {
+	minLen := c.MinPrefixLenIPv4
+	if dst.Addr().Is6() {
+		minLen = c.MinPrefixLenIPv6
+	}
+	allowed := func(p netip.Prefix) bool { return p.Masked() == dst }
+	if dst.Bits() >= minLen || slices.ContainsFunc(c.BroadPrefixesAllowed, allowed) {
+		return nil
+	}
+	return fmt.Errorf("%w: %v, minimum /%d", ErrDestinationTooBroad, dst, minLen)
+}
+
+// screenMartian returns ErrMartianDestination if dst is a default route or
+// lies within one of the martians of c.
+func (c *Config) screenMartian(dst netip.Prefix) error {
+	if dst.Bits() == 0 {
+		return fmt.Errorf("%w: %v is a default route", ErrMartianDestination, dst)
+	}
+	martians := c.Martians
+	if martians == nil {
+		martians = DefaultMartians
+	}
+	for _, m := range martians {
+		if m.Bits() <= dst.Bits() && m.Contains(dst.Addr()) {
+			return fmt.Errorf("%w: %v within %v", ErrMartianDestination, dst, m)
+		}
+	}
+	return nil
+}
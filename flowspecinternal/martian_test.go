@@ -0,0 +1,86 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package flowspecinternal
+
+import (
+	"errors"
+	"net/netip"
+	"testing"
+)
+
+func TestScreenMartians(t *testing.T) {
+	rib := tableRIB{
+		{Prefix: mustPrefix("0.0.0.0/0"), NeighborAS: 65001, ASPath: []uint32{65001}},
+		{Prefix: mustPrefix("::/0"), NeighborAS: 65001, ASPath: []uint32{65001}},
+	}
+	tests := []struct {
+		name     string
+		dst      string
+		martians []netip.Prefix
+		off      bool
+		want     error
+	}{
+		{name: "global", dst: "8.8.8.0/24"},
+		{name: "global IPv6", dst: "2a00:1450::/32"},
+		{name: "default route", dst: "0.0.0.0/0", want: ErrMartianDestination},
+		{name: "IPv6 default route", dst: "::/0", want: ErrMartianDestination},
+		{name: "private", dst: "10.1.0.0/16", want: ErrMartianDestination},
+		{name: "link local", dst: "169.254.1.1/32", want: ErrMartianDestination},
+		{name: "IPv6 link local", dst: "fe80::/64", want: ErrMartianDestination},
+		{name: "covering a martian", dst: "8.0.0.0/6"},
+		{name: "mapped", dst: "::ffff:10.0.0.0/104", want: ErrMartianDestination},
+		{name: "custom", dst: "10.1.0.0/16", martians: []netip.Prefix{mustPrefix("8.8.8.0/24")}},
+		{name: "custom martian", dst: "8.8.8.8/32", martians: []netip.Prefix{mustPrefix("8.8.8.0/24")}, want: ErrMartianDestination},
+		{name: "custom, default route", dst: "0.0.0.0/0", martians: []netip.Prefix{}, want: ErrMartianDestination},
+		{name: "screen off", dst: "10.1.0.0/16", off: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dst := mustPrefix(tt.dst)
+			route := &FlowSpecRoute{DestPrefix: &dst, NeighborAS: 65001, ASPath: []uint32{65001}}
+			cfg := &Config{ScreenMartians: !tt.off, Martians: tt.martians}
+			if err := ValidateFeasibility(route, rib, cfg); !errors.Is(err, tt.want) || (tt.want == nil) != (err == nil) {
+				t.Errorf("ValidateFeasibility() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestMinPrefixLen(t *testing.T) {
+	rib := tableRIB{
+		{Prefix: mustPrefix("0.0.0.0/0"), NeighborAS: 65001, ASPath: []uint32{65001}},
+		{Prefix: mustPrefix("::/0"), NeighborAS: 65001, ASPath: []uint32{65001}},
+	}
+	guard := Config{MinPrefixLenIPv4: DefaultMinPrefixLenIPv4, MinPrefixLenIPv6: DefaultMinPrefixLenIPv6}
+	allowed := guard
+	allowed.BroadPrefixesAllowed = []netip.Prefix{mustPrefix("4.0.0.1/6"), mustPrefix("2000::/3")}
+	tests := []struct {
+		name string
+		dst  string
+		cfg  Config
+		want error
+	}{
+		{name: "default route", dst: "0.0.0.0/0", cfg: guard, want: ErrDestinationTooBroad},
+		{name: "/7", dst: "8.0.0.0/7", cfg: guard, want: ErrDestinationTooBroad},
+		{name: "/8", dst: "8.0.0.0/8", cfg: guard},
+		{name: "IPv6 default route", dst: "::/0", cfg: guard, want: ErrDestinationTooBroad},
+		{name: "IPv6 /15", dst: "2a00::/15", cfg: guard, want: ErrDestinationTooBroad},
+		{name: "IPv6 /16", dst: "2a00::/16", cfg: guard},
+		{name: "allowed", dst: "4.0.0.0/6", cfg: allowed},
+		{name: "allowed IPv6", dst: "2000::/3", cfg: allowed},
+		{name: "only the allowed prefix", dst: "0.0.0.0/0", cfg: allowed, want: ErrDestinationTooBroad},
+		{name: "IPv4 only", dst: "::/0", cfg: Config{MinPrefixLenIPv4: 8}},
+		{name: "guard off", dst: "0.0.0.0/0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dst := mustPrefix(tt.dst)
+			route := &FlowSpecRoute{DestPrefix: &dst, NeighborAS: 65001, ASPath: []uint32{65001}}
+			if err := ValidateFeasibility(route, rib, &tt.cfg); !errors.Is(err, tt.want) || (tt.want == nil) != (err == nil) {
+				t.Errorf("ValidateFeasibility() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,205 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+// Package matcher classifies packet headers against FlowSpec rules in software.
+//
+// It is meant for testing rules and for enforcement where no kernel dataplane
+// is available; it favours exactness over speed.
+package matcher
+
+import (
+	"errors"
+	"net/netip"
+	"slices"
+	"sort"
+
+	fs "floofspectools/flowspecinternal"
+)
+
+var (
+	ErrUnknownComponent = errors.New("matcher: unknown component type")
+	ErrMissingPrefix    = errors.New("matcher: prefix component without prefix")
+)
+
+// IP protocol numbers with transport fields the components refer to.
+const (
+	protoICMP   = 1
+	protoTCP    = 6
+	protoUDP    = 17
+	protoICMPv6 = 58
+)
+
+// Packet is the parsed header of one packet.
+type Packet struct {
+	Src, Dst netip.Addr
+	Protocol uint8 // IPv4 protocol or IPv6 upper-layer next header
+	SrcPort  uint16
+	DstPort  uint16
+	ICMPType uint8
+	ICMPCode uint8
+	TCPFlags fs.TCPFlags
+	Length   uint16 // total IP packet length
+	DSCP     uint8
+	// Fragment holds the RFC8955 4.2.2.12 bits, see fs.PacketFragmentBits.
+	// DF is ignored for IPv6 packets, which have no such flag.
+	Fragment fs.FragmentBits
+}
+
+// Matcher evaluates packets against a rule set in RFC8955 5.1 order.
+type Matcher struct {
+	rules []rule
+}
+
+type rule struct {
+	index int
+	terms []term
+}
+
+// term is a prepared component: a prefix, value ranges or bitmask operators.
+type term struct {
+	typ    fs.ComponentType
+	prefix netip.Prefix
+	ranges []fs.ValueRange
+	ops    []fs.BitmaskOp
+}
+
+// anyValue bounds numeric ranges; every header field fits.
+const anyValue = 1<<32 - 1
+
+// New prepares rules for matching. Rules are evaluated in RFC8955 5.1 order
+// regardless of their order in the slice.
+func New(rules []fs.FSComponentList) (*Matcher, error) {
+	m := &Matcher{rules: make([]rule, 0, len(rules))}
+	for i, l := range rules {
+		terms, err := prepare(l)
+		if err != nil {
+			return nil, err
+		}
+		m.rules = append(m.rules, rule{index: i, terms: terms})
+	}
+	slices.SortStableFunc(m.rules, func(a, b rule) int {
+		return fs.CompareFlowSpecKey(rules[a.index], rules[b.index])
+	})
+	return m, nil
+}
+
+// Len returns the number of rules.
+func (m *Matcher) Len() int {
+	return len(m.rules)
+}
+
+// Match returns the index, in the slice passed to New, of the first rule p
+// matches. ok is false when no rule matches.
+func (m *Matcher) Match(p *Packet) (index int, ok bool) {
+	for _, r := range m.rules {
+		if matchTerms(r.terms, p) {
+			return r.index, true
+		}
+	}
+	return -1, false
+}
+
+// MatchAll returns the indexes of all rules p matches, in evaluation order.
+// It supports rules whose traffic-action T bit lets evaluation continue.
+func (m *Matcher) MatchAll(p *Packet) []int {
+	var out []int
+	for _, r := range m.rules {
+		if matchTerms(r.terms, p) {
+			out = append(out, r.index)
+		}
+	}
+	return out
+}
+
+// Matches reports whether p matches the single component list l.
+func Matches(l fs.FSComponentList, p *Packet) (bool, error) {
+	terms, err := prepare(l)
+	if err != nil {
+		return false, err
+	}
+	return matchTerms(terms, p), nil
+}
+
+func prepare(l fs.FSComponentList) ([]term, error) {
+	terms := make([]term, 0, len(l.Components))
+	for _, c := range l.Components {
+		t := term{typ: c.Type}
+		switch {
+		case c.Type == fs.ComponentTypeDestinationPrefix || c.Type == fs.ComponentTypeSourcePrefix:
+			if c.Prefix == nil {
+				return nil, ErrMissingPrefix
+			}
+			t.prefix = c.Prefix.Masked()
+		case c.Type.IsBitmask():
+			ops, err := fs.ParseBitmaskOps(c.Raw)
+			if err != nil {
+				return nil, err
+			}
+			t.ops = ops
+		case c.Type >= fs.ComponentTypeIpProtocol && c.Type <= fs.ComponentTypeFragment:
+			ops, err := fs.ParseNumericOps(c.Raw)
+			if err != nil {
+				return nil, err
+			}
+			t.ranges = fs.NumericRanges(ops, anyValue)
+		default:
+			return nil, ErrUnknownComponent
+		}
+		terms = append(terms, t)
+	}
+	return terms, nil
+}
+
+func matchTerms(terms []term, p *Packet) bool {
+	for _, t := range terms {
+		if !t.match(p) {
+			return false
+		}
+	}
+	return true
+}
+
+// match tests t against p. Fragments other than the first carry no transport
+// header, so port, ICMP and TCP flag components never match them.
+func (t term) match(p *Packet) bool {
+	first := !p.Fragment.NonFirst()
+	transport := (p.Protocol == protoTCP || p.Protocol == protoUDP) && first
+	icmp := ((p.Protocol == protoICMP && p.Dst.Is4()) || (p.Protocol == protoICMPv6 && p.Dst.Is6())) && first
+	switch t.typ {
+	case fs.ComponentTypeDestinationPrefix:
+		return t.prefix.Contains(p.Dst)
+	case fs.ComponentTypeSourcePrefix:
+		return t.prefix.Contains(p.Src)
+	case fs.ComponentTypeIpProtocol:
+		return inRanges(t.ranges, uint64(p.Protocol))
+	case fs.ComponentTypePort:
+		return transport && (inRanges(t.ranges, uint64(p.SrcPort)) || inRanges(t.ranges, uint64(p.DstPort)))
+	case fs.ComponentTypeDestinationPort:
+		return transport && inRanges(t.ranges, uint64(p.DstPort))
+	case fs.ComponentTypeSourcePort:
+		return transport && inRanges(t.ranges, uint64(p.SrcPort))
+	case fs.ComponentTypeICMPType:
+		return icmp && inRanges(t.ranges, uint64(p.ICMPType))
+	case fs.ComponentTypeICMPCode:
+		return icmp && inRanges(t.ranges, uint64(p.ICMPCode))
+	case fs.ComponentTypeTCPFlags:
+		return p.Protocol == protoTCP && first && p.TCPFlags.Matches(t.ops)
+	case fs.ComponentTypePacketLength:
+		return inRanges(t.ranges, uint64(p.Length))
+	case fs.ComponentTypeDSCP:
+		return inRanges(t.ranges, uint64(p.DSCP))
+	case fs.ComponentTypeFragment:
+		frag := p.Fragment
+		if p.Dst.Is6() {
+			frag &^= fs.FragmentDF // RFC8956 3.7
+		}
+		return fs.MatchBitmaskOps(t.ops, uint64(frag))
+	}
+	return false
+}
+
+func inRanges(ranges []fs.ValueRange, v uint64) bool {
+	i := sort.Search(len(ranges), func(i int) bool { return ranges[i].To >= v })
+	return i < len(ranges) && ranges[i].From <= v
+}
@@ -0,0 +1,224 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package matcher
+
+import (
+	"errors"
+	"net/netip"
+	"slices"
+	"testing"
+
+	fs "floofspectools/flowspecinternal"
+)
+
+func prefix(s string) *netip.Prefix {
+	p := netip.MustParsePrefix(s)
+	return &p
+}
+
+func udp(dst string, dport uint16) *Packet {
+	return &Packet{
+		Src:      netip.MustParseAddr("198.51.100.1"),
+		Dst:      netip.MustParseAddr(dst),
+		Protocol: 17,
+		SrcPort:  40000,
+		DstPort:  dport,
+		Length:   100,
+	}
+}
+
+func TestMatches(t *testing.T) {
+	tests := []struct {
+		name string
+		list fs.FSComponentList
+		pkt  *Packet
+		want bool
+	}{
+		{
+			name: "DstProtoPort",
+			list: fs.FSComponentList{Components: []fs.FSComponent{
+				{Type: fs.ComponentTypeDestinationPrefix, Prefix: prefix("192.0.2.0/24")},
+				{Type: fs.ComponentTypeIpProtocol, Raw: []byte{0x81, 0x11}},
+				{Type: fs.ComponentTypeDestinationPort, Raw: []byte{0x01, 0x35, 0x81, 0x7b}},
+			}},
+			pkt:  udp("192.0.2.9", 123),
+			want: true,
+		},
+		{
+			name: "DstOutside",
+			list: fs.FSComponentList{Components: []fs.FSComponent{
+				{Type: fs.ComponentTypeDestinationPrefix, Prefix: prefix("192.0.2.0/24")},
+			}},
+			pkt:  udp("192.0.3.9", 123),
+			want: false,
+		},
+		{
+			name: "PortMatchesEitherDirection",
+			list: fs.FSComponentList{Components: []fs.FSComponent{
+				{Type: fs.ComponentTypePort, Raw: []byte{0x91, 0x9c, 0x40}},
+			}},
+			pkt:  udp("192.0.2.9", 53),
+			want: true,
+		},
+		{
+			name: "PortNeverMatchesICMP",
+			list: fs.FSComponentList{Components: []fs.FSComponent{
+				{Type: fs.ComponentTypeDestinationPort, Raw: []byte{0x83, 0x00}},
+			}},
+			pkt:  &Packet{Dst: netip.MustParseAddr("192.0.2.9"), Protocol: 1},
+			want: false,
+		},
+		{
+			name: "ICMPv6Type",
+			list: fs.FSComponentList{Components: []fs.FSComponent{
+				{Type: fs.ComponentTypeICMPType, Raw: []byte{0x81, 0x80}},
+			}},
+			pkt:  &Packet{Dst: netip.MustParseAddr("2001:db8::1"), Protocol: 58, ICMPType: 128},
+			want: true,
+		},
+		{
+			// SYN set and ACK not set
+			name: "TCPFlagsSynNotAck",
+			list: fs.FSComponentList{Components: []fs.FSComponent{
+				{Type: fs.ComponentTypeTCPFlags, Raw: []byte{0x01, 0x02, 0xc2, 0x10}},
+			}},
+			pkt:  &Packet{Dst: netip.MustParseAddr("192.0.2.9"), Protocol: 6, TCPFlags: 0x02},
+			want: true,
+		},
+		{
+			name: "TCPFlagsSynAck",
+			list: fs.FSComponentList{Components: []fs.FSComponent{
+				{Type: fs.ComponentTypeTCPFlags, Raw: []byte{0x01, 0x02, 0xc2, 0x10}},
+			}},
+			pkt:  &Packet{Dst: netip.MustParseAddr("192.0.2.9"), Protocol: 6, TCPFlags: 0x12},
+			want: false,
+		},
+		{
+			name: "FragmentIsF",
+			list: fs.FSComponentList{Components: []fs.FSComponent{
+				{Type: fs.ComponentTypeFragment, Raw: []byte{0x80, 0x02}},
+			}},
+			pkt:  &Packet{Dst: netip.MustParseAddr("192.0.2.9"), Fragment: 0x02 | 0x08},
+			want: true,
+		},
+		{
+			name: "FragmentDFIgnoredForIPv6",
+			list: fs.FSComponentList{Components: []fs.FSComponent{
+				fs.FragmentComponent([]fs.BitmaskOp{fs.BitmaskNone(uint64(fs.FragmentDF))}),
+			}},
+			pkt:  &Packet{Dst: netip.MustParseAddr("2001:db8::9"), Fragment: fs.FragmentDF},
+			want: true,
+		},
+		{
+			name: "PortNeverMatchesNonFirstFragment",
+			list: fs.FSComponentList{Components: []fs.FSComponent{
+				{Type: fs.ComponentTypeDestinationPort, Raw: []byte{0x81, 0x00}},
+			}},
+			pkt:  &Packet{Dst: netip.MustParseAddr("192.0.2.9"), Protocol: 17, Fragment: fs.PacketFragmentBits(false, false, 185)},
+			want: false,
+		},
+		{
+			name: "LengthAndDSCP",
+			list: fs.FSComponentList{Components: []fs.FSComponent{
+				{Type: fs.ComponentTypePacketLength, Raw: []byte{0x03, 0x40, 0xc5, 0x80}},
+				{Type: fs.ComponentTypeDSCP, Raw: []byte{0x81, 0x2e}},
+			}},
+			pkt:  &Packet{Dst: netip.MustParseAddr("192.0.2.9"), Length: 100, DSCP: 46},
+			want: true,
+		},
+		{
+			name: "EmptyListMatchesAll",
+			pkt:  udp("192.0.2.9", 1),
+			want: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Matches(tt.list, tt.pkt)
+			if err != nil {
+				t.Fatalf("Matches(%v) error = %v, want <nil>", tt.list, err)
+			}
+			if got != tt.want {
+				t.Errorf("Matches(%v, %+v) = %v, want %v", tt.list, tt.pkt, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatcherOrder(t *testing.T) {
+	rules := []fs.FSComponentList{
+		{Components: []fs.FSComponent{
+			{Type: fs.ComponentTypeDestinationPrefix, Prefix: prefix("192.0.2.0/24")},
+		}},
+		{Components: []fs.FSComponent{
+			{Type: fs.ComponentTypeDestinationPrefix, Prefix: prefix("192.0.2.0/24")},
+			{Type: fs.ComponentTypeIpProtocol, Raw: []byte{0x81, 0x11}},
+		}},
+		{Components: []fs.FSComponent{
+			{Type: fs.ComponentTypeDestinationPrefix, Prefix: prefix("192.0.2.128/25")},
+		}},
+	}
+	m, err := New(rules)
+	if err != nil {
+		t.Fatalf("New() error = %v, want <nil>", err)
+	}
+
+	tests := []struct {
+		name    string
+		pkt     *Packet
+		want    int
+		wantOK  bool
+		wantAll []int
+	}{
+		// more components take precedence (RFC8955 5.1)
+		{name: "MoreComponentsFirst", pkt: udp("192.0.2.200", 53), want: 1, wantOK: true, wantAll: []int{1, 2, 0}},
+		// equal count: the more specific prefix takes precedence
+		{name: "MoreSpecificPrefix", pkt: &Packet{Dst: netip.MustParseAddr("192.0.2.200"), Protocol: 6}, want: 2, wantOK: true, wantAll: []int{2, 0}},
+		{name: "Fallback", pkt: &Packet{Dst: netip.MustParseAddr("192.0.2.1"), Protocol: 6}, want: 0, wantOK: true, wantAll: []int{0}},
+		{name: "NoMatch", pkt: udp("203.0.113.1", 53), want: -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := m.Match(tt.pkt)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("Match(%+v) = %d, %v, want %d, %v", tt.pkt, got, ok, tt.want, tt.wantOK)
+			}
+			if all := m.MatchAll(tt.pkt); !slices.Equal(all, tt.wantAll) {
+				t.Errorf("MatchAll(%+v) = %v, want %v", tt.pkt, all, tt.wantAll)
+			}
+		})
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		list    fs.FSComponentList
+		wantErr error
+	}{
+		{
+			name:    "MalformedOperators",
+			list:    fs.FSComponentList{Components: []fs.FSComponent{{Type: fs.ComponentTypeIpProtocol, Raw: []byte{0x01, 0x11}}}},
+			wantErr: fs.ErrMalformedOperators,
+		},
+		{
+			name:    "MissingPrefix",
+			list:    fs.FSComponentList{Components: []fs.FSComponent{{Type: fs.ComponentTypeDestinationPrefix}}},
+			wantErr: ErrMissingPrefix,
+		},
+		{
+			name:    "UnknownType",
+			list:    fs.FSComponentList{Components: []fs.FSComponent{{Type: 13, Raw: []byte{0x81, 0x01}}}},
+			wantErr: ErrUnknownComponent,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New([]fs.FSComponentList{tt.list}); !errors.Is(err, tt.wantErr) {
+				t.Errorf("New(%v) error = %v, want %v", tt.list, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,236 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+// Package metrics exports FlowSpec rule processing as Prometheus metrics.
+//
+// Rule counters follow an events.Bus, validation latency is observed by
+// wrapping ValidateFeasibility, and RIB sizes and per-action rule counts are
+// computed from the current snapshot at scrape time:
+//
+//	floofspec_rules_received_total
+//	floofspec_rules_accepted_total
+//	floofspec_rules_rejected_total{stage,reason}
+//	floofspec_rules_withdrawn_total
+//	floofspec_rules_revalidated_total{reason}
+//	floofspec_validation_duration_seconds
+//	floofspec_rib_routes{rib}
+//	floofspec_rules_by_action{action}
+//	floofspec_unicast_cache_hits_total{rib}
+//	floofspec_unicast_cache_misses_total{rib}
+//	floofspec_unicast_cache_evictions_total{rib}
+//
+// Reasons are the names of fs.Reason, with "feasible" for revalidations that
+// made a rule feasible; stages those of fs.ErrorStage.
+package metrics
+
+import (
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/actions"
+	"floofspectools/flowspecinternal/events"
+	"floofspectools/flowspecinternal/rib"
+)
+
+// Options configures the metrics.
+type Options struct {
+	// Namespace prefixes every metric name, defaults to "floofspec".
+	Namespace string
+	// FlowSpecRIB, if set, is reported as rib="flowspec" and broken down
+	// into rules_by_action.
+	FlowSpecRIB *rib.FlowSpecRIB
+	// UnicastRIBs are reported by name, e.g. "unicast" or a VRF name.
+	UnicastRIBs map[string]rib.Index
+	// UnicastCaches report their lookup counters by name.
+	UnicastCaches map[string]*rib.Cache
+	// Buckets of the validation latency histogram, defaults to
+	// prometheus.ExponentialBuckets(1e-6, 4, 10), 1µs to about 0.26s.
+	Buckets []float64
+}
+
+// Metrics holds the collectors registered by New.
+type Metrics struct {
+	received    prometheus.Counter
+	accepted    prometheus.Counter
+	rejected    *prometheus.CounterVec
+	withdrawn   prometheus.Counter
+	revalidated *prometheus.CounterVec
+	validation  prometheus.Histogram
+}
+
+// New creates the metrics and registers them on reg.
+func New(reg prometheus.Registerer, opts *Options) (*Metrics, error) {
+	var o Options
+	if opts != nil {
+		o = *opts
+	}
+	if o.Namespace == "" {
+		o.Namespace = "floofspec"
+	}
+	if o.Buckets == nil {
+		o.Buckets = prometheus.ExponentialBuckets(1e-6, 4, 10)
+	}
+	m := &Metrics{
+		received: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: o.Namespace, Name: "rules_received_total",
+			Help: "FlowSpec rules received, accepted or rejected.",
+		}),
+		accepted: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: o.Namespace, Name: "rules_accepted_total",
+			Help: "FlowSpec rules that passed validation.",
+		}),
+		rejected: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: o.Namespace, Name: "rules_rejected_total",
+			Help: "FlowSpec rules that failed validation, by stage and reason.",
+		}, []string{"stage", "reason"}),
+		withdrawn: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: o.Namespace, Name: "rules_withdrawn_total",
+			Help: "FlowSpec rules withdrawn.",
+		}),
+		revalidated: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: o.Namespace, Name: "rules_revalidated_total",
+			Help: "FlowSpec rules whose validation result changed, by new reason.",
+		}, []string{"reason"}),
+		validation: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: o.Namespace, Name: "validation_duration_seconds",
+			Help:    "Duration of FlowSpec feasibility validations.",
+			Buckets: o.Buckets,
+		}),
+	}
+	collectors := []prometheus.Collector{m.received, m.accepted, m.rejected, m.withdrawn, m.revalidated, m.validation}
+	if o.FlowSpecRIB != nil || len(o.UnicastRIBs) > 0 || len(o.UnicastCaches) > 0 {
+		collectors = append(collectors, newRIBCollector(&o))
+	}
+	for _, c := range collectors {
+		if err := reg.Register(c); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// Subscribe counts the events published on bus until cancel is called.
+func (m *Metrics) Subscribe(bus *events.Bus) (cancel func()) {
+	return bus.Subscribe(m.Observe)
+}
+
+// Observe counts one event.
+func (m *Metrics) Observe(e events.Event) {
+	switch e.Kind {
+	case events.RuleAccepted:
+		m.received.Inc()
+		m.accepted.Inc()
+	case events.RuleRejected:
+		m.received.Inc()
+		m.rejected.WithLabelValues(fs.ErrorStage(e.Err).String(), fs.Reason(e.Err)).Inc()
+	case events.RuleWithdrawn:
+		m.withdrawn.Inc()
+	case events.RuleRevalidated:
+		reason := fs.Reason(e.Err)
+		if reason == "" {
+			reason = "feasible"
+		}
+		m.revalidated.WithLabelValues(reason).Inc()
+	}
+}
+
+// ObserveValidation records the duration of one validation.
+func (m *Metrics) ObserveValidation(d time.Duration) {
+	m.validation.Observe(d.Seconds())
+}
+
+// ValidateFeasibility is fs.ValidateFeasibility with its duration recorded.
+func (m *Metrics) ValidateFeasibility(r *fs.FlowSpecRoute, unicast fs.UnicastRIB, cfg *fs.Config) error {
+	start := time.Now()
+	err := fs.ValidateFeasibility(r, unicast, cfg)
+	m.ObserveValidation(time.Since(start))
+	return err
+}
+
+// ribCollector reports table sizes, per-action counts and cache counters at
+// scrape time.
+type ribCollector struct {
+	opts        *Options
+	routes      *prometheus.Desc
+	byAction    *prometheus.Desc
+	cacheHits   *prometheus.Desc
+	cacheMisses *prometheus.Desc
+	cacheEvicts *prometheus.Desc
+}
+
+func newRIBCollector(o *Options) *ribCollector {
+	return &ribCollector{
+		opts: o,
+		routes: prometheus.NewDesc(prometheus.BuildFQName(o.Namespace, "", "rib_routes"),
+			"Routes currently held, by RIB.", []string{"rib"}, nil),
+		byAction: prometheus.NewDesc(prometheus.BuildFQName(o.Namespace, "", "rules_by_action"),
+			"Feasible FlowSpec rules in the FlowSpec RIB, by action; accept for rules without action.", []string{"action"}, nil),
+		cacheHits: prometheus.NewDesc(prometheus.BuildFQName(o.Namespace, "", "unicast_cache_hits_total"),
+			"Unicast RIB lookups answered from the cache, by RIB.", []string{"rib"}, nil),
+		cacheMisses: prometheus.NewDesc(prometheus.BuildFQName(o.Namespace, "", "unicast_cache_misses_total"),
+			"Unicast RIB lookups passed on to the backend, by RIB.", []string{"rib"}, nil),
+		cacheEvicts: prometheus.NewDesc(prometheus.BuildFQName(o.Namespace, "", "unicast_cache_evictions_total"),
+			"Cached unicast RIB answers evicted for space, by RIB.", []string{"rib"}, nil),
+	}
+}
+
+func (c *ribCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.routes
+	ch <- c.byAction
+	ch <- c.cacheHits
+	ch <- c.cacheMisses
+	ch <- c.cacheEvicts
+}
+
+func (c *ribCollector) Collect(ch chan<- prometheus.Metric) {
+	for name, idx := range c.opts.UnicastRIBs {
+		ch <- prometheus.MustNewConstMetric(c.routes, prometheus.GaugeValue, float64(idx.Len()), name)
+	}
+	for name, cache := range c.opts.UnicastCaches {
+		st := cache.Stats()
+		ch <- prometheus.MustNewConstMetric(c.cacheHits, prometheus.CounterValue, float64(st.Hits), name)
+		ch <- prometheus.MustNewConstMetric(c.cacheMisses, prometheus.CounterValue, float64(st.Misses), name)
+		ch <- prometheus.MustNewConstMetric(c.cacheEvicts, prometheus.CounterValue, float64(st.Evictions), name)
+	}
+	if c.opts.FlowSpecRIB == nil {
+		return
+	}
+	snap := c.opts.FlowSpecRIB.Snapshot()
+	ch <- prometheus.MustNewConstMetric(c.routes, prometheus.GaugeValue, float64(snap.Len()), "flowspec")
+	counts := map[string]int{}
+	for e := range snap.All() {
+		if e.Err != nil {
+			continue
+		}
+		seen := map[string]bool{}
+		for _, ec := range e.Route.ExtCommunities {
+			a, err := actions.Decode(ec)
+			if err != nil {
+				continue
+			}
+			seen[actionName(a)] = true
+		}
+		if len(seen) == 0 {
+			seen["accept"] = true
+		}
+		for name := range seen {
+			counts[name]++
+		}
+	}
+	for name, n := range counts {
+		ch <- prometheus.MustNewConstMetric(c.byAction, prometheus.GaugeValue, float64(n), name)
+	}
+}
+
+// actionName is the keyword of a in the rule syntax of actions.ParseActions,
+// e.g. "discard", "rate-bytes" or "redirect".
+func actionName(a actions.Action) string {
+	if f := strings.Fields(a.String()); len(f) > 0 {
+		return f[0]
+	}
+	return "unknown"
+}
@@ -0,0 +1,118 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package metrics
+
+import (
+	"errors"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/actions"
+	"floofspectools/flowspecinternal/events"
+	"floofspectools/flowspecinternal/rib"
+)
+
+func route(t *testing.T, s string, acts ...actions.Action) *fs.FlowSpecRoute {
+	t.Helper()
+	l, err := fs.ParseComponents(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &fs.FlowSpecRoute{AFI: fs.AFIIPv4, SAFI: fs.SAFIFlowSpec, Components: l, DestPrefix: l.Components[0].Prefix}
+	for _, a := range acts {
+		r.ExtCommunities = append(r.ExtCommunities, a.ExtendedCommunity())
+	}
+	return r
+}
+
+func TestMetrics(t *testing.T) {
+	bus := events.NewBus()
+	flowspec := rib.NewFlowSpecRIB(&rib.FlowSpecOptions{Events: bus})
+	unicast := rib.NewTrie()
+	unicast.Insert(&fs.UnicastRoute{Prefix: netip.MustParsePrefix("192.0.2.0/24"), NeighborAS: 64500, ASPath: []uint32{64500}})
+
+	cache := rib.NewCache(unicast, &rib.CacheOptions{Size: 1})
+
+	reg := prometheus.NewPedanticRegistry()
+	m, err := New(reg, &Options{
+		FlowSpecRIB:   flowspec,
+		UnicastRIBs:   map[string]rib.Index{"unicast": unicast},
+		UnicastCaches: map[string]*rib.Cache{"unicast": cache},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Subscribe(bus)
+
+	discard := route(t, "dst 192.0.2.0/24 proto udp", actions.TrafficRateBytes{})
+	flowspec.Insert(discard, m.ValidateFeasibility(discard, unicast, nil))
+	flowspec.Insert(route(t, "dst 192.0.2.0/25", actions.TrafficMarking{DSCP: 10}, actions.TrafficRateBytes{Rate: 1e6}), nil)
+	flowspec.Insert(route(t, "dst 192.0.2.128/25"), nil)
+	flowspec.Insert(route(t, "dst 198.51.100.0/24"), fs.ErrNoBestUnicast)
+	flowspec.Insert(route(t, "dst 203.0.113.0/24"), errors.New("unexpected"))
+	flowspec.Delete(route(t, "dst 192.0.2.128/25"))
+	flowspec.Revalidate(func(*fs.FlowSpecRoute) error { return nil }, nil)
+	cache.BestPath(netip.MustParsePrefix("192.0.2.0/24"))
+	cache.BestPath(netip.MustParsePrefix("192.0.2.0/24"))
+	cache.MoreSpecifics(netip.MustParsePrefix("192.0.2.0/24"))
+
+	want := `
+# HELP floofspec_rib_routes Routes currently held, by RIB.
+# TYPE floofspec_rib_routes gauge
+floofspec_rib_routes{rib="flowspec"} 4
+floofspec_rib_routes{rib="unicast"} 1
+# HELP floofspec_rules_accepted_total FlowSpec rules that passed validation.
+# TYPE floofspec_rules_accepted_total counter
+floofspec_rules_accepted_total 3
+# HELP floofspec_rules_by_action Feasible FlowSpec rules in the FlowSpec RIB, by action; accept for rules without action.
+# TYPE floofspec_rules_by_action gauge
+floofspec_rules_by_action{action="accept"} 2
+floofspec_rules_by_action{action="discard"} 1
+floofspec_rules_by_action{action="mark"} 1
+floofspec_rules_by_action{action="rate-bytes"} 1
+# HELP floofspec_rules_received_total FlowSpec rules received, accepted or rejected.
+# TYPE floofspec_rules_received_total counter
+floofspec_rules_received_total 5
+# HELP floofspec_rules_rejected_total FlowSpec rules that failed validation, by stage and reason.
+# TYPE floofspec_rules_rejected_total counter
+floofspec_rules_rejected_total{reason="no-best-unicast",stage="feasibility"} 1
+floofspec_rules_rejected_total{reason="other",stage="other"} 1
+# HELP floofspec_rules_revalidated_total FlowSpec rules whose validation result changed, by new reason.
+# TYPE floofspec_rules_revalidated_total counter
+floofspec_rules_revalidated_total{reason="feasible"} 2
+# HELP floofspec_rules_withdrawn_total FlowSpec rules withdrawn.
+# TYPE floofspec_rules_withdrawn_total counter
+floofspec_rules_withdrawn_total 1
+# HELP floofspec_unicast_cache_evictions_total Cached unicast RIB answers evicted for space, by RIB.
+# TYPE floofspec_unicast_cache_evictions_total counter
+floofspec_unicast_cache_evictions_total{rib="unicast"} 1
+# HELP floofspec_unicast_cache_hits_total Unicast RIB lookups answered from the cache, by RIB.
+# TYPE floofspec_unicast_cache_hits_total counter
+floofspec_unicast_cache_hits_total{rib="unicast"} 1
+# HELP floofspec_unicast_cache_misses_total Unicast RIB lookups passed on to the backend, by RIB.
+# TYPE floofspec_unicast_cache_misses_total counter
+floofspec_unicast_cache_misses_total{rib="unicast"} 2
+`
+	names := []string{
+		"floofspec_rib_routes", "floofspec_rules_accepted_total", "floofspec_rules_by_action", "floofspec_rules_received_total",
+		"floofspec_rules_rejected_total", "floofspec_rules_revalidated_total", "floofspec_rules_withdrawn_total",
+		"floofspec_unicast_cache_evictions_total", "floofspec_unicast_cache_hits_total", "floofspec_unicast_cache_misses_total",
+	}
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(want), names...); err != nil {
+		t.Error(err)
+	}
+	if n := testutil.CollectAndCount(m.validation); n != 1 {
+		t.Errorf("validation histogram has %d series, want 1", n)
+	}
+
+	if _, err := New(reg, nil); err == nil {
+		t.Error("New() registering twice error = <nil>, want AlreadyRegisteredError")
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package flowspecinternal
+
+import (
+	"slices"
+)
+
+// Minimize returns a copy of l with every operator sequence rewritten into its
+// shortest canonical encoding and prefixes masked. The result matches the same
+// packets as l: numeric sequences are rebuilt from their merged value ranges,
+// bitmask sequences lose repeated terms and groups. Components whose operators
+// do not decode return ErrMalformedOperators.
+func (l FSComponentList) Minimize() (FSComponentList, error) {
+	out := FSComponentList{Components: make([]FSComponent, 0, len(l.Components))}
+	for _, c := range l.Components {
+		m := FSComponent{Type: c.Type}
+		switch {
+		case c.Type == ComponentTypeDestinationPrefix || c.Type == ComponentTypeSourcePrefix:
+			if c.Prefix != nil {
+				p := c.Prefix.Masked()
+				m.Prefix = &p
+			}
+		case c.Type.IsMAC():
+			m.Raw = slices.Clone(c.Raw)
+		case c.Type.IsBitmask():
+			ops, err := ParseBitmaskOps(c.Raw)
+			if err != nil {
+				return FSComponentList{}, err
+			}
+			m.Raw = EncodeBitmaskOps(MinimizeBitmaskOps(ops))
+		default:
+			ops, err := ParseNumericOps(c.Raw)
+			if err != nil {
+				return FSComponentList{}, err
+			}
+			m.Raw = EncodeNumericOps(MinimizeNumericOps(ops, c.Type.maxValue()))
+		}
+		out.Components = append(out.Components, m)
+	}
+	return out, nil
+}
+
+// MinimizeNumericOps returns the shortest encoding of the values ops accept
+// in [0, max]: one operator per single value or open range, an AND-ed pair per
+// closed range, or AND-ed "!=" operators when the complement is a few single
+// values. Ranges are ordered by value.
+func MinimizeNumericOps(ops []NumericOp, max uint64) []NumericOp {
+	ranges := NumericRanges(ops, max)
+	switch {
+	case len(ranges) == 0:
+		return []NumericOp{{}}
+	case len(ranges) == 1 && ranges[0].From == 0 && ranges[0].To == max:
+		return []NumericOp{{LT: true, GT: true, EQ: true}}
+	}
+
+	var out []NumericOp
+	for _, r := range ranges {
+		switch {
+		case r.From == r.To:
+			out = append(out, NumericOp{EQ: true, Value: r.From})
+		case r.From == 0:
+			out = append(out, NumericOp{LT: true, EQ: true, Value: r.To})
+		case r.To == max:
+			out = append(out, lowerBound(r.From))
+		default:
+			upper := NumericOp{And: true, LT: true, EQ: true, Value: r.To}
+			out = append(out, lowerBound(r.From), upper)
+		}
+	}
+
+	// All values but a few: "!=a&!=b" may be shorter.
+	if ranges[0].From == 0 && ranges[len(ranges)-1].To == max {
+		var excl []NumericOp
+		for i := 1; i < len(ranges); i++ {
+			gap := ranges[i-1].To + 1
+			if gap != ranges[i].From-1 {
+				return out
+			}
+			excl = append(excl, NumericOp{And: len(excl) > 0, LT: true, GT: true, Value: gap})
+		}
+		if len(EncodeNumericOps(excl)) < len(EncodeNumericOps(out)) {
+			return excl
+		}
+	}
+	return out
+}
+
+// NumericOpsFromRanges returns the shortest operator sequence accepting the
+// values of ranges in [0, max], see MinimizeNumericOps.
+func NumericOpsFromRanges(ranges []ValueRange, max uint64) []NumericOp {
+	var ops []NumericOp
+	for _, r := range ranges {
+		ops = append(ops, NumericOp{GT: true, EQ: true, Value: r.From}, NumericOp{And: true, LT: true, EQ: true, Value: r.To})
+	}
+	return MinimizeNumericOps(ops, max)
+}
+
+// lowerBound returns ">=v", or ">v-1" when v-1 has a shorter encoding.
+func lowerBound(v uint64) NumericOp {
+	if len(encodeOp(nil, 0, v-1)) < len(encodeOp(nil, 0, v)) {
+		return NumericOp{GT: true, Value: v - 1}
+	}
+	return NumericOp{GT: true, EQ: true, Value: v}
+}
+
+// MinimizeBitmaskOps removes repeated terms within an AND-ed group and
+// repeated groups, keeping the first occurrence of each.
+func MinimizeBitmaskOps(ops []BitmaskOp) []BitmaskOp {
+	var (
+		out    []BitmaskOp
+		groups [][]BitmaskOp
+	)
+	same := func(a, b BitmaskOp) bool { return a.Value == b.Value && a.Not == b.Not && a.Match == b.Match }
+	for _, g := range SplitBitmaskOps(ops) {
+		var terms []BitmaskOp
+		for _, op := range g {
+			if !slices.ContainsFunc(terms, func(t BitmaskOp) bool { return same(t, op) }) {
+				terms = append(terms, op)
+			}
+		}
+		if slices.ContainsFunc(groups, func(o []BitmaskOp) bool { return slices.EqualFunc(o, terms, same) }) {
+			continue
+		}
+		groups = append(groups, terms)
+		for i, op := range terms {
+			op.And = i > 0
+			out = append(out, op)
+		}
+	}
+	return out
+}
@@ -0,0 +1,58 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package flowspecinternal
+
+import (
+	"testing"
+)
+
+func TestMinimize(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{name: "MergedRanges", in: "dport >=80&<=90,>=85&<=100,=101", want: "dport >=80&<=101"},
+		{name: "RedundantAnd", in: "port >=80&<=80&>10", want: "port =80"},
+		{name: "Sorted", in: "proto udp,tcp,udp", want: "proto tcp,udp"},
+		{name: "OpenRanges", in: "len <100,>1400", want: "len <=99,>=1401"},
+		{name: "ShorterLowerBound", in: "len >=256", want: "len >255"},
+		{name: "NotEqual", in: "dport <80,>80", want: "dport !=80"},
+		{name: "AllValues", in: "dscp <=10,>=5", want: "dscp true"},
+		{name: "NoValues", in: "dscp >10&<5", want: "dscp false"},
+		{name: "BitmaskDuplicates", in: "tcp-flags =syn|ack&=syn|ack&!rst,=syn|ack&!rst,fin", want: "tcp-flags =syn|ack&!rst,fin"},
+		{name: "HostBits", in: "dst 192.0.2.77/24", want: "dst 192.0.2.0/24"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := ParseComponents(tt.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := l.Minimize()
+			if err != nil {
+				t.Fatalf("Minimize() error = %v, want <nil>", err)
+			}
+			if got.String() != tt.want {
+				t.Errorf("Minimize(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+			if eq, err := Equivalent(l, got); err != nil || !eq {
+				t.Errorf("Equivalent(%q, %q) = %v, %v, want true", tt.in, got, eq, err)
+			}
+			if a, b := len(mustEncode(t, got)), len(mustEncode(t, l)); a > b {
+				t.Errorf("Minimize(%q) grew the NLRI from %d to %d bytes", tt.in, b, a)
+			}
+		})
+	}
+}
+
+func mustEncode(t *testing.T, l FSComponentList) []byte {
+	t.Helper()
+	b, err := EncodeNLRI(l, AFIIPv4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
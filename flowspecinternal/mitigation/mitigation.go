@@ -0,0 +1,225 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+// Package mitigation originates FlowSpec rules automatically while the
+// traffic toward a protected prefix exceeds a threshold.
+//
+// A Controller watches the traffic a flows.Provider reports. When a
+// Protection's threshold is exceeded it inserts the rule of its template
+// into the local FlowSpecRIB, the table of originated rules the BGP
+// speaker announces from; once the traffic stayed below the threshold for
+// the hold time it withdraws the rule with ErrSubsided. The RIB publishes
+// both on its events.Bus as RuleAccepted and RuleWithdrawn:
+//
+//	local := rib.NewFlowSpecRIB(&rib.FlowSpecOptions{Events: bus})
+//	c, err := mitigation.New(local, []mitigation.Protection{{
+//		Name:     "web",
+//		Prefix:   netip.MustParsePrefix("192.0.2.0/24"),
+//		PPS:      500000,
+//		Match:    mitigation.Protocol(17),
+//		Template: templates.UDPAmplification,
+//	}}, nil)
+//	go c.Run(ctx, collector, 10*time.Second)
+package mitigation
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"slices"
+	"sync"
+	"time"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/actions"
+	"floofspectools/flowspecinternal/flows"
+	"floofspectools/flowspecinternal/rib"
+	"floofspectools/flowspecinternal/templates"
+)
+
+var (
+	ErrInvalidProtection = errors.New("mitigation: protection needs a unique name, a prefix, a threshold and a template")
+	// ErrSubsided is the reason of the RuleWithdrawn event of a mitigation
+	// ended by the controller.
+	ErrSubsided = errors.New("mitigation: traffic stayed below the threshold for the hold time")
+)
+
+// DefaultHoldTime is Options.HoldTime when it is zero.
+const DefaultHoldTime = 5 * time.Minute
+
+// Template builds the rule mitigating an attack on victim. The functions
+// of package templates are Templates.
+type Template func(victim netip.Prefix, opts *templates.Options) (actions.Rule, error)
+
+// Protection is a prefix mitigated automatically.
+type Protection struct {
+	Name   string
+	Prefix netip.Prefix
+	// PPS and BPS are the packets and bits per second toward Prefix above
+	// which the mitigation starts; exceeding either suffices, zero
+	// disables that threshold.
+	PPS float64
+	BPS float64
+	// Match selects the flow records counted, e.g. Protocol(17) for a
+	// UDP amplification template. Nil counts all traffic toward Prefix.
+	Match func(flows.Record) bool
+	// Template and TemplateOptions build the rule for Prefix.
+	Template        Template
+	TemplateOptions *templates.Options
+}
+
+// Protocol returns a Protection.Match counting the traffic of the IP
+// protocol p only.
+func Protocol(p uint8) func(flows.Record) bool {
+	return func(r flows.Record) bool { return r.Protocol == p }
+}
+
+// Options configures a Controller.
+type Options struct {
+	// HoldTime is how long the traffic must stay below the thresholds
+	// before a mitigation is withdrawn, DefaultHoldTime if zero.
+	HoldTime time.Duration
+	Logger   *slog.Logger
+	// Now returns the current time, defaults to time.Now.
+	Now func() time.Time
+}
+
+// Mitigation is the state of an active Protection.
+type Mitigation struct {
+	Name  string
+	Route *fs.FlowSpecRoute
+	// Since is when the mitigation started, LastAbove when the traffic was
+	// last above the threshold.
+	Since     time.Time
+	LastAbove time.Time
+}
+
+// Controller starts and ends mitigations. Its methods are safe for
+// concurrent use.
+type Controller struct {
+	local       *rib.FlowSpecRIB
+	protections []Protection
+	hold        time.Duration
+	log         *slog.Logger
+	now         func() time.Time
+
+	mu     sync.Mutex
+	active map[string]*Mitigation
+}
+
+// New returns a Controller originating into local. It returns
+// ErrInvalidProtection for a protection without a name, a valid prefix, a
+// threshold or a template, or with the name of another.
+func New(local *rib.FlowSpecRIB, protections []Protection, opts *Options) (*Controller, error) {
+	var o Options
+	if opts != nil {
+		o = *opts
+	}
+	if o.HoldTime <= 0 {
+		o.HoldTime = DefaultHoldTime
+	}
+	if o.Now == nil {
+		o.Now = time.Now
+	}
+	protections = slices.Clone(protections)
+	for i, p := range protections {
+		if p.Name == "" || !p.Prefix.IsValid() || p.PPS <= 0 && p.BPS <= 0 || p.Template == nil ||
+			slices.ContainsFunc(protections[:i], func(q Protection) bool { return q.Name == p.Name }) {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidProtection, p.Name)
+		}
+		protections[i].Prefix = p.Prefix.Masked()
+	}
+	return &Controller{
+		local:       local,
+		protections: protections,
+		hold:        o.HoldTime,
+		log:         fs.SubsystemLogger(o.Logger, fs.SubsystemMitigation),
+		now:         o.Now,
+		active:      make(map[string]*Mitigation),
+	}, nil
+}
+
+// Run observes the records of p every interval until ctx is done and
+// returns ctx.Err(). Errors of p are logged and the interval skipped.
+func (c *Controller) Run(ctx context.Context, p flows.Provider, interval time.Duration) error {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+		records, err := p.TopTalkers(ctx)
+		if err != nil {
+			c.log.Warn("traffic not observed", "error", err)
+			continue
+		}
+		c.Observe(records)
+	}
+}
+
+// Observe takes the traffic of one interval, starting the mitigations of
+// protections above a threshold and ending those below it for the hold
+// time.
+func (c *Controller) Observe(records []flows.Record) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	for _, p := range c.protections {
+		var bps, pps float64
+		for _, r := range records {
+			if r.Dst.Bits() >= p.Prefix.Bits() && p.Prefix.Contains(r.Dst.Addr()) && (p.Match == nil || p.Match(r)) {
+				bps += r.BPS
+				pps += r.PPS
+			}
+		}
+		above := p.PPS > 0 && pps > p.PPS || p.BPS > 0 && bps > p.BPS
+		m := c.active[p.Name]
+		switch {
+		case above && m != nil:
+			m.LastAbove = now
+		case above:
+			c.start(p, now, bps, pps)
+		case m != nil && now.Sub(m.LastAbove) >= c.hold:
+			c.local.Withdraw(m.Route, ErrSubsided)
+			delete(c.active, p.Name)
+			c.log.Info("mitigation ended", "protection", p.Name, fs.LogKeyRule, m.Route.Components.String(), "duration", now.Sub(m.Since))
+		}
+	}
+}
+
+// start originates the rule of p.
+func (c *Controller) start(p Protection, now time.Time, bps, pps float64) {
+	rule, err := p.Template(p.Prefix, p.TemplateOptions)
+	if err != nil {
+		c.log.Error("mitigation not started", "protection", p.Name, "error", err)
+		return
+	}
+	route := &fs.FlowSpecRoute{AFI: fs.AFIIPv4, SAFI: fs.SAFIFlowSpec, Components: rule.Components, DestPrefix: &p.Prefix}
+	if p.Prefix.Addr().Is6() {
+		route.AFI = fs.AFIIPv6
+	}
+	for _, a := range rule.Actions {
+		route.ExtCommunities = append(route.ExtCommunities, a.ExtendedCommunity())
+	}
+	c.local.Insert(route, nil)
+	c.active[p.Name] = &Mitigation{Name: p.Name, Route: route, Since: now, LastAbove: now}
+	c.log.Info("mitigation started", "protection", p.Name, fs.LogKeyRule, rule.Components.String(), "bps", bps, "pps", pps)
+}
+
+// Active returns the active mitigations ordered by name.
+func (c *Controller) Active() []Mitigation {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make([]Mitigation, 0, len(c.active))
+	for _, m := range c.active {
+		out = append(out, *m)
+	}
+	slices.SortFunc(out, func(a, b Mitigation) int { return cmp.Compare(a.Name, b.Name) })
+	return out
+}
@@ -0,0 +1,91 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package mitigation
+
+import (
+	"errors"
+	"net/netip"
+	"testing"
+	"time"
+
+	"floofspectools/flowspecinternal/events"
+	"floofspectools/flowspecinternal/flows"
+	"floofspectools/flowspecinternal/rib"
+	"floofspectools/flowspecinternal/templates"
+)
+
+func TestController(t *testing.T) {
+	bus := events.NewBus()
+	var got []events.Event
+	bus.Subscribe(func(e events.Event) { got = append(got, e) })
+	local := rib.NewFlowSpecRIB(&rib.FlowSpecOptions{Events: bus})
+
+	now := time.Unix(0, 0)
+	c, err := New(local, []Protection{
+		{Name: "web", Prefix: netip.MustParsePrefix("192.0.2.0/24"), PPS: 1000, Match: Protocol(17), Template: templates.UDPAmplification},
+		{Name: "dns", Prefix: netip.MustParsePrefix("198.51.100.53/32"), BPS: 1e9, Template: templates.FragmentDrop},
+	}, &Options{HoldTime: time.Minute, Now: func() time.Time { return now }})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attack := []flows.Record{
+		{Protocol: 17, Dst: netip.MustParsePrefix("192.0.2.10/32"), SrcPort: 123, PPS: 600},
+		{Protocol: 17, Dst: netip.MustParsePrefix("192.0.2.11/32"), SrcPort: 53, PPS: 600},
+		{Protocol: 6, Dst: netip.MustParsePrefix("192.0.2.10/32"), DstPort: 443, PPS: 5000},
+		{Protocol: 17, Dst: netip.MustParsePrefix("198.51.100.0/24"), PPS: 5000, BPS: 2e9}, // only partly toward dns
+	}
+	c.Observe(attack)
+	if len(got) != 1 || got[0].Kind != events.RuleAccepted || got[0].Route.Components.String() != "dst 192.0.2.0/24 proto udp sport =19,=53,=123,=389,=11211" {
+		t.Fatalf("events after the attack = %v, want the web mitigation accepted", got)
+	}
+	if a := c.Active(); len(a) != 1 || a[0].Name != "web" || local.Snapshot().Len() != 1 {
+		t.Errorf("Active() = %v, want web", a)
+	}
+
+	// below the threshold, but not yet for the hold time
+	now = now.Add(30 * time.Second)
+	c.Observe(attack[:1])
+	now = now.Add(45 * time.Second)
+	c.Observe(attack) // above again
+	now = now.Add(59 * time.Second)
+	c.Observe(nil)
+	if len(got) != 1 {
+		t.Fatalf("events within the hold time = %v, want none", got[1:])
+	}
+
+	now = now.Add(time.Second)
+	c.Observe(nil)
+	if len(got) != 2 || got[1].Kind != events.RuleWithdrawn || !errors.Is(got[1].Err, ErrSubsided) {
+		t.Fatalf("events after the hold time = %v, want the web mitigation withdrawn", got)
+	}
+	if a := c.Active(); len(a) != 0 || local.Snapshot().Len() != 0 {
+		t.Errorf("Active() = %v, want none", a)
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	valid := Protection{Name: "a", Prefix: netip.MustParsePrefix("192.0.2.0/24"), PPS: 1, Template: templates.FragmentDrop}
+	noThreshold, noTemplate, noPrefix := valid, valid, valid
+	noThreshold.PPS = 0
+	noTemplate.Template = nil
+	noPrefix.Prefix = netip.Prefix{}
+	tests := []struct {
+		name        string
+		protections []Protection
+	}{
+		{"NoThreshold", []Protection{noThreshold}},
+		{"NoTemplate", []Protection{noTemplate}},
+		{"NoPrefix", []Protection{noPrefix}},
+		{"DuplicateName", []Protection{valid, valid}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(rib.NewFlowSpecRIB(nil), tt.protections, nil); !errors.Is(err, ErrInvalidProtection) {
+				t.Errorf("New() error = %v, want %v", err, ErrInvalidProtection)
+			}
+		})
+	}
+}
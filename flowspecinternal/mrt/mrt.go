@@ -0,0 +1,207 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+// Package mrt reads and writes MRT (RFC6396) dumps of FlowSpec routes.
+//
+// FlowSpec tables are stored as TABLE_DUMP_V2 RIB_GENERIC records following a
+// PEER_INDEX_TABLE, see ReadSnapshot and WriteSnapshot. BGP4MP records carry
+// raw BGP messages and allow replaying UPDATE streams.
+package mrt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net/netip"
+	"time"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/bgp"
+)
+
+var (
+	ErrShortRecord  = errors.New("mrt: record shorter than its header or length field")
+	ErrRecordTooBig = errors.New("mrt: record exceeds the maximum length")
+	ErrMalformed    = errors.New("mrt: malformed record body")
+	ErrNoPeerIndex  = errors.New("mrt: RIB record before PEER_INDEX_TABLE")
+	ErrUnknownPeer  = errors.New("mrt: RIB entry references an unknown peer index")
+	ErrWrongType    = errors.New("mrt: record has a different type or subtype")
+	ErrNotFlowSpec  = errors.New("mrt: route is not a FlowSpec route")
+)
+
+// Record types and subtypes used here (RFC6396 4).
+const (
+	TypeTableDumpV2 = 13
+	TypeBGP4MP      = 16
+
+	SubtypePeerIndexTable = 1
+	SubtypeRIBGeneric     = 6
+
+	SubtypeBGP4MPMessage    = 1
+	SubtypeBGP4MPMessageAS4 = 4
+)
+
+const (
+	headerLen    = 12
+	maxRecordLen = 1 << 20
+)
+
+// Record is one MRT record.
+type Record struct {
+	Timestamp time.Time // second resolution
+	Type      uint16
+	Subtype   uint16
+	Body      []byte
+}
+
+// Reader reads MRT records.
+type Reader struct {
+	r *bufio.Reader
+}
+
+// NewReader returns a Reader reading from r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+// Next returns the next record, io.EOF at the end of the dump.
+func (r *Reader) Next() (*Record, error) {
+	var hdr [headerLen]byte
+	if _, err := io.ReadFull(r.r, hdr[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, ErrShortRecord
+		}
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(hdr[8:])
+	if n > maxRecordLen {
+		return nil, ErrRecordTooBig
+	}
+	rec := &Record{
+		Timestamp: time.Unix(int64(binary.BigEndian.Uint32(hdr[:])), 0),
+		Type:      binary.BigEndian.Uint16(hdr[4:]),
+		Subtype:   binary.BigEndian.Uint16(hdr[6:]),
+		Body:      make([]byte, n),
+	}
+	if _, err := io.ReadFull(r.r, rec.Body); err != nil {
+		return nil, ErrShortRecord
+	}
+	return rec, nil
+}
+
+// Writer writes MRT records.
+type Writer struct {
+	w io.Writer
+}
+
+// NewWriter returns a Writer writing to w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// Write writes rec.
+func (w *Writer) Write(rec *Record) error {
+	if len(rec.Body) > maxRecordLen {
+		return ErrRecordTooBig
+	}
+	b := binary.BigEndian.AppendUint32(make([]byte, 0, headerLen+len(rec.Body)), uint32(rec.Timestamp.Unix()))
+	b = binary.BigEndian.AppendUint16(b, rec.Type)
+	b = binary.BigEndian.AppendUint16(b, rec.Subtype)
+	b = binary.BigEndian.AppendUint32(b, uint32(len(rec.Body)))
+	_, err := w.w.Write(append(b, rec.Body...))
+	return err
+}
+
+// BGP4MP is a BGP4MP_MESSAGE or BGP4MP_MESSAGE_AS4 record (RFC6396 4.4).
+type BGP4MP struct {
+	PeerAS    uint32
+	LocalAS   uint32
+	Interface uint16
+	PeerAddr  netip.Addr
+	LocalAddr netip.Addr
+	// AS4 is set for BGP4MP_MESSAGE_AS4, the message then uses 4 octet ASNs.
+	AS4 bool
+	// Message is the complete BGP message, header included.
+	Message []byte
+}
+
+// ParseBGP4MP decodes a BGP4MP message record.
+func ParseBGP4MP(rec *Record) (*BGP4MP, error) {
+	if rec.Type != TypeBGP4MP || (rec.Subtype != SubtypeBGP4MPMessage && rec.Subtype != SubtypeBGP4MPMessageAS4) {
+		return nil, ErrWrongType
+	}
+	b := rec.Body
+	m := BGP4MP{AS4: rec.Subtype == SubtypeBGP4MPMessageAS4}
+	if m.AS4 {
+		if len(b) < 12 {
+			return nil, ErrMalformed
+		}
+		m.PeerAS, m.LocalAS = binary.BigEndian.Uint32(b), binary.BigEndian.Uint32(b[4:])
+		b = b[8:]
+	} else {
+		if len(b) < 8 {
+			return nil, ErrMalformed
+		}
+		m.PeerAS, m.LocalAS = uint32(binary.BigEndian.Uint16(b)), uint32(binary.BigEndian.Uint16(b[2:]))
+		b = b[4:]
+	}
+	m.Interface = binary.BigEndian.Uint16(b)
+	afi := binary.BigEndian.Uint16(b[2:])
+	b = b[4:]
+	var ok bool
+	if m.PeerAddr, b, ok = readAddr(b, afi); !ok {
+		return nil, ErrMalformed
+	}
+	if m.LocalAddr, b, ok = readAddr(b, afi); !ok {
+		return nil, ErrMalformed
+	}
+	m.Message = b
+	return &m, nil
+}
+
+// Update decodes m's message as an UPDATE received from PeerAS.
+func (m *BGP4MP) Update() (*bgp.Update, error) {
+	return bgp.ParseUpdate(m.Message, &bgp.ParseOptions{
+		PeerAS:    m.PeerAS,
+		LocalAS:   m.LocalAS,
+		TwoByteAS: !m.AS4,
+	})
+}
+
+// Record returns m as a BGP4MP_MESSAGE_AS4 record, or BGP4MP_MESSAGE if AS4 is not set.
+func (m *BGP4MP) Record(ts time.Time) *Record {
+	var b []byte
+	subtype := uint16(SubtypeBGP4MPMessage)
+	if m.AS4 {
+		subtype = SubtypeBGP4MPMessageAS4
+		b = binary.BigEndian.AppendUint32(b, m.PeerAS)
+		b = binary.BigEndian.AppendUint32(b, m.LocalAS)
+	} else {
+		b = binary.BigEndian.AppendUint16(b, uint16(m.PeerAS))
+		b = binary.BigEndian.AppendUint16(b, uint16(m.LocalAS))
+	}
+	b = binary.BigEndian.AppendUint16(b, m.Interface)
+	b = binary.BigEndian.AppendUint16(b, afiOf(m.PeerAddr))
+	b = append(b, m.PeerAddr.AsSlice()...)
+	b = append(b, m.LocalAddr.AsSlice()...)
+	return &Record{Timestamp: ts, Type: TypeBGP4MP, Subtype: subtype, Body: append(b, m.Message...)}
+}
+
+func afiOf(a netip.Addr) uint16 {
+	if a.Is6() {
+		return fs.AFIIPv6
+	}
+	return fs.AFIIPv4
+}
+
+func readAddr(b []byte, afi uint16) (netip.Addr, []byte, bool) {
+	switch {
+	case afi == fs.AFIIPv4 && len(b) >= 4:
+		return netip.AddrFrom4([4]byte(b)), b[4:], true
+	case afi == fs.AFIIPv6 && len(b) >= 16:
+		return netip.AddrFrom16([16]byte(b)), b[16:], true
+	}
+	return netip.Addr{}, nil, false
+}
@@ -0,0 +1,243 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package mrt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net/netip"
+	"slices"
+	"testing"
+	"time"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/announce"
+	"floofspectools/flowspecinternal/bgp"
+	"floofspectools/flowspecinternal/rib"
+)
+
+func route(afi uint16, safi uint8, dst string, asPath ...uint32) *fs.FlowSpecRoute {
+	p := netip.MustParsePrefix(dst)
+	return &fs.FlowSpecRoute{
+		AFI:    afi,
+		SAFI:   safi,
+		ASPath: asPath,
+		Components: fs.FSComponentList{Components: []fs.FSComponent{
+			{Type: fs.ComponentTypeDestinationPrefix, Prefix: &p},
+			{Type: fs.ComponentTypeIpProtocol, Raw: []byte{0x81, 0x11}},
+		}},
+	}
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	discard := [8]byte{0x80, 0x06}
+	v4 := route(fs.AFIIPv4, fs.SAFIFlowSpec, "192.0.2.0/24", 64500, 64496)
+	v4.ExtCommunities = [][8]byte{discard}
+	v4.OriginatorID = netip.AddrFrom4([4]byte{192, 0, 2, 1})
+	v4.ClusterList = []netip.Addr{netip.AddrFrom4([4]byte{192, 0, 2, 2})}
+	v4.NextHop = netip.AddrFrom4([4]byte{198, 51, 100, 1})
+	vpn := route(fs.AFIIPv6, fs.SAFIFlowSpecVPN, "2001:db8::/32", 64501)
+	vpn.RD = [8]byte{0, 0, 0xfd, 0xe8, 0, 0, 0, 1}
+	// not a 4 octet CLUSTER_ID, so no CLUSTER_LIST is written
+	vpn.ClusterList = []netip.Addr{netip.MustParseAddr("2001:db8::1")}
+	originated := time.Unix(1700000000, 0)
+
+	in := &Snapshot{
+		Collector: netip.MustParseAddr("192.0.2.254"),
+		View:      "flowspec",
+		Peers: []Peer{
+			{BGPID: netip.MustParseAddr("192.0.2.1"), Address: netip.MustParseAddr("192.0.2.1"), AS: 64500},
+			{BGPID: netip.MustParseAddr("192.0.2.2"), Address: netip.MustParseAddr("2001:db8::2"), AS: 4200000000},
+		},
+		Routes: []TableRoute{
+			{Peer: 0, Originated: originated, Route: v4},
+			{Peer: 1, Originated: originated, Route: route(fs.AFIIPv4, fs.SAFIFlowSpec, "192.0.2.0/24", 4200000000)},
+			{Peer: 1, Originated: originated, Route: vpn},
+		},
+	}
+	var buf bytes.Buffer
+	if err := WriteSnapshot(&buf, in, originated); err != nil {
+		t.Fatalf("WriteSnapshot() error = %v, want <nil>", err)
+	}
+	out, err := ReadSnapshot(bytes.NewReader(buf.Bytes()), &ReadOptions{LocalAS: 64500})
+	if err != nil {
+		t.Fatalf("ReadSnapshot() error = %v, want <nil>", err)
+	}
+	if out.Collector != in.Collector || out.View != in.View || !slices.Equal(out.Peers, in.Peers) {
+		t.Errorf("ReadSnapshot() header = %v %q %v, want %v %q %v", out.Collector, out.View, out.Peers, in.Collector, in.View, in.Peers)
+	}
+	if len(out.Routes) != len(in.Routes) {
+		t.Fatalf("ReadSnapshot() = %d routes, want %d", len(out.Routes), len(in.Routes))
+	}
+	for i, want := range in.Routes {
+		got := out.Routes[i]
+		if got.Peer != want.Peer || !got.Originated.Equal(want.Originated) {
+			t.Errorf("route %d: peer %d at %v, want %d at %v", i, got.Peer, got.Originated, want.Peer, want.Originated)
+		}
+		g, w := got.Route, want.Route
+		clusters := slices.DeleteFunc(slices.Clone(w.ClusterList), func(id netip.Addr) bool { return !id.Is4() })
+		if g.Components.Canonical(nil) != w.Components.Canonical(nil) || g.AFI != w.AFI || g.SAFI != w.SAFI || g.RD != w.RD ||
+			!slices.Equal(g.ASPath, w.ASPath) || !slices.Equal(g.ExtCommunities, w.ExtCommunities) || g.OriginatorID != w.OriginatorID ||
+			!slices.Equal(g.ClusterList, clusters) || g.NextHop != w.NextHop {
+			t.Errorf("route %d = %+v, want %+v", i, g, w)
+		}
+	}
+	if got := out.Routes[1].Route.PeerRouterID; got != in.Peers[1].BGPID {
+		t.Errorf("PeerRouterID = %v, want the BGP ID %v of the peer", got, in.Peers[1].BGPID)
+	}
+	if out.Routes[0].Route.FromEBGP || !out.Routes[1].Route.FromEBGP {
+		t.Errorf("FromEBGP = %v, %v, want false for the collector's own AS, true otherwise", out.Routes[0].Route.FromEBGP, out.Routes[1].Route.FromEBGP)
+	}
+}
+
+func TestReadSnapshotErrors(t *testing.T) {
+	rib := &Record{Type: TypeTableDumpV2, Subtype: SubtypeRIBGeneric, Body: []byte{0, 0, 0, 0, 0, 1, 133, 0}}
+	var noPeers bytes.Buffer
+	NewWriter(&noPeers).Write(rib)
+
+	tests := []struct {
+		name    string
+		raw     []byte
+		wantErr error
+	}{
+		{name: "NoPeerIndex", raw: noPeers.Bytes(), wantErr: ErrNoPeerIndex},
+		{name: "TruncatedHeader", raw: []byte{0, 0, 0, 0, 0, 13}, wantErr: ErrShortRecord},
+		{name: "TruncatedBody", raw: []byte{0, 0, 0, 0, 0, 13, 0, 1, 0, 0, 0, 9, 1}, wantErr: ErrShortRecord},
+		{name: "TooBig", raw: []byte{0, 0, 0, 0, 0, 13, 0, 1, 0xff, 0, 0, 0}, wantErr: ErrRecordTooBig},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ReadSnapshot(bytes.NewReader(tt.raw), nil); !errors.Is(err, tt.wantErr) {
+				t.Errorf("ReadSnapshot() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBGP4MPRoundTrip(t *testing.T) {
+	r := route(fs.AFIIPv4, fs.SAFIFlowSpec, "192.0.2.0/24")
+	msg, err := bgp.EncodeUpdate(announce.Update{Components: r.Components}, bgp.EncodeOptions{LocalAS: 4200000000, EBGP: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := &BGP4MP{
+		PeerAS:    4200000000,
+		LocalAS:   64500,
+		PeerAddr:  netip.MustParseAddr("2001:db8::1"),
+		LocalAddr: netip.MustParseAddr("2001:db8::2"),
+		AS4:       true,
+		Message:   msg,
+	}
+	var buf bytes.Buffer
+	if err := NewWriter(&buf).Write(in.Record(time.Unix(1700000000, 0))); err != nil {
+		t.Fatal(err)
+	}
+	rec, err := NewReader(&buf).Next()
+	if err != nil {
+		t.Fatalf("Next() error = %v, want <nil>", err)
+	}
+	out, err := ParseBGP4MP(rec)
+	if err != nil {
+		t.Fatalf("ParseBGP4MP() error = %v, want <nil>", err)
+	}
+	if out.PeerAS != in.PeerAS || out.LocalAS != in.LocalAS || out.PeerAddr != in.PeerAddr || out.LocalAddr != in.LocalAddr || !out.AS4 {
+		t.Errorf("ParseBGP4MP() = %+v, want %+v", out, in)
+	}
+	u, err := out.Update()
+	if err != nil {
+		t.Fatalf("Update() error = %v, want <nil>", err)
+	}
+	if len(u.Announced) != 1 || !slices.Equal(u.Announced[0].ASPath, []uint32{4200000000}) {
+		t.Errorf("Update() = %+v, want one route with AS_PATH 4200000000", u.Announced)
+	}
+}
+
+// ribUnicast encodes a RIB_IPV4_UNICAST or RIB_IPV6_UNICAST record of p
+// with one entry per route, the peer index given by the route's PathID.
+func ribUnicast(p netip.Prefix, routes ...*fs.UnicastRoute) *Record {
+	subtype := uint16(SubtypeRIBIPv4Unicast)
+	if p.Addr().Is6() {
+		subtype = SubtypeRIBIPv6Unicast
+	}
+	b := append([]byte{0, 0, 0, 0, byte(p.Bits())}, p.Addr().AsSlice()[:(p.Bits()+7)/8]...)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(routes)))
+	for _, r := range routes {
+		attrs := encodeAttrs(&fs.FlowSpecRoute{ASPath: r.ASPath, OriginatorID: r.OriginatorID})
+		b = binary.BigEndian.AppendUint16(b, uint16(r.PathID))
+		b = binary.BigEndian.AppendUint32(b, 1700000000)
+		b = binary.BigEndian.AppendUint16(b, uint16(len(attrs)))
+		b = append(b, attrs...)
+	}
+	return &Record{Type: TypeTableDumpV2, Subtype: subtype, Body: b}
+}
+
+func TestReadUnicast(t *testing.T) {
+	s := &Snapshot{Peers: []Peer{
+		{Address: netip.MustParseAddr("192.0.2.1"), AS: 64500},
+		{Address: netip.MustParseAddr("192.0.2.2"), AS: 64501},
+	}}
+	v4, v6 := netip.MustParsePrefix("198.51.100.0/24"), netip.MustParsePrefix("2001:db8::/32")
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	for _, rec := range []*Record{
+		{Type: TypeTableDumpV2, Subtype: SubtypePeerIndexTable, Body: s.encodePeerIndex()},
+		ribUnicast(v6, &fs.UnicastRoute{PathID: 1, ASPath: []uint32{64501, 64510}}),
+		ribUnicast(v4,
+			&fs.UnicastRoute{PathID: 0, ASPath: []uint32{64500, 64502, 64510}},
+			&fs.UnicastRoute{PathID: 1, ASPath: []uint32{64501, 64510}, OriginatorID: netip.MustParseAddr("192.0.2.9")}),
+		{Type: TypeBGP4MP, Subtype: SubtypeBGP4MPMessageAS4},
+	} {
+		if err := w.Write(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		opts *UnicastOptions
+		want []*fs.UnicastRoute
+	}{
+		{
+			name: "ShortestPath",
+			want: []*fs.UnicastRoute{
+				{Prefix: v4, NeighborAS: 64501, ASPath: []uint32{64501, 64510}, OriginatorID: netip.MustParseAddr("192.0.2.9")},
+				{Prefix: v6, NeighborAS: 64501, ASPath: []uint32{64501, 64510}},
+			},
+		},
+		{
+			name: "Peer",
+			opts: &UnicastOptions{Peer: func(p Peer) bool { return p.AS == 64500 }},
+			want: []*fs.UnicastRoute{{Prefix: v4, NeighborAS: 64500, ASPath: []uint32{64500, 64502, 64510}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReadUnicast(bytes.NewReader(buf.Bytes()), tt.opts)
+			if err != nil {
+				t.Fatalf("ReadUnicast() error = %v, want <nil>", err)
+			}
+			if !slices.EqualFunc(got, tt.want, func(a, b *fs.UnicastRoute) bool {
+				return a.Prefix == b.Prefix && a.NeighborAS == b.NeighborAS && slices.Equal(a.ASPath, b.ASPath) && a.OriginatorID == b.OriginatorID
+			}) {
+				t.Errorf("ReadUnicast() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	idx := rib.NewTrie()
+	if err := LoadUnicast(bytes.NewReader(buf.Bytes()), idx, nil); err != nil {
+		t.Fatalf("LoadUnicast() error = %v, want <nil>", err)
+	}
+	if best := idx.BestPath(netip.MustParsePrefix("198.51.100.128/25")); best == nil || best.NeighborAS != 64501 {
+		t.Errorf("BestPath() = %v, want the route from AS64501", best)
+	}
+
+	var noPeers bytes.Buffer
+	NewWriter(&noPeers).Write(ribUnicast(v4, &fs.UnicastRoute{}))
+	if _, err := ReadUnicast(&noPeers, nil); !errors.Is(err, ErrNoPeerIndex) {
+		t.Errorf("ReadUnicast() error = %v, want %v", err, ErrNoPeerIndex)
+	}
+}
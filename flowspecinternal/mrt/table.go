@@ -0,0 +1,390 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package mrt
+
+import (
+	"encoding/binary"
+	"io"
+	"net/netip"
+	"time"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/bgp"
+)
+
+// Peer is an entry of the PEER_INDEX_TABLE (RFC6396 4.3.1).
+type Peer struct {
+	BGPID   netip.Addr
+	Address netip.Addr
+	AS      uint32
+}
+
+// TableRoute is one FlowSpec route of a snapshot.
+type TableRoute struct {
+	// Peer indexes Snapshot.Peers.
+	Peer       int
+	Originated time.Time
+	Route      *fs.FlowSpecRoute
+}
+
+// Snapshot is a FlowSpec RIB dump.
+type Snapshot struct {
+	Collector netip.Addr
+	View      string
+	Peers     []Peer
+	Routes    []TableRoute
+}
+
+// ReadOptions configures ReadSnapshot.
+type ReadOptions struct {
+	// LocalAS is the AS of the collector; MRT does not record it. Routes
+	// from peers in another AS are marked FromEBGP.
+	LocalAS uint32
+}
+
+// Peer index table peer type bits.
+const (
+	peerIPv6 = 0x01
+	peerAS4  = 0x02
+)
+
+// mpReachAbbreviated returns the MP_REACH_NLRI of a RIB entry: only the next
+// hop length and next hop are kept (RFC6396 4.3.4), and FlowSpec routes
+// rarely have a next hop.
+func mpReachAbbreviated(nh netip.Addr) []byte {
+	if !nh.IsValid() {
+		return []byte{0}
+	}
+	if nh.Is4In6() {
+		nh = nh.Unmap()
+	}
+	return append([]byte{byte(nh.BitLen() / 8)}, nh.AsSlice()...)
+}
+
+// ReadSnapshot reads the FlowSpec routes of a TABLE_DUMP_V2 dump from r.
+// Records of other types and RIB_GENERIC records of other families are skipped.
+func ReadSnapshot(r io.Reader, opts *ReadOptions) (*Snapshot, error) {
+	var o ReadOptions
+	if opts != nil {
+		o = *opts
+	}
+	var (
+		s         Snapshot
+		havePeers bool
+	)
+	mr := NewReader(r)
+	for {
+		rec, err := mr.Next()
+		if err == io.EOF {
+			return &s, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if rec.Type != TypeTableDumpV2 {
+			continue
+		}
+		switch rec.Subtype {
+		case SubtypePeerIndexTable:
+			if err := s.parsePeerIndex(rec.Body); err != nil {
+				return nil, err
+			}
+			havePeers = true
+		case SubtypeRIBGeneric:
+			if !havePeers {
+				return nil, ErrNoPeerIndex
+			}
+			if err := s.parseRIBGeneric(rec.Body, o); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// routerID returns the BGP ID of p, the zero Addr if unset.
+func (p Peer) routerID() netip.Addr {
+	if p.BGPID.IsUnspecified() {
+		return netip.Addr{}
+	}
+	return p.BGPID
+}
+
+func (s *Snapshot) parsePeerIndex(b []byte) error {
+	if len(b) < 6 {
+		return ErrMalformed
+	}
+	s.Collector = netip.AddrFrom4([4]byte(b))
+	n := int(binary.BigEndian.Uint16(b[4:]))
+	b = b[6:]
+	if len(b) < n+2 {
+		return ErrMalformed
+	}
+	s.View = string(b[:n])
+	count := int(binary.BigEndian.Uint16(b[n:]))
+	b = b[n+2:]
+	s.Peers = make([]Peer, 0, count)
+	for range count {
+		if len(b) < 5 {
+			return ErrMalformed
+		}
+		typ := b[0]
+		p := Peer{BGPID: netip.AddrFrom4([4]byte(b[1:5]))}
+		afi := uint16(fs.AFIIPv4)
+		if typ&peerIPv6 != 0 {
+			afi = fs.AFIIPv6
+		}
+		var ok bool
+		if p.Address, b, ok = readAddr(b[5:], afi); !ok {
+			return ErrMalformed
+		}
+		if typ&peerAS4 != 0 {
+			if len(b) < 4 {
+				return ErrMalformed
+			}
+			p.AS, b = binary.BigEndian.Uint32(b), b[4:]
+		} else {
+			if len(b) < 2 {
+				return ErrMalformed
+			}
+			p.AS, b = uint32(binary.BigEndian.Uint16(b)), b[2:]
+		}
+		s.Peers = append(s.Peers, p)
+	}
+	return nil
+}
+
+func (s *Snapshot) parseRIBGeneric(b []byte, o ReadOptions) error {
+	if len(b) < 7 {
+		return ErrMalformed
+	}
+	afi, safi := binary.BigEndian.Uint16(b[4:]), b[6]
+	if (afi != fs.AFIIPv4 && afi != fs.AFIIPv6) || (safi != fs.SAFIFlowSpec && safi != fs.SAFIFlowSpecVPN) {
+		return nil
+	}
+	b = b[7:]
+	n, hdr, err := fs.ReadNLRILength(b)
+	if err != nil {
+		return err
+	}
+	if len(b) < hdr+n+2 {
+		return ErrMalformed
+	}
+	nlri := b[:hdr+n]
+	count := int(binary.BigEndian.Uint16(b[hdr+n:]))
+	b = b[hdr+n+2:]
+
+	for range count {
+		if len(b) < 8 {
+			return ErrMalformed
+		}
+		idx := int(binary.BigEndian.Uint16(b))
+		originated := time.Unix(int64(binary.BigEndian.Uint32(b[2:])), 0)
+		alen := int(binary.BigEndian.Uint16(b[6:]))
+		if len(b) < 8+alen {
+			return ErrMalformed
+		}
+		attrs := b[8 : 8+alen]
+		b = b[8+alen:]
+		if idx >= len(s.Peers) {
+			return ErrUnknownPeer
+		}
+
+		u, err := bgp.ParseUpdateBody(updateBody(attrs, afi, safi, nlri), &bgp.ParseOptions{
+			PeerAS:       s.Peers[idx].AS,
+			LocalAS:      o.LocalAS,
+			PeerRouterID: s.Peers[idx].routerID(),
+		})
+		if err != nil {
+			return err
+		}
+		if len(u.Announced) != 1 {
+			return ErrMalformed
+		}
+		s.Routes = append(s.Routes, TableRoute{Peer: idx, Originated: originated, Route: u.Announced[0]})
+	}
+	return nil
+}
+
+// updateBody rebuilds an UPDATE body from a RIB entry: the abbreviated
+// MP_REACH_NLRI is replaced by a full one carrying its next hop and nlri.
+func updateBody(attrs []byte, afi uint16, safi uint8, nlri []byte) []byte {
+	var out []byte
+	nh := []byte{0}
+	for len(attrs) >= 3 {
+		hdr, n := 3, int(attrs[2])
+		if attrs[0]&bgp.FlagExtLength != 0 && len(attrs) >= 4 {
+			hdr, n = 4, int(binary.BigEndian.Uint16(attrs[2:]))
+		}
+		if len(attrs) < hdr+n {
+			break // left to ParseUpdateBody to reject
+		}
+		if attrs[1] != bgp.AttrMPReachNLRI {
+			out = append(out, attrs[:hdr+n]...)
+		} else if v := attrs[hdr : hdr+n]; len(v) > 0 && len(v) == 1+int(v[0]) {
+			nh = v
+		}
+		attrs = attrs[hdr+n:]
+	}
+	out = append(out, attrs...)
+	mp := binary.BigEndian.AppendUint16(nil, afi)
+	mp = append(mp, safi)
+	mp = append(mp, nh...)
+	mp = append(mp, 0)
+	out = appendAttr(out, bgp.FlagOptional, bgp.AttrMPReachNLRI, append(mp, nlri...))
+
+	body := []byte{0, 0}
+	body = binary.BigEndian.AppendUint16(body, uint16(len(out)))
+	return append(body, out...)
+}
+
+func appendAttr(dst []byte, flags, code byte, v []byte) []byte {
+	if len(v) > 255 {
+		dst = append(dst, flags|bgp.FlagExtLength, code)
+		dst = binary.BigEndian.AppendUint16(dst, uint16(len(v)))
+	} else {
+		dst = append(dst, flags, code, byte(len(v)))
+	}
+	return append(dst, v...)
+}
+
+// WriteSnapshot writes s as a PEER_INDEX_TABLE followed by one RIB_GENERIC
+// record per distinct NLRI, all stamped with ts.
+func WriteSnapshot(w io.Writer, s *Snapshot, ts time.Time) error {
+	mw := NewWriter(w)
+	if err := mw.Write(&Record{Timestamp: ts, Type: TypeTableDumpV2, Subtype: SubtypePeerIndexTable, Body: s.encodePeerIndex()}); err != nil {
+		return err
+	}
+
+	type rib struct {
+		afi     uint16
+		safi    uint8
+		nlri    []byte
+		entries [][]byte
+	}
+	var (
+		ribs  []*rib
+		index = make(map[string]*rib)
+	)
+	for _, tr := range s.Routes {
+		if tr.Peer < 0 || tr.Peer >= len(s.Peers) {
+			return ErrUnknownPeer
+		}
+		r := tr.Route
+		if r.SAFI != fs.SAFIFlowSpec && r.SAFI != fs.SAFIFlowSpecVPN {
+			return ErrNotFlowSpec
+		}
+		nlri, err := encodeNLRI(r)
+		if err != nil {
+			return err
+		}
+		key := string(binary.BigEndian.AppendUint16([]byte{r.SAFI}, r.AFI)) + string(nlri)
+		rb, ok := index[key]
+		if !ok {
+			rb = &rib{afi: r.AFI, safi: r.SAFI, nlri: nlri}
+			index[key] = rb
+			ribs = append(ribs, rb)
+		}
+		attrs := encodeAttrs(r)
+		e := binary.BigEndian.AppendUint16(nil, uint16(tr.Peer))
+		e = binary.BigEndian.AppendUint32(e, uint32(tr.Originated.Unix()))
+		e = binary.BigEndian.AppendUint16(e, uint16(len(attrs)))
+		rb.entries = append(rb.entries, append(e, attrs...))
+	}
+
+	for seq, rb := range ribs {
+		b := binary.BigEndian.AppendUint32(nil, uint32(seq))
+		b = binary.BigEndian.AppendUint16(b, rb.afi)
+		b = append(b, rb.safi)
+		b = append(b, rb.nlri...)
+		b = binary.BigEndian.AppendUint16(b, uint16(len(rb.entries)))
+		for _, e := range rb.entries {
+			b = append(b, e...)
+		}
+		if err := mw.Write(&Record{Timestamp: ts, Type: TypeTableDumpV2, Subtype: SubtypeRIBGeneric, Body: b}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Snapshot) encodePeerIndex() []byte {
+	id := s.Collector
+	if !id.Is4() {
+		id = netip.IPv4Unspecified()
+	}
+	b := append([]byte(nil), id.AsSlice()...)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s.View)))
+	b = append(b, s.View...)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s.Peers)))
+	for _, p := range s.Peers {
+		typ := byte(peerAS4)
+		if p.Address.Is6() {
+			typ |= peerIPv6
+		}
+		bgpID := p.BGPID
+		if !bgpID.Is4() {
+			bgpID = netip.IPv4Unspecified()
+		}
+		b = append(b, typ)
+		b = append(b, bgpID.AsSlice()...)
+		b = append(b, p.Address.AsSlice()...)
+		b = binary.BigEndian.AppendUint32(b, p.AS)
+	}
+	return b
+}
+
+// encodeNLRI returns r's NLRI with its length field, prefixed by the RD for SAFI 134.
+func encodeNLRI(r *fs.FlowSpecRoute) ([]byte, error) {
+	comps, err := fs.EncodeComponents(r.Components, r.AFI)
+	if err != nil {
+		return nil, err
+	}
+	var value []byte
+	if r.SAFI == fs.SAFIFlowSpecVPN {
+		value = append(value, r.RD[:]...)
+	}
+	value = append(value, comps...)
+	out, err := fs.AppendNLRILength(nil, len(value))
+	if err != nil {
+		return nil, err
+	}
+	return append(out, value...), nil
+}
+
+// encodeAttrs returns the path attributes of a RIB entry. AS_PATH always uses
+// 4 octet ASNs in TABLE_DUMP_V2 (RFC6396 4.3.4).
+func encodeAttrs(r *fs.FlowSpecRoute) []byte {
+	attrs := appendAttr(nil, bgp.FlagTransitive, bgp.AttrOrigin, []byte{0})
+	var path []byte
+	for rest := r.ASPath; len(rest) > 0; {
+		seg := rest[:min(len(rest), 255)]
+		rest = rest[len(seg):]
+		path = append(path, 2, byte(len(seg))) // AS_SEQUENCE
+		for _, as := range seg {
+			path = binary.BigEndian.AppendUint32(path, as)
+		}
+	}
+	attrs = appendAttr(attrs, bgp.FlagTransitive, bgp.AttrASPath, path)
+	if r.OriginatorID.Is4() {
+		attrs = appendAttr(attrs, bgp.FlagOptional, bgp.AttrOriginatorID, r.OriginatorID.AsSlice())
+	}
+	var cl []byte
+	for _, id := range r.ClusterList {
+		if id.Unmap().Is4() {
+			cl = append(cl, id.Unmap().AsSlice()...)
+		}
+	}
+	if len(cl) > 0 {
+		attrs = appendAttr(attrs, bgp.FlagOptional, bgp.AttrClusterList, cl)
+	}
+	if len(r.ExtCommunities) > 0 {
+		var ec []byte
+		for _, c := range r.ExtCommunities {
+			ec = append(ec, c[:]...)
+		}
+		attrs = appendAttr(attrs, bgp.FlagOptional|bgp.FlagTransitive, bgp.AttrExtCommunities, ec)
+	}
+	return appendAttr(attrs, bgp.FlagOptional, bgp.AttrMPReachNLRI, mpReachAbbreviated(r.NextHop))
+}
@@ -0,0 +1,171 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package mrt
+
+import (
+	"encoding/binary"
+	"io"
+	"net/netip"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/bgp"
+	"floofspectools/flowspecinternal/rib"
+)
+
+// TABLE_DUMP_V2 subtypes of unicast RIBs (RFC6396 4.3, RFC8050 4).
+const (
+	SubtypeRIBIPv4Unicast        = 2
+	SubtypeRIBIPv6Unicast        = 4
+	SubtypeRIBIPv4UnicastAddPath = 8
+	SubtypeRIBIPv6UnicastAddPath = 10
+)
+
+// safiUnicast is the SAFI an UPDATE is rebuilt with for a unicast RIB entry.
+const safiUnicast = 1
+
+// UnicastOptions configures ReadUnicast.
+type UnicastOptions struct {
+	// Peer selects the peers whose routes are read, e.g. the one router
+	// whose view rules are validated against. Nil reads all peers.
+	Peer func(Peer) bool
+}
+
+// ReadUnicast reads the unicast routes of a TABLE_DUMP_V2 dump, such as the
+// RIB files of route-views or RIPE RIS, from r. Of the routes several peers
+// have for a prefix it keeps the one with the shortest AS_PATH, the first
+// peer of the index on ties, as a dump carries no LOCAL_PREF to select by.
+// The routes are returned in rib.SortRoutes order, ready for BulkLoad.
+//
+// Entries whose attributes bgp.ParseUpdateBody would treat as withdraw are
+// skipped.
+func ReadUnicast(r io.Reader, opts *UnicastOptions) ([]*fs.UnicastRoute, error) {
+	var o UnicastOptions
+	if opts != nil {
+		o = *opts
+	}
+	var (
+		s         Snapshot
+		havePeers bool
+		routes    []*fs.UnicastRoute
+		index     = make(map[netip.Prefix]int)
+	)
+	mr := NewReader(r)
+	for {
+		rec, err := mr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if rec.Type != TypeTableDumpV2 {
+			continue
+		}
+		afi, addPath := fs.AFIIPv4, false
+		switch rec.Subtype {
+		case SubtypePeerIndexTable:
+			if err := s.parsePeerIndex(rec.Body); err != nil {
+				return nil, err
+			}
+			havePeers = true
+			continue
+		case SubtypeRIBIPv4Unicast:
+		case SubtypeRIBIPv6Unicast:
+			afi = fs.AFIIPv6
+		case SubtypeRIBIPv4UnicastAddPath:
+			addPath = true
+		case SubtypeRIBIPv6UnicastAddPath:
+			afi, addPath = fs.AFIIPv6, true
+		default:
+			continue
+		}
+		if !havePeers {
+			return nil, ErrNoPeerIndex
+		}
+		best, err := s.parseRIBUnicast(rec.Body, afi, addPath, o)
+		if err != nil {
+			return nil, err
+		}
+		if best == nil {
+			continue
+		}
+		if i, ok := index[best.Prefix]; !ok {
+			index[best.Prefix] = len(routes)
+			routes = append(routes, best)
+		} else if len(best.ASPath) < len(routes[i].ASPath) {
+			routes[i] = best
+		}
+	}
+	rib.SortRoutes(routes)
+	return routes, nil
+}
+
+// LoadUnicast reads the unicast routes of a TABLE_DUMP_V2 dump with
+// ReadUnicast and bulk loads them into idx.
+func LoadUnicast(r io.Reader, idx rib.Index, opts *UnicastOptions) error {
+	routes, err := ReadUnicast(r, opts)
+	if err != nil {
+		return err
+	}
+	return idx.BulkLoad(routes)
+}
+
+// parseRIBUnicast returns the route with the shortest AS_PATH among the
+// entries of a RIB_IPV4_UNICAST or RIB_IPV6_UNICAST record and their Add-Path
+// variants, nil if no entry is from a selected peer.
+func (s *Snapshot) parseRIBUnicast(b []byte, afi uint16, addPath bool, o UnicastOptions) (*fs.UnicastRoute, error) {
+	if len(b) < 5 {
+		return nil, ErrMalformed
+	}
+	n := (int(b[4]) + 7) / 8
+	if len(b) < 5+n+2 {
+		return nil, ErrMalformed
+	}
+	nlri := b[4 : 5+n]
+	count := int(binary.BigEndian.Uint16(b[5+n:]))
+	b = b[5+n+2:]
+
+	entryLen := 8
+	if addPath {
+		entryLen = 12
+	}
+	var best *fs.UnicastRoute
+	for range count {
+		if len(b) < entryLen {
+			return nil, ErrMalformed
+		}
+		idx := int(binary.BigEndian.Uint16(b))
+		var pathID uint32
+		if addPath {
+			pathID = binary.BigEndian.Uint32(b[6:])
+		}
+		alen := int(binary.BigEndian.Uint16(b[entryLen-2:]))
+		if len(b) < entryLen+alen {
+			return nil, ErrMalformed
+		}
+		attrs := b[entryLen : entryLen+alen]
+		b = b[entryLen+alen:]
+		if idx >= len(s.Peers) {
+			return nil, ErrUnknownPeer
+		}
+		if o.Peer != nil && !o.Peer(s.Peers[idx]) {
+			continue
+		}
+
+		u, err := bgp.ParseUpdateBody(updateBody(attrs, afi, safiUnicast, nlri), &bgp.ParseOptions{PeerAS: s.Peers[idx].AS, PeerRouterID: s.Peers[idx].routerID()})
+		if u == nil {
+			return nil, err
+		}
+		if len(u.Reachable) != 1 {
+			continue
+		}
+		r := u.Reachable[0]
+		r.PathID = pathID
+		if best == nil || len(r.ASPath) < len(best.ASPath) {
+			best = r
+		}
+	}
+	return best, nil
+}
@@ -0,0 +1,202 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package flowspecinternal
+
+import (
+	"net/netip"
+)
+
+var (
+	ErrMalformedNLRI     = NewError(StageDecode, "malformed-nlri", "RFC8955 4", "flowspec: NLRI malformed: truncated, unknown component type or components out of order (RFC8955 4)")
+	ErrUnsupportedOffset = NewError(StageDecode, "unsupported-offset", "RFC8956 3.1", "flowspec: NLRI unsupported: IPv6 prefix component with non-zero offset (RFC8956 3.1)")
+	ErrNLRITooLong       = NewError(StageDecode, "nlri-too-long", "RFC8955 4.1", "flowspec: NLRI exceeds 4095 bytes (RFC8955 4.1)")
+	ErrFamilyMismatch    = NewError(StageDecode, "prefix-family-mismatch", "RFC8956 3", "flowspec: prefix component address family does not match AFI")
+)
+
+// Address family and subsequent address family identifiers of FlowSpec.
+const (
+	AFIIPv4 uint16 = 1
+	AFIIPv6 uint16 = 2
+
+	SAFIFlowSpec    uint8 = 133
+	SAFIFlowSpecVPN uint8 = 134
+)
+
+// maxNLRILength is the largest length the 2 octet NLRI length field can carry.
+const maxNLRILength = 0x0fff
+
+// ReadNLRILength decodes the NLRI length field as per RFC8955 4.1.
+// It returns the length of the NLRI value and of the length field itself.
+func ReadNLRILength(b []byte) (length, hdr int, err error) {
+	if len(b) < 1 {
+		return 0, 0, ErrMalformedNLRI
+	}
+	if b[0]&0xf0 != 0xf0 {
+		return int(b[0]), 1, nil
+	}
+	if len(b) < 2 {
+		return 0, 0, ErrMalformedNLRI
+	}
+	return int(b[0]&0x0f)<<8 | int(b[1]), 2, nil
+}
+
+// AppendNLRILength appends the length field for an NLRI value of n bytes.
+func AppendNLRILength(dst []byte, n int) ([]byte, error) {
+	switch {
+	case n > maxNLRILength:
+		return nil, ErrNLRITooLong
+	case n < 240:
+		return append(dst, byte(n)), nil
+	}
+	return append(dst, 0xf0|byte(n>>8), byte(n)), nil
+}
+
+// DecodeNLRI decodes one length-prefixed SAFI 133 NLRI and returns the bytes consumed.
+func DecodeNLRI(b []byte, afi uint16) (FSComponentList, int, error) {
+	n, hdr, err := ReadNLRILength(b)
+	if err != nil {
+		return FSComponentList{}, 0, err
+	}
+	if len(b) < hdr+n {
+		return FSComponentList{}, 0, ErrMalformedNLRI
+	}
+	l, err := DecodeComponents(b[hdr:hdr+n], afi)
+	if err != nil {
+		return FSComponentList{}, 0, err
+	}
+	return l, hdr + n, nil
+}
+
+// EncodeNLRI encodes l as one length-prefixed SAFI 133 NLRI.
+func EncodeNLRI(l FSComponentList, afi uint16) ([]byte, error) {
+	body, err := EncodeComponents(l, afi)
+	if err != nil {
+		return nil, err
+	}
+	out, err := AppendNLRILength(make([]byte, 0, len(body)+2), len(body))
+	if err != nil {
+		return nil, err
+	}
+	return append(out, body...), nil
+}
+
+// DecodeComponents decodes the components of an NLRI value, without length field.
+// Component types must be strictly increasing as per RFC8955 4.2. For AFIL2VPN
+// the Ethernet components are accepted as well and prefix components are not.
+func DecodeComponents(b []byte, afi uint16) (FSComponentList, error) {
+	// one allocation for the components and one for all their values;
+	// every component takes at least 2 bytes
+	var l FSComponentList
+	if len(b) > 0 {
+		l.Components = make([]FSComponent, 0, min(len(b)/2, 8))
+	}
+	buf := make([]byte, 0, len(b))
+	value := func(v []byte) []byte {
+		buf = append(buf, v...)
+		return buf[len(buf)-len(v) : len(buf) : len(buf)]
+	}
+	for len(b) > 0 {
+		t := ComponentType(b[0])
+		if !t.validFor(afi) {
+			return FSComponentList{}, ErrMalformedNLRI
+		}
+		if n := len(l.Components); n > 0 && l.Components[n-1].Type >= t {
+			return FSComponentList{}, ErrMalformedNLRI
+		}
+		b = b[1:]
+
+		c := FSComponent{Type: t}
+		if t == ComponentTypeDestinationPrefix || t == ComponentTypeSourcePrefix {
+			p, n, err := decodePrefix(b, afi)
+			if err != nil {
+				return FSComponentList{}, err
+			}
+			c.Prefix = &p
+			b = b[n:]
+		} else if t.IsMAC() {
+			n, err := scanMAC(b)
+			if err != nil {
+				return FSComponentList{}, ErrMalformedNLRI
+			}
+			c.Raw = value(b[:n])
+			b = b[n:]
+		} else {
+			n, err := scanOps(b, nil)
+			if err != nil {
+				return FSComponentList{}, ErrMalformedNLRI
+			}
+			c.Raw = value(b[:n])
+			b = b[n:]
+		}
+		l.Components = append(l.Components, c)
+	}
+	return l, nil
+}
+
+// decodePrefix decodes a prefix component value: RFC8955 4.2.2.1 for IPv4,
+// RFC8956 3.1 (length, offset, pattern) for IPv6.
+func decodePrefix(b []byte, afi uint16) (netip.Prefix, int, error) {
+	if len(b) < 1 {
+		return netip.Prefix{}, 0, ErrMalformedNLRI
+	}
+	bits, hdr, size := int(b[0]), 1, 4
+	if afi == AFIIPv6 {
+		if len(b) < 2 {
+			return netip.Prefix{}, 0, ErrMalformedNLRI
+		}
+		if b[1] != 0 {
+			return netip.Prefix{}, 0, ErrUnsupportedOffset
+		}
+		hdr, size = 2, 16
+	} else if afi != AFIIPv4 {
+		return netip.Prefix{}, 0, ErrFamilyMismatch
+	}
+	n := (bits + 7) / 8
+	if bits > size*8 || len(b) < hdr+n {
+		return netip.Prefix{}, 0, ErrMalformedNLRI
+	}
+	var a [16]byte
+	copy(a[:], b[hdr:hdr+n])
+	addr := netip.AddrFrom16(a)
+	if afi == AFIIPv4 {
+		addr = netip.AddrFrom4([4]byte(a[:4]))
+	}
+	return netip.PrefixFrom(addr, bits).Masked(), hdr + n, nil
+}
+
+// EncodeComponents encodes the components of l, without length field, in the order given.
+// Components whose Raw is not exactly one value return ErrMalformedNLRI.
+func EncodeComponents(l FSComponentList, afi uint16) ([]byte, error) {
+	var out []byte
+	for _, c := range l.Components {
+		out = append(out, byte(c.Type))
+		if c.Type != ComponentTypeDestinationPrefix && c.Type != ComponentTypeSourcePrefix {
+			// refuse values DecodeComponents would reject, such as raw
+			// operators without the end-of-list bit
+			scan := func(b []byte) (int, error) { return scanOps(b, nil) }
+			if c.Type.IsMAC() {
+				scan = scanMAC
+			}
+			if n, err := scan(c.Raw); err != nil || n != len(c.Raw) {
+				return nil, ErrMalformedNLRI
+			}
+			out = append(out, c.Raw...)
+			continue
+		}
+		if c.Prefix == nil {
+			return nil, ErrMalformedNLRI
+		}
+		p := c.Prefix.Masked()
+		if p.Addr().Is6() != (afi == AFIIPv6) || afi == AFIL2VPN {
+			return nil, ErrFamilyMismatch
+		}
+		out = append(out, byte(p.Bits()))
+		if afi == AFIIPv6 {
+			out = append(out, 0) // offset
+		}
+		out = append(out, p.Addr().AsSlice()[:(p.Bits()+7)/8]...)
+	}
+	return out, nil
+}
@@ -0,0 +1,150 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package flowspecinternal
+
+import (
+	"bytes"
+	"errors"
+	"net/netip"
+	"testing"
+)
+
+func TestDecodeNLRI(t *testing.T) {
+	tests := []struct {
+		name    string
+		afi     uint16
+		raw     []byte
+		want    string // canonical form
+		wantN   int
+		wantErr error
+	}{
+		{
+			// RFC8955 4.3 example 1: destination 192.0.2.0/24, ip protocol tcp, port 25
+			name:  "RFC8955Example1",
+			afi:   AFIIPv4,
+			raw:   []byte{0x0b, 0x01, 0x18, 0xc0, 0x00, 0x02, 0x03, 0x81, 0x06, 0x04, 0x81, 0x19},
+			want:  "dst=192.0.2.0/24 proto=6 port=25",
+			wantN: 12,
+		},
+		{
+			name:  "IPv6DstAndSrc",
+			afi:   AFIIPv6,
+			raw:   []byte{0x0d, 0x01, 0x20, 0x00, 0x20, 0x01, 0x0d, 0xb8, 0x02, 0x00, 0x00, 0x03, 0x81, 0x06, 0xff},
+			want:  "dst=2001:db8::/32 src=::/0 proto=6",
+			wantN: 14,
+		},
+		{name: "Truncated", afi: AFIIPv4, raw: []byte{0x05, 0x01, 0x18, 0xc0}, wantErr: ErrMalformedNLRI},
+		{name: "OutOfOrder", afi: AFIIPv4, raw: []byte{0x06, 0x04, 0x81, 0x19, 0x03, 0x81, 0x06}, wantErr: ErrMalformedNLRI},
+		{name: "Duplicate", afi: AFIIPv4, raw: []byte{0x06, 0x03, 0x81, 0x06, 0x03, 0x81, 0x11}, wantErr: ErrMalformedNLRI},
+		{name: "UnknownType", afi: AFIIPv4, raw: []byte{0x03, 0x0d, 0x81, 0x00}, wantErr: ErrMalformedNLRI},
+		{name: "NoEndOfList", afi: AFIIPv4, raw: []byte{0x03, 0x03, 0x01, 0x06}, wantErr: ErrMalformedNLRI},
+		{name: "PrefixTooLong", afi: AFIIPv4, raw: []byte{0x07, 0x01, 0x21, 0xc0, 0x00, 0x02, 0x00, 0x00}, wantErr: ErrMalformedNLRI},
+		{name: "IPv6Offset", afi: AFIIPv6, raw: []byte{0x05, 0x01, 0x20, 0x08, 0x0d, 0xb8}, wantErr: ErrUnsupportedOffset},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, n, err := DecodeNLRI(tt.raw, tt.afi)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("DecodeNLRI(%x) error = %v, want %v", tt.raw, err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := l.Canonical(nil); got != tt.want || n != tt.wantN {
+				t.Errorf("DecodeNLRI(%x) = %q, %d, want %q, %d", tt.raw, got, n, tt.want, tt.wantN)
+			}
+		})
+	}
+}
+
+func TestEncodeNLRIRoundTrip(t *testing.T) {
+	dst := netip.MustParsePrefix("192.0.2.0/24")
+	v6 := netip.MustParsePrefix("2001:db8:1::/48")
+	tests := []struct {
+		name string
+		afi  uint16
+		list FSComponentList
+	}{
+		{
+			name: "IPv4",
+			afi:  AFIIPv4,
+			list: FSComponentList{Components: []FSComponent{
+				{Type: ComponentTypeDestinationPrefix, Prefix: &dst},
+				{Type: ComponentTypeIpProtocol, Raw: []byte{0x81, 0x06}},
+				{Type: ComponentTypePort, Raw: []byte{0x81, 0x19}},
+			}},
+		},
+		{
+			name: "IPv6",
+			afi:  AFIIPv6,
+			list: FSComponentList{Components: []FSComponent{
+				{Type: ComponentTypeSourcePrefix, Prefix: &v6},
+				{Type: ComponentTypeFragment, Raw: []byte{0x80, 0x02}},
+			}},
+		},
+		{
+			// 120 two byte port values need the 2 octet length field
+			name: "LongLength",
+			afi:  AFIIPv4,
+			list: FSComponentList{Components: []FSComponent{
+				{Type: ComponentTypeDestinationPort, Raw: EncodeNumericOps(manyPorts(120))},
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := EncodeNLRI(tt.list, tt.afi)
+			if err != nil {
+				t.Fatalf("EncodeNLRI() error = %v, want <nil>", err)
+			}
+			got, n, err := DecodeNLRI(b, tt.afi)
+			if err != nil || n != len(b) {
+				t.Fatalf("DecodeNLRI(%x) = %d, %v, want %d, <nil>", b, n, err, len(b))
+			}
+			if got.Canonical(nil) != tt.list.Canonical(nil) {
+				t.Errorf("DecodeNLRI(EncodeNLRI(%v)) = %v", tt.list, got)
+			}
+			again, _ := EncodeNLRI(got, tt.afi)
+			if !bytes.Equal(again, b) {
+				t.Errorf("EncodeNLRI() not stable: %x != %x", again, b)
+			}
+		})
+	}
+}
+
+func manyPorts(n int) []NumericOp {
+	ops := make([]NumericOp, n)
+	for i := range ops {
+		ops[i] = NumericOp{EQ: true, Value: uint64(1000 + i)}
+	}
+	return ops
+}
+
+func TestEncodeNLRIErrors(t *testing.T) {
+	v6 := netip.MustParsePrefix("2001:db8::/32")
+	tests := []struct {
+		name    string
+		list    FSComponentList
+		wantErr error
+	}{
+		{
+			name:    "FamilyMismatch",
+			list:    FSComponentList{Components: []FSComponent{{Type: ComponentTypeDestinationPrefix, Prefix: &v6}}},
+			wantErr: ErrFamilyMismatch,
+		},
+		{
+			name:    "TooLong",
+			list:    FSComponentList{Components: []FSComponent{{Type: ComponentTypeDestinationPort, Raw: EncodeNumericOps(manyPorts(1400))}}},
+			wantErr: ErrNLRITooLong,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := EncodeNLRI(tt.list, AFIIPv4); !errors.Is(err, tt.wantErr) {
+				t.Errorf("EncodeNLRI() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
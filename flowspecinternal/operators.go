@@ -0,0 +1,326 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package flowspecinternal
+
+import (
+	"slices"
+	"sort"
+)
+
+var (
+	ErrMalformedOperators = NewError(StageDecode, "malformed-operators", "RFC8955 4.2.1", "flowspec: component discarded: malformed {operator, value} sequence (RFC8955 4.2.1)")
+)
+
+// Operator byte bits shared by numeric and bitmask operators as per RFC8955 4.2.1.
+const (
+	opEndOfList = 0x80
+	opAnd       = 0x40
+	opLenMask   = 0x30
+
+	opLT = 0x04
+	opGT = 0x02
+	opEQ = 0x01
+
+	opNot   = 0x02
+	opMatch = 0x01
+)
+
+// NumericOp is a single {operator, value} pair of a numeric component
+// as per RFC8955 4.2.1.1.
+type NumericOp struct {
+	And   bool
+	LT    bool
+	GT    bool
+	EQ    bool
+	Value uint64
+}
+
+// BitmaskOp is a single {operator, value} pair of a bitmask component
+// as per RFC8955 4.2.1.2.
+type BitmaskOp struct {
+	And   bool
+	Not   bool
+	Match bool
+	Value uint64
+}
+
+// ValueRange is an inclusive range of component values.
+type ValueRange struct {
+	From uint64
+	To   uint64
+}
+
+// scanOps walks a {operator, value} sequence and calls fn for every pair.
+// It returns the number of bytes consumed up to and including the pair with the end-of-list bit.
+func scanOps(raw []byte, fn func(op byte, value uint64)) (int, error) {
+	i := 0
+	for i < len(raw) {
+		op := raw[i]
+		vlen := 1 << ((op & opLenMask) >> 4)
+		if i+1+vlen > len(raw) {
+			return 0, ErrMalformedOperators
+		}
+		var v uint64
+		for _, b := range raw[i+1 : i+1+vlen] {
+			v = v<<8 | uint64(b)
+		}
+		if fn != nil {
+			fn(op, v)
+		}
+		i += 1 + vlen
+		if op&opEndOfList != 0 {
+			return i, nil
+		}
+	}
+	return 0, ErrMalformedOperators
+}
+
+// ParseNumericOps decodes a numeric operator sequence. raw must hold exactly one sequence.
+func ParseNumericOps(raw []byte) ([]NumericOp, error) {
+	var ops []NumericOp
+	n, err := scanOps(raw, func(op byte, v uint64) {
+		ops = append(ops, NumericOp{
+			// RFC8955: the AND bit of the first operator MUST be treated as unset
+			And:   len(ops) > 0 && op&opAnd != 0,
+			LT:    op&opLT != 0,
+			GT:    op&opGT != 0,
+			EQ:    op&opEQ != 0,
+			Value: v,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	if n != len(raw) {
+		return nil, ErrMalformedOperators
+	}
+	return ops, nil
+}
+
+// ParseBitmaskOps decodes a bitmask operator sequence. raw must hold exactly one sequence.
+func ParseBitmaskOps(raw []byte) ([]BitmaskOp, error) {
+	var ops []BitmaskOp
+	n, err := scanOps(raw, func(op byte, v uint64) {
+		ops = append(ops, BitmaskOp{
+			And:   len(ops) > 0 && op&opAnd != 0,
+			Not:   op&opNot != 0,
+			Match: op&opMatch != 0,
+			Value: v,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	if n != len(raw) {
+		return nil, ErrMalformedOperators
+	}
+	return ops, nil
+}
+
+// encodeOp appends one operator byte plus the shortest value encoding.
+func encodeOp(dst []byte, op byte, v uint64) []byte {
+	var vlen int
+	switch {
+	case v <= 0xff:
+		vlen = 1
+	case v <= 0xffff:
+		vlen = 2
+		op |= 0x10
+	case v <= 0xffffffff:
+		vlen = 4
+		op |= 0x20
+	default:
+		vlen = 8
+		op |= 0x30
+	}
+	dst = append(dst, op)
+	for i := vlen - 1; i >= 0; i-- {
+		dst = append(dst, byte(v>>(8*i)))
+	}
+	return dst
+}
+
+// EncodeNumericOps encodes ops into their NLRI form, setting the end-of-list bit on the last pair.
+func EncodeNumericOps(ops []NumericOp) []byte {
+	var out []byte
+	for i, o := range ops {
+		var op byte
+		if i == len(ops)-1 {
+			op |= opEndOfList
+		}
+		if o.And && i > 0 {
+			op |= opAnd
+		}
+		if o.LT {
+			op |= opLT
+		}
+		if o.GT {
+			op |= opGT
+		}
+		if o.EQ {
+			op |= opEQ
+		}
+		out = encodeOp(out, op, o.Value)
+	}
+	return out
+}
+
+// EncodeBitmaskOps encodes ops into their NLRI form, setting the end-of-list bit on the last pair.
+func EncodeBitmaskOps(ops []BitmaskOp) []byte {
+	var out []byte
+	for i, o := range ops {
+		var op byte
+		if i == len(ops)-1 {
+			op |= opEndOfList
+		}
+		if o.And && i > 0 {
+			op |= opAnd
+		}
+		if o.Not {
+			op |= opNot
+		}
+		if o.Match {
+			op |= opMatch
+		}
+		out = encodeOp(out, op, o.Value)
+	}
+	return out
+}
+
+// Ranges returns the values in [0, max] the single operator accepts.
+func (o NumericOp) Ranges(max uint64) []ValueRange {
+	v := o.Value
+	var out []ValueRange
+	if o.LT && v > 0 {
+		hi := v - 1
+		if o.EQ {
+			hi = v
+		}
+		out = append(out, ValueRange{From: 0, To: min(hi, max)})
+	} else if o.EQ && v <= max {
+		out = append(out, ValueRange{From: v, To: v})
+	}
+	if o.GT && v < max {
+		lo := v + 1
+		if o.EQ {
+			lo = v
+		}
+		out = append(out, ValueRange{From: lo, To: max})
+	}
+	return normalizeRanges(out)
+}
+
+// NumericRanges evaluates ops over [0, max] and returns the accepted values
+// as sorted, disjoint ranges. AND binds tighter than OR as per RFC8955 4.2.1.1.
+func NumericRanges(ops []NumericOp, max uint64) []ValueRange {
+	var (
+		out   []ValueRange
+		group []ValueRange
+	)
+	for i, o := range ops {
+		if i > 0 && !o.And {
+			out = append(out, group...)
+		}
+		if i == 0 || !o.And {
+			group = []ValueRange{{From: 0, To: max}}
+		}
+		group = intersectRanges(group, o.Ranges(max))
+	}
+	out = append(out, group...)
+	return normalizeRanges(out)
+}
+
+// SplitBitmaskOps splits ops into their OR-ed groups of AND-ed terms.
+func SplitBitmaskOps(ops []BitmaskOp) [][]BitmaskOp {
+	var out [][]BitmaskOp
+	for i, o := range ops {
+		if i == 0 || !o.And {
+			out = append(out, nil)
+		}
+		out[len(out)-1] = append(out[len(out)-1], o)
+	}
+	return out
+}
+
+// JoinBitmaskOps is the inverse of SplitBitmaskOps: it ORs groups of AND-ed
+// terms into one sequence, setting And on all but the first term of a group.
+func JoinBitmaskOps(groups ...[]BitmaskOp) []BitmaskOp {
+	var out []BitmaskOp
+	for _, g := range groups {
+		for i, o := range g {
+			o.And = i > 0
+			out = append(out, o)
+		}
+	}
+	return out
+}
+
+// MatchBitmaskOps reports whether v matches ops: some group of AND-ed terms
+// has all its terms hold, as per RFC8955 4.2.1.2.
+func MatchBitmaskOps(ops []BitmaskOp, v uint64) bool {
+	for _, g := range SplitBitmaskOps(ops) {
+		if !slices.ContainsFunc(g, func(op BitmaskOp) bool { return bitmaskHit(op, v) == op.Not }) {
+			return true
+		}
+	}
+	return false
+}
+
+// BitmaskAny returns the term matching values with any of bits set.
+func BitmaskAny(bits uint64) BitmaskOp { return BitmaskOp{Value: bits} }
+
+// BitmaskNone returns the term matching values with none of bits set.
+func BitmaskNone(bits uint64) BitmaskOp { return BitmaskOp{Not: true, Value: bits} }
+
+// BitmaskAll returns the term matching values with all of bits set.
+func BitmaskAll(bits uint64) BitmaskOp { return BitmaskOp{Match: true, Value: bits} }
+
+// BitmaskNotAll returns the term matching values with some of bits unset.
+func BitmaskNotAll(bits uint64) BitmaskOp { return BitmaskOp{Not: true, Match: true, Value: bits} }
+
+// IntersectRanges returns the values in both a and b as sorted, disjoint ranges.
+func IntersectRanges(a, b []ValueRange) []ValueRange {
+	return intersectRanges(a, b)
+}
+
+// UnionRanges returns the values in any of sets as sorted, disjoint ranges.
+func UnionRanges(sets ...[]ValueRange) []ValueRange {
+	var out []ValueRange
+	for _, r := range sets {
+		out = append(out, r...)
+	}
+	return normalizeRanges(out)
+}
+
+func intersectRanges(a, b []ValueRange) []ValueRange {
+	var out []ValueRange
+	for _, x := range a {
+		for _, y := range b {
+			lo, hi := max(x.From, y.From), min(x.To, y.To)
+			if lo <= hi {
+				out = append(out, ValueRange{From: lo, To: hi})
+			}
+		}
+	}
+	return normalizeRanges(out)
+}
+
+// normalizeRanges sorts r and merges overlapping or adjacent ranges.
+func normalizeRanges(r []ValueRange) []ValueRange {
+	if len(r) == 0 {
+		return nil
+	}
+	sort.Slice(r, func(i, j int) bool { return r[i].From < r[j].From })
+	out := []ValueRange{r[0]}
+	for _, x := range r[1:] {
+		last := &out[len(out)-1]
+		if x.From <= last.To || x.From == last.To+1 {
+			last.To = max(last.To, x.To)
+			continue
+		}
+		out = append(out, x)
+	}
+	return out
+}
@@ -0,0 +1,152 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package flowspecinternal
+
+import (
+	"bytes"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestParseNumericOps(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     []byte
+		want    []NumericOp
+		wantErr error
+	}{
+		{
+			name: "SingleEq (proto udp)",
+			raw:  []byte{0x81, 0x11},
+			want: []NumericOp{{EQ: true, Value: 17}},
+		},
+		{
+			name: "TwoByteOr (port ==22 or ==443)",
+			raw:  []byte{0x11, 0x00, 0x16, 0x91, 0x01, 0xBB},
+			want: []NumericOp{{EQ: true, Value: 22}, {EQ: true, Value: 443}},
+		},
+		{
+			name: "AndRange (>=1024 and <=2048)",
+			raw:  []byte{0x13, 0x04, 0x00, 0xD5, 0x08, 0x00},
+			want: []NumericOp{{GT: true, EQ: true, Value: 1024}, {And: true, LT: true, EQ: true, Value: 2048}},
+		},
+		{
+			name:    "MissingEndOfList",
+			raw:     []byte{0x01, 0x11},
+			wantErr: ErrMalformedOperators,
+		},
+		{
+			name:    "TruncatedValue",
+			raw:     []byte{0x91, 0x01},
+			wantErr: ErrMalformedOperators,
+		},
+		{
+			name:    "TrailingBytes",
+			raw:     []byte{0x81, 0x11, 0x00},
+			wantErr: ErrMalformedOperators,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseNumericOps(tt.raw)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ParseNumericOps(%x) error = %v, want %v", tt.raw, err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("ParseNumericOps(%x) = %v, want %v", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncodeOpsRoundTrip(t *testing.T) {
+	numeric := []byte{0x13, 0x04, 0x00, 0xD5, 0x08, 0x00}
+	ops, err := ParseNumericOps(numeric)
+	if err != nil {
+		t.Fatalf("ParseNumericOps(%x) error = %v, want <nil>", numeric, err)
+	}
+	if got := EncodeNumericOps(ops); !bytes.Equal(got, numeric) {
+		t.Errorf("EncodeNumericOps(%v) = %x, want %x", ops, got, numeric)
+	}
+
+	bitmask := []byte{0x01, 0x02, 0xC2, 0x10}
+	bops, err := ParseBitmaskOps(bitmask)
+	if err != nil {
+		t.Fatalf("ParseBitmaskOps(%x) error = %v, want <nil>", bitmask, err)
+	}
+	want := []BitmaskOp{{Match: true, Value: 0x02}, {And: true, Not: true, Value: 0x10}}
+	if !slices.Equal(bops, want) {
+		t.Errorf("ParseBitmaskOps(%x) = %v, want %v", bitmask, bops, want)
+	}
+	if got := EncodeBitmaskOps(bops); !bytes.Equal(got, bitmask) {
+		t.Errorf("EncodeBitmaskOps(%v) = %x, want %x", bops, got, bitmask)
+	}
+}
+
+func TestNumericRanges(t *testing.T) {
+	tests := []struct {
+		name string
+		ops  []NumericOp
+		want []ValueRange
+	}{
+		{
+			name: "EqOrEq",
+			ops:  []NumericOp{{EQ: true, Value: 123}, {EQ: true, Value: 53}},
+			want: []ValueRange{{53, 53}, {123, 123}},
+		},
+		{
+			name: "AndRange",
+			ops:  []NumericOp{{GT: true, EQ: true, Value: 1024}, {And: true, LT: true, EQ: true, Value: 2048}},
+			want: []ValueRange{{1024, 2048}},
+		},
+		{
+			name: "AndBindsTighterThanOr",
+			ops: []NumericOp{
+				{EQ: true, Value: 80},
+				{GT: true, Value: 1000},
+				{And: true, LT: true, Value: 1003},
+			},
+			want: []ValueRange{{80, 80}, {1001, 1002}},
+		},
+		{
+			name: "NotEqual",
+			ops:  []NumericOp{{LT: true, GT: true, Value: 0}},
+			want: []ValueRange{{1, 65535}},
+		},
+		{
+			name: "False",
+			ops:  []NumericOp{{Value: 5}},
+			want: nil,
+		},
+		{
+			name: "AdjacentMerged",
+			ops:  []NumericOp{{LT: true, EQ: true, Value: 10}, {GT: true, Value: 10}},
+			want: []ValueRange{{0, 65535}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NumericRanges(tt.ops, 0xffff)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("NumericRanges(%v) = %v, want %v", tt.ops, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitBitmaskOps(t *testing.T) {
+	ops := []BitmaskOp{
+		{Match: true, Value: 0x02},
+		{And: true, Not: true, Value: 0x10},
+		{Value: 0x04},
+	}
+	got := SplitBitmaskOps(ops)
+	if len(got) != 2 || len(got[0]) != 2 || len(got[1]) != 1 {
+		t.Errorf("SplitBitmaskOps(%v) = %v, want 2 groups of sizes 2 and 1", ops, got)
+	}
+}
@@ -5,18 +5,26 @@
 package flowspecinternal
 
 import (
-	"sort"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+var (
+	ErrOrderingInvariant = errors.New("flowspec: CompareFlowSpecKey is not a strict weak ordering of the lists")
 )
 
 const (
-	AHasPrecedence int8 = -1
-	Equal          int8 = 0
-	BHasPrecedence int8 = 1
+	AHasPrecedence = -1
+	Equal          = 0
+	BHasPrecedence = 1
 )
 
 // CompareFlowSpecKey compares two FlowSpecKey instances according
-// to RFC8955 section 5.1 (ordering of Flow Specifications).
-func CompareFlowSpecKey(a, b FSComponentList) int8 {
+// to RFC8955 section 5.1 (ordering of Flow Specifications). It returns
+// AHasPrecedence, Equal or BHasPrecedence, so it can be passed to
+// slices.SortFunc and slices.BinarySearchFunc directly.
+func CompareFlowSpecKey(a, b FSComponentList) int {
 	alen := len(a.Components)
 	blen := len(b.Components)
 
@@ -56,13 +64,12 @@ func CompareFlowSpecKey(a, b FSComponentList) int8 {
 					return BHasPrecedence
 				}
 			}
-			if abits == bbits {
-				if aaddr.Less(baddr) {
-					return AHasPrecedence
-				}
-				if baddr.Less(aaddr) {
-					return BHasPrecedence
-				}
+			// equal or non-overlapping prefixes: the lowest IP value has precedence
+			if aaddr.Less(baddr) {
+				return AHasPrecedence
+			}
+			if baddr.Less(aaddr) {
+				return BHasPrecedence
 			}
 		} else {
 			araw := acomp.Raw
@@ -107,11 +114,69 @@ func CompareFlowSpecKey(a, b FSComponentList) int8 {
 	return Equal
 }
 
-// SortFlowSpecs sorts a slice of FlowSpecKey in-place as per RFC8955 section 5.1
+// SortFlowSpecs sorts a slice of FlowSpecKey in-place as per RFC8955 section 5.1.
+// The sort is stable and does not allocate.
 func SortFlowSpecs(list []FSComponentList) {
-	sort.Slice(list, func(i, j int) bool {
-		return CompareFlowSpecKey(list[i], list[j]) < 0
-	})
+	slices.SortStableFunc(list, CompareFlowSpecKey)
+}
+
+// InsertFlowSpec inserts l into list, which must be sorted as per RFC8955
+// section 5.1, after the lists of equal precedence, and returns the list.
+func InsertFlowSpec(list []FSComponentList, l FSComponentList) []FSComponentList {
+	i, found := slices.BinarySearchFunc(list, l, CompareFlowSpecKey)
+	for found && i < len(list) && CompareFlowSpecKey(list[i], l) == Equal {
+		i++
+	}
+	return slices.Insert(list, i, l)
+}
+
+// ValidateOrderingInvariants checks that CompareFlowSpecKey is a strict weak
+// ordering of lists, which sort.Slice and SortFlowSpecs rely on: every list
+// is Equal to itself, swapping the arguments negates the result and both
+// precedence and equality are transitive. It returns the first violation
+// wrapping ErrOrderingInvariant. It compares every triple of lists, so it is
+// meant for tests and debugging with small sets.
+func ValidateOrderingInvariants(lists []FSComponentList) error {
+	return validateOrdering(lists, CompareFlowSpecKey)
+}
+
+func validateOrdering(lists []FSComponentList, compare func(a, b FSComponentList) int) error {
+	n := len(lists)
+	cmp := make([]int, n*n)
+	for i := range lists {
+		for j := range lists {
+			cmp[i*n+j] = compare(lists[i], lists[j])
+		}
+	}
+	for i := range lists {
+		if cmp[i*n+i] != Equal {
+			return fmt.Errorf("%w: %v not equal to itself", ErrOrderingInvariant, lists[i])
+		}
+		for j := range lists {
+			if cmp[i*n+j] != -cmp[j*n+i] {
+				return fmt.Errorf("%w: %v vs %v is %d but reversed %d", ErrOrderingInvariant, lists[i], lists[j], cmp[i*n+j], cmp[j*n+i])
+			}
+		}
+	}
+	for i := range lists {
+		for j := range lists {
+			ij := cmp[i*n+j]
+			if ij == BHasPrecedence {
+				continue
+			}
+			for k := range lists {
+				jk := cmp[j*n+k]
+				if jk == BHasPrecedence {
+					continue
+				}
+				// i <= j <= k implies i <= k, strictly if either step is
+				if want := min(ij, jk); cmp[i*n+k] > want {
+					return fmt.Errorf("%w: %v, %v, %v are not transitive", ErrOrderingInvariant, lists[i], lists[j], lists[k])
+				}
+			}
+		}
+	}
+	return nil
 }
 
 // TODO: func KeyFromFlowSpecRoute(fs *FlowSpecRoute) (FlowSpecKey, error)
@@ -5,6 +5,8 @@
 package flowspecinternal
 
 import (
+	"errors"
+	"math/rand/v2"
 	"net/netip"
 	"slices"
 	"testing"
@@ -25,7 +27,7 @@ func TestCompareFSComponentList(t *testing.T) {
 		name   string
 		a      FSComponentList
 		b      FSComponentList
-		expect int8
+		expect int
 	}{
 		{
 			name: "MissingDestComponent_Loses (RFC8955 5.1 missing component)",
@@ -136,6 +138,26 @@ func TestCompareFSComponentList(t *testing.T) {
 			},
 			expect: AHasPrecedence, // X.0 < X.128
 		},
+		{
+			name: "DstPrefix_NonOverlapping_LowerIP_Wins (RFC8955 5.1 IP value rule)",
+			a: FSComponentList{
+				Components: []FSComponent{
+					{
+						Type:   ComponentTypeDestinationPrefix,
+						Prefix: mustPrefixPtr(t, "48.48.65.0/24"),
+					},
+				},
+			},
+			b: FSComponentList{
+				Components: []FSComponent{
+					{
+						Type:   ComponentTypeDestinationPrefix,
+						Prefix: mustPrefixPtr(t, "48.48.48.0/20"),
+					},
+				},
+			},
+			expect: BHasPrecedence, // more specific but not contained
+		},
 		{
 			name: "DstPrefix_Same_SrcPrefix_EqualLength_LowerIP_Wins (RFC8955 5.1 IP value rule)",
 			a: FSComponentList{
@@ -306,3 +328,86 @@ func TestSortFlowSpecs(t *testing.T) {
 		t.Errorf("SortFlowSpecs(%v) got = %v, want %v", list, got, want)
 	}
 }
+
+// randomList returns a list of random component types, with prefixes and
+// values drawn from small pools so that lists often share, contain or
+// overlap each other's components.
+func randomList(rng *rand.Rand) FSComponentList {
+	prefixes := []string{"10.0.0.0/8", "10.0.0.0/16", "10.1.0.0/16", "10.1.2.0/24", "10.128.0.0/9", "11.0.0.0/8", "0.0.0.0/0", "10.1.2.3/32"}
+	raws := [][]byte{{0x81, 0x06}, {0x81, 0x11}, {0x01, 0x06, 0x81, 0x11}, {0x03, 0x19, 0xc5, 0x50}, {0x91, 0x01, 0xbb}, {0x81}, {0x81, 0x06, 0x00}}
+	var l FSComponentList
+	for _, t := range []ComponentType{ComponentTypeDestinationPrefix, ComponentTypeSourcePrefix, ComponentTypeIpProtocol, ComponentTypePort, ComponentTypeDestinationPort, ComponentTypeDSCP} {
+		if rng.IntN(2) == 0 {
+			continue
+		}
+		c := FSComponent{Type: t}
+		if t == ComponentTypeDestinationPrefix || t == ComponentTypeSourcePrefix {
+			p := netip.MustParsePrefix(prefixes[rng.IntN(len(prefixes))])
+			c.Prefix = &p
+		} else {
+			c.Raw = raws[rng.IntN(len(raws))]
+		}
+		l.Components = append(l.Components, c)
+	}
+	return l
+}
+
+func TestValidateOrderingInvariants(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	for round := 0; round < 50; round++ {
+		lists := make([]FSComponentList, 40)
+		for i := range lists {
+			lists[i] = randomList(rng)
+		}
+		if err := ValidateOrderingInvariants(lists); err != nil {
+			t.Fatalf("round %d: %v", round, err)
+		}
+		SortFlowSpecs(lists)
+		for i := 1; i < len(lists); i++ {
+			if CompareFlowSpecKey(lists[i-1], lists[i]) == BHasPrecedence {
+				t.Fatalf("round %d: SortFlowSpecs left %v before %v", round, lists[i-1], lists[i])
+			}
+		}
+	}
+
+	// always preferring the first argument is not antisymmetric
+	one := mustParse(t, "proto tcp")
+	two := mustParse(t, "proto udp")
+	byArgs := func(_, _ FSComponentList) int { return AHasPrecedence }
+	if err := validateOrdering([]FSComponentList{one, two}, byArgs); !errors.Is(err, ErrOrderingInvariant) {
+		t.Errorf("validateOrdering(byArgs) error = %v, want %v", err, ErrOrderingInvariant)
+	}
+	// a cycle a < b < c < a
+	three := mustParse(t, "proto icmp")
+	rank := map[string]int{one.String(): 0, two.String(): 1, three.String(): 2}
+	cyclic := func(a, b FSComponentList) int {
+		switch (rank[b.String()] - rank[a.String()] + 3) % 3 {
+		case 0:
+			return Equal
+		case 1:
+			return AHasPrecedence
+		}
+		return BHasPrecedence
+	}
+	if err := validateOrdering([]FSComponentList{one, two, three}, cyclic); !errors.Is(err, ErrOrderingInvariant) {
+		t.Errorf("validateOrdering(cyclic) error = %v, want %v", err, ErrOrderingInvariant)
+	}
+}
+
+func TestInsertFlowSpec(t *testing.T) {
+	rules := benchRuleSet()[:2000]
+	var list []FSComponentList
+	for _, l := range rules {
+		list = InsertFlowSpec(list, l)
+	}
+	want := slices.Clone(rules)
+	SortFlowSpecs(want)
+	if len(list) != len(want) {
+		t.Fatalf("len = %d, want %d", len(list), len(want))
+	}
+	for i := range list {
+		if list[i].String() != want[i].String() {
+			t.Fatalf("list[%d] = %v, want %v", i, list[i], want[i])
+		}
+	}
+}
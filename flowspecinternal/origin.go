@@ -0,0 +1,78 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package flowspecinternal
+
+import (
+	"net/netip"
+)
+
+var (
+	ErrOriginUnauthorized = NewError(StagePolicy, "origin-unauthorized", "", "flowspec: NLRI rejected: announcing AS not authorized to originate destination prefix by RPKI/IRR origin database")
+)
+
+// OriginState is the outcome of route origin validation (RFC6811 2).
+type OriginState uint8
+
+const (
+	// OriginNotFound: no authorization covers the prefix.
+	OriginNotFound OriginState = iota
+	// OriginValid: an authorization covers the prefix and matches the AS
+	// and prefix length.
+	OriginValid
+	// OriginInvalid: authorizations cover the prefix but none matches.
+	OriginInvalid
+)
+
+func (s OriginState) String() string {
+	switch s {
+	case OriginValid:
+		return "valid"
+	case OriginInvalid:
+		return "invalid"
+	}
+	return "not-found"
+}
+
+// OriginAuthorizer decides whether an AS may originate a prefix, typically
+// from RPKI ROAs or IRR route objects. Implementations must be safe for
+// concurrent use.
+type OriginAuthorizer interface {
+	AuthorizeOrigin(prefix netip.Prefix, as uint32) OriginState
+}
+
+// AnnouncingAS returns the AS that originated fs: the last AS_PATH member,
+// or for an empty path from an eBGP neighbor the neighbor AS. Locally
+// originated and iBGP routes with an empty path have none.
+func (fs *FlowSpecRoute) AnnouncingAS() (uint32, bool) {
+	if n := len(fs.ASPath); n > 0 {
+		return fs.ASPath[n-1], true
+	}
+	if fs.FromEBGP && fs.NeighborAS != 0 {
+		return fs.NeighborAS, true
+	}
+	return 0, false
+}
+
+// checkOrigin rejects routes whose destination prefix the origin database
+// marks invalid for the announcing AS, and with cfg.RequireOriginValid also
+// those it does not know.
+func checkOrigin(fs *FlowSpecRoute, cfg *Config) error {
+	if cfg.OriginAuthorizer == nil || fs.DestPrefix == nil {
+		return nil
+	}
+	as, ok := fs.AnnouncingAS()
+	if !ok {
+		return nil
+	}
+	switch cfg.OriginAuthorizer.AuthorizeOrigin(fs.DestPrefix.Masked(), as) {
+	case OriginValid:
+		return nil
+	case OriginNotFound:
+		if !cfg.RequireOriginValid {
+			return nil
+		}
+	}
+	return ErrOriginUnauthorized
+}
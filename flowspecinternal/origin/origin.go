@@ -0,0 +1,294 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+// Package origin holds origin authorizations, RPKI validated ROA payloads or
+// IRR route objects, in a Table implementing fs.OriginAuthorizer:
+//
+//	vrps, err := origin.ReadVRPs(f) // rpki-client/Routinator JSON export
+//	t := origin.NewTable(vrps)
+//	cfg := &fs.Config{OriginAuthorizer: t}
+//
+// A Table may be replaced or updated while validation runs, e.g. from a
+// periodically refreshed VRP export or by the RTR client of the rtr
+// subpackage.
+package origin
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+
+	fs "floofspectools/flowspecinternal"
+)
+
+var (
+	ErrInvalidVRP = errors.New("origin: invalid validated ROA payload")
+)
+
+// VRP is a validated ROA payload (RFC6811 2): AS may originate Prefix and
+// its more-specifics up to MaxLength. An IRR route object is a VRP whose
+// MaxLength is the prefix length.
+type VRP struct {
+	Prefix    netip.Prefix
+	MaxLength uint8
+	AS        uint32
+}
+
+func (v VRP) String() string {
+	return fmt.Sprintf("%s-%d AS%d", v.Prefix, v.MaxLength, v.AS)
+}
+
+// Valid reports whether v is well formed: a masked prefix and a maximum
+// length between its length and the address size.
+func (v VRP) Valid() bool {
+	return v.Prefix.IsValid() && v.Prefix == v.Prefix.Masked() &&
+		int(v.MaxLength) >= v.Prefix.Bits() && int(v.MaxLength) <= v.Prefix.Addr().BitLen()
+}
+
+// Table is a set of VRPs indexed by prefix. The zero value is empty and
+// ready to use.
+type Table struct {
+	mu   sync.RWMutex
+	vrps map[netip.Prefix][]VRP
+	n    int
+}
+
+// NewTable returns a Table holding vrps; invalid ones are skipped.
+func NewTable(vrps []VRP) *Table {
+	t := &Table{}
+	t.Replace(vrps)
+	return t
+}
+
+// Replace discards the contents of t for vrps.
+func (t *Table) Replace(vrps []VRP) {
+	m := make(map[netip.Prefix][]VRP, len(vrps))
+	n := 0
+	for _, v := range vrps {
+		if v.Valid() && !contains(m[v.Prefix], v) {
+			m[v.Prefix] = append(m[v.Prefix], v)
+			n++
+		}
+	}
+	t.mu.Lock()
+	t.vrps, t.n = m, n
+	t.mu.Unlock()
+}
+
+func contains(vs []VRP, v VRP) bool {
+	for _, x := range vs {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+// Add inserts v, reporting false if it is invalid or already present.
+func (t *Table) Add(v VRP) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.add(v)
+}
+
+func (t *Table) add(v VRP) bool {
+	if !v.Valid() || contains(t.vrps[v.Prefix], v) {
+		return false
+	}
+	if t.vrps == nil {
+		t.vrps = map[netip.Prefix][]VRP{}
+	}
+	t.vrps[v.Prefix] = append(t.vrps[v.Prefix], v)
+	t.n++
+	return true
+}
+
+// Remove deletes v, reporting false if it was not present.
+func (t *Table) Remove(v VRP) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.remove(v)
+}
+
+func (t *Table) remove(v VRP) bool {
+	vs := t.vrps[v.Prefix]
+	for i, x := range vs {
+		if x == v {
+			vs = append(vs[:i:i], vs[i+1:]...)
+			if len(vs) == 0 {
+				delete(t.vrps, v.Prefix)
+			} else {
+				t.vrps[v.Prefix] = vs
+			}
+			t.n--
+			return true
+		}
+	}
+	return false
+}
+
+// Update applies withdraw, then announce, as one change: a concurrent
+// AuthorizeOrigin sees either none or all of it. Invalid VRPs are skipped.
+func (t *Table) Update(announce, withdraw []VRP) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, v := range withdraw {
+		t.remove(v)
+	}
+	for _, v := range announce {
+		t.add(v)
+	}
+}
+
+// Len returns the number of VRPs in t.
+func (t *Table) Len() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.n
+}
+
+// VRPs returns the contents of t in no particular order.
+func (t *Table) VRPs() []VRP {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	out := make([]VRP, 0, t.n)
+	for _, vs := range t.vrps {
+		out = append(out, vs...)
+	}
+	return out
+}
+
+// AuthorizeOrigin implements fs.OriginAuthorizer with the route origin
+// validation of RFC6811 2: VRPs covering prefix decide, a matching one makes
+// it valid.
+func (t *Table) AuthorizeOrigin(prefix netip.Prefix, as uint32) fs.OriginState {
+	prefix = prefix.Masked()
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	state := fs.OriginNotFound
+	for bits := prefix.Bits(); bits >= 0; bits-- {
+		p, _ := prefix.Addr().Prefix(bits)
+		for _, v := range t.vrps[p] {
+			// AS0 ROAs (RFC6483 4) cover but never match
+			if v.AS == as && as != 0 && prefix.Bits() <= int(v.MaxLength) {
+				return fs.OriginValid
+			}
+			state = fs.OriginInvalid
+		}
+	}
+	return state
+}
+
+type vrpsJSON struct {
+	ROAs []struct {
+		ASN       json.RawMessage `json:"asn"`
+		Prefix    string          `json:"prefix"`
+		MaxLength int             `json:"maxLength"`
+	} `json:"roas"`
+}
+
+// ReadVRPs reads the JSON VRP export of rpki-client, Routinator and
+// OctoRPKI: {"roas": [{"asn": "AS64500", "prefix": "192.0.2.0/24",
+// "maxLength": 24}]}. The AS may be a number or an "AS"-prefixed string.
+func ReadVRPs(r io.Reader) ([]VRP, error) {
+	var j vrpsJSON
+	if err := json.NewDecoder(r).Decode(&j); err != nil {
+		return nil, err
+	}
+	out := make([]VRP, 0, len(j.ROAs))
+	for _, roa := range j.ROAs {
+		as, err := parseAS(strings.Trim(string(roa.ASN), `"`))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidVRP, err)
+		}
+		p, err := netip.ParsePrefix(roa.Prefix)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidVRP, err)
+		}
+		v := VRP{Prefix: p, MaxLength: uint8(roa.MaxLength), AS: as}
+		if roa.MaxLength == 0 {
+			v.MaxLength = uint8(p.Bits())
+		}
+		if roa.MaxLength > 128 || !v.Valid() {
+			return nil, fmt.Errorf("%w: %s max length %d", ErrInvalidVRP, roa.Prefix, roa.MaxLength)
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+func parseAS(s string) (uint32, error) {
+	n, err := strconv.ParseUint(strings.TrimPrefix(strings.ToUpper(s), "AS"), 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid AS %q", s)
+	}
+	return uint32(n), nil
+}
+
+// ReadRouteObjects reads the route and route6 objects of an RPSL (RFC2622)
+// IRR database dump as VRPs with an exact-match maximum length. Objects are
+// separated by blank lines; other object classes and attributes are
+// ignored.
+func ReadRouteObjects(r io.Reader) ([]VRP, error) {
+	var (
+		out    []VRP
+		prefix string
+		origin string
+		line   int
+	)
+	flush := func() error {
+		defer func() { prefix, origin = "", "" }()
+		if prefix == "" {
+			return nil
+		}
+		p, err := netip.ParsePrefix(prefix)
+		if err != nil {
+			return fmt.Errorf("%w: line %d: %s", ErrInvalidVRP, line, err)
+		}
+		as, err := parseAS(origin)
+		if err != nil {
+			return fmt.Errorf("%w: line %d: %s", ErrInvalidVRP, line, err)
+		}
+		out = append(out, VRP{Prefix: p.Masked(), MaxLength: uint8(p.Bits()), AS: as})
+		return nil
+	}
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line++
+		l := sc.Text()
+		if strings.TrimSpace(l) == "" {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		key, value, ok := strings.Cut(l, ":")
+		if !ok || strings.HasPrefix(l, "%") || strings.HasPrefix(l, "#") {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		if i := strings.IndexByte(value, '#'); i >= 0 {
+			value = strings.TrimSpace(value[:i])
+		}
+		switch strings.ToLower(key) {
+		case "route", "route6":
+			prefix = value
+		case "origin":
+			origin = value
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
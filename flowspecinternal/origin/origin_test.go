@@ -0,0 +1,107 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package origin
+
+import (
+	"errors"
+	"net/netip"
+	"strings"
+	"testing"
+
+	fs "floofspectools/flowspecinternal"
+)
+
+func TestAuthorizeOrigin(t *testing.T) {
+	tbl := NewTable([]VRP{
+		{Prefix: netip.MustParsePrefix("192.0.2.0/24"), MaxLength: 25, AS: 64500},
+		{Prefix: netip.MustParsePrefix("198.51.100.0/22"), MaxLength: 22, AS: 64501},
+		{Prefix: netip.MustParsePrefix("198.51.100.0/24"), MaxLength: 24, AS: 64502},
+		{Prefix: netip.MustParsePrefix("203.0.113.0/24"), MaxLength: 24, AS: 0},
+		{Prefix: netip.MustParsePrefix("2001:db8::/32"), MaxLength: 48, AS: 64500},
+		{Prefix: netip.MustParsePrefix("10.0.0.0/8"), MaxLength: 4, AS: 64500}, // invalid
+	})
+	if tbl.Len() != 5 {
+		t.Errorf("Len() = %d, want 5", tbl.Len())
+	}
+	tests := []struct {
+		prefix string
+		as     uint32
+		want   fs.OriginState
+	}{
+		{"192.0.2.0/24", 64500, fs.OriginValid},
+		{"192.0.2.128/25", 64500, fs.OriginValid},
+		{"192.0.2.128/26", 64500, fs.OriginInvalid},
+		{"192.0.2.0/24", 64501, fs.OriginInvalid},
+		{"198.51.100.0/24", 64502, fs.OriginValid},
+		{"198.51.100.0/24", 64501, fs.OriginInvalid},
+		{"203.0.113.0/24", 0, fs.OriginInvalid},
+		{"2001:db8:1::/48", 64500, fs.OriginValid},
+		{"10.0.0.0/8", 64500, fs.OriginNotFound},
+	}
+	for _, tt := range tests {
+		if got := tbl.AuthorizeOrigin(netip.MustParsePrefix(tt.prefix), tt.as); got != tt.want {
+			t.Errorf("AuthorizeOrigin(%s, %d) = %s, want %s", tt.prefix, tt.as, got, tt.want)
+		}
+	}
+
+	v := VRP{Prefix: netip.MustParsePrefix("10.0.0.0/8"), MaxLength: 8, AS: 64500}
+	if !tbl.Add(v) || tbl.Add(v) {
+		t.Error("Add() did not report the insert once")
+	}
+	if got := tbl.AuthorizeOrigin(v.Prefix, 64500); got != fs.OriginValid {
+		t.Errorf("AuthorizeOrigin() after Add = %s", got)
+	}
+	if !tbl.Remove(v) || tbl.Remove(v) || tbl.Len() != 5 {
+		t.Error("Remove() did not report the delete once")
+	}
+}
+
+func TestReadVRPs(t *testing.T) {
+	vrps, err := ReadVRPs(strings.NewReader(`{"metadata": {}, "roas": [
+		{"asn": "AS64500", "prefix": "192.0.2.0/24", "maxLength": 24, "ta": "ripe"},
+		{"asn": 64501, "prefix": "2001:db8::/32", "maxLength": 48}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []VRP{
+		{Prefix: netip.MustParsePrefix("192.0.2.0/24"), MaxLength: 24, AS: 64500},
+		{Prefix: netip.MustParsePrefix("2001:db8::/32"), MaxLength: 48, AS: 64501},
+	}
+	if len(vrps) != 2 || vrps[0] != want[0] || vrps[1] != want[1] {
+		t.Errorf("ReadVRPs() = %v, want %v", vrps, want)
+	}
+	_, err = ReadVRPs(strings.NewReader(`{"roas": [{"asn": "AS1", "prefix": "192.0.2.0/24", "maxLength": 16}]}`))
+	if !errors.Is(err, ErrInvalidVRP) {
+		t.Errorf("ReadVRPs(max length) error = %v, want %v", err, ErrInvalidVRP)
+	}
+}
+
+func TestReadRouteObjects(t *testing.T) {
+	vrps, err := ReadRouteObjects(strings.NewReader(`% IRR dump
+route:      192.0.2.0/24
+descr:      example
+origin:     AS64500 # customer
+source:     RADB
+
+aut-num:    AS64500
+
+route6:     2001:db8::/32
+origin:     as64501
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []VRP{
+		{Prefix: netip.MustParsePrefix("192.0.2.0/24"), MaxLength: 24, AS: 64500},
+		{Prefix: netip.MustParsePrefix("2001:db8::/32"), MaxLength: 32, AS: 64501},
+	}
+	if len(vrps) != 2 || vrps[0] != want[0] || vrps[1] != want[1] {
+		t.Errorf("ReadRouteObjects() = %v, want %v", vrps, want)
+	}
+	if _, err := ReadRouteObjects(strings.NewReader("route: 192.0.2.0/24\norigin: ASX\n")); !errors.Is(err, ErrInvalidVRP) {
+		t.Errorf("ReadRouteObjects(bad origin) error = %v, want %v", err, ErrInvalidVRP)
+	}
+}
@@ -0,0 +1,346 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+// Package rtr implements an RPKI-to-Router (RFC8210) client keeping an
+// origin.Table synchronized with an RPKI cache, so that it can serve as
+// the fs.OriginAuthorizer of validation:
+//
+//	c := rtr.NewClient("rpki.example.net:3323", nil)
+//	go c.Run(ctx)
+//	cfg := &fs.Config{OriginAuthorizer: c}
+//
+// The client speaks version 1 and falls back to version 0 for caches that
+// do not support it. It polls with Serial Queries at the refresh interval,
+// follows Serial Notify, reconnects after the retry interval and drops the
+// VRPs once they are older than the expire interval.
+package rtr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/origin"
+)
+
+// Default timing parameters (RFC8210 6), used until the cache sends its own
+// in a version 1 End of Data.
+const (
+	DefaultRefresh = time.Hour
+	DefaultRetry   = 10 * time.Minute
+	DefaultExpire  = 2 * time.Hour
+)
+
+var (
+	ErrProtocol = errors.New("rtr: protocol error")
+
+	errDowngrade = errors.New("rtr: cache speaks an older protocol version")
+)
+
+// Options configures a Client.
+type Options struct {
+	// Version0 restricts the client to protocol version 0 (RFC6810).
+	Version0 bool
+	// Dial opens the transport to the cache, defaulting to TCP to the
+	// address given to NewClient.
+	Dial func(ctx context.Context) (net.Conn, error)
+	// Table receives the VRPs, defaulting to a new empty one.
+	Table *origin.Table
+	// Logger, if set, receives connection and synchronization events.
+	Logger *slog.Logger
+}
+
+// Client is an RTR client. Its methods are safe for concurrent use.
+type Client struct {
+	dial  func(ctx context.Context) (net.Conn, error)
+	table *origin.Table
+	log   *slog.Logger
+
+	mu      sync.Mutex
+	version uint8
+	synced  bool // session and serial are valid
+	session uint16
+	serial  uint32
+	updated time.Time
+	refresh time.Duration
+	retry   time.Duration
+	expire  time.Duration
+}
+
+// NewClient returns a Client for the cache at addr ("host:port").
+func NewClient(addr string, opts *Options) *Client {
+	var o Options
+	if opts != nil {
+		o = *opts
+	}
+	c := &Client{
+		dial:    o.Dial,
+		table:   o.Table,
+		log:     fs.SubsystemLogger(o.Logger, fs.SubsystemRTR),
+		version: 1,
+		refresh: DefaultRefresh,
+		retry:   DefaultRetry,
+		expire:  DefaultExpire,
+	}
+	if o.Version0 {
+		c.version = 0
+	}
+	if c.table == nil {
+		c.table = &origin.Table{}
+	}
+	if c.dial == nil {
+		var d net.Dialer
+		c.dial = func(ctx context.Context) (net.Conn, error) { return d.DialContext(ctx, "tcp", addr) }
+	}
+	return c
+}
+
+// Table returns the table the client maintains.
+func (c *Client) Table() *origin.Table { return c.table }
+
+// Synced reports whether the client holds VRPs that have not expired.
+func (c *Client) Synced() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.synced && time.Since(c.updated) < c.expire
+}
+
+// Serial returns the session id and serial number of the VRPs held.
+func (c *Client) Serial() (session uint16, serial uint32, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.session, c.serial, c.synced
+}
+
+// AuthorizeOrigin implements fs.OriginAuthorizer. Without synchronized VRPs
+// every prefix is fs.OriginNotFound, so an unreachable cache does not make
+// routes invalid.
+func (c *Client) AuthorizeOrigin(prefix netip.Prefix, as uint32) fs.OriginState {
+	if !c.Synced() {
+		return fs.OriginNotFound
+	}
+	return c.table.AuthorizeOrigin(prefix, as)
+}
+
+// Run synchronizes with the cache until ctx is done, reconnecting after the
+// retry interval when the connection fails.
+func (c *Client) Run(ctx context.Context) error {
+	for {
+		err := c.runConn(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		c.expireStale()
+		if errors.Is(err, errDowngrade) {
+			c.log.Info("falling back to older protocol version", "version", c.protocolVersion())
+			continue
+		}
+		c.mu.Lock()
+		retry := c.retry
+		c.mu.Unlock()
+		c.log.Warn("cache connection failed", "error", err, "retry", retry)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(retry):
+		}
+	}
+}
+
+func (c *Client) protocolVersion() uint8 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.version
+}
+
+// expireStale drops VRPs older than the expire interval (RFC8210 6).
+func (c *Client) expireStale() {
+	c.mu.Lock()
+	stale := c.synced && time.Since(c.updated) >= c.expire
+	if stale {
+		c.synced = false
+	}
+	c.mu.Unlock()
+	if stale {
+		c.table.Replace(nil)
+		c.log.Warn("VRPs expired")
+	}
+}
+
+// query asks for the changes since the serial held, or for all VRPs.
+func (c *Client) query() *PDU {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.synced {
+		return &PDU{Version: c.version, Type: TypeSerialQuery, Session: c.session, Serial: c.serial}
+	}
+	return &PDU{Version: c.version, Type: TypeResetQuery}
+}
+
+func (c *Client) runConn(ctx context.Context) error {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	done := make(chan struct{})
+	defer close(done)
+	pdus := make(chan *PDU)
+	errc := make(chan error, 1)
+	go func() {
+		for {
+			p, err := ReadPDU(conn)
+			if err != nil {
+				errc <- err
+				return
+			}
+			select {
+			case pdus <- p:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	send := func(p *PDU) error {
+		_, err := conn.Write(p.Marshal())
+		return err
+	}
+	fail := func(code uint16, p *PDU, format string, args ...any) error {
+		text := fmt.Sprintf(format, args...)
+		send(errorReport(c.protocolVersion(), code, p.Marshal(), text))
+		return fmt.Errorf("%w: %s", ErrProtocol, text)
+	}
+
+	q := c.query()
+	if err := send(q); err != nil {
+		return err
+	}
+	var (
+		pending            = q // the query being answered, nil when idle
+		inResponse         bool
+		announce, withdraw []origin.VRP
+	)
+	c.mu.Lock()
+	refresh := time.NewTimer(c.refresh)
+	c.mu.Unlock()
+	defer refresh.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-errc:
+			return err
+		case <-refresh.C:
+			c.expireStale()
+			if pending == nil {
+				pending = c.query()
+				if err := send(pending); err != nil {
+					return err
+				}
+			}
+			c.mu.Lock()
+			refresh.Reset(c.refresh)
+			c.mu.Unlock()
+		case p := <-pdus:
+			c.mu.Lock()
+			version, synced, session := c.version, c.synced, c.session
+			c.mu.Unlock()
+			if p.Version != version {
+				if p.Version < version && !synced {
+					c.mu.Lock()
+					c.version = p.Version
+					c.mu.Unlock()
+					return errDowngrade
+				}
+				return fail(ErrCodeUnexpectedVersion, p, "unexpected version %d", p.Version)
+			}
+			switch p.Type {
+			case TypeSerialNotify:
+				if pending == nil && (!synced || p.Session == session) {
+					pending = c.query()
+					if err := send(pending); err != nil {
+						return err
+					}
+				}
+			case TypeCacheResponse:
+				if pending == nil || inResponse {
+					return fail(ErrCodeInvalidRequest, p, "unsolicited cache response")
+				}
+				if pending.Type == TypeSerialQuery && p.Session != session {
+					return fail(ErrCodeCorruptData, p, "session id changed from %d to %d", session, p.Session)
+				}
+				inResponse, announce, withdraw = true, nil, nil
+			case TypeIPv4Prefix, TypeIPv6Prefix:
+				if !inResponse {
+					return fail(ErrCodeCorruptData, p, "prefix outside cache response")
+				}
+				if p.Announce {
+					announce = append(announce, p.VRP)
+				} else {
+					withdraw = append(withdraw, p.VRP)
+				}
+			case TypeRouterKey:
+				// BGPsec router keys are of no use for origin validation
+			case TypeEndOfData:
+				if !inResponse {
+					return fail(ErrCodeCorruptData, p, "end of data outside cache response")
+				}
+				if pending.Type == TypeResetQuery {
+					c.table.Replace(announce)
+				} else {
+					c.table.Update(announce, withdraw)
+				}
+				c.mu.Lock()
+				c.synced, c.session, c.serial, c.updated = true, p.Session, p.Serial, time.Now()
+				if p.Version >= 1 {
+					c.setIntervals(p)
+				}
+				refresh.Reset(c.refresh)
+				c.mu.Unlock()
+				c.log.Info("VRPs synchronized", "session", p.Session, "serial", p.Serial,
+					"announced", len(announce), "withdrawn", len(withdraw), "vrps", c.table.Len())
+				pending, inResponse, announce, withdraw = nil, false, nil, nil
+			case TypeCacheReset:
+				if pending == nil || pending.Type != TypeSerialQuery || inResponse {
+					return fail(ErrCodeInvalidRequest, p, "unsolicited cache reset")
+				}
+				c.mu.Lock()
+				c.synced = false
+				c.mu.Unlock()
+				pending = c.query()
+				if err := send(pending); err != nil {
+					return err
+				}
+			case TypeErrorReport:
+				return &ReportError{Code: p.Session, Text: p.Text}
+			default:
+				return fail(ErrCodeUnsupportedPDUType, p, "unsupported PDU type %d", p.Type)
+			}
+		}
+	}
+}
+
+// setIntervals takes the timing parameters of an End of Data PDU within
+// the ranges of RFC8210 6, keeping the current value otherwise.
+func (c *Client) setIntervals(p *PDU) {
+	set := func(d *time.Duration, secs, lo, hi uint32) {
+		if secs >= lo && secs <= hi {
+			*d = time.Duration(secs) * time.Second
+		}
+	}
+	set(&c.refresh, p.Refresh, 1, 86400)
+	set(&c.retry, p.Retry, 1, 7200)
+	set(&c.expire, p.Expire, 600, 172800)
+}
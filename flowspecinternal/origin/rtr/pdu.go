@@ -0,0 +1,188 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package rtr
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+
+	"floofspectools/flowspecinternal/origin"
+)
+
+var (
+	ErrMalformedPDU = errors.New("rtr: malformed PDU")
+)
+
+// PDU types (RFC8210 5).
+const (
+	TypeSerialNotify  uint8 = 0
+	TypeSerialQuery   uint8 = 1
+	TypeResetQuery    uint8 = 2
+	TypeCacheResponse uint8 = 3
+	TypeIPv4Prefix    uint8 = 4
+	TypeIPv6Prefix    uint8 = 6
+	TypeEndOfData     uint8 = 7
+	TypeCacheReset    uint8 = 8
+	TypeRouterKey     uint8 = 9
+	TypeErrorReport   uint8 = 10
+)
+
+// Error Report codes (RFC8210 12).
+const (
+	ErrCodeCorruptData        uint16 = 0
+	ErrCodeInternalError      uint16 = 1
+	ErrCodeNoDataAvailable    uint16 = 2
+	ErrCodeInvalidRequest     uint16 = 3
+	ErrCodeUnsupportedVersion uint16 = 4
+	ErrCodeUnsupportedPDUType uint16 = 5
+	ErrCodeWithdrawUnknown    uint16 = 6
+	ErrCodeDuplicateAnnounce  uint16 = 7
+	ErrCodeUnexpectedVersion  uint16 = 8
+)
+
+const (
+	headerLen = 8
+	// maxPDULen bounds Error Report and Router Key PDUs, the only ones of
+	// variable length.
+	maxPDULen    = 1 << 16
+	flagAnnounce = 0x01
+)
+
+// PDU is a decoded RTR PDU. Fields beyond the header are set according to
+// Type.
+type PDU struct {
+	Version uint8
+	Type    uint8
+	// Session is the session id, or the error code of an Error Report.
+	Session uint16
+	Serial  uint32
+
+	// Announce and VRP of IPv4 and IPv6 Prefix PDUs.
+	Announce bool
+	VRP      origin.VRP
+
+	// Intervals of a version 1 End of Data PDU, in seconds.
+	Refresh, Retry, Expire uint32
+
+	// Encapsulated PDU and diagnostic text of an Error Report.
+	Encapsulated []byte
+	Text         string
+}
+
+// ReadPDU reads one PDU from r. PDUs of unknown type are returned with
+// their header fields only.
+func ReadPDU(r io.Reader) (*PDU, error) {
+	var h [headerLen]byte
+	if _, err := io.ReadFull(r, h[:]); err != nil {
+		return nil, err
+	}
+	p := &PDU{Version: h[0], Type: h[1], Session: binary.BigEndian.Uint16(h[2:])}
+	n := binary.BigEndian.Uint32(h[4:])
+	if n < headerLen || n > maxPDULen {
+		return nil, fmt.Errorf("%w: length %d", ErrMalformedPDU, n)
+	}
+	b := make([]byte, n-headerLen)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+	want := map[uint8]int{
+		TypeSerialNotify: 4, TypeSerialQuery: 4, TypeResetQuery: 0, TypeCacheResponse: 0,
+		TypeIPv4Prefix: 12, TypeIPv6Prefix: 24, TypeCacheReset: 0,
+	}
+	if p.Type == TypeEndOfData {
+		want[TypeEndOfData] = 4
+		if p.Version >= 1 {
+			want[TypeEndOfData] = 16
+		}
+	}
+	if w, ok := want[p.Type]; ok && len(b) != w {
+		return nil, fmt.Errorf("%w: type %d length %d", ErrMalformedPDU, p.Type, n)
+	}
+	switch p.Type {
+	case TypeSerialNotify, TypeSerialQuery:
+		p.Serial = binary.BigEndian.Uint32(b)
+	case TypeEndOfData:
+		p.Serial = binary.BigEndian.Uint32(b)
+		if p.Version >= 1 {
+			p.Refresh = binary.BigEndian.Uint32(b[4:])
+			p.Retry = binary.BigEndian.Uint32(b[8:])
+			p.Expire = binary.BigEndian.Uint32(b[12:])
+		}
+	case TypeIPv4Prefix, TypeIPv6Prefix:
+		p.Announce = b[0]&flagAnnounce != 0
+		addr, _ := netip.AddrFromSlice(b[4 : len(b)-4])
+		pfx, err := addr.Prefix(int(b[1]))
+		if err != nil || int(b[1]) > int(b[2]) || int(b[2]) > addr.BitLen() {
+			return nil, fmt.Errorf("%w: prefix %s/%d-%d", ErrMalformedPDU, addr, b[1], b[2])
+		}
+		p.VRP = origin.VRP{Prefix: pfx, MaxLength: b[2], AS: binary.BigEndian.Uint32(b[len(b)-4:])}
+	case TypeErrorReport:
+		if len(b) < 8 {
+			return nil, fmt.Errorf("%w: error report length %d", ErrMalformedPDU, n)
+		}
+		el := binary.BigEndian.Uint32(b)
+		if uint64(el)+8 > uint64(len(b)) {
+			return nil, fmt.Errorf("%w: error report PDU length %d", ErrMalformedPDU, el)
+		}
+		p.Encapsulated = b[4 : 4+el]
+		tl := binary.BigEndian.Uint32(b[4+el:])
+		if uint64(tl) != uint64(len(b))-8-uint64(el) {
+			return nil, fmt.Errorf("%w: error report text length %d", ErrMalformedPDU, tl)
+		}
+		p.Text = string(b[8+el:])
+	}
+	return p, nil
+}
+
+// Marshal encodes p.
+func (p *PDU) Marshal() []byte {
+	var body []byte
+	switch p.Type {
+	case TypeSerialNotify, TypeSerialQuery:
+		body = binary.BigEndian.AppendUint32(nil, p.Serial)
+	case TypeEndOfData:
+		body = binary.BigEndian.AppendUint32(nil, p.Serial)
+		if p.Version >= 1 {
+			body = binary.BigEndian.AppendUint32(body, p.Refresh)
+			body = binary.BigEndian.AppendUint32(body, p.Retry)
+			body = binary.BigEndian.AppendUint32(body, p.Expire)
+		}
+	case TypeIPv4Prefix, TypeIPv6Prefix:
+		var flags byte
+		if p.Announce {
+			flags = flagAnnounce
+		}
+		body = append([]byte{flags, byte(p.VRP.Prefix.Bits()), p.VRP.MaxLength, 0}, p.VRP.Prefix.Addr().AsSlice()...)
+		body = binary.BigEndian.AppendUint32(body, p.VRP.AS)
+	case TypeErrorReport:
+		body = binary.BigEndian.AppendUint32(nil, uint32(len(p.Encapsulated)))
+		body = append(body, p.Encapsulated...)
+		body = binary.BigEndian.AppendUint32(body, uint32(len(p.Text)))
+		body = append(body, p.Text...)
+	}
+	b := make([]byte, headerLen, headerLen+len(body))
+	b[0], b[1] = p.Version, p.Type
+	binary.BigEndian.PutUint16(b[2:], p.Session)
+	binary.BigEndian.PutUint32(b[4:], uint32(headerLen+len(body)))
+	return append(b, body...)
+}
+
+// errorReport returns the Error Report PDU for code about pdu.
+func errorReport(version uint8, code uint16, pdu []byte, text string) *PDU {
+	return &PDU{Version: version, Type: TypeErrorReport, Session: code, Encapsulated: pdu, Text: text}
+}
+
+// ReportError is an Error Report received from the cache.
+type ReportError struct {
+	Code uint16
+	Text string
+}
+
+func (e *ReportError) Error() string {
+	return fmt.Sprintf("rtr: cache reported error %d: %s", e.Code, e.Text)
+}
@@ -0,0 +1,192 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package rtr
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/netip"
+	"reflect"
+	"testing"
+	"time"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/origin"
+)
+
+func vrp(p string, max uint8, as uint32) origin.VRP {
+	return origin.VRP{Prefix: netip.MustParsePrefix(p), MaxLength: max, AS: as}
+}
+
+func TestPDURoundTrip(t *testing.T) {
+	pdus := []*PDU{
+		{Version: 1, Type: TypeSerialNotify, Session: 7, Serial: 42},
+		{Version: 1, Type: TypeSerialQuery, Session: 7, Serial: 42},
+		{Version: 1, Type: TypeResetQuery},
+		{Version: 1, Type: TypeCacheResponse, Session: 7},
+		{Version: 1, Type: TypeIPv4Prefix, Announce: true, VRP: vrp("192.0.2.0/24", 25, 64500)},
+		{Version: 1, Type: TypeIPv6Prefix, VRP: vrp("2001:db8::/32", 48, 64501)},
+		{Version: 1, Type: TypeEndOfData, Session: 7, Serial: 42, Refresh: 3600, Retry: 600, Expire: 7200},
+		{Version: 0, Type: TypeEndOfData, Session: 7, Serial: 42},
+		{Version: 1, Type: TypeCacheReset},
+		{Version: 1, Type: TypeErrorReport, Session: ErrCodeNoDataAvailable, Encapsulated: []byte{1, 2, 0, 0, 0, 0, 0, 8}, Text: "no data"},
+	}
+	for _, p := range pdus {
+		got, err := ReadPDU(bytes.NewReader(p.Marshal()))
+		if err != nil {
+			t.Fatalf("ReadPDU(%+v) error = %v", p, err)
+		}
+		if !reflect.DeepEqual(got, p) {
+			t.Errorf("ReadPDU() = %+v, want %+v", got, p)
+		}
+	}
+	bad := (&PDU{Version: 1, Type: TypeIPv4Prefix, VRP: vrp("192.0.2.0/24", 24, 1)}).Marshal()
+	bad[10] = 16 // max length below prefix length
+	if _, err := ReadPDU(bytes.NewReader(bad)); err == nil {
+		t.Error("ReadPDU(max length < prefix length) succeeded")
+	}
+}
+
+// cache is a scripted RTR cache on the far end of a pipe.
+type cache struct {
+	t     *testing.T
+	conns chan net.Conn
+}
+
+func newCache(t *testing.T) (*cache, func(context.Context) (net.Conn, error)) {
+	c := &cache{t: t, conns: make(chan net.Conn, 4)}
+	return c, func(context.Context) (net.Conn, error) {
+		a, b := net.Pipe()
+		c.conns <- b
+		return a, nil
+	}
+}
+
+func (c *cache) accept() net.Conn {
+	c.t.Helper()
+	select {
+	case conn := <-c.conns:
+		return conn
+	case <-time.After(5 * time.Second):
+		c.t.Fatal("client did not connect")
+	}
+	return nil
+}
+
+func (c *cache) expect(conn net.Conn, want PDU) {
+	c.t.Helper()
+	got, err := ReadPDU(conn)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if got.Version != want.Version || got.Type != want.Type || got.Session != want.Session || got.Serial != want.Serial {
+		c.t.Fatalf("client sent %+v, want %+v", got, want)
+	}
+}
+
+func (c *cache) send(conn net.Conn, pdus ...*PDU) {
+	c.t.Helper()
+	for _, p := range pdus {
+		if _, err := conn.Write(p.Marshal()); err != nil {
+			c.t.Fatal(err)
+		}
+	}
+}
+
+func waitSerial(t *testing.T, cl *Client, serial uint32) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, s, ok := cl.Serial(); ok && s == serial {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("client did not reach serial %d", serial)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestClient(t *testing.T) {
+	srv, dial := newCache(t)
+	cl := NewClient("", &Options{Dial: dial})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go cl.Run(ctx)
+
+	if got := cl.AuthorizeOrigin(netip.MustParsePrefix("192.0.2.0/24"), 64500); got != fs.OriginNotFound {
+		t.Errorf("AuthorizeOrigin() before sync = %s", got)
+	}
+	conn := srv.accept()
+	srv.expect(conn, PDU{Version: 1, Type: TypeResetQuery})
+	srv.send(conn,
+		&PDU{Version: 1, Type: TypeCacheResponse, Session: 7},
+		&PDU{Version: 1, Type: TypeIPv4Prefix, Announce: true, VRP: vrp("192.0.2.0/24", 24, 64500)},
+		&PDU{Version: 1, Type: TypeIPv6Prefix, Announce: true, VRP: vrp("2001:db8::/32", 48, 64501)},
+		&PDU{Version: 1, Type: TypeEndOfData, Session: 7, Serial: 1, Refresh: 3600, Retry: 600, Expire: 7200},
+	)
+	waitSerial(t, cl, 1)
+	if got := cl.AuthorizeOrigin(netip.MustParsePrefix("192.0.2.0/24"), 64500); got != fs.OriginValid {
+		t.Errorf("AuthorizeOrigin() = %s, want valid", got)
+	}
+
+	// incremental update following a notify
+	srv.send(conn, &PDU{Version: 1, Type: TypeSerialNotify, Session: 7, Serial: 2})
+	srv.expect(conn, PDU{Version: 1, Type: TypeSerialQuery, Session: 7, Serial: 1})
+	srv.send(conn,
+		&PDU{Version: 1, Type: TypeCacheResponse, Session: 7},
+		&PDU{Version: 1, Type: TypeIPv4Prefix, VRP: vrp("192.0.2.0/24", 24, 64500)},
+		&PDU{Version: 1, Type: TypeIPv4Prefix, Announce: true, VRP: vrp("192.0.2.0/24", 24, 64502)},
+		&PDU{Version: 1, Type: TypeEndOfData, Session: 7, Serial: 2, Refresh: 3600, Retry: 600, Expire: 7200},
+	)
+	waitSerial(t, cl, 2)
+	if got := cl.AuthorizeOrigin(netip.MustParsePrefix("192.0.2.0/24"), 64500); got != fs.OriginInvalid {
+		t.Errorf("AuthorizeOrigin() after withdraw = %s, want invalid", got)
+	}
+	if cl.Table().Len() != 2 {
+		t.Errorf("Table().Len() = %d, want 2", cl.Table().Len())
+	}
+
+	// cache reset: the next response replaces everything
+	srv.send(conn, &PDU{Version: 1, Type: TypeSerialNotify, Session: 7, Serial: 3})
+	srv.expect(conn, PDU{Version: 1, Type: TypeSerialQuery, Session: 7, Serial: 2})
+	srv.send(conn, &PDU{Version: 1, Type: TypeCacheReset})
+	srv.expect(conn, PDU{Version: 1, Type: TypeResetQuery})
+	srv.send(conn,
+		&PDU{Version: 1, Type: TypeCacheResponse, Session: 8},
+		&PDU{Version: 1, Type: TypeIPv4Prefix, Announce: true, VRP: vrp("198.51.100.0/24", 24, 64503)},
+		&PDU{Version: 1, Type: TypeEndOfData, Session: 8, Serial: 3, Refresh: 3600, Retry: 600, Expire: 7200},
+	)
+	waitSerial(t, cl, 3)
+	if got := cl.Table().VRPs(); len(got) != 1 || got[0] != vrp("198.51.100.0/24", 24, 64503) {
+		t.Errorf("Table().VRPs() after reset = %v", got)
+	}
+}
+
+func TestClientDowngrade(t *testing.T) {
+	srv, dial := newCache(t)
+	cl := NewClient("", &Options{Dial: dial})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go cl.Run(ctx)
+
+	conn := srv.accept()
+	srv.expect(conn, PDU{Version: 1, Type: TypeResetQuery})
+	srv.send(conn, errorReport(0, ErrCodeUnsupportedVersion, nil, "version 0 only"))
+	conn.Close()
+
+	conn = srv.accept()
+	srv.expect(conn, PDU{Version: 0, Type: TypeResetQuery})
+	srv.send(conn,
+		&PDU{Version: 0, Type: TypeCacheResponse, Session: 3},
+		&PDU{Version: 0, Type: TypeIPv4Prefix, Announce: true, VRP: vrp("192.0.2.0/24", 24, 64500)},
+		&PDU{Version: 0, Type: TypeEndOfData, Session: 3, Serial: 9},
+	)
+	waitSerial(t, cl, 9)
+	if !cl.Synced() || cl.Table().Len() != 1 {
+		t.Errorf("Synced() = %v, Len() = %d", cl.Synced(), cl.Table().Len())
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package flowspecinternal
+
+import (
+	"errors"
+	"net/netip"
+	"testing"
+)
+
+type originMap map[netip.Prefix]uint32
+
+func (m originMap) AuthorizeOrigin(p netip.Prefix, as uint32) OriginState {
+	owner, ok := m[p]
+	switch {
+	case !ok:
+		return OriginNotFound
+	case owner == as:
+		return OriginValid
+	}
+	return OriginInvalid
+}
+
+func TestValidateOrigin(t *testing.T) {
+	dst := mustPrefix("192.0.2.0/24")
+	rib := &mockRIB{best: &UnicastRoute{Prefix: dst, NeighborAS: 64500, ASPath: []uint32{64500, 64510}, OriginatorID: netip.AddrFrom4([4]byte{192, 0, 2, 1})}}
+	authz := originMap{dst: 64510}
+	tests := []struct {
+		name    string
+		route   FlowSpecRoute
+		require bool
+		authz   originMap
+		want    error
+	}{
+		{name: "valid", route: FlowSpecRoute{ASPath: []uint32{64500, 64510}}, want: nil},
+		{name: "invalid", route: FlowSpecRoute{ASPath: []uint32{64500, 64520}}, want: ErrOriginUnauthorized},
+		{name: "not found", route: FlowSpecRoute{ASPath: []uint32{64500, 64510}}, authz: originMap{}, want: nil},
+		{name: "not found required", route: FlowSpecRoute{ASPath: []uint32{64500, 64510}}, authz: originMap{}, require: true, want: ErrOriginUnauthorized},
+		{name: "local", route: FlowSpecRoute{}, require: true, want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := tt.route
+			r.DestPrefix, r.FromEBGP, r.NeighborAS, r.OriginatorID = &dst, len(r.ASPath) > 0, 64500, netip.AddrFrom4([4]byte{192, 0, 2, 1})
+			cfg := &Config{OriginAuthorizer: authz, RequireOriginValid: tt.require}
+			if tt.authz != nil {
+				cfg.OriginAuthorizer = tt.authz
+			}
+			if err := ValidateFeasibility(&r, rib, cfg); !errors.Is(err, tt.want) {
+				t.Errorf("ValidateFeasibility() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+	if got := Reason(ErrOriginUnauthorized); got != "origin-unauthorized" {
+		t.Errorf("Reason() = %q", got)
+	}
+}
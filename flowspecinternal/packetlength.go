@@ -0,0 +1,72 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package flowspecinternal
+
+import "fmt"
+
+// Smallest total lengths of IPv4 and IPv6 packets: their fixed headers.
+// The packet length component (type 10) matches the total length, header
+// included, as the matcher package computes it.
+const (
+	MinIPv4PacketLength = 20
+	MinIPv6PacketLength = 40
+)
+
+// maxPacketLength is the largest total length the 16 bit IPv4 total length
+// and IPv6 payload length fields can describe without a jumbogram.
+const maxPacketLength = 0xffff
+
+// MinPacketLength returns the smallest length of a packet of afi.
+func MinPacketLength(afi uint16) uint64 {
+	if afi == AFIIPv6 {
+		return MinIPv6PacketLength
+	}
+	return MinIPv4PacketLength
+}
+
+// PacketLengthComponent returns the packet length component (type 10)
+// matching the lengths of ranges, e.g. PacketLengthComponent(ValueRange{From: 1400, To: 1500}).
+// Lengths above 65535 return ErrInvalidComponentValue.
+func PacketLengthComponent(ranges ...ValueRange) (FSComponent, error) {
+	for _, r := range ranges {
+		if r.From > r.To || r.To > maxPacketLength {
+			return FSComponent{}, fmt.Errorf("%w: len %d-%d", ErrInvalidComponentValue, r.From, r.To)
+		}
+	}
+	return FSComponent{Type: ComponentTypePacketLength, Raw: EncodeNumericOps(NumericOpsFromRanges(ranges, maxPacketLength))}, nil
+}
+
+// CheckPacketLength returns ErrImplausiblePacketLength if a packet length
+// component of l compares against a length above mtu or below
+// MinPacketLength(afi), or matches no length in between. Such values are
+// usually typos, as in "len >65536" or "len <=150" for 1500. An mtu of 0
+// stands for 65535.
+func CheckPacketLength(l FSComponentList, afi uint16, mtu uint64) error {
+	if mtu == 0 {
+		mtu = maxPacketLength
+	}
+	lo := MinPacketLength(afi)
+	for _, c := range l.Components {
+		if c.Type != ComponentTypePacketLength {
+			continue
+		}
+		ops, err := ParseNumericOps(c.Raw)
+		if err != nil {
+			return err
+		}
+		for _, op := range ops {
+			if op.Value > mtu {
+				return fmt.Errorf("%w: %d above MTU %d", ErrImplausiblePacketLength, op.Value, mtu)
+			}
+			if op.Value < lo {
+				return fmt.Errorf("%w: %d below the %d octet header", ErrImplausiblePacketLength, op.Value, lo)
+			}
+		}
+		if len(intersectRanges(NumericRanges(ops, maxPacketLength), []ValueRange{{From: lo, To: mtu}})) == 0 {
+			return fmt.Errorf("%w: no length from %d to %d", ErrImplausiblePacketLength, lo, mtu)
+		}
+	}
+	return nil
+}
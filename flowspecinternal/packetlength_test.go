@@ -0,0 +1,54 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package flowspecinternal
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckPacketLength(t *testing.T) {
+	tests := []struct {
+		rule    string
+		list    FSComponentList
+		afi     uint16
+		mtu     uint64
+		wantErr error
+	}{
+		{rule: "dst 192.0.2.0/24", afi: AFIIPv4},
+		{rule: "len 20-65535", afi: AFIIPv4},
+		{rule: "len >65536", list: raw(ComponentTypePacketLength, 0xa2, 0x00, 0x01, 0x00, 0x00), afi: AFIIPv4, wantErr: ErrImplausiblePacketLength},
+		{rule: "len >=1000", afi: AFIIPv4, mtu: 1500},
+		{rule: "len >=1600", afi: AFIIPv4, mtu: 1500, wantErr: ErrImplausiblePacketLength},
+		{rule: "len >1500", afi: AFIIPv4, mtu: 1500, wantErr: ErrImplausiblePacketLength},
+		{rule: "len <=20", afi: AFIIPv4},
+		{rule: "len <20", afi: AFIIPv4, wantErr: ErrImplausiblePacketLength},
+		{rule: "len 0-100", afi: AFIIPv4, wantErr: ErrImplausiblePacketLength},
+		{rule: "len 30", afi: AFIIPv6, wantErr: ErrImplausiblePacketLength},
+		{rule: "len 40-1280", afi: AFIIPv6, mtu: 1280},
+	}
+	for _, tt := range tests {
+		if tt.list.Components == nil {
+			tt.list = mustParse(t, tt.rule)
+		}
+		if err := CheckPacketLength(tt.list, tt.afi, tt.mtu); !errors.Is(err, tt.wantErr) {
+			t.Errorf("CheckPacketLength(%q, %d, %d) error = %v, want %v", tt.rule, tt.afi, tt.mtu, err, tt.wantErr)
+		}
+	}
+}
+
+func TestPacketLengthComponent(t *testing.T) {
+	c, err := PacketLengthComponent(ValueRange{From: 1400, To: 1500}, ValueRange{From: 9000, To: 9000})
+	if err != nil {
+		t.Fatalf("PacketLengthComponent() error = %v", err)
+	}
+	l := FSComponentList{Components: []FSComponent{c}}
+	if got, want := l.Canonical(nil), "len=1400-1500,9000"; got != want {
+		t.Errorf("Canonical() = %q, want %q", got, want)
+	}
+	if _, err := PacketLengthComponent(ValueRange{From: 1500, To: 65536}); !errors.Is(err, ErrInvalidComponentValue) {
+		t.Errorf("PacketLengthComponent(1500-65536) error = %v, want %v", err, ErrInvalidComponentValue)
+	}
+}
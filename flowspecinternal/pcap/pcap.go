@@ -0,0 +1,287 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+// Package pcap dry-runs FlowSpec rules against captured traffic.
+//
+// Replay reads a classic libpcap file (not pcapng) and reports, per rule, how
+// many packets and bytes the rule would have matched had it been installed.
+// Supported link types are Ethernet (with 802.1Q/802.1ad tags), Linux cooked
+// capture and raw IP.
+package pcap
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net/netip"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/matcher"
+)
+
+var (
+	ErrNotPcap         = errors.New("pcap: not a libpcap file (pcapng is not supported)")
+	ErrUnsupportedLink = errors.New("pcap: unsupported link type")
+	ErrTruncated       = errors.New("pcap: truncated file")
+	ErrNotIP           = errors.New("pcap: frame does not carry an IP packet")
+	ErrMalformedIP     = errors.New("pcap: malformed IP header")
+)
+
+// Link types as per the tcpdump.org registry.
+const (
+	LinkEthernet = 1
+	LinkRaw      = 101
+	LinkLinuxSLL = 113
+	LinkIPv4     = 228
+	LinkIPv6     = 229
+)
+
+// Count is the traffic attributed to one rule.
+type Count struct {
+	Packets uint64
+	Bytes   uint64
+}
+
+// Report is the outcome of a Replay.
+type Report struct {
+	// Rules holds one Count per rule, indexed like the rules passed to Replay.
+	Rules []Count
+	// Unmatched counts IP packets no rule matched.
+	Unmatched Count
+	// Skipped counts frames that were not IP or could not be decoded.
+	Skipped uint64
+}
+
+// Options tunes Replay.
+type Options struct {
+	// AllMatches attributes a packet to every rule it matches instead of only
+	// the first in RFC8955 5.1 order. Use it to see which rules a packet
+	// reaches when traffic-action T bits let evaluation continue.
+	AllMatches bool
+}
+
+// Replay matches every packet of the capture in r against rules.
+func Replay(r io.Reader, rules []fs.FSComponentList, opts *Options) (*Report, error) {
+	m, err := matcher.New(rules)
+	if err != nil {
+		return nil, err
+	}
+	pr, err := NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	all := opts != nil && opts.AllMatches
+
+	rep := &Report{Rules: make([]Count, len(rules))}
+	for {
+		frame, wireLen, err := pr.Next()
+		if err == io.EOF {
+			return rep, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		pkt, err := DecodeFrame(pr.LinkType, frame)
+		if err != nil {
+			rep.Skipped++
+			continue
+		}
+		var hits []int
+		if all {
+			hits = m.MatchAll(pkt)
+		} else if i, ok := m.Match(pkt); ok {
+			hits = []int{i}
+		}
+		if len(hits) == 0 {
+			rep.Unmatched.Packets++
+			rep.Unmatched.Bytes += uint64(wireLen)
+		}
+		for _, i := range hits {
+			rep.Rules[i].Packets++
+			rep.Rules[i].Bytes += uint64(wireLen)
+		}
+	}
+}
+
+// Reader reads records of a classic libpcap file.
+type Reader struct {
+	r        io.Reader
+	order    binary.ByteOrder
+	LinkType uint32
+	buf      []byte
+}
+
+// NewReader reads the file header from r.
+func NewReader(r io.Reader) (*Reader, error) {
+	var hdr [24]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, ErrNotPcap
+	}
+	pr := &Reader{r: r}
+	switch binary.LittleEndian.Uint32(hdr[0:]) {
+	case 0xa1b2c3d4, 0xa1b23c4d:
+		pr.order = binary.LittleEndian
+	case 0xd4c3b2a1, 0x4d3cb2a1:
+		pr.order = binary.BigEndian
+	default:
+		return nil, ErrNotPcap
+	}
+	pr.LinkType = pr.order.Uint32(hdr[20:]) & 0x0fffffff
+	switch pr.LinkType {
+	case LinkEthernet, LinkRaw, LinkLinuxSLL, LinkIPv4, LinkIPv6:
+	default:
+		return nil, ErrUnsupportedLink
+	}
+	return pr, nil
+}
+
+// Next returns the captured bytes of the next frame and its length on the wire.
+// The returned slice is only valid until the next call. It returns io.EOF at the end.
+func (pr *Reader) Next() (frame []byte, wireLen uint32, err error) {
+	var hdr [16]byte
+	if _, err := io.ReadFull(pr.r, hdr[:]); err != nil {
+		if err == io.EOF {
+			return nil, 0, io.EOF
+		}
+		return nil, 0, ErrTruncated
+	}
+	incl := pr.order.Uint32(hdr[8:])
+	if incl > 1<<18 {
+		return nil, 0, ErrTruncated
+	}
+	if cap(pr.buf) < int(incl) {
+		pr.buf = make([]byte, incl)
+	}
+	pr.buf = pr.buf[:incl]
+	if _, err := io.ReadFull(pr.r, pr.buf); err != nil {
+		return nil, 0, ErrTruncated
+	}
+	return pr.buf, pr.order.Uint32(hdr[12:]), nil
+}
+
+// DecodeFrame strips the link layer of frame and decodes the IP packet.
+func DecodeFrame(linkType uint32, frame []byte) (*matcher.Packet, error) {
+	var etherType uint16
+	switch linkType {
+	case LinkRaw, LinkIPv4, LinkIPv6:
+		return DecodeIP(frame)
+	case LinkEthernet:
+		if len(frame) < 14 {
+			return nil, ErrNotIP
+		}
+		etherType, frame = binary.BigEndian.Uint16(frame[12:]), frame[14:]
+		for (etherType == 0x8100 || etherType == 0x88a8) && len(frame) >= 4 {
+			etherType, frame = binary.BigEndian.Uint16(frame[2:]), frame[4:]
+		}
+	case LinkLinuxSLL:
+		if len(frame) < 16 {
+			return nil, ErrNotIP
+		}
+		etherType, frame = binary.BigEndian.Uint16(frame[14:]), frame[16:]
+	default:
+		return nil, ErrUnsupportedLink
+	}
+	if etherType != 0x0800 && etherType != 0x86dd {
+		return nil, ErrNotIP
+	}
+	return DecodeIP(frame)
+}
+
+// DecodeIP decodes an IPv4 or IPv6 packet header and its transport header.
+// Transport fields are left zero for non-first fragments.
+func DecodeIP(b []byte) (*matcher.Packet, error) {
+	if len(b) < 1 {
+		return nil, ErrMalformedIP
+	}
+	switch b[0] >> 4 {
+	case 4:
+		return decodeIPv4(b)
+	case 6:
+		return decodeIPv6(b)
+	}
+	return nil, ErrNotIP
+}
+
+func decodeIPv4(b []byte) (*matcher.Packet, error) {
+	ihl := int(b[0]&0x0f) * 4
+	if len(b) < 20 || ihl < 20 || len(b) < ihl {
+		return nil, ErrMalformedIP
+	}
+	flags := binary.BigEndian.Uint16(b[6:])
+	p := &matcher.Packet{
+		Src:      netip.AddrFrom4([4]byte(b[12:16])),
+		Dst:      netip.AddrFrom4([4]byte(b[16:20])),
+		Protocol: b[9],
+		Length:   binary.BigEndian.Uint16(b[2:]),
+		DSCP:     b[1] >> 2,
+		Fragment: fs.PacketFragmentBits(flags&0x4000 != 0, flags&0x2000 != 0, flags&0x1fff),
+	}
+	if flags&0x1fff == 0 {
+		decodeTransport(p, b[ihl:])
+	}
+	return p, nil
+}
+
+func decodeIPv6(b []byte) (*matcher.Packet, error) {
+	if len(b) < 40 {
+		return nil, ErrMalformedIP
+	}
+	p := &matcher.Packet{
+		Src:    netip.AddrFrom16([16]byte(b[8:24])),
+		Dst:    netip.AddrFrom16([16]byte(b[24:40])),
+		Length: binary.BigEndian.Uint16(b[4:]) + 40,
+		DSCP:   (b[0]&0x0f)<<2 | b[1]>>6,
+	}
+	next, rest := b[6], b[40:]
+	first := true
+	for {
+		switch next {
+		case 0, 43, 60: // hop-by-hop, routing, destination options
+			if len(rest) < 8 || len(rest) < (int(rest[1])+1)*8 {
+				return nil, ErrMalformedIP
+			}
+			next, rest = rest[0], rest[(int(rest[1])+1)*8:]
+			continue
+		case 51: // authentication header
+			if len(rest) < 8 || len(rest) < (int(rest[1])+2)*4 {
+				return nil, ErrMalformedIP
+			}
+			next, rest = rest[0], rest[(int(rest[1])+2)*4:]
+			continue
+		case 44: // fragment
+			if len(rest) < 8 {
+				return nil, ErrMalformedIP
+			}
+			off := binary.BigEndian.Uint16(rest[2:])
+			p.Fragment = fs.PacketFragmentBits(false, off&0x0001 != 0, off>>3)
+			first = off>>3 == 0
+			next, rest = rest[0], rest[8:]
+			continue
+		}
+		break
+	}
+	p.Protocol = next
+	if first {
+		decodeTransport(p, rest)
+	}
+	return p, nil
+}
+
+// decodeTransport fills the transport fields present in the captured bytes.
+func decodeTransport(p *matcher.Packet, b []byte) {
+	switch p.Protocol {
+	case 6, 17, 132:
+		if len(b) >= 4 {
+			p.SrcPort = binary.BigEndian.Uint16(b[0:])
+			p.DstPort = binary.BigEndian.Uint16(b[2:])
+		}
+		if p.Protocol == 6 && len(b) >= 14 {
+			p.TCPFlags = fs.TCPFlags(b[12]&0x01)<<8 | fs.TCPFlags(b[13])
+		}
+	case 1, 58:
+		if len(b) >= 2 {
+			p.ICMPType, p.ICMPCode = b[0], b[1]
+		}
+	}
+}
@@ -0,0 +1,207 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package pcap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net/netip"
+	"slices"
+	"testing"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/matcher"
+)
+
+func prefix(s string) *netip.Prefix {
+	p := netip.MustParsePrefix(s)
+	return &p
+}
+
+// ipv4 builds an IPv4 header for a transport payload.
+func ipv4(proto byte, src, dst string, flagsOff uint16, payload []byte) []byte {
+	b := make([]byte, 20)
+	b[0], b[1] = 0x45, 46<<2
+	binary.BigEndian.PutUint16(b[2:], uint16(20+len(payload)))
+	binary.BigEndian.PutUint16(b[6:], flagsOff)
+	b[8], b[9] = 64, proto
+	copy(b[12:], netip.MustParseAddr(src).AsSlice())
+	copy(b[16:], netip.MustParseAddr(dst).AsSlice())
+	return append(b, payload...)
+}
+
+func udpHdr(sport, dport uint16) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint16(b[0:], sport)
+	binary.BigEndian.PutUint16(b[2:], dport)
+	return b
+}
+
+func tcpHdr(sport, dport uint16, flags byte) []byte {
+	b := make([]byte, 20)
+	binary.BigEndian.PutUint16(b[0:], sport)
+	binary.BigEndian.PutUint16(b[2:], dport)
+	b[12], b[13] = 5<<4, flags
+	return b
+}
+
+func ether(etherType uint16, vlan bool, payload []byte) []byte {
+	b := make([]byte, 12)
+	if vlan {
+		b = binary.BigEndian.AppendUint16(b, 0x8100)
+		b = binary.BigEndian.AppendUint16(b, 100)
+	}
+	b = binary.BigEndian.AppendUint16(b, etherType)
+	return append(b, payload...)
+}
+
+// capture writes a little-endian microsecond libpcap file.
+func capture(linkType uint32, frames ...[]byte) []byte {
+	var b []byte
+	b = binary.LittleEndian.AppendUint32(b, 0xa1b2c3d4)
+	b = binary.LittleEndian.AppendUint16(b, 2)
+	b = binary.LittleEndian.AppendUint16(b, 4)
+	b = append(b, make([]byte, 8)...)
+	b = binary.LittleEndian.AppendUint32(b, 65535)
+	b = binary.LittleEndian.AppendUint32(b, linkType)
+	for i, f := range frames {
+		b = binary.LittleEndian.AppendUint32(b, uint32(i))
+		b = binary.LittleEndian.AppendUint32(b, 0)
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(f)))
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(f)))
+		b = append(b, f...)
+	}
+	return b
+}
+
+func TestReplay(t *testing.T) {
+	ntp := ether(0x0800, false, ipv4(17, "198.51.100.1", "192.0.2.9", 0, udpHdr(123, 40000)))
+	syn := ether(0x0800, true, ipv4(6, "198.51.100.1", "203.0.113.5", 0x4000, tcpHdr(40000, 443, 0x02)))
+	other := ether(0x0800, false, ipv4(17, "198.51.100.1", "203.0.113.5", 0, udpHdr(1, 2)))
+	arp := ether(0x0806, false, make([]byte, 28))
+
+	rules := []fs.FSComponentList{
+		{Components: []fs.FSComponent{
+			{Type: fs.ComponentTypeDestinationPrefix, Prefix: prefix("192.0.2.0/24")},
+			{Type: fs.ComponentTypeIpProtocol, Raw: []byte{0x81, 0x11}},
+			{Type: fs.ComponentTypeSourcePort, Raw: []byte{0x81, 0x7b}},
+		}},
+		{Components: []fs.FSComponent{
+			{Type: fs.ComponentTypeTCPFlags, Raw: []byte{0x81, 0x02}},
+		}},
+		{Components: []fs.FSComponent{
+			{Type: fs.ComponentTypeDSCP, Raw: []byte{0x81, 0x2e}},
+		}},
+	}
+	file := capture(LinkEthernet, ntp, ntp, syn, other, arp)
+
+	tests := []struct {
+		name string
+		opts *Options
+		want Report
+	}{
+		{
+			name: "FirstMatch",
+			want: Report{
+				Rules:     []Count{{2, uint64(2 * len(ntp))}, {1, uint64(len(syn))}, {1, uint64(len(other))}},
+				Unmatched: Count{},
+				Skipped:   1,
+			},
+		},
+		{
+			name: "AllMatches",
+			opts: &Options{AllMatches: true},
+			want: Report{
+				Rules:   []Count{{2, uint64(2 * len(ntp))}, {1, uint64(len(syn))}, {4, uint64(2*len(ntp) + len(syn) + len(other))}},
+				Skipped: 1,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Replay(bytes.NewReader(file), rules, tt.opts)
+			if err != nil {
+				t.Fatalf("Replay() error = %v, want <nil>", err)
+			}
+			if !slices.Equal(got.Rules, tt.want.Rules) || got.Unmatched != tt.want.Unmatched || got.Skipped != tt.want.Skipped {
+				t.Errorf("Replay() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReplayErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    []byte
+		wantErr error
+	}{
+		{name: "Empty", wantErr: ErrNotPcap},
+		{name: "Pcapng", file: append([]byte{0x0a, 0x0d, 0x0d, 0x0a}, make([]byte, 20)...), wantErr: ErrNotPcap},
+		{name: "LinkType", file: capture(105), wantErr: ErrUnsupportedLink},
+		{name: "TruncatedRecord", file: capture(LinkRaw, make([]byte, 40))[:50], wantErr: ErrTruncated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Replay(bytes.NewReader(tt.file), nil, nil); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Replay() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDecodeIP(t *testing.T) {
+	v6 := make([]byte, 40)
+	v6[0], v6[1] = 0x6b, 0x80 // traffic class 0xb8: DSCP 46
+	binary.BigEndian.PutUint16(v6[4:], 8+8)
+	v6[6] = 44 // fragment header
+	copy(v6[8:], netip.MustParseAddr("2001:db8::1").AsSlice())
+	copy(v6[24:], netip.MustParseAddr("2001:db8::2").AsSlice())
+	frag := []byte{17, 0, 0x00, 0x01, 0, 0, 0, 1} // first fragment, more follow
+	v6 = append(append(v6, frag...), udpHdr(53, 5353)...)
+
+	tests := []struct {
+		name string
+		in   []byte
+		want matcher.Packet
+	}{
+		{
+			name: "IPv4LastFragment",
+			in:   ipv4(17, "192.0.2.1", "192.0.2.2", 0x0010, udpHdr(53, 53)),
+			want: matcher.Packet{
+				Src: netip.MustParseAddr("192.0.2.1"), Dst: netip.MustParseAddr("192.0.2.2"),
+				Protocol: 17, Length: 28, DSCP: 46, Fragment: fs.FragmentIsF | fs.FragmentLF,
+			},
+		},
+		{
+			name: "IPv4TCP",
+			in:   ipv4(6, "192.0.2.1", "192.0.2.2", 0x4000, tcpHdr(1, 2, 0x12)),
+			want: matcher.Packet{
+				Src: netip.MustParseAddr("192.0.2.1"), Dst: netip.MustParseAddr("192.0.2.2"),
+				Protocol: 6, SrcPort: 1, DstPort: 2, TCPFlags: 0x12, Length: 40, DSCP: 46, Fragment: fs.FragmentDF,
+			},
+		},
+		{
+			name: "IPv6FirstFragment",
+			in:   v6,
+			want: matcher.Packet{
+				Src: netip.MustParseAddr("2001:db8::1"), Dst: netip.MustParseAddr("2001:db8::2"),
+				Protocol: 17, SrcPort: 53, DstPort: 5353, Length: 56, DSCP: 46, Fragment: fs.FragmentIsF | fs.FragmentFF,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecodeIP(tt.in)
+			if err != nil {
+				t.Fatalf("DecodeIP() error = %v, want <nil>", err)
+			}
+			if *got != tt.want {
+				t.Errorf("DecodeIP() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,250 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package flowspecinternal
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net/netip"
+	"slices"
+	"sync"
+)
+
+var (
+	ErrComponentNotAllowed = NewError(StagePolicy, "component-not-allowed", "", "flowspec: rule rejected: component type not allowed for peer by policy")
+	ErrActionNotAllowed    = NewError(StagePolicy, "action-not-allowed", "", "flowspec: rule rejected: traffic action not allowed for peer by policy")
+	ErrActionOutOfScope    = NewError(StagePolicy, "action-out-of-scope", "", "flowspec: rule rejected: traffic action not allowed for destination prefix by policy")
+	ErrPrefixNotOwned      = NewError(StagePolicy, "prefix-not-owned", "", "flowspec: rule rejected: destination prefix not within the peer's prefixes")
+	ErrUnknownPeer         = NewError(StagePolicy, "unknown-peer", "", "flowspec: rule rejected: no validation policy for peer")
+)
+
+// ActionClass names a class of traffic actions (RFC8955 7) a PeerPolicy
+// may allow.
+type ActionClass string
+
+const (
+	ActionDiscard       ActionClass = "discard"        // traffic-rate-bytes or -packets of 0
+	ActionRateLimit     ActionClass = "rate-limit"     // traffic-rate-bytes or -packets above 0
+	ActionTrafficAction ActionClass = "traffic-action" // sample and terminal bits
+	ActionRedirect      ActionClass = "redirect"       // redirect to VRF, any variant
+	ActionMarking       ActionClass = "marking"        // traffic-marking
+)
+
+// actionClass classifies ec, reporting false if it is not a traffic action.
+func actionClass(ec [8]byte) (ActionClass, bool) {
+	switch binary.BigEndian.Uint16(ec[:2]) {
+	case 0x8006, 0x800c:
+		if math.Float32frombits(binary.BigEndian.Uint32(ec[4:])) == 0 {
+			return ActionDiscard, true
+		}
+		return ActionRateLimit, true
+	case 0x8007:
+		return ActionTrafficAction, true
+	case 0x8008, 0x8108, 0x8208:
+		return ActionRedirect, true
+	case 0x8009:
+		return ActionMarking, true
+	}
+	return "", false
+}
+
+// ActionRule allows a class of traffic actions, optionally only in rules
+// whose destination prefix is within one of Prefixes, e.g. a customer may
+// discard traffic towards its own address space only.
+type ActionRule struct {
+	Action ActionClass `json:"action"`
+	// Prefixes restricts the action to destinations within them; nil
+	// allows it for any destination.
+	Prefixes []netip.Prefix `json:"prefixes,omitempty"`
+}
+
+// allows reports whether r permits its action in a rule for dst, which is
+// nil without a destination prefix.
+func (r *ActionRule) allows(dst *netip.Prefix) bool {
+	if r.Prefixes == nil {
+		return true
+	}
+	if dst == nil {
+		return false
+	}
+	for _, p := range r.Prefixes {
+		if p.Bits() <= dst.Bits() && p.Contains(dst.Addr()) {
+			return true
+		}
+	}
+	return false
+}
+
+// PrefixOwner holds the address space of a peer, e.g. its customer cone.
+// The prefixlist package provides one read from prefix lists.
+type PrefixOwner interface {
+	// OwnsPrefix reports whether rules for destination prefix may be
+	// accepted from the peer.
+	OwnsPrefix(prefix netip.Prefix) bool
+}
+
+// PeerPolicy is the validation policy of one neighbor: its feasibility
+// Config, its Limits, and which components and actions it may use.
+type PeerPolicy struct {
+	Config
+	Limits Limits `json:"limits"`
+
+	// AllowedComponents lists the component types the peer may use; nil
+	// allows every type.
+	AllowedComponents []ComponentType `json:"allowed_components,omitempty"`
+
+	// AllowedActions lists the traffic actions the peer may send; nil
+	// allows every action. An action is allowed if any rule of its class
+	// allows it. Extended communities that are not RFC8955 actions, e.g.
+	// route targets, always pass.
+	AllowedActions []ActionRule `json:"allowed_actions,omitempty"`
+
+	// Prefixes, if set, is the address space of the peer: rules without a
+	// destination prefix within it are rejected with ErrPrefixNotOwned,
+	// whatever the unicast RIB holds.
+	Prefixes PrefixOwner `json:"-"`
+}
+
+// Check applies the component, prefix, action and size restrictions of p
+// to fs, returning ErrComponentNotAllowed, ErrPrefixNotOwned,
+// ErrActionNotAllowed, ErrActionOutOfScope or a Limits error.
+// The rule count limit is left to the receiver, see CheckRuleCount.
+func (p *PeerPolicy) Check(fs *FlowSpecRoute) error {
+	if p.AllowedComponents != nil {
+		for _, c := range fs.Components.Components {
+			if !slices.Contains(p.AllowedComponents, c.Type) {
+				return fmt.Errorf("%w: %s", ErrComponentNotAllowed, c.Type)
+			}
+		}
+	}
+	dst := destPrefix(fs)
+	if p.Prefixes != nil && (dst == nil || !p.Prefixes.OwnsPrefix(*dst)) {
+		return fmt.Errorf("%w: %v", ErrPrefixNotOwned, dst)
+	}
+	if p.AllowedActions != nil {
+		if err := p.checkActions(fs, dst); err != nil {
+			return err
+		}
+	}
+	afi := fs.AFI
+	if afi == 0 {
+		afi = AFIIPv4
+	}
+	return p.Limits.Check(fs.Components, afi)
+}
+
+// checkActions returns ErrActionNotAllowed for an action of a class the
+// policy does not list and ErrActionOutOfScope for one listed only for
+// other destinations.
+func (p *PeerPolicy) checkActions(fs *FlowSpecRoute, dst *netip.Prefix) error {
+	for _, ec := range fs.ExtCommunities {
+		class, ok := actionClass(ec)
+		if !ok {
+			continue
+		}
+		allowed, listed := false, false
+		for _, r := range p.AllowedActions {
+			if r.Action == class {
+				listed = true
+				allowed = allowed || r.allows(dst)
+			}
+		}
+		switch {
+		case !listed:
+			return fmt.Errorf("%w: %s", ErrActionNotAllowed, class)
+		case !allowed:
+			return fmt.Errorf("%w: %s to %v", ErrActionOutOfScope, class, dst)
+		}
+	}
+	return nil
+}
+
+// destPrefix returns the destination prefix of fs, from its components if
+// DestPrefix is not set.
+func destPrefix(fs *FlowSpecRoute) *netip.Prefix {
+	if fs.DestPrefix != nil {
+		return fs.DestPrefix
+	}
+	for _, c := range fs.Components.Components {
+		if c.Type == ComponentTypeDestinationPrefix {
+			return c.Prefix
+		}
+	}
+	return nil
+}
+
+// CheckRuleCount returns ErrRuleLimit if a peer holding n rules may not
+// add another.
+func (p *PeerPolicy) CheckRuleCount(n int) error {
+	if p.Limits.MaxRules > 0 && n >= p.Limits.MaxRules {
+		return fmt.Errorf("%w: %d rules", ErrRuleLimit, p.Limits.MaxRules)
+	}
+	return nil
+}
+
+// Validate checks fs against p and then its feasibility against rib.
+func (p *PeerPolicy) Validate(fs *FlowSpecRoute, rib UnicastRIB) error {
+	if err := p.Check(fs); err != nil {
+		return err
+	}
+	return ValidateFeasibility(fs, rib, &p.Config)
+}
+
+// ValidatorSet holds the PeerPolicy of each neighbor, keyed by neighbor
+// address, so a route server can trust customers differently. Its methods
+// are safe for concurrent use.
+type ValidatorSet struct {
+	mu    sync.RWMutex
+	def   *PeerPolicy
+	peers map[netip.Addr]*PeerPolicy
+}
+
+// NewValidatorSet returns a set applying def to peers without a policy of
+// their own; with a nil def their rules are rejected with ErrUnknownPeer.
+func NewValidatorSet(def *PeerPolicy) *ValidatorSet {
+	return &ValidatorSet{def: def, peers: map[netip.Addr]*PeerPolicy{}}
+}
+
+// Set installs the policy of peer, replacing any previous one. Policies
+// must not be modified once installed.
+func (s *ValidatorSet) Set(peer netip.Addr, p *PeerPolicy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.peers[peer.Unmap()] = p
+}
+
+// SetDefault replaces the policy of peers without one of their own.
+func (s *ValidatorSet) SetDefault(def *PeerPolicy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.def = def
+}
+
+// Delete removes the policy of peer, which falls back to the default.
+func (s *ValidatorSet) Delete(peer netip.Addr) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.peers, peer.Unmap())
+}
+
+// Policy returns the policy applied to peer, nil if there is none.
+func (s *ValidatorSet) Policy(peer netip.Addr) *PeerPolicy {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if p, ok := s.peers[peer.Unmap()]; ok {
+		return p
+	}
+	return s.def
+}
+
+// Validate validates fs received from peer under the peer's policy.
+func (s *ValidatorSet) Validate(peer netip.Addr, fs *FlowSpecRoute, rib UnicastRIB) error {
+	p := s.Policy(peer)
+	if p == nil {
+		return fmt.Errorf("%w %s", ErrUnknownPeer, peer)
+	}
+	return p.Validate(fs, rib)
+}
@@ -0,0 +1,109 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package flowspecinternal
+
+import (
+	"errors"
+	"net/netip"
+	"testing"
+)
+
+func TestPeerPolicyCheck(t *testing.T) {
+	dst := mustPrefix("192.0.2.0/24")
+	rate := [8]byte{0x80, 0x06, 0, 0, 0x44, 0x7a, 0, 0} // 1000 bytes/s
+	discard := [8]byte{0x80, 0x06}
+	redirect := [8]byte{0x80, 0x08}
+	routeTarget := [8]byte{0x00, 0x02}
+	policy := &PeerPolicy{
+		Limits:            Limits{MaxComponents: 2},
+		AllowedComponents: []ComponentType{ComponentTypeDestinationPrefix, ComponentTypeIpProtocol, ComponentTypePort},
+		AllowedActions: []ActionRule{
+			{Action: ActionRateLimit},
+			{Action: ActionDiscard, Prefixes: []netip.Prefix{mustPrefix("192.0.2.0/25"), mustPrefix("192.0.2.0/24")}},
+		},
+	}
+	other := mustPrefix("198.51.100.0/24")
+	host := mustPrefix("192.0.2.1/32")
+	tests := []struct {
+		name       string
+		components []FSComponent
+		ext        [][8]byte
+		want       error
+	}{
+		{name: "allowed", components: []FSComponent{{Type: ComponentTypeDestinationPrefix, Prefix: &dst}}, ext: [][8]byte{rate}},
+		{name: "route target", components: []FSComponent{{Type: ComponentTypeDestinationPrefix, Prefix: &dst}}, ext: [][8]byte{rate, routeTarget}},
+		{name: "component", components: []FSComponent{{Type: ComponentTypeSourcePrefix, Prefix: &dst}}, want: ErrComponentNotAllowed},
+		{name: "action", components: []FSComponent{{Type: ComponentTypeDestinationPrefix, Prefix: &dst}}, ext: [][8]byte{redirect}, want: ErrActionNotAllowed},
+		{name: "discard own prefix", components: []FSComponent{{Type: ComponentTypeDestinationPrefix, Prefix: &host}}, ext: [][8]byte{discard}},
+		{name: "discard other prefix", components: []FSComponent{{Type: ComponentTypeDestinationPrefix, Prefix: &other}}, ext: [][8]byte{discard}, want: ErrActionOutOfScope},
+		{name: "discard no prefix", components: []FSComponent{{Type: ComponentTypeIpProtocol, Raw: []byte{0x81, 0x06}}}, ext: [][8]byte{discard}, want: ErrActionOutOfScope},
+		{name: "rate limit other prefix", components: []FSComponent{{Type: ComponentTypeDestinationPrefix, Prefix: &other}}, ext: [][8]byte{rate}},
+		{
+			name: "limits",
+			components: []FSComponent{
+				{Type: ComponentTypeDestinationPrefix, Prefix: &dst},
+				{Type: ComponentTypeIpProtocol, Raw: []byte{0x81, 0x06}},
+				{Type: ComponentTypePort, Raw: []byte{0x81, 0x50}},
+			},
+			want: ErrComponentLimit,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &FlowSpecRoute{Components: FSComponentList{Components: tt.components}, ExtCommunities: tt.ext}
+			if err := policy.Check(r); !errors.Is(err, tt.want) {
+				t.Errorf("Check() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	if err := (&PeerPolicy{}).Check(&FlowSpecRoute{ExtCommunities: [][8]byte{redirect}}); err != nil {
+		t.Errorf("Check() without restrictions = %v", err)
+	}
+	if err := (&PeerPolicy{Limits: Limits{MaxRules: 2}}).CheckRuleCount(2); !errors.Is(err, ErrRuleLimit) {
+		t.Errorf("CheckRuleCount(2) = %v, want %v", err, ErrRuleLimit)
+	}
+}
+
+func TestValidatorSet(t *testing.T) {
+	dst := mustPrefix("192.0.2.0/24")
+	r := &FlowSpecRoute{
+		DestPrefix: &dst,
+		Components: FSComponentList{Components: []FSComponent{{Type: ComponentTypeSourcePrefix, Prefix: &dst}}},
+	}
+	customer := netip.MustParseAddr("198.51.100.1")
+	strict := &PeerPolicy{AllowedComponents: []ComponentType{ComponentTypeDestinationPrefix}}
+
+	s := NewValidatorSet(nil)
+	if err := s.Validate(customer, r, &mockRIB{}); !errors.Is(err, ErrUnknownPeer) {
+		t.Errorf("Validate() without policy = %v, want %v", err, ErrUnknownPeer)
+	}
+	s.Set(netip.MustParseAddr("::ffff:198.51.100.1"), strict)
+	if got := s.Policy(customer); got != strict {
+		t.Errorf("Policy() = %v, want the mapped address' policy", got)
+	}
+	if err := s.Validate(customer, r, &mockRIB{}); !errors.Is(err, ErrComponentNotAllowed) {
+		t.Errorf("Validate() = %v, want %v", err, ErrComponentNotAllowed)
+	}
+	s.Delete(customer)
+	if s.Policy(customer) != nil {
+		t.Error("Policy() after Delete() is not nil")
+	}
+	s.SetDefault(strict)
+	if got := s.Policy(customer); got != strict {
+		t.Errorf("Policy() after SetDefault() = %v, want the default", got)
+	}
+
+	for err, want := range map[error]string{
+		ErrComponentNotAllowed: "component-not-allowed",
+		ErrActionNotAllowed:    "action-not-allowed",
+		ErrActionOutOfScope:    "action-out-of-scope",
+		ErrUnknownPeer:         "unknown-peer",
+	} {
+		if got := Reason(err); got != want {
+			t.Errorf("Reason(%v) = %q, want %q", err, got, want)
+		}
+	}
+}
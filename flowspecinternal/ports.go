@@ -0,0 +1,105 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package flowspecinternal
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// maxPort is the largest TCP, UDP or SCTP port.
+const maxPort = 0xffff
+
+// PortRange is an inclusive range of ports.
+type PortRange struct {
+	From uint16
+	To   uint16
+}
+
+// String returns r as "80" or "1024-2048", as in the rule syntax.
+func (r PortRange) String() string {
+	if r.From == r.To {
+		return strconv.Itoa(int(r.From))
+	}
+	return fmt.Sprintf("%d-%d", r.From, r.To)
+}
+
+// IsPort reports whether t is one of the port component types (4, 5 and 6).
+func (t ComponentType) IsPort() bool {
+	return t == ComponentTypePort || t == ComponentTypeDestinationPort || t == ComponentTypeSourcePort
+}
+
+// PortRanges returns the ports ops accepts as sorted, disjoint ranges.
+func PortRanges(ops []NumericOp) []PortRange {
+	return toPortRanges(NumericRanges(ops, maxPort))
+}
+
+// PortOps returns the shortest operator sequence accepting the ports of
+// ranges, which need not be sorted or disjoint.
+func PortOps(ranges []PortRange) []NumericOp {
+	return NumericOpsFromRanges(fromPortRanges(ranges), maxPort)
+}
+
+// ComponentPortRanges returns the ports of the port component c.
+func ComponentPortRanges(c FSComponent) ([]PortRange, error) {
+	if !c.Type.IsPort() {
+		return nil, fmt.Errorf("%w: %s is not a port component", ErrInvalidComponentValue, c.Type)
+	}
+	ops, err := ParseNumericOps(c.Raw)
+	if err != nil {
+		return nil, err
+	}
+	return PortRanges(ops), nil
+}
+
+// PortComponent returns the port component of type t matching the ports of
+// ranges, e.g. PortComponent(ComponentTypeDestinationPort, PortRange{From: 80, To: 80}).
+func PortComponent(t ComponentType, ranges ...PortRange) (FSComponent, error) {
+	if !t.IsPort() {
+		return FSComponent{}, fmt.Errorf("%w: %s is not a port component", ErrInvalidComponentValue, t)
+	}
+	for _, r := range ranges {
+		if r.From > r.To {
+			return FSComponent{}, fmt.Errorf("%w: %s %d-%d", ErrInvalidComponentValue, t, r.From, r.To)
+		}
+	}
+	return FSComponent{Type: t, Raw: EncodeNumericOps(PortOps(ranges))}, nil
+}
+
+// IntersectPortRanges returns the ports in both a and b as sorted, disjoint
+// ranges.
+func IntersectPortRanges(a, b []PortRange) []PortRange {
+	return toPortRanges(IntersectRanges(fromPortRanges(a), fromPortRanges(b)))
+}
+
+// UnionPortRanges returns the ports in any of sets as sorted, disjoint ranges.
+func UnionPortRanges(sets ...[]PortRange) []PortRange {
+	var all []ValueRange
+	for _, r := range sets {
+		all = append(all, fromPortRanges(r)...)
+	}
+	return toPortRanges(UnionRanges(all))
+}
+
+func toPortRanges(r []ValueRange) []PortRange {
+	if r == nil {
+		return nil
+	}
+	out := make([]PortRange, len(r))
+	for i, x := range r {
+		out[i] = PortRange{From: uint16(x.From), To: uint16(x.To)}
+	}
+	return out
+}
+
+func fromPortRanges(r []PortRange) []ValueRange {
+	out := make([]ValueRange, 0, len(r))
+	for _, x := range r {
+		if x.From <= x.To {
+			out = append(out, ValueRange{From: uint64(x.From), To: uint64(x.To)})
+		}
+	}
+	return out
+}
@@ -0,0 +1,47 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package flowspecinternal
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestPortRanges(t *testing.T) {
+	l := mustParse(t, "dport 80,443,1024-2048")
+	got, err := ComponentPortRanges(l.Components[0])
+	want := []PortRange{{80, 80}, {443, 443}, {1024, 2048}}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Fatalf("ComponentPortRanges() = %v, %v, want %v", got, err, want)
+	}
+	c, err := PortComponent(ComponentTypeDestinationPort, PortRange{1024, 2048}, PortRange{443, 443}, PortRange{80, 80})
+	if got := (FSComponentList{Components: []FSComponent{c}}); err != nil || got.Canonical(nil) != l.Canonical(nil) {
+		t.Errorf("PortComponent() = %v, %v, want %v", got.Canonical(nil), err, l.Canonical(nil))
+	}
+	if _, err := PortComponent(ComponentTypeDSCP, PortRange{1, 1}); !errors.Is(err, ErrInvalidComponentValue) {
+		t.Errorf("PortComponent(dscp) error = %v, want %v", err, ErrInvalidComponentValue)
+	}
+	if got := (PortRange{1024, 2048}).String(); got != "1024-2048" {
+		t.Errorf("String() = %q", got)
+	}
+}
+
+func TestPortRangeSets(t *testing.T) {
+	a := []PortRange{{1000, 2000}, {80, 80}}
+	b := []PortRange{{1500, 3000}, {79, 81}}
+	if got, want := IntersectPortRanges(a, b), []PortRange{{80, 80}, {1500, 2000}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("IntersectPortRanges() = %v, want %v", got, want)
+	}
+	if got, want := UnionPortRanges(a, b, []PortRange{{82, 999}}), []PortRange{{79, 3000}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("UnionPortRanges() = %v, want %v", got, want)
+	}
+	if got := IntersectPortRanges(a, []PortRange{{3000, 4000}}); got != nil {
+		t.Errorf("IntersectPortRanges() = %v, want none", got)
+	}
+	if got, want := PortRanges(PortOps([]PortRange{{0, 65535}})), []PortRange{{0, 65535}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("PortRanges(PortOps(any)) = %v, want %v", got, want)
+	}
+}
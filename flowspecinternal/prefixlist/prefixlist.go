@@ -0,0 +1,230 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+// Package prefixlist holds the address space of a peer, its customer cone,
+// as a List implementing fs.PrefixOwner:
+//
+//	entries, err := prefixlist.Read(f) // e.g. generated with bgpq4
+//	policy := &fs.PeerPolicy{Prefixes: prefixlist.New(entries)}
+//
+// The longest entry covering a destination prefix decides whether it is
+// owned, so a deny entry can carve a more-specific out of a permitted
+// aggregate.
+package prefixlist
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrInvalidEntry = errors.New("prefixlist: invalid entry")
+)
+
+// Entry permits, or with Deny excludes, Prefix and those of its
+// more-specifics with a length between MinLength and MaxLength.
+type Entry struct {
+	Prefix    netip.Prefix
+	MinLength uint8
+	MaxLength uint8
+	Deny      bool
+}
+
+func (e Entry) String() string {
+	action := "permit"
+	if e.Deny {
+		action = "deny"
+	}
+	s := fmt.Sprintf("%s %s", action, e.Prefix)
+	if int(e.MinLength) > e.Prefix.Bits() {
+		s += fmt.Sprintf(" ge %d", e.MinLength)
+	}
+	if int(e.MaxLength) < e.Prefix.Addr().BitLen() {
+		s += fmt.Sprintf(" le %d", e.MaxLength)
+	}
+	return s
+}
+
+// Valid reports whether e is well formed: a masked prefix and lengths
+// ordered prefix length <= MinLength <= MaxLength <= address size.
+func (e Entry) Valid() bool {
+	return e.Prefix.IsValid() && e.Prefix == e.Prefix.Masked() &&
+		int(e.MinLength) >= e.Prefix.Bits() && e.MinLength <= e.MaxLength &&
+		int(e.MaxLength) <= e.Prefix.Addr().BitLen()
+}
+
+// matches reports whether e covers p, which it contains.
+func (e Entry) matches(p netip.Prefix) bool {
+	return p.Bits() >= int(e.MinLength) && p.Bits() <= int(e.MaxLength)
+}
+
+// List is a set of entries indexed by prefix. The zero value is empty and
+// owns nothing. Its methods are safe for concurrent use.
+type List struct {
+	mu      sync.RWMutex
+	entries map[netip.Prefix][]Entry
+	n       int
+}
+
+// New returns a List holding entries; invalid ones are skipped.
+func New(entries []Entry) *List {
+	l := &List{}
+	l.Replace(entries)
+	return l
+}
+
+// Replace discards the contents of l for entries.
+func (l *List) Replace(entries []Entry) {
+	m := make(map[netip.Prefix][]Entry, len(entries))
+	n := 0
+	for _, e := range entries {
+		if e.Valid() && !slices.Contains(m[e.Prefix], e) {
+			m[e.Prefix] = append(m[e.Prefix], e)
+			n++
+		}
+	}
+	l.mu.Lock()
+	l.entries, l.n = m, n
+	l.mu.Unlock()
+}
+
+// Len returns the number of entries in l.
+func (l *List) Len() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.n
+}
+
+// Lookup returns the entry deciding about p: the one with the longest
+// prefix covering p whose length range includes it, with deny entries
+// taking precedence among those of the same prefix.
+func (l *List) Lookup(p netip.Prefix) (Entry, bool) {
+	p = p.Masked()
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	for bits := p.Bits(); bits >= 0; bits-- {
+		q, _ := p.Addr().Prefix(bits)
+		var (
+			found Entry
+			ok    bool
+		)
+		for _, e := range l.entries[q] {
+			if e.matches(p) && (!ok || e.Deny) {
+				found, ok = e, true
+			}
+		}
+		if ok {
+			return found, true
+		}
+	}
+	return Entry{}, false
+}
+
+// OwnsPrefix implements fs.PrefixOwner: p is owned if the entry deciding
+// about it permits it.
+func (l *List) OwnsPrefix(p netip.Prefix) bool {
+	e, ok := l.Lookup(p)
+	return ok && !e.Deny
+}
+
+// Read reads a prefix list, one entry per line, in either of two forms:
+//
+//	192.0.2.0/24
+//	ip prefix-list AS64500 seq 5 permit 192.0.2.0/24 le 32
+//
+// A bare prefix, as printed by bgpq4 -F '%n/%l\n', owns itself and all its
+// more-specifics. The Cisco IOS/FRR form ("ipv6 prefix-list" too) has the
+// usual semantics: without ge and le only the prefix itself matches. Empty
+// lines and lines starting with "#" or "!" are ignored.
+func Read(r io.Reader) ([]Entry, error) {
+	var out []Entry
+	sc := bufio.NewScanner(r)
+	for line := 1; sc.Scan(); line++ {
+		f := strings.Fields(sc.Text())
+		if len(f) == 0 || strings.HasPrefix(f[0], "#") || strings.HasPrefix(f[0], "!") {
+			continue
+		}
+		e, err := parseEntry(f)
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %d: %s", ErrInvalidEntry, line, err)
+		}
+		out = append(out, e)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func parseEntry(f []string) (Entry, error) {
+	if len(f) == 1 {
+		p, err := netip.ParsePrefix(f[0])
+		if err != nil {
+			return Entry{}, err
+		}
+		p = p.Masked()
+		return Entry{Prefix: p, MinLength: uint8(p.Bits()), MaxLength: uint8(p.Addr().BitLen())}, nil
+	}
+
+	// [ip|ipv6] prefix-list NAME [seq N] permit|deny PREFIX [ge N] [le N]
+	if f[0] == "ip" || f[0] == "ipv6" {
+		f = f[1:]
+	}
+	if len(f) < 4 || f[0] != "prefix-list" {
+		return Entry{}, fmt.Errorf("unrecognized line %q", strings.Join(f, " "))
+	}
+	f = f[2:]
+	if f[0] == "seq" {
+		if len(f) < 4 {
+			return Entry{}, errors.New("missing sequence number")
+		}
+		f = f[2:]
+	}
+	var e Entry
+	switch f[0] {
+	case "permit":
+	case "deny":
+		e.Deny = true
+	default:
+		return Entry{}, fmt.Errorf("unknown action %q", f[0])
+	}
+	p, err := netip.ParsePrefix(f[1])
+	if err != nil {
+		return Entry{}, err
+	}
+	e.Prefix = p.Masked()
+	e.MinLength, e.MaxLength = uint8(p.Bits()), uint8(p.Bits())
+	ge, le := false, false
+	for f = f[2:]; len(f) > 0; f = f[2:] {
+		if len(f) < 2 {
+			return Entry{}, fmt.Errorf("missing value for %q", f[0])
+		}
+		n, err := strconv.ParseUint(f[1], 10, 8)
+		if err != nil {
+			return Entry{}, fmt.Errorf("invalid length %q", f[1])
+		}
+		switch f[0] {
+		case "ge":
+			e.MinLength, ge = uint8(n), true
+		case "le":
+			e.MaxLength, le = uint8(n), true
+		default:
+			return Entry{}, fmt.Errorf("unknown keyword %q", f[0])
+		}
+	}
+	if ge && !le {
+		e.MaxLength = uint8(p.Addr().BitLen())
+	}
+	if !e.Valid() {
+		return Entry{}, fmt.Errorf("invalid lengths in %s", e)
+	}
+	return e, nil
+}
@@ -0,0 +1,111 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package prefixlist
+
+import (
+	"errors"
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+
+	fs "floofspectools/flowspecinternal"
+)
+
+const testList = `# AS64500 customer cone
+192.0.2.0/24
+2001:db8::/32
+ip prefix-list AS64500 seq 10 deny 192.0.2.128/25 ge 26
+ip prefix-list AS64500 seq 20 permit 198.51.100.0/24
+ipv6 prefix-list AS64500 permit 2001:db8:1::/48 le 64
+!
+`
+
+func TestRead(t *testing.T) {
+	got, err := Read(strings.NewReader(testList))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Entry{
+		{Prefix: netip.MustParsePrefix("192.0.2.0/24"), MinLength: 24, MaxLength: 32},
+		{Prefix: netip.MustParsePrefix("2001:db8::/32"), MinLength: 32, MaxLength: 128},
+		{Prefix: netip.MustParsePrefix("192.0.2.128/25"), MinLength: 26, MaxLength: 32, Deny: true},
+		{Prefix: netip.MustParsePrefix("198.51.100.0/24"), MinLength: 24, MaxLength: 24},
+		{Prefix: netip.MustParsePrefix("2001:db8:1::/48"), MinLength: 48, MaxLength: 64},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Read() = %v, want %v", got, want)
+	}
+
+	for _, bad := range []string{
+		"192.0.2.0",
+		"ip prefix-list X accept 192.0.2.0/24",
+		"ip prefix-list X permit 192.0.2.0/24 ge 20",
+		"ip prefix-list X permit 192.0.2.0/24 le",
+		"route 192.0.2.0/24",
+	} {
+		if _, err := Read(strings.NewReader(bad)); !errors.Is(err, ErrInvalidEntry) {
+			t.Errorf("Read(%q) error = %v, want %v", bad, err, ErrInvalidEntry)
+		}
+	}
+}
+
+func TestOwnsPrefix(t *testing.T) {
+	entries, err := Read(strings.NewReader(testList))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := New(entries)
+	var _ fs.PrefixOwner = l
+	tests := []struct {
+		prefix string
+		want   bool
+	}{
+		{"192.0.2.0/24", true},
+		{"192.0.2.1/32", true},
+		{"192.0.2.128/25", true}, // shorter than the deny entry's ge
+		{"192.0.2.192/26", false},
+		{"192.0.2.200/32", false},
+		{"192.0.0.0/16", false},
+		{"198.51.100.0/24", true},
+		{"198.51.100.0/25", false},
+		{"2001:db8:ffff::/48", true},
+		{"2001:db8:1::/64", true},
+		{"203.0.113.0/24", false},
+	}
+	for _, tt := range tests {
+		if got := l.OwnsPrefix(netip.MustParsePrefix(tt.prefix)); got != tt.want {
+			t.Errorf("OwnsPrefix(%s) = %v, want %v", tt.prefix, got, tt.want)
+		}
+	}
+	if l.Len() != len(entries) {
+		t.Errorf("Len() = %d, want %d", l.Len(), len(entries))
+	}
+	var empty List
+	if empty.OwnsPrefix(netip.MustParsePrefix("192.0.2.0/24")) {
+		t.Error("zero List owns a prefix")
+	}
+}
+
+func TestPeerPolicyPrefixes(t *testing.T) {
+	l := New([]Entry{{Prefix: netip.MustParsePrefix("192.0.2.0/24"), MinLength: 24, MaxLength: 32}})
+	p := &fs.PeerPolicy{Prefixes: l}
+	for dst, want := range map[string]error{
+		"192.0.2.64/26":   nil,
+		"198.51.100.0/24": fs.ErrPrefixNotOwned,
+	} {
+		d := netip.MustParsePrefix(dst)
+		r := &fs.FlowSpecRoute{DestPrefix: &d}
+		if err := p.Check(r); !errors.Is(err, want) {
+			t.Errorf("Check(%s) = %v, want %v", dst, err, want)
+		}
+	}
+	if err := p.Check(&fs.FlowSpecRoute{}); !errors.Is(err, fs.ErrPrefixNotOwned) {
+		t.Errorf("Check(no destination) = %v, want %v", err, fs.ErrPrefixNotOwned)
+	}
+	if got := fs.Reason(fs.ErrPrefixNotOwned); got != "prefix-not-owned" {
+		t.Errorf("Reason() = %q", got)
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package query
+
+import (
+	"net/netip"
+	"slices"
+	"strings"
+
+	"floofspectools/flowspecinternal/rib"
+)
+
+// Probe is a lookup in the destination prefix index of a snapshot.
+type Probe struct {
+	// Covering selects the rules whose destination contains Prefix, else
+	// those whose destination lies within it.
+	Covering bool
+	Prefix   netip.Prefix
+}
+
+func (p Probe) String() string {
+	if p.Covering {
+		return "dst covers " + p.Prefix.String()
+	}
+	return "dst within " + p.Prefix.String()
+}
+
+// Plan is how Run evaluates a query: by scanning every rule or, if Probes
+// is not empty, by filtering the union of the rules the probes return.
+type Plan struct {
+	Probes []Probe
+}
+
+// String renders p, e.g. "scan" or "index dst within 203.0.113.0/24".
+func (p Plan) String() string {
+	if len(p.Probes) == 0 {
+		return "scan"
+	}
+	s := make([]string, len(p.Probes))
+	for i, pr := range p.Probes {
+		s[i] = pr.String()
+	}
+	return "index " + strings.Join(s, ", ")
+}
+
+// probes returns index lookups returning a superset of the rules n
+// matches, false if n needs a scan.
+func probes(n node) ([]Probe, bool) {
+	switch n := n.(type) {
+	case *cmp:
+		if n.field != "dst" {
+			return nil, false
+		}
+		switch n.op {
+		case "within", "==":
+			return []Probe{{Prefix: n.prefix}}, true
+		case "covers":
+			return []Probe{{Covering: true, Prefix: n.prefix}}, true
+		}
+	case and:
+		// Any indexable operand bounds the conjunction; take the one with
+		// the fewest probes, the longest prefix on a tie.
+		var best []Probe
+		found := false
+		for _, x := range n {
+			if p, ok := probes(x); ok && (!found || better(p, best)) {
+				best, found = p, true
+			}
+		}
+		return best, found
+	case or:
+		var out []Probe
+		for _, x := range n {
+			p, ok := probes(x)
+			if !ok {
+				return nil, false
+			}
+			out = append(out, p...)
+		}
+		return out, true
+	}
+	return nil, false
+}
+
+func better(a, b []Probe) bool {
+	if len(a) != len(b) {
+		return len(a) < len(b)
+	}
+	return len(a) == 1 && !a[0].Covering && a[0].Prefix.Bits() > b[0].Prefix.Bits()
+}
+
+// Plan returns how Run evaluates q.
+func (q *Query) Plan() Plan {
+	p, _ := probes(q.root)
+	return Plan{Probes: p}
+}
+
+// Run returns the entries of s matching q in the order of s.
+func (q *Query) Run(s *rib.FlowSpecSnapshot) []*rib.FlowSpecEntry {
+	plan := q.Plan()
+	var out []*rib.FlowSpecEntry
+	if len(plan.Probes) == 0 {
+		for e := range s.All() {
+			if q.Match(e) {
+				out = append(out, e)
+			}
+		}
+		return out
+	}
+	seen := map[string]bool{}
+	for _, p := range plan.Probes {
+		candidates := s.CoveredBy(p.Prefix)
+		if p.Covering {
+			candidates = s.Covering(p.Prefix)
+		}
+		for _, e := range candidates {
+			if !seen[e.Key] && q.Match(e) {
+				seen[e.Key] = true
+				out = append(out, e)
+			}
+		}
+	}
+	if len(plan.Probes) > 1 {
+		slices.SortFunc(out, rib.CompareEntries)
+	}
+	return out
+}
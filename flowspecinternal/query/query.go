@@ -0,0 +1,490 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+// Package query is a filter language for searching the rules of a
+// FlowSpecRIB, e.g.
+//
+//	dst within 203.0.113.0/24 and action == discard and peer == 65001
+//
+// An expression combines comparisons with and, or, not and parentheses; and
+// binds tighter than or. The fields are
+//
+//	dst, src    within, covers, overlaps, ==, !=   prefix of the rule
+//	action      ==, !=                  discard, rate-limit, redirect, mark or accept
+//	peer        ==, !=, <, <=, >, >=    neighbor AS the rule came from
+//	proto       ==, !=                  IP protocol, number or name
+//	port, dport, sport  ==, !=          port, number or name
+//	family      ==, !=                  ipv4 or ipv6
+//	feasible    ==, !=                  true or false
+//	stale       ==, !=                  true or false
+//	reason      ==, !=                  rejection reason, see fs.Reason
+//	meta.KEY    ==, !=                  value of a FlowSpecRoute.Metadata key
+//
+// "dst within P" selects rules whose destination lies within P, "dst
+// covers P" those whose destination contains P. A rule with several
+// actions has each of their classes; one without actions is accept. Rules
+// without a protocol or port component admit every value, so "proto ==
+// udp" selects the rules applying to UDP traffic. Values with spaces are
+// double quoted.
+//
+// Run evaluates a query against a snapshot, answering destination prefix
+// conditions from the snapshot's prefix index instead of scanning every
+// rule; Plan tells which it does.
+package query
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/actions"
+	"floofspectools/flowspecinternal/analysis"
+	"floofspectools/flowspecinternal/rib"
+)
+
+var (
+	ErrSyntax = errors.New("query: syntax error")
+)
+
+// node is an expression of the syntax tree.
+type node interface {
+	match(e *rib.FlowSpecEntry) bool
+	String() string
+}
+
+type and []node
+type or []node
+type not struct{ x node }
+
+func (n and) match(e *rib.FlowSpecEntry) bool {
+	for _, x := range n {
+		if !x.match(e) {
+			return false
+		}
+	}
+	return true
+}
+
+func (n or) match(e *rib.FlowSpecEntry) bool {
+	for _, x := range n {
+		if x.match(e) {
+			return true
+		}
+	}
+	return false
+}
+
+func (n not) match(e *rib.FlowSpecEntry) bool { return !n.x.match(e) }
+
+func join(nodes []node, op string) string {
+	s := make([]string, len(nodes))
+	for i, x := range nodes {
+		s[i] = x.String()
+		if _, ok := x.(or); ok {
+			s[i] = "(" + s[i] + ")"
+		}
+	}
+	return strings.Join(s, " "+op+" ")
+}
+
+func (n and) String() string { return join(n, "and") }
+func (n or) String() string  { return join(n, "or") }
+
+func (n not) String() string {
+	if _, ok := n.x.(*cmp); ok {
+		return "not " + n.x.String()
+	}
+	return "not (" + n.x.String() + ")"
+}
+
+// cmp is a comparison of a field with a value.
+type cmp struct {
+	field, op, value string
+	// parsed value, by field
+	prefix netip.Prefix
+	class  analysis.Class
+	num    uint64
+	flag   bool
+	typ    fs.ComponentType
+}
+
+func (c *cmp) String() string {
+	v := c.value
+	if v == "" || strings.ContainsAny(v, " ()\"") {
+		v = strconv.Quote(v)
+	}
+	return c.field + " " + c.op + " " + v
+}
+
+// Query is a parsed filter expression.
+type Query struct {
+	root node
+}
+
+// Parse parses a filter expression; the empty one matches every rule.
+func Parse(s string) (*Query, error) {
+	toks, err := lex(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(toks) == 0 {
+		return &Query{root: and{}}, nil
+	}
+	p := &parser{toks: toks}
+	root, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if t, ok := p.peek(); ok {
+		return nil, fmt.Errorf("%w at %d: unexpected %q", ErrSyntax, t.pos, t.text)
+	}
+	return &Query{root: root}, nil
+}
+
+// String returns the query in normalized form.
+func (q *Query) String() string {
+	return q.root.String()
+}
+
+// Match reports whether the rule of e matches q.
+func (q *Query) Match(e *rib.FlowSpecEntry) bool {
+	return q.root.match(e)
+}
+
+type token struct {
+	text   string
+	pos    int
+	quoted bool
+}
+
+func lex(s string) ([]token, error) {
+	var toks []token
+	for i := 0; i < len(s); {
+		switch c := s[i]; {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case c == '(' || c == ')':
+			toks = append(toks, token{text: s[i : i+1], pos: i})
+			i++
+		case c == '"':
+			v, err := strconv.QuotedPrefix(s[i:])
+			if err != nil {
+				return nil, fmt.Errorf("%w at %d: unterminated string", ErrSyntax, i)
+			}
+			text, _ := strconv.Unquote(v)
+			toks = append(toks, token{text: text, pos: i, quoted: true})
+			i += len(v)
+		default:
+			j := i
+			for j < len(s) && !strings.ContainsRune(" \t\n()\"", rune(s[j])) {
+				j++
+			}
+			toks = append(toks, token{text: s[i:j], pos: i})
+			i = j
+		}
+	}
+	return toks, nil
+}
+
+type parser struct {
+	toks []token
+	i    int
+}
+
+func (p *parser) peek() (token, bool) {
+	if p.i < len(p.toks) {
+		return p.toks[p.i], true
+	}
+	return token{}, false
+}
+
+// keyword consumes the unquoted word kw if it is next.
+func (p *parser) keyword(kw string) bool {
+	if t, ok := p.peek(); ok && !t.quoted && strings.EqualFold(t.text, kw) {
+		p.i++
+		return true
+	}
+	return false
+}
+
+func (p *parser) next(what string) (token, error) {
+	t, ok := p.peek()
+	if !ok {
+		return t, fmt.Errorf("%w: missing %s at the end", ErrSyntax, what)
+	}
+	p.i++
+	return t, nil
+}
+
+func (p *parser) or() (node, error) {
+	var n or
+	for {
+		x, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		n = append(n, x)
+		if !p.keyword("or") {
+			break
+		}
+	}
+	if len(n) == 1 {
+		return n[0], nil
+	}
+	return n, nil
+}
+
+func (p *parser) and() (node, error) {
+	var n and
+	for {
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		n = append(n, x)
+		if !p.keyword("and") {
+			break
+		}
+	}
+	if len(n) == 1 {
+		return n[0], nil
+	}
+	return n, nil
+}
+
+func (p *parser) unary() (node, error) {
+	if p.keyword("not") {
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return not{x}, nil
+	}
+	if p.keyword("(") {
+		x, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if !p.keyword(")") {
+			t, _ := p.next(`")"`)
+			return nil, fmt.Errorf("%w at %d: missing \")\"", ErrSyntax, t.pos)
+		}
+		return x, nil
+	}
+	return p.cmp()
+}
+
+// operators allowed per field.
+var fieldOps = map[string][]string{
+	"dst":      {"within", "covers", "overlaps", "==", "!="},
+	"src":      {"within", "covers", "overlaps", "==", "!="},
+	"action":   {"==", "!="},
+	"peer":     {"==", "!=", "<", "<=", ">", ">="},
+	"proto":    {"==", "!="},
+	"port":     {"==", "!="},
+	"dport":    {"==", "!="},
+	"sport":    {"==", "!="},
+	"family":   {"==", "!="},
+	"feasible": {"==", "!="},
+	"stale":    {"==", "!="},
+	"reason":   {"==", "!="},
+	"meta.":    {"==", "!="},
+}
+
+func (p *parser) cmp() (node, error) {
+	f, err := p.next("field")
+	if err != nil {
+		return nil, err
+	}
+	field := strings.ToLower(f.text)
+	key := field
+	if strings.HasPrefix(field, "meta.") {
+		// Keys keep their case.
+		key, field = "meta.", "meta."+f.text[len("meta."):]
+		if field == "meta." {
+			key = ""
+		}
+	}
+	ops, ok := fieldOps[key]
+	if f.quoted || !ok {
+		return nil, fmt.Errorf("%w at %d: unknown field %q", ErrSyntax, f.pos, f.text)
+	}
+	o, err := p.next("operator")
+	if err != nil {
+		return nil, err
+	}
+	op := strings.ToLower(o.text)
+	if o.quoted || !slices.Contains(ops, op) {
+		return nil, fmt.Errorf("%w at %d: %s does not take %q", ErrSyntax, o.pos, field, o.text)
+	}
+	v, err := p.next("value")
+	if err != nil {
+		return nil, err
+	}
+	c := &cmp{field: field, op: op, value: v.text}
+	if err := c.parseValue(key); err != nil {
+		return nil, fmt.Errorf("%w at %d: %s: %v", ErrSyntax, v.pos, field, err)
+	}
+	return c, nil
+}
+
+func (c *cmp) parseValue(key string) error {
+	var err error
+	switch key {
+	case "dst", "src":
+		if c.prefix, err = netip.ParsePrefix(c.value); err != nil {
+			a, aerr := netip.ParseAddr(c.value)
+			if aerr != nil {
+				return err
+			}
+			c.prefix = netip.PrefixFrom(a, a.BitLen())
+		}
+		c.prefix = c.prefix.Masked()
+		c.value = c.prefix.String()
+	case "action":
+		return c.class.UnmarshalText([]byte(strings.ToLower(c.value)))
+	case "peer":
+		c.num, err = strconv.ParseUint(strings.TrimPrefix(strings.ToUpper(c.value), "AS"), 10, 32)
+		return err
+	case "proto":
+		c.typ = fs.ComponentTypeIpProtocol
+		p, err := fs.ParseProtocol(c.value)
+		c.num = uint64(p)
+		return err
+	case "port", "dport", "sport":
+		c.typ = map[string]fs.ComponentType{"port": fs.ComponentTypePort, "dport": fs.ComponentTypeDestinationPort, "sport": fs.ComponentTypeSourcePort}[key]
+		p, err := fs.ParsePort(c.value)
+		c.num = uint64(p)
+		return err
+	case "family":
+		switch strings.ToLower(c.value) {
+		case "ipv4":
+			c.num = uint64(fs.AFIIPv4)
+		case "ipv6":
+			c.num = uint64(fs.AFIIPv6)
+		default:
+			return fmt.Errorf("unknown family %q", c.value)
+		}
+	case "feasible", "stale":
+		c.flag, err = strconv.ParseBool(c.value)
+		return err
+	}
+	return nil
+}
+
+// destination returns the destination prefix of route, from DestPrefix or
+// its destination prefix component.
+func destination(route *fs.FlowSpecRoute) (netip.Prefix, bool) {
+	if route.DestPrefix != nil {
+		return route.DestPrefix.Masked(), true
+	}
+	return component(route, fs.ComponentTypeDestinationPrefix)
+}
+
+func component(route *fs.FlowSpecRoute, t fs.ComponentType) (netip.Prefix, bool) {
+	for _, c := range route.Components.Components {
+		if c.Type == t && c.Prefix != nil {
+			return c.Prefix.Masked(), true
+		}
+	}
+	return netip.Prefix{}, false
+}
+
+// admits reports whether the component t of route admits v, true if route
+// has none.
+func admits(route *fs.FlowSpecRoute, t fs.ComponentType, v, max uint64) bool {
+	for _, c := range route.Components.Components {
+		if c.Type != t {
+			continue
+		}
+		ops, err := fs.ParseNumericOps(c.Raw)
+		if err != nil {
+			return false
+		}
+		for _, r := range fs.NumericRanges(ops, max) {
+			if r.From <= v && v <= r.To {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// classes returns the action classes of route.
+func classes(route *fs.FlowSpecRoute) []analysis.Class {
+	var out []analysis.Class
+	for _, ec := range route.ExtCommunities {
+		a, err := actions.Decode(ec)
+		if err != nil {
+			continue
+		}
+		if c := analysis.ClassOf([]actions.Action{a}); c != analysis.ClassAccept {
+			out = append(out, c)
+		}
+	}
+	if len(out) == 0 {
+		out = append(out, analysis.ClassAccept)
+	}
+	return out
+}
+
+func (c *cmp) match(e *rib.FlowSpecEntry) bool {
+	r := e.Route
+	var eq bool
+	switch c.field {
+	case "dst", "src":
+		var p netip.Prefix
+		var ok bool
+		if c.field == "dst" {
+			p, ok = destination(r)
+		} else {
+			p, ok = component(r, fs.ComponentTypeSourcePrefix)
+		}
+		switch c.op {
+		case "within":
+			return ok && c.prefix.Bits() <= p.Bits() && c.prefix.Contains(p.Addr())
+		case "covers":
+			return ok && p.Bits() <= c.prefix.Bits() && p.Contains(c.prefix.Addr())
+		case "overlaps":
+			return ok && p.Overlaps(c.prefix)
+		}
+		eq = ok && p == c.prefix
+	case "action":
+		eq = slices.Contains(classes(r), c.class)
+	case "peer":
+		as := uint64(r.NeighborAS)
+		switch c.op {
+		case "<":
+			return as < c.num
+		case "<=":
+			return as <= c.num
+		case ">":
+			return as > c.num
+		case ">=":
+			return as >= c.num
+		}
+		eq = as == c.num
+	case "proto":
+		eq = admits(r, c.typ, c.num, 255)
+	case "port", "dport", "sport":
+		eq = admits(r, c.typ, c.num, 65535)
+	case "family":
+		eq = uint64(r.AFI) == c.num
+	case "feasible":
+		eq = (e.Err == nil) == c.flag
+	case "stale":
+		eq = e.Stale == c.flag
+	case "reason":
+		eq = fs.Reason(e.Err) == c.value
+	default: // meta.KEY
+		v, ok := r.Metadata[c.field[len("meta."):]]
+		eq = ok && v == c.value
+	}
+	return eq == (c.op == "==")
+}
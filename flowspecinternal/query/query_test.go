@@ -0,0 +1,145 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package query
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/actions"
+	"floofspectools/flowspecinternal/rib"
+)
+
+func testRIB(t *testing.T) *rib.FlowSpecSnapshot {
+	t.Helper()
+	r := rib.NewFlowSpecRIB(nil)
+	for _, rule := range []struct {
+		s    string
+		as   uint32
+		err  error
+		meta map[string]string
+	}{
+		{"dst 203.0.113.0/25 proto udp then discard", 65001, nil, map[string]string{"ticket": "INC-1"}},
+		{"dst 203.0.113.7/32 dport 53 then rate-limit 10M", 65001, nil, nil},
+		{"dst 203.0.113.0/24 proto tcp then redirect 65000:1", 65002, fs.ErrNoBestUnicast, nil},
+		{"dst 198.51.100.0/24 src 192.0.2.0/24 then discard", 65002, nil, map[string]string{"ticket": "INC-2"}},
+		{"dst 10.0.0.0/8 dport >=1024", 65003, nil, nil},
+		{"dst 2001:db8::/48 proto tcp then discard", 65001, nil, nil},
+	} {
+		list, acts, err := actions.ParseRule(rule.s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		route := &fs.FlowSpecRoute{AFI: fs.AFIIPv4, SAFI: fs.SAFIFlowSpec, Components: list, NeighborAS: rule.as, Metadata: rule.meta}
+		if list.Components[0].Prefix.Addr().Is6() {
+			route.AFI = fs.AFIIPv6
+		}
+		for _, a := range acts {
+			route.ExtCommunities = append(route.ExtCommunities, a.ExtendedCommunity())
+		}
+		r.Insert(route, rule.err)
+	}
+	return r.Snapshot()
+}
+
+func dsts(entries []*rib.FlowSpecEntry) []string {
+	var out []string
+	for _, e := range entries {
+		p, _ := destination(e.Route)
+		out = append(out, p.String())
+	}
+	return out
+}
+
+func TestRun(t *testing.T) {
+	s := testRIB(t)
+	for _, tt := range []struct {
+		q    string
+		want []string
+		plan string
+	}{
+		{"", []string{"10.0.0.0/8", "198.51.100.0/24", "203.0.113.7/32", "203.0.113.0/25", "203.0.113.0/24", "2001:db8::/48"}, "scan"},
+		{"dst within 203.0.113.0/24 and action == discard and peer == 65001", []string{"203.0.113.0/25"}, "index dst within 203.0.113.0/24"},
+		{"dst within 203.0.113.0/25", []string{"203.0.113.7/32", "203.0.113.0/25"}, "index dst within 203.0.113.0/25"},
+		{"dst covers 203.0.113.7", []string{"203.0.113.7/32", "203.0.113.0/25", "203.0.113.0/24"}, "index dst covers 203.0.113.7/32"},
+		{"dst == 203.0.113.0/24", []string{"203.0.113.0/24"}, "index dst within 203.0.113.0/24"},
+		{"dst overlaps 203.0.113.128/25", []string{"203.0.113.0/24"}, "scan"},
+		{"dst within 198.51.100.0/24 or dst within 10.0.0.0/8", []string{"10.0.0.0/8", "198.51.100.0/24"}, "index dst within 198.51.100.0/24, dst within 10.0.0.0/8"},
+		{"dst within 10.0.0.0/8 or peer == 65001", []string{"10.0.0.0/8", "203.0.113.7/32", "203.0.113.0/25", "2001:db8::/48"}, "scan"},
+		{"src within 192.0.2.0/24", []string{"198.51.100.0/24"}, "scan"},
+		{"action == rate-limit", []string{"203.0.113.7/32"}, "scan"},
+		{"action == accept", []string{"10.0.0.0/8"}, "scan"},
+		{"action != discard and family == ipv4", []string{"10.0.0.0/8", "203.0.113.7/32", "203.0.113.0/24"}, "scan"},
+		{"peer >= AS65002", []string{"10.0.0.0/8", "198.51.100.0/24", "203.0.113.0/24"}, "scan"},
+		{"proto == udp", []string{"10.0.0.0/8", "198.51.100.0/24", "203.0.113.7/32", "203.0.113.0/25"}, "scan"},
+		{"dport == 53 and dst within 0.0.0.0/0", []string{"198.51.100.0/24", "203.0.113.7/32", "203.0.113.0/25", "203.0.113.0/24"}, "index dst within 0.0.0.0/0"},
+		{"dport == 8080 and not proto == udp", []string{"203.0.113.0/24", "2001:db8::/48"}, "scan"},
+		{"feasible == false", []string{"203.0.113.0/24"}, "scan"},
+		{"reason == no-best-unicast", []string{"203.0.113.0/24"}, "scan"},
+		{"stale == true", nil, "scan"},
+		{"meta.ticket == INC-2 or meta.ticket == \"INC-1\"", []string{"198.51.100.0/24", "203.0.113.0/25"}, "scan"},
+		{"NOT (family == ipv4 OR peer < 65001)", []string{"2001:db8::/48"}, "scan"},
+	} {
+		t.Run(tt.q, func(t *testing.T) {
+			q, err := Parse(tt.q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := dsts(q.Run(s)); !slices.Equal(got, tt.want) {
+				t.Errorf("Run() = %q, want %q", got, tt.want)
+			}
+			if got := q.Plan().String(); got != tt.plan {
+				t.Errorf("Plan() = %q, want %q", got, tt.plan)
+			}
+			var scan []*rib.FlowSpecEntry
+			for e := range s.All() {
+				if q.Match(e) {
+					scan = append(scan, e)
+				}
+			}
+			if got, want := dsts(q.Run(s)), dsts(scan); !slices.Equal(got, want) {
+				t.Errorf("Run() = %q, scan %q", got, want)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, tt := range []struct {
+		in, want string
+	}{
+		{"dst within 203.0.113.1/24", "dst within 203.0.113.0/24"},
+		{"a == b", ""},
+		{"dst within", ""},
+		{"dst within nope", ""},
+		{"dst > 203.0.113.0/24", ""},
+		{"peer == 65001 and", ""},
+		{"(peer == 65001", ""},
+		{"peer == 65001)", ""},
+		{"action == drop", ""},
+		{"meta. == x", ""},
+		{`meta.note == "a b`, ""},
+		{`Peer == 1 or (action == mark and not (stale == true or meta.note == "a b"))`, `peer == 1 or action == mark and not (stale == true or meta.note == "a b")`},
+		{"not (peer == 1 or peer == 2) and feasible == true", "not (peer == 1 or peer == 2) and feasible == true"},
+		{"(peer == 1 or peer == 2) and feasible == true", "(peer == 1 or peer == 2) and feasible == true"},
+	} {
+		q, err := Parse(tt.in)
+		if tt.want == "" {
+			if !errors.Is(err, ErrSyntax) {
+				t.Errorf("Parse(%q) error = %v, want ErrSyntax", tt.in, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Parse(%q) error = %v", tt.in, err)
+			continue
+		}
+		if got := q.String(); got != tt.want {
+			t.Errorf("Parse(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,312 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+// Package remoterib implements fs.UnicastRIB on a routing daemon queried over
+// the floofspec.v1.UnicastRIB gRPC service of ribpb/unicast.proto, for
+// controllers that do not hold the full table themselves:
+//
+//	conn, err := grpc.NewClient("rib.example.net:50051", ...)
+//	c := remoterib.NewClient(conn, &remoterib.Options{TTL: time.Minute})
+//	err = fs.ValidateFeasibilityCtx(ctx, route, c, cfg)
+//
+// Answers are cached per prefix, routes found for Options.TTL and empty
+// answers for Options.NegativeTTL; failed lookups are not cached. NewServer
+// serves any fs.UnicastRIB, e.g. a rib.Index, over the same service.
+// Regenerate the ribpb package with "go generate" after changing the proto.
+package remoterib
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative ribpb/unicast.proto
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/remoterib/ribpb"
+)
+
+// Defaults used for zero Options fields.
+const (
+	DefaultTTL         = 30 * time.Second
+	DefaultNegativeTTL = 5 * time.Second
+	DefaultTimeout     = 5 * time.Second
+	DefaultMaxEntries  = 100000
+)
+
+var (
+	ErrInvalidResponse = errors.New("remoterib: invalid route in response")
+)
+
+// Options configures a Client.
+type Options struct {
+	// TTL is how long a found route is cached, NegativeTTL how long an
+	// answer without routes is. A negative value disables that cache.
+	TTL         time.Duration
+	NegativeTTL time.Duration
+	// Timeout bounds the lookups of the UnicastRIB methods, which have no
+	// context of their own.
+	Timeout time.Duration
+	// MaxEntries bounds the cached answers per lookup kind. Expired entries
+	// are evicted first, then arbitrary ones.
+	MaxEntries int
+	// Logger, if set, receives failed lookups of the UnicastRIB methods.
+	Logger *slog.Logger
+	// Now returns the current time, defaults to time.Now.
+	Now func() time.Time
+}
+
+// Client is an fs.UnicastRIBCtx backed by a remote UnicastRIB service. Its
+// methods are safe for concurrent use. Routes it returns are shared with
+// the cache and must not be modified.
+//
+// The UnicastRIB methods treat a failed lookup like an empty answer, which
+// fails rule b) but passes rule c); use fs.ValidateFeasibilityCtx to get
+// an fs.ErrRIBLookup instead. The service has no AllPaths, so AllPaths
+// returns the best path only.
+type Client struct {
+	rpc  ribpb.UnicastRIBClient
+	opts Options
+	log  *slog.Logger
+
+	mu   sync.Mutex
+	best map[netip.Prefix]entry[*fs.UnicastRoute]
+	more map[netip.Prefix]entry[[]*fs.UnicastRoute]
+}
+
+type entry[T any] struct {
+	v       T
+	expires time.Time
+}
+
+// NewClient returns a Client querying the service on conn.
+func NewClient(conn grpc.ClientConnInterface, opts *Options) *Client {
+	var o Options
+	if opts != nil {
+		o = *opts
+	}
+	if o.TTL == 0 {
+		o.TTL = DefaultTTL
+	}
+	if o.NegativeTTL == 0 {
+		o.NegativeTTL = DefaultNegativeTTL
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = DefaultTimeout
+	}
+	if o.MaxEntries <= 0 {
+		o.MaxEntries = DefaultMaxEntries
+	}
+	if o.Now == nil {
+		o.Now = time.Now
+	}
+	return &Client{
+		rpc:  ribpb.NewUnicastRIBClient(conn),
+		opts: o,
+		log:  fs.SubsystemLogger(o.Logger, fs.SubsystemRemoteRIB),
+		best: make(map[netip.Prefix]entry[*fs.UnicastRoute]),
+		more: make(map[netip.Prefix]entry[[]*fs.UnicastRoute]),
+	}
+}
+
+// Flush drops all cached answers, e.g. after the remote table was reloaded.
+func (c *Client) Flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	clear(c.best)
+	clear(c.more)
+}
+
+// BestPath implements fs.UnicastRIB.
+func (c *Client) BestPath(p netip.Prefix) *fs.UnicastRoute {
+	ctx, cancel := context.WithTimeout(context.Background(), c.opts.Timeout)
+	defer cancel()
+	r, err := c.BestPathCtx(ctx, p)
+	if err != nil {
+		c.log.Warn("unicast lookup failed", "lookup", "best_path", fs.LogKeyPrefix, p.String(), "error", err)
+	}
+	return r
+}
+
+// MoreSpecifics implements fs.UnicastRIB.
+func (c *Client) MoreSpecifics(p netip.Prefix) []*fs.UnicastRoute {
+	ctx, cancel := context.WithTimeout(context.Background(), c.opts.Timeout)
+	defer cancel()
+	rs, err := c.MoreSpecificsCtx(ctx, p)
+	if err != nil {
+		c.log.Warn("unicast lookup failed", "lookup", "more_specifics", fs.LogKeyPrefix, p.String(), "error", err)
+	}
+	return rs
+}
+
+// AllPaths implements fs.UnicastRIB with the best path only.
+func (c *Client) AllPaths(p netip.Prefix) []*fs.UnicastRoute {
+	if r := c.BestPath(p); r != nil {
+		return []*fs.UnicastRoute{r}
+	}
+	return nil
+}
+
+// BestPathCtx implements fs.UnicastRIBCtx.
+func (c *Client) BestPathCtx(ctx context.Context, p netip.Prefix) (*fs.UnicastRoute, error) {
+	p = p.Masked()
+	if r, ok := lookup(c, c.best, p); ok {
+		return r, nil
+	}
+	resp, err := c.rpc.BestPath(ctx, &ribpb.BestPathRequest{Prefix: p.String()})
+	if err != nil {
+		return nil, err
+	}
+	var r *fs.UnicastRoute
+	if resp.Route != nil {
+		if r, err = fromProto(resp.Route); err != nil {
+			return nil, err
+		}
+	}
+	store(c, c.best, p, r, r != nil)
+	return r, nil
+}
+
+// MoreSpecificsCtx implements fs.UnicastRIBCtx.
+func (c *Client) MoreSpecificsCtx(ctx context.Context, p netip.Prefix) ([]*fs.UnicastRoute, error) {
+	p = p.Masked()
+	if rs, ok := lookup(c, c.more, p); ok {
+		return rs, nil
+	}
+	resp, err := c.rpc.MoreSpecifics(ctx, &ribpb.MoreSpecificsRequest{Prefix: p.String()})
+	if err != nil {
+		return nil, err
+	}
+	var rs []*fs.UnicastRoute
+	if len(resp.Routes) > 0 {
+		rs = make([]*fs.UnicastRoute, len(resp.Routes))
+	}
+	for i, pr := range resp.Routes {
+		if rs[i], err = fromProto(pr); err != nil {
+			return nil, err
+		}
+	}
+	store(c, c.more, p, rs, len(rs) > 0)
+	return rs, nil
+}
+
+// AllPathsCtx implements fs.UnicastRIBCtx with the best path only.
+func (c *Client) AllPathsCtx(ctx context.Context, p netip.Prefix) ([]*fs.UnicastRoute, error) {
+	r, err := c.BestPathCtx(ctx, p)
+	if r == nil {
+		return nil, err
+	}
+	return []*fs.UnicastRoute{r}, nil
+}
+
+// lookup returns the cached answer for p in m, if it has not expired.
+func lookup[T any](c *Client, m map[netip.Prefix]entry[T], p netip.Prefix) (T, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := m[p]
+	if !ok || !c.opts.Now().Before(e.expires) {
+		var zero T
+		return zero, false
+	}
+	return e.v, true
+}
+
+// store caches the answer v for p in m, for TTL if found and NegativeTTL
+// otherwise.
+func store[T any](c *Client, m map[netip.Prefix]entry[T], p netip.Prefix, v T, found bool) {
+	ttl := c.opts.NegativeTTL
+	if found {
+		ttl = c.opts.TTL
+	}
+	if ttl < 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.opts.Now()
+	if _, ok := m[p]; !ok && len(m) >= c.opts.MaxEntries {
+		for k, e := range m {
+			if !now.Before(e.expires) {
+				delete(m, k)
+			}
+		}
+		for k := range m {
+			if len(m) < c.opts.MaxEntries {
+				break
+			}
+			delete(m, k)
+		}
+	}
+	m[p] = entry[T]{v: v, expires: now.Add(ttl)}
+}
+
+func fromProto(r *ribpb.UnicastRoute) (*fs.UnicastRoute, error) {
+	p, err := netip.ParsePrefix(r.Prefix)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidResponse, err)
+	}
+	u := &fs.UnicastRoute{Prefix: p, NeighborAS: r.NeighborAs, ASPath: r.AsPath, PathID: r.PathId}
+	if r.OriginatorId != "" {
+		a, err := netip.ParseAddr(r.OriginatorId)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidResponse, err)
+		}
+		u.OriginatorID = a.Unmap()
+	}
+	return u, nil
+}
+
+func toProto(r *fs.UnicastRoute) *ribpb.UnicastRoute {
+	pr := &ribpb.UnicastRoute{Prefix: r.Prefix.String(), NeighborAs: r.NeighborAS, AsPath: r.ASPath, PathId: r.PathID}
+	if r.OriginatorID.IsValid() {
+		pr.OriginatorId = r.OriginatorID.String()
+	}
+	return pr
+}
+
+// Server implements ribpb.UnicastRIBServer on an fs.UnicastRIB.
+type Server struct {
+	ribpb.UnimplementedUnicastRIBServer
+	rib fs.UnicastRIB
+}
+
+// NewServer returns a Server answering from rib.
+func NewServer(rib fs.UnicastRIB) *Server {
+	return &Server{rib: rib}
+}
+
+// BestPath implements ribpb.UnicastRIBServer.
+func (s *Server) BestPath(ctx context.Context, req *ribpb.BestPathRequest) (*ribpb.BestPathResponse, error) {
+	p, err := netip.ParsePrefix(req.Prefix)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	resp := &ribpb.BestPathResponse{}
+	if r := s.rib.BestPath(p); r != nil {
+		resp.Route = toProto(r)
+	}
+	return resp, nil
+}
+
+// MoreSpecifics implements ribpb.UnicastRIBServer.
+func (s *Server) MoreSpecifics(ctx context.Context, req *ribpb.MoreSpecificsRequest) (*ribpb.MoreSpecificsResponse, error) {
+	p, err := netip.ParsePrefix(req.Prefix)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	rs := s.rib.MoreSpecifics(p)
+	resp := &ribpb.MoreSpecificsResponse{Routes: make([]*ribpb.UnicastRoute, len(rs))}
+	for i, r := range rs {
+		resp.Routes[i] = toProto(r)
+	}
+	return resp, nil
+}
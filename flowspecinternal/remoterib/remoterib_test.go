@@ -0,0 +1,150 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package remoterib
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/remoterib/ribpb"
+	"floofspectools/flowspecinternal/rib"
+)
+
+// countingRIB counts the lookups reaching the remote RIB.
+type countingRIB struct {
+	fs.UnicastRIB
+	calls atomic.Int32
+}
+
+func (c *countingRIB) BestPath(p netip.Prefix) *fs.UnicastRoute {
+	c.calls.Add(1)
+	return c.UnicastRIB.BestPath(p)
+}
+
+func (c *countingRIB) MoreSpecifics(p netip.Prefix) []*fs.UnicastRoute {
+	c.calls.Add(1)
+	return c.UnicastRIB.MoreSpecifics(p)
+}
+
+func dial(t *testing.T, unicast fs.UnicastRIB, opts *Options) *Client {
+	t.Helper()
+	lis := bufconn.Listen(1 << 16)
+	srv := grpc.NewServer()
+	ribpb.RegisterUnicastRIBServer(srv, NewServer(unicast))
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return NewClient(conn, opts)
+}
+
+func TestClient(t *testing.T) {
+	trie := rib.NewTrie()
+	trie.Insert(&fs.UnicastRoute{Prefix: netip.MustParsePrefix("192.0.2.0/24"), NeighborAS: 64500, ASPath: []uint32{64500, 64501}, OriginatorID: netip.MustParseAddr("198.51.100.1")})
+	trie.Insert(&fs.UnicastRoute{Prefix: netip.MustParsePrefix("192.0.2.128/25"), NeighborAS: 64502, ASPath: []uint32{64502}})
+	remote := &countingRIB{UnicastRIB: trie}
+	now := time.Unix(0, 0)
+	c := dial(t, remote, &Options{TTL: time.Minute, NegativeTTL: time.Second, Now: func() time.Time { return now }})
+	ctx := context.Background()
+
+	best, err := c.BestPathCtx(ctx, netip.MustParsePrefix("192.0.2.1/32"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if best == nil || best.Prefix.String() != "192.0.2.0/24" || best.OriginatorID != netip.MustParseAddr("198.51.100.1") || len(best.ASPath) != 2 {
+		t.Fatalf("BestPathCtx() = %+v", best)
+	}
+	more := c.MoreSpecifics(netip.MustParsePrefix("192.0.2.0/24"))
+	if len(more) != 1 || more[0].NeighborAS != 64502 || more[0].OriginatorID.IsValid() {
+		t.Fatalf("MoreSpecifics() = %+v", more)
+	}
+	if got := c.BestPath(netip.MustParsePrefix("203.0.113.0/24")); got != nil {
+		t.Fatalf("BestPath(uncovered) = %+v, want nil", got)
+	}
+	if got := c.AllPaths(netip.MustParsePrefix("192.0.2.1/32")); len(got) != 1 || got[0] != best {
+		t.Errorf("AllPaths() = %+v, want the cached best path", got)
+	}
+
+	calls := remote.calls.Load()
+	c.BestPath(netip.MustParsePrefix("192.0.2.1/32"))
+	c.MoreSpecifics(netip.MustParsePrefix("192.0.2.0/24"))
+	c.BestPath(netip.MustParsePrefix("203.0.113.0/24"))
+	if got := remote.calls.Load(); got != calls {
+		t.Errorf("cached lookups reached the remote RIB %d times", got-calls)
+	}
+
+	// the negative entry expires first
+	now = now.Add(2 * time.Second)
+	c.BestPath(netip.MustParsePrefix("192.0.2.1/32"))
+	c.BestPath(netip.MustParsePrefix("203.0.113.0/24"))
+	if got := remote.calls.Load(); got != calls+1 {
+		t.Errorf("lookups after the negative TTL reached the remote RIB %d times, want 1", got-calls)
+	}
+	c.Flush()
+	c.BestPath(netip.MustParsePrefix("192.0.2.1/32"))
+	if got := remote.calls.Load(); got != calls+2 {
+		t.Errorf("lookups after Flush reached the remote RIB %d times, want 2", got-calls)
+	}
+
+	route := &fs.FlowSpecRoute{DestPrefix: &best.Prefix, FromEBGP: true, NeighborAS: 64500, ASPath: []uint32{64500}, OriginatorID: best.OriginatorID}
+	if err := fs.ValidateFeasibilityCtx(ctx, route, c, nil); !errors.Is(err, fs.ErrMoreSpecificFromOtherNeighbor) {
+		t.Errorf("ValidateFeasibilityCtx() = %v, want %v", err, fs.ErrMoreSpecificFromOtherNeighbor)
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	c := dial(t, rib.NewTrie(), nil)
+	p := netip.MustParsePrefix("192.0.2.0/24")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.BestPathCtx(ctx, p); err == nil {
+		t.Error("BestPathCtx(canceled) = nil error")
+	}
+	route := &fs.FlowSpecRoute{DestPrefix: &p}
+	if err := fs.ValidateFeasibilityCtx(ctx, route, c, nil); !errors.Is(err, fs.ErrRIBLookup) {
+		t.Errorf("ValidateFeasibilityCtx(canceled) = %v, want %v", err, fs.ErrRIBLookup)
+	}
+	// failed lookups are not cached
+	if err := fs.ValidateFeasibilityCtx(context.Background(), route, c, nil); !errors.Is(err, fs.ErrNoBestUnicast) {
+		t.Errorf("ValidateFeasibilityCtx() = %v, want %v", err, fs.ErrNoBestUnicast)
+	}
+
+	if _, err := fromProto(&ribpb.UnicastRoute{Prefix: "192.0.2.0/24", OriginatorId: "bogus"}); !errors.Is(err, ErrInvalidResponse) {
+		t.Errorf("fromProto(bad originator) = %v, want %v", err, ErrInvalidResponse)
+	}
+}
+
+func TestStoreEvicts(t *testing.T) {
+	now := time.Unix(0, 0)
+	c := NewClient(nil, &Options{MaxEntries: 2, Now: func() time.Time { return now }})
+	a, b, d := netip.MustParsePrefix("192.0.2.0/24"), netip.MustParsePrefix("198.51.100.0/24"), netip.MustParsePrefix("203.0.113.0/24")
+	store(c, c.best, a, nil, false) // expires after DefaultNegativeTTL
+	now = now.Add(time.Second)
+	store(c, c.best, b, &fs.UnicastRoute{Prefix: b}, true)
+	now = now.Add(DefaultNegativeTTL)
+	store(c, c.best, d, &fs.UnicastRoute{Prefix: d}, true)
+	if _, ok := c.best[a]; ok || len(c.best) != 2 {
+		t.Errorf("cache after eviction = %v, want the expired entry gone", c.best)
+	}
+	store(c, c.best, a, nil, false)
+	if len(c.best) != 2 {
+		t.Errorf("cache holds %d entries, want at most 2", len(c.best))
+	}
+}
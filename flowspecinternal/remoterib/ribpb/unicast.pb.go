@@ -0,0 +1,367 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: ribpb/unicast.proto
+
+package ribpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// UnicastRoute is a unicast path.
+type UnicastRoute struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// prefix, e.g. "192.0.2.0/24".
+	Prefix     string   `protobuf:"bytes,1,opt,name=prefix,proto3" json:"prefix,omitempty"`
+	NeighborAs uint32   `protobuf:"varint,2,opt,name=neighbor_as,json=neighborAs,proto3" json:"neighbor_as,omitempty"`
+	AsPath     []uint32 `protobuf:"varint,3,rep,packed,name=as_path,json=asPath,proto3" json:"as_path,omitempty"`
+	// originator_id is the BGP identifier of the originating router, empty
+	// if the route has none.
+	OriginatorId string `protobuf:"bytes,4,opt,name=originator_id,json=originatorId,proto3" json:"originator_id,omitempty"`
+	// path_id tells apart Add-Path (RFC7911) paths, 0 otherwise.
+	PathId        uint32 `protobuf:"varint,5,opt,name=path_id,json=pathId,proto3" json:"path_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UnicastRoute) Reset() {
+	*x = UnicastRoute{}
+	mi := &file_ribpb_unicast_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UnicastRoute) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UnicastRoute) ProtoMessage() {}
+
+func (x *UnicastRoute) ProtoReflect() protoreflect.Message {
+	mi := &file_ribpb_unicast_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UnicastRoute.ProtoReflect.Descriptor instead.
+func (*UnicastRoute) Descriptor() ([]byte, []int) {
+	return file_ribpb_unicast_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *UnicastRoute) GetPrefix() string {
+	if x != nil {
+		return x.Prefix
+	}
+	return ""
+}
+
+func (x *UnicastRoute) GetNeighborAs() uint32 {
+	if x != nil {
+		return x.NeighborAs
+	}
+	return 0
+}
+
+func (x *UnicastRoute) GetAsPath() []uint32 {
+	if x != nil {
+		return x.AsPath
+	}
+	return nil
+}
+
+func (x *UnicastRoute) GetOriginatorId() string {
+	if x != nil {
+		return x.OriginatorId
+	}
+	return ""
+}
+
+func (x *UnicastRoute) GetPathId() uint32 {
+	if x != nil {
+		return x.PathId
+	}
+	return 0
+}
+
+type BestPathRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Prefix        string                 `protobuf:"bytes,1,opt,name=prefix,proto3" json:"prefix,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BestPathRequest) Reset() {
+	*x = BestPathRequest{}
+	mi := &file_ribpb_unicast_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BestPathRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BestPathRequest) ProtoMessage() {}
+
+func (x *BestPathRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_ribpb_unicast_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BestPathRequest.ProtoReflect.Descriptor instead.
+func (*BestPathRequest) Descriptor() ([]byte, []int) {
+	return file_ribpb_unicast_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *BestPathRequest) GetPrefix() string {
+	if x != nil {
+		return x.Prefix
+	}
+	return ""
+}
+
+type BestPathResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// route is unset if no route covers the prefix.
+	Route         *UnicastRoute `protobuf:"bytes,1,opt,name=route,proto3" json:"route,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BestPathResponse) Reset() {
+	*x = BestPathResponse{}
+	mi := &file_ribpb_unicast_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BestPathResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BestPathResponse) ProtoMessage() {}
+
+func (x *BestPathResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_ribpb_unicast_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BestPathResponse.ProtoReflect.Descriptor instead.
+func (*BestPathResponse) Descriptor() ([]byte, []int) {
+	return file_ribpb_unicast_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *BestPathResponse) GetRoute() *UnicastRoute {
+	if x != nil {
+		return x.Route
+	}
+	return nil
+}
+
+type MoreSpecificsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Prefix        string                 `protobuf:"bytes,1,opt,name=prefix,proto3" json:"prefix,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MoreSpecificsRequest) Reset() {
+	*x = MoreSpecificsRequest{}
+	mi := &file_ribpb_unicast_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MoreSpecificsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MoreSpecificsRequest) ProtoMessage() {}
+
+func (x *MoreSpecificsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_ribpb_unicast_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MoreSpecificsRequest.ProtoReflect.Descriptor instead.
+func (*MoreSpecificsRequest) Descriptor() ([]byte, []int) {
+	return file_ribpb_unicast_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *MoreSpecificsRequest) GetPrefix() string {
+	if x != nil {
+		return x.Prefix
+	}
+	return ""
+}
+
+type MoreSpecificsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Routes        []*UnicastRoute        `protobuf:"bytes,1,rep,name=routes,proto3" json:"routes,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MoreSpecificsResponse) Reset() {
+	*x = MoreSpecificsResponse{}
+	mi := &file_ribpb_unicast_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MoreSpecificsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MoreSpecificsResponse) ProtoMessage() {}
+
+func (x *MoreSpecificsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_ribpb_unicast_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MoreSpecificsResponse.ProtoReflect.Descriptor instead.
+func (*MoreSpecificsResponse) Descriptor() ([]byte, []int) {
+	return file_ribpb_unicast_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *MoreSpecificsResponse) GetRoutes() []*UnicastRoute {
+	if x != nil {
+		return x.Routes
+	}
+	return nil
+}
+
+var File_ribpb_unicast_proto protoreflect.FileDescriptor
+
+const file_ribpb_unicast_proto_rawDesc = "" +
+	"\n" +
+	"\x13ribpb/unicast.proto\x12\ffloofspec.v1\"\x9e\x01\n" +
+	"\fUnicastRoute\x12\x16\n" +
+	"\x06prefix\x18\x01 \x01(\tR\x06prefix\x12\x1f\n" +
+	"\vneighbor_as\x18\x02 \x01(\rR\n" +
+	"neighborAs\x12\x17\n" +
+	"\aas_path\x18\x03 \x03(\rR\x06asPath\x12#\n" +
+	"\roriginator_id\x18\x04 \x01(\tR\foriginatorId\x12\x17\n" +
+	"\apath_id\x18\x05 \x01(\rR\x06pathId\")\n" +
+	"\x0fBestPathRequest\x12\x16\n" +
+	"\x06prefix\x18\x01 \x01(\tR\x06prefix\"D\n" +
+	"\x10BestPathResponse\x120\n" +
+	"\x05route\x18\x01 \x01(\v2\x1a.floofspec.v1.UnicastRouteR\x05route\".\n" +
+	"\x14MoreSpecificsRequest\x12\x16\n" +
+	"\x06prefix\x18\x01 \x01(\tR\x06prefix\"K\n" +
+	"\x15MoreSpecificsResponse\x122\n" +
+	"\x06routes\x18\x01 \x03(\v2\x1a.floofspec.v1.UnicastRouteR\x06routes2\xb1\x01\n" +
+	"\n" +
+	"UnicastRIB\x12I\n" +
+	"\bBestPath\x12\x1d.floofspec.v1.BestPathRequest\x1a\x1e.floofspec.v1.BestPathResponse\x12X\n" +
+	"\rMoreSpecifics\x12\".floofspec.v1.MoreSpecificsRequest\x1a#.floofspec.v1.MoreSpecificsResponseB1Z/floofspectools/flowspecinternal/remoterib/ribpbb\x06proto3"
+
+var (
+	file_ribpb_unicast_proto_rawDescOnce sync.Once
+	file_ribpb_unicast_proto_rawDescData []byte
+)
+
+func file_ribpb_unicast_proto_rawDescGZIP() []byte {
+	file_ribpb_unicast_proto_rawDescOnce.Do(func() {
+		file_ribpb_unicast_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_ribpb_unicast_proto_rawDesc), len(file_ribpb_unicast_proto_rawDesc)))
+	})
+	return file_ribpb_unicast_proto_rawDescData
+}
+
+var file_ribpb_unicast_proto_msgTypes = make([]protoimpl.MessageInfo, 5)
+var file_ribpb_unicast_proto_goTypes = []any{
+	(*UnicastRoute)(nil),          // 0: floofspec.v1.UnicastRoute
+	(*BestPathRequest)(nil),       // 1: floofspec.v1.BestPathRequest
+	(*BestPathResponse)(nil),      // 2: floofspec.v1.BestPathResponse
+	(*MoreSpecificsRequest)(nil),  // 3: floofspec.v1.MoreSpecificsRequest
+	(*MoreSpecificsResponse)(nil), // 4: floofspec.v1.MoreSpecificsResponse
+}
+var file_ribpb_unicast_proto_depIdxs = []int32{
+	0, // 0: floofspec.v1.BestPathResponse.route:type_name -> floofspec.v1.UnicastRoute
+	0, // 1: floofspec.v1.MoreSpecificsResponse.routes:type_name -> floofspec.v1.UnicastRoute
+	1, // 2: floofspec.v1.UnicastRIB.BestPath:input_type -> floofspec.v1.BestPathRequest
+	3, // 3: floofspec.v1.UnicastRIB.MoreSpecifics:input_type -> floofspec.v1.MoreSpecificsRequest
+	2, // 4: floofspec.v1.UnicastRIB.BestPath:output_type -> floofspec.v1.BestPathResponse
+	4, // 5: floofspec.v1.UnicastRIB.MoreSpecifics:output_type -> floofspec.v1.MoreSpecificsResponse
+	4, // [4:6] is the sub-list for method output_type
+	2, // [2:4] is the sub-list for method input_type
+	2, // [2:2] is the sub-list for extension type_name
+	2, // [2:2] is the sub-list for extension extendee
+	0, // [0:2] is the sub-list for field type_name
+}
+
+func init() { file_ribpb_unicast_proto_init() }
+func file_ribpb_unicast_proto_init() {
+	if File_ribpb_unicast_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_ribpb_unicast_proto_rawDesc), len(file_ribpb_unicast_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   5,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_ribpb_unicast_proto_goTypes,
+		DependencyIndexes: file_ribpb_unicast_proto_depIdxs,
+		MessageInfos:      file_ribpb_unicast_proto_msgTypes,
+	}.Build()
+	File_ribpb_unicast_proto = out.File
+	file_ribpb_unicast_proto_goTypes = nil
+	file_ribpb_unicast_proto_depIdxs = nil
+}
@@ -0,0 +1,177 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: ribpb/unicast.proto
+
+package ribpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	UnicastRIB_BestPath_FullMethodName      = "/floofspec.v1.UnicastRIB/BestPath"
+	UnicastRIB_MoreSpecifics_FullMethodName = "/floofspec.v1.UnicastRIB/MoreSpecifics"
+)
+
+// UnicastRIBClient is the client API for UnicastRIB service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// UnicastRIB answers the unicast lookups of FlowSpec validation (RFC8955 6)
+// from a routing daemon holding the table.
+type UnicastRIBClient interface {
+	// BestPath returns the best path of the longest prefix match covering
+	// the prefix, none if no route covers it.
+	BestPath(ctx context.Context, in *BestPathRequest, opts ...grpc.CallOption) (*BestPathResponse, error)
+	// MoreSpecifics returns the best paths of all prefixes strictly more
+	// specific than the prefix.
+	MoreSpecifics(ctx context.Context, in *MoreSpecificsRequest, opts ...grpc.CallOption) (*MoreSpecificsResponse, error)
+}
+
+type unicastRIBClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewUnicastRIBClient(cc grpc.ClientConnInterface) UnicastRIBClient {
+	return &unicastRIBClient{cc}
+}
+
+func (c *unicastRIBClient) BestPath(ctx context.Context, in *BestPathRequest, opts ...grpc.CallOption) (*BestPathResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(BestPathResponse)
+	err := c.cc.Invoke(ctx, UnicastRIB_BestPath_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *unicastRIBClient) MoreSpecifics(ctx context.Context, in *MoreSpecificsRequest, opts ...grpc.CallOption) (*MoreSpecificsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(MoreSpecificsResponse)
+	err := c.cc.Invoke(ctx, UnicastRIB_MoreSpecifics_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// UnicastRIBServer is the server API for UnicastRIB service.
+// All implementations must embed UnimplementedUnicastRIBServer
+// for forward compatibility.
+//
+// UnicastRIB answers the unicast lookups of FlowSpec validation (RFC8955 6)
+// from a routing daemon holding the table.
+type UnicastRIBServer interface {
+	// BestPath returns the best path of the longest prefix match covering
+	// the prefix, none if no route covers it.
+	BestPath(context.Context, *BestPathRequest) (*BestPathResponse, error)
+	// MoreSpecifics returns the best paths of all prefixes strictly more
+	// specific than the prefix.
+	MoreSpecifics(context.Context, *MoreSpecificsRequest) (*MoreSpecificsResponse, error)
+	mustEmbedUnimplementedUnicastRIBServer()
+}
+
+// UnimplementedUnicastRIBServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedUnicastRIBServer struct{}
+
+func (UnimplementedUnicastRIBServer) BestPath(context.Context, *BestPathRequest) (*BestPathResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BestPath not implemented")
+}
+func (UnimplementedUnicastRIBServer) MoreSpecifics(context.Context, *MoreSpecificsRequest) (*MoreSpecificsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method MoreSpecifics not implemented")
+}
+func (UnimplementedUnicastRIBServer) mustEmbedUnimplementedUnicastRIBServer() {}
+func (UnimplementedUnicastRIBServer) testEmbeddedByValue()                    {}
+
+// UnsafeUnicastRIBServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to UnicastRIBServer will
+// result in compilation errors.
+type UnsafeUnicastRIBServer interface {
+	mustEmbedUnimplementedUnicastRIBServer()
+}
+
+func RegisterUnicastRIBServer(s grpc.ServiceRegistrar, srv UnicastRIBServer) {
+	// If the following call pancis, it indicates UnimplementedUnicastRIBServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&UnicastRIB_ServiceDesc, srv)
+}
+
+func _UnicastRIB_BestPath_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BestPathRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UnicastRIBServer).BestPath(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: UnicastRIB_BestPath_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UnicastRIBServer).BestPath(ctx, req.(*BestPathRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UnicastRIB_MoreSpecifics_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MoreSpecificsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UnicastRIBServer).MoreSpecifics(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: UnicastRIB_MoreSpecifics_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UnicastRIBServer).MoreSpecifics(ctx, req.(*MoreSpecificsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// UnicastRIB_ServiceDesc is the grpc.ServiceDesc for UnicastRIB service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var UnicastRIB_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "floofspec.v1.UnicastRIB",
+	HandlerType: (*UnicastRIBServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "BestPath",
+			Handler:    _UnicastRIB_BestPath_Handler,
+		},
+		{
+			MethodName: "MoreSpecifics",
+			Handler:    _UnicastRIB_MoreSpecifics_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "ribpb/unicast.proto",
+}
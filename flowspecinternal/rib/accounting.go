@@ -0,0 +1,169 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package rib
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	fs "floofspectools/flowspecinternal"
+)
+
+var (
+	ErrUnknownRule = errors.New("rib: rule not in the FlowSpec RIB")
+)
+
+// Default accounting granularity and history, see FlowSpecOptions.
+const (
+	DefaultAccountingResolution = time.Minute
+	DefaultAccountingRetention  = time.Hour
+)
+
+// Counters is traffic matched by a rule.
+type Counters struct {
+	Packets uint64 `json:"packets"`
+	Bytes   uint64 `json:"bytes"`
+}
+
+// CounterSink receives the matched traffic counters dataplane backends read
+// from the rules they installed. FlowSpecRIB implements it.
+type CounterSink interface {
+	// ReportCounters reports the cumulative counters c of route on source,
+	// e.g. a router or interface name, read at time at. Counters that go
+	// down are taken as a reset of the dataplane rule.
+	ReportCounters(source string, route *fs.FlowSpecRoute, at time.Time, c Counters) error
+}
+
+// accounting aggregates reported counters per rule into fixed time buckets.
+type accounting struct {
+	mu         sync.Mutex
+	resolution time.Duration
+	retention  time.Duration
+	rules      map[string]*ruleTraffic
+}
+
+type ruleTraffic struct {
+	// last holds the latest cumulative counters per source.
+	last map[string]Counters
+	// buckets are ordered by start, oldest first.
+	buckets   []bucket
+	lastMatch time.Time
+}
+
+type bucket struct {
+	start time.Time
+	Counters
+}
+
+func newAccounting(resolution, retention time.Duration) *accounting {
+	if resolution <= 0 {
+		resolution = DefaultAccountingResolution
+	}
+	if retention <= 0 {
+		retention = DefaultAccountingRetention
+	}
+	return &accounting{resolution: resolution, retention: retention, rules: make(map[string]*ruleTraffic)}
+}
+
+func (a *accounting) report(key, source string, at time.Time, c Counters) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	t := a.rules[key]
+	if t == nil {
+		t = &ruleTraffic{last: make(map[string]Counters)}
+		a.rules[key] = t
+	}
+	prev, seen := t.last[source]
+	t.last[source] = c
+	if !seen {
+		// the first report only sets the baseline
+		return
+	}
+	d := c
+	if c.Packets >= prev.Packets && c.Bytes >= prev.Bytes {
+		d = Counters{Packets: c.Packets - prev.Packets, Bytes: c.Bytes - prev.Bytes}
+	}
+	if d == (Counters{}) {
+		return
+	}
+	if at.After(t.lastMatch) {
+		t.lastMatch = at
+	}
+	start := at.Truncate(a.resolution)
+	i := len(t.buckets)
+	for i > 0 && t.buckets[i-1].start.After(start) {
+		i--
+	}
+	if i > 0 && t.buckets[i-1].start.Equal(start) {
+		t.buckets[i-1].Packets += d.Packets
+		t.buckets[i-1].Bytes += d.Bytes
+	} else {
+		t.buckets = append(t.buckets, bucket{})
+		copy(t.buckets[i+1:], t.buckets[i:])
+		t.buckets[i] = bucket{start: start, Counters: d}
+	}
+	cutoff := at.Add(-a.retention)
+	n := 0
+	for n < len(t.buckets) && t.buckets[n].start.Add(a.resolution).Before(cutoff) {
+		n++
+	}
+	t.buckets = t.buckets[n:]
+}
+
+func (a *accounting) traffic(key string, since time.Time) Counters {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var sum Counters
+	t := a.rules[key]
+	if t == nil {
+		return sum
+	}
+	for _, b := range t.buckets {
+		if !b.start.Before(since.Truncate(a.resolution)) {
+			sum.Packets += b.Packets
+			sum.Bytes += b.Bytes
+		}
+	}
+	return sum
+}
+
+func (a *accounting) lastMatch(key string) time.Time {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if t := a.rules[key]; t != nil {
+		return t.lastMatch
+	}
+	return time.Time{}
+}
+
+func (a *accounting) forget(key string) {
+	a.mu.Lock()
+	delete(a.rules, key)
+	a.mu.Unlock()
+}
+
+// ReportCounters implements CounterSink. Reports for routes not in the RIB
+// return ErrUnknownRule.
+func (r *FlowSpecRIB) ReportCounters(source string, route *fs.FlowSpecRoute, at time.Time, c Counters) error {
+	if _, ok := r.Snapshot().Get(route); !ok {
+		return ErrUnknownRule
+	}
+	r.acct.report(FlowSpecKey(route), source, at, c)
+	return nil
+}
+
+// Traffic returns the traffic route matched on all sources in the last
+// window, at the resolution of the accounting: the bucket containing
+// now-window is included whole. Windows beyond the retention are cut short.
+func (r *FlowSpecRIB) Traffic(route *fs.FlowSpecRoute, window time.Duration) Counters {
+	return r.acct.traffic(FlowSpecKey(route), r.now().Add(-window))
+}
+
+// LastMatch returns when route was last reported to match traffic, or the
+// zero time if it never was.
+func (r *FlowSpecRIB) LastMatch(route *fs.FlowSpecRoute) time.Time {
+	return r.acct.lastMatch(FlowSpecKey(route))
+}
@@ -0,0 +1,69 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package rib
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestFlowSpecRIBAccounting(t *testing.T) {
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	now := start
+	r := NewFlowSpecRIB(&FlowSpecOptions{Now: func() time.Time { return now }, AccountingRetention: 30 * time.Minute})
+	route := flowSpecRoute(t, "dst 192.0.2.0/24")
+	r.Insert(route, nil)
+
+	if err := r.ReportCounters("edge1", flowSpecRoute(t, "dst 198.51.100.0/24"), now, Counters{}); !errors.Is(err, ErrUnknownRule) {
+		t.Errorf("ReportCounters(unknown) error = %v, want %v", err, ErrUnknownRule)
+	}
+
+	report := func(source string, at time.Duration, packets, bytes uint64) {
+		t.Helper()
+		if err := r.ReportCounters(source, route, start.Add(at), Counters{Packets: packets, Bytes: bytes}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	report("edge1", 0, 100, 10000)           // baseline
+	report("edge2", 0, 5, 500)               // baseline
+	report("edge1", time.Minute, 150, 15000) // +50
+	report("edge2", 2*time.Minute, 15, 1500) // +10
+	report("edge1", 5*time.Minute, 20, 2000) // reset: +20
+	report("edge1", 6*time.Minute, 20, 2000) // idle
+	now = start.Add(6 * time.Minute)
+
+	tests := []struct {
+		window time.Duration
+		want   Counters
+	}{
+		{window: 0, want: Counters{}},
+		{window: time.Minute, want: Counters{Packets: 20, Bytes: 2000}},
+		{window: 2 * time.Minute, want: Counters{Packets: 20, Bytes: 2000}},
+		{window: 5 * time.Minute, want: Counters{Packets: 80, Bytes: 8000}},
+		{window: time.Hour, want: Counters{Packets: 80, Bytes: 8000}},
+	}
+	for _, tt := range tests {
+		if got := r.Traffic(route, tt.window); got != tt.want {
+			t.Errorf("Traffic(%v) = %+v, want %+v", tt.window, got, tt.want)
+		}
+	}
+	if got := r.LastMatch(route); !got.Equal(start.Add(5 * time.Minute)) {
+		t.Errorf("LastMatch() = %v, want %v", got, start.Add(5*time.Minute))
+	}
+
+	// buckets beyond the retention are dropped
+	report("edge1", time.Hour, 21, 2100)
+	now = start.Add(time.Hour)
+	if got := r.Traffic(route, 2*time.Hour); got != (Counters{Packets: 1, Bytes: 100}) {
+		t.Errorf("Traffic() after retention = %+v, want 1 packet", got)
+	}
+
+	r.Delete(route)
+	r.Insert(route, nil)
+	if got := r.Traffic(route, time.Hour); got != (Counters{}) || !r.LastMatch(route).IsZero() {
+		t.Errorf("Traffic() of re-inserted rule = %+v, want none", got)
+	}
+}
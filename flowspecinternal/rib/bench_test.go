@@ -0,0 +1,165 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package rib
+
+import (
+	"math/rand/v2"
+	"net/netip"
+	"slices"
+	"testing"
+
+	fs "floofspectools/flowspecinternal"
+)
+
+const benchRoutes = 100_000
+
+// benchTable returns a table shaped roughly like a v4 DFZ: mostly /24, some shorter.
+func benchTable() []*fs.UnicastRoute {
+	rng := rand.New(rand.NewPCG(7, 7))
+	routes := make([]*fs.UnicastRoute, 0, benchRoutes)
+	for len(routes) < benchRoutes {
+		bits := 24
+		if rng.IntN(10) < 3 {
+			bits = 16 + rng.IntN(8)
+		}
+		a := netip.AddrFrom4([4]byte{byte(1 + rng.IntN(222)), byte(rng.IntN(256)), byte(rng.IntN(256)), 0})
+		routes = append(routes, &fs.UnicastRoute{
+			Prefix:     netip.PrefixFrom(a, bits).Masked(),
+			NeighborAS: uint32(64512 + rng.IntN(100)),
+		})
+	}
+	return routes
+}
+
+func BenchmarkInsert(b *testing.B) {
+	table := benchTable()
+	for _, idx := range indexes {
+		b.Run(idx.name, func(b *testing.B) {
+			for b.Loop() {
+				rib := idx.new()
+				for _, r := range table[:10_000] {
+					rib.Insert(r)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkChurn(b *testing.B) {
+	table := benchTable()
+	for _, idx := range indexes {
+		b.Run(idx.name, func(b *testing.B) {
+			rib := idx.new()
+			for _, r := range table {
+				rib.Insert(r)
+			}
+			i := 0
+			for b.Loop() {
+				r := table[i%len(table)]
+				rib.Delete(r.Prefix)
+				rib.Insert(r)
+				i++
+			}
+		})
+	}
+}
+
+func BenchmarkBestPath(b *testing.B) {
+	table := benchTable()
+	for _, idx := range indexes {
+		b.Run(idx.name, func(b *testing.B) {
+			rib := idx.new()
+			for _, r := range table {
+				rib.Insert(r)
+			}
+			i := 0
+			for b.Loop() {
+				p := table[i%len(table)].Prefix
+				rib.BestPath(netip.PrefixFrom(p.Addr(), 28))
+				i++
+			}
+		})
+	}
+}
+
+func BenchmarkMoreSpecifics(b *testing.B) {
+	table := benchTable()
+	for _, idx := range indexes {
+		b.Run(idx.name, func(b *testing.B) {
+			rib := idx.new()
+			for _, r := range table {
+				rib.Insert(r)
+			}
+			i := 0
+			for b.Loop() {
+				p := table[i%len(table)].Prefix
+				rib.MoreSpecifics(netip.PrefixFrom(p.Addr(), 16).Masked())
+				i++
+			}
+		})
+	}
+}
+
+func BenchmarkLoad(b *testing.B) {
+	table := benchTable()
+	SortRoutes(table)
+	table = slices.CompactFunc(table, func(x, y *fs.UnicastRoute) bool { return x.Prefix == y.Prefix })
+	for _, idx := range indexes {
+		b.Run(idx.name+"/Insert", func(b *testing.B) {
+			for b.Loop() {
+				rib := idx.new()
+				for _, r := range table {
+					rib.Insert(r)
+				}
+			}
+		})
+		b.Run(idx.name+"/BulkLoad", func(b *testing.B) {
+			for b.Loop() {
+				if err := idx.new().BulkLoad(table); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkValidateFeasibility validates FlowSpec routes against a full
+// table: most for a /32 within a unicast prefix from its neighbor AS, some
+// from iBGP with an empty AS path and some from the wrong AS, which fail.
+func BenchmarkValidateFeasibility(b *testing.B) {
+	table := benchTable()
+	rng := rand.New(rand.NewPCG(8, 8))
+	routes := make([]*fs.FlowSpecRoute, 10_000)
+	for i := range routes {
+		u := table[rng.IntN(len(table))]
+		a := u.Prefix.Addr().As4()
+		a[3] = byte(1 + rng.IntN(254))
+		dst := netip.PrefixFrom(netip.AddrFrom4(a), 32)
+		r := &fs.FlowSpecRoute{DestPrefix: &dst, FromEBGP: true, NeighborAS: u.NeighborAS, ASPath: []uint32{u.NeighborAS}}
+		switch rng.IntN(10) {
+		case 0, 1:
+			r.FromEBGP, r.NeighborAS, r.ASPath = false, 0, nil
+		case 2:
+			r.NeighborAS, r.ASPath = 64999, []uint32{64999}
+		}
+		routes[i] = r
+	}
+	cfg := &fs.Config{EnableEmptyOrConfed: true}
+	for _, idx := range indexes {
+		b.Run(idx.name, func(b *testing.B) {
+			rib := idx.new()
+			for _, r := range table {
+				rib.Insert(r)
+			}
+			b.ReportAllocs()
+			i := 0
+			for b.Loop() {
+				_ = fs.ValidateFeasibility(routes[i%len(routes)], rib, cfg)
+				i++
+			}
+			b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "validations/s")
+		})
+	}
+}
@@ -0,0 +1,372 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package rib
+
+import (
+	"net/netip"
+	"slices"
+	"sort"
+	"sync"
+
+	fs "floofspectools/flowspecinternal"
+)
+
+// degree is the minimum degree of the B-tree; nodes hold degree-1 to 2*degree-1 items.
+const degree = 16
+
+type btreeNode struct {
+	items    []*fs.UnicastRoute
+	children []*btreeNode
+}
+
+// BTree is a UnicastRIB backed by a B-tree in comparePrefix order.
+type BTree struct {
+	notifier
+	addPaths
+	mu   sync.RWMutex
+	root *btreeNode
+	size int
+}
+
+// NewBTree returns an empty BTree.
+func NewBTree() *BTree {
+	return &BTree{}
+}
+
+func (n *btreeNode) leaf() bool { return len(n.children) == 0 }
+
+func (n *btreeNode) find(p netip.Prefix) (int, bool) {
+	i := sort.Search(len(n.items), func(i int) bool {
+		return comparePrefix(n.items[i].Prefix, p) >= 0
+	})
+	return i, i < len(n.items) && comparePrefix(n.items[i].Prefix, p) == 0
+}
+
+func (n *btreeNode) get(p netip.Prefix) *fs.UnicastRoute {
+	for n != nil {
+		i, found := n.find(p)
+		if found {
+			return n.items[i]
+		}
+		if n.leaf() {
+			return nil
+		}
+		n = n.children[i]
+	}
+	return nil
+}
+
+func (n *btreeNode) splitChild(i int) {
+	c := n.children[i]
+	mid := c.items[degree-1]
+	right := &btreeNode{items: slices.Clone(c.items[degree:])}
+	if !c.leaf() {
+		right.children = slices.Clone(c.children[degree:])
+		c.children = c.children[:degree:degree]
+	}
+	c.items = c.items[: degree-1 : degree-1]
+	n.items = slices.Insert(n.items, i, mid)
+	n.children = slices.Insert(n.children, i+1, right)
+}
+
+// insertNonFull inserts r below n and reports whether the tree grew.
+func (n *btreeNode) insertNonFull(r *fs.UnicastRoute) bool {
+	i, found := n.find(r.Prefix)
+	if found {
+		n.items[i] = r
+		return false
+	}
+	if n.leaf() {
+		n.items = slices.Insert(n.items, i, r)
+		return true
+	}
+	if len(n.children[i].items) == 2*degree-1 {
+		n.splitChild(i)
+		switch c := comparePrefix(r.Prefix, n.items[i].Prefix); {
+		case c == 0:
+			n.items[i] = r
+			return false
+		case c > 0:
+			i++
+		}
+	}
+	return n.children[i].insertNonFull(r)
+}
+
+func (n *btreeNode) min() *fs.UnicastRoute {
+	for !n.leaf() {
+		n = n.children[0]
+	}
+	return n.items[0]
+}
+
+func (n *btreeNode) max() *fs.UnicastRoute {
+	for !n.leaf() {
+		n = n.children[len(n.children)-1]
+	}
+	return n.items[len(n.items)-1]
+}
+
+// merge folds item i and child i+1 into child i.
+func (n *btreeNode) merge(i int) {
+	left, right := n.children[i], n.children[i+1]
+	left.items = append(left.items, n.items[i])
+	left.items = append(left.items, right.items...)
+	left.children = append(left.children, right.children...)
+	n.items = slices.Delete(n.items, i, i+1)
+	n.children = slices.Delete(n.children, i+1, i+2)
+}
+
+// fill makes sure child i holds at least degree items and returns its (possibly shifted) index.
+func (n *btreeNode) fill(i int) int {
+	switch {
+	case i > 0 && len(n.children[i-1].items) >= degree:
+		c, left := n.children[i], n.children[i-1]
+		c.items = slices.Insert(c.items, 0, n.items[i-1])
+		n.items[i-1] = left.items[len(left.items)-1]
+		left.items = left.items[:len(left.items)-1]
+		if !left.leaf() {
+			c.children = slices.Insert(c.children, 0, left.children[len(left.children)-1])
+			left.children = left.children[:len(left.children)-1]
+		}
+	case i < len(n.items) && len(n.children[i+1].items) >= degree:
+		c, right := n.children[i], n.children[i+1]
+		c.items = append(c.items, n.items[i])
+		n.items[i] = right.items[0]
+		right.items = slices.Delete(right.items, 0, 1)
+		if !right.leaf() {
+			c.children = append(c.children, right.children[0])
+			right.children = slices.Delete(right.children, 0, 1)
+		}
+	case i < len(n.items):
+		n.merge(i)
+	default:
+		n.merge(i - 1)
+		i--
+	}
+	return i
+}
+
+func (n *btreeNode) remove(p netip.Prefix) bool {
+	i, found := n.find(p)
+	if n.leaf() {
+		if !found {
+			return false
+		}
+		n.items = slices.Delete(n.items, i, i+1)
+		return true
+	}
+	if found {
+		switch {
+		case len(n.children[i].items) >= degree:
+			pred := n.children[i].max()
+			n.items[i] = pred
+			return n.children[i].remove(pred.Prefix)
+		case len(n.children[i+1].items) >= degree:
+			succ := n.children[i+1].min()
+			n.items[i] = succ
+			return n.children[i+1].remove(succ.Prefix)
+		}
+		n.merge(i)
+		return n.children[i].remove(p)
+	}
+	if len(n.children[i].items) < degree {
+		i = n.fill(i)
+	}
+	return n.children[i].remove(p)
+}
+
+// ascend calls fn for every item >= pivot in order until fn returns false.
+func (n *btreeNode) ascend(pivot netip.Prefix, fn func(*fs.UnicastRoute) bool) bool {
+	i, _ := n.find(pivot)
+	for ; i < len(n.items); i++ {
+		if !n.leaf() && !n.children[i].ascend(pivot, fn) {
+			return false
+		}
+		if !fn(n.items[i]) {
+			return false
+		}
+	}
+	if !n.leaf() {
+		return n.children[len(n.items)].ascend(pivot, fn)
+	}
+	return true
+}
+
+// Insert adds r, replacing any route for the same prefix.
+func (t *BTree) Insert(r *fs.UnicastRoute) {
+	t.mu.Lock()
+	t.insert(r)
+	t.mu.Unlock()
+	t.emit(Event{Kind: EventInsert, Prefix: r.Prefix, Route: r})
+}
+
+// BulkLoad replaces the table with routes sorted by SortRoutes and drops
+// all additional paths.
+// The tree is built bottom-up in O(n) instead of n inserts.
+func (t *BTree) BulkLoad(routes []*fs.UnicastRoute) error {
+	if err := checkSorted(routes); err != nil {
+		return err
+	}
+	var root *btreeNode
+	if len(routes) > 0 {
+		nodes, seps := buildLevel(routes, nil)
+		for len(nodes) > 1 {
+			nodes, seps = buildLevel(seps, nodes)
+		}
+		root = nodes[0]
+	}
+	t.mu.Lock()
+	t.root, t.size = root, len(routes)
+	t.resetPaths()
+	t.mu.Unlock()
+	t.emit(Event{Kind: EventLoaded, Count: len(routes)})
+	return nil
+}
+
+// buildLevel packs items into as few nodes as possible, each holding between
+// degree-1 and 2*degree-1 items, and returns the nodes plus the separators
+// that form the next level up. children, if any, has len(items)+1 entries.
+func buildLevel(items []*fs.UnicastRoute, children []*btreeNode) ([]*btreeNode, []*fs.UnicastRoute) {
+	const maxItems = 2*degree - 1
+	n := len(items)
+	count := (n + 1 + maxItems) / (maxItems + 1)
+	per := n - (count - 1)
+
+	var (
+		nodes []*btreeNode
+		seps  []*fs.UnicastRoute
+		pos   int
+		cpos  int
+	)
+	for i := 0; i < count; i++ {
+		m := per / count
+		if i < per%count {
+			m++
+		}
+		node := &btreeNode{items: slices.Clone(items[pos : pos+m])}
+		if children != nil {
+			node.children = slices.Clone(children[cpos : cpos+m+1])
+			cpos += m + 1
+		}
+		pos += m
+		nodes = append(nodes, node)
+		if i < count-1 {
+			seps = append(seps, items[pos])
+			pos++
+		}
+	}
+	return nodes, seps
+}
+
+func (t *BTree) insert(r *fs.UnicastRoute) {
+	r.Prefix = r.Prefix.Masked()
+	if t.root == nil {
+		t.root = &btreeNode{items: []*fs.UnicastRoute{r}}
+		t.size++
+		return
+	}
+	if len(t.root.items) == 2*degree-1 {
+		t.root = &btreeNode{children: []*btreeNode{t.root}}
+		t.root.splitChild(0)
+	}
+	if t.root.insertNonFull(r) {
+		t.size++
+	}
+}
+
+// Delete removes the route and the additional paths for p and reports
+// whether the route existed.
+func (t *BTree) Delete(p netip.Prefix) bool {
+	p = p.Masked()
+	t.mu.Lock()
+	ok := t.delete(p)
+	t.deletePaths(p)
+	t.mu.Unlock()
+	if ok {
+		t.emit(Event{Kind: EventDelete, Prefix: p})
+	}
+	return ok
+}
+
+func (t *BTree) delete(p netip.Prefix) bool {
+	if t.root == nil || !t.root.remove(p) {
+		return false
+	}
+	t.size--
+	if len(t.root.items) == 0 {
+		if t.root.leaf() {
+			t.root = nil
+		} else {
+			t.root = t.root.children[0]
+		}
+	}
+	return true
+}
+
+// BestPath returns the longest prefix match covering p.
+func (t *BTree) BestPath(p netip.Prefix) *fs.UnicastRoute {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	for bits := p.Bits(); bits >= 0; bits-- {
+		if r := t.root.get(netip.PrefixFrom(p.Addr(), bits).Masked()); r != nil {
+			return r
+		}
+	}
+	return nil
+}
+
+// MoreSpecifics returns all routes strictly more specific than p.
+func (t *BTree) MoreSpecifics(p netip.Prefix) []*fs.UnicastRoute {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if t.root == nil {
+		return nil
+	}
+	p = p.Masked()
+	var out []*fs.UnicastRoute
+	t.root.ascend(p, func(r *fs.UnicastRoute) bool {
+		if !p.Contains(r.Prefix.Addr()) {
+			return false
+		}
+		if r.Prefix.Bits() > p.Bits() {
+			out = append(out, r)
+		}
+		return true
+	})
+	return out
+}
+
+// Len returns the number of routes.
+func (t *BTree) Len() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.size
+}
+
+// InsertPath adds r as an additional path of its prefix, replacing the one
+// with the same PathID.
+func (t *BTree) InsertPath(r *fs.UnicastRoute) {
+	t.insertPath(r)
+	t.emit(Event{Kind: EventInsertPath, Prefix: r.Prefix.Masked(), Route: r})
+}
+
+// DeletePath removes the additional path id of p.
+func (t *BTree) DeletePath(p netip.Prefix, id uint32) bool {
+	p = p.Masked()
+	ok := t.deletePath(p, id)
+	if ok {
+		t.emit(Event{Kind: EventDeletePath, Prefix: p, PathID: id})
+	}
+	return ok
+}
+
+// AllPaths returns the best path of the longest prefix match covering p
+// followed by the additional paths of that prefix.
+func (t *BTree) AllPaths(p netip.Prefix) []*fs.UnicastRoute {
+	return t.allPaths(t.BestPath(p))
+}
@@ -0,0 +1,264 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package rib
+
+import (
+	"container/list"
+	"context"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	fs "floofspectools/flowspecinternal"
+)
+
+// DefaultCacheSize is the number of answers a Cache holds when
+// CacheOptions.Size is zero.
+const DefaultCacheSize = 65536
+
+// CacheOptions configures a Cache.
+type CacheOptions struct {
+	// Size bounds the cached answers; the least recently used are evicted.
+	Size int
+	// TTL is how long an answer is cached, zero keeps it until it is
+	// evicted or invalidated.
+	TTL time.Duration
+	// Now returns the current time, defaults to time.Now.
+	Now func() time.Time
+}
+
+// CacheStats counts the lookups of a Cache.
+type CacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64 // answers dropped for space, not by TTL or Invalidate
+}
+
+// Cache is a UnicastRIB caching the answers of another one, e.g. to spare a
+// remote backend during bulk validation. Answers are cached by query prefix;
+// when the backend changes, Invalidate the changed prefix or let an Index
+// do it with idx.Notify(cache.Observe). Its methods are safe for concurrent
+// use. It implements fs.UnicastRIBCtx, passing ctx on if the backend does.
+type Cache struct {
+	backend fs.UnicastRIB
+	ctxRIB  fs.UnicastRIBCtx
+	size    int
+	ttl     time.Duration
+	now     func() time.Time
+
+	hits, misses, evictions atomic.Uint64
+
+	mu      sync.Mutex
+	lru     *list.List // of *cacheEntry, most recently used first
+	entries map[cacheKey]*list.Element
+	// gen counts invalidations, an answer queried across one is not cached
+	gen uint64
+}
+
+type cacheKind uint8
+
+const (
+	cacheBestPath cacheKind = iota
+	cacheMoreSpecifics
+	cacheAllPaths
+)
+
+type cacheKey struct {
+	kind cacheKind
+	p    netip.Prefix
+}
+
+type cacheEntry struct {
+	key     cacheKey
+	routes  []*fs.UnicastRoute
+	expires time.Time
+}
+
+// NewCache returns a Cache in front of backend.
+func NewCache(backend fs.UnicastRIB, opts *CacheOptions) *Cache {
+	var o CacheOptions
+	if opts != nil {
+		o = *opts
+	}
+	if o.Size <= 0 {
+		o.Size = DefaultCacheSize
+	}
+	if o.Now == nil {
+		o.Now = time.Now
+	}
+	c := &Cache{
+		backend: backend,
+		size:    o.Size,
+		ttl:     o.TTL,
+		now:     o.Now,
+		lru:     list.New(),
+		entries: make(map[cacheKey]*list.Element),
+	}
+	c.ctxRIB, _ = backend.(fs.UnicastRIBCtx)
+	return c
+}
+
+// Stats returns the lookup counters.
+func (c *Cache) Stats() CacheStats {
+	return CacheStats{Hits: c.hits.Load(), Misses: c.misses.Load(), Evictions: c.evictions.Load()}
+}
+
+// Len returns the number of cached answers.
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// BestPath implements fs.UnicastRIB.
+func (c *Cache) BestPath(p netip.Prefix) *fs.UnicastRoute {
+	r, _ := c.BestPathCtx(context.Background(), p)
+	return r
+}
+
+// MoreSpecifics implements fs.UnicastRIB.
+func (c *Cache) MoreSpecifics(p netip.Prefix) []*fs.UnicastRoute {
+	rs, _ := c.MoreSpecificsCtx(context.Background(), p)
+	return rs
+}
+
+// AllPaths implements fs.UnicastRIB.
+func (c *Cache) AllPaths(p netip.Prefix) []*fs.UnicastRoute {
+	rs, _ := c.AllPathsCtx(context.Background(), p)
+	return rs
+}
+
+// BestPathCtx implements fs.UnicastRIBCtx.
+func (c *Cache) BestPathCtx(ctx context.Context, p netip.Prefix) (*fs.UnicastRoute, error) {
+	rs, err := c.lookup(ctx, cacheKey{cacheBestPath, p.Masked()})
+	if len(rs) == 0 {
+		return nil, err
+	}
+	return rs[0], nil
+}
+
+// MoreSpecificsCtx implements fs.UnicastRIBCtx.
+func (c *Cache) MoreSpecificsCtx(ctx context.Context, p netip.Prefix) ([]*fs.UnicastRoute, error) {
+	return c.lookup(ctx, cacheKey{cacheMoreSpecifics, p.Masked()})
+}
+
+// AllPathsCtx implements fs.UnicastRIBCtx.
+func (c *Cache) AllPathsCtx(ctx context.Context, p netip.Prefix) ([]*fs.UnicastRoute, error) {
+	return c.lookup(ctx, cacheKey{cacheAllPaths, p.Masked()})
+}
+
+// lookup returns the cached answer for k or asks the backend. Failed
+// lookups are not cached.
+func (c *Cache) lookup(ctx context.Context, k cacheKey) ([]*fs.UnicastRoute, error) {
+	c.mu.Lock()
+	if el, ok := c.entries[k]; ok {
+		e := el.Value.(*cacheEntry)
+		if e.expires.IsZero() || c.now().Before(e.expires) {
+			c.lru.MoveToFront(el)
+			c.mu.Unlock()
+			c.hits.Add(1)
+			return e.routes, nil
+		}
+		c.remove(el)
+	}
+	gen := c.gen
+	c.mu.Unlock()
+	c.misses.Add(1)
+
+	rs, err := c.query(ctx, k)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.gen != gen {
+		return rs, nil
+	}
+	e := &cacheEntry{key: k, routes: rs}
+	if c.ttl > 0 {
+		e.expires = c.now().Add(c.ttl)
+	}
+	if el, ok := c.entries[k]; ok {
+		c.remove(el)
+	}
+	c.entries[k] = c.lru.PushFront(e)
+	for c.lru.Len() > c.size {
+		c.remove(c.lru.Back())
+		c.evictions.Add(1)
+	}
+	return rs, nil
+}
+
+func (c *Cache) query(ctx context.Context, k cacheKey) ([]*fs.UnicastRoute, error) {
+	if c.ctxRIB != nil {
+		switch k.kind {
+		case cacheBestPath:
+			r, err := c.ctxRIB.BestPathCtx(ctx, k.p)
+			if r == nil {
+				return nil, err
+			}
+			return []*fs.UnicastRoute{r}, err
+		case cacheMoreSpecifics:
+			return c.ctxRIB.MoreSpecificsCtx(ctx, k.p)
+		}
+		return c.ctxRIB.AllPathsCtx(ctx, k.p)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	switch k.kind {
+	case cacheBestPath:
+		if r := c.backend.BestPath(k.p); r != nil {
+			return []*fs.UnicastRoute{r}, nil
+		}
+		return nil, nil
+	case cacheMoreSpecifics:
+		return c.backend.MoreSpecifics(k.p), nil
+	}
+	return c.backend.AllPaths(k.p), nil
+}
+
+func (c *Cache) remove(el *list.Element) {
+	delete(c.entries, c.lru.Remove(el).(*cacheEntry).key)
+}
+
+// Invalidate drops the answers a change of the route for p can affect:
+// best paths and all paths of prefixes within p, and more-specifics of
+// prefixes covering p. It costs a pass over the cached answers.
+func (c *Cache) Invalidate(p netip.Prefix) {
+	p = p.Masked()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	for k, el := range c.entries {
+		affected := k.p.Bits() >= p.Bits() && p.Contains(k.p.Addr())
+		if k.kind == cacheMoreSpecifics {
+			affected = k.p.Bits() < p.Bits() && k.p.Contains(p.Addr())
+		}
+		if affected {
+			c.remove(el)
+		}
+	}
+}
+
+// InvalidateAll drops all cached answers.
+func (c *Cache) InvalidateAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	c.lru.Init()
+	clear(c.entries)
+}
+
+// Observe invalidates the answers an Index change affects, for use with
+// Index.Notify.
+func (c *Cache) Observe(e Event) {
+	if e.Kind == EventLoaded {
+		c.InvalidateAll()
+		return
+	}
+	c.Invalidate(e.Prefix)
+}
@@ -0,0 +1,109 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package rib
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"testing"
+	"time"
+
+	fs "floofspectools/flowspecinternal"
+)
+
+func TestCache(t *testing.T) {
+	trie := NewTrie()
+	trie.Insert(&fs.UnicastRoute{Prefix: netip.MustParsePrefix("192.0.2.0/24"), NeighborAS: 64500})
+	now := time.Unix(0, 0)
+	c := NewCache(trie, &CacheOptions{Size: 3, TTL: time.Minute, Now: func() time.Time { return now }})
+	trie.Notify(c.Observe)
+
+	p := netip.MustParsePrefix("192.0.2.0/25")
+	if r := c.BestPath(p); r == nil || r.NeighborAS != 64500 {
+		t.Fatalf("BestPath() = %v, want the /24", r)
+	}
+	c.BestPath(p)
+	c.BestPath(netip.MustParsePrefix("192.0.2.1/25")) // same prefix once masked
+	if got, want := c.Stats(), (CacheStats{Hits: 2, Misses: 1}); got != want {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+
+	// a more specific route changes the answers for p and for the /24
+	c.MoreSpecifics(netip.MustParsePrefix("192.0.2.0/24"))
+	c.AllPaths(netip.MustParsePrefix("198.51.100.0/24"))
+	trie.Insert(&fs.UnicastRoute{Prefix: netip.MustParsePrefix("192.0.2.0/25"), NeighborAS: 64501})
+	if c.Len() != 1 {
+		t.Errorf("Len() after Insert = %d, want 1 unaffected answer", c.Len())
+	}
+	if r := c.BestPath(p); r == nil || r.NeighborAS != 64501 {
+		t.Errorf("BestPath() after Insert = %v, want the /25", r)
+	}
+	if rs := c.MoreSpecifics(netip.MustParsePrefix("192.0.2.0/24")); len(rs) != 1 {
+		t.Errorf("MoreSpecifics() after Insert = %v, want the /25", rs)
+	}
+
+	c.BestPath(netip.MustParsePrefix("203.0.113.0/24"))
+	if st := c.Stats(); st.Evictions != 1 || c.Len() != 3 {
+		t.Errorf("Stats() = %+v with %d answers, want 1 eviction and 3 answers", st, c.Len())
+	}
+
+	misses := c.Stats().Misses
+	now = now.Add(time.Minute)
+	c.BestPath(p)
+	if got := c.Stats().Misses; got != misses+1 {
+		t.Errorf("lookup after the TTL missed %d times, want 1", got-misses)
+	}
+
+	if err := trie.BulkLoad(nil); err != nil {
+		t.Fatal(err)
+	}
+	if c.Len() != 0 || c.BestPath(p) != nil {
+		t.Errorf("Len() after BulkLoad = %d, want 0", c.Len())
+	}
+}
+
+func TestCacheInvalidate(t *testing.T) {
+	c := NewCache(NewTrie(), nil)
+	for _, s := range []string{"192.0.2.0/24", "192.0.2.0/26", "192.0.2.128/25", "198.51.100.0/24", "2001:db8::/32"} {
+		c.BestPath(netip.MustParsePrefix(s))
+		c.MoreSpecifics(netip.MustParsePrefix(s))
+	}
+	c.Invalidate(netip.MustParsePrefix("192.0.2.0/25"))
+
+	tests := []struct {
+		kind   cacheKind
+		prefix string
+		want   bool
+	}{
+		{cacheBestPath, "192.0.2.0/24", true},
+		{cacheBestPath, "192.0.2.0/26", false},
+		{cacheBestPath, "192.0.2.128/25", true},
+		{cacheMoreSpecifics, "192.0.2.0/24", false},
+		{cacheMoreSpecifics, "192.0.2.0/26", true},
+		{cacheMoreSpecifics, "192.0.2.128/25", true},
+		{cacheBestPath, "198.51.100.0/24", true},
+		{cacheMoreSpecifics, "2001:db8::/32", true},
+	}
+	for _, tt := range tests {
+		if _, ok := c.entries[cacheKey{tt.kind, netip.MustParsePrefix(tt.prefix)}]; ok != tt.want {
+			t.Errorf("kind %d %s cached = %v, want %v", tt.kind, tt.prefix, ok, tt.want)
+		}
+	}
+}
+
+func TestCacheCtx(t *testing.T) {
+	c := NewCache(NewTrie(), nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	dst := netip.MustParsePrefix("192.0.2.0/24")
+	route := &fs.FlowSpecRoute{DestPrefix: &dst}
+	if err := fs.ValidateFeasibilityCtx(ctx, route, c, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("ValidateFeasibilityCtx(canceled) = %v, want %v", err, context.Canceled)
+	}
+	if c.Len() != 0 {
+		t.Errorf("Len() = %d, want failed lookups not cached", c.Len())
+	}
+}
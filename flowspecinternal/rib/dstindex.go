@@ -0,0 +1,82 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package rib
+
+import (
+	"net/netip"
+	"slices"
+)
+
+type dstNode struct {
+	child   [2]*dstNode
+	entries []*FlowSpecEntry
+}
+
+// dstIndex is a binary trie of entries by destination prefix, see
+// destination. Entries without one are not indexed.
+type dstIndex struct {
+	v4, v6 *dstNode
+}
+
+func newDstIndex(entries []*FlowSpecEntry) *dstIndex {
+	x := &dstIndex{v4: &dstNode{}, v6: &dstNode{}}
+	for _, e := range entries {
+		p, ok := destination(e.Route)
+		if !ok {
+			continue
+		}
+		n := x.root(p)
+		for i := range p.Bits() {
+			b := addrBit(p.Addr(), i)
+			if n.child[b] == nil {
+				n.child[b] = &dstNode{}
+			}
+			n = n.child[b]
+		}
+		n.entries = append(n.entries, e)
+	}
+	return x
+}
+
+func (x *dstIndex) root(p netip.Prefix) *dstNode {
+	if p.Addr().Is4() {
+		return x.v4
+	}
+	return x.v6
+}
+
+// covering returns the entries whose destination contains p, p included.
+func (x *dstIndex) covering(p netip.Prefix) []*FlowSpecEntry {
+	p = p.Masked()
+	n := x.root(p)
+	out := slices.Clone(n.entries)
+	for i := 0; i < p.Bits() && n != nil; i++ {
+		if n = n.child[addrBit(p.Addr(), i)]; n != nil {
+			out = append(out, n.entries...)
+		}
+	}
+	return out
+}
+
+// coveredBy returns the entries whose destination lies within p, p included.
+func (x *dstIndex) coveredBy(p netip.Prefix) []*FlowSpecEntry {
+	p = p.Masked()
+	n := x.root(p)
+	for i := 0; i < p.Bits() && n != nil; i++ {
+		n = n.child[addrBit(p.Addr(), i)]
+	}
+	var out []*FlowSpecEntry
+	var walk func(n *dstNode)
+	walk = func(n *dstNode) {
+		if n == nil {
+			return
+		}
+		out = append(out, n.entries...)
+		walk(n.child[0])
+		walk(n.child[1])
+	}
+	walk(n)
+	return out
+}
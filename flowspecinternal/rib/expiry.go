@@ -0,0 +1,159 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package rib
+
+import (
+	"context"
+	"time"
+
+	fs "floofspectools/flowspecinternal"
+)
+
+var (
+	ErrExpired = fs.NewError(fs.StagePolicy, "rule-expired", "", "rib: rule lifetime expired")
+	ErrIdle    = fs.NewError(fs.StagePolicy, "rule-idle", "", "rib: rule matched no traffic within its idle timeout")
+)
+
+// DefaultExpiryInterval is how often RunExpiry checks the lifetimes when
+// called with a non-positive interval.
+const DefaultExpiryInterval = time.Second
+
+// Lifetime bounds how long a rule stays in a FlowSpecRIB. A zero field
+// disables that limit.
+type Lifetime struct {
+	// TTL withdraws the rule this long after it was inserted or last
+	// refreshed.
+	TTL time.Duration
+	// Idle withdraws the rule once no traffic was reported for it with
+	// ReportCounters for this long, counted from its last match or, if it
+	// did not match since, from its insertion or last refresh.
+	Idle time.Duration
+}
+
+type txLifetime struct {
+	Lifetime
+	route *fs.FlowSpecRoute
+}
+
+type lifetime struct {
+	Lifetime
+	since time.Time
+}
+
+// deadline returns when the rule expires with the given last match and the
+// error it expires with, or the zero time if it does not expire.
+func (l *lifetime) deadline(lastMatch time.Time) (time.Time, error) {
+	var at time.Time
+	var err error
+	if l.TTL > 0 {
+		at, err = l.since.Add(l.TTL), ErrExpired
+	}
+	if l.Idle > 0 {
+		idle := l.since
+		if lastMatch.After(idle) {
+			idle = lastMatch
+		}
+		if idle = idle.Add(l.Idle); at.IsZero() || idle.Before(at) {
+			at, err = idle, ErrIdle
+		}
+	}
+	return at, err
+}
+
+// SetLifetime sets the lifetime of route, counted from the end of the
+// transaction, or removes it for a zero Lifetime. Routes not in the table
+// then get none. The lifetime is dropped with the rule; replacing the rule
+// with Insert keeps it.
+func (tx *FlowSpecTx) SetLifetime(route *fs.FlowSpecRoute, lt Lifetime) {
+	if tx.lifetimes == nil {
+		tx.lifetimes = make(map[string]txLifetime)
+	}
+	tx.lifetimes[FlowSpecKey(route)] = txLifetime{Lifetime: lt, route: route}
+}
+
+// InsertWithLifetime is Insert followed by SetLifetime in one Apply.
+func (r *FlowSpecRIB) InsertWithLifetime(route *fs.FlowSpecRoute, err error, lt Lifetime) {
+	r.Apply(func(tx *FlowSpecTx) {
+		tx.Insert(route, err)
+		tx.SetLifetime(route, lt)
+	})
+}
+
+// Refresh restarts the lifetime of route from now. It returns
+// ErrUnknownRule if route is not in the RIB and does nothing for routes
+// without a lifetime.
+func (r *FlowSpecRIB) Refresh(route *fs.FlowSpecRoute) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.snap.Load().Get(route); !ok {
+		return ErrUnknownRule
+	}
+	if l := r.lifetimes[FlowSpecKey(route)]; l != nil {
+		l.since = r.now()
+	}
+	return nil
+}
+
+// Expiry returns when route expires unless refreshed or, for an idle
+// timeout, matched, and the zero time if it has no lifetime.
+func (r *FlowSpecRIB) Expiry(route *fs.FlowSpecRoute) time.Time {
+	key := FlowSpecKey(route)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	l := r.lifetimes[key]
+	if l == nil {
+		return time.Time{}
+	}
+	at, _ := l.deadline(r.acct.lastMatch(key))
+	return at
+}
+
+// Expire withdraws the rules whose lifetime ran out, and the stale rules not
+// re-inserted in time, and returns them. The RuleWithdrawn events of expired
+// rules carry ErrExpired, ErrIdle or ErrStale. Stale rules of a peer with a
+// FlowSpecOptions.LongLivedStaleTime are first kept as long-lived stale.
+func (r *FlowSpecRIB) Expire() []*fs.FlowSpecRoute {
+	var expired []*fs.FlowSpecRoute
+	r.Apply(func(tx *FlowSpecTx) {
+		now := r.now()
+		for i := len(tx.entries) - 1; i >= 0; i-- {
+			e := tx.entries[i]
+			if t, ok := r.stale[e.Key]; ok && !now.Before(t.until) {
+				if r.expireStale(tx, i, now) {
+					expired = append(expired, e.Route)
+				}
+				continue
+			}
+			l := r.lifetimes[e.Key]
+			if l == nil {
+				continue
+			}
+			at, err := l.deadline(r.acct.lastMatch(e.Key))
+			if at.IsZero() || now.Before(at) {
+				continue
+			}
+			tx.remove(i, err)
+			expired = append(expired, e.Route)
+		}
+	})
+	return expired
+}
+
+// RunExpiry calls Expire every interval until ctx is done.
+func (r *FlowSpecRIB) RunExpiry(ctx context.Context, interval time.Duration) error {
+	if interval <= 0 {
+		interval = DefaultExpiryInterval
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+			r.Expire()
+		}
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package rib
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/events"
+)
+
+func TestFlowSpecRIBExpiry(t *testing.T) {
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	now := start
+	bus := events.NewBus()
+	var withdrawn []events.Event
+	bus.Subscribe(func(e events.Event) { withdrawn = append(withdrawn, e) }, events.RuleWithdrawn)
+	r := NewFlowSpecRIB(&FlowSpecOptions{Events: bus, Now: func() time.Time { return now }})
+
+	ttl := flowSpecRoute(t, "dst 192.0.2.0/24")
+	refreshed := flowSpecRoute(t, "dst 192.0.2.0/25")
+	idle := flowSpecRoute(t, "dst 198.51.100.0/24")
+	matched := flowSpecRoute(t, "dst 198.51.100.0/25")
+	forever := flowSpecRoute(t, "dst 203.0.113.0/24")
+	r.InsertWithLifetime(ttl, nil, Lifetime{TTL: 10 * time.Minute})
+	r.InsertWithLifetime(refreshed, nil, Lifetime{TTL: 10 * time.Minute})
+	r.InsertWithLifetime(idle, nil, Lifetime{Idle: 5 * time.Minute})
+	r.InsertWithLifetime(matched, nil, Lifetime{Idle: 5 * time.Minute})
+	r.Insert(forever, nil)
+
+	if got, want := r.Expiry(ttl), start.Add(10*time.Minute); !got.Equal(want) {
+		t.Errorf("Expiry(ttl) = %v, want %v", got, want)
+	}
+	if got := r.Expiry(forever); !got.IsZero() {
+		t.Errorf("Expiry(forever) = %v, want zero", got)
+	}
+	if err := r.Refresh(flowSpecRoute(t, "dst 10.0.0.0/8")); !errors.Is(err, ErrUnknownRule) {
+		t.Errorf("Refresh(unknown) error = %v, want %v", err, ErrUnknownRule)
+	}
+
+	if err := r.ReportCounters("edge1", matched, now, Counters{Packets: 1}); err != nil {
+		t.Fatal(err)
+	}
+	now = start.Add(4 * time.Minute)
+	if err := r.ReportCounters("edge1", matched, now, Counters{Packets: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if got := r.Expire(); len(got) != 0 {
+		t.Errorf("Expire() at 4m = %d rules, want none", len(got))
+	}
+
+	now = start.Add(5 * time.Minute)
+	if err := r.Refresh(refreshed); err != nil {
+		t.Fatal(err)
+	}
+	if got := r.Expire(); len(got) != 1 || got[0] != idle {
+		t.Errorf("Expire() at 5m = %v, want the idle rule", got)
+	}
+
+	now = start.Add(10 * time.Minute)
+	if got := r.Expire(); len(got) != 2 {
+		t.Errorf("Expire() at 10m = %d rules, want ttl and matched", len(got))
+	}
+	if got, want := r.Snapshot().Len(), 2; got != want {
+		t.Errorf("Len() = %d, want %d", got, want)
+	}
+
+	now = start.Add(15 * time.Minute)
+	if got := r.Expire(); len(got) != 1 || got[0] != refreshed {
+		t.Errorf("Expire() at 15m = %v, want the refreshed rule", got)
+	}
+	if _, ok := r.Snapshot().Get(forever); !ok {
+		t.Error("rule without lifetime expired")
+	}
+
+	wantErrs := map[string]error{
+		FlowSpecKey(idle):      ErrIdle,
+		FlowSpecKey(ttl):       ErrExpired,
+		FlowSpecKey(matched):   ErrIdle,
+		FlowSpecKey(refreshed): ErrExpired,
+	}
+	if len(withdrawn) != len(wantErrs) {
+		t.Fatalf("got %d withdrawn events, want %d", len(withdrawn), len(wantErrs))
+	}
+	for _, e := range withdrawn {
+		if want := wantErrs[FlowSpecKey(e.Route)]; !errors.Is(e.Err, want) {
+			t.Errorf("withdrawn %s error = %v, want %v", e.Route.Components, e.Err, want)
+		}
+		if got := fs.ErrorStage(e.Err); got != fs.StagePolicy {
+			t.Errorf("withdrawn %s stage = %v, want %v", e.Route.Components, got, fs.StagePolicy)
+		}
+	}
+
+	// a deleted rule loses its lifetime
+	r.InsertWithLifetime(ttl, nil, Lifetime{TTL: time.Minute})
+	r.Delete(ttl)
+	r.Insert(ttl, nil)
+	now = now.Add(time.Hour)
+	if got := r.Expire(); len(got) != 0 {
+		t.Errorf("Expire() of re-inserted rule = %v, want none", got)
+	}
+}
+
+func TestFlowSpecRIBRunExpiry(t *testing.T) {
+	r := NewFlowSpecRIB(nil)
+	route := flowSpecRoute(t, "dst 192.0.2.0/24")
+	r.InsertWithLifetime(route, nil, Lifetime{TTL: time.Millisecond})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	done := make(chan error)
+	go func() { done <- r.RunExpiry(ctx, time.Millisecond) }()
+	for r.Snapshot().Len() != 0 {
+		if ctx.Err() != nil {
+			t.Fatal("rule did not expire")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("RunExpiry() error = %v, want %v", err, context.Canceled)
+	}
+}
@@ -0,0 +1,428 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package rib
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"fmt"
+	"iter"
+	"log/slog"
+	"net/netip"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/events"
+)
+
+// FlowSpecEntry is a FlowSpec route held by a FlowSpecRIB together with the
+// result of its validation. Entries are shared between snapshots and must
+// not be modified.
+type FlowSpecEntry struct {
+	Key   string
+	Route *fs.FlowSpecRoute
+	// Err is the validation result, nil for a feasible route.
+	Err error
+	// Stale is set by MarkStale until the route is re-inserted or flushed.
+	Stale bool
+}
+
+// FlowSpecKey identifies r among the routes of a FlowSpecRIB: AFI, SAFI, RD
+// and the canonical form of its components.
+func FlowSpecKey(r *fs.FlowSpecRoute) string {
+	return fmt.Sprintf("%d/%d/%x/%s", r.AFI, r.SAFI, r.RD, r.Components.Canonical(nil))
+}
+
+// WithMetadata returns a filter selecting the entries whose route has every
+// key of sel in its Metadata with the given value, or with any value for an
+// empty one.
+func WithMetadata(sel map[string]string) func(*FlowSpecEntry) bool {
+	return func(e *FlowSpecEntry) bool {
+		for k, v := range sel {
+			if got, ok := e.Route.Metadata[k]; !ok || v != "" && got != v {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// FlowSpecRIB holds received or originated FlowSpec routes for one writer and
+// any number of readers. Every change publishes a new immutable
+// FlowSpecSnapshot; readers such as the matcher or exporters take one with
+// Snapshot and keep a consistent view without ever blocking the writer.
+//
+// Changes copy the table, O(n) per Insert or Delete. Use Apply to batch
+// several changes into one copy and one snapshot.
+//
+// Every change is published on FlowSpecOptions.Events once its snapshot is
+// visible: RuleAccepted or RuleRejected for inserted routes, RuleWithdrawn
+// for deleted ones and RuleRevalidated from Revalidate.
+//
+// Rules inserted with a Lifetime are withdrawn by Expire, or RunExpiry in
+// the background, once their TTL runs out or they matched no traffic for
+// their idle timeout, so mitigations do not outlive the attack by accident.
+//
+// The routes of a restarting peer are marked with MarkStale and, like BGP
+// graceful restart (RFC4724), stay in force until re-announced or flushed.
+type FlowSpecRIB struct {
+	mu   sync.Mutex // serializes writers
+	snap atomic.Pointer[FlowSpecSnapshot]
+	bus  *events.Bus
+	log  *slog.Logger
+	acct *accounting
+	now  func() time.Time
+	// lifetimes holds the rules inserted with a Lifetime, guarded by mu.
+	lifetimes map[string]*lifetime
+	// stale holds the timers of the stale rules, guarded by mu.
+	stale     map[string]staleTimer
+	onStale   func(route *fs.FlowSpecRoute, stale bool)
+	longLived func(route *fs.FlowSpecRoute) time.Duration
+}
+
+// FlowSpecOptions configures a FlowSpecRIB.
+type FlowSpecOptions struct {
+	// Events, if set, receives the changes.
+	Events *events.Bus
+	// Logger, if set, receives the changes at debug and revalidations at
+	// info level.
+	Logger *slog.Logger
+	// AccountingResolution and AccountingRetention set the bucket size and
+	// history of the traffic reported with ReportCounters, defaulting to
+	// DefaultAccountingResolution and DefaultAccountingRetention.
+	AccountingResolution time.Duration
+	AccountingRetention  time.Duration
+	// OnStale, if set, is called once a change is published for every
+	// route MarkStale marked stale and every stale route re-inserted, so a
+	// dataplane can flag the rules it keeps enforcing. Flushed routes are
+	// published as RuleWithdrawn with ErrStale instead.
+	OnStale func(route *fs.FlowSpecRoute, stale bool)
+	// LongLivedStaleTime, if set, returns the RFC9494 long-lived stale time
+	// of the peer of a route, 0 if it has none, see Expire.
+	LongLivedStaleTime func(route *fs.FlowSpecRoute) time.Duration
+	// Now returns the current time, defaults to time.Now.
+	Now func() time.Time
+}
+
+// NewFlowSpecRIB returns an empty FlowSpecRIB.
+func NewFlowSpecRIB(opts *FlowSpecOptions) *FlowSpecRIB {
+	var o FlowSpecOptions
+	if opts != nil {
+		o = *opts
+	}
+	if o.Now == nil {
+		o.Now = time.Now
+	}
+	r := &FlowSpecRIB{
+		bus:       o.Events,
+		log:       fs.SubsystemLogger(o.Logger, fs.SubsystemRIB),
+		acct:      newAccounting(o.AccountingResolution, o.AccountingRetention),
+		now:       o.Now,
+		lifetimes: make(map[string]*lifetime),
+		stale:     make(map[string]staleTimer),
+		onStale:   o.OnStale,
+		longLived: o.LongLivedStaleTime,
+	}
+	r.snap.Store(&FlowSpecSnapshot{})
+	return r
+}
+
+// Snapshot returns the current table. It does not lock.
+func (r *FlowSpecRIB) Snapshot() *FlowSpecSnapshot {
+	return r.snap.Load()
+}
+
+// Insert adds route with its validation result, replacing the route with the
+// same FlowSpecKey.
+func (r *FlowSpecRIB) Insert(route *fs.FlowSpecRoute, err error) {
+	r.Apply(func(tx *FlowSpecTx) { tx.Insert(route, err) })
+}
+
+// Delete removes the route with the same FlowSpecKey as route and reports
+// whether it existed.
+func (r *FlowSpecRIB) Delete(route *fs.FlowSpecRoute) bool {
+	return r.Withdraw(route, nil)
+}
+
+// Withdraw is Delete with reason as the Err of the RuleWithdrawn event, e.g.
+// why a controller ended a mitigation.
+func (r *FlowSpecRIB) Withdraw(route *fs.FlowSpecRoute, reason error) bool {
+	var found bool
+	r.Apply(func(tx *FlowSpecTx) { found = tx.Withdraw(route, reason) })
+	return found
+}
+
+// Apply runs fn on a private copy of the table and publishes the result as
+// one snapshot, followed by the events of its changes. Writers calling Apply
+// concurrently are serialized, and so are their events.
+func (r *FlowSpecRIB) Apply(fn func(tx *FlowSpecTx)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	old := r.snap.Load()
+	tx := &FlowSpecTx{entries: slices.Clone(old.entries)}
+	fn(tx)
+	for _, e := range tx.events {
+		switch e.Kind {
+		case events.RuleWithdrawn:
+			key := FlowSpecKey(e.Route)
+			r.acct.forget(key)
+			delete(r.lifetimes, key)
+			delete(r.stale, key)
+		case events.RuleAccepted, events.RuleRejected:
+			delete(r.stale, FlowSpecKey(e.Route))
+		}
+	}
+	for key, lt := range tx.lifetimes {
+		if _, found := search(tx.entries, &FlowSpecEntry{Key: key, Route: lt.route}); !found || lt.Lifetime == (Lifetime{}) {
+			delete(r.lifetimes, key)
+		} else {
+			r.lifetimes[key] = &lifetime{Lifetime: lt.Lifetime, since: r.now()}
+		}
+	}
+	if !tx.changed {
+		return
+	}
+	r.snap.Store(&FlowSpecSnapshot{entries: tx.entries, version: old.version + 1})
+	for _, e := range tx.events {
+		r.logEvent(e)
+		r.bus.Publish(e)
+	}
+	if r.onStale != nil {
+		for _, c := range tx.stale {
+			r.onStale(c.route, c.stale)
+		}
+	}
+}
+
+func (r *FlowSpecRIB) logEvent(e events.Event) {
+	level := slog.LevelDebug
+	if e.Kind == events.RuleRevalidated {
+		level = slog.LevelInfo
+	}
+	if !r.log.Enabled(context.Background(), level) {
+		return
+	}
+	attrs := []any{"event", e.Kind.String(), fs.LogKeyPeer, e.Route.NeighborAS, fs.LogKeyRule, FlowSpecKey(e.Route)}
+	if e.Route.DestPrefix != nil {
+		attrs = append(attrs, fs.LogKeyPrefix, e.Route.DestPrefix.String())
+	}
+	if e.Err != nil {
+		attrs = append(attrs, "error", e.Err)
+	}
+	r.log.Log(context.Background(), level, "flowspec rib change", attrs...)
+}
+
+// Revalidate runs validate on every route, e.g. fs.ValidateFeasibility
+// against a changed unicast RIB, and replaces the entries whose result
+// changed. Only the routes of entries matching filter are validated; a nil
+// filter selects all.
+func (r *FlowSpecRIB) Revalidate(validate func(*fs.FlowSpecRoute) error, filter func(*FlowSpecEntry) bool) {
+	r.Apply(func(tx *FlowSpecTx) {
+		for i, e := range tx.entries {
+			if filter != nil && !filter(e) {
+				continue
+			}
+			tx.revalidate(i, validate(e.Route))
+		}
+	})
+}
+
+// RevalidatePrefix is Revalidate for the routes a change of the unicast
+// route for p can affect: those whose destination prefix covers p, whose
+// best match p may become, or lies within p, whose more specifics p may be.
+// It finds them with the destination prefix index of Covering instead of
+// validating every route.
+func (r *FlowSpecRIB) RevalidatePrefix(validate func(*fs.FlowSpecRoute) error, p netip.Prefix) {
+	r.Apply(func(tx *FlowSpecTx) {
+		// Apply holds mu, so the snapshot has the entries tx started with
+		s := r.Snapshot()
+		for _, e := range append(s.Covering(p), s.CoveredBy(p)...) {
+			// an entry with prefix p is in both
+			if i, found := search(tx.entries, e); found && tx.entries[i] == e {
+				tx.revalidate(i, validate(e.Route))
+			}
+		}
+	})
+}
+
+// FlowSpecTx is the private table an Apply function changes. It must not be
+// used after the function returns.
+type FlowSpecTx struct {
+	entries []*FlowSpecEntry
+	changed bool
+	events  []events.Event
+	// lifetimes set with SetLifetime
+	lifetimes map[string]txLifetime
+	// stale changes for FlowSpecOptions.OnStale
+	stale []staleChange
+}
+
+// Insert adds route with its validation result, replacing the route with the
+// same FlowSpecKey.
+func (tx *FlowSpecTx) Insert(route *fs.FlowSpecRoute, err error) {
+	e := &FlowSpecEntry{Key: FlowSpecKey(route), Route: route, Err: err}
+	i, found := search(tx.entries, e)
+	if found {
+		if tx.entries[i].Stale {
+			tx.stale = append(tx.stale, staleChange{route, false})
+		}
+		tx.entries[i] = e
+	} else {
+		tx.entries = slices.Insert(tx.entries, i, e)
+	}
+	tx.changed = true
+	if err == nil {
+		tx.events = append(tx.events, events.Event{Kind: events.RuleAccepted, Route: route})
+	} else {
+		tx.events = append(tx.events, events.Event{Kind: events.RuleRejected, Route: route, Err: err})
+	}
+}
+
+// Delete removes the route with the same FlowSpecKey as route and reports
+// whether it existed.
+func (tx *FlowSpecTx) Delete(route *fs.FlowSpecRoute) bool {
+	return tx.Withdraw(route, nil)
+}
+
+// Withdraw is Delete with reason as the Err of the RuleWithdrawn event.
+func (tx *FlowSpecTx) Withdraw(route *fs.FlowSpecRoute, reason error) bool {
+	i, found := search(tx.entries, &FlowSpecEntry{Key: FlowSpecKey(route), Route: route})
+	if found {
+		tx.remove(i, reason)
+	}
+	return found
+}
+
+// revalidate replaces entry i if its validation result err changed.
+func (tx *FlowSpecTx) revalidate(i int, err error) {
+	e := tx.entries[i]
+	if (err == nil) == (e.Err == nil) && (err == nil || err.Error() == e.Err.Error()) {
+		return
+	}
+	tx.entries[i] = &FlowSpecEntry{Key: e.Key, Route: e.Route, Err: err, Stale: e.Stale}
+	tx.changed = true
+	tx.events = append(tx.events, events.Event{Kind: events.RuleRevalidated, Route: e.Route, Err: err, Previous: e.Err})
+}
+
+// remove deletes entry i, withdrawn for reason err.
+func (tx *FlowSpecTx) remove(i int, err error) {
+	tx.events = append(tx.events, events.Event{Kind: events.RuleWithdrawn, Route: tx.entries[i].Route, Err: err})
+	tx.entries = slices.Delete(tx.entries, i, i+1)
+	tx.changed = true
+}
+
+// Clear removes all routes.
+func (tx *FlowSpecTx) Clear() {
+	for _, e := range tx.entries {
+		tx.events = append(tx.events, events.Event{Kind: events.RuleWithdrawn, Route: e.Route})
+	}
+	if len(tx.entries) > 0 {
+		tx.entries, tx.changed = nil, true
+	}
+}
+
+// FlowSpecSnapshot is an immutable view of a FlowSpecRIB. Entries are
+// ordered by AFI, SAFI and RD and within those in RFC8955 5.1 order, so a
+// matcher can evaluate them front to back.
+type FlowSpecSnapshot struct {
+	entries []*FlowSpecEntry
+	version uint64
+
+	// dst is built on the first prefix query
+	dstOnce sync.Once
+	dst     *dstIndex
+}
+
+func (s *FlowSpecSnapshot) dstIndex() *dstIndex {
+	s.dstOnce.Do(func() { s.dst = newDstIndex(s.entries) })
+	return s.dst
+}
+
+// Covering returns the entries whose destination prefix contains p, p
+// included, in order. The destination prefix is the route's DestPrefix or
+// else its destination prefix component; routes without one are never
+// returned. The first prefix query of a snapshot indexes it in O(n), later
+// ones take O(prefix length + results).
+func (s *FlowSpecSnapshot) Covering(p netip.Prefix) []*FlowSpecEntry {
+	return sortEntries(s.dstIndex().covering(p))
+}
+
+// CoveredBy returns the entries whose destination prefix lies within p, p
+// included, in order. See Covering.
+func (s *FlowSpecSnapshot) CoveredBy(p netip.Prefix) []*FlowSpecEntry {
+	return sortEntries(s.dstIndex().coveredBy(p))
+}
+
+func sortEntries(entries []*FlowSpecEntry) []*FlowSpecEntry {
+	slices.SortFunc(entries, CompareEntries)
+	return entries
+}
+
+// Version counts the changes published before this snapshot; it differs
+// between any two snapshots of one FlowSpecRIB with different contents.
+func (s *FlowSpecSnapshot) Version() uint64 {
+	return s.version
+}
+
+// Len returns the number of routes.
+func (s *FlowSpecSnapshot) Len() int {
+	return len(s.entries)
+}
+
+// Get returns the entry for the route with the same FlowSpecKey as route.
+func (s *FlowSpecSnapshot) Get(route *fs.FlowSpecRoute) (*FlowSpecEntry, bool) {
+	i, found := search(s.entries, &FlowSpecEntry{Key: FlowSpecKey(route), Route: route})
+	if !found {
+		return nil, false
+	}
+	return s.entries[i], true
+}
+
+// All yields the entries in order.
+func (s *FlowSpecSnapshot) All() iter.Seq[*FlowSpecEntry] {
+	return slices.Values(s.entries)
+}
+
+// Feasible returns the component lists of the routes without validation
+// error for afi, in order, e.g. for matcher.New.
+func (s *FlowSpecSnapshot) Feasible(afi uint16) []fs.FSComponentList {
+	var out []fs.FSComponentList
+	for _, e := range s.entries {
+		if e.Err == nil && e.Route.AFI == afi {
+			out = append(out, e.Route.Components)
+		}
+	}
+	return out
+}
+
+func search(entries []*FlowSpecEntry, e *FlowSpecEntry) (int, bool) {
+	return slices.BinarySearchFunc(entries, e, CompareEntries)
+}
+
+// CompareEntries orders entries as a FlowSpecSnapshot does: by family and
+// RD, then by RFC8955 5.1 precedence. Lists of equal precedence are ordered
+// by key.
+func CompareEntries(a, b *FlowSpecEntry) int {
+	if c := cmp.Compare(a.Route.AFI, b.Route.AFI); c != 0 {
+		return c
+	}
+	if c := cmp.Compare(a.Route.SAFI, b.Route.SAFI); c != 0 {
+		return c
+	}
+	if c := bytes.Compare(a.Route.RD[:], b.Route.RD[:]); c != 0 {
+		return c
+	}
+	if a.Key == b.Key {
+		return 0
+	}
+	if c := fs.CompareFlowSpecKey(a.Route.Components, b.Route.Components); c != fs.Equal {
+		return c
+	}
+	return cmp.Compare(a.Key, b.Key)
+}
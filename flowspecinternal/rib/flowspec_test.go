@@ -0,0 +1,242 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package rib
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"slices"
+	"sync"
+	"testing"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/events"
+)
+
+func flowSpecRoute(t testing.TB, s string) *fs.FlowSpecRoute {
+	t.Helper()
+	l, err := fs.ParseComponents(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	afi := fs.AFIIPv4
+	if c := l.Components[0]; c.Prefix != nil && c.Prefix.Addr().Is6() {
+		afi = fs.AFIIPv6
+	}
+	return &fs.FlowSpecRoute{AFI: afi, SAFI: fs.SAFIFlowSpec, Components: l}
+}
+
+func rules(s *FlowSpecSnapshot) []string {
+	var out []string
+	for e := range s.All() {
+		out = append(out, e.Route.Components.String())
+	}
+	return out
+}
+
+func TestFlowSpecRIB(t *testing.T) {
+	r := NewFlowSpecRIB(nil)
+	empty := r.Snapshot()
+
+	errInfeasible := errors.New("infeasible")
+	r.Insert(flowSpecRoute(t, "dst 192.0.2.0/24"), nil)
+	r.Insert(flowSpecRoute(t, "dst 2001:db8::/32"), nil)
+	r.Insert(flowSpecRoute(t, "dst 192.0.2.0/25 proto tcp"), errInfeasible)
+	r.Insert(flowSpecRoute(t, "dst 192.0.2.0/24 dport 80"), nil)
+	before := r.Snapshot()
+	r.Insert(flowSpecRoute(t, "dst 192.0.2.0/25 proto tcp"), nil) // replaces
+
+	s := r.Snapshot()
+	want := []string{"dst 192.0.2.0/25 proto tcp", "dst 192.0.2.0/24 dport =80", "dst 192.0.2.0/24", "dst 2001:db8::/32"}
+	if got := rules(s); !slices.Equal(got, want) {
+		t.Errorf("All() = %q, want %q", got, want)
+	}
+	if s.Version() != 5 || empty.Len() != 0 {
+		t.Errorf("Version() = %d, empty Len() = %d, want 5, 0", s.Version(), empty.Len())
+	}
+	if e, ok := before.Get(flowSpecRoute(t, "dst 192.0.2.0/25 proto tcp")); !ok || e.Err != errInfeasible {
+		t.Errorf("earlier snapshot Get() = %v, %v, want the infeasible entry", e, ok)
+	}
+	if got := len(s.Feasible(fs.AFIIPv4)); got != 3 {
+		t.Errorf("Feasible(IPv4) has %d rules, want 3", got)
+	}
+
+	if !r.Delete(flowSpecRoute(t, "dst 192.0.2.0/24")) || r.Delete(flowSpecRoute(t, "dst 192.0.2.0/24")) {
+		t.Error("Delete() = false or repeated Delete() = true")
+	}
+	if s.Len() != 4 || r.Snapshot().Len() != 3 {
+		t.Errorf("Len() = %d after Delete, snapshot %d, want 3, 4", r.Snapshot().Len(), s.Len())
+	}
+
+	v := r.Snapshot().Version()
+	r.Apply(func(tx *FlowSpecTx) { tx.Delete(flowSpecRoute(t, "dst 198.51.100.0/24")) })
+	if got := r.Snapshot().Version(); got != v {
+		t.Errorf("Version() = %d after no-op Apply, want %d", got, v)
+	}
+	r.Apply(func(tx *FlowSpecTx) { tx.Clear() })
+	if r.Snapshot().Len() != 0 {
+		t.Errorf("Len() = %d after Clear, want 0", r.Snapshot().Len())
+	}
+}
+
+func TestFlowSpecRIBConcurrentReaders(t *testing.T) {
+	r := NewFlowSpecRIB(nil)
+	routes := make([]*fs.FlowSpecRoute, 200)
+	for i := range routes {
+		routes[i] = flowSpecRoute(t, fmt.Sprintf("dst 10.%d.%d.0/24", i/256, i%256))
+	}
+
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 200 {
+				s := r.Snapshot()
+				n := 0
+				for e := range s.All() {
+					if e.Route == nil {
+						t.Error("snapshot holds a nil route")
+					}
+					n++
+				}
+				if n != s.Len() || uint64(n) > s.Version() {
+					t.Errorf("snapshot has %d routes, Len() %d, version %d", n, s.Len(), s.Version())
+				}
+			}
+		}()
+	}
+	for _, route := range routes {
+		r.Insert(route, nil)
+	}
+	wg.Wait()
+	if got := r.Snapshot().Len(); got != len(routes) {
+		t.Errorf("Len() = %d, want %d", got, len(routes))
+	}
+}
+
+func TestFlowSpecRIBEvents(t *testing.T) {
+	bus := events.NewBus()
+	var got []string
+	bus.Subscribe(func(e events.Event) { got = append(got, e.String()) })
+	r := NewFlowSpecRIB(&FlowSpecOptions{Events: bus})
+
+	errNoBest := errors.New("no best path")
+	a, b := flowSpecRoute(t, "dst 192.0.2.0/24"), flowSpecRoute(t, "dst 198.51.100.0/24")
+	r.Apply(func(tx *FlowSpecTx) {
+		tx.Insert(a, nil)
+		tx.Insert(b, errNoBest)
+	})
+	r.Revalidate(func(route *fs.FlowSpecRoute) error { return nil }, nil)
+	r.Revalidate(func(route *fs.FlowSpecRoute) error { return nil }, nil) // unchanged
+	r.Delete(a)
+	if e, _ := r.Snapshot().Get(b); e.Err != nil {
+		t.Errorf("revalidated entry error = %v, want <nil>", e.Err)
+	}
+	r.Withdraw(b, errors.New("attack over"))
+
+	want := []string{
+		"accepted dst 192.0.2.0/24",
+		"rejected dst 198.51.100.0/24: no best path",
+		"revalidated dst 198.51.100.0/24",
+		"withdrawn dst 192.0.2.0/24",
+		"withdrawn dst 198.51.100.0/24: attack over",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("events = %q, want %q", got, want)
+	}
+}
+
+func TestFlowSpecSnapshotPrefixIndex(t *testing.T) {
+	r := NewFlowSpecRIB(nil)
+	for _, s := range []string{"dst 192.0.2.0/24", "dst 192.0.2.0/25 proto tcp", "dst 192.0.2.128/26", "dst 192.0.0.0/16", "dst 198.51.100.0/24", "proto udp", "dst 2001:db8::/32"} {
+		r.Insert(flowSpecRoute(t, s), nil)
+	}
+	s := r.Snapshot()
+	names := func(entries []*FlowSpecEntry) []string {
+		var out []string
+		for _, e := range entries {
+			out = append(out, e.Route.Components.String())
+		}
+		return out
+	}
+	tests := []struct {
+		prefix            string
+		covering, covered []string
+	}{
+		{prefix: "192.0.2.0/24", covering: []string{"dst 192.0.2.0/24", "dst 192.0.0.0/16"}, covered: []string{"dst 192.0.2.0/25 proto tcp", "dst 192.0.2.128/26", "dst 192.0.2.0/24"}},
+		{prefix: "192.0.2.130/32", covering: []string{"dst 192.0.2.128/26", "dst 192.0.2.0/24", "dst 192.0.0.0/16"}},
+		{prefix: "0.0.0.0/0", covered: []string{"dst 192.0.2.0/25 proto tcp", "dst 192.0.2.128/26", "dst 192.0.2.0/24", "dst 192.0.0.0/16", "dst 198.51.100.0/24"}},
+		{prefix: "2001:db8:1::/48", covering: []string{"dst 2001:db8::/32"}},
+	}
+	for _, tt := range tests {
+		p := netip.MustParsePrefix(tt.prefix)
+		if got := names(s.Covering(p)); !slices.Equal(got, tt.covering) {
+			t.Errorf("Covering(%s) = %q, want %q", p, got, tt.covering)
+		}
+		if got := names(s.CoveredBy(p)); !slices.Equal(got, tt.covered) {
+			t.Errorf("CoveredBy(%s) = %q, want %q", p, got, tt.covered)
+		}
+	}
+}
+
+func TestFlowSpecRIBRevalidatePrefix(t *testing.T) {
+	r := NewFlowSpecRIB(nil)
+	errNoBest := errors.New("no best path")
+	for _, s := range []string{"dst 192.0.2.0/24", "dst 192.0.2.0/25", "dst 192.0.0.0/16", "dst 198.51.100.0/24", "proto udp"} {
+		r.Insert(flowSpecRoute(t, s), errNoBest)
+	}
+	var validated []string
+	r.RevalidatePrefix(func(route *fs.FlowSpecRoute) error {
+		validated = append(validated, route.Components.String())
+		return nil
+	}, netip.MustParsePrefix("192.0.2.0/24"))
+	slices.Sort(validated)
+	if want := []string{"dst 192.0.0.0/16", "dst 192.0.2.0/24", "dst 192.0.2.0/25"}; !slices.Equal(validated, want) {
+		t.Errorf("validated %q, want %q", validated, want)
+	}
+	for e := range r.Snapshot().All() {
+		if want := !slices.Contains(validated, e.Route.Components.String()); (e.Err != nil) != want {
+			t.Errorf("%s error = %v", e.Route.Components, e.Err)
+		}
+	}
+}
+
+func TestWithMetadata(t *testing.T) {
+	r := NewFlowSpecRIB(nil)
+	tagged := flowSpecRoute(t, "dst 192.0.2.0/24")
+	tagged.Metadata = map[string]string{"ticket": "NOC-1", "customer": "acme"}
+	r.Insert(tagged, nil)
+	r.Insert(flowSpecRoute(t, "dst 198.51.100.0/24"), nil)
+	// Metadata is not part of the key: the same rule with other metadata
+	// replaces it.
+	retagged := flowSpecRoute(t, "dst 192.0.2.0/24")
+	retagged.Metadata = map[string]string{"ticket": "NOC-2", "customer": "acme"}
+	r.Insert(retagged, nil)
+	if r.Snapshot().Len() != 2 {
+		t.Fatalf("Len() = %d, want the retagged rule replaced", r.Snapshot().Len())
+	}
+	for _, tt := range []struct {
+		sel  map[string]string
+		want int
+	}{
+		{nil, 2},
+		{map[string]string{"customer": "acme"}, 1},
+		{map[string]string{"customer": "acme", "ticket": "NOC-1"}, 0},
+		{map[string]string{"ticket": ""}, 1},
+		{map[string]string{"origin": ""}, 0},
+	} {
+		n := 0
+		for e := range r.Snapshot().All() {
+			if WithMetadata(tt.sel)(e) {
+				n++
+			}
+		}
+		if n != tt.want {
+			t.Errorf("WithMetadata(%v) selects %d rules, want %d", tt.sel, n, tt.want)
+		}
+	}
+}
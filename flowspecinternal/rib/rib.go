@@ -0,0 +1,201 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+// Package rib provides UnicastRIB implementations backed by different index structures.
+//
+// All indexes answer the same queries with identical results; they differ in cost:
+//
+//   - Trie: binary radix trie per address family. Insert, delete and BestPath are
+//     O(prefix length), independent of table size. Pick it for high churn (full
+//     Internet feeds with frequent updates) or when MoreSpecifics is queried often.
+//   - Sorted: a single sorted slice. Smallest memory footprint and cache friendly
+//     lookups (O(prefix length * log n)) but O(n) insert/delete. Pick it for tables
+//     that are loaded once and rarely change, e.g. offline validation of a dump.
+//   - BTree: an in-memory B-tree over the same ordering as Sorted. O(log n) for
+//     every operation with moderate memory overhead. Pick it for large tables with
+//     mixed churn where the trie's per-bit nodes are too expensive.
+//
+// Run `go test -bench . ./flowspecinternal/rib` to compare them on your hardware.
+//
+// FlowSpecRIB holds FlowSpec routes in RFC8955 5.1 order and publishes
+// immutable snapshots, so readers never contend with the update path.
+package rib
+
+import (
+	"errors"
+	"net/netip"
+	"slices"
+	"sync"
+
+	fs "floofspectools/flowspecinternal"
+)
+
+var (
+	ErrUnsorted = errors.New("rib: bulk load input not sorted or contains duplicate prefixes; see SortRoutes")
+)
+
+// Index is a mutable UnicastRIB. Implementations are safe for concurrent use.
+type Index interface {
+	fs.UnicastRIB
+	// Insert adds r, replacing any route for the same prefix.
+	Insert(r *fs.UnicastRoute)
+	// Delete removes the route and the additional paths for p and reports
+	// whether the route existed.
+	Delete(p netip.Prefix) bool
+	// Len returns the number of routes.
+	Len() int
+	// BulkLoad replaces the whole table with routes, which must be sorted by
+	// SortRoutes, and drops all additional paths. The table is locked once
+	// for the whole load and a single EventLoaded is emitted instead of one
+	// EventInsert per route.
+	BulkLoad(routes []*fs.UnicastRoute) error
+	// InsertPath adds r as an additional path of its prefix received with
+	// Add-Path (RFC7911), replacing the one with the same PathID. AllPaths
+	// returns it after the route added with Insert, the best path.
+	InsertPath(r *fs.UnicastRoute)
+	// DeletePath removes the additional path id of p and reports whether it
+	// existed.
+	DeletePath(p netip.Prefix, id uint32) bool
+	// Notify registers fn to be called after every change.
+	Notify(fn func(Event))
+}
+
+// EventKind tells what changed in an Index.
+type EventKind uint8
+
+const (
+	EventInsert EventKind = iota
+	EventDelete
+	EventLoaded
+	EventInsertPath
+	EventDeletePath
+)
+
+// Event describes a change to an Index.
+type Event struct {
+	Kind   EventKind
+	Prefix netip.Prefix     // EventInsert, EventDelete, EventInsertPath, EventDeletePath
+	Route  *fs.UnicastRoute // EventInsert, EventInsertPath
+	PathID uint32           // EventDeletePath
+	Count  int              // EventLoaded: number of routes loaded
+}
+
+type notifier struct {
+	fnsMu sync.Mutex
+	fns   []func(Event)
+}
+
+// Notify registers fn to be called after every change.
+func (n *notifier) Notify(fn func(Event)) {
+	n.fnsMu.Lock()
+	defer n.fnsMu.Unlock()
+	n.fns = append(n.fns, fn)
+}
+
+func (n *notifier) emit(e Event) {
+	n.fnsMu.Lock()
+	fns := n.fns
+	n.fnsMu.Unlock()
+	for _, fn := range fns {
+		fn(e)
+	}
+}
+
+// addPaths holds the additional paths of an Index by prefix.
+type addPaths struct {
+	pathsMu sync.RWMutex
+	paths   map[netip.Prefix][]*fs.UnicastRoute
+}
+
+func (a *addPaths) insertPath(r *fs.UnicastRoute) {
+	p := r.Prefix.Masked()
+	a.pathsMu.Lock()
+	defer a.pathsMu.Unlock()
+	if a.paths == nil {
+		a.paths = map[netip.Prefix][]*fs.UnicastRoute{}
+	}
+	ps := a.paths[p]
+	if i := slices.IndexFunc(ps, func(o *fs.UnicastRoute) bool { return o.PathID == r.PathID }); i >= 0 {
+		ps[i] = r
+		return
+	}
+	a.paths[p] = append(ps, r)
+}
+
+func (a *addPaths) deletePath(p netip.Prefix, id uint32) bool {
+	a.pathsMu.Lock()
+	defer a.pathsMu.Unlock()
+	ps := a.paths[p]
+	i := slices.IndexFunc(ps, func(o *fs.UnicastRoute) bool { return o.PathID == id })
+	if i < 0 {
+		return false
+	}
+	ps = slices.Delete(slices.Clone(ps), i, i+1)
+	if len(ps) == 0 {
+		delete(a.paths, p)
+	} else {
+		a.paths[p] = ps
+	}
+	return true
+}
+
+// deletePaths removes all additional paths of p.
+func (a *addPaths) deletePaths(p netip.Prefix) {
+	a.pathsMu.Lock()
+	defer a.pathsMu.Unlock()
+	delete(a.paths, p)
+}
+
+// resetPaths removes all additional paths.
+func (a *addPaths) resetPaths() {
+	a.pathsMu.Lock()
+	defer a.pathsMu.Unlock()
+	a.paths = nil
+}
+
+// allPaths returns best followed by the additional paths of its prefix
+// with a different PathID, nil for a nil best.
+func (a *addPaths) allPaths(best *fs.UnicastRoute) []*fs.UnicastRoute {
+	if best == nil {
+		return nil
+	}
+	out := []*fs.UnicastRoute{best}
+	a.pathsMu.RLock()
+	defer a.pathsMu.RUnlock()
+	for _, r := range a.paths[best.Prefix.Masked()] {
+		if r.PathID != best.PathID {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// SortRoutes masks and sorts routes into the order BulkLoad expects.
+func SortRoutes(routes []*fs.UnicastRoute) {
+	for _, r := range routes {
+		r.Prefix = r.Prefix.Masked()
+	}
+	slices.SortFunc(routes, func(a, b *fs.UnicastRoute) int {
+		return comparePrefix(a.Prefix, b.Prefix)
+	})
+}
+
+// checkSorted is the O(n) precondition check of BulkLoad.
+func checkSorted(routes []*fs.UnicastRoute) error {
+	for i := 1; i < len(routes); i++ {
+		if comparePrefix(routes[i-1].Prefix, routes[i].Prefix) >= 0 {
+			return ErrUnsorted
+		}
+	}
+	return nil
+}
+
+// comparePrefix orders prefixes by family, address and then prefix length,
+// which keeps all more-specifics of a prefix directly behind it.
+func comparePrefix(a, b netip.Prefix) int {
+	if c := a.Addr().Compare(b.Addr()); c != 0 {
+		return c
+	}
+	return a.Bits() - b.Bits()
+}
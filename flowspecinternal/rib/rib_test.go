@@ -0,0 +1,314 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package rib
+
+import (
+	"errors"
+	"math/rand/v2"
+	"net/netip"
+	"slices"
+	"testing"
+
+	fs "floofspectools/flowspecinternal"
+)
+
+var indexes = []struct {
+	name string
+	new  func() Index
+}{
+	{name: "Trie", new: func() Index { return NewTrie() }},
+	{name: "Sorted", new: func() Index { return NewSorted() }},
+	{name: "BTree", new: func() Index { return NewBTree() }},
+}
+
+func route(s string, as uint32) *fs.UnicastRoute {
+	return &fs.UnicastRoute{Prefix: netip.MustParsePrefix(s), NeighborAS: as, ASPath: []uint32{as}}
+}
+
+func prefixes(routes []*fs.UnicastRoute) []string {
+	out := make([]string, 0, len(routes))
+	for _, r := range routes {
+		out = append(out, r.Prefix.String())
+	}
+	return out
+}
+
+func TestIndexQueries(t *testing.T) {
+	for _, idx := range indexes {
+		t.Run(idx.name, func(t *testing.T) {
+			rib := idx.new()
+			for _, r := range []*fs.UnicastRoute{
+				route("0.0.0.0/0", 1),
+				route("192.0.2.0/24", 65001),
+				route("192.0.2.0/25", 65001),
+				route("192.0.2.128/26", 65002),
+				route("198.51.100.0/24", 65003),
+				route("2001:db8::/32", 65004),
+				route("2001:db8:1::/48", 65005),
+			} {
+				rib.Insert(r)
+			}
+			rib.Insert(route("192.0.2.0/24", 65009)) // replaces
+
+			if got := rib.Len(); got != 7 {
+				t.Errorf("Len() = %d, want 7", got)
+			}
+
+			best := []struct{ query, want string }{
+				{"192.0.2.0/24", "192.0.2.0/24"},
+				{"192.0.2.192/27", "192.0.2.0/24"},
+				{"192.0.2.130/32", "192.0.2.128/26"},
+				{"203.0.113.0/24", "0.0.0.0/0"},
+				{"2001:db8:1:2::/64", "2001:db8:1::/48"},
+				{"2001:db9::/32", ""},
+			}
+			for _, tt := range best {
+				got := rib.BestPath(netip.MustParsePrefix(tt.query))
+				gotStr := ""
+				if got != nil {
+					gotStr = got.Prefix.String()
+				}
+				if gotStr != tt.want {
+					t.Errorf("BestPath(%s) = %q, want %q", tt.query, gotStr, tt.want)
+				}
+			}
+			if got := rib.BestPath(netip.MustParsePrefix("192.0.2.0/24")); got.NeighborAS != 65009 {
+				t.Errorf("BestPath(192.0.2.0/24).NeighborAS = %d, want 65009", got.NeighborAS)
+			}
+
+			more := rib.MoreSpecifics(netip.MustParsePrefix("192.0.2.0/24"))
+			if got, want := prefixes(more), []string{"192.0.2.0/25", "192.0.2.128/26"}; !slices.Equal(got, want) {
+				t.Errorf("MoreSpecifics(192.0.2.0/24) = %v, want %v", got, want)
+			}
+
+			if !rib.Delete(netip.MustParsePrefix("192.0.2.128/26")) {
+				t.Errorf("Delete(192.0.2.128/26) = false, want true")
+			}
+			if rib.Delete(netip.MustParsePrefix("192.0.2.128/26")) {
+				t.Errorf("second Delete(192.0.2.128/26) = true, want false")
+			}
+			if got := rib.BestPath(netip.MustParsePrefix("192.0.2.130/32")); got == nil || got.Prefix.String() != "192.0.2.0/24" {
+				t.Errorf("BestPath(192.0.2.130/32) after delete = %v, want 192.0.2.0/24", got)
+			}
+		})
+	}
+}
+
+// naive is the reference all indexes are checked against.
+type naive map[netip.Prefix]*fs.UnicastRoute
+
+func (n naive) best(p netip.Prefix) *fs.UnicastRoute {
+	var best *fs.UnicastRoute
+	for q, r := range n {
+		if q.Bits() <= p.Bits() && q.Contains(p.Addr()) && (best == nil || q.Bits() > best.Prefix.Bits()) {
+			best = r
+		}
+	}
+	return best
+}
+
+func (n naive) more(p netip.Prefix) []*fs.UnicastRoute {
+	var out []*fs.UnicastRoute
+	for q, r := range n {
+		if q.Bits() > p.Bits() && p.Contains(q.Addr()) {
+			out = append(out, r)
+		}
+	}
+	slices.SortFunc(out, func(a, b *fs.UnicastRoute) int { return comparePrefix(a.Prefix, b.Prefix) })
+	return out
+}
+
+func randomPrefix(rng *rand.Rand) netip.Prefix {
+	// a narrow address space forces lots of nesting and collisions
+	a := netip.AddrFrom4([4]byte{10, byte(rng.IntN(4)), byte(rng.IntN(256)), 0})
+	return netip.PrefixFrom(a, 8+rng.IntN(17)).Masked()
+}
+
+func TestIndexAgainstNaive(t *testing.T) {
+	for _, idx := range indexes {
+		t.Run(idx.name, func(t *testing.T) {
+			rng := rand.New(rand.NewPCG(1, 2))
+			rib := idx.new()
+			ref := naive{}
+			for i := 0; i < 5000; i++ {
+				p := randomPrefix(rng)
+				if rng.IntN(3) == 0 {
+					_, existed := ref[p]
+					delete(ref, p)
+					if got := rib.Delete(p); got != existed {
+						t.Fatalf("Delete(%s) = %v, want %v", p, got, existed)
+					}
+					continue
+				}
+				r := &fs.UnicastRoute{Prefix: p, NeighborAS: uint32(i)}
+				ref[p] = r
+				rib.Insert(r)
+			}
+			if rib.Len() != len(ref) {
+				t.Fatalf("Len() = %d, want %d", rib.Len(), len(ref))
+			}
+			for i := 0; i < 500; i++ {
+				p := randomPrefix(rng)
+				if got, want := rib.BestPath(p), ref.best(p); got != want {
+					t.Fatalf("BestPath(%s) = %v, want %v", p, got, want)
+				}
+				if got, want := rib.MoreSpecifics(p), ref.more(p); !slices.Equal(got, want) {
+					t.Fatalf("MoreSpecifics(%s) = %v, want %v", p, prefixes(got), prefixes(want))
+				}
+			}
+		})
+	}
+}
+
+func TestBulkLoad(t *testing.T) {
+	for _, idx := range indexes {
+		t.Run(idx.name, func(t *testing.T) {
+			rng := rand.New(rand.NewPCG(3, 4))
+			ref := naive{}
+			for i := 0; i < 3000; i++ {
+				p := randomPrefix(rng)
+				ref[p] = &fs.UnicastRoute{Prefix: p, NeighborAS: uint32(i)}
+			}
+			routes := make([]*fs.UnicastRoute, 0, len(ref))
+			for _, r := range ref {
+				routes = append(routes, r)
+			}
+			SortRoutes(routes)
+
+			rib := idx.new()
+			rib.Insert(route("203.0.113.0/24", 1)) // dropped by the load
+			var events []Event
+			rib.Notify(func(e Event) { events = append(events, e) })
+			if err := rib.BulkLoad(routes); err != nil {
+				t.Fatalf("BulkLoad() error = %v, want <nil>", err)
+			}
+			if len(events) != 1 || events[0].Kind != EventLoaded || events[0].Count != len(routes) {
+				t.Errorf("BulkLoad() events = %v, want a single EventLoaded with Count %d", events, len(routes))
+			}
+			if rib.Len() != len(ref) {
+				t.Fatalf("Len() = %d, want %d", rib.Len(), len(ref))
+			}
+			for i := 0; i < 500; i++ {
+				p := randomPrefix(rng)
+				if got, want := rib.BestPath(p), ref.best(p); got != want {
+					t.Fatalf("BestPath(%s) = %v, want %v", p, got, want)
+				}
+				if got, want := rib.MoreSpecifics(p), ref.more(p); !slices.Equal(got, want) {
+					t.Fatalf("MoreSpecifics(%s) = %v, want %v", p, prefixes(got), prefixes(want))
+				}
+			}
+
+			// the loaded table must stay fully mutable
+			for p := range ref {
+				if !rib.Delete(p) {
+					t.Fatalf("Delete(%s) after BulkLoad = false, want true", p)
+				}
+			}
+			if rib.Len() != 0 {
+				t.Errorf("Len() after deleting everything = %d, want 0", rib.Len())
+			}
+		})
+	}
+}
+
+func TestBulkLoadUnsorted(t *testing.T) {
+	for _, idx := range indexes {
+		t.Run(idx.name, func(t *testing.T) {
+			routes := []*fs.UnicastRoute{route("192.0.2.0/24", 1), route("10.0.0.0/8", 2)}
+			if err := idx.new().BulkLoad(routes); !errors.Is(err, ErrUnsorted) {
+				t.Errorf("BulkLoad(unsorted) error = %v, want %v", err, ErrUnsorted)
+			}
+		})
+	}
+}
+
+func TestEvents(t *testing.T) {
+	for _, idx := range indexes {
+		t.Run(idx.name, func(t *testing.T) {
+			rib := idx.new()
+			var kinds []EventKind
+			rib.Notify(func(e Event) { kinds = append(kinds, e.Kind) })
+			rib.Insert(route("192.0.2.0/24", 1))
+			rib.Delete(netip.MustParsePrefix("192.0.2.0/24"))
+			rib.Delete(netip.MustParsePrefix("192.0.2.0/24")) // no-op, no event
+			if want := []EventKind{EventInsert, EventDelete}; !slices.Equal(kinds, want) {
+				t.Errorf("events = %v, want %v", kinds, want)
+			}
+		})
+	}
+}
+
+func TestAllPaths(t *testing.T) {
+	for _, idx := range indexes {
+		t.Run(idx.name, func(t *testing.T) {
+			rib := idx.new()
+			var kinds []EventKind
+			rib.Notify(func(e Event) { kinds = append(kinds, e.Kind) })
+			best := route("192.0.2.0/24", 65001)
+			alt := route("192.0.2.0/24", 65002)
+			alt.PathID = 2
+			rib.Insert(best)
+			rib.InsertPath(best) // same PathID as the best path, not repeated
+			rib.InsertPath(alt)
+			rib.InsertPath(route("198.51.100.0/24", 65003)) // no best path
+
+			paths := rib.AllPaths(netip.MustParsePrefix("192.0.2.1/32"))
+			if len(paths) != 2 || paths[0] != best || paths[1] != alt {
+				t.Errorf("AllPaths() = %v, want best and alternative path", paths)
+			}
+			if got := rib.AllPaths(netip.MustParsePrefix("198.51.100.0/24")); got != nil {
+				t.Errorf("AllPaths() without best path = %v", got)
+			}
+			if !rib.DeletePath(netip.MustParsePrefix("192.0.2.0/24"), 2) || rib.DeletePath(netip.MustParsePrefix("192.0.2.0/24"), 2) {
+				t.Error("DeletePath() did not remove the path exactly once")
+			}
+			if got := rib.AllPaths(netip.MustParsePrefix("192.0.2.0/24")); len(got) != 1 {
+				t.Errorf("AllPaths() after DeletePath() = %v", got)
+			}
+			if rib.Len() != 1 {
+				t.Errorf("Len() = %d, additional paths must not count", rib.Len())
+			}
+			want := []EventKind{EventInsert, EventInsertPath, EventInsertPath, EventInsertPath, EventDeletePath}
+			if !slices.Equal(kinds, want) {
+				t.Errorf("events = %v, want %v", kinds, want)
+			}
+		})
+	}
+}
+
+func TestAllPathsReloadDelete(t *testing.T) {
+	for _, idx := range indexes {
+		t.Run(idx.name, func(t *testing.T) {
+			rib := idx.new()
+			p := netip.MustParsePrefix("192.0.2.0/24")
+			best := route("192.0.2.0/24", 65001)
+			alt := route("192.0.2.0/24", 65002)
+			alt.PathID = 2
+			rib.Insert(best)
+			rib.InsertPath(alt)
+
+			// a reload replaces the additional paths along with the table
+			if err := rib.BulkLoad([]*fs.UnicastRoute{best}); err != nil {
+				t.Fatal(err)
+			}
+			if got := rib.AllPaths(p); len(got) != 1 || got[0] != best {
+				t.Errorf("AllPaths() after BulkLoad() = %v, want the best path only", got)
+			}
+
+			// a withdrawn prefix takes its additional paths along
+			rib.InsertPath(alt)
+			if !rib.Delete(p) {
+				t.Fatal("Delete() = false")
+			}
+			rib.Insert(best)
+			if got := rib.AllPaths(p); len(got) != 1 || got[0] != best {
+				t.Errorf("AllPaths() after Delete() and Insert() = %v, want the best path only", got)
+			}
+			if rib.DeletePath(p, 2) {
+				t.Error("DeletePath() found a path removed by Delete()")
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package rib
+
+import "math/rand/v2"
+
+// maxLevel bounds the skip list height; 2^maxLevel items keep O(log n).
+const maxLevel = 24
+
+type skipNode[T any] struct {
+	item T
+	next []*skipNode[T]
+}
+
+// skipList is an ordered set of items under cmp, with expected O(log n)
+// insert, delete and seek.
+type skipList[T any] struct {
+	cmp   func(a, b T) int
+	head  skipNode[T]
+	level int
+	size  int
+	rng   *rand.Rand
+}
+
+func newSkipList[T any](cmp func(a, b T) int) *skipList[T] {
+	return &skipList[T]{
+		cmp:   cmp,
+		head:  skipNode[T]{next: make([]*skipNode[T], maxLevel)},
+		level: 1,
+		rng:   rand.New(rand.NewPCG(1, 2)),
+	}
+}
+
+// path returns, for every level, the last node before item.
+func (s *skipList[T]) path(item T) [maxLevel]*skipNode[T] {
+	var update [maxLevel]*skipNode[T]
+	x := &s.head
+	for l := s.level - 1; l >= 0; l-- {
+		for x.next[l] != nil && s.cmp(x.next[l].item, item) < 0 {
+			x = x.next[l]
+		}
+		update[l] = x
+	}
+	return update
+}
+
+// insert adds item, replacing an equal one, and reports whether it replaced.
+func (s *skipList[T]) insert(item T) bool {
+	update := s.path(item)
+	if n := update[0].next[0]; n != nil && s.cmp(n.item, item) == 0 {
+		n.item = item
+		return true
+	}
+	lvl := 1
+	for lvl < maxLevel && s.rng.IntN(4) == 0 {
+		lvl++
+	}
+	for ; s.level < lvl; s.level++ {
+		update[s.level] = &s.head
+	}
+	n := &skipNode[T]{item: item, next: make([]*skipNode[T], lvl)}
+	for l := range lvl {
+		n.next[l] = update[l].next[l]
+		update[l].next[l] = n
+	}
+	s.size++
+	return false
+}
+
+// delete removes the item equal to item and reports whether it existed.
+func (s *skipList[T]) delete(item T) bool {
+	update := s.path(item)
+	n := update[0].next[0]
+	if n == nil || s.cmp(n.item, item) != 0 {
+		return false
+	}
+	for l := range n.next {
+		update[l].next[l] = n.next[l]
+	}
+	for s.level > 1 && s.head.next[s.level-1] == nil {
+		s.level--
+	}
+	s.size--
+	return true
+}
+
+// seek returns the first node not before item, or nil.
+func (s *skipList[T]) seek(item T) *skipNode[T] {
+	return s.path(item)[0].next[0]
+}
+
+func (s *skipList[T]) first() *skipNode[T] {
+	return s.head.next[0]
+}
@@ -0,0 +1,143 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package rib
+
+import (
+	"net/netip"
+	"slices"
+	"sort"
+	"sync"
+
+	fs "floofspectools/flowspecinternal"
+)
+
+// Sorted is a UnicastRIB backed by a slice kept in comparePrefix order.
+type Sorted struct {
+	notifier
+	addPaths
+	mu     sync.RWMutex
+	routes []*fs.UnicastRoute
+}
+
+// NewSorted returns an empty Sorted.
+func NewSorted() *Sorted {
+	return &Sorted{}
+}
+
+func (s *Sorted) search(p netip.Prefix) (int, bool) {
+	i := sort.Search(len(s.routes), func(i int) bool {
+		return comparePrefix(s.routes[i].Prefix, p) >= 0
+	})
+	return i, i < len(s.routes) && comparePrefix(s.routes[i].Prefix, p) == 0
+}
+
+// Insert adds r, replacing any route for the same prefix.
+func (s *Sorted) Insert(r *fs.UnicastRoute) {
+	r.Prefix = r.Prefix.Masked()
+	s.mu.Lock()
+	i, found := s.search(r.Prefix)
+	if found {
+		s.routes[i] = r
+	} else {
+		s.routes = slices.Insert(s.routes, i, r)
+	}
+	s.mu.Unlock()
+	s.emit(Event{Kind: EventInsert, Prefix: r.Prefix, Route: r})
+}
+
+// BulkLoad replaces the table with routes sorted by SortRoutes and drops
+// all additional paths.
+func (s *Sorted) BulkLoad(routes []*fs.UnicastRoute) error {
+	if err := checkSorted(routes); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.routes = slices.Clone(routes)
+	s.resetPaths()
+	s.mu.Unlock()
+	s.emit(Event{Kind: EventLoaded, Count: len(routes)})
+	return nil
+}
+
+// Delete removes the route and the additional paths for p and reports
+// whether the route existed.
+func (s *Sorted) Delete(p netip.Prefix) bool {
+	p = p.Masked()
+	s.mu.Lock()
+	i, found := s.search(p)
+	if found {
+		s.routes = slices.Delete(s.routes, i, i+1)
+	}
+	s.deletePaths(p)
+	s.mu.Unlock()
+	if found {
+		s.emit(Event{Kind: EventDelete, Prefix: p})
+	}
+	return found
+}
+
+// BestPath returns the longest prefix match covering p.
+func (s *Sorted) BestPath(p netip.Prefix) *fs.UnicastRoute {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for bits := p.Bits(); bits >= 0; bits-- {
+		q := netip.PrefixFrom(p.Addr(), bits).Masked()
+		if i, found := s.search(q); found {
+			return s.routes[i]
+		}
+	}
+	return nil
+}
+
+// MoreSpecifics returns all routes strictly more specific than p.
+func (s *Sorted) MoreSpecifics(p netip.Prefix) []*fs.UnicastRoute {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	p = p.Masked()
+	var out []*fs.UnicastRoute
+	i, _ := s.search(p)
+	for ; i < len(s.routes); i++ {
+		r := s.routes[i]
+		if !p.Contains(r.Prefix.Addr()) {
+			break
+		}
+		if r.Prefix.Bits() > p.Bits() {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// Len returns the number of routes.
+func (s *Sorted) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.routes)
+}
+
+// InsertPath adds r as an additional path of its prefix, replacing the one
+// with the same PathID.
+func (s *Sorted) InsertPath(r *fs.UnicastRoute) {
+	s.insertPath(r)
+	s.emit(Event{Kind: EventInsertPath, Prefix: r.Prefix.Masked(), Route: r})
+}
+
+// DeletePath removes the additional path id of p.
+func (s *Sorted) DeletePath(p netip.Prefix, id uint32) bool {
+	p = p.Masked()
+	ok := s.deletePath(p, id)
+	if ok {
+		s.emit(Event{Kind: EventDeletePath, Prefix: p, PathID: id})
+	}
+	return ok
+}
+
+// AllPaths returns the best path of the longest prefix match covering p
+// followed by the additional paths of that prefix.
+func (s *Sorted) AllPaths(p netip.Prefix) []*fs.UnicastRoute {
+	return s.allPaths(s.BestPath(p))
+}
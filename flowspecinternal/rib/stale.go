@@ -0,0 +1,117 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package rib
+
+import (
+	"slices"
+	"time"
+
+	fs "floofspectools/flowspecinternal"
+)
+
+var (
+	ErrStale = fs.NewError(fs.StagePolicy, "rule-stale", "RFC4724 4.2", "rib: stale rule not re-announced after the peer restarted")
+)
+
+// DefaultStaleTime is how long MarkStale keeps stale rules when called with
+// a non-positive duration, the common BGP stale path timer.
+const DefaultStaleTime = 360 * time.Second
+
+type staleTimer struct {
+	until     time.Time
+	longLived bool
+}
+
+type staleChange struct {
+	route *fs.FlowSpecRoute
+	stale bool
+}
+
+// FromNeighbor returns a filter selecting the entries received from
+// neighbor AS as, e.g. for MarkStale.
+func FromNeighbor(as uint32) func(*FlowSpecEntry) bool {
+	return func(e *FlowSpecEntry) bool { return e.Route.NeighborAS == as }
+}
+
+// MarkStale marks the routes of the entries matching filter stale, e.g. those
+// of a peer whose session went down, and returns how many it marked. Stale
+// routes stay in the table and are still enforced; re-inserting one makes it
+// current again. Those still stale after staleTime, DefaultStaleTime if not
+// positive, are withdrawn by Expire or turned long-lived stale, or withdrawn
+// earlier by FlushStale once the peer re-sent its routes. Marking a stale
+// route again restarts its timer.
+func (r *FlowSpecRIB) MarkStale(filter func(*FlowSpecEntry) bool, staleTime time.Duration) int {
+	if staleTime <= 0 {
+		staleTime = DefaultStaleTime
+	}
+	n := 0
+	r.Apply(func(tx *FlowSpecTx) {
+		until := r.now().Add(staleTime)
+		for i, e := range tx.entries {
+			if filter != nil && !filter(e) {
+				continue
+			}
+			if !e.Stale {
+				tx.entries[i] = &FlowSpecEntry{Key: e.Key, Route: e.Route, Err: e.Err, Stale: true}
+				tx.stale = append(tx.stale, staleChange{e.Route, true})
+				tx.changed = true
+			}
+			// Apply holds mu
+			r.stale[e.Key] = staleTimer{until: until}
+			n++
+		}
+	})
+	return n
+}
+
+// FlushStale withdraws the stale routes of the entries matching filter, e.g.
+// once the peer signalled the end of its initial updates, and returns them.
+// Their RuleWithdrawn events carry ErrStale.
+func (r *FlowSpecRIB) FlushStale(filter func(*FlowSpecEntry) bool) []*fs.FlowSpecRoute {
+	var flushed []*fs.FlowSpecRoute
+	r.Apply(func(tx *FlowSpecTx) {
+		for i := len(tx.entries) - 1; i >= 0; i-- {
+			e := tx.entries[i]
+			if !e.Stale || (filter != nil && !filter(e)) {
+				continue
+			}
+			tx.remove(i, ErrStale)
+			flushed = append(flushed, e.Route)
+		}
+	})
+	return flushed
+}
+
+// StaleUntil returns when route is flushed unless re-inserted, and the zero
+// time if it is not stale.
+func (r *FlowSpecRIB) StaleUntil(route *fs.FlowSpecRoute) time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.stale[FlowSpecKey(route)].until
+}
+
+// expireStale handles the stale entry i whose timer ran out at now: with a
+// long-lived stale time for its peer (RFC9494 4.2) and without
+// CommunityNoLLGR it is replaced by a copy of its route carrying
+// CommunityLLGRStale, retained for that time; otherwise it is withdrawn with
+// ErrStale. It reports whether the entry was withdrawn.
+func (r *FlowSpecRIB) expireStale(tx *FlowSpecTx, i int, now time.Time) bool {
+	e := tx.entries[i]
+	if t := r.stale[e.Key]; !t.longLived && r.longLived != nil && !e.Route.HasCommunity(fs.CommunityNoLLGR) {
+		if d := r.longLived(e.Route); d > 0 {
+			route := *e.Route
+			if !route.HasCommunity(fs.CommunityLLGRStale) {
+				route.Communities = append(slices.Clone(route.Communities), fs.CommunityLLGRStale)
+			}
+			tx.entries[i] = &FlowSpecEntry{Key: e.Key, Route: &route, Err: e.Err, Stale: true}
+			tx.stale = append(tx.stale, staleChange{&route, true})
+			tx.changed = true
+			r.stale[e.Key] = staleTimer{until: now.Add(d), longLived: true}
+			return false
+		}
+	}
+	tx.remove(i, ErrStale)
+	return true
+}
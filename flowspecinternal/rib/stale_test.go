@@ -0,0 +1,140 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package rib
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/events"
+)
+
+func TestFlowSpecRIBStale(t *testing.T) {
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	now := start
+	bus := events.NewBus()
+	var withdrawn []events.Event
+	bus.Subscribe(func(e events.Event) { withdrawn = append(withdrawn, e) }, events.RuleWithdrawn)
+	stale := map[string]bool{}
+	r := NewFlowSpecRIB(&FlowSpecOptions{
+		Events:  bus,
+		Now:     func() time.Time { return now },
+		OnStale: func(route *fs.FlowSpecRoute, s bool) { stale[route.Components.String()] = s },
+	})
+
+	peer := func(rule string, as uint32) *fs.FlowSpecRoute {
+		route := flowSpecRoute(t, rule)
+		route.NeighborAS = as
+		return route
+	}
+	kept := peer("dst 192.0.2.0/24", 65001)
+	gone := peer("dst 198.51.100.0/24", 65001)
+	other := peer("dst 203.0.113.0/24", 65002)
+	for _, route := range []*fs.FlowSpecRoute{kept, gone, other} {
+		r.Insert(route, nil)
+	}
+
+	if n := r.MarkStale(FromNeighbor(65001), 2*time.Minute); n != 2 {
+		t.Errorf("MarkStale() = %d, want 2", n)
+	}
+	if e, _ := r.Snapshot().Get(kept); !e.Stale {
+		t.Error("kept is not stale after MarkStale")
+	}
+	if e, _ := r.Snapshot().Get(other); e.Stale {
+		t.Error("other peer's rule is stale")
+	}
+	if got, want := r.StaleUntil(gone), start.Add(2*time.Minute); !got.Equal(want) {
+		t.Errorf("StaleUntil(gone) = %v, want %v", got, want)
+	}
+	if !stale[kept.Components.String()] || !stale[gone.Components.String()] || len(stale) != 2 {
+		t.Errorf("OnStale after MarkStale = %v, want kept and gone stale", stale)
+	}
+
+	// the peer re-announces kept after its restart
+	now = start.Add(time.Minute)
+	r.Insert(peer("dst 192.0.2.0/24", 65001), nil)
+	if e, _ := r.Snapshot().Get(kept); e.Stale || !r.StaleUntil(kept).IsZero() {
+		t.Error("kept is still stale after re-insertion")
+	}
+	if stale[kept.Components.String()] {
+		t.Error("OnStale not called with false for re-inserted rule")
+	}
+	if got := r.Expire(); len(got) != 0 {
+		t.Errorf("Expire() at 1m = %v, want none", got)
+	}
+
+	now = start.Add(2 * time.Minute)
+	if got := r.Expire(); len(got) != 1 || got[0] != gone {
+		t.Errorf("Expire() at 2m = %v, want the stale rule", got)
+	}
+	if len(withdrawn) != 1 || !errors.Is(withdrawn[0].Err, ErrStale) {
+		t.Errorf("withdrawn = %v, want one with %v", withdrawn, ErrStale)
+	}
+	if got, want := r.Snapshot().Len(), 2; got != want {
+		t.Errorf("Len() = %d, want %d", got, want)
+	}
+
+	r.MarkStale(nil, 0)
+	if got, want := r.StaleUntil(other), now.Add(DefaultStaleTime); !got.Equal(want) {
+		t.Errorf("StaleUntil(other) = %v, want %v", got, want)
+	}
+	if got := r.FlushStale(FromNeighbor(65002)); len(got) != 1 || got[0] != other {
+		t.Errorf("FlushStale(65002) = %v, want the other peer's rule", got)
+	}
+	if got := r.Snapshot().Len(); got != 1 {
+		t.Errorf("Len() after FlushStale = %d, want 1", got)
+	}
+}
+
+func TestFlowSpecRIBLongLivedStale(t *testing.T) {
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	now := start
+	var marked []*fs.FlowSpecRoute
+	r := NewFlowSpecRIB(&FlowSpecOptions{
+		Now:     func() time.Time { return now },
+		OnStale: func(route *fs.FlowSpecRoute, s bool) { marked = append(marked, route) },
+		LongLivedStaleTime: func(route *fs.FlowSpecRoute) time.Duration {
+			if route.NeighborAS == 65001 {
+				return time.Hour
+			}
+			return 0
+		},
+	})
+	llgr := flowSpecRoute(t, "dst 192.0.2.0/24")
+	llgr.NeighborAS = 65001
+	noLLGR := flowSpecRoute(t, "dst 192.0.2.0/25")
+	noLLGR.NeighborAS, noLLGR.Communities = 65001, []uint32{fs.CommunityNoLLGR}
+	other := flowSpecRoute(t, "dst 198.51.100.0/24")
+	other.NeighborAS = 65002
+	for _, route := range []*fs.FlowSpecRoute{llgr, noLLGR, other} {
+		r.Insert(route, nil)
+	}
+	r.MarkStale(nil, time.Minute)
+
+	now = start.Add(time.Minute)
+	if got := r.Expire(); len(got) != 2 {
+		t.Errorf("Expire() at 1m = %v, want the NO_LLGR rule and that of the peer without LLGR", got)
+	}
+	e, ok := r.Snapshot().Get(llgr)
+	if !ok || !e.Stale || !e.Route.HasCommunity(fs.CommunityLLGRStale) {
+		t.Fatalf("entry = %+v, want it long-lived stale with LLGR_STALE", e)
+	}
+	if llgr.HasCommunity(fs.CommunityLLGRStale) {
+		t.Error("LLGR_STALE added to the inserted route")
+	}
+	if last := marked[len(marked)-1]; last != e.Route {
+		t.Errorf("OnStale last called with %v, want the long-lived stale route", last)
+	}
+	if got, want := r.StaleUntil(llgr), now.Add(time.Hour); !got.Equal(want) {
+		t.Errorf("StaleUntil() = %v, want %v", got, want)
+	}
+
+	now = now.Add(time.Hour)
+	if got := r.Expire(); len(got) != 1 || r.Snapshot().Len() != 0 {
+		t.Errorf("Expire() after the long-lived stale time = %v, want the LLGR rule", got)
+	}
+}
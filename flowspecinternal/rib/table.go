@@ -0,0 +1,136 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package rib
+
+import (
+	"cmp"
+	"iter"
+	"net/netip"
+
+	fs "floofspectools/flowspecinternal"
+)
+
+// FlowSpecTable is an ordered set of FlowSpec routes keyed by FlowSpecKey,
+// iterated in the order of FlowSpecSnapshot: by AFI, SAFI and RD and within
+// those in RFC8955 5.1 order. Insert, Delete and Get are O(log n), so large
+// tables updated one route at a time stay cheap; FlowSpecRIB instead copies
+// its table on every change to publish immutable snapshots.
+//
+// A FlowSpecTable is not safe for concurrent use.
+type FlowSpecTable struct {
+	keys  map[string]*FlowSpecEntry
+	order *skipList[*FlowSpecEntry]
+	dst   *skipList[*FlowSpecEntry] // routes with a destination prefix, by prefix
+}
+
+// NewFlowSpecTable returns an empty FlowSpecTable.
+func NewFlowSpecTable() *FlowSpecTable {
+	return &FlowSpecTable{
+		keys:  map[string]*FlowSpecEntry{},
+		order: newSkipList(CompareEntries),
+		dst:   newSkipList(compareDestination),
+	}
+}
+
+// Insert adds route with its validation result, replacing the route with the
+// same FlowSpecKey, and reports whether it replaced one.
+func (t *FlowSpecTable) Insert(route *fs.FlowSpecRoute, err error) bool {
+	e := &FlowSpecEntry{Key: FlowSpecKey(route), Route: route, Err: err}
+	old, replaced := t.keys[e.Key]
+	if replaced {
+		t.order.delete(old)
+		t.dst.delete(old)
+	}
+	t.keys[e.Key] = e
+	t.order.insert(e)
+	if _, ok := destination(route); ok {
+		t.dst.insert(e)
+	}
+	return replaced
+}
+
+// Delete removes the route with the same FlowSpecKey as route and reports
+// whether it existed.
+func (t *FlowSpecTable) Delete(route *fs.FlowSpecRoute) bool {
+	key := FlowSpecKey(route)
+	e, ok := t.keys[key]
+	if !ok {
+		return false
+	}
+	delete(t.keys, key)
+	t.order.delete(e)
+	t.dst.delete(e)
+	return true
+}
+
+// Get returns the entry with the same FlowSpecKey as route.
+func (t *FlowSpecTable) Get(route *fs.FlowSpecRoute) (*FlowSpecEntry, bool) {
+	e, ok := t.keys[FlowSpecKey(route)]
+	return e, ok
+}
+
+// Len returns the number of routes.
+func (t *FlowSpecTable) Len() int {
+	return t.order.size
+}
+
+// All yields the entries in order. The table must not change meanwhile.
+func (t *FlowSpecTable) All() iter.Seq[*FlowSpecEntry] {
+	return func(yield func(*FlowSpecEntry) bool) {
+		for n := t.order.first(); n != nil; n = n.next[0] {
+			if !yield(n.item) {
+				return
+			}
+		}
+	}
+}
+
+// Destination yields the entries whose destination prefix lies within p, ordered by that prefix, in O(log n + matches). Routes without a
+// destination prefix are not yielded. The table must not change meanwhile.
+func (t *FlowSpecTable) Destination(p netip.Prefix) iter.Seq[*FlowSpecEntry] {
+	p = p.Masked()
+	return func(yield func(*FlowSpecEntry) bool) {
+		start := &FlowSpecEntry{Route: &fs.FlowSpecRoute{Components: fs.FSComponentList{
+			Components: []fs.FSComponent{{Type: fs.ComponentTypeDestinationPrefix, Prefix: &p}},
+		}}}
+		for n := t.dst.seek(start); n != nil; n = n.next[0] {
+			d, _ := destination(n.item.Route)
+			if d.Addr().BitLen() != p.Addr().BitLen() || !p.Contains(d.Addr()) {
+				return
+			}
+			if d.Bits() >= p.Bits() && !yield(n.item) {
+				return
+			}
+		}
+	}
+}
+
+// destination returns the destination prefix of route: DestPrefix, which
+// ValidateFeasibility checks, or else its destination prefix component.
+func destination(route *fs.FlowSpecRoute) (netip.Prefix, bool) {
+	if route.DestPrefix != nil {
+		return route.DestPrefix.Masked(), true
+	}
+	for _, c := range route.Components.Components {
+		if c.Type == fs.ComponentTypeDestinationPrefix && c.Prefix != nil {
+			return c.Prefix.Masked(), true
+		}
+	}
+	return netip.Prefix{}, false
+}
+
+// compareDestination orders by destination address, then prefix length,
+// then key, so the prefixes within a prefix are contiguous.
+func compareDestination(a, b *FlowSpecEntry) int {
+	da, _ := destination(a.Route)
+	db, _ := destination(b.Route)
+	if c := da.Addr().Compare(db.Addr()); c != 0 {
+		return c
+	}
+	if c := cmp.Compare(da.Bits(), db.Bits()); c != 0 {
+		return c
+	}
+	return cmp.Compare(a.Key, b.Key)
+}
@@ -0,0 +1,120 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package rib
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/netip"
+	"slices"
+	"testing"
+
+	fs "floofspectools/flowspecinternal"
+)
+
+func tableRules(seq func(func(*FlowSpecEntry) bool)) []string {
+	var out []string
+	for e := range seq {
+		out = append(out, e.Route.Components.String())
+	}
+	return out
+}
+
+func TestFlowSpecTable(t *testing.T) {
+	tbl := NewFlowSpecTable()
+	errInfeasible := errors.New("infeasible")
+	for _, s := range []string{"dst 192.0.2.0/24", "dst 2001:db8::/32", "dst 192.0.2.0/25 proto tcp", "dst 192.0.2.0/24 dport 80", "proto udp", "dst 198.51.100.0/24"} {
+		if tbl.Insert(flowSpecRoute(t, s), errInfeasible) {
+			t.Errorf("Insert(%q) replaced", s)
+		}
+	}
+	if !tbl.Insert(flowSpecRoute(t, "dst 192.0.2.0/25 proto tcp"), nil) {
+		t.Error("Insert() did not replace")
+	}
+	want := []string{"dst 192.0.2.0/25 proto tcp", "dst 192.0.2.0/24 dport =80", "dst 192.0.2.0/24", "dst 198.51.100.0/24", "proto udp", "dst 2001:db8::/32"}
+	if got := tableRules(tbl.All()); !slices.Equal(got, want) {
+		t.Errorf("All() = %q, want %q", got, want)
+	}
+	if e, ok := tbl.Get(flowSpecRoute(t, "dst 192.0.2.0/25 proto tcp")); !ok || e.Err != nil || tbl.Len() != 6 {
+		t.Errorf("Get() = %v, %v, Len() = %d, want the replaced entry and 6", e, ok, tbl.Len())
+	}
+
+	want = []string{"dst 192.0.2.0/24", "dst 192.0.2.0/24 dport =80", "dst 192.0.2.0/25 proto tcp"}
+	if got := tableRules(tbl.Destination(netip.MustParsePrefix("192.0.2.0/23"))); !slices.Equal(got, want) {
+		t.Errorf("Destination(192.0.2.0/23) = %q, want %q", got, want)
+	}
+	if got := tableRules(tbl.Destination(netip.MustParsePrefix("192.0.2.0/25"))); !slices.Equal(got, want[2:]) {
+		t.Errorf("Destination(192.0.2.0/25) = %q, want %q", got, want[2:])
+	}
+	if got := tableRules(tbl.Destination(netip.MustParsePrefix("::/0"))); !slices.Equal(got, []string{"dst 2001:db8::/32"}) {
+		t.Errorf("Destination(::/0) = %q", got)
+	}
+
+	if !tbl.Delete(flowSpecRoute(t, "dst 192.0.2.0/24")) || tbl.Delete(flowSpecRoute(t, "dst 192.0.2.0/24")) {
+		t.Error("Delete() did not report the route once")
+	}
+	if got := tableRules(tbl.Destination(netip.MustParsePrefix("192.0.2.0/24"))); len(got) != 2 || tbl.Len() != 5 {
+		t.Errorf("after Delete: Destination() = %q, Len() = %d", got, tbl.Len())
+	}
+}
+
+// TestFlowSpecTableMatchesRIB checks the table against FlowSpecRIB, whose
+// sorted slice is the reference order, under random inserts and deletes.
+func TestFlowSpecTableMatchesRIB(t *testing.T) {
+	rng := rand.New(rand.NewPCG(3, 4))
+	tbl := NewFlowSpecTable()
+	r := NewFlowSpecRIB(nil)
+	for range 3000 {
+		s := fmt.Sprintf("dst 10.%d.%d.0/%d dport %d", rng.IntN(4), rng.IntN(8), 22+rng.IntN(3), rng.IntN(3))
+		route := flowSpecRoute(t, s)
+		if rng.IntN(3) == 0 {
+			tbl.Delete(route)
+			r.Delete(route)
+			continue
+		}
+		tbl.Insert(route, nil)
+		r.Insert(route, nil)
+	}
+	if got, want := tableRules(tbl.All()), rules(r.Snapshot()); !slices.Equal(got, want) {
+		t.Fatalf("All() differs from FlowSpecRIB: %d vs %d routes", len(got), len(want))
+	}
+	var want []string
+	within := netip.MustParsePrefix("10.1.0.0/16")
+	for e := range r.Snapshot().All() {
+		if d, _ := destination(e.Route); within.Contains(d.Addr()) {
+			want = append(want, e.Route.Components.String())
+		}
+	}
+	got := tableRules(tbl.Destination(within))
+	slices.Sort(got)
+	slices.Sort(want)
+	if !slices.Equal(got, want) {
+		t.Errorf("Destination() = %d routes, want %d", len(got), len(want))
+	}
+}
+
+func BenchmarkFlowSpecTableInsert(b *testing.B) {
+	routes := make([]*fs.FlowSpecRoute, 10_000)
+	for i := range routes {
+		routes[i] = flowSpecRoute(b, fmt.Sprintf("dst 10.%d.%d.0/24 dport %d", i/256%256, i%256, i%7))
+	}
+	b.Run("FlowSpecTable", func(b *testing.B) {
+		for b.Loop() {
+			tbl := NewFlowSpecTable()
+			for _, r := range routes {
+				tbl.Insert(r, nil)
+			}
+		}
+	})
+	b.Run("FlowSpecRIB", func(b *testing.B) {
+		for b.Loop() {
+			r := NewFlowSpecRIB(nil)
+			for _, route := range routes {
+				r.Insert(route, nil)
+			}
+		}
+	})
+}
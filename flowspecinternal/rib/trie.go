@@ -0,0 +1,221 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package rib
+
+import (
+	"net/netip"
+	"sync"
+
+	fs "floofspectools/flowspecinternal"
+)
+
+type trieNode struct {
+	child [2]*trieNode
+	route *fs.UnicastRoute
+}
+
+// Trie is a binary trie indexed UnicastRIB.
+type Trie struct {
+	notifier
+	addPaths
+	mu   sync.RWMutex
+	v4   *trieNode
+	v6   *trieNode
+	size int
+}
+
+// NewTrie returns an empty Trie.
+func NewTrie() *Trie {
+	return &Trie{v4: &trieNode{}, v6: &trieNode{}}
+}
+
+func addrBit(a netip.Addr, i int) int {
+	b := a.As16()
+	if a.Is4() {
+		i += 96
+	}
+	return int(b[i/8]>>(7-i%8)) & 1
+}
+
+func (t *Trie) root(p netip.Prefix) *trieNode {
+	if p.Addr().Is4() {
+		return t.v4
+	}
+	return t.v6
+}
+
+// Insert adds r, replacing any route for the same prefix.
+func (t *Trie) Insert(r *fs.UnicastRoute) {
+	t.mu.Lock()
+	t.insert(r)
+	t.mu.Unlock()
+	t.emit(Event{Kind: EventInsert, Prefix: r.Prefix.Masked(), Route: r})
+}
+
+// BulkLoad replaces the table with routes sorted by SortRoutes and drops
+// all additional paths.
+func (t *Trie) BulkLoad(routes []*fs.UnicastRoute) error {
+	if err := checkSorted(routes); err != nil {
+		return err
+	}
+	// allocate nodes in slabs, per-node allocation dominates the load otherwise
+	var slab []trieNode
+	alloc := func() *trieNode {
+		if len(slab) == 0 {
+			slab = make([]trieNode, 4096)
+		}
+		n := &slab[0]
+		slab = slab[1:]
+		return n
+	}
+	t.mu.Lock()
+	t.v4, t.v6, t.size = &trieNode{}, &trieNode{}, 0
+	t.resetPaths()
+	for _, r := range routes {
+		t.insertWith(r, alloc)
+	}
+	t.mu.Unlock()
+	t.emit(Event{Kind: EventLoaded, Count: len(routes)})
+	return nil
+}
+
+func (t *Trie) insert(r *fs.UnicastRoute) {
+	t.insertWith(r, func() *trieNode { return &trieNode{} })
+}
+
+func (t *Trie) insertWith(r *fs.UnicastRoute, alloc func() *trieNode) {
+	p := r.Prefix.Masked()
+	n := t.root(p)
+	for i := 0; i < p.Bits(); i++ {
+		b := addrBit(p.Addr(), i)
+		if n.child[b] == nil {
+			n.child[b] = alloc()
+		}
+		n = n.child[b]
+	}
+	if n.route == nil {
+		t.size++
+	}
+	n.route = r
+}
+
+// Delete removes the route and the additional paths for p and prunes nodes
+// left empty.
+func (t *Trie) Delete(p netip.Prefix) bool {
+	p = p.Masked()
+	t.mu.Lock()
+	ok := t.delete(p)
+	t.deletePaths(p)
+	t.mu.Unlock()
+	if ok {
+		t.emit(Event{Kind: EventDelete, Prefix: p})
+	}
+	return ok
+}
+
+func (t *Trie) delete(p netip.Prefix) bool {
+	path := []*trieNode{t.root(p)}
+	for i := 0; i < p.Bits(); i++ {
+		n := path[len(path)-1].child[addrBit(p.Addr(), i)]
+		if n == nil {
+			return false
+		}
+		path = append(path, n)
+	}
+	n := path[len(path)-1]
+	if n.route == nil {
+		return false
+	}
+	n.route = nil
+	t.size--
+	for i := len(path) - 1; i > 0; i-- {
+		n := path[i]
+		if n.route != nil || n.child[0] != nil || n.child[1] != nil {
+			break
+		}
+		path[i-1].child[addrBit(p.Addr(), i-1)] = nil
+	}
+	return true
+}
+
+// BestPath returns the longest prefix match covering p.
+func (t *Trie) BestPath(p netip.Prefix) *fs.UnicastRoute {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	p = p.Masked()
+	n := t.root(p)
+	best := n.route
+	for i := 0; i < p.Bits(); i++ {
+		n = n.child[addrBit(p.Addr(), i)]
+		if n == nil {
+			break
+		}
+		if n.route != nil {
+			best = n.route
+		}
+	}
+	return best
+}
+
+// MoreSpecifics returns all routes strictly more specific than p.
+func (t *Trie) MoreSpecifics(p netip.Prefix) []*fs.UnicastRoute {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	p = p.Masked()
+	n := t.root(p)
+	for i := 0; i < p.Bits() && n != nil; i++ {
+		n = n.child[addrBit(p.Addr(), i)]
+	}
+	if n == nil {
+		return nil
+	}
+	var out []*fs.UnicastRoute
+	var walk func(*trieNode)
+	walk = func(n *trieNode) {
+		if n == nil {
+			return
+		}
+		if n.route != nil {
+			out = append(out, n.route)
+		}
+		walk(n.child[0])
+		walk(n.child[1])
+	}
+	walk(n.child[0])
+	walk(n.child[1])
+	return out
+}
+
+// Len returns the number of routes.
+func (t *Trie) Len() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.size
+}
+
+// InsertPath adds r as an additional path of its prefix, replacing the one
+// with the same PathID.
+func (t *Trie) InsertPath(r *fs.UnicastRoute) {
+	t.insertPath(r)
+	t.emit(Event{Kind: EventInsertPath, Prefix: r.Prefix.Masked(), Route: r})
+}
+
+// DeletePath removes the additional path id of p.
+func (t *Trie) DeletePath(p netip.Prefix, id uint32) bool {
+	p = p.Masked()
+	ok := t.deletePath(p, id)
+	if ok {
+		t.emit(Event{Kind: EventDeletePath, Prefix: p, PathID: id})
+	}
+	return ok
+}
+
+// AllPaths returns the best path of the longest prefix match covering p
+// followed by the additional paths of that prefix.
+func (t *Trie) AllPaths(p netip.Prefix) []*fs.UnicastRoute {
+	return t.allPaths(t.BestPath(p))
+}
@@ -0,0 +1,112 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package rib
+
+import (
+	"slices"
+	"sync"
+
+	fs "floofspectools/flowspecinternal"
+)
+
+// VPNFlowSpecRIB imports VPN FlowSpec routes (SAFI 134) into a FlowSpecRIB
+// per VRF: a route is imported into every VRF of an fs.VRFs importing one
+// of its route targets and validated against that VRF's unicast RIB
+// (RFC8955 8), so its result may differ between VRFs. Its methods are safe
+// for concurrent use.
+type VPNFlowSpecRIB struct {
+	vrfs *fs.VRFs
+	cfg  *fs.Config
+	opts *FlowSpecOptions
+
+	mu   sync.Mutex
+	ribs map[string]*FlowSpecRIB
+	// imported holds the VRFs each route is imported into by FlowSpecKey.
+	imported map[string][]string
+}
+
+// NewVPNFlowSpecRIB returns a VPNFlowSpecRIB importing into vrfs, validating
+// under cfg and creating the per-VRF RIBs with opts.
+func NewVPNFlowSpecRIB(vrfs *fs.VRFs, cfg *fs.Config, opts *FlowSpecOptions) *VPNFlowSpecRIB {
+	return &VPNFlowSpecRIB{
+		vrfs:     vrfs,
+		cfg:      cfg,
+		opts:     opts,
+		ribs:     map[string]*FlowSpecRIB{},
+		imported: map[string][]string{},
+	}
+}
+
+// VRF returns the FlowSpec RIB of the VRF name, nil before a route was
+// imported into it.
+func (v *VPNFlowSpecRIB) VRF(name string) *FlowSpecRIB {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.ribs[name]
+}
+
+func (v *VPNFlowSpecRIB) vrf(name string) *FlowSpecRIB {
+	r, ok := v.ribs[name]
+	if !ok {
+		r = NewFlowSpecRIB(v.opts)
+		v.ribs[name] = r
+	}
+	return r
+}
+
+// Import inserts route into the VRFs importing its route targets with the
+// result of its validation in each, removes it from VRFs an earlier
+// announcement was imported into but which no longer import it, and
+// returns the names of the VRFs it was imported into.
+func (v *VPNFlowSpecRIB) Import(route *fs.FlowSpecRoute) []string {
+	key := FlowSpecKey(route)
+	var names []string
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for _, vrf := range v.vrfs.Importing(route) {
+		v.vrf(vrf.Name).Insert(route, fs.ValidateFeasibility(route, vrf.RIB, v.cfg))
+		names = append(names, vrf.Name)
+	}
+	for _, name := range v.imported[key] {
+		if !slices.Contains(names, name) {
+			v.ribs[name].Delete(route)
+		}
+	}
+	if names == nil {
+		delete(v.imported, key)
+	} else {
+		v.imported[key] = names
+	}
+	return names
+}
+
+// Withdraw removes route from the VRFs it was imported into and reports
+// whether there were any.
+func (v *VPNFlowSpecRIB) Withdraw(route *fs.FlowSpecRoute) bool {
+	key := FlowSpecKey(route)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	names, ok := v.imported[key]
+	for _, name := range names {
+		v.ribs[name].Delete(route)
+	}
+	delete(v.imported, key)
+	return ok
+}
+
+// Revalidate validates the routes of the VRF name again against its
+// unicast RIB, e.g. after that changed.
+func (v *VPNFlowSpecRIB) Revalidate(name string) {
+	rib := v.vrfs.RIB(name)
+	v.mu.Lock()
+	r := v.ribs[name]
+	v.mu.Unlock()
+	if r == nil || rib == nil {
+		return
+	}
+	r.Revalidate(func(route *fs.FlowSpecRoute) error {
+		return fs.ValidateFeasibility(route, rib, v.cfg)
+	}, nil)
+}
@@ -0,0 +1,76 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package rib
+
+import (
+	"errors"
+	"net/netip"
+	"slices"
+	"testing"
+
+	fs "floofspectools/flowspecinternal"
+)
+
+func TestVPNFlowSpecRIB(t *testing.T) {
+	red, blue := NewTrie(), NewTrie()
+	dst := netip.MustParsePrefix("192.0.2.0/24")
+	red.Insert(&fs.UnicastRoute{Prefix: dst, NeighborAS: 65001, OriginatorID: netip.AddrFrom4([4]byte{192, 0, 2, 1})})
+	vrfs := fs.NewVRFs(NewTrie())
+	for _, v := range []fs.VRF{
+		{Name: "red", ImportTargets: []string{"65000:1"}, RIB: red},
+		{Name: "blue", ImportTargets: []string{"65000:1", "65000:2"}, RIB: blue},
+	} {
+		if err := vrfs.Add(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rt1, _ := fs.ParseRouteTarget("65000:1")
+	rt2, _ := fs.ParseRouteTarget("65000:2")
+	rd, _ := fs.ParseRD("65000:100")
+	route := func(rts ...[8]byte) *fs.FlowSpecRoute {
+		p := dst
+		return &fs.FlowSpecRoute{
+			AFI: fs.AFIIPv4, SAFI: fs.SAFIFlowSpecVPN, RD: rd, DestPrefix: &p, OriginatorID: netip.AddrFrom4([4]byte{192, 0, 2, 1}),
+			Components:     fs.FSComponentList{Components: []fs.FSComponent{{Type: fs.ComponentTypeDestinationPrefix, Prefix: &p}}},
+			ExtCommunities: rts,
+		}
+	}
+	v := NewVPNFlowSpecRIB(vrfs, nil, nil)
+
+	r := route(rt1)
+	if got := v.Import(r); !slices.Equal(got, []string{"red", "blue"}) {
+		t.Errorf("Import() = %v, want [red blue]", got)
+	}
+	if e, ok := v.VRF("red").Snapshot().Get(r); !ok || e.Err != nil {
+		t.Errorf("red entry = %v, %v, want feasible", e, ok)
+	}
+	if e, ok := v.VRF("blue").Snapshot().Get(r); !ok || !errors.Is(e.Err, fs.ErrNoBestUnicast) {
+		t.Errorf("blue entry = %v, %v, want %v", e, ok, fs.ErrNoBestUnicast)
+	}
+
+	// blue gains the unicast route
+	blue.Insert(&fs.UnicastRoute{Prefix: dst, NeighborAS: 65001, OriginatorID: netip.AddrFrom4([4]byte{192, 0, 2, 1})})
+	v.Revalidate("blue")
+	if e, _ := v.VRF("blue").Snapshot().Get(r); e == nil || e.Err != nil {
+		t.Errorf("blue entry after Revalidate() = %v, want feasible", e)
+	}
+
+	// re-announced with another route target: leaves red
+	if got := v.Import(route(rt2)); !slices.Equal(got, []string{"blue"}) {
+		t.Errorf("Import() = %v, want [blue]", got)
+	}
+	if n := v.VRF("red").Snapshot().Len(); n != 0 {
+		t.Errorf("red holds %d routes after the route target changed", n)
+	}
+	if !v.Withdraw(r) || v.Withdraw(r) {
+		t.Error("Withdraw() did not remove the route exactly once")
+	}
+	if n := v.VRF("blue").Snapshot().Len(); n != 0 {
+		t.Errorf("blue holds %d routes after Withdraw()", n)
+	}
+	if got := v.Import(route()); got != nil || v.VRF("green") != nil {
+		t.Errorf("Import() without route targets = %v", got)
+	}
+}
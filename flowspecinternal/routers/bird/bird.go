@@ -0,0 +1,282 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+// Package bird renders FlowSpec rules as BIRD 2/3 static flow4/flow6
+// routes, for deployment through configuration management where the router
+// cannot peer with the controller:
+//
+//	protocol static flowspec4 {
+//		flow4;
+//		route flow4 { dst 192.0.2.0/24; proto = 6; dport = 443; } {
+//			bgp_ext_community.add((generic, 0x80060000, 0x00000000)); # discard
+//		};
+//	}
+//
+// Actions are added as generic bgp_ext_community values, so every action
+// including registered extensions is carried unchanged.
+package bird
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/actions"
+)
+
+var (
+	ErrUnsupportedComponent = errors.New("bird: component cannot be expressed as BIRD flow match")
+	ErrMixedFamilies        = errors.New("bird: destination and source prefix address families differ")
+)
+
+// Options configures the generated protocols.
+type Options struct {
+	// Name4 and Name6 name the static protocols, defaulting to "flowspec4"
+	// and "flowspec6".
+	Name4, Name6 string
+	// IPv6 selects flow6 for rules that carry no prefix component.
+	IPv6 bool
+}
+
+var fragmentNames = [...]string{"dont_fragment", "is_fragment", "first_fragment", "last_fragment"}
+
+// Route renders one "route flow4|flow6 {...}" statement with the actions of
+// r in an attribute block, and reports whether it is a flow6 route.
+func Route(r actions.Rule, opts *Options) (string, bool, error) {
+	ipv6, err := family(r.Components, opts != nil && opts.IPv6)
+	if err != nil {
+		return "", false, err
+	}
+	net := "flow4"
+	if ipv6 {
+		net = "flow6"
+	}
+	var b strings.Builder
+	b.WriteString("route " + net + " {")
+	for _, c := range r.Components.Components {
+		m, err := match(c, ipv6)
+		if err != nil {
+			return "", false, err
+		}
+		b.WriteString(" " + m + ";")
+	}
+	b.WriteString(" }")
+	if len(r.Actions) > 0 {
+		b.WriteString(" {\n")
+		for _, a := range r.Actions {
+			ec := a.ExtendedCommunity()
+			fmt.Fprintf(&b, "\tbgp_ext_community.add((generic, 0x%08x, 0x%08x)); # %s\n",
+				binary.BigEndian.Uint32(ec[:4]), binary.BigEndian.Uint32(ec[4:]), a)
+		}
+		b.WriteString("}")
+	}
+	b.WriteString(";")
+	return b.String(), ipv6, nil
+}
+
+// Config renders rules as one static protocol per address family present,
+// keeping the order of rules.
+func Config(rules []actions.Rule, opts *Options) (string, error) {
+	o := Options{Name4: "flowspec4", Name6: "flowspec6"}
+	if opts != nil {
+		o.IPv6 = opts.IPv6
+		if opts.Name4 != "" {
+			o.Name4 = opts.Name4
+		}
+		if opts.Name6 != "" {
+			o.Name6 = opts.Name6
+		}
+	}
+	var routes [2][]string
+	for _, r := range rules {
+		s, ipv6, err := Route(r, &o)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", r.Components, err)
+		}
+		i := 0
+		if ipv6 {
+			i = 1
+		}
+		routes[i] = append(routes[i], s)
+	}
+	var b strings.Builder
+	for i, name := range []string{o.Name4, o.Name6} {
+		if len(routes[i]) == 0 {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "protocol static %s {\n\tflow%d;\n", name, 4+2*i)
+		for _, r := range routes[i] {
+			b.WriteString("\t" + strings.ReplaceAll(r, "\n", "\n\t") + "\n")
+		}
+		b.WriteString("}\n")
+	}
+	return b.String(), nil
+}
+
+func family(list fs.FSComponentList, fallback bool) (bool, error) {
+	var seen []bool
+	for _, c := range list.Components {
+		if c.Prefix != nil {
+			seen = append(seen, c.Prefix.Addr().Is6())
+		}
+	}
+	if len(seen) == 0 {
+		return fallback, nil
+	}
+	for _, v := range seen[1:] {
+		if v != seen[0] {
+			return false, ErrMixedFamilies
+		}
+	}
+	return seen[0], nil
+}
+
+func match(c fs.FSComponent, ipv6 bool) (string, error) {
+	switch c.Type {
+	case fs.ComponentTypeDestinationPrefix, fs.ComponentTypeSourcePrefix:
+		if c.Prefix == nil {
+			return "", fmt.Errorf("%w: %s without prefix", ErrUnsupportedComponent, c.Type)
+		}
+		kw := "dst"
+		if c.Type == fs.ComponentTypeSourcePrefix {
+			kw = "src"
+		}
+		return kw + " " + c.Prefix.String(), nil
+	case fs.ComponentTypeIpProtocol:
+		if ipv6 {
+			return numeric("next header", c)
+		}
+		return numeric("proto", c)
+	case fs.ComponentTypePort:
+		return numeric("port", c)
+	case fs.ComponentTypeDestinationPort:
+		return numeric("dport", c)
+	case fs.ComponentTypeSourcePort:
+		return numeric("sport", c)
+	case fs.ComponentTypeICMPType:
+		return numeric("icmp type", c)
+	case fs.ComponentTypeICMPCode:
+		return numeric("icmp code", c)
+	case fs.ComponentTypePacketLength:
+		return numeric("length", c)
+	case fs.ComponentTypeDSCP:
+		return numeric("dscp", c)
+	case fs.ComponentTypeTCPFlags:
+		return tcpFlags(c)
+	case fs.ComponentTypeFragment:
+		return fragment(c)
+	}
+	return "", fmt.Errorf("%w: %s", ErrUnsupportedComponent, c.Type)
+}
+
+var numericOperators = [...]string{"", "=", ">", ">=", "<", "<=", "!=", ""}
+
+// numeric renders AND-ed terms joined by "&&" and OR-ed groups by "||".
+func numeric(kw string, c fs.FSComponent) (string, error) {
+	ops, err := fs.ParseNumericOps(c.Raw)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	b.WriteString(kw)
+	for i, op := range ops {
+		if i > 0 {
+			b.WriteString(join(op.And))
+		}
+		k := 0
+		if op.LT {
+			k |= 4
+		}
+		if op.GT {
+			k |= 2
+		}
+		if op.EQ {
+			k |= 1
+		}
+		switch k {
+		case 0:
+			return "", fmt.Errorf("%w: %s operator matches no value", ErrUnsupportedComponent, c.Type)
+		case 7:
+			b.WriteString(" >= 0")
+		default:
+			fmt.Fprintf(&b, " %s %d", numericOperators[k], op.Value)
+		}
+	}
+	return b.String(), nil
+}
+
+func join(and bool) string {
+	if and {
+		return " &&"
+	}
+	return " ||"
+}
+
+// tcpFlags renders each term as BIRD's value/mask test, "(flags & mask) ==
+// value", negated with "!".
+func tcpFlags(c fs.FSComponent) (string, error) {
+	ops, err := fs.ParseBitmaskOps(c.Raw)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	b.WriteString("tcp flags")
+	for i, op := range ops {
+		if i > 0 {
+			b.WriteString(join(op.And))
+		}
+		// match: all bits set; otherwise any bit set, i.e. not none set
+		value, not := op.Value, op.Not
+		if !op.Match {
+			value, not = 0, !not
+		}
+		neg := ""
+		if not {
+			neg = "!"
+		}
+		fmt.Fprintf(&b, " %s0x%x/0x%x", neg, value, op.Value)
+	}
+	return b.String(), nil
+}
+
+// fragment renders the fragment bits by name. A multi-bit term expands into
+// AND-ed single-bit terms where that keeps its meaning: all bits set, or
+// none set.
+func fragment(c fs.FSComponent) (string, error) {
+	ops, err := fs.ParseBitmaskOps(c.Raw)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	b.WriteString("fragment")
+	for i, op := range ops {
+		single := op.Value != 0 && op.Value&(op.Value-1) == 0
+		if !single && op.Match == op.Not {
+			return "", fmt.Errorf("%w: fragment term matching any of several bits", ErrUnsupportedComponent)
+		}
+		neg := ""
+		if op.Not {
+			neg = "!"
+		}
+		var names []string
+		for bit, n := range fragmentNames {
+			if op.Value&(1<<bit) != 0 {
+				names = append(names, neg+n)
+			}
+		}
+		if len(names) == 0 || op.Value > 0x0f {
+			return "", fmt.Errorf("%w: fragment bits 0x%x", ErrUnsupportedComponent, op.Value)
+		}
+		if i > 0 {
+			b.WriteString(join(op.And))
+		}
+		b.WriteString(" " + strings.Join(names, " && "))
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,81 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package bird
+
+import (
+	"errors"
+	"testing"
+
+	"floofspectools/flowspecinternal/actions"
+)
+
+func TestRoute(t *testing.T) {
+	tests := []struct {
+		rule    string
+		want    string
+		wantErr error
+	}{
+		{
+			rule: "dst 192.0.2.0/24 proto tcp dport =443",
+			want: "route flow4 { dst 192.0.2.0/24; proto = 6; dport = 443; };",
+		},
+		{
+			rule: "dst 192.0.2.0/24 dport >=1024&<=2048,=80 len <100 then discard",
+			want: "route flow4 { dst 192.0.2.0/24; dport >= 1024 && <= 2048 || = 80; length < 100; } {\n" +
+				"\tbgp_ext_community.add((generic, 0x80060000, 0x00000000)); # discard\n};",
+		},
+		{
+			rule: "src 10.0.0.0/8 tcp-flags =syn|ack,!rst frag isf&!lf",
+			want: "route flow4 { src 10.0.0.0/8; tcp flags 0x12/0x12 || 0x0/0x4; fragment is_fragment && !last_fragment; };",
+		},
+		{
+			rule: "dst 2001:db8::/32 proto udp dscp =46",
+			want: "route flow6 { dst 2001:db8::/32; next header = 17; dscp = 46; };",
+		},
+		{rule: "dst 192.0.2.0/24 src 2001:db8::/32", wantErr: ErrMixedFamilies},
+		{rule: "dst 192.0.2.0/24 frag df|lf", wantErr: ErrUnsupportedComponent},
+	}
+	for _, tt := range tests {
+		list, acts, err := actions.ParseRule(tt.rule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, _, err := Route(actions.Rule{Components: list, Actions: acts}, nil)
+		if tt.wantErr != nil {
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Route(%q) error = %v, want %v", tt.rule, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Route(%q) error = %v", tt.rule, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Route(%q) =\n%s\nwant\n%s", tt.rule, got, tt.want)
+		}
+	}
+}
+
+func TestConfig(t *testing.T) {
+	var rules []actions.Rule
+	for _, s := range []string{"dst 2001:db8::/32 then rate-limit 0", "dst 192.0.2.0/24"} {
+		list, acts, err := actions.ParseRule(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rules = append(rules, actions.Rule{Components: list, Actions: acts})
+	}
+	got, err := Config(rules, &Options{Name6: "ddos6"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "protocol static flowspec4 {\n\tflow4;\n\troute flow4 { dst 192.0.2.0/24; };\n}\n" +
+		"\nprotocol static ddos6 {\n\tflow6;\n\troute flow6 { dst 2001:db8::/32; } {\n" +
+		"\t\tbgp_ext_community.add((generic, 0x80060000, 0x00000000)); # discard\n\t};\n}\n"
+	if got != want {
+		t.Errorf("Config() =\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,307 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+// Package frr renders FlowSpec rules as FRRouting vtysh configuration.
+//
+// FRR installs FlowSpec as policy based routing and cannot originate it from
+// configuration, so a rule set becomes one pbr-map applied to the ingress
+// interfaces:
+//
+//	pbr-map flowspec seq 10
+//	 match dst-ip 192.0.2.0/24
+//	 match ip-protocol tcp
+//	 match dst-port 443
+//	 set table 10000
+//	exit
+//
+// pbrd matches single values, so OR-ed operators and ranges are expanded into
+// consecutive sequences. Actions map onto set clauses:
+//   - discard (rate 0) jumps to Options.DropTable, which holds blackhole
+//     default routes
+//   - redirect sets the VRF given for the route target in Options.VRFs
+//   - traffic marking sets the DSCP
+//   - no forwarding action sets "vrf unchanged"
+//
+// Non-zero rate limits, the terminal bit and ICMP, TCP flag, packet length
+// and fragment components have no pbrd counterpart and are rejected; the
+// sample bit is ignored.
+package frr
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/actions"
+)
+
+var (
+	ErrUnsupportedComponent = errors.New("frr: component cannot be expressed as pbr-map match")
+	ErrUnsupportedAction    = errors.New("frr: action cannot be expressed as pbr-map set")
+	ErrEmptyMatch           = errors.New("frr: component operators match no value; rule can never match")
+	ErrMixedFamilies        = errors.New("frr: destination and source prefix address families differ")
+	ErrUnknownVRF           = errors.New("frr: no VRF configured for redirect route target")
+	ErrTooManyRules         = errors.New("frr: rule expansion exceeds Options.MaxRules")
+)
+
+// Options configures the generated configuration.
+type Options struct {
+	// Name is the pbr-map name, defaulting to "flowspec".
+	Name string
+	// DropTable is the kernel table of discarded traffic, defaulting to
+	// 10000.
+	DropTable uint32
+	// VRFs maps redirect route targets, as in "65500:100" or
+	// "192.0.2.1:100", to VRF names.
+	VRFs map[string]string
+	// Interfaces are given "pbr-policy Name".
+	Interfaces []string
+	// MaxRules bounds the sequences of one FlowSpec rule, defaults to 256.
+	MaxRules int
+}
+
+// Commands returns the vtysh configuration lines for rules in their order,
+// which should be RFC8955 5.1 order as pbrd stops at the first matching
+// sequence. Feed them to "vtysh -f" or after "configure terminal".
+func Commands(rules []actions.Rule, opts *Options) ([]string, error) {
+	o := Options{Name: "flowspec", DropTable: 10000, MaxRules: 256}
+	if opts != nil {
+		o.VRFs, o.Interfaces = opts.VRFs, opts.Interfaces
+		if opts.Name != "" {
+			o.Name = opts.Name
+		}
+		if opts.DropTable != 0 {
+			o.DropTable = opts.DropTable
+		}
+		if opts.MaxRules > 0 {
+			o.MaxRules = opts.MaxRules
+		}
+	}
+	var (
+		out  []string
+		drop bool
+		seq  = 10
+	)
+	for _, r := range rules {
+		if err := checkFamily(r.Components); err != nil {
+			return nil, fmt.Errorf("%s: %w", r.Components, err)
+		}
+		matches, err := compileMatches(r.Components, o.MaxRules)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", r.Components, err)
+		}
+		sets, discard, err := compileSets(r.Actions, o)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", r.Components, err)
+		}
+		drop = drop || discard
+		for _, m := range matches {
+			out = append(out, fmt.Sprintf("pbr-map %s seq %d", o.Name, seq))
+			for _, l := range append(m, sets...) {
+				out = append(out, " "+l)
+			}
+			out = append(out, "exit")
+			seq += 10
+		}
+	}
+	if drop {
+		t := strconv.FormatUint(uint64(o.DropTable), 10)
+		out = append(out, "ip route 0.0.0.0/0 blackhole table "+t, "ipv6 route ::/0 blackhole table "+t)
+	}
+	for _, ifname := range o.Interfaces {
+		out = append(out, "interface "+ifname, " pbr-policy "+o.Name, "exit")
+	}
+	return out, nil
+}
+
+func checkFamily(list fs.FSComponentList) error {
+	var seen []bool
+	for _, c := range list.Components {
+		if c.Prefix != nil {
+			seen = append(seen, c.Prefix.Addr().Is6())
+		}
+	}
+	for i := 1; i < len(seen); i++ {
+		if seen[i] != seen[0] {
+			return ErrMixedFamilies
+		}
+	}
+	return nil
+}
+
+// values enumerates the values c matches, nil if it matches all of them.
+func values(c fs.FSComponent, max uint64) ([]uint64, error) {
+	ops, err := fs.ParseNumericOps(c.Raw)
+	if err != nil {
+		return nil, err
+	}
+	ranges := fs.NumericRanges(ops, max)
+	if len(ranges) == 0 {
+		return nil, ErrEmptyMatch
+	}
+	if len(ranges) == 1 && ranges[0].From == 0 && ranges[0].To == max {
+		return nil, nil
+	}
+	var out []uint64
+	for _, r := range ranges {
+		for v := r.From; v <= r.To; v++ {
+			out = append(out, v)
+		}
+	}
+	return out, nil
+}
+
+// cross returns every combination of one alternative from each of alts.
+func cross(acc [][]string, alts [][]string, limit int) ([][]string, error) {
+	var out [][]string
+	for _, a := range acc {
+		for _, b := range alts {
+			out = append(out, append(append([]string{}, a...), b...))
+			if len(out) > limit {
+				return nil, ErrTooManyRules
+			}
+		}
+	}
+	return out, nil
+}
+
+func protoName(p uint64) string {
+	switch p {
+	case 6:
+		return "tcp"
+	case 17:
+		return "udp"
+	case 1:
+		return "icmp"
+	}
+	return strconv.FormatUint(p, 10)
+}
+
+func compileMatches(list fs.FSComponentList, limit int) ([][]string, error) {
+	acc := [][]string{nil}
+	var (
+		protos []uint64
+		ports  bool
+		alts   [][][]string
+	)
+	for _, c := range list.Components {
+		switch c.Type {
+		case fs.ComponentTypeDestinationPrefix:
+			acc[0] = append(acc[0], "match dst-ip "+c.Prefix.Masked().String())
+		case fs.ComponentTypeSourcePrefix:
+			acc[0] = append(acc[0], "match src-ip "+c.Prefix.Masked().String())
+		case fs.ComponentTypeIpProtocol:
+			var err error
+			if protos, err = values(c, 0xff); err != nil {
+				return nil, err
+			}
+		case fs.ComponentTypePort, fs.ComponentTypeDestinationPort, fs.ComponentTypeSourcePort:
+			vs, err := values(c, 0xffff)
+			if err != nil {
+				return nil, err
+			}
+			if vs == nil {
+				continue
+			}
+			ports = true
+			var a [][]string
+			for _, v := range vs {
+				p := strconv.FormatUint(v, 10)
+				if c.Type != fs.ComponentTypeSourcePort {
+					a = append(a, []string{"match dst-port " + p})
+				}
+				if c.Type != fs.ComponentTypeDestinationPort {
+					a = append(a, []string{"match src-port " + p})
+				}
+			}
+			alts = append(alts, a)
+		case fs.ComponentTypeDSCP:
+			vs, err := values(c, 0x3f)
+			if err != nil {
+				return nil, err
+			}
+			var a [][]string
+			for _, v := range vs {
+				a = append(a, []string{fmt.Sprintf("match dscp %d", v)})
+			}
+			if a != nil {
+				alts = append(alts, a)
+			}
+		default:
+			return nil, fmt.Errorf("%w: %s", ErrUnsupportedComponent, c.Type)
+		}
+	}
+	if ports {
+		// pbrd matches ports of tcp and udp only
+		if protos == nil {
+			protos = []uint64{6, 17}
+		}
+		for _, p := range protos {
+			if p != 6 && p != 17 {
+				return nil, fmt.Errorf("%w: ports of protocol %d", ErrUnsupportedComponent, p)
+			}
+		}
+	}
+	if protos != nil {
+		var a [][]string
+		for _, p := range protos {
+			a = append(a, []string{"match ip-protocol " + protoName(p)})
+		}
+		alts = append([][][]string{a}, alts...)
+	}
+	for _, a := range alts {
+		var err error
+		if acc, err = cross(acc, a, limit); err != nil {
+			return nil, err
+		}
+	}
+	return acc, nil
+}
+
+// compileSets maps acts onto set clauses and reports whether the rule
+// discards.
+func compileSets(acts []actions.Action, o Options) ([]string, bool, error) {
+	var (
+		forward string
+		mark    string
+		discard bool
+	)
+	for _, a := range acts {
+		switch v := a.(type) {
+		case actions.TrafficRateBytes, actions.TrafficRatePackets:
+			if !actions.IsDiscard(a) {
+				return nil, false, fmt.Errorf("%w: %s", ErrUnsupportedAction, a)
+			}
+			discard = true
+		case actions.Redirect:
+			rt := strings.TrimPrefix(v.String(), "redirect ")
+			vrf, ok := o.VRFs[rt]
+			if !ok {
+				return nil, false, fmt.Errorf("%w: %s", ErrUnknownVRF, rt)
+			}
+			forward = "set vrf " + vrf
+		case actions.TrafficMarking:
+			mark = fmt.Sprintf("set dscp %d", v.DSCP&0x3f)
+		case actions.TrafficAction:
+			if v.Terminal {
+				return nil, false, fmt.Errorf("%w: %s", ErrUnsupportedAction, a)
+			}
+		default:
+			return nil, false, fmt.Errorf("%w: %s", ErrUnsupportedAction, a)
+		}
+	}
+	if discard {
+		// discarding overrides every other action
+		return []string{fmt.Sprintf("set table %d", o.DropTable)}, true, nil
+	}
+	if forward == "" {
+		forward = "set vrf unchanged"
+	}
+	if mark != "" {
+		return []string{mark, forward}, false, nil
+	}
+	return []string{forward}, false, nil
+}
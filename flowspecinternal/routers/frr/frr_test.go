@@ -0,0 +1,83 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package frr
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"floofspectools/flowspecinternal/actions"
+)
+
+func TestCommands(t *testing.T) {
+	opts := &Options{VRFs: map[string]string{"65500:100": "scrub"}, Interfaces: []string{"eth0"}}
+	tests := []struct {
+		name    string
+		rules   []string
+		want    []string
+		wantErr error
+	}{
+		{
+			name:  "discard",
+			rules: []string{"dst 192.0.2.0/24 proto tcp dport =443 then discard"},
+			want: []string{
+				"pbr-map flowspec seq 10", " match dst-ip 192.0.2.0/24", " match ip-protocol tcp", " match dst-port 443", " set table 10000", "exit",
+				"ip route 0.0.0.0/0 blackhole table 10000", "ipv6 route ::/0 blackhole table 10000",
+				"interface eth0", " pbr-policy flowspec", "exit",
+			},
+		},
+		{
+			name:  "expansion and redirect",
+			rules: []string{"src 2001:db8::/32 port =53 then redirect 65500:100 mark 10"},
+			want: []string{
+				"pbr-map flowspec seq 10", " match src-ip 2001:db8::/32", " match ip-protocol tcp", " match dst-port 53", " set dscp 10", " set vrf scrub", "exit",
+				"pbr-map flowspec seq 20", " match src-ip 2001:db8::/32", " match ip-protocol tcp", " match src-port 53", " set dscp 10", " set vrf scrub", "exit",
+				"pbr-map flowspec seq 30", " match src-ip 2001:db8::/32", " match ip-protocol udp", " match dst-port 53", " set dscp 10", " set vrf scrub", "exit",
+				"pbr-map flowspec seq 40", " match src-ip 2001:db8::/32", " match ip-protocol udp", " match src-port 53", " set dscp 10", " set vrf scrub", "exit",
+				"interface eth0", " pbr-policy flowspec", "exit",
+			},
+		},
+		{
+			name:  "sequence across rules",
+			rules: []string{"dst 192.0.2.0/25 dscp =46", "dst 192.0.2.0/24"},
+			want: []string{
+				"pbr-map flowspec seq 10", " match dst-ip 192.0.2.0/25", " match dscp 46", " set vrf unchanged", "exit",
+				"pbr-map flowspec seq 20", " match dst-ip 192.0.2.0/24", " set vrf unchanged", "exit",
+				"interface eth0", " pbr-policy flowspec", "exit",
+			},
+		},
+		{name: "rate limit", rules: []string{"dst 192.0.2.0/24 then rate-limit 9600"}, wantErr: ErrUnsupportedAction},
+		{name: "unknown vrf", rules: []string{"dst 192.0.2.0/24 then redirect 65500:200"}, wantErr: ErrUnknownVRF},
+		{name: "fragment", rules: []string{"dst 192.0.2.0/24 frag isf"}, wantErr: ErrUnsupportedComponent},
+		{name: "icmp ports", rules: []string{"dst 192.0.2.0/24 proto icmp dport =80"}, wantErr: ErrUnsupportedComponent},
+		{name: "expansion limit", rules: []string{"dst 192.0.2.0/24 dport >=1&<=1000"}, wantErr: ErrTooManyRules},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var rules []actions.Rule
+			for _, s := range tt.rules {
+				list, acts, err := actions.ParseRule(s)
+				if err != nil {
+					t.Fatal(err)
+				}
+				rules = append(rules, actions.Rule{Components: list, Actions: acts})
+			}
+			got, err := Commands(rules, opts)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Commands() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("Commands() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
@@ -0,0 +1,277 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+// Package iosxr renders FlowSpec rules as IOS-XR local flowspec
+// configuration: one traffic class-map per rule, a pbr policy-map per
+// address family applying them in rule order, and the flowspec stanza
+// installing the policies:
+//
+//	class-map type traffic match-all flowspec-1
+//	 match destination-address ipv4 192.0.2.0 255.255.255.0
+//	 match protocol 6
+//	 match destination-port 80 1024-2048
+//	 end-class-map
+//	!
+//	policy-map type pbr flowspec-v4
+//	 class type traffic flowspec-1
+//	  drop
+//	 !
+//	 class type traffic class-default
+//	 !
+//	 end-policy-map
+//	!
+//	flowspec
+//	 address-family ipv4
+//	  service-policy type pbr flowspec-v4
+//	 !
+//	!
+//
+// TCP flags support a single operator and fragments OR-ed single bits; the
+// terminal bit cannot be expressed and the sample bit is ignored.
+package iosxr
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/actions"
+)
+
+var (
+	ErrUnsupportedComponent = errors.New("iosxr: component cannot be expressed as flowspec class-map match")
+	ErrUnsupportedAction    = errors.New("iosxr: action cannot be expressed as flowspec policy-map action")
+	ErrEmptyMatch           = fs.ErrEmptyMatch
+	ErrMixedFamilies        = fs.ErrMixedFamilies
+)
+
+// Options configures the generated configuration.
+type Options struct {
+	// Name prefixes the class-maps, Name-1, Name-2, ... in rule order, and
+	// names the policy-maps Name-v4 and Name-v6. It defaults to "flowspec".
+	Name string
+	// IPv6 selects ipv6 for rules that carry no prefix component.
+	IPv6 bool
+}
+
+var fragmentNames = [...]string{"dont-fragment", "is-fragment", "first-fragment", "last-fragment"}
+
+// Config renders rules as class-maps, policy-maps and the flowspec stanza.
+func Config(rules []actions.Rule, opts *Options) (string, error) {
+	o := Options{Name: "flowspec"}
+	if opts != nil {
+		o.IPv6 = opts.IPv6
+		if opts.Name != "" {
+			o.Name = opts.Name
+		}
+	}
+	var (
+		b       strings.Builder
+		classes [2][]string
+	)
+	for i, r := range rules {
+		ipv6, err := fs.AddressFamily(r.Components, o.IPv6)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", r.Components, err)
+		}
+		matches, err := compileMatches(r.Components, ipv6)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", r.Components, err)
+		}
+		acts, err := compileActions(r.Actions)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", r.Components, err)
+		}
+		name := fmt.Sprintf("%s-%d", o.Name, i+1)
+		fmt.Fprintf(&b, "class-map type traffic match-all %s\n", name)
+		for _, m := range matches {
+			b.WriteString(" " + m + "\n")
+		}
+		b.WriteString(" end-class-map\n!\n")
+		var c strings.Builder
+		fmt.Fprintf(&c, " class type traffic %s\n", name)
+		for _, a := range acts {
+			c.WriteString("  " + a + "\n")
+		}
+		c.WriteString(" !\n")
+		f := 0
+		if ipv6 {
+			f = 1
+		}
+		classes[f] = append(classes[f], c.String())
+	}
+	families := []string{"ipv4", "ipv6"}
+	policies := []string{o.Name + "-v4", o.Name + "-v6"}
+	for f := range families {
+		if len(classes[f]) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "policy-map type pbr %s\n", policies[f])
+		for _, c := range classes[f] {
+			b.WriteString(c)
+		}
+		b.WriteString(" class type traffic class-default\n !\n end-policy-map\n!\n")
+	}
+	if len(classes[0])+len(classes[1]) > 0 {
+		b.WriteString("flowspec\n")
+		for f, af := range families {
+			if len(classes[f]) > 0 {
+				fmt.Fprintf(&b, " address-family %s\n  service-policy type pbr %s\n !\n", af, policies[f])
+			}
+		}
+		b.WriteString("!\n")
+	}
+	return b.String(), nil
+}
+
+// valueList renders the values c matches as "80 1024-2048", or "" if it
+// matches every value.
+func valueList(c fs.FSComponent, max uint64) (string, error) {
+	ranges, err := fs.ComponentRanges(c, max)
+	if err != nil || fs.MatchesAll(ranges, max) {
+		return "", err
+	}
+	items := make([]string, len(ranges))
+	for i, r := range ranges {
+		items[i] = strconv.FormatUint(r.From, 10)
+		if r.From != r.To {
+			items[i] += "-" + strconv.FormatUint(r.To, 10)
+		}
+	}
+	return strings.Join(items, " "), nil
+}
+
+func compileMatches(list fs.FSComponentList, ipv6 bool) ([]string, error) {
+	af := "ipv4"
+	if ipv6 {
+		af = "ipv6"
+	}
+	var out []string
+	for _, c := range list.Components {
+		var (
+			kw    string
+			limit uint64 = 0xffff
+		)
+		switch c.Type {
+		case fs.ComponentTypeDestinationPrefix, fs.ComponentTypeSourcePrefix:
+			kw = "destination-address"
+			if c.Type == fs.ComponentTypeSourcePrefix {
+				kw = "source-address"
+			}
+			p := c.Prefix.Masked()
+			if ipv6 {
+				out = append(out, fmt.Sprintf("match %s ipv6 %s", kw, p))
+			} else {
+				mask := net.CIDRMask(p.Bits(), 32)
+				out = append(out, fmt.Sprintf("match %s ipv4 %s %s", kw, p.Addr(), net.IP(mask)))
+			}
+			continue
+		case fs.ComponentTypeIpProtocol:
+			kw, limit = "protocol", 0xff
+		case fs.ComponentTypePort:
+			kw = "port"
+		case fs.ComponentTypeDestinationPort:
+			kw = "destination-port"
+		case fs.ComponentTypeSourcePort:
+			kw = "source-port"
+		case fs.ComponentTypeICMPType:
+			kw, limit = af+" icmp-type", 0xff
+		case fs.ComponentTypeICMPCode:
+			kw, limit = af+" icmp-code", 0xff
+		case fs.ComponentTypePacketLength:
+			kw = "packet length"
+		case fs.ComponentTypeDSCP:
+			kw, limit = "dscp", 0x3f
+		case fs.ComponentTypeTCPFlags:
+			m, err := tcpFlag(c)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, m)
+			continue
+		case fs.ComponentTypeFragment:
+			m, err := fragmentType(c)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, m)
+			continue
+		default:
+			return nil, fmt.Errorf("%w: %s", ErrUnsupportedComponent, c.Type)
+		}
+		v, err := valueList(c, limit)
+		if err != nil {
+			return nil, err
+		}
+		if v != "" {
+			out = append(out, "match "+kw+" "+v)
+		}
+	}
+	return out, nil
+}
+
+func tcpFlag(c fs.FSComponent) (string, error) {
+	ops, err := fs.ParseBitmaskOps(c.Raw)
+	if err != nil {
+		return "", err
+	}
+	if len(ops) != 1 || ops[0].Not || ops[0].Value > 0xff {
+		return "", fmt.Errorf("%w: tcp flags other than one positive operator", ErrUnsupportedComponent)
+	}
+	if ops[0].Match {
+		return fmt.Sprintf("match tcp-flag 0x%02x match-all", ops[0].Value), nil
+	}
+	return fmt.Sprintf("match tcp-flag 0x%02x match-any", ops[0].Value), nil
+}
+
+func fragmentType(c fs.FSComponent) (string, error) {
+	ops, err := fs.ParseBitmaskOps(c.Raw)
+	if err != nil {
+		return "", err
+	}
+	var names []string
+	for i, op := range ops {
+		if (i > 0 && op.And) || op.Not || op.Value == 0 || op.Value > 0x0f || (op.Match && op.Value&(op.Value-1) != 0) {
+			return "", fmt.Errorf("%w: fragment operators other than OR-ed bits", ErrUnsupportedComponent)
+		}
+		for bit, n := range fragmentNames {
+			if op.Value&(1<<bit) != 0 {
+				names = append(names, n)
+			}
+		}
+	}
+	return "match fragment-type " + strings.Join(names, " "), nil
+}
+
+func compileActions(acts []actions.Action) ([]string, error) {
+	var out []string
+	for _, a := range acts {
+		if actions.IsDiscard(a) {
+			return []string{"drop"}, nil
+		}
+		switch v := a.(type) {
+		case actions.TrafficRateBytes:
+			out = append(out, fmt.Sprintf("police rate %d bps", uint64(v.Rate)*8))
+		case actions.TrafficRatePackets:
+			out = append(out, fmt.Sprintf("police rate %d pps", uint64(v.Rate)))
+		case actions.Redirect:
+			out = append(out, "redirect nexthop route-target "+strings.TrimPrefix(v.String(), "redirect "))
+		case actions.TrafficMarking:
+			out = append(out, fmt.Sprintf("set dscp %d", v.DSCP&0x3f))
+		case actions.TrafficAction:
+			if v.Terminal {
+				return nil, fmt.Errorf("%w: %s", ErrUnsupportedAction, a)
+			}
+		default:
+			return nil, fmt.Errorf("%w: %s", ErrUnsupportedAction, a)
+		}
+	}
+	if len(out) == 0 {
+		out = []string{"transmit"}
+	}
+	return out, nil
+}
@@ -0,0 +1,101 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package iosxr
+
+import (
+	"errors"
+	"testing"
+
+	"floofspectools/flowspecinternal/actions"
+)
+
+func rules(t *testing.T, ss ...string) []actions.Rule {
+	t.Helper()
+	var out []actions.Rule
+	for _, s := range ss {
+		list, acts, err := actions.ParseRule(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, actions.Rule{Components: list, Actions: acts})
+	}
+	return out
+}
+
+func TestConfig(t *testing.T) {
+	got, err := Config(rules(t,
+		"dst 192.0.2.0/24 proto tcp dport >=1024&<=2048,=80 tcp-flags syn then discard",
+		"dst 2001:db8::/32 frag isf,ff then rate-limit 1000 mark 10",
+		"src 198.51.100.0/24 then redirect 65500:100",
+	), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `class-map type traffic match-all flowspec-1
+ match destination-address ipv4 192.0.2.0 255.255.255.0
+ match protocol 6
+ match destination-port 80 1024-2048
+ match tcp-flag 0x02 match-any
+ end-class-map
+!
+class-map type traffic match-all flowspec-2
+ match destination-address ipv6 2001:db8::/32
+ match fragment-type is-fragment first-fragment
+ end-class-map
+!
+class-map type traffic match-all flowspec-3
+ match source-address ipv4 198.51.100.0 255.255.255.0
+ end-class-map
+!
+policy-map type pbr flowspec-v4
+ class type traffic flowspec-1
+  drop
+ !
+ class type traffic flowspec-3
+  redirect nexthop route-target 65500:100
+ !
+ class type traffic class-default
+ !
+ end-policy-map
+!
+policy-map type pbr flowspec-v6
+ class type traffic flowspec-2
+  police rate 8000 bps
+  set dscp 10
+ !
+ class type traffic class-default
+ !
+ end-policy-map
+!
+flowspec
+ address-family ipv4
+  service-policy type pbr flowspec-v4
+ !
+ address-family ipv6
+  service-policy type pbr flowspec-v6
+ !
+!
+`
+	if got != want {
+		t.Errorf("Config() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestConfigErrors(t *testing.T) {
+	tests := []struct {
+		rule string
+		want error
+	}{
+		{rule: "dst 192.0.2.0/24 tcp-flags syn&!ack", want: ErrUnsupportedComponent},
+		{rule: "dst 192.0.2.0/24 frag !isf", want: ErrUnsupportedComponent},
+		{rule: "dst 192.0.2.0/24 then terminal", want: ErrUnsupportedAction},
+		{rule: "dst 192.0.2.0/24 src 2001:db8::/32", want: ErrMixedFamilies},
+	}
+	for _, tt := range tests {
+		if _, err := Config(rules(t, tt.rule), nil); !errors.Is(err, tt.want) {
+			t.Errorf("Config(%q) error = %v, want %v", tt.rule, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,362 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+// Package junos renders FlowSpec rules as Junos firewall filter terms, for
+// change review and for offline installation on routers that do not peer
+// with the controller.
+//
+// Each rule becomes one term of a filter per address family, in rule order,
+// followed by an accepting default term. Numeric operators become value and
+// range lists and TCP flag operators boolean tcp-flags expressions, so no
+// rule needs expanding. Non-zero rate limits reference policers defined in
+// the same firewall stanza.
+package junos
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/actions"
+)
+
+var (
+	ErrUnsupportedComponent = errors.New("junos: component cannot be expressed as firewall filter match")
+	ErrUnsupportedAction    = errors.New("junos: action cannot be expressed as firewall filter action")
+	ErrEmptyMatch           = fs.ErrEmptyMatch
+	ErrMixedFamilies        = fs.ErrMixedFamilies
+	ErrUnknownInstance      = errors.New("junos: no routing instance configured for redirect route target")
+)
+
+// Options configures the generated filters.
+type Options struct {
+	// Name is the filter name, defaulting to "flowspec". Terms are named
+	// Name-1, Name-2, ... in rule order.
+	Name string
+	// Instances maps redirect route targets, as in "65500:100" or
+	// "192.0.2.1:100", to routing instance names.
+	Instances map[string]string
+	// IPv6 selects family inet6 for rules that carry no prefix component.
+	IPv6 bool
+}
+
+var tcpFlagNames = [...]string{"fin", "syn", "rst", "push", "ack", "urgent"}
+
+// Filter renders rules as a "firewall { ... }" stanza.
+func Filter(rules []actions.Rule, opts *Options) (string, error) {
+	o := Options{Name: "flowspec"}
+	if opts != nil {
+		o.Instances, o.IPv6 = opts.Instances, opts.IPv6
+		if opts.Name != "" {
+			o.Name = opts.Name
+		}
+	}
+	var (
+		terms    [2][]string
+		policers []string
+		seen     = map[string]bool{}
+	)
+	for i, r := range rules {
+		ipv6, err := fs.AddressFamily(r.Components, o.IPv6)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", r.Components, err)
+		}
+		from, err := compileFrom(r.Components, ipv6)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", r.Components, err)
+		}
+		then, pol, err := compileThen(r.Actions, o)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", r.Components, err)
+		}
+		if pol != "" && !seen[pol] {
+			seen[pol] = true
+			policers = append(policers, pol)
+		}
+		var b strings.Builder
+		fmt.Fprintf(&b, "term %s-%d {\n", o.Name, i+1)
+		if len(from) > 0 {
+			b.WriteString("    from {\n")
+			for _, l := range from {
+				b.WriteString("        " + l + ";\n")
+			}
+			b.WriteString("    }\n")
+		}
+		b.WriteString("    then {\n")
+		for _, l := range then {
+			b.WriteString("        " + l + ";\n")
+		}
+		b.WriteString("    }\n}\n")
+		f := 0
+		if ipv6 {
+			f = 1
+		}
+		terms[f] = append(terms[f], b.String())
+	}
+
+	var b strings.Builder
+	b.WriteString("firewall {\n")
+	for _, p := range policers {
+		b.WriteString(indent(p, 1))
+	}
+	for f, family := range []string{"inet", "inet6"} {
+		if len(terms[f]) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "    family %s {\n        filter %s {\n", family, o.Name)
+		for _, t := range terms[f] {
+			b.WriteString(indent(t, 3))
+		}
+		b.WriteString(indent("term default {\n    then accept;\n}\n", 3))
+		b.WriteString("        }\n    }\n")
+	}
+	b.WriteString("}\n")
+	return b.String(), nil
+}
+
+func indent(s string, depth int) string {
+	pad := strings.Repeat("    ", depth)
+	lines := strings.SplitAfter(s, "\n")
+	for i, l := range lines {
+		if l != "" {
+			lines[i] = pad + l
+		}
+	}
+	return strings.Join(lines, "")
+}
+
+// valueList renders the values c matches as "[ 80 1024-2048 ]", or "" if
+// it matches every value.
+func valueList(c fs.FSComponent, max uint64) (string, error) {
+	ranges, err := fs.ComponentRanges(c, max)
+	if err != nil || fs.MatchesAll(ranges, max) {
+		return "", err
+	}
+	var items []string
+	for _, r := range ranges {
+		if r.From == r.To {
+			items = append(items, strconv.FormatUint(r.From, 10))
+		} else {
+			items = append(items, fmt.Sprintf("%d-%d", r.From, r.To))
+		}
+	}
+	if len(items) == 1 {
+		return items[0], nil
+	}
+	return "[ " + strings.Join(items, " ") + " ]", nil
+}
+
+func compileFrom(list fs.FSComponentList, ipv6 bool) ([]string, error) {
+	var from []string
+	for _, c := range list.Components {
+		var (
+			kw    string
+			limit uint64 = 0xffff
+		)
+		switch c.Type {
+		case fs.ComponentTypeDestinationPrefix:
+			from = append(from, "destination-address "+c.Prefix.Masked().String())
+			continue
+		case fs.ComponentTypeSourcePrefix:
+			from = append(from, "source-address "+c.Prefix.Masked().String())
+			continue
+		case fs.ComponentTypeIpProtocol:
+			kw, limit = "protocol", 0xff
+			if ipv6 {
+				kw = "next-header"
+			}
+		case fs.ComponentTypePort:
+			kw = "port"
+		case fs.ComponentTypeDestinationPort:
+			kw = "destination-port"
+		case fs.ComponentTypeSourcePort:
+			kw = "source-port"
+		case fs.ComponentTypeICMPType:
+			kw, limit = "icmp-type", 0xff
+		case fs.ComponentTypeICMPCode:
+			kw, limit = "icmp-code", 0xff
+		case fs.ComponentTypePacketLength:
+			kw = "packet-length"
+		case fs.ComponentTypeDSCP:
+			kw, limit = "dscp", 0x3f
+			if ipv6 {
+				kw = "traffic-class"
+			}
+		case fs.ComponentTypeTCPFlags:
+			expr, err := tcpFlags(c)
+			if err != nil {
+				return nil, err
+			}
+			from = append(from, "tcp-flags "+strconv.Quote(expr))
+			continue
+		case fs.ComponentTypeFragment:
+			f, err := fragment(c, ipv6)
+			if err != nil {
+				return nil, err
+			}
+			from = append(from, f...)
+			continue
+		default:
+			return nil, fmt.Errorf("%w: %s", ErrUnsupportedComponent, c.Type)
+		}
+		v, err := valueList(c, limit)
+		if err != nil {
+			return nil, err
+		}
+		if v != "" {
+			from = append(from, kw+" "+v)
+		}
+	}
+	return from, nil
+}
+
+// tcpFlags renders the operators as a tcp-flags expression of flag names,
+// with "&" binding AND-ed terms and "|" the OR-ed groups.
+func tcpFlags(c fs.FSComponent) (string, error) {
+	ops, err := fs.ParseBitmaskOps(c.Raw)
+	if err != nil {
+		return "", err
+	}
+	var groups, group []string
+	for i, op := range ops {
+		if i > 0 && !op.And {
+			groups, group = append(groups, strings.Join(group, " & ")), nil
+		}
+		var names []string
+		for bit, n := range tcpFlagNames {
+			if op.Value&(1<<bit) != 0 {
+				if op.Not {
+					n = "!" + n
+				}
+				names = append(names, n)
+			}
+		}
+		if len(names) == 0 || op.Value >= 1<<len(tcpFlagNames) {
+			return "", fmt.Errorf("%w: tcp flags 0x%x", ErrUnsupportedComponent, op.Value)
+		}
+		// all bits set, or with Not none set, AND the names; any bit set,
+		// or with Not not all set, OR them
+		if op.Match != op.Not || len(names) == 1 {
+			group = append(group, strings.Join(names, " & "))
+		} else {
+			group = append(group, "("+strings.Join(names, " | ")+")")
+		}
+	}
+	groups = append(groups, strings.Join(group, " & "))
+	if len(groups) == 1 {
+		return groups[0], nil
+	}
+	for i, g := range groups {
+		if strings.Contains(g, "&") {
+			groups[i] = "(" + g + ")"
+		}
+	}
+	return strings.Join(groups, " | "), nil
+}
+
+// fragment supports AND-ed single-bit terms, which map onto the IPv4
+// fragment conditions; inet6 only knows is-fragment.
+func fragment(c fs.FSComponent, ipv6 bool) ([]string, error) {
+	ops, err := fs.ParseBitmaskOps(c.Raw)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		from  []string
+		flags []string
+	)
+	for i, op := range ops {
+		if (i > 0 && !op.And) || op.Value&(op.Value-1) != 0 {
+			return nil, fmt.Errorf("%w: fragment operators other than single AND-ed bits", ErrUnsupportedComponent)
+		}
+		switch {
+		case op.Value == 0x02 && !op.Not:
+			from = append(from, "is-fragment")
+		case ipv6:
+			return nil, fmt.Errorf("%w: inet6 fragment bits 0x%x", ErrUnsupportedComponent, op.Value)
+		case op.Value == 0x01 && op.Not:
+			flags = append(flags, "!dont-fragment")
+		case op.Value == 0x01:
+			flags = append(flags, "dont-fragment")
+		case op.Value == 0x02:
+			from = append(from, "fragment-offset 0")
+			flags = append(flags, "!more-fragments")
+		case op.Value == 0x04 && !op.Not:
+			from = append(from, "first-fragment")
+		default:
+			return nil, fmt.Errorf("%w: fragment bits 0x%x", ErrUnsupportedComponent, op.Value)
+		}
+	}
+	if len(flags) > 0 {
+		from = append(from, "fragment-flags "+strconv.Quote(strings.Join(flags, " & ")))
+	}
+	return from, nil
+}
+
+// compileThen maps acts onto filter actions, returning the definition of
+// the policer a rate limit references.
+func compileThen(acts []actions.Action, o Options) ([]string, string, error) {
+	var (
+		then      []string
+		policer   string
+		redirect  string
+		discard   bool
+		continues bool
+	)
+	for _, a := range acts {
+		switch v := a.(type) {
+		case actions.TrafficRateBytes:
+			if v.Rate == 0 {
+				discard = true
+				continue
+			}
+			bps := uint64(v.Rate) * 8
+			name := fmt.Sprintf("%s-%dbps", o.Name, bps)
+			policer = fmt.Sprintf("policer %s {\n    if-exceeding {\n        bandwidth-limit %d;\n        burst-size-limit %d;\n    }\n    then discard;\n}\n",
+				name, bps, max(uint64(v.Rate)/10, 1500))
+			then = append(then, "policer "+name)
+		case actions.TrafficRatePackets:
+			if v.Rate == 0 {
+				discard = true
+				continue
+			}
+			pps := uint64(v.Rate)
+			name := fmt.Sprintf("%s-%dpps", o.Name, pps)
+			policer = fmt.Sprintf("policer %s {\n    if-exceeding-pps {\n        pps-limit %d;\n        packet-burst %d;\n    }\n    then discard;\n}\n",
+				name, pps, max(pps/10, 1))
+			then = append(then, "policer "+name)
+		case actions.Redirect:
+			rt := strings.TrimPrefix(v.String(), "redirect ")
+			ri, ok := o.Instances[rt]
+			if !ok {
+				return nil, "", fmt.Errorf("%w: %s", ErrUnknownInstance, rt)
+			}
+			redirect = "routing-instance " + ri
+		case actions.TrafficMarking:
+			then = append(then, fmt.Sprintf("dscp %d", v.DSCP&0x3f))
+		case actions.TrafficAction:
+			if v.Sample {
+				then = append(then, "sample")
+			}
+			continues = v.Terminal
+		default:
+			return nil, "", fmt.Errorf("%w: %s", ErrUnsupportedAction, a)
+		}
+	}
+	if discard {
+		return []string{"discard"}, "", nil
+	}
+	switch {
+	case redirect != "":
+		// a routing instance ends evaluation whatever the terminal bit says
+		then = append(then, redirect)
+	case continues:
+		then = append(then, "next term")
+	default:
+		then = append(then, "accept")
+	}
+	return then, policer, nil
+}
@@ -0,0 +1,114 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package junos
+
+import (
+	"errors"
+	"testing"
+
+	"floofspectools/flowspecinternal/actions"
+)
+
+func rules(t *testing.T, ss ...string) []actions.Rule {
+	t.Helper()
+	var out []actions.Rule
+	for _, s := range ss {
+		list, acts, err := actions.ParseRule(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, actions.Rule{Components: list, Actions: acts})
+	}
+	return out
+}
+
+func TestFilter(t *testing.T) {
+	got, err := Filter(rules(t,
+		"dst 192.0.2.0/24 proto tcp dport >=1024&<=2048,=80 tcp-flags =syn|ack,!rst then discard",
+		"src 198.51.100.0/24 frag !isf then rate-limit 9600 mark 10",
+		"dst 2001:db8::/32 proto udp dscp =46 then redirect 65500:100",
+	), &Options{Instances: map[string]string{"65500:100": "scrub"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `firewall {
+    policer flowspec-76800bps {
+        if-exceeding {
+            bandwidth-limit 76800;
+            burst-size-limit 1500;
+        }
+        then discard;
+    }
+    family inet {
+        filter flowspec {
+            term flowspec-1 {
+                from {
+                    destination-address 192.0.2.0/24;
+                    protocol 6;
+                    destination-port [ 80 1024-2048 ];
+                    tcp-flags "(syn & ack) | !rst";
+                }
+                then {
+                    discard;
+                }
+            }
+            term flowspec-2 {
+                from {
+                    source-address 198.51.100.0/24;
+                    fragment-offset 0;
+                    fragment-flags "!more-fragments";
+                }
+                then {
+                    policer flowspec-76800bps;
+                    dscp 10;
+                    accept;
+                }
+            }
+            term default {
+                then accept;
+            }
+        }
+    }
+    family inet6 {
+        filter flowspec {
+            term flowspec-3 {
+                from {
+                    destination-address 2001:db8::/32;
+                    next-header 17;
+                    traffic-class 46;
+                }
+                then {
+                    routing-instance scrub;
+                }
+            }
+            term default {
+                then accept;
+            }
+        }
+    }
+}
+`
+	if got != want {
+		t.Errorf("Filter() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestFilterErrors(t *testing.T) {
+	tests := []struct {
+		rule string
+		want error
+	}{
+		{rule: "dst 192.0.2.0/24 then redirect 65500:200", want: ErrUnknownInstance},
+		{rule: "dst 192.0.2.0/24 tcp-flags ece", want: ErrUnsupportedComponent},
+		{rule: "dst 192.0.2.0/24 frag lf", want: ErrUnsupportedComponent},
+		{rule: "dst 2001:db8::/32 frag df", want: ErrUnsupportedComponent},
+		{rule: "dst 192.0.2.0/24 src 2001:db8::/32", want: ErrMixedFamilies},
+	}
+	for _, tt := range tests {
+		if _, err := Filter(rules(t, tt.rule), nil); !errors.Is(err, tt.want) {
+			t.Errorf("Filter(%q) error = %v, want %v", tt.rule, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,316 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+// Package routeserver models a transparent FlowSpec route server (RFC7947)
+// redistributing the rules of its clients, e.g. at an IXP.
+//
+// Routes received from a client pass its import policy and are kept in the
+// server's Adj-RIB-In. A route server computes a unicast best path per
+// client, so the feasibility of a rule differs between clients: following
+// RFC9117 4.2, rule b) and the left-most AS check are applied against each
+// client's own unicast view, the route server not prepending its AS. A
+// rule is exported to a client if its export filter passes and it is
+// feasible in that client's view; the result is the client's RIB-out, a
+// rib.FlowSpecRIB publishing its changes on the client's event bus.
+package routeserver
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/netip"
+	"slices"
+	"sync"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/events"
+	"floofspectools/flowspecinternal/rib"
+)
+
+var (
+	ErrInvalidClient   = errors.New("routeserver: client needs an address, an AS and a unicast view")
+	ErrDuplicateClient = errors.New("routeserver: client already configured")
+	ErrUnknownClient   = errors.New("routeserver: unknown client")
+)
+
+// Client configures one route server client. It must not be modified once
+// added.
+type Client struct {
+	// Addr identifies the client.
+	Addr netip.Addr
+	AS   uint32
+	// Import, if set, is the policy routes received from the client must
+	// pass; its Config is not used, feasibility is decided per receiving
+	// client.
+	Import *fs.PeerPolicy
+	// Export, if set, filters the routes exported to the client.
+	Export func(r *fs.FlowSpecRoute) bool
+	// Unicast is the client's unicast view, the best paths the route
+	// server computed for it, against which the rules exported to it are
+	// validated.
+	Unicast fs.UnicastRIB
+	// Validation configures the feasibility check of exported rules,
+	// defaulting to that of fs.ValidateFeasibility.
+	Validation *fs.Config
+	// Events, if set, receives the changes of the client's RIB-out:
+	// RuleAccepted for exported rules and RuleWithdrawn for removed ones.
+	Events *events.Bus
+}
+
+type client struct {
+	*Client
+	out   *rib.FlowSpecRIB
+	rules int // routes held in the Adj-RIB-In
+}
+
+// Options configures a Server.
+type Options struct {
+	// Events, if set, receives the import results: RuleAccepted and
+	// RuleRejected for announced routes, RuleWithdrawn for withdrawn ones.
+	Events *events.Bus
+	// Logger, if set, receives rejected routes and client changes.
+	Logger *slog.Logger
+}
+
+// Server is a route server. Its methods are safe for concurrent use.
+type Server struct {
+	bus    *events.Bus
+	logger *slog.Logger
+	log    *slog.Logger
+
+	mu      sync.Mutex
+	clients map[netip.Addr]*client
+	// adjIn holds the accepted routes by rib.FlowSpecKey and client.
+	adjIn map[string]map[netip.Addr]*fs.FlowSpecRoute
+}
+
+// New returns a Server without clients.
+func New(opts *Options) *Server {
+	var o Options
+	if opts != nil {
+		o = *opts
+	}
+	return &Server{
+		bus:     o.Events,
+		logger:  o.Logger,
+		log:     fs.SubsystemLogger(o.Logger, fs.SubsystemRouteServer),
+		clients: map[netip.Addr]*client{},
+		adjIn:   map[string]map[netip.Addr]*fs.FlowSpecRoute{},
+	}
+}
+
+// AddClient adds c and exports the rules of the other clients to it.
+func (s *Server) AddClient(c *Client) error {
+	if !c.Addr.IsValid() || c.AS == 0 || c.Unicast == nil {
+		return ErrInvalidClient
+	}
+	addr := c.Addr.Unmap()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.clients[addr]; ok {
+		return fmt.Errorf("%w: %s", ErrDuplicateClient, addr)
+	}
+	cc := *c
+	cc.Addr = addr
+	cl := &client{
+		Client: &cc,
+		out:    rib.NewFlowSpecRIB(&rib.FlowSpecOptions{Events: c.Events, Logger: s.logger}),
+	}
+	s.clients[addr] = cl
+	s.export(cl, s.allKeys())
+	s.log.Info("client added", "client", addr.String(), fs.LogKeyPeer, c.AS)
+	return nil
+}
+
+// RemoveClient withdraws the routes of the client at addr from the others
+// and removes it.
+func (s *Server) RemoveClient(addr netip.Addr) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, err := s.client(addr)
+	if err != nil {
+		return err
+	}
+	keys := map[string]*fs.FlowSpecRoute{}
+	for key, paths := range s.adjIn {
+		if r, ok := paths[c.Addr]; ok {
+			keys[key] = r
+			s.removePath(key, c)
+		}
+	}
+	delete(s.clients, c.Addr)
+	for _, o := range s.clients {
+		s.export(o, keys)
+	}
+	s.log.Info("client removed", "client", c.Addr.String(), fs.LogKeyPeer, c.AS, "routes", len(keys))
+	return nil
+}
+
+func (s *Server) client(addr netip.Addr) (*client, error) {
+	c, ok := s.clients[addr.Unmap()]
+	if !ok {
+		return nil, fmt.Errorf("%w %s", ErrUnknownClient, addr)
+	}
+	return c, nil
+}
+
+// Announce imports r received from the client at addr, replacing its
+// previous route with the same rib.FlowSpecKey, and updates the RIB-out of
+// the other clients. A route failing the import policy withdraws the
+// previous one and its error is returned.
+func (s *Server) Announce(addr netip.Addr, r *fs.FlowSpecRoute) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, err := s.client(addr)
+	if err != nil {
+		return err
+	}
+	route := *r
+	route.FromEBGP, route.NeighborAS = true, c.AS
+	key := rib.FlowSpecKey(&route)
+	_, replace := s.adjIn[key][c.Addr]
+	if c.Import != nil {
+		err = c.Import.Check(&route)
+		if err == nil && !replace {
+			err = c.Import.CheckRuleCount(c.rules)
+		}
+	}
+	if err != nil {
+		s.bus.Publish(events.Event{Kind: events.RuleRejected, Route: &route, Err: err})
+		s.log.Info("flowspec route rejected by import policy", "client", c.Addr.String(), fs.LogKeyPeer, c.AS,
+			fs.LogKeyRule, route.Components.Canonical(nil), "error", err)
+		if replace {
+			s.removePath(key, c)
+			s.propagate(key, &route)
+		}
+		return err
+	}
+	if s.adjIn[key] == nil {
+		s.adjIn[key] = map[netip.Addr]*fs.FlowSpecRoute{}
+	}
+	if !replace {
+		c.rules++
+	}
+	s.adjIn[key][c.Addr] = &route
+	s.bus.Publish(events.Event{Kind: events.RuleAccepted, Route: &route})
+	s.propagate(key, &route)
+	return nil
+}
+
+// Withdraw removes the route with the same rib.FlowSpecKey as r received
+// from the client at addr and reports whether it existed.
+func (s *Server) Withdraw(addr netip.Addr, r *fs.FlowSpecRoute) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, err := s.client(addr)
+	if err != nil {
+		return false, err
+	}
+	key := rib.FlowSpecKey(r)
+	old, ok := s.adjIn[key][c.Addr]
+	if !ok {
+		return false, nil
+	}
+	s.removePath(key, c)
+	s.bus.Publish(events.Event{Kind: events.RuleWithdrawn, Route: old})
+	s.propagate(key, old)
+	return true, nil
+}
+
+// Revalidate recomputes the RIB-out of the client at addr, e.g. after its
+// unicast view changed.
+func (s *Server) Revalidate(addr netip.Addr) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, err := s.client(addr)
+	if err != nil {
+		return err
+	}
+	s.export(c, s.allKeys())
+	return nil
+}
+
+// RIBOut returns the current RIB-out of the client at addr.
+func (s *Server) RIBOut(addr netip.Addr) (*rib.FlowSpecSnapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, err := s.client(addr)
+	if err != nil {
+		return nil, err
+	}
+	return c.out.Snapshot(), nil
+}
+
+func (s *Server) removePath(key string, c *client) {
+	delete(s.adjIn[key], c.Addr)
+	if len(s.adjIn[key]) == 0 {
+		delete(s.adjIn, key)
+	}
+	c.rules--
+}
+
+// allKeys returns every key of the Adj-RIB-In with one of its routes.
+func (s *Server) allKeys() map[string]*fs.FlowSpecRoute {
+	keys := make(map[string]*fs.FlowSpecRoute, len(s.adjIn))
+	for key, paths := range s.adjIn {
+		for _, r := range paths {
+			keys[key] = r
+			break
+		}
+	}
+	return keys
+}
+
+// propagate updates the RIB-out of every client for key, of which r is a
+// route.
+func (s *Server) propagate(key string, r *fs.FlowSpecRoute) {
+	keys := map[string]*fs.FlowSpecRoute{key: r}
+	for _, c := range s.clients {
+		s.export(c, keys)
+	}
+}
+
+// export brings the RIB-out of c up to date for keys, each given with one
+// of its routes, in one snapshot.
+func (s *Server) export(c *client, keys map[string]*fs.FlowSpecRoute) {
+	snap := c.out.Snapshot()
+	c.out.Apply(func(tx *rib.FlowSpecTx) {
+		for key, r := range keys {
+			best := s.best(c, key)
+			cur, ok := snap.Get(r)
+			switch {
+			case best == nil && ok:
+				tx.Delete(r)
+			case best != nil && (!ok || cur.Route != best):
+				tx.Insert(best, nil)
+			}
+		}
+	})
+}
+
+// best returns the route for key exported to c: of the routes of the other
+// clients that pass its export filter and are feasible in its unicast view,
+// the one of the lowest client address. Routes carrying
+// fs.CommunityLLGRStale are least preferred (RFC9494 4.3).
+func (s *Server) best(c *client, key string) *fs.FlowSpecRoute {
+	paths := s.adjIn[key]
+	var stale *fs.FlowSpecRoute
+	for _, addr := range slices.SortedFunc(maps.Keys(paths), netip.Addr.Compare) {
+		r := paths[addr]
+		if addr == c.Addr || (c.Export != nil && !c.Export(r)) {
+			continue
+		}
+		if r.HasCommunity(fs.CommunityLLGRStale) {
+			if stale == nil && fs.ValidateFeasibility(r, c.Unicast, c.Validation) == nil {
+				stale = r
+			}
+			continue
+		}
+		if fs.ValidateFeasibility(r, c.Unicast, c.Validation) == nil {
+			return r
+		}
+	}
+	return stale
+}
@@ -0,0 +1,198 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package routeserver
+
+import (
+	"errors"
+	"net/netip"
+	"slices"
+	"testing"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/events"
+	"floofspectools/flowspecinternal/rib"
+)
+
+var (
+	addrA = netip.MustParseAddr("192.0.2.1")
+	addrB = netip.MustParseAddr("192.0.2.2")
+	addrC = netip.MustParseAddr("192.0.2.3")
+	dst   = netip.MustParsePrefix("203.0.113.0/24")
+)
+
+// viaA is the unicast route to dst announced by client A.
+var viaA = &fs.UnicastRoute{Prefix: dst, NeighborAS: 64501, ASPath: []uint32{64501}, OriginatorID: netip.AddrFrom4([4]byte{10, 0, 0, 1})}
+
+func flowRoute() *fs.FlowSpecRoute {
+	p := dst
+	l := fs.FSComponentList{Components: []fs.FSComponent{{Type: fs.ComponentTypeDestinationPrefix, Prefix: &p}}}
+	return &fs.FlowSpecRoute{
+		AFI: fs.AFIIPv4, SAFI: fs.SAFIFlowSpec, Components: l, DestPrefix: &p,
+		ASPath: []uint32{64501}, OriginatorID: netip.AddrFrom4([4]byte{10, 0, 0, 1}),
+	}
+}
+
+func kinds(b *events.Bus) *[]events.Kind {
+	var k []events.Kind
+	b.Subscribe(func(e events.Event) { k = append(k, e.Kind) })
+	return &k
+}
+
+func ribOutLen(t *testing.T, s *Server, addr netip.Addr) int {
+	t.Helper()
+	snap, err := s.RIBOut(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return snap.Len()
+}
+
+func TestServer(t *testing.T) {
+	imports := events.NewBus()
+	importKinds := kinds(imports)
+	s := New(&Options{Events: imports})
+
+	viewB, viewC := rib.NewTrie(), rib.NewTrie()
+	viewB.Insert(viaA)
+	// C's best path to dst is through another neighbor
+	viewC.Insert(&fs.UnicastRoute{Prefix: dst, NeighborAS: 64599, ASPath: []uint32{64599}, OriginatorID: netip.AddrFrom4([4]byte{10, 0, 0, 9})})
+	busB, busC := events.NewBus(), events.NewBus()
+	kindsB, kindsC := kinds(busB), kinds(busC)
+
+	for _, c := range []*Client{
+		{Addr: addrA, AS: 64501, Unicast: rib.NewTrie(), Import: &fs.PeerPolicy{AllowedActions: []fs.ActionRule{{Action: fs.ActionDiscard}}}},
+		{Addr: addrB, AS: 64502, Unicast: viewB, Events: busB},
+		{Addr: addrC, AS: 64503, Unicast: viewC, Events: busC},
+	} {
+		if err := s.AddClient(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.AddClient(&Client{Addr: addrA, AS: 64501, Unicast: rib.NewTrie()}); !errors.Is(err, ErrDuplicateClient) {
+		t.Errorf("AddClient(duplicate) = %v, want %v", err, ErrDuplicateClient)
+	}
+	if err := s.AddClient(&Client{Addr: netip.MustParseAddr("192.0.2.9")}); !errors.Is(err, ErrInvalidClient) {
+		t.Errorf("AddClient(no AS) = %v, want %v", err, ErrInvalidClient)
+	}
+	if err := s.Announce(netip.MustParseAddr("192.0.2.9"), flowRoute()); !errors.Is(err, ErrUnknownClient) {
+		t.Errorf("Announce(unknown) = %v, want %v", err, ErrUnknownClient)
+	}
+
+	// exported to B only: C's view makes it infeasible, A announced it
+	if err := s.Announce(addrA, flowRoute()); err != nil {
+		t.Fatal(err)
+	}
+	if got := []int{ribOutLen(t, s, addrA), ribOutLen(t, s, addrB), ribOutLen(t, s, addrC)}; !slices.Equal(got, []int{0, 1, 0}) {
+		t.Errorf("RIB-out sizes = %v, want [0 1 0]", got)
+	}
+
+	// C's view now has A's path
+	viewC.Insert(viaA)
+	if err := s.Revalidate(addrC); err != nil {
+		t.Fatal(err)
+	}
+	if n := ribOutLen(t, s, addrC); n != 1 {
+		t.Errorf("RIB-out of C after Revalidate() has %d routes, want 1", n)
+	}
+
+	// A re-announcement failing the import policy withdraws the route
+	redirect := flowRoute()
+	redirect.ExtCommunities = [][8]byte{{0x80, 0x08, 0xfb, 0xf5, 0, 0, 0, 1}}
+	if err := s.Announce(addrA, redirect); !errors.Is(err, fs.ErrActionNotAllowed) {
+		t.Errorf("Announce() = %v, want %v", err, fs.ErrActionNotAllowed)
+	}
+	if n := ribOutLen(t, s, addrB); n != 0 {
+		t.Errorf("RIB-out of B after rejected re-announcement has %d routes", n)
+	}
+	if err := s.Announce(addrA, flowRoute()); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := s.Withdraw(addrA, flowRoute()); !ok || err != nil {
+		t.Errorf("Withdraw() = %v, %v", ok, err)
+	}
+	if n := ribOutLen(t, s, addrB); n != 0 {
+		t.Errorf("RIB-out of B after Withdraw() has %d routes", n)
+	}
+
+	if err := s.Announce(addrA, flowRoute()); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RemoveClient(addrA); err != nil {
+		t.Fatal(err)
+	}
+	if n := ribOutLen(t, s, addrB); n != 0 {
+		t.Errorf("RIB-out of B after RemoveClient() has %d routes", n)
+	}
+
+	wantImports := []events.Kind{events.RuleAccepted, events.RuleRejected, events.RuleAccepted, events.RuleWithdrawn, events.RuleAccepted}
+	if !slices.Equal(*importKinds, wantImports) {
+		t.Errorf("import events = %v, want %v", *importKinds, wantImports)
+	}
+	wantB := []events.Kind{events.RuleAccepted, events.RuleWithdrawn, events.RuleAccepted, events.RuleWithdrawn, events.RuleAccepted, events.RuleWithdrawn}
+	if !slices.Equal(*kindsB, wantB) {
+		t.Errorf("RIB-out events of B = %v, want %v", *kindsB, wantB)
+	}
+	wantC := []events.Kind{events.RuleAccepted, events.RuleWithdrawn, events.RuleAccepted, events.RuleWithdrawn, events.RuleAccepted, events.RuleWithdrawn}
+	if !slices.Equal(*kindsC, wantC) {
+		t.Errorf("RIB-out events of C = %v, want %v", *kindsC, wantC)
+	}
+}
+
+func TestServerExportFilter(t *testing.T) {
+	s := New(nil)
+	view := rib.NewTrie()
+	view.Insert(viaA)
+	for _, c := range []*Client{
+		{Addr: addrA, AS: 64501, Unicast: rib.NewTrie()},
+		{Addr: addrB, AS: 64502, Unicast: view, Export: func(*fs.FlowSpecRoute) bool { return false }},
+		{Addr: addrC, AS: 64503, Unicast: view},
+	} {
+		if err := s.AddClient(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Announce(addrA, flowRoute()); err != nil {
+		t.Fatal(err)
+	}
+	if got := []int{ribOutLen(t, s, addrB), ribOutLen(t, s, addrC)}; !slices.Equal(got, []int{0, 1}) {
+		t.Errorf("RIB-out sizes = %v, want [0 1]", got)
+	}
+}
+
+func TestServerLLGRStale(t *testing.T) {
+	s := New(nil)
+	view := rib.NewTrie()
+	view.Insert(viaA)
+	cfg := &fs.Config{LeftMostASExempt: []uint32{64501, 64502}, EnableEmptyOrConfed: true}
+	for _, c := range []*Client{
+		{Addr: addrA, AS: 64501, Unicast: view, Validation: cfg},
+		{Addr: addrB, AS: 64502, Unicast: view, Validation: cfg},
+		{Addr: addrC, AS: 64503, Unicast: view, Validation: cfg},
+	} {
+		if err := s.AddClient(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stale := flowRoute()
+	stale.Communities = []uint32{fs.CommunityLLGRStale}
+	if err := s.Announce(addrA, stale); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Announce(addrB, flowRoute()); err != nil {
+		t.Fatal(err)
+	}
+	snap, err := s.RIBOut(addrC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, ok := snap.Get(flowRoute())
+	if !ok || e.Route.NeighborAS != 64502 {
+		t.Fatalf("RIB-out of C = %v, want the route of B over the LLGR-stale one of A", e)
+	}
+	// B has no other choice
+	if got := ribOutLen(t, s, addrB); got != 1 {
+		t.Errorf("RIB-out of B = %d rules, want the LLGR-stale one", got)
+	}
+}
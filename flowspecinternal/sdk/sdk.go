@@ -0,0 +1,275 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+// Package sdk is a small, stable API for managing locally originated rules
+// declaratively, e.g. from a Terraform provider:
+//
+//	c := sdk.New(local, &sdk.Options{Validate: ...})
+//	r, err := c.CreateRule(ctx, sdk.RuleSpec{Match: "dst 192.0.2.0/24 proto udp", Actions: "discard"})
+//	// store r.ID in the resource state
+//	r, err = c.ReadRule(ctx, r.ID)
+//	r, err = c.UpdateRuleActions(ctx, r.ID, "rate-limit 10M")
+//	err = c.DeleteRule(ctx, r.ID)
+//
+// A rule's ID is its rib.FlowSpecKey: family and the canonical form of its
+// components, so the same match always has the same ID however it is
+// written. Every call is idempotent: creating an existing rule with the
+// same actions returns it, and deleting a missing rule succeeds. The match
+// of a rule never changes; a different match is a different rule.
+package sdk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/actions"
+	"floofspectools/flowspecinternal/rib"
+)
+
+var (
+	ErrNotFound = errors.New("sdk: no such rule")
+	// ErrExists is returned by CreateRule for a rule that exists with other
+	// actions; update or import it instead.
+	ErrExists = errors.New("sdk: rule exists with other actions")
+	ErrSpec   = errors.New("sdk: invalid rule spec")
+)
+
+// RuleSpec is the desired state of a rule.
+type RuleSpec struct {
+	// Match is the rule in the syntax of fs.ParseComponents.
+	Match string `json:"match"`
+	// Actions in the syntax of actions.ParseActions, empty to accept.
+	Actions string `json:"actions,omitempty"`
+	// IPv6 selects the family of a rule without prefix component; rules
+	// with an IPv6 prefix are IPv6 anyway.
+	IPv6 bool `json:"ipv6,omitempty"`
+	// TTL, if positive, withdraws the rule unless it is created again.
+	TTL time.Duration `json:"ttl,omitempty"`
+	// Metadata is the provenance of the rule, see fs.FlowSpecRoute.
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// Rule is the state of a rule.
+type Rule struct {
+	ID string `json:"id"`
+	// Match and Actions are canonical, see fs.FSComponentList.Canonical
+	// and actions.Canonical.
+	Match   string `json:"match"`
+	Actions string `json:"actions"`
+	IPv6    bool   `json:"ipv6,omitempty"`
+	// Feasible is false for a rule the controller holds but rejects, e.g.
+	// after a unicast route change; Reason and Error say why.
+	Feasible bool              `json:"feasible"`
+	Reason   string            `json:"reason,omitempty"`
+	Error    string            `json:"error,omitempty"`
+	Expires  time.Time         `json:"expires,omitzero"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// Options configures a Client.
+type Options struct {
+	// Validate checks rules before they are created, e.g.
+	// fs.ValidateFeasibility against the unicast RIB. Nil accepts every
+	// rule.
+	Validate func(*fs.FlowSpecRoute) error
+}
+
+// Client manages the rules of a FlowSpecRIB of locally originated rules.
+type Client struct {
+	local *rib.FlowSpecRIB
+	o     Options
+}
+
+// New returns a Client for local.
+func New(local *rib.FlowSpecRIB, opts *Options) *Client {
+	var o Options
+	if opts != nil {
+		o = *opts
+	}
+	return &Client{local: local, o: o}
+}
+
+// Route parses spec into the route CreateRule originates.
+func Route(spec RuleSpec) (*fs.FlowSpecRoute, error) {
+	list, err := fs.ParseComponents(spec.Match)
+	if err != nil {
+		return nil, fmt.Errorf("%w: match: %w", ErrSpec, err)
+	}
+	if len(list.Components) == 0 {
+		return nil, fmt.Errorf("%w: empty match", ErrSpec)
+	}
+	acts, err := actions.ParseActions(spec.Actions)
+	if err != nil {
+		return nil, fmt.Errorf("%w: actions: %w", ErrSpec, err)
+	}
+	route := &fs.FlowSpecRoute{AFI: fs.AFIIPv4, SAFI: fs.SAFIFlowSpec, Components: list, Metadata: spec.Metadata}
+	if spec.IPv6 {
+		route.AFI = fs.AFIIPv6
+	}
+	for _, c := range list.Components {
+		if c.Prefix == nil {
+			continue
+		}
+		if c.Prefix.Addr().Is6() {
+			route.AFI = fs.AFIIPv6
+		}
+		if c.Type == fs.ComponentTypeDestinationPrefix {
+			route.DestPrefix = c.Prefix
+		}
+	}
+	for _, a := range acts {
+		route.ExtCommunities = append(route.ExtCommunities, a.ExtendedCommunity())
+	}
+	return route, nil
+}
+
+// ID returns the ID of the rule spec describes.
+func ID(spec RuleSpec) (string, error) {
+	route, err := Route(spec)
+	if err != nil {
+		return "", err
+	}
+	return rib.FlowSpecKey(route), nil
+}
+
+// routeActions decodes the traffic actions of route, skipping other
+// extended communities.
+func routeActions(route *fs.FlowSpecRoute) []actions.Action {
+	var acts []actions.Action
+	for _, ec := range route.ExtCommunities {
+		if a, err := actions.Decode(ec); err == nil {
+			acts = append(acts, a)
+		}
+	}
+	return acts
+}
+
+func (c *Client) rule(e *rib.FlowSpecEntry) *Rule {
+	r := &Rule{
+		ID:       e.Key,
+		Match:    e.Route.Components.Canonical(nil),
+		Actions:  actions.Canonical(routeActions(e.Route)),
+		IPv6:     e.Route.AFI == fs.AFIIPv6,
+		Feasible: e.Err == nil,
+		Expires:  c.local.Expiry(e.Route),
+		Metadata: e.Route.Metadata,
+	}
+	if e.Err != nil {
+		r.Reason, r.Error = fs.Reason(e.Err), e.Err.Error()
+	}
+	return r
+}
+
+func (c *Client) lookup(id string) (*rib.FlowSpecEntry, error) {
+	for e := range c.local.Snapshot().All() {
+		if e.Key == id {
+			return e, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+}
+
+// originate validates and inserts route, setting its lifetime if lt is not
+// nil and keeping the one it has otherwise.
+func (c *Client) originate(route *fs.FlowSpecRoute, lt *rib.Lifetime) (*Rule, error) {
+	if c.o.Validate != nil {
+		if err := c.o.Validate(route); err != nil {
+			return nil, err
+		}
+	}
+	if lt != nil {
+		c.local.InsertWithLifetime(route, nil, *lt)
+	} else {
+		c.local.Insert(route, nil)
+	}
+	e, _ := c.local.Snapshot().Get(route)
+	return c.rule(e), nil
+}
+
+// CreateRule originates the rule of spec. If it exists with the same
+// actions it is returned, its lifetime and metadata set anew from spec;
+// with other actions CreateRule fails with ErrExists. A rule failing
+// Options.Validate is not created and its validation error returned.
+func (c *Client) CreateRule(ctx context.Context, spec RuleSpec) (*Rule, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	route, err := Route(spec)
+	if err != nil {
+		return nil, err
+	}
+	if e, ok := c.local.Snapshot().Get(route); ok {
+		if have, want := actions.Canonical(routeActions(e.Route)), actions.Canonical(routeActions(route)); have != want {
+			return nil, fmt.Errorf("%w: %s has %s", ErrExists, e.Key, have)
+		}
+	}
+	return c.originate(route, &rib.Lifetime{TTL: spec.TTL})
+}
+
+// ReadRule returns the rule of id, ErrNotFound if it is not originated,
+// e.g. withdrawn after its TTL.
+func (c *Client) ReadRule(ctx context.Context, id string) (*Rule, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	e, err := c.lookup(id)
+	if err != nil {
+		return nil, err
+	}
+	return c.rule(e), nil
+}
+
+// ListRules returns every originated rule in RFC8955 order.
+func (c *Client) ListRules(ctx context.Context) ([]*Rule, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var out []*Rule
+	for e := range c.local.Snapshot().All() {
+		out = append(out, c.rule(e))
+	}
+	return out, nil
+}
+
+// UpdateRuleActions replaces the actions of the rule of id, keeping other
+// extended communities, its metadata and its lifetime. The rule is validated again.
+func (c *Client) UpdateRuleActions(ctx context.Context, id string, acts string) (*Rule, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	parsed, err := actions.ParseActions(acts)
+	if err != nil {
+		return nil, fmt.Errorf("%w: actions: %w", ErrSpec, err)
+	}
+	e, err := c.lookup(id)
+	if err != nil {
+		return nil, err
+	}
+	route := *e.Route
+	route.ExtCommunities = nil
+	for _, ec := range e.Route.ExtCommunities {
+		if _, err := actions.Decode(ec); err != nil {
+			route.ExtCommunities = append(route.ExtCommunities, ec)
+		}
+	}
+	for _, a := range parsed {
+		route.ExtCommunities = append(route.ExtCommunities, a.ExtendedCommunity())
+	}
+	return c.originate(&route, nil)
+}
+
+// DeleteRule withdraws the rule of id; a rule that does not exist is not
+// an error.
+func (c *Client) DeleteRule(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if e, err := c.lookup(id); err == nil {
+		c.local.Delete(e.Route)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package sdk
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/rib"
+)
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0)
+	local := rib.NewFlowSpecRIB(&rib.FlowSpecOptions{Now: func() time.Time { return now }})
+	c := New(local, &Options{Validate: func(r *fs.FlowSpecRoute) error {
+		if r.DestPrefix != nil && r.DestPrefix.Addr().IsLoopback() {
+			return fs.ErrNoBestUnicast
+		}
+		return nil
+	}})
+
+	r, err := c.CreateRule(ctx, RuleSpec{Match: "proto udp dst 192.0.2.0/24", Actions: "discard", TTL: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Match == "" || !r.Feasible || r.Expires.IsZero() || r.IPv6 {
+		t.Errorf("CreateRule() = %+v", r)
+	}
+	// The same rule written differently is the same rule.
+	id, err := ID(RuleSpec{Match: "dst 192.0.2.0/24 proto udp"})
+	if err != nil || id != r.ID {
+		t.Errorf("ID() = %q, %v, want %q", id, err, r.ID)
+	}
+	if again, err := c.CreateRule(ctx, RuleSpec{Match: "dst 192.0.2.0/24 proto udp", Actions: "discard", TTL: time.Hour, Metadata: map[string]string{"ticket": "NOC-1"}}); err != nil ||
+		again.ID != r.ID || again.Metadata["ticket"] != "NOC-1" || local.Snapshot().Len() != 1 {
+		t.Errorf("CreateRule() again = %+v, %v", again, err)
+	}
+	if _, err := c.CreateRule(ctx, RuleSpec{Match: "dst 192.0.2.0/24 proto udp", Actions: "rate-limit 10M"}); !errors.Is(err, ErrExists) {
+		t.Errorf("CreateRule() other actions = %v, want ErrExists", err)
+	}
+
+	now = now.Add(time.Minute)
+	u, err := c.UpdateRuleActions(ctx, r.ID, "rate-limit 10M")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.ID != r.ID || u.Actions == r.Actions || !u.Expires.Equal(r.Expires) || u.Metadata["ticket"] != "NOC-1" {
+		t.Errorf("UpdateRuleActions() = %+v, want new actions and the lifetime and metadata kept from %+v", u, r)
+	}
+	if got, err := c.ReadRule(ctx, r.ID); err != nil || got.Actions != u.Actions {
+		t.Errorf("ReadRule() = %+v, %v", got, err)
+	}
+
+	if _, err := c.CreateRule(ctx, RuleSpec{Match: "dst 127.0.0.1/32"}); !errors.Is(err, fs.ErrNoBestUnicast) {
+		t.Errorf("CreateRule() infeasible = %v", err)
+	}
+	v6, err := c.CreateRule(ctx, RuleSpec{Match: "dst 2001:db8::/32"})
+	if err != nil || !v6.IPv6 {
+		t.Errorf("CreateRule() IPv6 = %+v, %v", v6, err)
+	}
+	if rules, err := c.ListRules(ctx); err != nil || len(rules) != 2 {
+		t.Errorf("ListRules() = %v, %v", rules, err)
+	}
+
+	for range 2 {
+		if err := c.DeleteRule(ctx, r.ID); err != nil {
+			t.Errorf("DeleteRule() = %v", err)
+		}
+	}
+	if _, err := c.ReadRule(ctx, r.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("ReadRule() deleted = %v, want ErrNotFound", err)
+	}
+}
+
+func TestRouteErrors(t *testing.T) {
+	for _, spec := range []RuleSpec{
+		{},
+		{Match: "dst nope"},
+		{Match: "dst 192.0.2.0/24", Actions: "explode"},
+	} {
+		if _, err := Route(spec); !errors.Is(err, ErrSpec) {
+			t.Errorf("Route(%+v) = %v, want ErrSpec", spec, err)
+		}
+	}
+}
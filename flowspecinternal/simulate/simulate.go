@@ -0,0 +1,167 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+// Package simulate predicts which neighbors would accept a FlowSpec
+// announcement before it is made, e.g. as a check in a change pipeline.
+//
+// A Topology describes the announcing speaker and the peers it announces
+// to, each with its unicast table and validation policy. Simulate derives
+// the route every peer would receive, prepending the announcer's AS over
+// eBGP, and runs the peer's PeerPolicy and the RFC8955/9117 feasibility
+// rules on it:
+//
+//	topo, err := simulate.ReadTopology(f)
+//	for _, res := range simulate.Simulate(route, topo) {
+//		fmt.Println(res.Peer, res.Accepted(), fs.Reason(res.Err))
+//	}
+package simulate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"slices"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/rib"
+)
+
+var (
+	ErrInvalidTopology = errors.New("simulate: topology needs the announcer's AS and named peers with an AS")
+)
+
+// Topology describes an announcing speaker and its FlowSpec peers.
+type Topology struct {
+	// AS and RouterID of the announcing speaker. RouterID becomes the
+	// originator of routes that do not carry one.
+	AS       uint32     `json:"as"`
+	RouterID netip.Addr `json:"router_id,omitzero"`
+	Peers    []*Peer    `json:"peers"`
+}
+
+// Peer is a router the rule is announced to.
+type Peer struct {
+	Name string `json:"name"`
+	AS   uint32 `json:"as"`
+	// Policy is the peer's validation policy for the session with the
+	// announcer, including its feasibility Config.
+	Policy fs.PeerPolicy `json:"policy"`
+	// Unicast is the peer's unicast table, its best path per prefix.
+	Unicast []*fs.UnicastRoute `json:"unicast"`
+	// RIB, if set, is used instead of Unicast.
+	RIB fs.UnicastRIB `json:"-"`
+}
+
+// Result is the predicted outcome at one peer.
+type Result struct {
+	Peer string
+	// Route is the route as the peer would receive it.
+	Route *fs.FlowSpecRoute
+	// Err is the reason the peer would reject the route, nil if it would
+	// accept it.
+	Err error
+}
+
+// Accepted reports whether the peer would accept the route.
+func (r Result) Accepted() bool { return r.Err == nil }
+
+type resultJSON struct {
+	Peer     string `json:"peer"`
+	Rule     string `json:"rule,omitempty"`
+	Accepted bool   `json:"accepted"`
+	Reason   string `json:"reason,omitempty"`
+	RFCRule  string `json:"rfc_rule,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// MarshalJSON renders r with the components of its route in the rule
+// syntax, the stable name of its rejection reason, see fs.Reason, and the
+// feasibility rule it stems from, see fs.RFCRule.
+func (r Result) MarshalJSON() ([]byte, error) {
+	j := resultJSON{Peer: r.Peer, Accepted: r.Accepted()}
+	if r.Route != nil {
+		j.Rule = r.Route.Components.String()
+	}
+	if r.Err != nil {
+		j.Reason, j.RFCRule, j.Error = fs.Reason(r.Err), fs.RFCRule(r.Err), r.Err.Error()
+	}
+	return json.Marshal(j)
+}
+
+// ReadTopology decodes a JSON topology from r and checks it. Unknown fields
+// are rejected, so that typos do not silently change the prediction.
+func ReadTopology(r io.Reader) (*Topology, error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	var t Topology
+	if err := dec.Decode(&t); err != nil {
+		return nil, fmt.Errorf("simulate: %w", err)
+	}
+	return &t, t.Check()
+}
+
+// Check returns ErrInvalidTopology if the announcer has no AS or a peer has
+// no name, a duplicate name or no AS.
+func (t *Topology) Check() error {
+	if t.AS == 0 {
+		return ErrInvalidTopology
+	}
+	var names []string
+	for _, p := range t.Peers {
+		if p == nil || p.Name == "" || p.AS == 0 || slices.Contains(names, p.Name) {
+			return ErrInvalidTopology
+		}
+		names = append(names, p.Name)
+	}
+	return nil
+}
+
+// Simulate returns the outcome of announcing route to every peer of t, in
+// the order of t.Peers. route is the rule as the announcer sends it: its
+// AS_PATH without the announcer's AS, which is prepended for eBGP peers.
+// Peers without a RIB get one built from Unicast on first use, so a
+// topology must not be simulated from several goroutines at once.
+func Simulate(route *fs.FlowSpecRoute, t *Topology) []Result {
+	out := make([]Result, 0, len(t.Peers))
+	for _, p := range t.Peers {
+		r := t.received(route, p)
+		out = append(out, Result{Peer: p.Name, Route: r, Err: p.Policy.Validate(r, p.unicast())})
+	}
+	return out
+}
+
+// received returns route as p receives it from the announcer.
+func (t *Topology) received(route *fs.FlowSpecRoute, p *Peer) *fs.FlowSpecRoute {
+	r := *route
+	r.NeighborAS = t.AS
+	r.FromEBGP = p.AS != t.AS
+	if r.FromEBGP {
+		r.ASPath = append([]uint32{t.AS}, route.ASPath...)
+	}
+	if !r.OriginatorID.IsValid() {
+		r.OriginatorID = t.RouterID
+	}
+	if r.DestPrefix == nil {
+		for _, c := range r.Components.Components {
+			if c.Type == fs.ComponentTypeDestinationPrefix {
+				r.DestPrefix = c.Prefix
+			}
+		}
+	}
+	return &r
+}
+
+// unicast returns the RIB of p, building it from Unicast once.
+func (p *Peer) unicast() fs.UnicastRIB {
+	if p.RIB == nil {
+		idx := rib.NewTrie()
+		for _, r := range p.Unicast {
+			idx.Insert(r)
+		}
+		p.RIB = idx
+	}
+	return p.RIB
+}
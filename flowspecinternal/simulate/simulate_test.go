@@ -0,0 +1,98 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package simulate
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/actions"
+)
+
+const topology = `{
+	"as": 64500,
+	"router_id": "192.0.2.1",
+	"peers": [
+		{"name": "transit", "as": 64510, "unicast": [{"prefix": "198.51.100.0/24", "neighbor_as": 64500, "as_path": [64500], "originator_id": "192.0.2.1"}]},
+		{"name": "backup", "as": 64511, "unicast": [{"prefix": "198.51.100.0/24", "neighbor_as": 64520, "as_path": [64520, 64500]}]},
+		{"name": "core", "as": 64500, "policy": {"enable_empty_or_confed": true}, "unicast": [{"prefix": "198.51.100.0/23", "neighbor_as": 64500, "as_path": [], "originator_id": "192.0.2.1"}]},
+		{"name": "customer", "as": 64530, "policy": {"allowed_actions": [{"action": "rate-limit"}]}, "unicast": [{"prefix": "198.51.100.0/24", "neighbor_as": 64500, "as_path": [64500], "originator_id": "192.0.2.1"}]},
+		{"name": "isolated", "as": 64540}
+	]
+}`
+
+func TestSimulate(t *testing.T) {
+	topo, err := ReadTopology(strings.NewReader(topology))
+	if err != nil {
+		t.Fatal(err)
+	}
+	comps, acts, err := actions.ParseRule("match dst 198.51.100.0/24 proto udp then discard")
+	if err != nil {
+		t.Fatal(err)
+	}
+	route := &fs.FlowSpecRoute{AFI: fs.AFIIPv4, SAFI: fs.SAFIFlowSpec, Components: comps}
+	for _, a := range acts {
+		route.ExtCommunities = append(route.ExtCommunities, a.ExtendedCommunity())
+	}
+
+	want := []struct {
+		peer string
+		err  error
+	}{
+		{"transit", nil},
+		{"backup", fs.ErrOriginatorValidationFailed},
+		{"core", nil},
+		{"customer", fs.ErrActionNotAllowed},
+		{"isolated", fs.ErrNoBestUnicast},
+	}
+	got := Simulate(route, topo)
+	if len(got) != len(want) {
+		t.Fatalf("Simulate() = %d results, want %d", len(got), len(want))
+	}
+	for i, w := range want {
+		if got[i].Peer != w.peer || !errors.Is(got[i].Err, w.err) || got[i].Accepted() != (w.err == nil) {
+			t.Errorf("Simulate()[%d] = %s: %v, want %s: %v", i, got[i].Peer, got[i].Err, w.peer, w.err)
+		}
+	}
+	if r := got[0].Route; !r.FromEBGP || len(r.ASPath) != 1 || r.ASPath[0] != 64500 || r.DestPrefix == nil {
+		t.Errorf("route received by transit = %+v, want the announcer's AS prepended", r)
+	}
+	if r := got[2].Route; r.FromEBGP || len(r.ASPath) != 0 {
+		t.Errorf("route received by core = %+v, want iBGP with an empty AS_PATH", r)
+	}
+	if len(route.ASPath) != 0 {
+		t.Errorf("Simulate() modified the route's AS_PATH to %v", route.ASPath)
+	}
+
+	b, err := json.Marshal(got[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"peer":"backup","rule":"dst 198.51.100.0/24 proto udp","accepted":false,"reason":"originator-validation-failed","rfc_rule":"b","error":"` + fs.ErrOriginatorValidationFailed.Error() + `"}`; string(b) != want {
+		t.Errorf("json.Marshal() = %s, want %s", b, want)
+	}
+}
+
+func TestReadTopologyErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+	}{
+		{"NoAS", `{"peers": [{"name": "a", "as": 1}]}`},
+		{"NoName", `{"as": 1, "peers": [{"as": 2}]}`},
+		{"DuplicateName", `{"as": 1, "peers": [{"name": "a", "as": 2}, {"name": "a", "as": 3}]}`},
+		{"UnknownField", `{"as": 1, "peers": [{"name": "a", "as": 2, "polcy": {}}]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ReadTopology(strings.NewReader(tt.in)); err == nil {
+				t.Error("ReadTopology() error = <nil>, want an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,230 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+// Package store persists FlowSpec rules in a bbolt database so a
+// FlowSpecRIB survives process restarts.
+//
+// A Store subscribed to the events of a rib.FlowSpecRIB writes every
+// accepted, rejected or revalidated rule and removes withdrawn ones.
+// Locally originated rules are written with Put, marked Local and with their
+// lifetime. On start, Replay loads the rules back into an empty RIB and
+// validates them again, against the unicast RIB of the new process rather
+// than the result stored before the restart.
+//
+// Rules are stored as the JSON of fs.FlowSpecRoute keyed by rib.FlowSpecKey.
+// The database records its SchemaVersion; Open migrates older databases and
+// refuses newer ones.
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/events"
+	"floofspectools/flowspecinternal/rib"
+)
+
+var (
+	ErrSchemaVersion = errors.New("store: database schema is newer than supported")
+)
+
+// SchemaVersion is the version of the database layout written by this
+// package.
+const SchemaVersion = 1
+
+var (
+	metaBucket  = []byte("meta")
+	rulesBucket = []byte("rules")
+	versionKey  = []byte("schema_version")
+)
+
+// migrations[v] upgrades a database from version v to v+1. Version 0 is an
+// empty database.
+var migrations = [SchemaVersion]func(tx *bolt.Tx) error{
+	func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(rulesBucket)
+		return err
+	},
+}
+
+// Record is a stored rule.
+type Record struct {
+	Route *fs.FlowSpecRoute `json:"route"`
+	// Local marks rules originated by this process rather than received.
+	Local bool `json:"local,omitempty"`
+	// TTL and Idle are the rib.Lifetime of the rule, restarted on Replay.
+	TTL  time.Duration `json:"ttl,omitempty"`
+	Idle time.Duration `json:"idle,omitempty"`
+}
+
+// Lifetime returns the lifetime of the rule.
+func (r *Record) Lifetime() rib.Lifetime {
+	return rib.Lifetime{TTL: r.TTL, Idle: r.Idle}
+}
+
+// Options configures a Store.
+type Options struct {
+	// Timeout bounds the wait for the file lock of a database held by
+	// another process, defaults to one second.
+	Timeout time.Duration
+	// Logger, if set, receives the errors of writes made for events, which
+	// have no caller to return them to.
+	Logger *slog.Logger
+}
+
+// Store is a bbolt database of FlowSpec rules.
+type Store struct {
+	db  *bolt.DB
+	log *slog.Logger
+}
+
+// Open opens or creates the database at path and migrates it to
+// SchemaVersion.
+func Open(path string, opts *Options) (*Store, error) {
+	var o Options
+	if opts != nil {
+		o = *opts
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = time.Second
+	}
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: o.Timeout})
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Update(migrate); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Store{db: db, log: fs.SubsystemLogger(o.Logger, fs.SubsystemStore)}, nil
+}
+
+func migrate(tx *bolt.Tx) error {
+	meta, err := tx.CreateBucketIfNotExists(metaBucket)
+	if err != nil {
+		return err
+	}
+	v := 0
+	if b := meta.Get(versionKey); b != nil {
+		if v, err = strconv.Atoi(string(b)); err != nil {
+			return fmt.Errorf("store: invalid schema version %q", b)
+		}
+	}
+	if v > SchemaVersion {
+		return fmt.Errorf("%w: %d > %d", ErrSchemaVersion, v, SchemaVersion)
+	}
+	for ; v < SchemaVersion; v++ {
+		if err := migrations[v](tx); err != nil {
+			return fmt.Errorf("store: migrating schema version %d: %w", v, err)
+		}
+	}
+	return meta.Put(versionKey, []byte(strconv.Itoa(v)))
+}
+
+// Close closes the database.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Put writes rec, replacing the record of the same rule.
+func (s *Store) Put(rec Record) error {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(rulesBucket).Put([]byte(rib.FlowSpecKey(rec.Route)), b)
+	})
+}
+
+// Delete removes the record of route, if any.
+func (s *Store) Delete(route *fs.FlowSpecRoute) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(rulesBucket).Delete([]byte(rib.FlowSpecKey(route)))
+	})
+}
+
+// Records returns the stored rules ordered by key.
+func (s *Store) Records() ([]Record, error) {
+	var recs []Record
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(rulesBucket).ForEach(func(k, v []byte) error {
+			var rec Record
+			if err := json.Unmarshal(v, &rec); err != nil || rec.Route == nil {
+				return fmt.Errorf("store: invalid record %q: %v", k, err)
+			}
+			recs = append(recs, rec)
+			return nil
+		})
+	})
+	return recs, err
+}
+
+// update writes route for an event, keeping Local and the lifetime of an
+// existing record.
+func (s *Store) update(route *fs.FlowSpecRoute) error {
+	key := []byte(rib.FlowSpecKey(route))
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(rulesBucket)
+		rec := Record{Route: route}
+		if v := b.Get(key); v != nil {
+			var old Record
+			if json.Unmarshal(v, &old) == nil {
+				rec.Local, rec.TTL, rec.Idle = old.Local, old.TTL, old.Idle
+			}
+		}
+		v, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		return b.Put(key, v)
+	})
+}
+
+// Observe persists one event.
+func (s *Store) Observe(e events.Event) {
+	var err error
+	switch e.Kind {
+	case events.RuleAccepted, events.RuleRejected, events.RuleRevalidated:
+		err = s.update(e.Route)
+	case events.RuleWithdrawn:
+		err = s.Delete(e.Route)
+	}
+	if err != nil {
+		s.log.Error("persisting flowspec rule", "event", e.Kind.String(), fs.LogKeyRule, rib.FlowSpecKey(e.Route), "error", err)
+	}
+}
+
+// Subscribe persists the changes published on bus, typically the Events of
+// a FlowSpecRIB, until cancel is called. Each change is a database
+// transaction made before the publisher continues.
+func (s *Store) Subscribe(bus *events.Bus) (cancel func()) {
+	return bus.Subscribe(s.Observe)
+}
+
+// Replay inserts the stored rules into r in one Apply, each with the result
+// of validate, e.g. fs.ValidateFeasibility against the current unicast RIB,
+// and the stored lifetime counted from now. It returns the number of rules.
+//
+// Call Replay before Subscribe, or the replayed rules are written back.
+func (s *Store) Replay(r *rib.FlowSpecRIB, validate func(*fs.FlowSpecRoute) error) (int, error) {
+	recs, err := s.Records()
+	if err != nil {
+		return 0, err
+	}
+	r.Apply(func(tx *rib.FlowSpecTx) {
+		for _, rec := range recs {
+			tx.Insert(rec.Route, validate(rec.Route))
+			tx.SetLifetime(rec.Route, rec.Lifetime())
+		}
+	})
+	return len(recs), nil
+}
@@ -0,0 +1,124 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package store
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/events"
+	"floofspectools/flowspecinternal/rib"
+)
+
+func route(t *testing.T, s string) *fs.FlowSpecRoute {
+	t.Helper()
+	l, err := fs.ParseComponents(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &fs.FlowSpecRoute{AFI: fs.AFIIPv4, SAFI: 133, NeighborAS: 64500, ASPath: []uint32{64500}, Components: l}
+	r.DestPrefix = l.Components[0].Prefix
+	return r
+}
+
+func TestReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.db")
+	s, err := Open(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bus := events.NewBus()
+	s.Subscribe(bus)
+	r := rib.NewFlowSpecRIB(&rib.FlowSpecOptions{Events: bus})
+
+	received := route(t, "dst 192.0.2.0/24")
+	local := route(t, "dst 198.51.100.0/24 proto =17")
+	local.Metadata = map[string]string{"origin": "mitigation", "ticket": "NOC-1"}
+	withdrawn := route(t, "dst 203.0.113.0/24")
+	r.Insert(received, nil)
+	r.Insert(withdrawn, fs.ErrNoBestUnicast)
+	lt := rib.Lifetime{TTL: time.Hour}
+	if err := s.Put(Record{Route: local, Local: true, TTL: lt.TTL}); err != nil {
+		t.Fatal(err)
+	}
+	r.InsertWithLifetime(local, nil, lt)
+	r.Delete(withdrawn)
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// restart
+	if s, err = Open(path, nil); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	r = rib.NewFlowSpecRIB(nil)
+	n, err := s.Replay(r, func(route *fs.FlowSpecRoute) error {
+		if route.Components.Canonical(nil) == received.Components.Canonical(nil) {
+			return fs.ErrNoBestUnicast
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 || r.Snapshot().Len() != 2 {
+		t.Fatalf("Replay() = %d, RIB holds %d rules, want 2", n, r.Snapshot().Len())
+	}
+	if e, ok := r.Snapshot().Get(received); !ok || !errors.Is(e.Err, fs.ErrNoBestUnicast) {
+		t.Errorf("received rule = %+v, %v, want revalidated as infeasible", e, ok)
+	}
+	if e, ok := r.Snapshot().Get(local); !ok || e.Err != nil || e.Route.Metadata["ticket"] != "NOC-1" {
+		t.Errorf("local rule = %+v, %v, want feasible with its metadata", e, ok)
+	}
+	if r.Expiry(local).IsZero() {
+		t.Error("local rule lost its lifetime")
+	}
+	if _, ok := r.Snapshot().Get(withdrawn); ok {
+		t.Error("withdrawn rule replayed")
+	}
+
+	recs, err := s.Records()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rec := range recs {
+		if want := rec.Route.Components.Canonical(nil) == local.Components.Canonical(nil); rec.Local != want {
+			t.Errorf("%s Local = %v, want %v", rec.Route.Components, rec.Local, want)
+		}
+		if rec.Route.NeighborAS != 64500 || len(rec.Route.ASPath) != 1 {
+			t.Errorf("%s route attributes not stored: %+v", rec.Route.Components, rec.Route)
+		}
+	}
+}
+
+func TestSchemaVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.db")
+	s, err := Open(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	db, err := bolt.Open(path, 0o600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(metaBucket).Put(versionKey, []byte("99"))
+	})
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(path, nil); !errors.Is(err, ErrSchemaVersion) {
+		t.Errorf("Open() error = %v, want %v", err, ErrSchemaVersion)
+	}
+}
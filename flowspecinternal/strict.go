@@ -0,0 +1,223 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package flowspecinternal
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+var (
+	ErrInvalidComponentValue   = NewError(StageDecode, "invalid-component-value", "RFC8955 4.2.2", "flowspec: component value invalid for its type (RFC8955 4.2.2, RFC8956 3)")
+	ErrProtocolMismatch        = NewError(StageDecode, "protocol-mismatch", "", "flowspec: component can never match the protocols of the IP protocol component")
+	ErrTCPFlagsWithoutTCP      = NewError(StageDecode, "tcp-flags-without-tcp", "", "flowspec: TCP flags component without an IP protocol component restricted to tcp")
+	ErrUnknownEnforcement      = errors.New("flowspec: unknown enforcement")
+	ErrImplausiblePacketLength = NewError(StageDecode, "implausible-packet-length", "", "flowspec: packet length component compares against lengths outside the link MTU and minimum header")
+)
+
+// Enforcement selects how an optional check treats the rules failing it.
+type Enforcement uint8
+
+const (
+	// EnforceOff skips the check.
+	EnforceOff Enforcement = iota
+	// EnforceWarn accepts the rules and logs them at warning level to
+	// Config.Logger.
+	EnforceWarn
+	// EnforceReject rejects the rules.
+	EnforceReject
+)
+
+var enforcementNames = [...]string{
+	EnforceOff:    "off",
+	EnforceWarn:   "warn",
+	EnforceReject: "reject",
+}
+
+func (e Enforcement) String() string {
+	if int(e) < len(enforcementNames) {
+		return enforcementNames[e]
+	}
+	return fmt.Sprintf("enforcement-%d", uint8(e))
+}
+
+func (e Enforcement) MarshalText() ([]byte, error) {
+	return []byte(e.String()), nil
+}
+
+func (e *Enforcement) UnmarshalText(b []byte) error {
+	i := slices.Index(enforcementNames[:], string(b))
+	if i < 0 {
+		return fmt.Errorf("%w: %q", ErrUnknownEnforcement, b)
+	}
+	*e = Enforcement(i)
+	return nil
+}
+
+// IP protocols the transport components refer to.
+const (
+	protoICMP   = 1
+	protoTCP    = 6
+	protoUDP    = 17
+	protoICMPv6 = 58
+)
+
+// CheckComponents returns every semantic problem of a decoded list, in
+// component order. Errors wrapping ErrInvalidComponentValue are values no
+// header field can hold:
+//
+//   - numeric values beyond the field width, e.g. a DSCP above 63 or a port
+//     above 65535 (RFC8955 4.2.2)
+//   - fragment bits other than DF, IsF, FF and LF, and DF for IPv6 where the
+//     bit must be zero (RFC8956 3.7)
+//
+// Errors wrapping ErrProtocolMismatch are ICMP, port or TCP flag components
+// next to an IP protocol component that excludes ICMP, TCP and UDP, or TCP.
+// Such a rule is valid but matches nothing, so they are usually only logged.
+//
+// The structural checks of DecodeComponents, duplicate and out-of-order
+// types, are not repeated.
+func CheckComponents(l FSComponentList, afi uint16) []error {
+	var errs []error
+	var protos []ValueRange
+	for _, c := range l.Components {
+		if c.Type == ComponentTypeIpProtocol {
+			if ops, err := ParseNumericOps(c.Raw); err == nil {
+				protos = NumericRanges(ops, 0xff)
+			}
+		}
+	}
+	allows := func(p ...uint64) bool {
+		if protos == nil {
+			return true
+		}
+		for _, v := range p {
+			for _, r := range protos {
+				if r.From <= v && v <= r.To {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	for _, c := range l.Components {
+		switch {
+		case c.Type == ComponentTypeDestinationPrefix || c.Type == ComponentTypeSourcePrefix || c.Type.IsMAC():
+			continue
+		case c.Type == ComponentTypeFragment:
+			mask := uint64(fragmentAll)
+			if afi == AFIIPv6 {
+				mask &^= uint64(FragmentDF)
+			}
+			ops, err := ParseBitmaskOps(c.Raw)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			for _, op := range ops {
+				if op.Value&^mask != 0 {
+					errs = append(errs, fmt.Errorf("%w: %s bits 0x%02x", ErrInvalidComponentValue, c.Type, op.Value&^mask))
+					break
+				}
+			}
+		case c.Type == ComponentTypeTCPFlags:
+			if !allows(protoTCP) {
+				errs = append(errs, fmt.Errorf("%w: %s without tcp", ErrProtocolMismatch, c.Type))
+			}
+		default:
+			ops, err := ParseNumericOps(c.Raw)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			for _, op := range ops {
+				if op.Value > c.Type.maxValue() {
+					errs = append(errs, fmt.Errorf("%w: %s value %d above %d", ErrInvalidComponentValue, c.Type, op.Value, c.Type.maxValue()))
+					break
+				}
+			}
+			switch c.Type {
+			case ComponentTypePort, ComponentTypeDestinationPort, ComponentTypeSourcePort:
+				if !allows(protoTCP, protoUDP) {
+					errs = append(errs, fmt.Errorf("%w: %s without tcp or udp", ErrProtocolMismatch, c.Type))
+				}
+			case ComponentTypeICMPType, ComponentTypeICMPCode:
+				icmp := uint64(protoICMP)
+				if afi == AFIIPv6 {
+					icmp = protoICMPv6
+				}
+				if !allows(icmp) {
+					errs = append(errs, fmt.Errorf("%w: %s without %s", ErrProtocolMismatch, c.Type, FormatProtocol(uint8(icmp))))
+				}
+			}
+		}
+	}
+	return errs
+}
+
+// CheckTCPFlagsProtocol returns ErrTCPFlagsWithoutTCP if l has a TCP flags
+// component but no IP protocol component matching tcp only. Such a rule also
+// matches packets of other protocols, whose flags field is something else.
+func CheckTCPFlagsProtocol(l FSComponentList) error {
+	if !slices.ContainsFunc(l.Components, func(c FSComponent) bool { return c.Type == ComponentTypeTCPFlags }) {
+		return nil
+	}
+	for _, c := range l.Components {
+		if c.Type != ComponentTypeIpProtocol {
+			continue
+		}
+		if ops, err := ParseNumericOps(c.Raw); err == nil &&
+			slices.Equal(NumericRanges(ops, 0xff), []ValueRange{{From: protoTCP, To: protoTCP}}) {
+			return nil
+		}
+	}
+	return ErrTCPFlagsWithoutTCP
+}
+
+// CheckStrict applies the strict mode of c to a decoded list: with Strict it
+// returns the first CheckComponents error wrapping ErrInvalidComponentValue,
+// with StrictProtocol also the first wrapping ErrProtocolMismatch. Then
+// TCPFlagsNeedTCP applies CheckTCPFlagsProtocol and PacketLengthCheck
+// CheckPacketLength with LinkMTU. A nil c is lenient.
+func (c *Config) CheckStrict(l FSComponentList, afi uint16) error {
+	if c == nil {
+		return nil
+	}
+	if c.Strict || c.StrictProtocol {
+		for _, err := range CheckComponents(l, afi) {
+			if errors.Is(err, ErrProtocolMismatch) {
+				if c.StrictProtocol {
+					return err
+				}
+				continue
+			}
+			if c.Strict {
+				return err
+			}
+		}
+	}
+	if c.TCPFlagsNeedTCP != EnforceOff {
+		if err := c.enforce(c.TCPFlagsNeedTCP, l, CheckTCPFlagsProtocol(l)); err != nil {
+			return err
+		}
+	}
+	if c.PacketLengthCheck != EnforceOff {
+		return c.enforce(c.PacketLengthCheck, l, CheckPacketLength(l, afi, uint64(c.LinkMTU)))
+	}
+	return nil
+}
+
+// enforce returns err if e rejects, or logs it and returns nil if e warns.
+func (c *Config) enforce(e Enforcement, l FSComponentList, err error) error {
+	if err != nil && e == EnforceWarn {
+		if c.Logger != nil {
+			SubsystemLogger(c.Logger, SubsystemDecode).Warn("rule accepted", LogKeyRule, l.Canonical(nil), "error", err)
+		}
+		return nil
+	}
+	return err
+}
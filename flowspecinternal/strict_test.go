@@ -0,0 +1,92 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package flowspecinternal
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckComponents(t *testing.T) {
+	tests := []struct {
+		name     string
+		list     FSComponentList
+		afi      uint16
+		wantErrs []error
+	}{
+		{name: "Valid", list: mustParse(t, "dst 192.0.2.0/24 proto tcp dport 443 tcp-flags syn dscp 46 frag df|isf"), afi: AFIIPv4},
+		{name: "DSCP", list: raw(ComponentTypeDSCP, 0x81, 0x40), afi: AFIIPv4, wantErrs: []error{ErrInvalidComponentValue}},
+		{name: "Protocol", list: raw(ComponentTypeIpProtocol, 0x91, 0x01, 0x00), afi: AFIIPv4, wantErrs: []error{ErrInvalidComponentValue}},
+		{name: "FragmentReserved", list: raw(ComponentTypeFragment, 0x81, 0x10), afi: AFIIPv4, wantErrs: []error{ErrInvalidComponentValue}},
+		{name: "FragmentDFOnIPv6", list: raw(ComponentTypeFragment, 0x81, 0x01), afi: AFIIPv6, wantErrs: []error{ErrInvalidComponentValue}},
+		{name: "ICMPWithUDP", list: mustParse(t, "proto udp icmp-type 8"), afi: AFIIPv4, wantErrs: []error{ErrProtocolMismatch}},
+		{name: "ICMPWithICMPv6", list: mustParse(t, "proto 58 icmp-type 128"), afi: AFIIPv6},
+		{name: "ICMPWithoutProtocol", list: mustParse(t, "icmp-type 8"), afi: AFIIPv4},
+		{name: "PortsAndFlagsWithUDP", list: mustParse(t, "proto udp dport 53 tcp-flags syn"), afi: AFIIPv4, wantErrs: []error{ErrProtocolMismatch}},
+		{name: "PortsWithICMP", list: mustParse(t, "proto icmp port 53 icmp-code 0"), afi: AFIIPv4, wantErrs: []error{ErrProtocolMismatch}},
+		{name: "Malformed", list: raw(ComponentTypePort, 0x01), afi: AFIIPv4, wantErrs: []error{ErrMalformedOperators}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := CheckComponents(tt.list, tt.afi)
+			if len(errs) != len(tt.wantErrs) {
+				t.Fatalf("CheckComponents() = %v, want %v", errs, tt.wantErrs)
+			}
+			for i, err := range errs {
+				if !errors.Is(err, tt.wantErrs[i]) {
+					t.Errorf("CheckComponents()[%d] = %v, want %v", i, err, tt.wantErrs[i])
+				}
+			}
+		})
+	}
+}
+
+func TestConfigCheckStrict(t *testing.T) {
+	invalid := raw(ComponentTypeDSCP, 0x81, 0x40)
+	mismatch := mustParse(t, "proto udp icmp-type 8")
+	tooLong := raw(ComponentTypePacketLength, 0xa2, 0x00, 0x01, 0x00, 0x00) // len >65536
+	tests := []struct {
+		name    string
+		cfg     *Config
+		list    FSComponentList
+		wantErr error
+	}{
+		{name: "NilConfig", list: invalid},
+		{name: "Lenient", cfg: &Config{}, list: invalid},
+		{name: "Strict", cfg: &Config{Strict: true}, list: invalid, wantErr: ErrInvalidComponentValue},
+		{name: "StrictAllowsMismatch", cfg: &Config{Strict: true}, list: mismatch},
+		{name: "StrictProtocol", cfg: &Config{StrictProtocol: true}, list: mismatch, wantErr: ErrProtocolMismatch},
+		{name: "StrictProtocolOnly", cfg: &Config{StrictProtocol: true}, list: invalid},
+		{name: "TCPFlagsOff", cfg: &Config{}, list: mustParse(t, "tcp-flags syn")},
+		{name: "TCPFlagsWarn", cfg: &Config{TCPFlagsNeedTCP: EnforceWarn}, list: mustParse(t, "tcp-flags syn")},
+		{name: "TCPFlagsReject", cfg: &Config{TCPFlagsNeedTCP: EnforceReject}, list: mustParse(t, "proto tcp,udp tcp-flags syn"), wantErr: ErrTCPFlagsWithoutTCP},
+		{name: "TCPFlagsWithTCP", cfg: &Config{TCPFlagsNeedTCP: EnforceReject}, list: mustParse(t, "proto tcp tcp-flags syn")},
+		{name: "PacketLengthOff", cfg: &Config{}, list: tooLong},
+		{name: "PacketLengthWarn", cfg: &Config{PacketLengthCheck: EnforceWarn}, list: tooLong},
+		{name: "PacketLengthReject", cfg: &Config{PacketLengthCheck: EnforceReject}, list: tooLong, wantErr: ErrImplausiblePacketLength},
+		{name: "PacketLengthAboveMTU", cfg: &Config{PacketLengthCheck: EnforceReject, LinkMTU: 1500}, list: mustParse(t, "len 1400-9000"), wantErr: ErrImplausiblePacketLength},
+		{name: "PacketLengthWithinMTU", cfg: &Config{PacketLengthCheck: EnforceReject, LinkMTU: 1500}, list: mustParse(t, "len 1400-1500")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.cfg.CheckStrict(tt.list, AFIIPv4); !errors.Is(err, tt.wantErr) {
+				t.Errorf("CheckStrict() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func mustParse(t *testing.T, s string) FSComponentList {
+	t.Helper()
+	l, err := ParseComponents(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+func raw(typ ComponentType, b ...byte) FSComponentList {
+	return FSComponentList{Components: []FSComponent{{Type: typ, Raw: b}}}
+}
@@ -0,0 +1,221 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package flowspecinternal
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrUnknownSymbol = errors.New("flowspec: unknown protocol, port or DSCP name")
+)
+
+// symbol is one well-known number with its canonical name and accepted aliases.
+type symbol struct {
+	num     uint16
+	name    string
+	aliases []string
+}
+
+// protocolSymbols lists IP protocol numbers as assigned by IANA.
+// Names follow /etc/protocols except where the lower-case keyword is better known.
+var protocolSymbols = []symbol{
+	{1, "icmp", nil},
+	{2, "igmp", nil},
+	{4, "ipip", []string{"ipencap"}},
+	{6, "tcp", nil},
+	{8, "egp", nil},
+	{17, "udp", nil},
+	{41, "ipv6", nil},
+	{46, "rsvp", nil},
+	{47, "gre", nil},
+	{50, "esp", nil},
+	{51, "ah", nil},
+	{58, "icmpv6", []string{"ipv6-icmp"}},
+	{89, "ospf", []string{"ospfigp"}},
+	{103, "pim", nil},
+	{112, "vrrp", nil},
+	{115, "l2tp", nil},
+	{132, "sctp", nil},
+}
+
+// portSymbols lists service ports, biased towards services seen in mitigation rules
+// (amplification vectors). A name is not tied to tcp or udp.
+var portSymbols = []symbol{
+	{17, "qotd", nil},
+	{19, "chargen", nil},
+	{20, "ftp-data", nil},
+	{21, "ftp", nil},
+	{22, "ssh", nil},
+	{23, "telnet", nil},
+	{25, "smtp", nil},
+	{53, "dns", []string{"domain"}},
+	{67, "bootps", []string{"dhcp"}},
+	{68, "bootpc", nil},
+	{69, "tftp", nil},
+	{80, "http", []string{"www"}},
+	{88, "kerberos", nil},
+	{110, "pop3", nil},
+	{111, "rpcbind", []string{"sunrpc", "portmap"}},
+	{123, "ntp", nil},
+	{137, "netbios-ns", nil},
+	{143, "imap", nil},
+	{161, "snmp", nil},
+	{162, "snmptrap", nil},
+	{179, "bgp", nil},
+	{389, "ldap", []string{"cldap"}},
+	{443, "https", nil},
+	{445, "microsoft-ds", []string{"smb"}},
+	{500, "isakmp", []string{"ike"}},
+	{514, "syslog", nil},
+	{636, "ldaps", nil},
+	{853, "domain-s", []string{"dot"}},
+	{873, "rsync", nil},
+	{993, "imaps", nil},
+	{995, "pop3s", nil},
+	{1194, "openvpn", nil},
+	{1433, "ms-sql-s", []string{"mssql"}},
+	{1900, "ssdp", nil},
+	{3306, "mysql", nil},
+	{3389, "ms-wbt-server", []string{"rdp"}},
+	{3702, "ws-discovery", nil},
+	{4500, "ipsec-nat-t", nil},
+	{5060, "sip", nil},
+	{5353, "mdns", nil},
+	{5432, "postgresql", []string{"postgres"}},
+	{5683, "coap", nil},
+	{11211, "memcache", []string{"memcached"}},
+}
+
+// dscpSymbols names the DSCP code points with their usual lower-case keyword.
+var dscpSymbols = []symbol{
+	{DSCPCS0, "cs0", []string{"be", "default"}},
+	{DSCPLE, "le", nil},
+	{DSCPCS1, "cs1", nil},
+	{DSCPAF11, "af11", nil},
+	{DSCPAF12, "af12", nil},
+	{DSCPAF13, "af13", nil},
+	{DSCPCS2, "cs2", nil},
+	{DSCPAF21, "af21", nil},
+	{DSCPAF22, "af22", nil},
+	{DSCPAF23, "af23", nil},
+	{DSCPCS3, "cs3", nil},
+	{DSCPAF31, "af31", nil},
+	{DSCPAF32, "af32", nil},
+	{DSCPAF33, "af33", nil},
+	{DSCPCS4, "cs4", nil},
+	{DSCPAF41, "af41", nil},
+	{DSCPAF42, "af42", nil},
+	{DSCPAF43, "af43", nil},
+	{DSCPCS5, "cs5", nil},
+	{DSCPVoiceAdmit, "voice-admit", nil},
+	{DSCPEF, "ef", nil},
+	{DSCPCS6, "cs6", nil},
+	{DSCPCS7, "cs7", nil},
+}
+
+type symbolTable struct {
+	names   map[uint16]string
+	numbers map[string]uint16
+}
+
+func newSymbolTable(syms []symbol) symbolTable {
+	t := symbolTable{names: map[uint16]string{}, numbers: map[string]uint16{}}
+	for _, s := range syms {
+		t.names[s.num] = s.name
+		t.numbers[s.name] = s.num
+		for _, a := range s.aliases {
+			t.numbers[a] = s.num
+		}
+	}
+	return t
+}
+
+var (
+	protocolTable = newSymbolTable(protocolSymbols)
+	portTable     = newSymbolTable(portSymbols)
+	dscpTable     = newSymbolTable(dscpSymbols)
+)
+
+// ProtocolName returns the canonical name of IP protocol p.
+func ProtocolName(p uint8) (string, bool) {
+	name, ok := protocolTable.names[uint16(p)]
+	return name, ok
+}
+
+// PortName returns the canonical service name of port p.
+func PortName(p uint16) (string, bool) {
+	name, ok := portTable.names[p]
+	return name, ok
+}
+
+// DSCPName returns the name of DSCP code point d.
+func DSCPName(d uint8) (string, bool) {
+	name, ok := dscpTable.names[uint16(d)]
+	return name, ok
+}
+
+// ParseProtocol accepts a protocol name, alias or decimal number, case-insensitively.
+func ParseProtocol(s string) (uint8, error) {
+	v, err := parseSymbol(protocolTable, s, 8)
+	return uint8(v), err
+}
+
+// ParsePort accepts a service name, alias or decimal number, case-insensitively.
+func ParsePort(s string) (uint16, error) {
+	return parseSymbol(portTable, s, 16)
+}
+
+// ParseDSCP accepts a DSCP name, alias or decimal number, case-insensitively.
+// Numbers above 63 return ErrInvalidComponentValue.
+func ParseDSCP(s string) (uint8, error) {
+	v, err := parseSymbol(dscpTable, s, 8)
+	if err == nil && v > maxDSCP {
+		return 0, fmt.Errorf("%w: dscp %d above %d", ErrInvalidComponentValue, v, maxDSCP)
+	}
+	return uint8(v), err
+}
+
+func parseSymbol(t symbolTable, s string, bits int) (uint16, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if v, ok := t.numbers[s]; ok {
+		return v, nil
+	}
+	v, err := strconv.ParseUint(s, 10, bits)
+	if err != nil {
+		return 0, ErrUnknownSymbol
+	}
+	return uint16(v), nil
+}
+
+// FormatProtocol renders p by name if it has one, numerically otherwise.
+// ParseProtocol(FormatProtocol(p)) == p for every p.
+func FormatProtocol(p uint8) string {
+	if name, ok := ProtocolName(p); ok {
+		return name
+	}
+	return strconv.Itoa(int(p))
+}
+
+// FormatPort renders p by name if it has one, numerically otherwise.
+// ParsePort(FormatPort(p)) == p for every p.
+func FormatPort(p uint16) string {
+	if name, ok := PortName(p); ok {
+		return name
+	}
+	return strconv.Itoa(int(p))
+}
+
+// FormatDSCP renders d by name if it has one, numerically otherwise.
+// ParseDSCP(FormatDSCP(d)) == d for every d up to 63.
+func FormatDSCP(d uint8) string {
+	if name, ok := DSCPName(d); ok {
+		return name
+	}
+	return strconv.Itoa(int(d))
+}
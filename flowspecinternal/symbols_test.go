@@ -0,0 +1,101 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package flowspecinternal
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseProtocol(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    uint8
+		wantErr error
+	}{
+		{name: "Name", in: "udp", want: 17},
+		{name: "UpperCase", in: "TCP", want: 6},
+		{name: "Alias", in: "ipv6-icmp", want: 58},
+		{name: "Number", in: "17", want: 17},
+		{name: "UnnamedNumber", in: "253", want: 253},
+		{name: "OutOfRange", in: "256", wantErr: ErrUnknownSymbol},
+		{name: "Unknown", in: "quic", wantErr: ErrUnknownSymbol},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseProtocol(tt.in)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ParseProtocol(%q) error = %v, want %v", tt.in, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseProtocol(%q) = %d, want %d", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePort(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    uint16
+		wantErr error
+	}{
+		{name: "Name", in: "ntp", want: 123},
+		{name: "Alias", in: "domain", want: 53},
+		{name: "Number", in: "123", want: 123},
+		{name: "OutOfRange", in: "65536", wantErr: ErrUnknownSymbol},
+		{name: "Negative", in: "-1", wantErr: ErrUnknownSymbol},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParsePort(tt.in)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ParsePort(%q) error = %v, want %v", tt.in, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParsePort(%q) = %d, want %d", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSymbolsRoundTrip(t *testing.T) {
+	for p := 0; p <= 0xff; p++ {
+		if got, err := ParseProtocol(FormatProtocol(uint8(p))); err != nil || got != uint8(p) {
+			t.Errorf("ParseProtocol(FormatProtocol(%d)) = %d, %v, want %d, <nil>", p, got, err, p)
+		}
+	}
+	for p := 0; p <= 0xffff; p++ {
+		if got, err := ParsePort(FormatPort(uint16(p))); err != nil || got != uint16(p) {
+			t.Errorf("ParsePort(FormatPort(%d)) = %d, %v, want %d, <nil>", p, got, err, p)
+		}
+	}
+	for d := 0; d <= 63; d++ {
+		if got, err := ParseDSCP(FormatDSCP(uint8(d))); err != nil || got != uint8(d) {
+			t.Errorf("ParseDSCP(FormatDSCP(%d)) = %d, %v, want %d, <nil>", d, got, err, d)
+		}
+	}
+}
+
+func TestSymbolTablesUnique(t *testing.T) {
+	for _, tbl := range [][]symbol{protocolSymbols, portSymbols, dscpSymbols} {
+		seen := map[string]bool{}
+		nums := map[uint16]bool{}
+		for _, s := range tbl {
+			if nums[s.num] {
+				t.Errorf("number %d listed twice", s.num)
+			}
+			nums[s.num] = true
+			for _, n := range append([]string{s.name}, s.aliases...) {
+				if seen[n] {
+					t.Errorf("name %q listed twice", n)
+				}
+				seen[n] = true
+			}
+		}
+	}
+}
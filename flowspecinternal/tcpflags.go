@@ -0,0 +1,114 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package flowspecinternal
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// TCPFlags is the TCP header flags field the TCP flags component (type 9)
+// tests, as per RFC8955 4.2.2.9.
+type TCPFlags uint16
+
+const (
+	TCPFlagFIN TCPFlags = 0x01
+	TCPFlagSYN TCPFlags = 0x02
+	TCPFlagRST TCPFlags = 0x04
+	TCPFlagPSH TCPFlags = 0x08
+	TCPFlagACK TCPFlags = 0x10
+	TCPFlagURG TCPFlags = 0x20
+	TCPFlagECE TCPFlags = 0x40
+	TCPFlagCWR TCPFlags = 0x80
+)
+
+// String returns the names of the flags of f joined by "|", as in the rule
+// syntax, or its hex value if it is 0 or has unnamed bits set.
+func (f TCPFlags) String() string {
+	return canonicalBits(ComponentTypeTCPFlags, uint64(f), CanonicalOptions{Symbolic: true})
+}
+
+// ParseTCPFlags parses the notation of TCPFlags.String, also accepting
+// numbers and upper case names.
+func ParseTCPFlags(s string) (TCPFlags, error) {
+	if v, err := strconv.ParseUint(s, 0, 16); err == nil {
+		return TCPFlags(v), nil
+	}
+	var f TCPFlags
+	for _, n := range strings.Split(strings.ToLower(s), "|") {
+		i := slices.Index(tcpFlagNames, n)
+		if i < 0 {
+			return 0, fmt.Errorf("%w: unknown %s bit %q", ErrSyntax, ComponentTypeTCPFlags, n)
+		}
+		f |= 1 << i
+	}
+	return f, nil
+}
+
+// Matches reports whether f matches the bitmask operator sequence ops.
+func (f TCPFlags) Matches(ops []BitmaskOp) bool {
+	return MatchBitmaskOps(ops, uint64(f))
+}
+
+// ParseTCPFlagsExpr parses a TCP flags condition such as "syn and not ack"
+// into a bitmask operator sequence. Terms are joined by "and", which binds
+// tighter than "or"; a term is flags as accepted by ParseTCPFlags, matching
+// if any of them is set, or "all" flags, matching if all of them are set,
+// each optionally negated by "not":
+//
+//	syn and not ack          SYN without ACK
+//	rst or fin               RST or FIN
+//	all syn|ack              SYN and ACK
+//	not all syn|fin          SYN and FIN not both set
+func ParseTCPFlagsExpr(s string) ([]BitmaskOp, error) {
+	var groups [][]BitmaskOp
+	for _, g := range splitWord(s, "or") {
+		var group []BitmaskOp
+		for _, term := range splitWord(g, "and") {
+			f := strings.Fields(term)
+			not := len(f) > 0 && f[0] == "not"
+			if not {
+				f = f[1:]
+			}
+			all := len(f) > 0 && f[0] == "all"
+			if all {
+				f = f[1:]
+			}
+			if len(f) != 1 {
+				return nil, fmt.Errorf("%w: TCP flags term %q", ErrSyntax, strings.TrimSpace(term))
+			}
+			flags, err := ParseTCPFlags(f[0])
+			if err != nil {
+				return nil, err
+			}
+			group = append(group, BitmaskOp{Not: not, Match: all, Value: uint64(flags)})
+		}
+		groups = append(groups, group)
+	}
+	return JoinBitmaskOps(groups...), nil
+}
+
+// splitWord splits s around the whitespace separated word sep.
+func splitWord(s, sep string) []string {
+	var out []string
+	var cur []string
+	for _, w := range strings.Fields(s) {
+		if w == sep {
+			out = append(out, strings.Join(cur, " "))
+			cur = nil
+			continue
+		}
+		cur = append(cur, w)
+	}
+	return append(out, strings.Join(cur, " "))
+}
+
+// TCPFlagsComponent returns the TCP flags component OR-ing groups of AND-ed
+// operators, see ParseTCPFlagsExpr for a textual form.
+func TCPFlagsComponent(groups ...[]BitmaskOp) FSComponent {
+	return FSComponent{Type: ComponentTypeTCPFlags, Raw: EncodeBitmaskOps(JoinBitmaskOps(groups...))}
+}
@@ -0,0 +1,78 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package flowspecinternal
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseTCPFlagsExpr(t *testing.T) {
+	tests := []struct {
+		in     string
+		want   []BitmaskOp
+		format string
+		match  []TCPFlags
+		miss   []TCPFlags
+	}{
+		{
+			in:     "syn and not ack",
+			want:   []BitmaskOp{BitmaskAny(uint64(TCPFlagSYN)), {And: true, Not: true, Value: uint64(TCPFlagACK)}},
+			format: "tcp-flags syn&!ack",
+			match:  []TCPFlags{TCPFlagSYN, TCPFlagSYN | TCPFlagECE},
+			miss:   []TCPFlags{TCPFlagSYN | TCPFlagACK, 0},
+		},
+		{
+			in:     "rst or fin",
+			want:   []BitmaskOp{BitmaskAny(uint64(TCPFlagRST)), BitmaskAny(uint64(TCPFlagFIN))},
+			format: "tcp-flags rst,fin",
+			match:  []TCPFlags{TCPFlagRST, TCPFlagFIN | TCPFlagACK},
+			miss:   []TCPFlags{TCPFlagACK},
+		},
+		{
+			in:     "all SYN|ACK",
+			want:   []BitmaskOp{BitmaskAll(uint64(TCPFlagSYN | TCPFlagACK))},
+			format: "tcp-flags =syn|ack",
+			match:  []TCPFlags{TCPFlagSYN | TCPFlagACK | TCPFlagPSH},
+			miss:   []TCPFlags{TCPFlagSYN},
+		},
+		{
+			in:     "not all syn|fin",
+			want:   []BitmaskOp{BitmaskNotAll(uint64(TCPFlagSYN | TCPFlagFIN))},
+			format: "tcp-flags !=fin|syn",
+			match:  []TCPFlags{TCPFlagSYN, 0},
+			miss:   []TCPFlags{TCPFlagSYN | TCPFlagFIN},
+		},
+	}
+	for _, tt := range tests {
+		ops, err := ParseTCPFlagsExpr(tt.in)
+		if err != nil || !reflect.DeepEqual(ops, tt.want) {
+			t.Errorf("ParseTCPFlagsExpr(%q) = %+v, %v, want %+v", tt.in, ops, err, tt.want)
+			continue
+		}
+		if got := TCPFlagsComponent(SplitBitmaskOps(ops)...).String(); got != tt.format {
+			t.Errorf("TCPFlagsComponent(%q) = %q, want %q", tt.in, got, tt.format)
+		}
+		for _, f := range tt.match {
+			if !f.Matches(ops) {
+				t.Errorf("%q does not match %v", tt.in, f)
+			}
+		}
+		for _, f := range tt.miss {
+			if f.Matches(ops) {
+				t.Errorf("%q matches %v", tt.in, f)
+			}
+		}
+	}
+	for _, bad := range []string{"", "syn and", "not", "syn ack", "xmas"} {
+		if _, err := ParseTCPFlagsExpr(bad); !errors.Is(err, ErrSyntax) {
+			t.Errorf("ParseTCPFlagsExpr(%q) error = %v, want %v", bad, err, ErrSyntax)
+		}
+	}
+	if f, err := ParseTCPFlags("syn|ack"); err != nil || f != TCPFlagSYN|TCPFlagACK || f.String() != "syn|ack" {
+		t.Errorf("ParseTCPFlags() = %v, %v", f, err)
+	}
+}
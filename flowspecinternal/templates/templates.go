@@ -0,0 +1,170 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+// Package templates builds the rules of common DDoS mitigations from a
+// victim prefix and a few parameters, so that an operator under attack does
+// not write component lists by hand:
+//
+//	rule, err := templates.UDPAmplification(victim, nil)
+//	// match dst 192.0.2.10/32 proto udp sport =19,=53,=123,=389,=11211 then discard
+//
+// Every rule is checked before it is returned: its components round-trip
+// through the NLRI encoding, pass fs.CheckComponents for the family of the
+// victim and its actions pass actions.Validate.
+package templates
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/actions"
+)
+
+var (
+	ErrInvalidVictim = errors.New("templates: victim is not a valid prefix")
+	ErrNeedRate      = errors.New("templates: SYN flood mitigation needs a rate, discarding all SYNs blocks every new connection")
+	ErrInvalidRule   = errors.New("templates: generated rule is invalid")
+)
+
+// UDP source ports of the reflection protocols UDPAmplification blocks by
+// default.
+const (
+	PortChargen   = 19
+	PortDNS       = 53
+	PortNTP       = 123
+	PortCLDAP     = 389
+	PortMemcached = 11211
+)
+
+// AmplificationPorts are the default ports of UDPAmplification.
+var AmplificationPorts = []uint16{PortChargen, PortDNS, PortNTP, PortCLDAP, PortMemcached}
+
+// IP protocols the templates match.
+const (
+	protoTCP = 6
+	protoUDP = 17
+)
+
+// Options tunes a template.
+type Options struct {
+	// Ports replaces the ports a template matches: the reflector source
+	// ports of UDPAmplification, the destination ports of SYNFlood, which
+	// matches any port by default. FragmentDrop ignores it, fragments
+	// other than the first carry no ports.
+	Ports []uint16
+	// Rate, if positive, limits matching traffic to Rate bytes per second
+	// instead of discarding it. SYNFlood requires it.
+	Rate float32
+	// AS is the informational AS of a rate-limit action.
+	AS uint16
+}
+
+// UDPAmplification returns the rule discarding, or rate limiting, UDP
+// traffic toward victim from the source ports of reflection protocols,
+// AmplificationPorts unless opts.Ports is set. Legitimate replies to
+// queries the victim sends itself match as well.
+func UDPAmplification(victim netip.Prefix, opts *Options) (actions.Rule, error) {
+	o := options(opts)
+	ports := o.Ports
+	if ports == nil {
+		ports = AmplificationPorts
+	}
+	sport, err := fs.PortComponent(fs.ComponentTypeSourcePort, portRanges(ports)...)
+	if err != nil {
+		return actions.Rule{}, err
+	}
+	return build(victim, o, protocol(protoUDP), sport)
+}
+
+// SYNFlood returns the rule limiting TCP SYNs without ACK toward victim,
+// to the destination ports of opts.Ports or any port, to opts.Rate bytes
+// per second. Without a rate it returns ErrNeedRate.
+func SYNFlood(victim netip.Prefix, opts *Options) (actions.Rule, error) {
+	o := options(opts)
+	if !(o.Rate > 0) {
+		return actions.Rule{}, ErrNeedRate
+	}
+	comps := []fs.FSComponent{protocol(protoTCP)}
+	if len(o.Ports) > 0 {
+		dport, err := fs.PortComponent(fs.ComponentTypeDestinationPort, portRanges(o.Ports)...)
+		if err != nil {
+			return actions.Rule{}, err
+		}
+		comps = append(comps, dport)
+	}
+	syn := fs.TCPFlagsComponent([]fs.BitmaskOp{fs.BitmaskAny(uint64(fs.TCPFlagSYN)), fs.BitmaskNone(uint64(fs.TCPFlagACK))})
+	return build(victim, o, append(comps, syn)...)
+}
+
+// FragmentDrop returns the rule discarding, or rate limiting, fragmented
+// packets of any protocol toward victim, as sent by fragment floods and by
+// amplification attacks whose replies exceed the MTU.
+func FragmentDrop(victim netip.Prefix, opts *Options) (actions.Rule, error) {
+	o := options(opts)
+	return build(victim, o, fs.FragmentComponent([]fs.BitmaskOp{fs.BitmaskAny(uint64(fs.FragmentIsF))}))
+}
+
+func options(opts *Options) Options {
+	var o Options
+	if opts != nil {
+		o = *opts
+	}
+	return o
+}
+
+// build returns the rule of victim followed by comps, which must be in
+// increasing type order, with the action of o, and checks it.
+func build(victim netip.Prefix, o Options, comps ...fs.FSComponent) (actions.Rule, error) {
+	if !victim.IsValid() {
+		return actions.Rule{}, ErrInvalidVictim
+	}
+	dst := victim.Masked()
+	r := actions.Rule{
+		Components: fs.FSComponentList{Components: append([]fs.FSComponent{{Type: fs.ComponentTypeDestinationPrefix, Prefix: &dst}}, comps...)},
+		Actions:    []actions.Action{actions.TrafficRateBytes{AS: o.AS, Rate: max(o.Rate, 0)}},
+	}
+	afi := fs.AFIIPv4
+	if dst.Addr().Is6() {
+		afi = fs.AFIIPv6
+	}
+	if err := check(r, afi); err != nil {
+		return actions.Rule{}, fmt.Errorf("%w: %s: %w", ErrInvalidRule, r.Components, err)
+	}
+	return r, nil
+}
+
+// check validates r as a receiver of it would.
+func check(r actions.Rule, afi uint16) error {
+	b, err := fs.EncodeNLRI(r.Components, afi)
+	if err != nil {
+		return err
+	}
+	if _, _, err := fs.DecodeNLRI(b, afi); err != nil {
+		return err
+	}
+	if errs := fs.CheckComponents(r.Components, afi); len(errs) > 0 {
+		return errs[0]
+	}
+	for _, a := range r.Actions {
+		if err := actions.Validate(a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// protocol returns the IP protocol component matching p only.
+func protocol(p uint8) fs.FSComponent {
+	return fs.FSComponent{Type: fs.ComponentTypeIpProtocol, Raw: fs.EncodeNumericOps([]fs.NumericOp{{EQ: true, Value: uint64(p)}})}
+}
+
+func portRanges(ports []uint16) []fs.PortRange {
+	out := make([]fs.PortRange, len(ports))
+	for i, p := range ports {
+		out[i] = fs.PortRange{From: p, To: p}
+	}
+	return out
+}
@@ -0,0 +1,66 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package templates
+
+import (
+	"errors"
+	"net/netip"
+	"testing"
+
+	"floofspectools/flowspecinternal/actions"
+)
+
+func TestTemplates(t *testing.T) {
+	v4 := netip.MustParsePrefix("192.0.2.10/32")
+	v6 := netip.MustParsePrefix("2001:db8::1/128")
+	tests := []struct {
+		name  string
+		build func(netip.Prefix, *Options) (actions.Rule, error)
+		pfx   netip.Prefix
+		opts  *Options
+		want  string
+	}{
+		{"UDPAmplification", UDPAmplification, v4, nil,
+			"match dst 192.0.2.10/32 proto udp sport =19,=53,=123,=389,=11211 then discard"},
+		{"UDPAmplificationPortsRate", UDPAmplification, v6, &Options{Ports: []uint16{53}, Rate: 1e6},
+			"match dst 2001:db8::1/128 proto udp sport =53 then rate-limit 1M"},
+		{"SYNFlood", SYNFlood, netip.MustParsePrefix("192.0.2.77/24"), &Options{Rate: 125000},
+			"match dst 192.0.2.0/24 proto tcp tcp-flags syn&!ack then rate-limit 125k"},
+		{"SYNFloodPorts", SYNFlood, v4, &Options{Ports: []uint16{443, 80, 81}, Rate: 125000},
+			"match dst 192.0.2.10/32 proto tcp dport =80,=81,=443 tcp-flags syn&!ack then rate-limit 125k"},
+		{"FragmentDrop", FragmentDrop, v4, &Options{Ports: []uint16{53}},
+			"match dst 192.0.2.10/32 frag isf then discard"},
+		{"FragmentDropIPv6", FragmentDrop, v6, nil,
+			"match dst 2001:db8::1/128 frag isf then discard"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := tt.build(tt.pfx, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			comps, acts, err := actions.ParseRule(tt.want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := actions.CanonicalRule(r.Components, r.Actions, nil), actions.CanonicalRule(comps, acts, nil); got != want {
+				t.Errorf("rule = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestTemplatesErrors(t *testing.T) {
+	v4 := netip.MustParsePrefix("192.0.2.10/32")
+	if _, err := UDPAmplification(netip.Prefix{}, nil); !errors.Is(err, ErrInvalidVictim) {
+		t.Errorf("UDPAmplification(invalid) error = %v, want %v", err, ErrInvalidVictim)
+	}
+	if _, err := SYNFlood(v4, nil); !errors.Is(err, ErrNeedRate) {
+		t.Errorf("SYNFlood(no rate) error = %v, want %v", err, ErrNeedRate)
+	}
+	if _, err := FragmentDrop(v4, &Options{Rate: -1}); err != nil {
+		t.Errorf("FragmentDrop(negative rate) error = %v, want a discard rule", err)
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+// Package tracing instruments the FlowSpec validation pipeline with
+// OpenTelemetry spans.
+//
+// The functions wrap their uninstrumented counterparts with a span started
+// from ctx, so a controller that traces its own request handling sees
+// decoding, validation and RIB changes as child spans. Failures set the span
+// status to error and record the reason. A nil TracerProvider uses the
+// global one, which does nothing until the application installs an SDK.
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/rib"
+)
+
+// ScopeName is the instrumentation scope of the spans.
+const ScopeName = "floofspectools/flowspecinternal"
+
+// Span attribute keys.
+const (
+	AttrPeer    = attribute.Key("flowspec.peer")
+	AttrPrefix  = attribute.Key("flowspec.prefix")
+	AttrRule    = attribute.Key("flowspec.rule")
+	AttrAFI     = attribute.Key("flowspec.afi")
+	AttrReason  = attribute.Key("flowspec.reason")
+	AttrRFCRule = attribute.Key("flowspec.rfc_rule")
+)
+
+// Tracer returns the tracer of tp, or of the global provider when tp is nil.
+func Tracer(tp trace.TracerProvider) trace.Tracer {
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	return tp.Tracer(ScopeName)
+}
+
+// RouteAttributes describes r for a span.
+func RouteAttributes(r *fs.FlowSpecRoute) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		AttrPeer.Int64(int64(r.NeighborAS)),
+		AttrAFI.Int(int(r.AFI)),
+		AttrRule.String(r.Components.Canonical(nil)),
+	}
+	if r.DestPrefix != nil {
+		attrs = append(attrs, AttrPrefix.String(r.DestPrefix.String()))
+	}
+	return attrs
+}
+
+// End records err on span, if any, and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		span.SetAttributes(AttrReason.String(fs.Reason(err)))
+		if rule := fs.RFCRule(err); rule != "" {
+			span.SetAttributes(AttrRFCRule.String(rule))
+		}
+	}
+	span.End()
+}
+
+// ValidateFeasibility is fs.ValidateFeasibilityCtx in a "flowspec.validate"
+// span, whose context is passed on to UnicastRIBCtx lookups.
+func ValidateFeasibility(ctx context.Context, tp trace.TracerProvider, r *fs.FlowSpecRoute, unicast fs.UnicastRIB, cfg *fs.Config) error {
+	ctx, span := Tracer(tp).Start(ctx, "flowspec.validate")
+	if span.IsRecording() {
+		span.SetAttributes(RouteAttributes(r)...)
+	}
+	err := fs.ValidateFeasibilityCtx(ctx, r, unicast, cfg)
+	End(span, err)
+	return err
+}
+
+// DecodeNLRI is fs.DecodeNLRI in a "flowspec.decode" span.
+func DecodeNLRI(ctx context.Context, tp trace.TracerProvider, b []byte, afi uint16) (fs.FSComponentList, int, error) {
+	_, span := Tracer(tp).Start(ctx, "flowspec.decode", trace.WithAttributes(AttrAFI.Int(int(afi))))
+	l, n, err := fs.DecodeNLRI(b, afi)
+	if err == nil && span.IsRecording() {
+		span.SetAttributes(AttrRule.String(l.Canonical(nil)), attribute.Int("flowspec.nlri_length", n))
+	}
+	End(span, err)
+	return l, n, err
+}
+
+// Insert is FlowSpecRIB.Insert in a "flowspec.rib.insert" span. The span
+// covers publishing the events, so slow subscribers show up in it.
+func Insert(ctx context.Context, tp trace.TracerProvider, r *rib.FlowSpecRIB, route *fs.FlowSpecRoute, err error) {
+	_, span := Tracer(tp).Start(ctx, "flowspec.rib.insert")
+	r.Insert(route, err)
+	if span.IsRecording() {
+		span.SetAttributes(RouteAttributes(route)...)
+		span.SetAttributes(attribute.Bool("flowspec.feasible", err == nil), attribute.Int("flowspec.rib_routes", r.Snapshot().Len()))
+	}
+	span.End()
+}
@@ -0,0 +1,73 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/rib"
+)
+
+func TestSpans(t *testing.T) {
+	exp := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exp))
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "request")
+
+	// dst 192.0.2.0/24
+	l, _, err := DecodeNLRI(ctx, tp, []byte{0x05, 0x01, 0x18, 0xc0, 0x00, 0x02}, fs.AFIIPv4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	route := &fs.FlowSpecRoute{AFI: fs.AFIIPv4, NeighborAS: 64500, Components: l, DestPrefix: l.Components[0].Prefix}
+	unicast := rib.NewTrie()
+	verr := ValidateFeasibility(ctx, tp, route, unicast, nil)
+	Insert(ctx, tp, rib.NewFlowSpecRIB(nil), route, verr)
+	parent.End()
+
+	spans := exp.GetSpans()
+	if len(spans) != 4 {
+		t.Fatalf("got %d spans, want 4", len(spans))
+	}
+	byName := map[string]tracetest.SpanStub{}
+	for _, s := range spans {
+		byName[s.Name] = s
+	}
+	for _, name := range []string{"flowspec.decode", "flowspec.validate", "flowspec.rib.insert"} {
+		s, ok := byName[name]
+		if !ok {
+			t.Fatalf("no %s span", name)
+		}
+		if s.Parent.SpanID() != parent.SpanContext().SpanID() {
+			t.Errorf("%s span is not a child of the request span", name)
+		}
+	}
+
+	v := byName["flowspec.validate"]
+	if v.Status.Code != codes.Error {
+		t.Errorf("validate span status = %v, want Error", v.Status.Code)
+	}
+	want := map[attribute.Key]attribute.Value{
+		AttrPeer:    attribute.Int64Value(64500),
+		AttrPrefix:  attribute.StringValue("192.0.2.0/24"),
+		AttrReason:  attribute.StringValue("no-best-unicast"),
+		AttrRFCRule: attribute.StringValue("b"),
+	}
+	got := map[attribute.Key]attribute.Value{}
+	for _, kv := range v.Attributes {
+		got[kv.Key] = kv.Value
+	}
+	for k, w := range want {
+		if got[k] != w {
+			t.Errorf("validate span %s = %v, want %v", k, got[k].Emit(), w.Emit())
+		}
+	}
+}
@@ -5,45 +5,254 @@
 package flowspecinternal
 
 import (
+	"context"
+	"log/slog"
 	"net"
 	"net/netip"
+	"slices"
 )
 
 // FlowSpecRoute represents the bits we need for RFC8955/9117 feasibility.
-// ToDo: extend, e.g. src prefix or segments
+// ToDo: extend, e.g. segments
 type FlowSpecRoute struct {
 	DestPrefix   *netip.Prefix
 	FromEBGP     bool
 	NeighborAS   uint32
-	ASPath       []uint32
-	OriginatorID net.IP
+	ASPath       []uint32   // AS_SEQUENCE and AS_SET members, confederation segments excluded
+	OriginatorID netip.Addr // zero if the route has none
+	// PeerRouterID is the BGP Identifier of the peer the route was
+	// received from, its originator when OriginatorID is zero.
+	PeerRouterID netip.Addr
+	// ClusterList holds the CLUSTER_IDs of the route reflectors the route
+	// passed, the most recent first (RFC4456 8).
+	ClusterList []netip.Addr
+	// NextHop is the next hop of the MP_REACH_NLRI, zero for plain RFC8955
+	// routes, which have none. Redirect-to-IP rules carry their target
+	// here (draft-ietf-idr-flowspec-redirect-ip).
+	NextHop netip.Addr
+
+	// Fields below are filled when decoding from the wire, they are not used
+	// by ValidateFeasibility but for AFI: if set, DestPrefix must be of its
+	// family.
+
+	AFI        uint16 // AFIIPv4 or AFIIPv6
+	SAFI       uint8  // SAFIFlowSpec or SAFIFlowSpecVPN
+	RD         [8]byte
+	Components FSComponentList
+	// ExtCommunities holds the route's extended communities, including the
+	// traffic filtering actions; decode them with the actions subpackage.
+	ExtCommunities [][8]byte
+	// Communities holds the route's RFC1997 communities, e.g.
+	// CommunityLLGRStale.
+	Communities []uint32
+
+	// Priority ranks the route among those of its peer when Limits.Overflow
+	// is OverflowEvict, higher is kept longer. It is local metadata and
+	// never encoded.
+	Priority int
+	// Metadata holds the provenance of the route, e.g. the originating
+	// system, a ticket or a customer. It is local metadata, never encoded
+	// and not part of the rule's identity.
+	Metadata map[string]string
+}
+
+// Well-known communities of long-lived graceful restart (RFC9494 4).
+const (
+	// CommunityLLGRStale marks a route retained after the graceful restart
+	// of its peer; it is least preferred.
+	CommunityLLGRStale uint32 = 0xffff0006
+	// CommunityNoLLGR marks a route that must not be retained as long-lived
+	// stale.
+	CommunityNoLLGR uint32 = 0xffff0007
+)
+
+// HasCommunity reports whether r carries the RFC1997 community c.
+func (r *FlowSpecRoute) HasCommunity(c uint32) bool {
+	return slices.Contains(r.Communities, c)
 }
 
 // UnicastRoute is the minimal info we need from the unicast RIB.
 type UnicastRoute struct {
-	Prefix       netip.Prefix
-	NeighborAS   uint32 // Support for rfc6793
-	ASPath       []uint32
-	OriginatorID net.IP
+	Prefix       netip.Prefix `json:"prefix"`
+	NeighborAS   uint32       `json:"neighbor_as"` // Support for rfc6793
+	ASPath       []uint32     `json:"as_path"`
+	OriginatorID netip.Addr   `json:"originator_id,omitzero"`
+	// PeerRouterID is the BGP Identifier of the peer the route was received
+	// from, see FlowSpecRoute.PeerRouterID.
+	PeerRouterID netip.Addr `json:"peer_router_id,omitzero"`
+	// ClusterList holds the CLUSTER_IDs of the route reflectors the route
+	// passed, see FlowSpecRoute.ClusterList.
+	ClusterList []netip.Addr `json:"cluster_list,omitempty"`
+	// PathID tells apart the paths of a prefix received with Add-Path
+	// (RFC7911), 0 otherwise.
+	PathID uint32 `json:"path_id,omitempty"`
+}
+
+// SetOriginatorIP sets OriginatorID from ip in its 4 or 16 byte form, IPv4
+// as a 4 byte address either way; nil clears it.
+func (r *FlowSpecRoute) SetOriginatorIP(ip net.IP) {
+	r.OriginatorID = originatorAddr(ip)
+}
+
+// SetOriginatorIP sets OriginatorID from ip, see FlowSpecRoute.SetOriginatorIP.
+func (r *UnicastRoute) SetOriginatorIP(ip net.IP) {
+	r.OriginatorID = originatorAddr(ip)
+}
+
+// Originator returns the router that originated r into the AS: its
+// ORIGINATOR_ID if reflected (RFC4456 8), else the BGP Identifier of the
+// peer it came from (RFC9117 4.1), the zero Addr if neither is known.
+func (r *FlowSpecRoute) Originator() netip.Addr {
+	return originator(r.OriginatorID, r.PeerRouterID)
+}
+
+// Originator returns the originator of r, see FlowSpecRoute.Originator.
+func (r *UnicastRoute) Originator() netip.Addr {
+	return originator(r.OriginatorID, r.PeerRouterID)
+}
+
+func originator(originatorID, peerRouterID netip.Addr) netip.Addr {
+	if originatorID.IsValid() {
+		return originatorID.Unmap()
+	}
+	return peerRouterID.Unmap()
+}
+
+func originatorAddr(ip net.IP) netip.Addr {
+	a, _ := netip.AddrFromSlice(ip)
+	return a.Unmap()
 }
 
 // UnicastRIB ToDo: intended to be an interface to operations performed on RIB
 type UnicastRIB interface {
 	BestPath(p netip.Prefix) *UnicastRoute
 	MoreSpecifics(p netip.Prefix) []*UnicastRoute
+	// AllPaths returns the paths of the longest prefix match covering p,
+	// the best path first; a RIB without Add-Path returns the best path
+	// only.
+	AllPaths(p netip.Prefix) []*UnicastRoute
+}
+
+// UnicastRIBCtx is a UnicastRIB whose lookups may block on an external
+// backend such as a gRPC service, an RTR cache or a database.
+// ValidateFeasibilityCtx uses the Ctx methods, which should return early
+// with ctx.Err() once ctx is done; other callers keep using the plain ones.
+type UnicastRIBCtx interface {
+	UnicastRIB
+	BestPathCtx(ctx context.Context, p netip.Prefix) (*UnicastRoute, error)
+	MoreSpecificsCtx(ctx context.Context, p netip.Prefix) ([]*UnicastRoute, error)
+	AllPathsCtx(ctx context.Context, p netip.Prefix) ([]*UnicastRoute, error)
 }
 
 // Config to reflect options in RFC ToDo: extend with options for user
 type Config struct {
 	// AllowNoDestPrefix as per RFC8955 6.
 	// "However, rule a MAY be relaxed by explicit configuration"
-	AllowNoDestPrefix bool
+	AllowNoDestPrefix bool `json:"allow_no_dest_prefix"`
 
 	// EnableEmptyOrConfed as per RFC 9117 4.1 b) 2.1
-	EnableEmptyOrConfed bool
+	EnableEmptyOrConfed bool `json:"enable_empty_or_confed"`
+
+	// AnyPath relaxes rule b) to accept a rule if any path of the best
+	// matching prefix, not only the best one, is from its originator, as
+	// several implementations do with Add-Path or multipath. Rule c) and
+	// the left-most AS check then use that path.
+	AnyPath bool `json:"any_path,omitempty"`
+
+	// ClusterID, if set, is the CLUSTER_ID of the local route reflection
+	// cluster: a route whose CLUSTER_LIST holds it looped through the
+	// cluster and is rejected with ErrClusterLoop (RFC4456 8).
+	ClusterID netip.Addr `json:"cluster_id,omitzero"`
+
+	// SameCluster extends rule b) for route reflector topologies: the rule
+	// and the unicast path it is validated against must have been
+	// reflected first by the same cluster, the last of their CLUSTER_LIST,
+	// or both not at all, else ErrClusterMismatch.
+	SameCluster bool `json:"same_cluster,omitempty"`
+
+	// ValidateNextHop checks the NextHop of routes having one: a martian
+	// next hop returns ErrNextHopMartian, one without a covering route in
+	// the unicast RIB ErrNextHopUnresolved.
+	ValidateNextHop bool `json:"validate_next_hop,omitempty"`
+
+	// ScreenMartians rejects rules for a default route or a destination
+	// within Martians with ErrMartianDestination, before the unicast RIB
+	// is consulted.
+	ScreenMartians bool `json:"screen_martians,omitempty"`
+	// Martians replaces DefaultMartians for ScreenMartians.
+	Martians []netip.Prefix `json:"martians,omitempty"`
+
+	// MinPrefixLenIPv4 and MinPrefixLenIPv6, if set, reject rules whose
+	// destination prefix is shorter with ErrDestinationTooBroad, as a
+	// discard rule for a default route would black-hole all traffic. See
+	// DefaultMinPrefixLenIPv4 and DefaultMinPrefixLenIPv6.
+	MinPrefixLenIPv4 int `json:"min_prefix_len_ipv4,omitempty"`
+	MinPrefixLenIPv6 int `json:"min_prefix_len_ipv6,omitempty"`
+	// BroadPrefixesAllowed lists the destination prefixes exempt from
+	// MinPrefixLenIPv4 and MinPrefixLenIPv6.
+	BroadPrefixesAllowed []netip.Prefix `json:"broad_prefixes_allowed,omitempty"`
+
+	// LeftMostASExempt lists the neighbor ASes whose routes skip the
+	// RFC9117 4.2 left-most AS check, e.g. route servers that do not
+	// prepend their AS (RFC7947 2.2.2.1) and relay rules for prefixes
+	// whose unicast routes they learned elsewhere.
+	LeftMostASExempt []uint32 `json:"left_most_as_exempt,omitempty"`
+
+	// LeftMostASRelaxed lists neighbor ASes for which the left-most AS
+	// check also passes when the unicast best path was received from the
+	// same neighbor AS, e.g. a route server passing on both from different
+	// clients.
+	LeftMostASRelaxed []uint32 `json:"left_most_as_relaxed,omitempty"`
 
 	// ASPathPolicy as per RFC9117 4.1 b) 2.3
-	ASPathPolicy ASPathPolicy
+	// It is not serialized to JSON.
+	ASPathPolicy ASPathPolicy `json:"-"`
+
+	// Strict rejects rules whose component values no packet header can
+	// carry, see CheckComponents.
+	Strict bool `json:"strict,omitempty"`
+
+	// StrictProtocol also rejects ICMP, port and TCP flag components that
+	// contradict the IP protocol component instead of accepting rules that
+	// never match.
+	StrictProtocol bool `json:"strict_protocol,omitempty"`
+
+	// TCPFlagsNeedTCP warns about or rejects rules with a TCP flags
+	// component whose IP protocol component does not restrict them to
+	// tcp, see CheckTCPFlagsProtocol.
+	TCPFlagsNeedTCP Enforcement `json:"tcp_flags_need_tcp,omitempty"`
+
+	// PacketLengthCheck warns about or rejects rules with a packet length
+	// component comparing against lengths above LinkMTU or below the IP
+	// header, see CheckPacketLength. A LinkMTU of 0 stands for 65535.
+	PacketLengthCheck Enforcement `json:"packet_length_check,omitempty"`
+	LinkMTU           uint32      `json:"link_mtu,omitempty"`
+
+	// MalformedNLRI and MalformedAttribute select the RFC7606 handling of
+	// malformed UPDATE contents, see NLRIErrorHandling and
+	// AttributeErrorHandling. Errors that leave the NLRI boundaries unknown
+	// always reset the session.
+	MalformedNLRI      ErrorHandling `json:"malformed_nlri,omitempty"`
+	MalformedAttribute ErrorHandling `json:"malformed_attribute,omitempty"`
+
+	// OriginAuthorizer, if set, is consulted after the RFC rules: a route
+	// whose destination prefix it finds invalid for the announcing AS is
+	// rejected with ErrOriginUnauthorized. It is not serialized to JSON.
+	OriginAuthorizer OriginAuthorizer `json:"-"`
+
+	// RequireOriginValid also rejects routes the OriginAuthorizer has no
+	// authorization for.
+	RequireOriginValid bool `json:"require_origin_valid,omitempty"`
+
+	// ExperimentalL2VPN decodes L2VPN FlowSpec NLRI (AFI 25, SAFI 134) with
+	// the Ethernet components of draft-ietf-idr-flowspec-l2vpn instead of
+	// ignoring the family. Their routes have no destination prefix, so
+	// ValidateFeasibility rejects them unless AllowNoDestPrefix is set.
+	ExperimentalL2VPN bool `json:"experimental_l2vpn,omitempty"`
+
+	// Logger, if set, receives the results of ValidateFeasibility.
+	// It is not serialized to JSON.
+	Logger *slog.Logger `json:"-"`
 }
 
 // ASPathPolicy ToDo: Implement, for now just a stub
@@ -59,14 +268,37 @@ const (
 	ComponentTypeSourcePrefix      ComponentType = 2
 	ComponentTypeIpProtocol        ComponentType = 3
 	ComponentTypePort              ComponentType = 4
-	// TODO: ComponentType 5 to 12
+	ComponentTypeDestinationPort   ComponentType = 5
+	ComponentTypeSourcePort        ComponentType = 6
+	ComponentTypeICMPType          ComponentType = 7
+	ComponentTypeICMPCode          ComponentType = 8
+	ComponentTypeTCPFlags          ComponentType = 9
+	ComponentTypePacketLength      ComponentType = 10
+	ComponentTypeDSCP              ComponentType = 11
+	ComponentTypeFragment          ComponentType = 12
+
+	// Ethernet components of draft-ietf-idr-flowspec-l2vpn, only valid in
+	// NLRI of AFIL2VPN. MAC components carry an address, the others numeric
+	// operators.
+	ComponentTypeEthernetType   ComponentType = 14
+	ComponentTypeSourceMAC      ComponentType = 15
+	ComponentTypeDestinationMAC ComponentType = 16
+	ComponentTypeVLANID         ComponentType = 21
+	ComponentTypeInnerVLANID    ComponentType = 23
 )
 
+// IsBitmask reports whether components of type t carry bitmask operators
+// (RFC8955 4.2.1.2) rather than numeric operators (RFC8955 4.2.1.1).
+func (t ComponentType) IsBitmask() bool {
+	return t == ComponentTypeTCPFlags || t == ComponentTypeFragment
+}
+
 // FSComponent represents a single FlowSpec NLRI component as per RFC8955 4.2.2.
 //
 // For type 1/2, Prefix is used.
 // For all other types, Raw is used to
-// carrie the NLRI-encoded "value" bytes for comparison as per RFC8955 section 5.1
+// carrie the NLRI-encoded "value" bytes for comparison as per RFC8955 section 5.1,
+// for MAC components the length octet and the address.
 type FSComponent struct {
 	Type   ComponentType
 	Prefix *netip.Prefix
@@ -5,20 +5,154 @@
 package flowspecinternal
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"log/slog"
 	"net/netip"
+	"slices"
 )
 
 var (
-	ErrNoDestinationPrefix           = errors.New("flowspec: NLRI discarded: destination prefix component not present; operator-configured requirement violated (RFC8955-a)")
-	ErrNoBestUnicast                 = errors.New("flowspec: NLRI infeasible: no valid unicast best-path exists for embedded destination; forwarding context undefined")
-	ErrOriginatorValidationFailed    = errors.New("flowspec: NLRI infeasible: originator/AS_PATH validation failed against unicast best-path (RFC8955/9117-b); announce-source not authorized")
-	ErrMoreSpecificFromOtherNeighbor = errors.New("flowspec: NLRI infeasible: more-specific unicast prefix advertised by different upstream AS detected (RFC8955-c); rule conflicts with routing topology")
-	ErrLeftMostASMismatch            = errors.New("flowspec: NLRI rejected: eBGP AS_PATH left-most AS mismatch relative to unicast best-path (RFC9117); route-server or peer topology inconsistency")
+	ErrNoDestinationPrefix           = NewError(StageFeasibility, "no-destination-prefix", "RFC8955 6 a)", "flowspec: NLRI discarded: destination prefix component not present; operator-configured requirement violated (RFC8955-a)")
+	ErrNoBestUnicast                 = NewError(StageFeasibility, "no-best-unicast", "RFC8955 6 b)", "flowspec: NLRI infeasible: no valid unicast best-path exists for embedded destination; forwarding context undefined")
+	ErrOriginatorValidationFailed    = NewError(StageFeasibility, "originator-validation-failed", "RFC9117 4.1 b)", "flowspec: NLRI infeasible: originator/AS_PATH validation failed against unicast best-path (RFC8955/9117-b); announce-source not authorized")
+	ErrMoreSpecificFromOtherNeighbor = NewError(StageFeasibility, "more-specific-from-other-neighbor", "RFC8955 6 c)", "flowspec: NLRI infeasible: more-specific unicast prefix advertised by different upstream AS detected (RFC8955-c); rule conflicts with routing topology")
+	ErrLeftMostASMismatch            = NewError(StageFeasibility, "left-most-as-mismatch", "RFC9117 4.2", "flowspec: NLRI rejected: eBGP AS_PATH left-most AS mismatch relative to unicast best-path (RFC9117); route-server or peer topology inconsistency")
+	ErrRIBLookup                     = NewError(StageFeasibility, "rib-lookup-failed", "", "flowspec: NLRI not validated: unicast RIB lookup failed")
+	ErrClusterLoop                   = NewError(StageFeasibility, "cluster-loop", "RFC4456 8", "flowspec: NLRI discarded: CLUSTER_LIST contains the local CLUSTER_ID (RFC4456 8); route reflection loop")
+	ErrClusterMismatch               = NewError(StageFeasibility, "cluster-mismatch", "", "flowspec: NLRI infeasible: originating cluster differs from that of the unicast best-path; announce-source not authorized")
+	ErrNextHopMartian                = NewError(StageFeasibility, "next-hop-martian", "RFC6890", "flowspec: NLRI infeasible: next hop is a martian address; redirect target not routable")
+	ErrNextHopUnresolved             = NewError(StageFeasibility, "next-hop-unresolved", "", "flowspec: NLRI infeasible: next hop does not resolve in the unicast RIB; redirect target unreachable")
+	ErrMartianDestination            = NewError(StagePolicy, "martian-destination", "RFC6890", "flowspec: NLRI discarded: destination prefix is a martian or reserved range (RFC6890)")
+	ErrDestinationTooBroad           = NewError(StagePolicy, "destination-too-broad", "", "flowspec: NLRI discarded: destination prefix shorter than the configured minimum length; rule too broad")
+	ErrAddressFamilyMismatch         = NewError(StageFeasibility, "address-family-mismatch", "RFC8956 3", "flowspec: NLRI discarded: destination prefix is not of the NLRI address family (RFC8955 4 / RFC8956 3)")
 )
 
-// ValidateFeasibility applies the RFC8955 and RFC9117 feasibility rules
+// rfcRules names the feasibility rule each error stems from.
+var rfcRules = []struct {
+	err  error
+	rule string
+}{
+	{ErrNoDestinationPrefix, "a"},
+	{ErrNoBestUnicast, "b"},
+	{ErrOriginatorValidationFailed, "b"},
+	{ErrMoreSpecificFromOtherNeighbor, "c"},
+	{ErrLeftMostASMismatch, "rfc9117"},
+}
+
+// RFCRule returns the feasibility rule err stems from: "a", "b", "c" or
+// "rfc9117" (the left-most AS check), or "" for other errors.
+func RFCRule(err error) string {
+	for _, r := range rfcRules {
+		if errors.Is(err, r.err) {
+			return r.rule
+		}
+	}
+	return ""
+}
+
+// ValidateFeasibility applies the RFC8955 and RFC9117 feasibility rules,
+// then cfg.OriginAuthorizer if set. IPv6 rules (RFC8956) follow the same
+// rules with their destination looked up among the IPv6 routes of rib; the
+// ORIGINATOR_ID stays a 4 octet router id for both families. Rule b)
+// compares the Originator of the rule and the unicast route, so routes not
+// reflected are compared by the BGP Identifiers of their peers.
+// Infeasible routes are logged at info, feasible ones at debug level to
+// cfg.Logger.
 func ValidateFeasibility(fs *FlowSpecRoute, rib UnicastRIB, cfg *Config) error {
+	ctx := context.Background()
+	err := validateFeasibility(fs, ribLookup{ctx: ctx, rib: rib}, cfg)
+	logFeasibility(ctx, fs, cfg, err)
+	return err
+}
+
+// ValidateFeasibilityCtx is ValidateFeasibility with lookups bounded by ctx.
+// If rib implements UnicastRIBCtx its Ctx methods are used, otherwise ctx is
+// checked before each lookup. A failed lookup or a done ctx returns an
+// ErrRIBLookup wrapping the cause, so errors.Is(err,
+// context.DeadlineExceeded) tells timeouts apart; the route is then neither
+// feasible nor infeasible and is logged at warn level.
+func ValidateFeasibilityCtx(ctx context.Context, fs *FlowSpecRoute, rib UnicastRIB, cfg *Config) error {
+	l := ribLookup{ctx: ctx, rib: rib}
+	l.rctx, _ = rib.(UnicastRIBCtx)
+	err := validateFeasibility(fs, l, cfg)
+	logFeasibility(ctx, fs, cfg, err)
+	return err
+}
+
+func logFeasibility(ctx context.Context, fs *FlowSpecRoute, cfg *Config, err error) {
+	if cfg == nil || cfg.Logger == nil {
+		return
+	}
+	log := SubsystemLogger(cfg.Logger, SubsystemValidation)
+	level, msg := slog.LevelDebug, "flowspec route feasible"
+	if errors.Is(err, ErrRIBLookup) {
+		level, msg = slog.LevelWarn, "flowspec route not validated"
+	} else if err != nil {
+		level, msg = slog.LevelInfo, "flowspec route infeasible"
+	}
+	if !log.Enabled(ctx, level) {
+		return
+	}
+	attrs := []any{LogKeyPeer, fs.NeighborAS, LogKeyRule, fs.Components.Canonical(nil)}
+	if fs.DestPrefix != nil {
+		attrs = append(attrs, LogKeyPrefix, fs.DestPrefix.String())
+	}
+	if err != nil {
+		if rule := RFCRule(err); rule != "" {
+			attrs = append(attrs, LogKeyRFCRule, rule)
+		}
+		attrs = append(attrs, "error", err)
+	}
+	log.Log(ctx, level, msg, attrs...)
+}
+
+// ribLookup runs the lookups of validateFeasibility, through rctx if set.
+type ribLookup struct {
+	ctx  context.Context
+	rib  UnicastRIB
+	rctx UnicastRIBCtx
+}
+
+func (l ribLookup) bestPath(p netip.Prefix) (*UnicastRoute, error) {
+	if l.rctx != nil {
+		return wrapLookup(l.rctx.BestPathCtx(l.ctx, p))
+	}
+	if err := l.ctx.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrRIBLookup, err)
+	}
+	return l.rib.BestPath(p), nil
+}
+
+func (l ribLookup) moreSpecifics(p netip.Prefix) ([]*UnicastRoute, error) {
+	if l.rctx != nil {
+		return wrapLookup(l.rctx.MoreSpecificsCtx(l.ctx, p))
+	}
+	if err := l.ctx.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrRIBLookup, err)
+	}
+	return l.rib.MoreSpecifics(p), nil
+}
+
+func (l ribLookup) allPaths(p netip.Prefix) ([]*UnicastRoute, error) {
+	if l.rctx != nil {
+		return wrapLookup(l.rctx.AllPathsCtx(l.ctx, p))
+	}
+	if err := l.ctx.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrRIBLookup, err)
+	}
+	return l.rib.AllPaths(p), nil
+}
+
+func wrapLookup[T any](v T, err error) (T, error) {
+	if err != nil {
+		return v, fmt.Errorf("%w: %w", ErrRIBLookup, err)
+	}
+	return v, nil
+}
+
+func validateFeasibility(fs *FlowSpecRoute, rib ribLookup, cfg *Config) error {
 	var (
 		best          *UnicastRoute
 		dst           *netip.Prefix
@@ -31,18 +165,43 @@ func ValidateFeasibility(fs *FlowSpecRoute, rib UnicastRIB, cfg *Config) error {
 		}
 	}
 
+	if cfg.ClusterID.IsValid() && slices.ContainsFunc(fs.ClusterList, func(id netip.Addr) bool { return id.Unmap() == cfg.ClusterID.Unmap() }) {
+		return fmt.Errorf("%w: %v", ErrClusterLoop, cfg.ClusterID)
+	}
+
+	if cfg.ValidateNextHop && fs.NextHop.IsValid() {
+		if err := validateNextHop(fs.NextHop, rib); err != nil {
+			return err
+		}
+	}
+
 	// Rule a)
-	dst = fs.DestPrefix
-	if dst == nil {
+	if fs.DestPrefix == nil {
 		if !cfg.AllowNoDestPrefix {
 			return ErrNoDestinationPrefix
 		}
 		// RFC8955: if no dst prefix and explicitly allowed, rules b) and c) are moot
 		return nil
 	}
+	p, err := lookupPrefix(fs)
+	if err != nil {
+		return err
+	}
+	dst = &p
+	if err := cfg.screenBroad(p); err != nil {
+		return err
+	}
+	if cfg.ScreenMartians {
+		if err := cfg.screenMartian(p); err != nil {
+			return err
+		}
+	}
 
 	// Rule b)
-	best = rib.BestPath(*dst)
+	best, err = rib.bestPath(*dst)
+	if err != nil {
+		return err
+	}
 	if best == nil {
 		return ErrNoBestUnicast
 	}
@@ -51,13 +210,31 @@ func ValidateFeasibility(fs *FlowSpecRoute, rib UnicastRIB, cfg *Config) error {
 			goto RuleCCheck
 		}
 	}
-	if !best.OriginatorID.Equal(fs.OriginatorID) {
-		return ErrOriginatorValidationFailed
+	if best.Originator() != fs.Originator() {
+		if !cfg.AnyPath {
+			return ErrOriginatorValidationFailed
+		}
+		paths, err := rib.allPaths(*dst)
+		if err != nil {
+			return err
+		}
+		best = originatorPath(paths, fs.Originator())
+		if best == nil {
+			return ErrOriginatorValidationFailed
+		}
+	}
+	if cfg.SameCluster {
+		if a, b := originCluster(fs.ClusterList), originCluster(best.ClusterList); a != b {
+			return fmt.Errorf("%w: %v, unicast path %v", ErrClusterMismatch, a, b)
+		}
 	}
 
 RuleCCheck:
 	// Rule c)
-	moreSpecifics = rib.MoreSpecifics(*dst)
+	moreSpecifics, err = rib.moreSpecifics(*dst)
+	if err != nil {
+		return err
+	}
 	for _, r := range moreSpecifics {
 		if r.NeighborAS != best.NeighborAS {
 			return ErrMoreSpecificFromOtherNeighbor
@@ -65,7 +242,12 @@ RuleCCheck:
 	}
 
 	// RFC9117: eBGP AS_PATH left-most AS equality check.
-	if fs.FromEBGP == true {
+	if fs.FromEBGP == true && !slices.Contains(cfg.LeftMostASExempt, fs.NeighborAS) {
+		// A transparent route server passes on routes of its clients, the
+		// unicast best path may have been chosen from another one.
+		if slices.Contains(cfg.LeftMostASRelaxed, fs.NeighborAS) && best.NeighborAS == fs.NeighborAS {
+			return checkOrigin(fs, cfg)
+		}
 		// Only empty if the route originates from your own network. No eBGP FlowSpec route should exist
 		// that has control over locally originating prefixes.
 		if len(best.ASPath) == 0 {
@@ -78,5 +260,60 @@ RuleCCheck:
 			return ErrLeftMostASMismatch
 		}
 	}
+	return checkOrigin(fs, cfg)
+}
+
+// lookupPrefix returns the destination prefix of fs as looked up in the
+// unicast RIB: masked, and an IPv4-mapped IPv6 prefix of a rule not marked
+// IPv6 in its IPv4 form, as for OriginatorID. A prefix of the other family
+// than a set fs.AFI returns ErrAddressFamilyMismatch, so an IPv6 rule is
+// never validated against IPv4 routes or the other way round.
+func lookupPrefix(fs *FlowSpecRoute) (netip.Prefix, error) {
+	p := fs.DestPrefix.Masked()
+	if a := p.Addr(); a.Is4In6() && p.Bits() >= 96 && fs.AFI != AFIIPv6 {
+		p = netip.PrefixFrom(a.Unmap(), p.Bits()-96)
+	}
+	switch {
+	case fs.AFI == AFIIPv4 && !p.Addr().Is4(),
+		fs.AFI == AFIIPv6 && !p.Addr().Is6():
+		return p, fmt.Errorf("%w: %v in AFI %d", ErrAddressFamilyMismatch, p, fs.AFI)
+	}
+	return p, nil
+}
+
+// validateNextHop checks that nh is no martian and resolves in rib.
+func validateNextHop(nh netip.Addr, rib ribLookup) error {
+	nh = nh.Unmap()
+	for _, p := range martianNextHops {
+		if p.Contains(nh) {
+			return fmt.Errorf("%w: %v", ErrNextHopMartian, nh)
+		}
+	}
+	best, err := rib.bestPath(netip.PrefixFrom(nh, nh.BitLen()))
+	if err != nil {
+		return err
+	}
+	if best == nil {
+		return fmt.Errorf("%w: %v", ErrNextHopUnresolved, nh)
+	}
+	return nil
+}
+
+// originCluster returns the cluster that reflected a route first, the zero
+// Addr if none did.
+func originCluster(clusterList []netip.Addr) netip.Addr {
+	if len(clusterList) == 0 {
+		return netip.Addr{}
+	}
+	return clusterList[len(clusterList)-1].Unmap()
+}
+
+// originatorPath returns the first of paths from originator.
+func originatorPath(paths []*UnicastRoute, originator netip.Addr) *UnicastRoute {
+	for _, p := range paths {
+		if p.Originator() == originator {
+			return p
+		}
+	}
 	return nil
 }
@@ -5,15 +5,19 @@
 package flowspecinternal
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"net"
 	"net/netip"
 	"testing"
+	"time"
 )
 
 type mockRIB struct {
 	best         *UnicastRoute
 	moreSpecific []*UnicastRoute
+	paths        []*UnicastRoute // additional paths of best's prefix
 }
 
 func (m *mockRIB) BestPath(p netip.Prefix) *UnicastRoute {
@@ -24,6 +28,50 @@ func (m *mockRIB) MoreSpecifics(p netip.Prefix) []*UnicastRoute {
 	return m.moreSpecific
 }
 
+func (m *mockRIB) AllPaths(p netip.Prefix) []*UnicastRoute {
+	if m.best == nil {
+		return nil
+	}
+	return append([]*UnicastRoute{m.best}, m.paths...)
+}
+
+// ctxRIB is a mockRIB behind a backend that fails with err, or blocks until
+// ctx is done if block is set.
+type ctxRIB struct {
+	mockRIB
+	err   error
+	block bool
+}
+
+func (m *ctxRIB) wait(ctx context.Context) error {
+	if m.block {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return m.err
+}
+
+func (m *ctxRIB) BestPathCtx(ctx context.Context, p netip.Prefix) (*UnicastRoute, error) {
+	if err := m.wait(ctx); err != nil {
+		return nil, err
+	}
+	return m.BestPath(p), nil
+}
+
+func (m *ctxRIB) MoreSpecificsCtx(ctx context.Context, p netip.Prefix) ([]*UnicastRoute, error) {
+	if err := m.wait(ctx); err != nil {
+		return nil, err
+	}
+	return m.MoreSpecifics(p), nil
+}
+
+func (m *ctxRIB) AllPathsCtx(ctx context.Context, p netip.Prefix) ([]*UnicastRoute, error) {
+	if err := m.wait(ctx); err != nil {
+		return nil, err
+	}
+	return m.AllPaths(p), nil
+}
+
 type allowAllPolicy struct{}
 
 func (allowAllPolicy) Allows(asPath []uint32) bool { return true }
@@ -53,7 +101,7 @@ func TestValidateFeasibility(t *testing.T) {
 					DestPrefix:   nil,
 					FromEBGP:     false,
 					ASPath:       nil,
-					OriginatorID: net.IPv4(192, 0, 2, 1),
+					OriginatorID: netip.AddrFrom4([4]byte{192, 0, 2, 1}),
 				}
 				return fs, &mockRIB{}, cfg, ErrNoDestinationPrefix
 			},
@@ -70,7 +118,7 @@ func TestValidateFeasibility(t *testing.T) {
 					DestPrefix:   nil,
 					FromEBGP:     false,
 					ASPath:       nil,
-					OriginatorID: net.IPv4(192, 0, 2, 1),
+					OriginatorID: netip.AddrFrom4([4]byte{192, 0, 2, 1}),
 				}
 				return fs, &mockRIB{}, cfg, nil
 			},
@@ -83,13 +131,13 @@ func TestValidateFeasibility(t *testing.T) {
 					DestPrefix:   &dst,
 					FromEBGP:     false,
 					ASPath:       []uint32{65001},
-					OriginatorID: net.IPv4(192, 0, 2, 1),
+					OriginatorID: netip.AddrFrom4([4]byte{192, 0, 2, 1}),
 				}
 				best := &UnicastRoute{
 					Prefix:       mustPrefix("192.88.99.0/24"),
 					NeighborAS:   65001,
 					ASPath:       []uint32{65001},
-					OriginatorID: net.IPv4(192, 0, 2, 1),
+					OriginatorID: netip.AddrFrom4([4]byte{192, 0, 2, 1}),
 				}
 				cfg := &Config{
 					AllowNoDestPrefix:   false,
@@ -106,14 +154,14 @@ func TestValidateFeasibility(t *testing.T) {
 				fs := &FlowSpecRoute{
 					DestPrefix:   &dst,
 					FromEBGP:     false,
-					ASPath:       nil,                    // empty
-					OriginatorID: net.IPv4(192, 0, 2, 2), // different from unicast originator
+					ASPath:       nil,                                    // empty
+					OriginatorID: netip.AddrFrom4([4]byte{192, 0, 2, 2}), // different from unicast originator
 				}
 				best := &UnicastRoute{
 					Prefix:       mustPrefix("192.88.99.0/24"),
 					NeighborAS:   65001,
 					ASPath:       []uint32{65001},
-					OriginatorID: net.IPv4(192, 0, 2, 1),
+					OriginatorID: netip.AddrFrom4([4]byte{192, 0, 2, 1}),
 				}
 				cfg := &Config{
 					AllowNoDestPrefix:   false,
@@ -131,13 +179,13 @@ func TestValidateFeasibility(t *testing.T) {
 					DestPrefix:   &dst,
 					FromEBGP:     false,
 					ASPath:       nil,
-					OriginatorID: net.IPv4(192, 0, 2, 2),
+					OriginatorID: netip.AddrFrom4([4]byte{192, 0, 2, 2}),
 				}
 				best := &UnicastRoute{
 					Prefix:       mustPrefix("192.88.99.0/24"),
 					NeighborAS:   65001,
 					ASPath:       []uint32{65001},
-					OriginatorID: net.IPv4(192, 0, 2, 1),
+					OriginatorID: netip.AddrFrom4([4]byte{192, 0, 2, 1}),
 				}
 				cfg := &Config{
 					AllowNoDestPrefix:   false,
@@ -155,19 +203,19 @@ func TestValidateFeasibility(t *testing.T) {
 					DestPrefix:   &dst,
 					FromEBGP:     false,
 					ASPath:       []uint32{65001},
-					OriginatorID: net.IPv4(192, 0, 2, 1),
+					OriginatorID: netip.AddrFrom4([4]byte{192, 0, 2, 1}),
 				}
 				best := &UnicastRoute{
 					Prefix:       mustPrefix("192.88.99.0/24"),
 					NeighborAS:   65001,
 					ASPath:       []uint32{65001},
-					OriginatorID: net.IPv4(192, 0, 2, 1),
+					OriginatorID: netip.AddrFrom4([4]byte{192, 0, 2, 1}),
 				}
 				more := &UnicastRoute{
 					Prefix:       mustPrefix("192.88.99.0/25"),
 					NeighborAS:   65002, // different upstream AS
 					ASPath:       []uint32{65002},
-					OriginatorID: net.IPv4(192, 0, 2, 3),
+					OriginatorID: netip.AddrFrom4([4]byte{192, 0, 2, 3}),
 				}
 				cfg := &Config{
 					AllowNoDestPrefix:   false,
@@ -186,7 +234,7 @@ func TestValidateFeasibility(t *testing.T) {
 					DestPrefix:   &dst,
 					FromEBGP:     false,
 					ASPath:       []uint32{65001},
-					OriginatorID: net.IPv4(192, 0, 2, 1),
+					OriginatorID: netip.AddrFrom4([4]byte{192, 0, 2, 1}),
 				}
 				cfg := &Config{
 					AllowNoDestPrefix:   false,
@@ -204,13 +252,13 @@ func TestValidateFeasibility(t *testing.T) {
 					DestPrefix:   &dst,
 					FromEBGP:     false,
 					ASPath:       []uint32{65001},
-					OriginatorID: net.IPv4(192, 0, 2, 2),
+					OriginatorID: netip.AddrFrom4([4]byte{192, 0, 2, 2}),
 				}
 				best := &UnicastRoute{
 					Prefix:       mustPrefix("192.88.99.0/24"),
 					NeighborAS:   65001,
 					ASPath:       []uint32{65001},
-					OriginatorID: net.IPv4(192, 0, 2, 1),
+					OriginatorID: netip.AddrFrom4([4]byte{192, 0, 2, 1}),
 				}
 				cfg := &Config{
 					AllowNoDestPrefix:   false,
@@ -228,25 +276,25 @@ func TestValidateFeasibility(t *testing.T) {
 					DestPrefix:   &dst,
 					FromEBGP:     false,
 					ASPath:       []uint32{65001},
-					OriginatorID: net.IPv4(192, 0, 2, 1),
+					OriginatorID: netip.AddrFrom4([4]byte{192, 0, 2, 1}),
 				}
 				best := &UnicastRoute{
 					Prefix:       mustPrefix("192.88.99.0/24"),
 					NeighborAS:   65001,
 					ASPath:       []uint32{65001},
-					OriginatorID: net.IPv4(192, 0, 2, 1),
+					OriginatorID: netip.AddrFrom4([4]byte{192, 0, 2, 1}),
 				}
 				more1 := &UnicastRoute{
 					Prefix:       mustPrefix("192.88.99.0/25"),
 					NeighborAS:   65001,
 					ASPath:       []uint32{65001},
-					OriginatorID: net.IPv4(192, 0, 2, 3),
+					OriginatorID: netip.AddrFrom4([4]byte{192, 0, 2, 3}),
 				}
 				more2 := &UnicastRoute{
 					Prefix:       mustPrefix("192.88.99.128/25"),
 					NeighborAS:   65001,
 					ASPath:       []uint32{65001},
-					OriginatorID: net.IPv4(192, 0, 2, 4),
+					OriginatorID: netip.AddrFrom4([4]byte{192, 0, 2, 4}),
 				}
 				cfg := &Config{
 					AllowNoDestPrefix:   false,
@@ -265,13 +313,13 @@ func TestValidateFeasibility(t *testing.T) {
 					DestPrefix:   &dst,
 					FromEBGP:     false,
 					ASPath:       []uint32{}, // ! not nil
-					OriginatorID: net.IPv4(192, 0, 2, 2),
+					OriginatorID: netip.AddrFrom4([4]byte{192, 0, 2, 2}),
 				}
 				best := &UnicastRoute{
 					Prefix:       mustPrefix("192.88.99.0/24"),
 					NeighborAS:   65001,
 					ASPath:       []uint32{65001},
-					OriginatorID: net.IPv4(192, 0, 2, 1),
+					OriginatorID: netip.AddrFrom4([4]byte{192, 0, 2, 1}),
 				}
 				cfg := &Config{
 					AllowNoDestPrefix:   false,
@@ -289,13 +337,13 @@ func TestValidateFeasibility(t *testing.T) {
 					DestPrefix:   &dst,
 					FromEBGP:     true,
 					ASPath:       []uint32{65001, 64512},
-					OriginatorID: net.IPv4(192, 0, 2, 10),
+					OriginatorID: netip.AddrFrom4([4]byte{192, 0, 2, 10}),
 				}
 				best := &UnicastRoute{
 					Prefix:       mustPrefix("192.88.99.0/24"),
 					NeighborAS:   65001,
 					ASPath:       []uint32{65001, 64496},
-					OriginatorID: net.IPv4(192, 0, 2, 10),
+					OriginatorID: netip.AddrFrom4([4]byte{192, 0, 2, 10}),
 				}
 				cfg := &Config{
 					AllowNoDestPrefix:   false,
@@ -314,13 +362,13 @@ func TestValidateFeasibility(t *testing.T) {
 					DestPrefix:   &dst,
 					FromEBGP:     true,
 					ASPath:       []uint32{65001, 64512},
-					OriginatorID: net.IPv4(192, 0, 2, 10),
+					OriginatorID: netip.AddrFrom4([4]byte{192, 0, 2, 10}),
 				}
 				best := &UnicastRoute{
 					Prefix:       mustPrefix("192.88.99.0/24"),
 					NeighborAS:   65001,
 					ASPath:       []uint32{65001, 64496},
-					OriginatorID: net.IPv4(192, 0, 2, 20),
+					OriginatorID: netip.AddrFrom4([4]byte{192, 0, 2, 20}),
 				}
 				cfg := &Config{
 					AllowNoDestPrefix:   false,
@@ -339,13 +387,13 @@ func TestValidateFeasibility(t *testing.T) {
 					DestPrefix:   &dst,
 					FromEBGP:     true,
 					ASPath:       []uint32{65001},
-					OriginatorID: net.IPv4(192, 0, 2, 10),
+					OriginatorID: netip.AddrFrom4([4]byte{192, 0, 2, 10}),
 				}
 				best := &UnicastRoute{
 					Prefix:       mustPrefix("192.88.99.0/24"),
 					NeighborAS:   60006,
 					ASPath:       []uint32{},
-					OriginatorID: net.IPv4(192, 0, 2, 1),
+					OriginatorID: netip.AddrFrom4([4]byte{192, 0, 2, 1}),
 				}
 				cfg := &Config{
 					AllowNoDestPrefix:   false,
@@ -364,13 +412,13 @@ func TestValidateFeasibility(t *testing.T) {
 					DestPrefix:   &dst,
 					FromEBGP:     false,
 					ASPath:       []uint32{65001},
-					OriginatorID: net.IPv4(192, 0, 2, 1),
+					OriginatorID: netip.AddrFrom4([4]byte{192, 0, 2, 1}),
 				}
 				best := &UnicastRoute{
 					Prefix:       mustPrefix("192.0.2.0/24"),
 					NeighborAS:   65001,
 					ASPath:       []uint32{65001},
-					OriginatorID: net.IPv4(192, 0, 2, 1),
+					OriginatorID: netip.AddrFrom4([4]byte{192, 0, 2, 1}),
 				}
 				return fs, &mockRIB{best: best}, nil, nil
 			},
@@ -383,13 +431,13 @@ func TestValidateFeasibility(t *testing.T) {
 					DestPrefix:   &dst,
 					FromEBGP:     true,
 					ASPath:       []uint32{65002, 65001},
-					OriginatorID: net.IPv4(192, 0, 2, 1),
+					OriginatorID: netip.AddrFrom4([4]byte{192, 0, 2, 1}),
 				}
 				best := &UnicastRoute{
 					Prefix:       mustPrefix("192.88.99.0/24"),
 					NeighborAS:   65001,
 					ASPath:       []uint32{65001, 64512},
-					OriginatorID: net.IPv4(192, 0, 2, 1),
+					OriginatorID: netip.AddrFrom4([4]byte{192, 0, 2, 1}),
 				}
 				cfg := &Config{
 					AllowNoDestPrefix:   false,
@@ -417,3 +465,349 @@ func TestValidateFeasibility(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateLeftMostASRouteServer(t *testing.T) {
+	const rsAS = 64600
+	dst := mustPrefix("192.0.2.0/24")
+	// client 65002 announces a rule through a transparent route server, which
+	// chose the unicast best path of client 65001
+	fs := &FlowSpecRoute{DestPrefix: &dst, FromEBGP: true, NeighborAS: rsAS, ASPath: []uint32{65002}, OriginatorID: netip.AddrFrom4([4]byte{192, 0, 2, 1})}
+	viaRS := &UnicastRoute{Prefix: dst, NeighborAS: rsAS, ASPath: []uint32{65001}, OriginatorID: netip.AddrFrom4([4]byte{192, 0, 2, 1})}
+	direct := &UnicastRoute{Prefix: dst, NeighborAS: 65001, ASPath: []uint32{65001}, OriginatorID: netip.AddrFrom4([4]byte{192, 0, 2, 1})}
+	tests := []struct {
+		name string
+		cfg  Config
+		best *UnicastRoute
+		want error
+	}{
+		{name: "default", best: viaRS, want: ErrLeftMostASMismatch},
+		{name: "relaxed", cfg: Config{LeftMostASRelaxed: []uint32{rsAS}}, best: viaRS},
+		{name: "relaxed, best path from direct peer", cfg: Config{LeftMostASRelaxed: []uint32{rsAS}}, best: direct, want: ErrLeftMostASMismatch},
+		{name: "exempt", cfg: Config{LeftMostASExempt: []uint32{rsAS}}, best: direct},
+		{name: "other AS exempt", cfg: Config{LeftMostASExempt: []uint32{65001}}, best: viaRS, want: ErrLeftMostASMismatch},
+		{name: "other AS relaxed", cfg: Config{LeftMostASRelaxed: []uint32{65001}}, best: viaRS, want: ErrLeftMostASMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateFeasibility(fs, &mockRIB{best: tt.best}, &tt.cfg); !errors.Is(err, tt.want) {
+				t.Errorf("ValidateFeasibility() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateAnyPath(t *testing.T) {
+	dst := mustPrefix("192.0.2.0/24")
+	fs := &FlowSpecRoute{DestPrefix: &dst, FromEBGP: true, NeighborAS: 65002, ASPath: []uint32{65002}, OriginatorID: netip.AddrFrom4([4]byte{192, 0, 2, 2})}
+	rib := &mockRIB{
+		best:  &UnicastRoute{Prefix: dst, NeighborAS: 65001, ASPath: []uint32{65001}, OriginatorID: netip.AddrFrom4([4]byte{192, 0, 2, 1})},
+		paths: []*UnicastRoute{{Prefix: dst, NeighborAS: 65002, ASPath: []uint32{65002}, OriginatorID: netip.AddrFrom4([4]byte{192, 0, 2, 2}), PathID: 2}},
+	}
+	other := *fs
+	other.OriginatorID = netip.AddrFrom4([4]byte{192, 0, 2, 3})
+	// IPv4-mapped originators match their 4 byte form
+	mapped := *fs
+	mapped.OriginatorID = netip.AddrFrom16(fs.OriginatorID.As16())
+	mappedBest := *fs
+	mappedBest.NeighborAS, mappedBest.ASPath = 65001, []uint32{65001}
+	mappedBest.OriginatorID = netip.AddrFrom16(rib.best.OriginatorID.As16())
+	tests := []struct {
+		name  string
+		route *FlowSpecRoute
+		cfg   Config
+		want  error
+	}{
+		{name: "best path only", route: fs, want: ErrOriginatorValidationFailed},
+		{name: "any path", route: fs, cfg: Config{AnyPath: true}},
+		{name: "any path, no match", route: &other, cfg: Config{AnyPath: true}, want: ErrOriginatorValidationFailed},
+		{name: "best path, mapped", route: &mappedBest},
+		{name: "any path, mapped", route: &mapped, cfg: Config{AnyPath: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateFeasibility(tt.route, rib, &tt.cfg); !errors.Is(err, tt.want) {
+				t.Errorf("ValidateFeasibility() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateOriginatorForms(t *testing.T) {
+	dst := mustPrefix("192.0.2.0/24")
+	best := &UnicastRoute{Prefix: dst, NeighborAS: 65001, ASPath: []uint32{65001}}
+	best.SetOriginatorIP(net.IPv4(192, 0, 2, 1)) // 16 byte form
+	fs := &FlowSpecRoute{DestPrefix: &dst, FromEBGP: true, NeighborAS: 65001, ASPath: []uint32{65001}}
+	fs.SetOriginatorIP(net.IPv4(192, 0, 2, 1).To4())
+	if best.OriginatorID != fs.OriginatorID || !fs.OriginatorID.Is4() {
+		t.Fatalf("SetOriginatorIP() = %v and %v, want the same 4 byte address", best.OriginatorID, fs.OriginatorID)
+	}
+	// assigned directly in its IPv4-mapped form
+	fs.OriginatorID = netip.AddrFrom16(fs.OriginatorID.As16())
+	if err := ValidateFeasibility(fs, &mockRIB{best: best}, nil); err != nil {
+		t.Errorf("ValidateFeasibility() with mapped originator = %v, want <nil>", err)
+	}
+	if fs.SetOriginatorIP(nil); fs.OriginatorID.IsValid() {
+		t.Errorf("SetOriginatorIP(nil) = %v, want the zero Addr", fs.OriginatorID)
+	}
+}
+
+func TestValidateFeasibilityCtx(t *testing.T) {
+	dst := mustPrefix("192.0.2.0/24")
+	best := &UnicastRoute{Prefix: dst, NeighborAS: 65001, ASPath: []uint32{65001}}
+	route := &FlowSpecRoute{DestPrefix: &dst, FromEBGP: true, NeighborAS: 65001, ASPath: []uint32{65001}}
+	backendErr := errors.New("backend unavailable")
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name  string
+		ctx   context.Context
+		rib   UnicastRIB
+		want  error
+		cause error
+	}{
+		{"plain RIB", context.Background(), &mockRIB{best: best}, nil, nil},
+		{"plain RIB, rule result", context.Background(), &mockRIB{}, ErrNoBestUnicast, nil},
+		{"plain RIB, canceled", canceled, &mockRIB{best: best}, ErrRIBLookup, context.Canceled},
+		{"ctx RIB", context.Background(), &ctxRIB{mockRIB: mockRIB{best: best}}, nil, nil},
+		{"ctx RIB, backend error", context.Background(), &ctxRIB{mockRIB: mockRIB{best: best}, err: backendErr}, ErrRIBLookup, backendErr},
+		{"ctx RIB, deadline", nil, &ctxRIB{mockRIB: mockRIB{best: best}, block: true}, ErrRIBLookup, context.DeadlineExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := tt.ctx
+			if ctx == nil {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+				defer cancel()
+			}
+			err := ValidateFeasibilityCtx(ctx, route, tt.rib, nil)
+			if !errors.Is(err, tt.want) || (tt.want == nil) != (err == nil) {
+				t.Fatalf("ValidateFeasibilityCtx() = %v, want %v", err, tt.want)
+			}
+			if tt.cause != nil && !errors.Is(err, tt.cause) {
+				t.Errorf("ValidateFeasibilityCtx() = %v, want it to wrap %v", err, tt.cause)
+			}
+		})
+	}
+
+	// ValidateFeasibility keeps using the plain lookups
+	if err := ValidateFeasibility(route, &ctxRIB{mockRIB: mockRIB{best: best}, err: backendErr}, nil); err != nil {
+		t.Errorf("ValidateFeasibility() = %v, want <nil>", err)
+	}
+	if got := Reason(fmt.Errorf("%w: %w", ErrRIBLookup, context.Canceled)); got != "rib-lookup-failed" {
+		t.Errorf("Reason() = %q, want rib-lookup-failed", got)
+	}
+}
+
+// tableRIB answers lookups from its routes by prefix, unlike mockRIB.
+type tableRIB []*UnicastRoute
+
+func (t tableRIB) BestPath(p netip.Prefix) *UnicastRoute {
+	var best *UnicastRoute
+	for _, r := range t {
+		if r.Prefix.Bits() <= p.Bits() && r.Prefix.Contains(p.Addr()) && (best == nil || r.Prefix.Bits() > best.Prefix.Bits()) {
+			best = r
+		}
+	}
+	return best
+}
+
+func (t tableRIB) MoreSpecifics(p netip.Prefix) []*UnicastRoute {
+	var out []*UnicastRoute
+	for _, r := range t {
+		if r.Prefix.Bits() > p.Bits() && p.Contains(r.Prefix.Addr()) {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+func (t tableRIB) AllPaths(p netip.Prefix) []*UnicastRoute {
+	if best := t.BestPath(p); best != nil {
+		return []*UnicastRoute{best}
+	}
+	return nil
+}
+
+// TestValidateFeasibilityIPv6 mirrors TestValidateFeasibility for RFC8956
+// rules against a RIB holding routes of both families.
+func TestValidateFeasibilityIPv6(t *testing.T) {
+	orig1 := netip.AddrFrom4([4]byte{192, 0, 2, 1})
+	orig2 := netip.AddrFrom4([4]byte{192, 0, 2, 2})
+	rib := tableRIB{
+		{Prefix: mustPrefix("2001:db8::/32"), NeighborAS: 65001, ASPath: []uint32{65001}, OriginatorID: orig1},
+		{Prefix: mustPrefix("2001:db8:100::/40"), NeighborAS: 65001, ASPath: []uint32{65001, 65010}, OriginatorID: orig1},
+		{Prefix: mustPrefix("2001:db8:8001::/48"), NeighborAS: 65002, ASPath: []uint32{65002}, OriginatorID: orig2},
+		{Prefix: mustPrefix("3fff::/20")}, // locally originated
+		{Prefix: mustPrefix("192.0.2.0/24"), NeighborAS: 65001, ASPath: []uint32{65001}, OriginatorID: orig1},
+	}
+	ibgp := func(dst string, asPath []uint32, originator netip.Addr) *FlowSpecRoute {
+		r := &FlowSpecRoute{AFI: AFIIPv6, NeighborAS: 65001, ASPath: asPath, OriginatorID: originator}
+		if dst != "" {
+			p := mustPrefix(dst)
+			r.DestPrefix = &p
+		}
+		return r
+	}
+	ebgp := func(dst string, neighbor uint32, asPath []uint32, originator netip.Addr) *FlowSpecRoute {
+		r := ibgp(dst, asPath, originator)
+		r.FromEBGP, r.NeighborAS = true, neighbor
+		return r
+	}
+	withAFI := func(r *FlowSpecRoute, afi uint16) *FlowSpecRoute {
+		r.AFI = afi
+		return r
+	}
+	defaults := Config{EnableEmptyOrConfed: true}
+	tests := []struct {
+		name  string
+		route *FlowSpecRoute
+		cfg   Config
+		want  error
+	}{
+		{"NoDestPrefix_Disallowed (RFC8955 a)", ibgp("", nil, orig1), defaults, ErrNoDestinationPrefix},
+		{"NoDestPrefix_Allowed (RFC8955 a - relaxed)", ibgp("", nil, orig1), Config{AllowNoDestPrefix: true}, nil},
+		{"OriginatorMatch_OK (RFC8955 6.b)", ibgp("2001:db8::/33", []uint32{65001}, orig1), defaults, nil},
+		{"EmptyASPath_OK_with_iBGP_and_EnableEmptyOrConfed (RFC9117 4.1 b.2)", ibgp("2001:db8::/33", nil, orig2), defaults, nil},
+		{"EmptyASPath_Disallowed_when_b2_disabled", ibgp("2001:db8::/33", nil, orig2), Config{}, ErrOriginatorValidationFailed},
+		{"OriginatorMismatch", ibgp("2001:db8::/33", []uint32{65001}, orig2), defaults, ErrOriginatorValidationFailed},
+		{"MoreSpecificFromDifferentNeighbor (RFC8955 6.c)", ibgp("2001:db8::/32", []uint32{65001}, orig1), defaults, ErrMoreSpecificFromOtherNeighbor},
+		{"MoreSpecificsSameNeighbor_OK (RFC8955 6.c)", ibgp("2001:db8:100::/39", []uint32{65001}, orig1), defaults, nil},
+		{"NoBestUnicast, IPv4 routes ignored", ibgp("2001:db9::/32", []uint32{65001}, orig1), defaults, ErrNoBestUnicast},
+		{"EBGP_OriginatorAndLeftMostMatch_OK (RFC9117 4.2)", ebgp("2001:db8:100::/48", 65001, []uint32{65001}, orig1), defaults, nil},
+		{"EBGP_LeftMostASMismatch (RFC9117 4.2)", ebgp("2001:db8:100::/48", 65003, []uint32{65003}, orig1), defaults, ErrLeftMostASMismatch},
+		{"EBGP_LocalOriginBestPath_Error (RFC9117 4.2)", ebgp("3fff:0:1::/48", 65001, []uint32{65001}, netip.Addr{}), defaults, ErrLeftMostASMismatch},
+		{"HostBitsMasked", ibgp("2001:db8:100::1/40", []uint32{65001}, orig1), defaults, nil},
+		{"IPv4PrefixInIPv6Rule", ibgp("192.0.2.0/24", []uint32{65001}, orig1), defaults, ErrAddressFamilyMismatch},
+		{"IPv6PrefixInIPv4Rule", withAFI(ibgp("2001:db8::/33", []uint32{65001}, orig1), AFIIPv4), defaults, ErrAddressFamilyMismatch},
+		{"IPv4MappedInIPv6Rule, looked up as IPv6", ibgp("::ffff:192.0.2.0/120", []uint32{65001}, orig1), defaults, ErrNoBestUnicast},
+		{"IPv4MappedInIPv4Rule, unmapped", withAFI(ibgp("::ffff:192.0.2.0/120", []uint32{65001}, orig1), AFIIPv4), defaults, nil},
+		{"IPv4MappedWithoutAFI, unmapped", withAFI(ibgp("::ffff:192.0.2.0/120", []uint32{65001}, orig1), 0), defaults, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateFeasibility(tt.route, rib, &tt.cfg)
+			if !errors.Is(err, tt.want) || (tt.want == nil) != (err == nil) {
+				t.Errorf("ValidateFeasibility() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+	if got := Reason(ErrAddressFamilyMismatch); got != "address-family-mismatch" {
+		t.Errorf("Reason() = %q, want address-family-mismatch", got)
+	}
+}
+
+func TestValidateOriginatorFallback(t *testing.T) {
+	dst := mustPrefix("192.0.2.0/24")
+	rr := netip.AddrFrom4([4]byte{192, 0, 2, 1})
+	peerA := netip.AddrFrom4([4]byte{198, 51, 100, 1})
+	peerB := netip.AddrFrom4([4]byte{198, 51, 100, 2})
+	tests := []struct {
+		name                  string
+		rule, unicast         [2]netip.Addr // OriginatorID, PeerRouterID
+		anyPathFrom           netip.Addr    // PeerRouterID of another path
+		anyPath               bool
+		want                  error
+		wantRuleOriginator    netip.Addr
+		wantUnicastOriginator netip.Addr
+	}{
+		{name: "both reflected", rule: [2]netip.Addr{rr, peerA}, unicast: [2]netip.Addr{rr, peerB}, wantRuleOriginator: rr, wantUnicastOriginator: rr},
+		{name: "neither reflected, same peer", rule: [2]netip.Addr{{}, peerA}, unicast: [2]netip.Addr{{}, peerA}, wantRuleOriginator: peerA, wantUnicastOriginator: peerA},
+		{name: "neither reflected, other peer", rule: [2]netip.Addr{{}, peerA}, unicast: [2]netip.Addr{{}, peerB}, want: ErrOriginatorValidationFailed, wantRuleOriginator: peerA, wantUnicastOriginator: peerB},
+		{name: "rule reflected from the unicast peer", rule: [2]netip.Addr{peerA, rr}, unicast: [2]netip.Addr{{}, peerA}, wantRuleOriginator: peerA, wantUnicastOriginator: peerA},
+		{name: "unicast reflected from the rule peer", rule: [2]netip.Addr{{}, peerA}, unicast: [2]netip.Addr{peerA, rr}, wantRuleOriginator: peerA, wantUnicastOriginator: peerA},
+		{name: "ORIGINATOR_ID takes precedence", rule: [2]netip.Addr{rr, peerA}, unicast: [2]netip.Addr{{}, peerA}, want: ErrOriginatorValidationFailed, wantRuleOriginator: rr, wantUnicastOriginator: peerA},
+		{name: "mapped peer router id", rule: [2]netip.Addr{{}, netip.AddrFrom16(peerA.As16())}, unicast: [2]netip.Addr{{}, peerA}, wantRuleOriginator: peerA, wantUnicastOriginator: peerA},
+		{name: "neither known", wantRuleOriginator: netip.Addr{}, wantUnicastOriginator: netip.Addr{}},
+		{name: "any path from the peer", rule: [2]netip.Addr{{}, peerA}, unicast: [2]netip.Addr{{}, peerB}, anyPathFrom: peerA, anyPath: true, wantRuleOriginator: peerA, wantUnicastOriginator: peerB},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			route := &FlowSpecRoute{DestPrefix: &dst, NeighborAS: 65001, ASPath: []uint32{65001}, OriginatorID: tt.rule[0], PeerRouterID: tt.rule[1]}
+			best := &UnicastRoute{Prefix: dst, NeighborAS: 65001, ASPath: []uint32{65001}, OriginatorID: tt.unicast[0], PeerRouterID: tt.unicast[1]}
+			rib := &mockRIB{best: best}
+			if tt.anyPathFrom.IsValid() {
+				rib.paths = []*UnicastRoute{{Prefix: dst, NeighborAS: 65001, ASPath: []uint32{65001}, PeerRouterID: tt.anyPathFrom, PathID: 2}}
+			}
+			if got := route.Originator(); got != tt.wantRuleOriginator {
+				t.Errorf("FlowSpecRoute.Originator() = %v, want %v", got, tt.wantRuleOriginator)
+			}
+			if got := best.Originator(); got != tt.wantUnicastOriginator {
+				t.Errorf("UnicastRoute.Originator() = %v, want %v", got, tt.wantUnicastOriginator)
+			}
+			if err := ValidateFeasibility(route, rib, &Config{AnyPath: tt.anyPath}); !errors.Is(err, tt.want) || (tt.want == nil) != (err == nil) {
+				t.Errorf("ValidateFeasibility() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateClusterList(t *testing.T) {
+	dst := mustPrefix("192.0.2.0/24")
+	local := netip.AddrFrom4([4]byte{10, 0, 0, 1})
+	c2 := netip.AddrFrom4([4]byte{10, 0, 0, 2})
+	c3 := netip.AddrFrom4([4]byte{10, 0, 0, 3})
+	tests := []struct {
+		name          string
+		rule, unicast []netip.Addr
+		cfg           Config
+		want          error
+	}{
+		{name: "not reflected", cfg: Config{ClusterID: local, SameCluster: true}},
+		{name: "loop", rule: []netip.Addr{c2, local}, cfg: Config{ClusterID: local}, want: ErrClusterLoop},
+		{name: "mapped loop", rule: []netip.Addr{netip.AddrFrom16(local.As16())}, cfg: Config{ClusterID: local}, want: ErrClusterLoop},
+		{name: "no loop", rule: []netip.Addr{c2, c3}, cfg: Config{ClusterID: local}},
+		{name: "loop check off", rule: []netip.Addr{local}},
+		{name: "same cluster", rule: []netip.Addr{c2, c3}, unicast: []netip.Addr{c3}, cfg: Config{SameCluster: true}},
+		{name: "other cluster", rule: []netip.Addr{c3, c2}, unicast: []netip.Addr{c3}, cfg: Config{SameCluster: true}, want: ErrClusterMismatch},
+		{name: "rule only reflected", rule: []netip.Addr{c2}, cfg: Config{SameCluster: true}, want: ErrClusterMismatch},
+		{name: "other cluster, check off", rule: []netip.Addr{c2}, unicast: []netip.Addr{c3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			route := &FlowSpecRoute{DestPrefix: &dst, NeighborAS: 65001, ASPath: []uint32{65001}, ClusterList: tt.rule}
+			rib := &mockRIB{best: &UnicastRoute{Prefix: dst, NeighborAS: 65001, ASPath: []uint32{65001}, ClusterList: tt.unicast}}
+			if err := ValidateFeasibility(route, rib, &tt.cfg); !errors.Is(err, tt.want) || (tt.want == nil) != (err == nil) {
+				t.Errorf("ValidateFeasibility() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateNextHop(t *testing.T) {
+	dst := mustPrefix("192.0.2.0/24")
+	rib := tableRIB{
+		{Prefix: dst, NeighborAS: 65001, ASPath: []uint32{65001}},
+		{Prefix: mustPrefix("198.51.100.0/24"), NeighborAS: 65002},
+		{Prefix: mustPrefix("2001:db8::/32"), NeighborAS: 65002},
+	}
+	tests := []struct {
+		name    string
+		nextHop string
+		off     bool
+		want    error
+	}{
+		{name: "none"},
+		{name: "resolved", nextHop: "198.51.100.7"},
+		{name: "resolved IPv6", nextHop: "2001:db8::1"},
+		{name: "resolved mapped", nextHop: "::ffff:198.51.100.7"},
+		{name: "unresolved", nextHop: "203.0.113.1", want: ErrNextHopUnresolved},
+		{name: "unresolved IPv6", nextHop: "2001:db9::1", want: ErrNextHopUnresolved},
+		{name: "loopback", nextHop: "127.0.0.1", want: ErrNextHopMartian},
+		{name: "multicast", nextHop: "ff02::1", want: ErrNextHopMartian},
+		{name: "unspecified", nextHop: "0.0.0.0", want: ErrNextHopMartian},
+		{name: "check off", nextHop: "127.0.0.1", off: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			route := &FlowSpecRoute{DestPrefix: &dst, NeighborAS: 65001, ASPath: []uint32{65001}}
+			if tt.nextHop != "" {
+				route.NextHop = netip.MustParseAddr(tt.nextHop)
+			}
+			if err := ValidateFeasibility(route, rib, &Config{ValidateNextHop: !tt.off}); !errors.Is(err, tt.want) || (tt.want == nil) != (err == nil) {
+				t.Errorf("ValidateFeasibility() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,272 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package flowspecinternal
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrInvalidRD          = errors.New("flowspec: invalid route distinguisher")
+	ErrInvalidRouteTarget = errors.New("flowspec: invalid route target")
+	ErrDuplicateVRF       = errors.New("flowspec: VRF already configured")
+	ErrNoVRF              = NewError(StagePolicy, "no-vrf", "RFC8955 8", "flowspec: NLRI rejected: no VRF imports the route targets of the VPN route (RFC8955 8)")
+)
+
+// rdLen is the size of a route distinguisher (RFC4364 4.2).
+const rdLen = 8
+
+// parseAdminValue parses "administrator:assigned number" as used by route
+// distinguishers and route targets, returning the RFC4364 4.2 type (0 for
+// a 2 octet AS, 1 for an IPv4 address, 2 for a 4 octet AS) and the 6 value
+// octets.
+func parseAdminValue(s string) (uint16, [6]byte, error) {
+	var v [6]byte
+	i := strings.LastIndexByte(s, ':')
+	if i < 0 {
+		return 0, v, fmt.Errorf("missing ':' in %q", s)
+	}
+	admin, assigned := s[:i], s[i+1:]
+	if addr, err := netip.ParseAddr(admin); err == nil {
+		n, err := strconv.ParseUint(assigned, 10, 16)
+		if err != nil || !addr.Is4() {
+			return 0, v, fmt.Errorf("invalid IPv4 administrator value %q", s)
+		}
+		a := addr.As4()
+		copy(v[:4], a[:])
+		binary.BigEndian.PutUint16(v[4:], uint16(n))
+		return 1, v, nil
+	}
+	as, err := strconv.ParseUint(strings.TrimPrefix(admin, "AS"), 10, 32)
+	if err != nil {
+		return 0, v, fmt.Errorf("invalid administrator %q", admin)
+	}
+	if as <= 0xffff {
+		n, err := strconv.ParseUint(assigned, 10, 32)
+		if err != nil {
+			return 0, v, fmt.Errorf("invalid assigned number %q", assigned)
+		}
+		binary.BigEndian.PutUint16(v[:2], uint16(as))
+		binary.BigEndian.PutUint32(v[2:], uint32(n))
+		return 0, v, nil
+	}
+	n, err := strconv.ParseUint(assigned, 10, 16)
+	if err != nil {
+		return 0, v, fmt.Errorf("invalid assigned number %q", assigned)
+	}
+	binary.BigEndian.PutUint32(v[:4], uint32(as))
+	binary.BigEndian.PutUint16(v[4:], uint16(n))
+	return 2, v, nil
+}
+
+func formatAdminValue(typ uint16, v []byte) string {
+	switch typ {
+	case 0:
+		return fmt.Sprintf("%d:%d", binary.BigEndian.Uint16(v), binary.BigEndian.Uint32(v[2:]))
+	case 1:
+		return fmt.Sprintf("%s:%d", netip.AddrFrom4([4]byte(v[:4])), binary.BigEndian.Uint16(v[4:]))
+	case 2:
+		return fmt.Sprintf("%d:%d", binary.BigEndian.Uint32(v), binary.BigEndian.Uint16(v[4:]))
+	}
+	return fmt.Sprintf("%d:%x", typ, v)
+}
+
+// ParseRD parses a route distinguisher written as "65000:100",
+// "192.0.2.1:100" or "4200000000:100" (RFC4364 4.2 types 0, 1 and 2).
+func ParseRD(s string) ([8]byte, error) {
+	var rd [8]byte
+	typ, v, err := parseAdminValue(s)
+	if err != nil {
+		return rd, fmt.Errorf("%w: %s", ErrInvalidRD, err)
+	}
+	binary.BigEndian.PutUint16(rd[:], typ)
+	copy(rd[2:], v[:])
+	return rd, nil
+}
+
+// FormatRD returns rd in the notation of ParseRD.
+func FormatRD(rd [8]byte) string {
+	return formatAdminValue(binary.BigEndian.Uint16(rd[:]), rd[2:])
+}
+
+// ParseRouteTarget parses a route target extended community (RFC4360 4,
+// RFC5668) written like a route distinguisher, optionally prefixed by
+// "target:".
+func ParseRouteTarget(s string) ([8]byte, error) {
+	var ec [8]byte
+	typ, v, err := parseAdminValue(strings.TrimPrefix(s, "target:"))
+	if err != nil {
+		return ec, fmt.Errorf("%w: %s", ErrInvalidRouteTarget, err)
+	}
+	ec[0], ec[1] = byte(typ), 0x02
+	copy(ec[2:], v[:])
+	return ec, nil
+}
+
+// IsRouteTarget reports whether ec is a route target of one of the three
+// administrator types.
+func IsRouteTarget(ec [8]byte) bool {
+	return ec[0] <= 0x02 && ec[1] == 0x02
+}
+
+// FormatRouteTarget returns the route target ec as "target:admin:number".
+func FormatRouteTarget(ec [8]byte) string {
+	return "target:" + formatAdminValue(uint16(ec[0]), ec[2:])
+}
+
+// DecodeVPNNLRI decodes one length-prefixed SAFI 134 NLRI (RFC8955 8), whose
+// length covers the route distinguisher, and returns the bytes consumed.
+func DecodeVPNNLRI(b []byte, afi uint16) ([8]byte, FSComponentList, int, error) {
+	var rd [8]byte
+	n, hdr, err := ReadNLRILength(b)
+	if err != nil {
+		return rd, FSComponentList{}, 0, err
+	}
+	if n < rdLen || len(b) < hdr+n {
+		return rd, FSComponentList{}, 0, ErrMalformedNLRI
+	}
+	rd = [8]byte(b[hdr : hdr+rdLen])
+	l, err := DecodeComponents(b[hdr+rdLen:hdr+n], afi)
+	if err != nil {
+		return rd, FSComponentList{}, 0, err
+	}
+	return rd, l, hdr + n, nil
+}
+
+// EncodeVPNNLRI encodes rd and l as one length-prefixed SAFI 134 NLRI.
+func EncodeVPNNLRI(rd [8]byte, l FSComponentList, afi uint16) ([]byte, error) {
+	body, err := EncodeComponents(l, afi)
+	if err != nil {
+		return nil, err
+	}
+	out, err := AppendNLRILength(make([]byte, 0, rdLen+len(body)+2), rdLen+len(body))
+	if err != nil {
+		return nil, err
+	}
+	out = append(out, rd[:]...)
+	return append(out, body...), nil
+}
+
+// RIBProvider selects the unicast RIB a FlowSpec route is validated
+// against, nil if there is none.
+type RIBProvider interface {
+	RIBFor(fs *FlowSpecRoute) UnicastRIB
+}
+
+// VRF is a VPN routing and forwarding instance holding its own unicast RIB.
+type VRF struct {
+	Name string
+	// ImportTargets are the route targets, in ParseRouteTarget notation, of
+	// the VPN routes imported into the VRF.
+	ImportTargets []string
+	RIB           UnicastRIB
+}
+
+// VRFs is a RIBProvider for L3VPN deployments: SAFI 133 routes are
+// validated against the default RIB, SAFI 134 routes against that of a VRF
+// importing one of their route targets (RFC8955 8): the first added of those
+// importing the first route target imported at all. Its methods are safe
+// for concurrent use.
+type VRFs struct {
+	def UnicastRIB
+
+	mu       sync.RWMutex
+	order    []*VRF
+	byName   map[string]*VRF
+	byTarget map[[8]byte][]*VRF
+}
+
+// NewVRFs returns a provider with the default RIB def and no VRFs.
+func NewVRFs(def UnicastRIB) *VRFs {
+	return &VRFs{def: def, byName: map[string]*VRF{}, byTarget: map[[8]byte][]*VRF{}}
+}
+
+// Add adds v, returning ErrDuplicateVRF if its name is taken and
+// ErrInvalidRouteTarget for an unparsable import target.
+func (p *VRFs) Add(v VRF) error {
+	targets := make([][8]byte, 0, len(v.ImportTargets))
+	for _, s := range v.ImportTargets {
+		rt, err := ParseRouteTarget(s)
+		if err != nil {
+			return err
+		}
+		targets = append(targets, rt)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.byName[v.Name]; ok {
+		return fmt.Errorf("%w: %s", ErrDuplicateVRF, v.Name)
+	}
+	p.byName[v.Name] = &v
+	p.order = append(p.order, &v)
+	for _, rt := range targets {
+		p.byTarget[rt] = append(p.byTarget[rt], &v)
+	}
+	return nil
+}
+
+// RIB returns the unicast RIB of the VRF name, nil if there is none.
+func (p *VRFs) RIB(name string) UnicastRIB {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if v, ok := p.byName[name]; ok {
+		return v.RIB
+	}
+	return nil
+}
+
+// RIBFor implements RIBProvider.
+func (p *VRFs) RIBFor(fs *FlowSpecRoute) UnicastRIB {
+	if fs.SAFI != SAFIFlowSpecVPN {
+		return p.def
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	for _, ec := range fs.ExtCommunities {
+		if !IsRouteTarget(ec) {
+			continue
+		}
+		if vs := p.byTarget[ec]; len(vs) > 0 {
+			return vs[0].RIB
+		}
+	}
+	return nil
+}
+
+// Importing returns the VRFs importing one of the route targets of the
+// SAFI 134 route fs, in order of addition.
+func (p *VRFs) Importing(fs *FlowSpecRoute) []VRF {
+	if fs.SAFI != SAFIFlowSpecVPN {
+		return nil
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	var out []VRF
+	for _, v := range p.order {
+		if slices.ContainsFunc(fs.ExtCommunities, func(ec [8]byte) bool {
+			return IsRouteTarget(ec) && slices.Contains(p.byTarget[ec], v)
+		}) {
+			out = append(out, *v)
+		}
+	}
+	return out
+}
+
+// ValidateFeasibilityIn validates fs like ValidateFeasibility against the
+// unicast RIB p selects for it, failing with ErrNoVRF if there is none.
+func ValidateFeasibilityIn(fs *FlowSpecRoute, p RIBProvider, cfg *Config) error {
+	rib := p.RIBFor(fs)
+	if rib == nil {
+		return ErrNoVRF
+	}
+	return ValidateFeasibility(fs, rib, cfg)
+}
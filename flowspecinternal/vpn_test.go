@@ -0,0 +1,110 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package flowspecinternal
+
+import (
+	"errors"
+	"net/netip"
+	"reflect"
+	"testing"
+)
+
+func TestParseRD(t *testing.T) {
+	tests := []struct {
+		in   string
+		want [8]byte
+	}{
+		{"65000:100", [8]byte{0, 0, 0xfd, 0xe8, 0, 0, 0, 100}},
+		{"192.0.2.1:100", [8]byte{0, 1, 192, 0, 2, 1, 0, 100}},
+		{"4200000000:100", [8]byte{0, 2, 0xfa, 0x56, 0xea, 0, 0, 100}},
+	}
+	for _, tt := range tests {
+		got, err := ParseRD(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseRD(%q) = %v, %v, want %v", tt.in, got, err, tt.want)
+			continue
+		}
+		if s := FormatRD(got); s != tt.in {
+			t.Errorf("FormatRD() = %q, want %q", s, tt.in)
+		}
+	}
+	for _, bad := range []string{"65000", "2001:db8::1:1", "4200000000:70000", "x:1"} {
+		if _, err := ParseRD(bad); !errors.Is(err, ErrInvalidRD) {
+			t.Errorf("ParseRD(%q) error = %v, want %v", bad, err, ErrInvalidRD)
+		}
+	}
+
+	rt, err := ParseRouteTarget("target:65000:1")
+	if err != nil || rt != [8]byte{0, 2, 0xfd, 0xe8, 0, 0, 0, 1} || !IsRouteTarget(rt) {
+		t.Errorf("ParseRouteTarget() = %v, %v", rt, err)
+	}
+	if s := FormatRouteTarget(rt); s != "target:65000:1" {
+		t.Errorf("FormatRouteTarget() = %q", s)
+	}
+	if IsRouteTarget([8]byte{0x80, 0x06}) {
+		t.Error("IsRouteTarget(traffic-rate) = true")
+	}
+}
+
+func TestVPNNLRIRoundTrip(t *testing.T) {
+	dst := mustPrefix("192.0.2.0/24")
+	l := FSComponentList{Components: []FSComponent{{Type: ComponentTypeDestinationPrefix, Prefix: &dst}}}
+	rd, _ := ParseRD("65000:100")
+	b, err := EncodeVPNNLRI(rd, l, AFIIPv4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int(b[0]) != len(b)-1 {
+		t.Errorf("NLRI length = %d, want %d including the RD", b[0], len(b)-1)
+	}
+	gotRD, got, n, err := DecodeVPNNLRI(b, AFIIPv4)
+	if err != nil || n != len(b) || gotRD != rd || !reflect.DeepEqual(got, l) {
+		t.Errorf("DecodeVPNNLRI() = %v, %v, %d, %v", gotRD, got, n, err)
+	}
+	if _, _, _, err := DecodeVPNNLRI([]byte{4, 0, 0, 0, 1}, AFIIPv4); !errors.Is(err, ErrMalformedNLRI) {
+		t.Errorf("DecodeVPNNLRI(short RD) error = %v", err)
+	}
+}
+
+func TestVRFs(t *testing.T) {
+	dst := mustPrefix("192.0.2.0/24")
+	best := &UnicastRoute{Prefix: dst, NeighborAS: 65001, OriginatorID: netip.AddrFrom4([4]byte{192, 0, 2, 1})}
+	red, blue := &mockRIB{best: best}, &mockRIB{}
+	p := NewVRFs(&mockRIB{})
+	if err := p.Add(VRF{Name: "red", ImportTargets: []string{"65000:1", "target:65000:2"}, RIB: red}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Add(VRF{Name: "blue", ImportTargets: []string{"65000:3"}, RIB: blue}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Add(VRF{Name: "red"}); !errors.Is(err, ErrDuplicateVRF) {
+		t.Errorf("Add(duplicate) = %v, want %v", err, ErrDuplicateVRF)
+	}
+	if err := p.Add(VRF{Name: "green", ImportTargets: []string{"green"}}); !errors.Is(err, ErrInvalidRouteTarget) {
+		t.Errorf("Add(bad target) = %v, want %v", err, ErrInvalidRouteTarget)
+	}
+	if p.RIB("red") != red || p.RIB("green") != nil {
+		t.Error("RIB() returned the wrong VRF")
+	}
+
+	rt2, _ := ParseRouteTarget("65000:2")
+	rt9, _ := ParseRouteTarget("65000:9")
+	r := &FlowSpecRoute{DestPrefix: &dst, OriginatorID: netip.AddrFrom4([4]byte{192, 0, 2, 1}), SAFI: SAFIFlowSpecVPN}
+	r.ExtCommunities = [][8]byte{{0x80, 0x06}, rt9, rt2}
+	if err := ValidateFeasibilityIn(r, p, nil); err != nil {
+		t.Errorf("ValidateFeasibilityIn() = %v, want <nil> in VRF red", err)
+	}
+	r.ExtCommunities = [][8]byte{rt9}
+	if err := ValidateFeasibilityIn(r, p, nil); !errors.Is(err, ErrNoVRF) {
+		t.Errorf("ValidateFeasibilityIn() = %v, want %v", err, ErrNoVRF)
+	}
+	r.SAFI = SAFIFlowSpec
+	if err := ValidateFeasibilityIn(r, p, nil); !errors.Is(err, ErrNoBestUnicast) {
+		t.Errorf("ValidateFeasibilityIn(SAFI 133) = %v, want %v from the default RIB", err, ErrNoBestUnicast)
+	}
+	if got := Reason(ErrNoVRF); got != "no-vrf" {
+		t.Errorf("Reason() = %q", got)
+	}
+}
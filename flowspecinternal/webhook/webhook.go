@@ -0,0 +1,261 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+// Package webhook posts rule events to an HTTP endpoint, e.g. SOC tooling or
+// a chat bot, so they are alerted without polling the API.
+//
+// Every event is sent as one JSON Payload. With a secret the body is signed
+// with HMAC-SHA256 in the X-Flowspec-Signature header as "sha256=<hex>";
+// receivers check it with Verify. Failed deliveries, transport errors and
+// 429 or 5xx responses, are retried with exponential backoff. Events are
+// queued so a slow endpoint never blocks the publisher; when the queue is
+// full they are dropped and counted.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/events"
+)
+
+var (
+	ErrNoURL       = errors.New("webhook: no URL")
+	ErrStatus      = errors.New("webhook: endpoint rejected the event")
+	ErrGaveUp      = errors.New("webhook: delivery attempts exhausted")
+	ErrQueueClosed = errors.New("webhook: notifier closed")
+)
+
+// Request headers.
+const (
+	HeaderSignature = "X-Flowspec-Signature"
+	HeaderEvent     = "X-Flowspec-Event"
+)
+
+// Defaults of Options.
+const (
+	DefaultMaxAttempts = 5
+	DefaultBackoff     = time.Second
+	DefaultMaxBackoff  = time.Minute
+	DefaultQueueSize   = 1024
+	DefaultTimeout     = 10 * time.Second
+)
+
+// Options configures a Notifier.
+type Options struct {
+	URL string
+	// Secret, if set, signs the bodies.
+	Secret []byte
+	// Kinds selects the events, defaulting to RuleAccepted, RuleRejected
+	// and RuleWithdrawn.
+	Kinds []events.Kind
+	// Client defaults to an http.Client with DefaultTimeout.
+	Client *http.Client
+	// MaxAttempts bounds the deliveries of one event, DefaultMaxAttempts
+	// if not positive.
+	MaxAttempts int
+	// Backoff is the wait before the first retry, doubling up to
+	// MaxBackoff; DefaultBackoff and DefaultMaxBackoff if not positive.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// QueueSize bounds the events waiting for delivery, DefaultQueueSize
+	// if not positive.
+	QueueSize int
+	// Logger, if set, receives failed and dropped deliveries.
+	Logger *slog.Logger
+	// Now returns the current time, defaults to time.Now.
+	Now func() time.Time
+}
+
+// Payload is the JSON body of a webhook.
+type Payload struct {
+	Kind events.Kind `json:"kind"`
+	Time time.Time   `json:"time"`
+	// Rule is the canonical form of the rule's components.
+	Rule  string            `json:"rule"`
+	Route *fs.FlowSpecRoute `json:"route"`
+	// Reason and Error give the rejection, withdrawal or revalidation
+	// reason, see fs.Reason.
+	Reason string `json:"reason,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Notifier delivers events to one endpoint.
+type Notifier struct {
+	o       Options
+	log     *slog.Logger
+	queue   chan Payload
+	dropped atomic.Uint64
+	failed  atomic.Uint64
+}
+
+// New returns a Notifier; call Run to deliver the events it receives.
+func New(opts *Options) (*Notifier, error) {
+	var o Options
+	if opts != nil {
+		o = *opts
+	}
+	if o.URL == "" {
+		return nil, ErrNoURL
+	}
+	if len(o.Kinds) == 0 {
+		o.Kinds = []events.Kind{events.RuleAccepted, events.RuleRejected, events.RuleWithdrawn}
+	}
+	if o.Client == nil {
+		o.Client = &http.Client{Timeout: DefaultTimeout}
+	}
+	if o.MaxAttempts <= 0 {
+		o.MaxAttempts = DefaultMaxAttempts
+	}
+	if o.Backoff <= 0 {
+		o.Backoff = DefaultBackoff
+	}
+	if o.MaxBackoff <= 0 {
+		o.MaxBackoff = DefaultMaxBackoff
+	}
+	if o.QueueSize <= 0 {
+		o.QueueSize = DefaultQueueSize
+	}
+	if o.Now == nil {
+		o.Now = time.Now
+	}
+	return &Notifier{
+		o:     o,
+		log:   fs.SubsystemLogger(o.Logger, fs.SubsystemWebhook),
+		queue: make(chan Payload, o.QueueSize),
+	}, nil
+}
+
+// Subscribe queues the selected events published on bus until cancel is
+// called.
+func (n *Notifier) Subscribe(bus *events.Bus) (cancel func()) {
+	return bus.Subscribe(n.Observe, n.o.Kinds...)
+}
+
+// Observe queues e if its kind is selected, dropping it if the queue is
+// full.
+func (n *Notifier) Observe(e events.Event) {
+	if !slices.Contains(n.o.Kinds, e.Kind) {
+		return
+	}
+	p := Payload{Kind: e.Kind, Time: n.o.Now(), Rule: e.Route.Components.Canonical(nil), Route: e.Route}
+	if e.Err != nil {
+		p.Reason, p.Error = fs.Reason(e.Err), e.Err.Error()
+	}
+	select {
+	case n.queue <- p:
+	default:
+		n.dropped.Add(1)
+		n.log.Warn("webhook queue full, event dropped", "event", e.Kind.String(), fs.LogKeyRule, p.Rule)
+	}
+}
+
+// Dropped counts the events dropped because the queue was full.
+func (n *Notifier) Dropped() uint64 {
+	return n.dropped.Load()
+}
+
+// Failed counts the events given up after MaxAttempts or a 4xx response.
+func (n *Notifier) Failed() uint64 {
+	return n.failed.Load()
+}
+
+// Run delivers the queued events one at a time, in order, until ctx is done.
+func (n *Notifier) Run(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case p := <-n.queue:
+			if err := n.Deliver(ctx, p); err != nil && ctx.Err() == nil {
+				n.failed.Add(1)
+				n.log.Error("webhook delivery failed", "event", p.Kind.String(), fs.LogKeyRule, p.Rule, "error", err)
+			}
+		}
+	}
+}
+
+// Deliver posts p, retrying with backoff. It returns an error wrapping
+// ErrStatus for a response that is not retried, ErrGaveUp after
+// MaxAttempts or the context's error.
+func (n *Notifier) Deliver(ctx context.Context, p Payload) error {
+	body, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	backoff := n.o.Backoff
+	for attempt := 1; ; attempt++ {
+		retry, err := n.post(ctx, p.Kind, body)
+		if err == nil {
+			return nil
+		}
+		if !retry {
+			return err
+		}
+		if attempt >= n.o.MaxAttempts {
+			return fmt.Errorf("%w: %d attempts, last: %w", ErrGaveUp, attempt, err)
+		}
+		n.log.Debug("webhook delivery failed, retrying", "event", p.Kind.String(), "attempt", attempt, "backoff", backoff, "error", err)
+		t := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+		backoff = min(2*backoff, n.o.MaxBackoff)
+	}
+}
+
+// post sends one attempt and reports whether a failure may be retried.
+func (n *Notifier) post(ctx context.Context, kind events.Kind, body []byte) (retry bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.o.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, kind.String())
+	if len(n.o.Secret) > 0 {
+		req.Header.Set(HeaderSignature, Sign(n.o.Secret, body))
+	}
+	resp, err := n.o.Client.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("%w: %s", ErrStatus, resp.Status)
+	default:
+		return false, fmt.Errorf("%w: %s", ErrStatus, resp.Status)
+	}
+}
+
+// Sign returns the signature header value of body: "sha256=" and the hex
+// HMAC-SHA256 of body under secret.
+func Sign(secret, body []byte) string {
+	m := hmac.New(sha256.New, secret)
+	m.Write(body)
+	return "sha256=" + hex.EncodeToString(m.Sum(nil))
+}
+
+// Verify reports whether signature is the signature of body under secret,
+// in constant time.
+func Verify(secret, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
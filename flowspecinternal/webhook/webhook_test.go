@@ -0,0 +1,118 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/actions"
+	"floofspectools/flowspecinternal/events"
+)
+
+func testRoute(t *testing.T) *fs.FlowSpecRoute {
+	t.Helper()
+	list, _, err := actions.ParseRule("dst 192.0.2.0/24 proto udp then discard")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &fs.FlowSpecRoute{AFI: fs.AFIIPv4, SAFI: fs.SAFIFlowSpec, Components: list}
+}
+
+func TestNotifier(t *testing.T) {
+	secret := []byte("s3cret")
+	var calls atomic.Int32
+	got := make(chan Payload, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !Verify(secret, body, r.Header.Get(HeaderSignature)) {
+			t.Errorf("signature %q does not verify", r.Header.Get(HeaderSignature))
+		}
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var p Payload
+		if err := json.Unmarshal(body, &p); err != nil {
+			t.Error(err)
+		}
+		got <- p
+	}))
+	defer srv.Close()
+
+	n, err := New(&Options{URL: srv.URL, Secret: secret, Backoff: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bus := events.NewBus()
+	n.Subscribe(bus)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go n.Run(ctx)
+
+	r := testRoute(t)
+	bus.Publish(events.Event{Kind: events.RuleRevalidated, Route: r})
+	bus.Publish(events.Event{Kind: events.RuleRejected, Route: r, Err: fs.ErrNoBestUnicast})
+	select {
+	case p := <-got:
+		if p.Kind != events.RuleRejected || p.Rule != r.Components.Canonical(nil) || p.Reason != fs.Reason(fs.ErrNoBestUnicast) {
+			t.Errorf("payload = %+v", p)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no delivery")
+	}
+	if c := calls.Load(); c != 3 {
+		t.Errorf("%d attempts, want 3", c)
+	}
+}
+
+func TestDeliverErrors(t *testing.T) {
+	status := http.StatusBadRequest
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	n, err := New(&Options{URL: srv.URL, MaxAttempts: 2, Backoff: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := Payload{Kind: events.RuleAccepted, Route: testRoute(t)}
+	if err := n.Deliver(context.Background(), p); !errors.Is(err, ErrStatus) || errors.Is(err, ErrGaveUp) || calls.Load() != 1 {
+		t.Errorf("400: Deliver() = %v after %d attempts, want ErrStatus without retry", err, calls.Load())
+	}
+	status, calls = http.StatusInternalServerError, atomic.Int32{}
+	if err := n.Deliver(context.Background(), p); !errors.Is(err, ErrGaveUp) || calls.Load() != 2 {
+		t.Errorf("500: Deliver() = %v after %d attempts, want ErrGaveUp after 2", err, calls.Load())
+	}
+
+	if _, err := New(nil); !errors.Is(err, ErrNoURL) {
+		t.Errorf("New(nil) = %v, want ErrNoURL", err)
+	}
+}
+
+func TestObserveDrops(t *testing.T) {
+	n, err := New(&Options{URL: "http://example.invalid", QueueSize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := testRoute(t)
+	for range 3 {
+		n.Observe(events.Event{Kind: events.RuleWithdrawn, Route: r})
+	}
+	if n.Dropped() != 2 {
+		t.Errorf("Dropped() = %d, want 2", n.Dropped())
+	}
+}
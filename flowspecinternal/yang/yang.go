@@ -0,0 +1,708 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+// Package yang converts FlowSpec rules to and from the IETF ACL model
+// (ietf-access-control-list, RFC8519) in its RFC7951 JSON encoding, the form
+// NETCONF/RESTCONF controllers exchange.
+//
+// The ACL model has no OR-ed values, a FlowSpec rule is therefore emitted as
+// one ACE per combination of alternatives. Rate limiting and DSCP marking have
+// no ACL counterpart and are carried as leaves of the "floofspectools-flowspec"
+// module augmenting the ACE actions.
+package yang
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/actions"
+)
+
+var (
+	ErrNotExpressible     = errors.New("yang: component cannot be expressed in the ACL model")
+	ErrUnsupportedAction  = errors.New("yang: action cannot be expressed in the ACL model")
+	ErrMixedFamilies      = errors.New("yang: destination and source prefix address families differ")
+	ErrTooManyEntries     = errors.New("yang: rule expands into too many ACEs")
+	ErrUnsupportedMatch   = errors.New("yang: ACE uses a match the FlowSpec model cannot express")
+	ErrUnknownForwarding  = errors.New("yang: unknown forwarding action")
+	ErrConflictingActions = errors.New("yang: more than one traffic-rate action present")
+)
+
+// Identities of the ietf-access-control-list module.
+const (
+	ACLTypeIPv4  = "ietf-access-control-list:ipv4-acl-type"
+	ACLTypeIPv6  = "ietf-access-control-list:ipv6-acl-type"
+	ACLTypeMixed = "ietf-access-control-list:mixed-eth-ipv4-ipv6-acl-type"
+
+	ForwardingAccept = "ietf-access-control-list:accept"
+	ForwardingDrop   = "ietf-access-control-list:drop"
+	ForwardingReject = "ietf-access-control-list:reject"
+)
+
+// maxACEs bounds the expansion of a single rule.
+const maxACEs = 256
+
+// Rule is a named FlowSpec rule.
+type Rule struct {
+	Name       string
+	Components fs.FSComponentList
+	Actions    []actions.Action
+}
+
+// Options tunes Marshal.
+type Options struct {
+	// IPv6 selects the address family for rules that carry no prefix component.
+	IPv6 bool
+}
+
+type document struct {
+	ACLs struct {
+		ACL []aclJSON `json:"acl"`
+	} `json:"ietf-access-control-list:acls"`
+}
+
+type aclJSON struct {
+	Name string `json:"name"`
+	Type string `json:"type,omitempty"`
+	ACEs struct {
+		ACE []aceJSON `json:"ace"`
+	} `json:"aces"`
+}
+
+type aceJSON struct {
+	Name    string      `json:"name"`
+	Matches matchesJSON `json:"matches"`
+	Actions actionsJSON `json:"actions"`
+}
+
+type matchesJSON struct {
+	IPv4 *l3JSON   `json:"ipv4,omitempty"`
+	IPv6 *l3JSON   `json:"ipv6,omitempty"`
+	TCP  *l4JSON   `json:"tcp,omitempty"`
+	UDP  *l4JSON   `json:"udp,omitempty"`
+	ICMP *icmpJSON `json:"icmp,omitempty"`
+}
+
+type l3JSON struct {
+	DSCP     *uint8  `json:"dscp,omitempty"`
+	Length   *uint16 `json:"length,omitempty"`
+	Protocol *uint8  `json:"protocol,omitempty"`
+	DstV4    string  `json:"destination-ipv4-network,omitempty"`
+	SrcV4    string  `json:"source-ipv4-network,omitempty"`
+	DstV6    string  `json:"destination-ipv6-network,omitempty"`
+	SrcV6    string  `json:"source-ipv6-network,omitempty"`
+}
+
+type l4JSON struct {
+	Flags           string    `json:"flags,omitempty"`
+	SourcePort      *portJSON `json:"source-port,omitempty"`
+	DestinationPort *portJSON `json:"destination-port,omitempty"`
+}
+
+// portJSON is the port-range-or-operator grouping of ietf-packet-fields.
+type portJSON struct {
+	LowerPort *uint16 `json:"lower-port,omitempty"`
+	UpperPort *uint16 `json:"upper-port,omitempty"`
+	Operator  string  `json:"operator,omitempty"`
+	Port      *uint16 `json:"port,omitempty"`
+}
+
+type icmpJSON struct {
+	Type *uint8 `json:"type,omitempty"`
+	Code *uint8 `json:"code,omitempty"`
+}
+
+type actionsJSON struct {
+	Forwarding string   `json:"forwarding"`
+	RateLimit  *float32 `json:"floofspectools-flowspec:rate-limit,omitempty"`     // bytes per second
+	RateLimitP *float32 `json:"floofspectools-flowspec:rate-limit-pps,omitempty"` // packets per second
+	Marking    *uint8   `json:"floofspectools-flowspec:dscp-marking,omitempty"`
+}
+
+// tcpFlags are the bit names of the ietf-packet-fields tcp flags, FlowSpec bit order.
+var tcpFlags = []string{"fin", "syn", "rst", "psh", "ack", "urg", "ece", "cwr"}
+
+const (
+	protoICMP   = 1
+	protoTCP    = 6
+	protoUDP    = 17
+	protoICMPv6 = 58
+)
+
+func ptr[T any](v T) *T { return &v }
+
+// Marshal renders rules as one ACL called name.
+func Marshal(name string, rules []Rule, opts *Options) ([]byte, error) {
+	var o Options
+	if opts != nil {
+		o = *opts
+	}
+	acl := aclJSON{Name: name}
+	var v4, v6 bool
+	for _, r := range rules {
+		ipv6, err := family(r.Components, o.IPv6)
+		if err != nil {
+			return nil, fmt.Errorf("rule %q: %w", r.Name, err)
+		}
+		v4, v6 = v4 || !ipv6, v6 || ipv6
+		act, err := encodeActions(r.Actions)
+		if err != nil {
+			return nil, fmt.Errorf("rule %q: %w", r.Name, err)
+		}
+		aces, err := expand(r.Components, ipv6)
+		if err != nil {
+			return nil, fmt.Errorf("rule %q: %w", r.Name, err)
+		}
+		for i, ace := range aces {
+			ace.Name = r.Name
+			if len(aces) > 1 {
+				ace.Name = fmt.Sprintf("%s.%d", r.Name, i+1)
+			}
+			ace.Actions = act
+			acl.ACEs.ACE = append(acl.ACEs.ACE, ace)
+		}
+	}
+	switch {
+	case v4 && v6:
+		acl.Type = ACLTypeMixed
+	case v6:
+		acl.Type = ACLTypeIPv6
+	case v4:
+		acl.Type = ACLTypeIPv4
+	}
+	var doc document
+	doc.ACLs.ACL = []aclJSON{acl}
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+func family(list fs.FSComponentList, fallback bool) (bool, error) {
+	var seen []bool
+	for _, c := range list.Components {
+		if (c.Type == fs.ComponentTypeDestinationPrefix || c.Type == fs.ComponentTypeSourcePrefix) && c.Prefix != nil {
+			seen = append(seen, c.Prefix.Addr().Is6())
+		}
+	}
+	if len(seen) == 0 {
+		return fallback, nil
+	}
+	for _, v := range seen[1:] {
+		if v != seen[0] {
+			return false, ErrMixedFamilies
+		}
+	}
+	return seen[0], nil
+}
+
+// mutator applies one alternative of a component to an ACE and reports
+// whether the combination is possible.
+type mutator func(a *aceJSON) bool
+
+// expand returns one ACE per combination of the alternatives of list.
+func expand(list fs.FSComponentList, ipv6 bool) ([]aceJSON, error) {
+	var (
+		protos []uint64
+		dims   [][]mutator
+		needs  uint64 // protocol implied by the components if none is given
+	)
+	l3 := func(a *aceJSON) *l3JSON {
+		p := &a.Matches.IPv4
+		if ipv6 {
+			p = &a.Matches.IPv6
+		}
+		if *p == nil {
+			*p = &l3JSON{}
+		}
+		return *p
+	}
+	for _, c := range list.Components {
+		switch c.Type {
+		case fs.ComponentTypeDestinationPrefix, fs.ComponentTypeSourcePrefix:
+			if c.Prefix == nil {
+				return nil, ErrNotExpressible
+			}
+			p, dst := c.Prefix.Masked().String(), c.Type == fs.ComponentTypeDestinationPrefix
+			dims = append(dims, []mutator{func(a *aceJSON) bool {
+				l := l3(a)
+				switch {
+				case dst && ipv6:
+					l.DstV6 = p
+				case dst:
+					l.DstV4 = p
+				case ipv6:
+					l.SrcV6 = p
+				default:
+					l.SrcV4 = p
+				}
+				return true
+			}})
+		case fs.ComponentTypeIpProtocol:
+			vals, err := values(c, 255)
+			if err != nil {
+				return nil, err
+			}
+			protos = vals
+		case fs.ComponentTypePort, fs.ComponentTypeDestinationPort, fs.ComponentTypeSourcePort:
+			ranges, err := ranges(c, 0xffff)
+			if err != nil {
+				return nil, err
+			}
+			var alts []mutator
+			for _, r := range ranges {
+				if c.Type != fs.ComponentTypeSourcePort {
+					alts = append(alts, portMutator(r, true))
+				}
+				if c.Type != fs.ComponentTypeDestinationPort {
+					alts = append(alts, portMutator(r, false))
+				}
+			}
+			dims = append(dims, alts)
+		case fs.ComponentTypeICMPType, fs.ComponentTypeICMPCode:
+			vals, err := values(c, 255)
+			if err != nil {
+				return nil, err
+			}
+			isType := c.Type == fs.ComponentTypeICMPType
+			var alts []mutator
+			for _, v := range vals {
+				alts = append(alts, func(a *aceJSON) bool {
+					if a.Matches.ICMP == nil {
+						return false
+					}
+					if isType {
+						a.Matches.ICMP.Type = ptr(uint8(v))
+					} else {
+						a.Matches.ICMP.Code = ptr(uint8(v))
+					}
+					return true
+				})
+			}
+			dims = append(dims, alts)
+			needs = protoICMP
+			if ipv6 {
+				needs = protoICMPv6
+			}
+		case fs.ComponentTypeTCPFlags:
+			flags, err := tcpFlagMatch(c.Raw)
+			if err != nil {
+				return nil, err
+			}
+			dims = append(dims, []mutator{func(a *aceJSON) bool {
+				if a.Matches.TCP == nil {
+					return false
+				}
+				a.Matches.TCP.Flags = flags
+				return true
+			}})
+			needs = protoTCP
+		case fs.ComponentTypePacketLength, fs.ComponentTypeDSCP:
+			max := uint64(0xffff)
+			if c.Type == fs.ComponentTypeDSCP {
+				max = 63
+			}
+			vals, err := values(c, max)
+			if err != nil {
+				return nil, err
+			}
+			isLen := c.Type == fs.ComponentTypePacketLength
+			var alts []mutator
+			for _, v := range vals {
+				alts = append(alts, func(a *aceJSON) bool {
+					if isLen {
+						l3(a).Length = ptr(uint16(v))
+					} else {
+						l3(a).DSCP = ptr(uint8(v))
+					}
+					return true
+				})
+			}
+			dims = append(dims, alts)
+		default:
+			return nil, fmt.Errorf("%w: %v", ErrNotExpressible, c.Type)
+		}
+	}
+
+	if protos == nil {
+		switch {
+		case needs != 0:
+			protos = []uint64{needs}
+		case hasPorts(list):
+			protos = []uint64{protoTCP, protoUDP}
+		}
+	}
+	if protos != nil {
+		var alts []mutator
+		for _, p := range protos {
+			alts = append(alts, func(a *aceJSON) bool {
+				l3(a).Protocol = ptr(uint8(p))
+				switch p {
+				case protoTCP:
+					a.Matches.TCP = &l4JSON{}
+				case protoUDP:
+					a.Matches.UDP = &l4JSON{}
+				case protoICMP, protoICMPv6:
+					a.Matches.ICMP = &icmpJSON{}
+				}
+				return true
+			})
+		}
+		dims = append([][]mutator{alts}, dims...) // the l4 container must exist first
+	}
+
+	aces := []aceJSON{{}}
+	for _, alts := range dims {
+		var next []aceJSON
+		for _, base := range aces {
+			for _, m := range alts {
+				a := clone(base)
+				if m(&a) {
+					next = append(next, a)
+				}
+			}
+		}
+		if len(next) > maxACEs {
+			return nil, ErrTooManyEntries
+		}
+		aces = next
+	}
+	return aces, nil
+}
+
+func hasPorts(list fs.FSComponentList) bool {
+	for _, c := range list.Components {
+		switch c.Type {
+		case fs.ComponentTypePort, fs.ComponentTypeDestinationPort, fs.ComponentTypeSourcePort:
+			return true
+		}
+	}
+	return false
+}
+
+// clone copies the containers of a so alternatives do not share them.
+func clone(a aceJSON) aceJSON {
+	if a.Matches.IPv4 != nil {
+		a.Matches.IPv4 = ptr(*a.Matches.IPv4)
+	}
+	if a.Matches.IPv6 != nil {
+		a.Matches.IPv6 = ptr(*a.Matches.IPv6)
+	}
+	if a.Matches.TCP != nil {
+		a.Matches.TCP = ptr(*a.Matches.TCP)
+	}
+	if a.Matches.UDP != nil {
+		a.Matches.UDP = ptr(*a.Matches.UDP)
+	}
+	if a.Matches.ICMP != nil {
+		a.Matches.ICMP = ptr(*a.Matches.ICMP)
+	}
+	return a
+}
+
+func portMutator(r fs.ValueRange, dst bool) mutator {
+	p := &portJSON{}
+	switch {
+	case r.From == r.To:
+		p.Operator, p.Port = "eq", ptr(uint16(r.From))
+	case r.From == 0:
+		p.Operator, p.Port = "lte", ptr(uint16(r.To))
+	case r.To == 0xffff:
+		p.Operator, p.Port = "gte", ptr(uint16(r.From))
+	default:
+		p.LowerPort, p.UpperPort = ptr(uint16(r.From)), ptr(uint16(r.To))
+	}
+	full := r.From == 0 && r.To == 0xffff
+	return func(a *aceJSON) bool {
+		l4 := a.Matches.TCP
+		if l4 == nil {
+			l4 = a.Matches.UDP
+		}
+		if l4 == nil {
+			return false
+		}
+		if full {
+			return true
+		}
+		if dst {
+			l4.DestinationPort = p
+		} else {
+			l4.SourcePort = p
+		}
+		return true
+	}
+}
+
+func ranges(c fs.FSComponent, max uint64) ([]fs.ValueRange, error) {
+	ops, err := fs.ParseNumericOps(c.Raw)
+	if err != nil {
+		return nil, err
+	}
+	return fs.NumericRanges(ops, max), nil
+}
+
+// values returns the single values a numeric component accepts.
+func values(c fs.FSComponent, max uint64) ([]uint64, error) {
+	rs, err := ranges(c, max)
+	if err != nil {
+		return nil, err
+	}
+	var out []uint64
+	for _, r := range rs {
+		if r.To-r.From >= maxACEs || len(out) > maxACEs {
+			return nil, ErrTooManyEntries
+		}
+		for v := r.From; v <= r.To; v++ {
+			out = append(out, v)
+		}
+	}
+	return out, nil
+}
+
+// tcpFlagMatch accepts a single AND-ed group of "all bits set" operators, the
+// only form the ACL flags leaf can express.
+func tcpFlagMatch(raw []byte) (string, error) {
+	ops, err := fs.ParseBitmaskOps(raw)
+	if err != nil {
+		return "", err
+	}
+	var bits uint64
+	for i, op := range ops {
+		if !op.Match || op.Not || (i > 0 && !op.And) {
+			return "", fmt.Errorf("%w: tcp-flags", ErrNotExpressible)
+		}
+		bits |= op.Value
+	}
+	if bits == 0 || bits > 0xff {
+		return "", fmt.Errorf("%w: tcp-flags", ErrNotExpressible)
+	}
+	var names []string
+	for i, n := range tcpFlags {
+		if bits&(1<<i) != 0 {
+			names = append(names, n)
+		}
+	}
+	return strings.Join(names, " "), nil
+}
+
+func encodeActions(acts []actions.Action) (actionsJSON, error) {
+	out := actionsJSON{Forwarding: ForwardingAccept}
+	rates := 0
+	for _, a := range acts {
+		switch a := a.(type) {
+		case actions.TrafficRateBytes:
+			rates++
+			if a.Rate == 0 {
+				out.Forwarding = ForwardingDrop
+			} else {
+				out.RateLimit = ptr(a.Rate)
+			}
+		case actions.TrafficRatePackets:
+			rates++
+			if a.Rate == 0 {
+				out.Forwarding = ForwardingDrop
+			} else {
+				out.RateLimitP = ptr(a.Rate)
+			}
+		case actions.TrafficMarking:
+			out.Marking = ptr(a.DSCP)
+		default:
+			return actionsJSON{}, fmt.Errorf("%w: %v", ErrUnsupportedAction, a)
+		}
+	}
+	if rates > 1 {
+		return actionsJSON{}, ErrConflictingActions
+	}
+	return out, nil
+}
+
+// Unmarshal parses RFC8519 ACLs into one rule per ACE, named after the ACE.
+// Rules keep the ACL order.
+func Unmarshal(b []byte) ([]Rule, error) {
+	var doc document
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, err
+	}
+	var rules []Rule
+	for _, acl := range doc.ACLs.ACL {
+		for _, ace := range acl.ACEs.ACE {
+			r, err := decodeACE(ace)
+			if err != nil {
+				return nil, fmt.Errorf("ace %q: %w", ace.Name, err)
+			}
+			rules = append(rules, r)
+		}
+	}
+	return rules, nil
+}
+
+func eq(v uint64) []byte {
+	return fs.EncodeNumericOps([]fs.NumericOp{{EQ: true, Value: v}})
+}
+
+func decodeACE(ace aceJSON) (Rule, error) {
+	r := Rule{Name: ace.Name}
+	m := ace.Matches
+	if m.IPv4 != nil && m.IPv6 != nil {
+		return Rule{}, ErrMixedFamilies
+	}
+	l3 := m.IPv4
+	if l3 == nil {
+		l3 = m.IPv6
+	}
+	if l3 == nil {
+		l3 = &l3JSON{}
+	}
+	l4s := 0
+	for _, ok := range []bool{m.TCP != nil, m.UDP != nil, m.ICMP != nil} {
+		if ok {
+			l4s++
+		}
+	}
+	if l4s > 1 {
+		return Rule{}, ErrUnsupportedMatch
+	}
+
+	var comps []fs.FSComponent
+	for _, p := range []struct {
+		t fs.ComponentType
+		s string
+	}{
+		{fs.ComponentTypeDestinationPrefix, l3.DstV4 + l3.DstV6},
+		{fs.ComponentTypeSourcePrefix, l3.SrcV4 + l3.SrcV6},
+	} {
+		if p.s == "" {
+			continue
+		}
+		pfx, err := netip.ParsePrefix(p.s)
+		if err != nil {
+			return Rule{}, err
+		}
+		comps = append(comps, fs.FSComponent{Type: p.t, Prefix: &pfx})
+	}
+
+	proto := l3.Protocol
+	if proto == nil {
+		switch {
+		case m.TCP != nil:
+			proto = ptr(uint8(protoTCP))
+		case m.UDP != nil:
+			proto = ptr(uint8(protoUDP))
+		case m.ICMP != nil && m.IPv6 != nil:
+			proto = ptr(uint8(protoICMPv6))
+		case m.ICMP != nil:
+			proto = ptr(uint8(protoICMP))
+		}
+	}
+	if proto != nil {
+		comps = append(comps, fs.FSComponent{Type: fs.ComponentTypeIpProtocol, Raw: eq(uint64(*proto))})
+	}
+
+	l4 := m.TCP
+	if l4 == nil {
+		l4 = m.UDP
+	}
+	if l4 != nil {
+		for _, p := range []struct {
+			t    fs.ComponentType
+			port *portJSON
+		}{
+			{fs.ComponentTypeDestinationPort, l4.DestinationPort},
+			{fs.ComponentTypeSourcePort, l4.SourcePort},
+		} {
+			if p.port == nil {
+				continue
+			}
+			raw, err := decodePort(p.port)
+			if err != nil {
+				return Rule{}, err
+			}
+			comps = append(comps, fs.FSComponent{Type: p.t, Raw: raw})
+		}
+	}
+	if m.ICMP != nil {
+		if m.ICMP.Type != nil {
+			comps = append(comps, fs.FSComponent{Type: fs.ComponentTypeICMPType, Raw: eq(uint64(*m.ICMP.Type))})
+		}
+		if m.ICMP.Code != nil {
+			comps = append(comps, fs.FSComponent{Type: fs.ComponentTypeICMPCode, Raw: eq(uint64(*m.ICMP.Code))})
+		}
+	}
+	if m.TCP != nil && m.TCP.Flags != "" {
+		var bits uint64
+		for _, f := range strings.Fields(m.TCP.Flags) {
+			i := indexOf(tcpFlags, f)
+			if i < 0 {
+				return Rule{}, fmt.Errorf("%w: tcp flag %q", ErrUnsupportedMatch, f)
+			}
+			bits |= 1 << i
+		}
+		comps = append(comps, fs.FSComponent{Type: fs.ComponentTypeTCPFlags, Raw: fs.EncodeBitmaskOps([]fs.BitmaskOp{{Match: true, Value: bits}})})
+	}
+	if l3.Length != nil {
+		comps = append(comps, fs.FSComponent{Type: fs.ComponentTypePacketLength, Raw: eq(uint64(*l3.Length))})
+	}
+	if l3.DSCP != nil {
+		comps = append(comps, fs.FSComponent{Type: fs.ComponentTypeDSCP, Raw: eq(uint64(*l3.DSCP))})
+	}
+	r.Components = fs.FSComponentList{Components: comps}
+
+	act := ace.Actions
+	switch act.Forwarding {
+	case ForwardingDrop, ForwardingReject:
+		r.Actions = append(r.Actions, actions.TrafficRateBytes{Rate: 0})
+	case ForwardingAccept:
+		if act.RateLimit != nil && act.RateLimitP != nil {
+			return Rule{}, ErrConflictingActions
+		}
+		if act.RateLimit != nil {
+			r.Actions = append(r.Actions, actions.TrafficRateBytes{Rate: *act.RateLimit})
+		}
+		if act.RateLimitP != nil {
+			r.Actions = append(r.Actions, actions.TrafficRatePackets{Rate: *act.RateLimitP})
+		}
+	default:
+		return Rule{}, fmt.Errorf("%w: %q", ErrUnknownForwarding, act.Forwarding)
+	}
+	if act.Marking != nil {
+		r.Actions = append(r.Actions, actions.TrafficMarking{DSCP: *act.Marking})
+	}
+	return r, nil
+}
+
+func decodePort(p *portJSON) ([]byte, error) {
+	if p.LowerPort != nil && p.UpperPort != nil {
+		return fs.EncodeNumericOps([]fs.NumericOp{
+			{GT: true, EQ: true, Value: uint64(*p.LowerPort)},
+			{And: true, LT: true, EQ: true, Value: uint64(*p.UpperPort)},
+		}), nil
+	}
+	if p.Port == nil {
+		return nil, ErrUnsupportedMatch
+	}
+	op := fs.NumericOp{Value: uint64(*p.Port)}
+	switch p.Operator {
+	case "eq", "":
+		op.EQ = true
+	case "lte":
+		op.LT, op.EQ = true, true
+	case "gte":
+		op.GT, op.EQ = true, true
+	case "neq":
+		op.LT, op.GT = true, true
+	default:
+		return nil, fmt.Errorf("%w: port operator %q", ErrUnsupportedMatch, p.Operator)
+	}
+	return fs.EncodeNumericOps([]fs.NumericOp{op}), nil
+}
+
+func indexOf(s []string, v string) int {
+	for i, e := range s {
+		if e == v {
+			return i
+		}
+	}
+	return -1
+}
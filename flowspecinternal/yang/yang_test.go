@@ -0,0 +1,189 @@
+// Copyright (C) 2025 ThorriSnep
+// Licensed under the GNU Affero General Public License v3.0 or later.
+// See the LICENSE file or <https://www.gnu.org/licenses/agpl-3.0.html>.
+
+package yang
+
+import (
+	"encoding/json"
+	"errors"
+	"net/netip"
+	"reflect"
+	"testing"
+
+	fs "floofspectools/flowspecinternal"
+	"floofspectools/flowspecinternal/actions"
+)
+
+func prefix(s string) *netip.Prefix {
+	p := netip.MustParsePrefix(s)
+	return &p
+}
+
+func TestMarshalExpands(t *testing.T) {
+	rules := []Rule{{
+		Name: "web",
+		Components: fs.FSComponentList{Components: []fs.FSComponent{
+			{Type: fs.ComponentTypeDestinationPrefix, Prefix: prefix("192.0.2.0/24")},
+			{Type: fs.ComponentTypeDestinationPort, Raw: []byte{0x01, 0x50, 0x91, 0x01, 0xbb}}, // =80 || =443
+		}},
+		Actions: []actions.Action{actions.TrafficRateBytes{Rate: 0}},
+	}}
+	b, err := Marshal("ddos", rules, nil)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v, want <nil>", err)
+	}
+	var doc document
+	if err := json.Unmarshal(b, &doc); err != nil {
+		t.Fatal(err)
+	}
+	acl := doc.ACLs.ACL[0]
+	if acl.Name != "ddos" || acl.Type != ACLTypeIPv4 {
+		t.Errorf("acl = %q %q, want %q %q", acl.Name, acl.Type, "ddos", ACLTypeIPv4)
+	}
+	// tcp and udp times two ports.
+	if got := len(acl.ACEs.ACE); got != 4 {
+		t.Fatalf("Marshal() = %d ACEs, want 4:\n%s", got, b)
+	}
+	ace := acl.ACEs.ACE[0]
+	if ace.Name != "web.1" || ace.Actions.Forwarding != ForwardingDrop || ace.Matches.TCP == nil ||
+		*ace.Matches.IPv4.Protocol != protoTCP || *ace.Matches.TCP.DestinationPort.Port != 80 {
+		t.Errorf("first ACE = %+v", ace)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		rule Rule
+	}{
+		{
+			name: "IPv6PortRange",
+			rule: Rule{
+				Name: "r",
+				Components: fs.FSComponentList{Components: []fs.FSComponent{
+					{Type: fs.ComponentTypeDestinationPrefix, Prefix: prefix("2001:db8::/32")},
+					{Type: fs.ComponentTypeIpProtocol, Raw: []byte{0x81, 0x11}},
+					{Type: fs.ComponentTypeDestinationPort, Raw: []byte{0x13, 0x04, 0x00, 0xd5, 0x08, 0x00}}, // >=1024 && <=2048
+				}},
+				Actions: []actions.Action{actions.TrafficRateBytes{Rate: 125000}},
+			},
+		},
+		{
+			name: "TCPFlagsAndMarking",
+			rule: Rule{
+				Name: "syn",
+				Components: fs.FSComponentList{Components: []fs.FSComponent{
+					{Type: fs.ComponentTypeSourcePrefix, Prefix: prefix("198.51.100.0/24")},
+					{Type: fs.ComponentTypeIpProtocol, Raw: []byte{0x81, 0x06}},
+					{Type: fs.ComponentTypeTCPFlags, Raw: []byte{0x81, 0x02}},
+					{Type: fs.ComponentTypeDSCP, Raw: []byte{0x81, 0x2e}},
+				}},
+				Actions: []actions.Action{actions.TrafficMarking{DSCP: 10}},
+			},
+		},
+		{
+			name: "ICMP",
+			rule: Rule{
+				Name: "ping",
+				Components: fs.FSComponentList{Components: []fs.FSComponent{
+					{Type: fs.ComponentTypeDestinationPrefix, Prefix: prefix("192.0.2.1/32")},
+					{Type: fs.ComponentTypeIpProtocol, Raw: []byte{0x81, 0x01}},
+					{Type: fs.ComponentTypeICMPType, Raw: []byte{0x81, 0x08}},
+				}},
+				Actions: []actions.Action{actions.TrafficRatePackets{Rate: 100}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := Marshal("acl", []Rule{tt.rule}, nil)
+			if err != nil {
+				t.Fatalf("Marshal() error = %v, want <nil>", err)
+			}
+			got, err := Unmarshal(b)
+			if err != nil {
+				t.Fatalf("Unmarshal(%s) error = %v, want <nil>", b, err)
+			}
+			if len(got) != 1 {
+				t.Fatalf("Unmarshal(%s) = %d rules, want 1", b, len(got))
+			}
+			if got[0].Components.Canonical(nil) != tt.rule.Components.Canonical(nil) {
+				t.Errorf("components = %s, want %s", got[0].Components.Canonical(nil), tt.rule.Components.Canonical(nil))
+			}
+			if !reflect.DeepEqual(got[0].Actions, tt.rule.Actions) {
+				t.Errorf("actions = %+v, want %+v", got[0].Actions, tt.rule.Actions)
+			}
+		})
+	}
+}
+
+func TestMarshalErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    Rule
+		wantErr error
+	}{
+		{
+			name:    "Fragment",
+			rule:    Rule{Components: fs.FSComponentList{Components: []fs.FSComponent{{Type: fs.ComponentTypeFragment, Raw: []byte{0x81, 0x01}}}}},
+			wantErr: ErrNotExpressible,
+		},
+		{
+			name:    "NotFlags",
+			rule:    Rule{Components: fs.FSComponentList{Components: []fs.FSComponent{{Type: fs.ComponentTypeTCPFlags, Raw: []byte{0x83, 0x02}}}}},
+			wantErr: ErrNotExpressible,
+		},
+		{
+			name: "MixedFamilies",
+			rule: Rule{Components: fs.FSComponentList{Components: []fs.FSComponent{
+				{Type: fs.ComponentTypeDestinationPrefix, Prefix: prefix("192.0.2.0/24")},
+				{Type: fs.ComponentTypeSourcePrefix, Prefix: prefix("2001:db8::/32")},
+			}}},
+			wantErr: ErrMixedFamilies,
+		},
+		{
+			name:    "WideLength",
+			rule:    Rule{Components: fs.FSComponentList{Components: []fs.FSComponent{{Type: fs.ComponentTypePacketLength, Raw: []byte{0x92, 0x01, 0x00}}}}}, // >256
+			wantErr: ErrTooManyEntries,
+		},
+		{
+			name:    "Redirect",
+			rule:    Rule{Actions: []actions.Action{actions.Redirect{AS: 64500, Value: 1}}},
+			wantErr: ErrUnsupportedAction,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Marshal("acl", []Rule{tt.rule}, nil); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Marshal() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		wantErr error
+	}{
+		{
+			name:    "Forwarding",
+			in:      `{"ietf-access-control-list:acls":{"acl":[{"name":"a","aces":{"ace":[{"name":"x","matches":{},"actions":{"forwarding":"log"}}]}}]}}`,
+			wantErr: ErrUnknownForwarding,
+		},
+		{
+			name:    "PortOperator",
+			in:      `{"ietf-access-control-list:acls":{"acl":[{"name":"a","aces":{"ace":[{"name":"x","matches":{"udp":{"source-port":{"operator":"range","port":1}}},"actions":{"forwarding":"ietf-access-control-list:accept"}}]}}]}}`,
+			wantErr: ErrUnsupportedMatch,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Unmarshal([]byte(tt.in)); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Unmarshal() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}